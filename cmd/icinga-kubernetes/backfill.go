@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	igldatabase "github.com/icinga/icinga-go-library/database"
+	"github.com/icinga/icinga-go-library/logging"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/metrics"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	promapi "github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	kclientcmd "k8s.io/client-go/tools/clientcmd"
+	"os"
+	"time"
+)
+
+// runBackfill implements the backfill subcommand, which executes the configured Prometheus queries as range queries
+// and stores the results as historical metrics of all clusters with Prometheus configured.
+// It returns 1 if backfilling fails, 0 otherwise.
+func runBackfill(args []string) int {
+	var cmd command
+	var kubeconfig string
+	var kubecontext string
+	var from string
+	var to string
+	var step time.Duration
+
+	flags := pflag.NewFlagSet("backfill", pflag.ContinueOnError)
+	cmd.addFlags(flags, time.Hour, "timeout of the backfill")
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "path to a kube config, ignored if clusters are configured")
+	flags.StringVar(&kubecontext, "context", "", "kube config context to use, ignored if clusters are configured")
+	flags.StringVar(&from, "from", "", "start of the time range to backfill in RFC 3339 format")
+	flags.StringVar(&to, "to", "", "end of the time range to backfill in RFC 3339 format, defaults to now")
+	flags.DurationVar(&step, "step", time.Minute, "resolution of the backfilled metrics")
+
+	var start, end time.Time
+	err := func() error {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		if from == "" {
+			return errors.New("--from is required")
+		}
+
+		var err error
+		start, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return errors.Wrap(err, "invalid --from")
+		}
+
+		end = time.Now()
+		if to != "" {
+			end, err = time.Parse(time.RFC3339, to)
+			if err != nil {
+				return errors.Wrap(err, "invalid --to")
+			}
+		}
+
+		if !start.Before(end) {
+			return errors.New("--from must be before --to")
+		}
+
+		if step < time.Second {
+			return errors.New("--step must be at least one second")
+		}
+
+		cfg, err := cmd.config()
+		if err != nil {
+			return err
+		}
+
+		type cluster struct {
+			name       string
+			kubeconfig string
+			context    string
+			prometheus metrics.PrometheusConfig
+		}
+
+		var clusters []cluster
+		if len(cfg.Clusters) == 0 {
+			if cfg.Prometheus.Url != "" {
+				clusters = append(clusters, cluster{cfg.ClusterName, kubeconfig, kubecontext, cfg.Prometheus})
+			}
+		} else {
+			for _, c := range cfg.Clusters {
+				if c.Prometheus.Url != "" {
+					clusters = append(clusters, cluster{c.Name, c.Kubeconfig, c.Context, c.Prometheus})
+				}
+			}
+		}
+
+		if len(clusters) == 0 {
+			return errors.New("Prometheus is not configured")
+		}
+
+		logs, err := logging.NewLoggingFromConfig("Icinga Kubernetes", cfg.Logging)
+		if err != nil {
+			return errors.Wrap(err, "can't configure logging")
+		}
+
+		db, err := igldatabase.NewDbFromConfig(&cfg.Database, logs.GetChildLogger("database"), igldatabase.RetryConnectorCallbacks{})
+		if err != nil {
+			return err
+		}
+		defer func() { _ = db.Close() }()
+
+		writeLimiter := database.NewWriteLimiter(cfg.WriteLimit)
+
+		ctx, cancel := cmd.context()
+		defer cancel()
+
+		for _, c := range clusters {
+			rules := kclientcmd.NewDefaultClientConfigLoadingRules()
+			rules.ExplicitPath = c.kubeconfig
+
+			kconfig, err := newKubeConfig(kclientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+				rules, &kclientcmd.ConfigOverrides{CurrentContext: c.context}))
+			if err != nil {
+				return err
+			}
+			cfg.Kubernetes.Apply(kconfig)
+
+			clientset, err := kubernetes.NewForConfig(kconfig)
+			if err != nil {
+				return errors.Wrap(err, "can't create Kubernetes client")
+			}
+
+			clusterEntity, err := getCluster(ctx, clientset, c.name)
+			if err != nil {
+				return err
+			}
+
+			promClient, err := promapi.NewClient(promapi.Config{Address: c.prometheus.Url})
+			if err != nil {
+				return errors.Wrap(err, "error creating promClient")
+			}
+
+			logger := logs.GetChildLogger("prometheus")
+			if c.name != "" {
+				logger = logging.NewLogger(logger.With("cluster", c.name), logger.Interval())
+			}
+
+			// Metrics are mapped to nodes, pods and services by name, so the informers are only used as lookup tables
+			// and metrics of objects that no longer exist can't be backfilled.
+			trim := informers.WithTransform(schemav1.Trim)
+			factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, trim)
+			namespacedFactory := informers.NewSharedInformerFactoryWithOptions(
+				clientset, 0, trim, informers.WithTweakListOptions(cfg.Namespaces.TweakListOptions))
+			nodes := factory.Core().V1().Nodes().Informer()
+			pods := namespacedFactory.Core().V1().Pods().Informer()
+			services := namespacedFactory.Core().V1().Services().Informer()
+
+			informerCtx, stopInformers := context.WithCancel(ctx)
+			factory.Start(informerCtx.Done())
+			namespacedFactory.Start(informerCtx.Done())
+
+			name := c.name
+			if name == "" {
+				name = clusterEntity.Uuid.String()
+			}
+
+			backfill := metrics.NewPromMetricBackfill(
+				promv1.NewAPI(promClient), db, writeLimiter, logger, name, clusterEntity.Uuid, cfg.Namespaces.Allowed,
+				promv1.Range{Start: start, End: end, Step: step})
+
+			g, gCtx := errgroup.WithContext(ctx)
+			g.Go(func() error {
+				return backfill.Clusters(gCtx, nodes)
+			})
+			g.Go(func() error {
+				// The queries of Cilium don't return anything if it isn't installed.
+				return backfill.Nodes(gCtx, nodes, true)
+			})
+			g.Go(func() error {
+				return backfill.Pods(gCtx, pods)
+			})
+			g.Go(func() error {
+				return backfill.Containers(gCtx, pods)
+			})
+			g.Go(func() error {
+				return backfill.Services(gCtx, services)
+			})
+
+			err = g.Wait()
+			stopInformers()
+			factory.Shutdown()
+			namespacedFactory.Shutdown()
+
+			if err != nil {
+				return errors.Wrapf(err, "cluster %s", name)
+			}
+		}
+
+		return nil
+	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	fmt.Printf("Backfilled metrics from %s to %s.\n", start.Format(time.RFC3339), end.Format(time.RFC3339))
+
+	return 0
+}
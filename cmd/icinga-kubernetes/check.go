@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/check"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"strings"
+	"time"
+)
+
+// runCheck implements the check subcommand, which reports the state of a single resource
+// as synchronized to the database in the monitoring plugin format and returns the plugin exit code.
+func runCheck(args []string) int {
+	var cmd command
+	var opts check.Options
+
+	flags := pflag.NewFlagSet("check", pflag.ContinueOnError)
+	cmd.addFlags(flags, 30*time.Second, "timeout of the check")
+	flags.StringVar(&opts.Kind, "type", "", "type of the resource to check, one of "+strings.Join(check.KindNames(), ", "))
+	flags.StringVar(&opts.Cluster, "cluster", "", "name of the cluster, only required if the resource exists in multiple clusters")
+	flags.StringVar(&opts.Namespace, "namespace", "default", "namespace of the resource, ignored for cluster-scoped resources")
+	flags.StringVar(&opts.Name, "name", "", "name of the resource")
+	flags.DurationVar(&opts.MaxAge, "max-age", 5*time.Minute, "report unknown if the cluster hasn't been synchronized within this duration, 0 to disable")
+	flags.DurationVar(&opts.MaxSuccessAge, "max-success-age", 0, "report critical if the last success, e.g. the last successful backup of a velero-schedule, is older than this duration, 0 to disable")
+
+	result := func() check.Result {
+		if err := flags.Parse(args); err != nil {
+			return check.Unknown(err)
+		}
+
+		if opts.Kind == "" || opts.Name == "" {
+			return check.Unknown(errors.New("--type and --name are required"))
+		}
+
+		var result check.Result
+		if err := withDatabase(&cmd, func(ctx context.Context, _ *internal.Config, db *database.Database) error {
+			var err error
+			result, err = check.Check(ctx, db, opts)
+
+			return err
+		}); err != nil {
+			return check.Unknown(err)
+		}
+
+		return result
+	}()
+
+	fmt.Println(result)
+
+	return result.ExitCode()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// command holds the options of a subcommand that reads the configuration file.
+type command struct {
+	configLocation string
+	timeout        time.Duration
+}
+
+// addFlags adds the --config flag and the --timeout flag with the given default and usage to flags.
+func (c *command) addFlags(flags *pflag.FlagSet, timeout time.Duration, usage string) {
+	flags.StringVar(&c.configLocation, "config", "./config.yml", "path to the config file")
+	flags.DurationVar(&c.timeout, "timeout", timeout, usage)
+}
+
+// config loads the configuration file.
+func (c *command) config() (*internal.Config, error) {
+	var cfg internal.Config
+	if err := internal.FromYAMLFile(c.configLocation, &cfg); err != nil {
+		return nil, errors.Wrap(err, "can't create configuration")
+	}
+
+	return &cfg, nil
+}
+
+// context returns a context that is canceled on SIGINT or SIGTERM, e.g. Ctrl-C, or once the timeout elapses.
+func (c *command) context() (context.Context, context.CancelFunc) {
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithTimeout(signalCtx, c.timeout)
+
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// withDatabase loads the configuration file of cmd, connects to its database and calls fn with the context of cmd.
+func withDatabase(cmd *command, fn func(context.Context, *internal.Config, *database.Database) error) error {
+	cfg, err := cmd.config()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewFromConfig(&cfg.Database, klog.NewKlogr().WithName("database"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	ctx, cancel := cmd.context()
+	defer cancel()
+
+	return fn(ctx, cfg, db)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/verify"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	kclientcmd "k8s.io/client-go/tools/clientcmd"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runDiff implements the diff subcommand, which lists every object that is missing in the database,
+// has a stale resource version there or doesn't exist in the cluster anymore, per cluster and type.
+// It returns 1 if there are any differences or comparison fails, 0 otherwise.
+func runDiff(args []string) int {
+	var cmd command
+	var kubeconfig string
+	var kubecontext string
+	var cluster string
+	var types []string
+
+	flags := pflag.NewFlagSet("diff", pflag.ContinueOnError)
+	cmd.addFlags(flags, 5*time.Minute, "timeout of the comparison")
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "path to a kube config, ignored if clusters are configured")
+	flags.StringVar(&kubecontext, "context", "", "kube config context to use, ignored if clusters are configured")
+	flags.StringVar(&cluster, "cluster", "", "name of the cluster to compare, all clusters if not set")
+	flags.StringSliceVar(&types, "type", nil, "controllers whose objects to compare, all enabled ones if not set")
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var differences int
+	err := func() error {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		for _, t := range types {
+			if _, ok := verify.Resources()[t]; !ok {
+				return errors.Errorf("unknown type %q, must be one of %s", t, strings.Join(resourceNames(), ", "))
+			}
+		}
+
+		return withDatabase(&cmd, func(ctx context.Context, cfg *internal.Config, db *database.Database) error {
+			type clusterConfig struct {
+				name        string
+				kubeconfig  string
+				context     string
+				controllers []string
+			}
+
+			clusters := []clusterConfig{{cfg.ClusterName, kubeconfig, kubecontext, cfg.Controllers}}
+			if len(cfg.Clusters) > 0 {
+				clusters = clusters[:0]
+				for _, c := range cfg.Clusters {
+					controllers := cfg.Controllers
+					if len(c.Controllers) > 0 {
+						controllers = c.Controllers
+					}
+
+					if cluster == "" || c.Name == cluster {
+						clusters = append(clusters, clusterConfig{c.Name, c.Kubeconfig, c.Context, controllers})
+					}
+				}
+
+				if len(clusters) == 0 {
+					return errors.Errorf("cluster %q is not configured", cluster)
+				}
+			}
+
+			_, _ = fmt.Fprintln(tw, "CLUSTER\tTYPE\tSTATE\tOBJECT")
+
+			for _, c := range clusters {
+				resources := make(map[string]verify.Resource)
+				for name, r := range verify.Resources() {
+					if len(types) > 0 {
+						if slices.Contains(types, name) {
+							resources[name] = r
+						}
+					} else if len(c.controllers) == 0 || slices.Contains(c.controllers, name) {
+						resources[name] = r
+					}
+				}
+
+				rules := kclientcmd.NewDefaultClientConfigLoadingRules()
+				rules.ExplicitPath = c.kubeconfig
+
+				kconfig, err := newKubeConfig(kclientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+					rules, &kclientcmd.ConfigOverrides{CurrentContext: c.context}))
+				if err != nil {
+					return err
+				}
+				cfg.Kubernetes.Apply(kconfig)
+
+				clientset, err := kubernetes.NewForConfig(kconfig)
+				if err != nil {
+					return errors.Wrap(err, "can't create Kubernetes client")
+				}
+
+				metadataClient, err := metadata.NewForConfig(kconfig)
+				if err != nil {
+					return errors.Wrap(err, "can't create Kubernetes metadata client")
+				}
+
+				clusterEntity, err := getCluster(ctx, clientset, c.name)
+				if err != nil {
+					return err
+				}
+
+				name := c.name
+				if name == "" {
+					name = clusterEntity.Uuid.String()
+				}
+
+				diff, err := verify.Diff(ctx, db, metadataClient, clusterEntity.Uuid, &cfg.Namespaces, resources)
+				if err != nil {
+					return errors.Wrapf(err, "cluster %s", name)
+				}
+
+				for _, d := range diff {
+					_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, d.Resource, d.State, d.Object())
+				}
+				differences += len(diff)
+			}
+
+			return nil
+		})
+	}()
+
+	if differences > 0 {
+		_ = tw.Flush()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	if differences > 0 {
+		return 1
+	}
+
+	fmt.Println("No differences found.")
+
+	return 0
+}
+
+// resourceNames returns the sorted names of the controllers whose objects can be compared.
+func resourceNames() []string {
+	var names []string
+	for name := range verify.Resources() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
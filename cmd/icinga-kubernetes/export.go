@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/export"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"os"
+	"strings"
+	"time"
+)
+
+// runExport implements the export subcommand, which prints the manifest of a single resource
+// as last synchronized to the database, and returns the exit code.
+func runExport(args []string) int {
+	var cmd command
+	var opts export.Options
+
+	flags := pflag.NewFlagSet("export", pflag.ContinueOnError)
+	cmd.addFlags(flags, 30*time.Second, "timeout of the export")
+	flags.StringVar(&opts.Kind, "type", "", "type of the resource to export, one of "+strings.Join(export.KindNames(), ", "))
+	flags.StringVar(&opts.Cluster, "cluster", "", "name of the cluster, only required if the resource exists in multiple clusters")
+	flags.StringVar(&opts.Namespace, "namespace", "default", "namespace of the resource, ignored for cluster-scoped resources")
+	flags.StringVar(&opts.Name, "name", "", "name of the resource")
+	flags.StringVarP(&opts.Format, "output", "o", export.Yaml, "output format, yaml or json")
+
+	err := func() error {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		if opts.Kind == "" || opts.Name == "" {
+			return errors.New("--type and --name are required")
+		}
+
+		return withDatabase(&cmd, func(ctx context.Context, _ *internal.Config, db *database.Database) error {
+			manifest, err := export.Export(ctx, db, opts)
+			if err != nil {
+				return err
+			}
+
+			_, err = os.Stdout.Write(manifest)
+
+			return errors.WithStack(err)
+		})
+	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
@@ -3,50 +3,116 @@ package main
 import (
 	"context"
 	"flag"
+	"github.com/go-logr/logr"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
-	"github.com/icinga/icinga-go-library/config"
 	igldatabase "github.com/icinga/icinga-go-library/database"
 	"github.com/icinga/icinga-go-library/logging"
 	"github.com/icinga/icinga-go-library/periodic"
 	"github.com/icinga/icinga-go-library/types"
 	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/api"
+	"github.com/icinga/icinga-kubernetes/pkg/apimetrics"
+	"github.com/icinga/icinga-kubernetes/pkg/archive"
+	"github.com/icinga/icinga-kubernetes/pkg/bus"
+	"github.com/icinga/icinga-kubernetes/pkg/canary"
+	"github.com/icinga/icinga-kubernetes/pkg/capacity"
+	"github.com/icinga/icinga-kubernetes/pkg/certificate"
 	"github.com/icinga/icinga-kubernetes/pkg/com"
+	"github.com/icinga/icinga-kubernetes/pkg/cost"
+	"github.com/icinga/icinga-kubernetes/pkg/cronjob"
+	"github.com/icinga/icinga-kubernetes/pkg/daemonset"
 	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/debug"
+	"github.com/icinga/icinga-kubernetes/pkg/disruption"
+	"github.com/icinga/icinga-kubernetes/pkg/downtime"
+	"github.com/icinga/icinga-kubernetes/pkg/etcd"
+	"github.com/icinga/icinga-kubernetes/pkg/exporter"
+	"github.com/icinga/icinga-kubernetes/pkg/health"
+	"github.com/icinga/icinga-kubernetes/pkg/history"
+	"github.com/icinga/icinga-kubernetes/pkg/icinga2"
+	"github.com/icinga/icinga-kubernetes/pkg/imagepull"
+	"github.com/icinga/icinga-kubernetes/pkg/ingress"
 	"github.com/icinga/icinga-kubernetes/pkg/metrics"
+	"github.com/icinga/icinga-kubernetes/pkg/plugin"
+	"github.com/icinga/icinga-kubernetes/pkg/probe"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	"github.com/icinga/icinga-kubernetes/pkg/pullsecret"
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	"github.com/icinga/icinga-kubernetes/pkg/rightsizing"
 	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/service"
+	"github.com/icinga/icinga-kubernetes/pkg/supervisor"
 	"github.com/icinga/icinga-kubernetes/pkg/sync"
 	syncv1 "github.com/icinga/icinga-kubernetes/pkg/sync/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/upgrade"
+	"github.com/icinga/icinga-kubernetes/pkg/webhook"
 	k8sMysql "github.com/icinga/icinga-kubernetes/schema/mysql"
 	"github.com/pkg/errors"
 	promapi "github.com/prometheus/client_golang/api"
 	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
+	kcorev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
+	kcache "k8s.io/client-go/tools/cache"
 	kclientcmd "k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	"os"
+	"os/signal"
+	"path"
+	rtdebug "runtime/debug"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 )
 
 func main() {
 	runtime.ReallyCrash = true
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backfill":
+			os.Exit(runBackfill(os.Args[2:]))
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "snapshot":
+			os.Exit(runSnapshot(os.Args[2:]))
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		}
+	}
+
 	var configLocation string
 	var showVersion bool
+	var once bool
 
 	klog.InitFlags(nil)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 
 	pflag.BoolVar(&showVersion, "version", false, "print version and exit")
 	pflag.StringVar(&configLocation, "config", "./config.yml", "path to the config file")
+	pflag.BoolVar(&once, "once", false, "synchronize all resources and metrics once and exit")
 
+	// Without a kubeconfig, the in-cluster configuration is used if running within Kubernetes.
+	// Don't set loadingRules.DefaultClientConfig, as otherwise http://localhost:8080 is silently used as a last resort.
 	loadingRules := kclientcmd.NewDefaultClientConfigLoadingRules()
-	loadingRules.DefaultClientConfig = &kclientcmd.DefaultClientConfig
 	pflag.StringVar(&loadingRules.ExplicitPath, "kubeconfig", "", "Path to a kube config. Only required if out-of-cluster")
 
 	overrides := kclientcmd.ConfigOverrides{}
@@ -61,29 +127,79 @@ func main() {
 		os.Exit(0)
 	}
 
-	kconfig, err := kclientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &overrides).ClientConfig()
+	log := klog.NewKlogr()
+
+	var cfg internal.Config
+	err := internal.FromYAMLFile(configLocation, &cfg)
 	if err != nil {
-		if kclientcmd.IsEmptyConfig(err) {
-			klog.Fatal(
-				"no configuration provided: set KUBECONFIG environment variable or --kubeconfig CLI flag to" +
-					" a kubeconfig file with cluster access configured")
-		}
+		klog.Fatal(errors.Wrap(err, "can't create configuration"))
+	}
 
-		klog.Fatal(errors.Wrap(err, "can't configure Kubernetes client"))
+	if limit, ok := cfg.MemoryLimitBytes(); ok && os.Getenv("GOMEMLIMIT") == "" {
+		rtdebug.SetMemoryLimit(limit)
 	}
 
-	clientset, err := kubernetes.NewForConfig(kconfig)
-	if err != nil {
-		klog.Fatal(err)
+	// Options that can't be overridden per cluster are the same for all of them.
+	base := clusterConfig{
+		namespaces:       &cfg.Namespaces,
+		workloads:        cfg.Icinga2.Workloads,
+		downtimes:        cfg.Downtimes,
+		flapping:         cfg.Flapping,
+		acknowledgements: cfg.Acknowledgements,
+		plugins:          cfg.Plugins,
+		cost:             &cfg.Cost,
+		capacity:         &cfg.Capacity,
+		rightsizing:      &cfg.Rightsizing,
+		certificates:     &cfg.Certificates,
+		probes:           &cfg.Probes,
+		canary:           &cfg.Canary,
+		containerLogs:    cfg.ContainerLogsEnabled(),
 	}
 
-	factory := informers.NewSharedInformerFactory(clientset, 0)
-	log := klog.NewKlogr()
+	var clusters []clusterConfig
+	if len(cfg.Clusters) == 0 {
+		kconfig, err := newKubeConfig(kclientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &overrides))
+		if err != nil {
+			klog.Fatal(err)
+		}
 
-	var cfg internal.Config
-	err = config.FromYAMLFile(configLocation, &cfg)
-	if err != nil {
-		klog.Fatal(errors.Wrap(err, "can't create configuration"))
+		c := base
+		c.name = cfg.ClusterName
+		c.kconfig = kconfig
+		c.prometheus = cfg.Prometheus
+		c.thresholds = cfg.Thresholds
+		c.namespaceOverrides = cfg.NamespaceOverrides
+		c.controllers = cfg.Controllers
+		c.kubernetes = cfg.Kubernetes
+		c.log = log
+		clusters = append(clusters, c)
+	} else {
+		for _, cc := range cfg.Clusters {
+			rules := kclientcmd.NewDefaultClientConfigLoadingRules()
+			rules.ExplicitPath = cc.Kubeconfig
+
+			kconfig, err := newKubeConfig(kclientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+				rules, &kclientcmd.ConfigOverrides{CurrentContext: cc.Context}))
+			if err != nil {
+				klog.Fatal(errors.Wrapf(err, "cluster %s", cc.Name))
+			}
+
+			controllers := cfg.Controllers
+			if len(cc.Controllers) > 0 {
+				controllers = cc.Controllers
+			}
+
+			c := base
+			c.name = cc.Name
+			c.kconfig = kconfig
+			c.prometheus = cc.Prometheus
+			c.thresholds = cfg.Thresholds.Merge(cc.Thresholds)
+			c.namespaceOverrides = slices.Concat(cfg.NamespaceOverrides, cc.NamespaceOverrides)
+			c.controllers = controllers
+			c.kubernetes = cc.KubernetesOf(cfg.Kubernetes)
+			c.log = log.WithValues("cluster", cc.Name)
+			clusters = append(clusters, c)
+		}
 	}
 
 	dbLog := log.WithName("database")
@@ -91,6 +207,7 @@ func main() {
 	if err != nil {
 		klog.Fatal(err)
 	}
+	db.SetWriteLimiter(database.NewWriteLimiter(cfg.WriteLimit))
 	if !db.Connect() {
 		return
 	}
@@ -110,13 +227,612 @@ func main() {
 				}
 			}
 		}
+	} else {
+		if err := dbUpgradeSchema(db, dbLog); err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	var logs *logging.Logging
+	var db2 *igldatabase.DB
+	if slices.ContainsFunc(clusters, func(c clusterConfig) bool { return c.prometheus.Url != "" }) {
+		logs, err = logging.NewLoggingFromConfig("Icinga Kubernetes", cfg.Logging)
+		if err != nil {
+			klog.Fatal(errors.Wrap(err, "can't configure logging"))
+		}
+
+		db2, err = igldatabase.NewDbFromConfig(&cfg.Database, logs.GetChildLogger("database"), igldatabase.RetryConnectorCallbacks{})
+		if err != nil {
+			klog.Fatal("IGL_DATABASE: ", err)
+		}
+	}
+
+	var debugServer *debug.Server
+	if cfg.Debug.Listen != "" {
+		debugServer = debug.NewServer(cfg.Debug.Listen)
+
+		// Not part of the errgroup, so that it doesn't keep a single synchronization with --once from exiting.
+		go func() {
+			defer runtime.HandleCrash()
+
+			klog.Fatal(debugServer.ListenAndServe())
+		}()
+	}
+
+	var icinga2Client *icinga2.Client
+	if cfg.Icinga2.Url != "" && !once {
+		icinga2Client, err = icinga2.NewClient(&cfg.Icinga2)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	// Cancel the context on shutdown, so that in-flight API requests and database writes are aborted.
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	g, ctx := errgroup.WithContext(signalCtx)
+
+	// Webhooks are only notified of problems while running continuously.
+	var sinks []*webhook.Sink
+	if !once {
+		for i := range cfg.Webhooks {
+			sink, err := webhook.NewSink(&cfg.Webhooks[i], log.WithName("webhook"))
+			if err != nil {
+				klog.Fatal(err)
+			}
+
+			sinks = append(sinks, sink)
+
+			g.Go(func() error {
+				defer runtime.HandleCrash()
+
+				return sink.Run(ctx)
+			})
+		}
+	}
+
+	// Like webhooks, the event bus only publishes while running continuously.
+	var eventBus *bus.Bus
+	if cfg.EventBus.Type != "" && !once {
+		eventBus, err = bus.NewBus(&cfg.EventBus, log.WithName("event-bus"))
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		g.Go(func() error {
+			defer runtime.HandleCrash()
+
+			return eventBus.Run(ctx)
+		})
+	}
+
+	// The API is only served while running continuously.
+	var changes *api.Changes
+	if cfg.Api.Enabled() && !once {
+		changes = api.NewChanges()
+		apiServer := api.NewServer(cfg.Api, db, changes, log.WithName("api"))
+
+		if cfg.Api.Listen != "" {
+			g.Go(func() error {
+				defer runtime.HandleCrash()
+
+				return apiServer.ListenAndServe(ctx)
+			})
+		}
+
+		if cfg.Api.GrpcListen != "" {
+			g.Go(func() error {
+				defer runtime.HandleCrash()
+
+				return apiServer.ListenAndServeGrpc(ctx)
+			})
+		}
+	}
+
+	// Like the API, the exporter is only served while running continuously.
+	if cfg.Exporter.Listen != "" && !once {
+		exporterServer := exporter.NewServer(cfg.Exporter, db, log.WithName("exporter"))
+
+		g.Go(func() error {
+			defer runtime.HandleCrash()
+
+			return exporterServer.ListenAndServe(ctx)
+		})
+	}
+
+	shared := services{
+		db2:           db2,
+		logs:          logs,
+		debugServer:   debugServer,
+		icinga2Client: icinga2Client,
+		sinks:         sinks,
+		eventBus:      eventBus,
+		changes:       changes,
+	}
+
+	for _, c := range clusters {
+		c.kubernetes.Apply(c.kconfig)
+
+		g.Go(func() error {
+			defer runtime.HandleCrash()
+
+			return syncCluster(ctx, c, db, shared, once)
+		})
+	}
+
+	// Retention is meaningless for a single synchronization.
+	if !once {
+		var archiver *archive.Archiver
+		if cfg.Archive.Endpoint != "" {
+			archiver, err = archive.NewArchiver(&cfg.Archive, log.WithName("archive"))
+			if err != nil {
+				klog.Fatal(err)
+			}
+		}
+
+		const week, month, quarter = 7 * 24 * time.Hour, 30 * 24 * time.Hour, 90 * 24 * time.Hour
+
+		// Rows are deleted once older than their retention, which defaults to a day, and archived before if configured.
+		cleanups := []database.CleanupStmt{
+			{Table: "event", PK: "uuid", Column: "created"},
+			{Table: "state_history", PK: "uuid", Column: "event_time", Retention: month},
+			{Table: "container_restart", PK: "uuid", Column: "event_time", Retention: month},
+			{Table: "pod_eviction", PK: "uuid", Column: "event_time", Retention: month},
+			{Table: "hpa_scaling", PK: "uuid", Column: "event_time", Retention: month},
+			{Table: "image_pull", PK: "uuid", Column: "last_seen", Retention: month},
+			{Table: "job_failure", PK: "uuid", Column: "failed", Retention: month},
+			{Table: "problem", PK: "uuid", Column: "cleared", Retention: month},
+			{Table: "certificate_problem", PK: "uuid", Column: "cleared", Retention: month},
+			{Table: "hpa_problem", PK: "uuid", Column: "cleared", Retention: month},
+			{Table: "cron_job_problem", PK: "uuid", Column: "cleared", Retention: month},
+			{Table: "resource_quota_problem", PK: "uuid", Column: "cleared", Retention: month},
+			{Table: "service_problem", PK: "uuid", Column: "cleared", Retention: month},
+			{Table: "gitops_problem", PK: "uuid", Column: "cleared", Retention: month},
+			{Table: "canary_run", PK: "uuid", Column: "started", Retention: month},
+			{Table: "problem_comment", PK: "uuid", Column: "created", Retention: month},
+			{Table: "flapping_history", PK: "uuid", Column: "end_time", Retention: month},
+			{Table: "cost_namespace", PK: "(cluster_uuid, namespace, hour)", Column: "hour", Retention: quarter},
+			{Table: "cost_workload", PK: "(cluster_uuid, namespace, kind, name, hour)", Column: "hour", Retention: quarter},
+			// Resource quota usage is kept for the week that forecasts are computed from.
+			{
+				Table: "resource_quota_usage", PK: "(cluster_uuid, namespace, name, resource, timestamp)",
+				Column: "timestamp", Retention: week,
+			},
+			{Table: "api_request", PK: "uuid", Column: "timestamp"},
+			// API warnings that haven't been received for a month are deleted.
+			{Table: "api_warning", PK: "uuid", Column: "last_seen", Retention: month},
+			// The etcd inventory is kept for a quarter, so that its growth can be tracked over months.
+			{Table: "etcd_object_count", PK: "uuid", Column: "timestamp", Retention: quarter},
+			{Table: "etcd_size", PK: "uuid", Column: "timestamp", Retention: quarter},
+			{Table: "prometheus_cluster_metric", PK: "(cluster_uuid, timestamp, category, name)", Column: "timestamp"},
+			{Table: "prometheus_node_metric", PK: "(node_uuid, timestamp, category, name)", Column: "timestamp"},
+			{Table: "prometheus_pod_metric", PK: "(pod_uuid, timestamp, category, name)", Column: "timestamp"},
+			{Table: "prometheus_container_metric", PK: "(container_uuid, timestamp, category, name)", Column: "timestamp"},
+			{Table: "prometheus_service_metric", PK: "(service_uuid, timestamp, category, name)", Column: "timestamp"},
+		}
+
+		for _, stmt := range cleanups {
+			stmt.Archiver = archiver.For(stmt.Table)
+
+			g.Go(func() error {
+				return db.PeriodicCleanup(ctx, stmt)
+			})
+		}
 	}
 
-	g, ctx := errgroup.WithContext(context.Background())
+	if err := g.Wait(); err != nil {
+		if signalCtx.Err() == nil || !errors.Is(err, context.Canceled) {
+			klog.Fatal(err)
+		}
+
+		log.Info("Shut down")
+
+		return
+	}
+
+	if once {
+		log.Info("Finished synchronizing once")
+	}
+}
+
+// clusterConfig defines a cluster to synchronize and the options of its synchronization.
+type clusterConfig struct {
+	name       string
+	kconfig    *rest.Config
+	prometheus metrics.PrometheusConfig
+	thresholds schemav1.Thresholds
+	// namespaceOverrides override the configuration for the matching namespaces, the cluster-specific ones last.
+	namespaceOverrides []internal.NamespaceOverrides
+	// controllers restricts synchronization to the listed controllers. If empty, all controllers are run.
+	controllers []string
+	// kubernetes is the Kubernetes configuration with the overrides of the cluster applied.
+	kubernetes internal.KubernetesConfig
+	namespaces *sync.NamespacesConfig
+	// workloads lists the controllers of workloads that are registered in Icinga 2 in addition to nodes.
+	workloads        []string
+	downtimes        []downtime.Window
+	flapping         history.FlappingConfig
+	acknowledgements problem.AcknowledgementsConfig
+	plugins          []plugin.Config
+	cost             *cost.Config
+	capacity         *capacity.Config
+	rightsizing      *rightsizing.Config
+	certificates     *certificate.Config
+	probes           *probe.Config
+	canary           *canary.Config
+	containerLogs    bool
+	log              logr.Logger
+}
+
+// services are shared by the synchronizations of all clusters. All but the database are optional.
+type services struct {
+	db2           *igldatabase.DB
+	logs          *logging.Logging
+	debugServer   *debug.Server
+	icinga2Client *icinga2.Client
+	sinks         []*webhook.Sink
+	eventBus      *bus.Bus
+	changes       *api.Changes
+}
+
+// newKubeConfig returns the Kubernetes client configuration from the given kubeconfig.
+func newKubeConfig(clientConfig kclientcmd.ClientConfig) (*rest.Config, error) {
+	kconfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		if kclientcmd.IsEmptyConfig(err) {
+			return nil, errors.New(
+				"no configuration provided: set KUBECONFIG environment variable or --kubeconfig CLI flag to" +
+					" a kubeconfig file with cluster access configured or run within a Kubernetes cluster")
+		}
+
+		return nil, errors.Wrap(err, "can't configure Kubernetes client")
+	}
+
+	return kconfig, nil
+}
+
+// syncCluster synchronizes all resources and, if Prometheus is configured, metrics of the given cluster
+// to the database until ctx is canceled or an error occurs.
+// Each cluster uses its own errgroup and informers,
+// so that nothing but the given services is shared with other clusters.
+func syncCluster(ctx context.Context, c clusterConfig, db *database.Database, s services, once bool) error {
+	// All clients of the cluster are created from its config,
+	// so that all their requests are recorded and the warnings of their responses are captured.
+	requests := apimetrics.NewRecorder()
+	c.kconfig.Wrap(requests.Wrap)
+	warnings := upgrade.NewWarnings()
+	c.kconfig.Wrap(warnings.Wrap)
+
+	clientset, err := kubernetes.NewForConfig(c.kconfig)
+	if err != nil {
+		return errors.Wrap(err, "can't create Kubernetes client")
+	}
+
+	log := c.log
+	log.Info("Connecting to Kubernetes API server", "host", c.kconfig.Host)
+
+	// Cluster-scoped resources aren't subject to namespace filtering,
+	// so they use a separate informer factory from namespaced resources and namespaces themselves.
+	// Controllers and metric syncs of the same resource share its informer.
+	// Objects are trimmed before caching to reduce memory usage.
+	// Informers check for due resyncs in the shortest resync interval,
+	// while each controller resyncs in its own or that of the namespace of an object.
+	resync := internal.NamespaceResyncCheck(c.kubernetes.ResyncCheck(), c.namespaceOverrides)
+	trim := informers.WithTransform(schemav1.Trim)
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, resync, trim)
+	namespacedFactory := informers.NewSharedInformerFactoryWithOptions(
+		clientset, resync, trim, informers.WithTweakListOptions(c.namespaces.TweakListOptions))
+	namespaceFactory := informers.NewSharedInformerFactoryWithOptions(
+		clientset, resync, trim, informers.WithTweakListOptions(c.namespaces.TweakNamespaceListOptions))
+
+	dynamicClient, err := dynamic.NewForConfig(c.kconfig)
+	if err != nil {
+		return errors.Wrap(err, "can't create dynamic Kubernetes client")
+	}
+	dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resync)
+	dynamicNamespacedFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(
+		dynamicClient, resync, kmetav1.NamespaceAll, c.namespaces.TweakListOptions)
+
+	metadataClient, err := metadata.NewForConfig(c.kconfig)
+	if err != nil {
+		return errors.Wrap(err, "can't create metadata Kubernetes client")
+	}
+	metadataFactory := metadatainformer.NewSharedInformerFactory(metadataClient, resync)
+	metadataNamespacedFactory := metadatainformer.NewFilteredSharedInformerFactory(
+		metadataClient, resync, kmetav1.NamespaceAll, c.namespaces.TweakListOptions)
+
+	features := []sync.Feature{
+		sync.WithDebounce(c.kubernetes.Debounce), sync.WithRelationWorkers(c.kubernetes.RelationWorkers)}
+	if once {
+		features = append(features, sync.WithOnce())
+	}
+	// Clip so that appending to features always copies and the slices don't share their backing arrays.
+	features = slices.Clip(features)
+
+	// namespaced returns the features of the namespaced controller with the given name, which only synchronizes
+	// objects of the configured namespaces for which it is enabled, and resyncs them in the interval of their namespace.
+	namespaced := func(name string) []sync.Feature {
+		return append(
+			features,
+			sync.WithFilter(func(obj kmetav1.Object) bool {
+				return c.namespaces.Filter(obj) &&
+					internal.ControllerEnabledIn(c.namespaceOverrides, name, obj.GetNamespace())
+			}),
+			sync.WithResync(internal.NamespaceResyncCheck(c.kubernetes.ResyncOf(name), c.namespaceOverrides)),
+			sync.WithResyncOf(func(namespace string) time.Duration {
+				if resync, ok := internal.ResyncIn(c.namespaceOverrides, namespace); ok {
+					return resync
+				}
+
+				return c.kubernetes.ResyncOf(name)
+			}))
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	cluster, err := getCluster(ctx, clientset, c.name)
+	if err != nil {
+		return err
+	}
+	clusterUuid := cluster.Uuid
+
+	stmt, _ := db.BuildUpsertStmt(cluster)
+	if _, err := db.NamedExecContext(ctx, stmt, cluster); err != nil {
+		return errors.Wrap(err, "can't update cluster")
+	}
+
+	if err := adoptRows(ctx, db, clusterUuid, log); err != nil {
+		return err
+	}
+
+	// Delete instances from previous runs. If only some controllers are run, other instances synchronize
+	// the same cluster, so only instances without a recent heartbeat are deleted.
+	instances := "cluster_uuid=?"
+	args := []any{clusterUuid}
+	if len(c.controllers) > 0 {
+		instances += " AND heartbeat<?"
+		args = append(args, time.Now().Add(-5*time.Minute).UnixMilli())
+	}
+
+	if _, err := db.ExecContext(ctx, db.Rebind(
+		"DELETE FROM kubernetes_instance_controller WHERE instance_uuid IN "+
+			"(SELECT uuid FROM kubernetes_instance WHERE "+instances+")"), args...); err != nil {
+		return errors.Wrap(err, "can't delete instance controllers")
+	}
+
+	if _, err := db.ExecContext(ctx, db.Rebind(
+		"DELETE FROM kubernetes_instance_metric WHERE instance_uuid IN "+
+			"(SELECT uuid FROM kubernetes_instance WHERE "+instances+")"), args...); err != nil {
+		return errors.Wrap(err, "can't delete instance metrics")
+	}
+
+	if _, err := db.ExecContext(ctx, db.Rebind("DELETE FROM kubernetes_instance WHERE "+instances), args...); err != nil {
+		return errors.Wrap(err, "can't delete instance")
+	}
+
+	var statuses sync.Statuses
+
+	enabled := func(controller string) bool {
+		return len(c.controllers) == 0 || slices.Contains(c.controllers, controller)
+	}
+
+	// Controllers and other tasks are restarted if they fail, so that they don't stop unrelated tasks.
+	// With once, errors stop all tasks instead.
+	sup := supervisor.New(ctx, g, !once, log.WithName("supervisor"))
+
+	// goSync runs fn supervised if the controller with the given name is enabled.
+	goSync := func(name string, fn func() error) {
+		if enabled(name) {
+			sup.Go(name, supervisor.OnFailure, fn)
+		}
+	}
+
+	// served returns whether the API server serves the resource handled by h, which is only checked if it is optional.
+	served := func(h registry.Handler) (bool, error) {
+		if !h.Optional {
+			return true, nil
+		}
+
+		resources, err := clientset.Discovery().ServerResourcesForGroupVersion(h.Gvr.GroupVersion().String())
+		if kerrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "can't discover resources of %s", h.Gvr.GroupVersion())
+		}
+
+		for _, r := range resources.APIResources {
+			if r.Name == h.Gvr.Resource {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	// observe returns a feature recording the status of the controller with the given name
+	// and streaming the changes it writes to API clients.
+	observe := func(name string) sync.Feature {
+		return func(f *sync.Features) {
+			sync.WithStatus(statuses.Get(name))(f)
+			sync.WithOnUpsert(s.changes.Upserted(c.name, name))(f)
+			sync.WithOnDelete(s.changes.Deleted(c.name, name))(f)
+		}
+	}
+
+	// annotations returns the annotations of objects in store by key, if already listed.
+	annotations := func(store kcache.Store) func(string) map[string]string {
+		return func(key string) map[string]string {
+			// The store may also contain placeholders from warmup, which don't carry annotations.
+			if obj, exists, _ := store.GetByKey(key); exists {
+				if _, placeholder := obj.(schemav1.Resource); !placeholder {
+					return obj.(kmetav1.Object).GetAnnotations()
+				}
+			}
+
+			return nil
+		}
+	}
+	namespaceAnnotations := annotations(namespaceFactory.Core().V1().Namespaces().Informer().GetStore())
+	downtimes := downtime.NewDowntimes(
+		c.downtimes, namespaceAnnotations, annotations(factory.Core().V1().Nodes().Informer().GetStore()))
+
+	drains := downtime.NewDrains(annotations(factory.Core().V1().Nodes().Informer().GetStore()))
+
+	// nodeUuid returns the UUID of the node with the given name, if already listed.
+	nodeUuid := func(name string) (types.UUID, bool) {
+		if obj, exists, _ := factory.Core().V1().Nodes().Informer().GetStore().GetByKey(name); exists {
+			if node, ok := obj.(*kcorev1.Node); ok {
+				return schemav1.EnsureUUID(node.UID), true
+			}
+		}
+
+		return types.UUID{}, false
+	}
+
+	flapping := history.NewFlapping(c.flapping, db, clusterUuid)
+	if err := flapping.Load(ctx); err != nil {
+		return err
+	}
+
+	// Flapping ends over time, which is meaningless for a single synchronization.
+	if !once {
+		sup.Go("flapping", supervisor.OnFailure, func() error {
+			return flapping.Run(ctx)
+		})
+	}
+
+	restarts := history.NewRestarts(db, clusterUuid)
+	if enabled("pods") {
+		if err := restarts.Load(ctx); err != nil {
+			return err
+		}
+	}
+
+	rollup := health.NewRollup(db, clusterUuid)
+
+	// withStateHistory returns a feature recording the state transitions of the resources created by newResource,
+	// whose objects are cached by informer, and rolling up their states to the health of namespaces.
+	withStateHistory := func(newResource func() schemav1.Resource, informer kcache.SharedIndexInformer) (sync.Feature, error) {
+		h := history.NewStateHistory(db, clusterUuid, newResource().(schemav1.Stater), func(resource schemav1.Resource) bool {
+			key, _ := kcache.MetaNamespaceKeyFunc(resource)
+			objAnnotations := annotations(informer.GetStore())(key)
+
+			var node string
+			if _, ok := resource.(*schemav1.Node); ok {
+				node = resource.GetName()
+			} else if pod, ok := resource.(*schemav1.Pod); ok {
+				node = pod.NodeName.String
+			}
+
+			return downtimes.In(resource.GetNamespace(), node, objAnnotations, time.Now())
+		}, flapping)
+		if err := h.Load(ctx); err != nil {
+			return nil, err
+		}
+
+		resourceType := database.TableName(newResource())
+		if err := rollup.Load(ctx, resourceType); err != nil {
+			return nil, err
+		}
+
+		return func(f *sync.Features) {
+			sync.WithOnUpsert(h.Upserted)(f)
+			sync.WithOnDelete(h.Deleted)(f)
+			sync.WithOnUpsert(rollup.Upserted(resourceType))(f)
+			sync.WithOnDelete(rollup.Deleted(resourceType))(f)
+		}, nil
+	}
+
+	var nodeMemoryUsage func(types.UUID) (float64, bool)
+	var promMetricSync *metrics.PromMetricSync
+	if c.prometheus.Url != "" {
+		promClient, err := promapi.NewClient(promapi.Config{Address: c.prometheus.Url})
+		if err != nil {
+			return errors.Wrap(err, "error creating promClient")
+		}
+
+		logger := s.logs.GetChildLogger("prometheus")
+		if c.name != "" {
+			logger = logging.NewLogger(logger.With("cluster", c.name), logger.Interval())
+		}
+
+		promApiClient := promv1.NewAPI(promClient)
+		name := c.name
+		if name == "" {
+			name = clusterUuid.String()
+		}
+
+		promMetricSync = metrics.NewPromMetricSync(
+			promApiClient, s.db2, db.WriteLimiter(), logger, name, clusterUuid, c.namespaces.Allowed, &c.prometheus, once)
+		nodeMemoryUsage = promMetricSync.NodeMemoryUsage
+
+		// The metric syncs wait for the informers run by the respective controllers.
+		if enabled("nodes") {
+			sup.Go("cluster-metrics", supervisor.OnFailure, func() error {
+				return promMetricSync.Clusters(ctx, factory.Core().V1().Nodes().Informer())
+			})
+
+			// The health of the Cilium agents is only queried if Cilium is installed.
+			h, _ := registry.Lookup("cilium-endpoints")
+			cilium, err := served(h)
+			if err != nil {
+				return err
+			}
+
+			sup.Go("node-metrics", supervisor.OnFailure, func() error {
+				return promMetricSync.Nodes(ctx, factory.Core().V1().Nodes().Informer(), cilium)
+			})
+
+			// Disks are only reported by node-exporter of nodes that expose their SMART attributes.
+			sup.Go("node-disks", supervisor.OnFailure, func() error {
+				return promMetricSync.NodeDisks(ctx, factory.Core().V1().Nodes().Informer())
+			})
+		}
+
+		if enabled("pods") {
+			sup.Go("pod-metrics", supervisor.OnFailure, func() error {
+				return promMetricSync.Pods(ctx, namespacedFactory.Core().V1().Pods().Informer())
+			})
+
+			sup.Go("container-metrics", supervisor.OnFailure, func() error {
+				return promMetricSync.Containers(ctx, namespacedFactory.Core().V1().Pods().Informer())
+			})
+		}
+
+		// Request metrics of services are only available if Istio is installed.
+		if enabled("services") {
+			h, _ := registry.Lookup("istio-virtual-services")
+			istio, err := served(h)
+			if err != nil {
+				return err
+			}
+
+			if istio {
+				sup.Go("service-metrics", supervisor.OnFailure, func() error {
+					return promMetricSync.Services(ctx, namespacedFactory.Core().V1().Services().Informer())
+				})
+			}
+		}
+
+		// Capacity is forecast from the trend of the node and pod metrics.
+		if enabled("nodes") && enabled("pods") && !once {
+			sup.Go("capacity", supervisor.OnFailure, func() error {
+				return capacity.NewForecaster(db, clusterUuid, c.capacity, log.WithName("capacity")).Run(ctx)
+			})
+		}
 
-	if _, err := db.ExecContext(ctx, "DELETE FROM kubernetes_instance"); err != nil {
-		klog.Fatal(errors.Wrap(err, "can't delete instance"))
+		// Recommendations are computed from the container usage in Prometheus, as it exceeds the metric retention.
+		if c.rightsizing.Enabled() && enabled("pods") && !once {
+			sup.Go("rightsizing", supervisor.OnFailure, func() error {
+				return rightsizing.NewRecommender(
+					db, promMetricSync, clusterUuid, c.rightsizing, log.WithName("rightsizing"),
+				).Run(ctx)
+			})
+		}
 	}
+
 	// ,omitempty
 	var kubernetesVersion string
 	var kubernetesHeartbeat time.Time
@@ -128,8 +844,15 @@ func main() {
 			kubernetesHeartbeat = tick.Time
 		}
 
+		// Report tasks that failed recently, unless the API server isn't reachable, which is likely the cause.
+		var message any = err
+		if err == nil {
+			message = sup.Unhealthy()
+		}
+
 		instance := schemav1.Instance{
 			Uuid:                instanceId[:],
+			ClusterUuid:         clusterUuid,
 			Version:             internal.Version.Version,
 			KubernetesVersion:   schemav1.NewNullableString(kubernetesVersion),
 			KubernetesHeartbeat: types.UnixMilli(kubernetesHeartbeat),
@@ -137,7 +860,7 @@ func main() {
 				Bool:  err == nil,
 				Valid: true,
 			},
-			Message:   schemav1.NewNullableString(err),
+			Message:   schemav1.NewNullableString(message),
 			Heartbeat: types.UnixMilli(tick.Time),
 		}
 
@@ -146,172 +869,612 @@ func main() {
 		if _, err := db.NamedExecContext(ctx, stmt, instance); err != nil {
 			klog.Error(errors.Wrap(err, "can't update instance"))
 		}
+
+		for name, status := range statuses.All() {
+			controller := schemav1.InstanceController{
+				InstanceUuid: instanceId[:],
+				Name:         name,
+				LastSync:     types.UnixMilli(status.LastSync()),
+				LastEvent:    types.UnixMilli(status.LastEvent()),
+				QueueDepth:   status.QueueDepth(),
+				Errors:       status.Errors(),
+			}
+
+			stmt, _ := db.BuildUpsertStmt(controller)
+
+			if _, err := db.NamedExecContext(ctx, stmt, controller); err != nil {
+				klog.Error(errors.Wrap(err, "can't update instance controller"))
+			}
+		}
+
+		if promMetricSync != nil {
+			for _, f := range promMetricSync.Freshness() {
+				metric := schemav1.InstanceMetric{
+					InstanceUuid: instanceId[:],
+					Kind:         f.Kind,
+					Category:     f.Category,
+					LastQuery:    types.UnixMilli(f.LastQuery),
+					Backlog:      f.Backlog,
+				}
+
+				stmt, _ := db.BuildUpsertStmt(metric)
+
+				if _, err := db.NamedExecContext(ctx, stmt, metric); err != nil {
+					klog.Error(errors.Wrap(err, "can't update instance metric"))
+				}
+			}
+		}
 	}, periodic.Immediate()).Stop()
 
-	if cfg.Prometheus.Url != "" {
-		logs, err := logging.NewLoggingFromConfig("Icinga Kubernetes", cfg.Logging)
-		if err != nil {
-			klog.Fatal(errors.Wrap(err, "can't configure logging"))
+	if s.icinga2Client != nil {
+		registrar := icinga2.NewRegistrar(s.icinga2Client, c.name, clusterUuid, c.namespaces.Filter, log.WithName("icinga2"))
+		informers := map[string]kcache.SharedIndexInformer{
+			"nodes":         factory.Core().V1().Nodes().Informer(),
+			"deployments":   namespacedFactory.Apps().V1().Deployments().Informer(),
+			"daemon-sets":   namespacedFactory.Apps().V1().DaemonSets().Informer(),
+			"stateful-sets": namespacedFactory.Apps().V1().StatefulSets().Informer(),
 		}
 
-		db2, err := igldatabase.NewDbFromConfig(&cfg.Database, logs.GetChildLogger("database"), igldatabase.RetryConnectorCallbacks{})
-		if err != nil {
-			klog.Fatal("IGL_DATABASE: ", err)
+		// Objects are only registered if their controller is enabled, as it runs their informer.
+		for _, controller := range append([]string{"nodes"}, c.workloads...) {
+			if enabled(controller) {
+				if err := registrar.Watch(controller, informers[controller]); err != nil {
+					return errors.Wrap(err, "can't watch objects to register")
+				}
+			}
 		}
 
-		promClient, err := promapi.NewClient(promapi.Config{Address: cfg.Prometheus.Url})
-		if err != nil {
-			klog.Fatal(errors.Wrap(err, "error creating promClient"))
+		sup.Go("icinga2", supervisor.OnFailure, func() error {
+			return registrar.Run(ctx)
+		})
+	}
+
+	// notify publishes the given raised or cleared problem to the event bus and notifies webhooks of it unless silenced,
+	// as data platforms subscribed to the event bus receive all problems.
+	notify := func(p problem.Problem, silenced bool) {
+		s.eventBus.Problem(c.name, p)
+
+		if silenced {
+			return
 		}
 
-		promApiClient := promv1.NewAPI(promClient)
-		promMetricSync := metrics.NewPromMetricSync(promApiClient, db2, logs.GetChildLogger("prometheus"))
+		e := webhook.NewEvent(c.name, p)
+		for _, sink := range s.sinks {
+			sink.Notify(e)
+		}
+	}
 
-		g.Go(func() error {
-			return promMetricSync.Nodes(ctx, factory.Core().V1().Nodes().Informer())
+	env := registry.Env{
+		ClusterUuid: clusterUuid,
+		Clientset:   clientset,
+		Db:          db,
+		Thresholds: func(namespace string) schemav1.Thresholds {
+			return internal.ThresholdsOf(c.thresholds, c.namespaceOverrides, namespace).
+				WithAnnotations(namespaceAnnotations(namespace))
+		},
+		NodeMemoryUsage:   nodeMemoryUsage,
+		ContainerRestarts: restarts.Count,
+		Notify: func(p problem.Problem) {
+			notify(p, false)
+		},
+	}
+
+	// newInformer returns the informer of the resource handled by h.
+	// Resources configured to be metadata-only are watched with metadata informers
+	// and resources of types unknown to client-go, e.g. custom resources, with dynamic informers.
+	newInformer := func(h registry.Handler) (kcache.SharedIndexInformer, error) {
+		f, df, mf := namespacedFactory, dynamicNamespacedFactory, metadataNamespacedFactory
+		if h.ClusterScoped {
+			f, df, mf = factory, dynamicFactory, metadataFactory
+		}
+
+		var informer kcache.SharedIndexInformer
+		if slices.Contains(c.kubernetes.MetadataOnly, h.Name) {
+			informer = mf.ForResource(h.Gvr).Informer()
+		} else if generic, err := f.ForResource(h.Gvr); err == nil {
+			return generic.Informer(), nil
+		} else {
+			informer = df.ForResource(h.Gvr).Informer()
+		}
+
+		if err := informer.SetTransform(schemav1.Trim); err != nil {
+			return nil, errors.Wrapf(err, "can't set transform of %s informer", h.Name)
+		}
+
+		return informer, nil
+	}
+
+	// watch returns the informer run by the given controller and the filter applied to its objects.
+	// The informer is nil if the API server doesn't serve the resource of the controller.
+	watch := func(controller string) (kcache.SharedIndexInformer, func(kmetav1.Object) bool, error) {
+		h, _ := registry.Lookup(controller)
+		switch h.Name {
+		case "namespaces":
+			return namespaceFactory.Core().V1().Namespaces().Informer(), c.namespaces.FilterNamespace, nil
+		case "pods":
+			return namespacedFactory.Core().V1().Pods().Informer(), c.namespaces.Filter, nil
+		default:
+			if ok, err := served(h); err != nil || !ok {
+				return nil, nil, err
+			}
+
+			informer, err := newInformer(h)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if h.ClusterScoped {
+				return informer, nil, nil
+			}
+
+			return informer, c.namespaces.Filter, nil
+		}
+	}
+
+	// Plugins are only run while running continuously, as they don't signal when they are done.
+	if !once {
+		for i := range c.plugins {
+			p := plugin.NewPlugin(
+				&c.plugins[i], db, c.name, clusterUuid, log.WithName("plugin").WithValues("plugin", c.plugins[i].Name))
+
+			// Objects are only sent if their controller is enabled, as it runs their informer.
+			for _, controller := range c.plugins[i].Controllers {
+				if !enabled(controller) {
+					continue
+				}
+
+				informer, filter, err := watch(controller)
+				if err != nil {
+					return err
+				}
+				if informer == nil {
+					continue
+				}
+
+				if err := p.Watch(controller, informer, filter); err != nil {
+					return err
+				}
+			}
+
+			sup.Go("plugin-"+c.plugins[i].Name, supervisor.OnFailure, func() error {
+				return p.Run(ctx)
+			})
+		}
+	}
+
+	if s.eventBus != nil {
+		for _, controller := range registry.Names() {
+			if !enabled(controller) || !s.eventBus.Publishes(controller) {
+				continue
+			}
+
+			informer, filter, err := watch(controller)
+			if err != nil {
+				return err
+			}
+			if informer == nil {
+				continue
+			}
+
+			if err := s.eventBus.Watch(c.name, clusterUuid, controller, informer, filter); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Services and ingresses are probed as cached by the informers run by their controllers.
+	// Cluster IPs of services, including the one of the cluster DNS, are only reachable from within the cluster.
+	if c.probes.Enabled() && !once {
+		var dns kubernetes.Interface
+		if probe.InCluster(c.kconfig.Host) {
+			dns = clientset
+		}
+
+		var stores [2]kcache.Store
+		for i, controller := range []string{"services", "ingresses"} {
+			if !enabled(controller) || (controller == "services" && !probe.InCluster(c.kconfig.Host)) {
+				continue
+			}
+
+			informer, _, err := watch(controller)
+			if err != nil {
+				return err
+			}
+
+			stores[i] = informer.GetStore()
+		}
+
+		sup.Go("probes", supervisor.OnFailure, func() error {
+			return probe.NewProber(
+				db, clusterUuid, c.probes, stores[0], stores[1], c.namespaces.Filter, dns, log.WithName("probes"),
+			).Run(ctx)
 		})
+	}
 
-		g.Go(func() error {
-			return promMetricSync.Pods(ctx, factory.Core().V1().Pods().Informer())
+	// The tasks that aren't tied to any controller are enabled by their own name like controllers,
+	// so that only one instance per cluster runs them if the controllers are spread across instances.
+	if enabled("api-requests") && !once {
+		sup.Go("api-requests", supervisor.OnFailure, func() error {
+			return requests.Run(ctx, db, clusterUuid)
 		})
 	}
 
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Core().V1().Namespaces().Informer(), log.WithName("namespaces"), schemav1.NewNamespace)
+	if enabled("api-warnings") && !once {
+		sup.Go("api-warnings", supervisor.OnFailure, func() error {
+			return warnings.Run(ctx, db, clusterUuid)
+		})
+	}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Core().V1().Nodes().Informer(), log.WithName("nodes"), schemav1.NewNode)
+	if c.canary.Enabled() && !once {
+		sup.Go("canary", supervisor.OnFailure, func() error {
+			return canary.NewCanary(db, clientset, clusterUuid, c.canary, log.WithName("canary")).Run(ctx)
+		})
+	}
+
+	goSync("namespaces", func() error {
+		informer := s.debugServer.Track(path.Join(c.name, "namespaces"), namespaceFactory.Core().V1().Namespaces().Informer())
+		h, _ := registry.Lookup("namespaces")
+		s := syncv1.NewSync(db, clusterUuid, informer, log.WithName("namespaces"), h.Factory(env))
 
-		return s.Run(ctx)
+		return s.Run(ctx, append(
+			features, sync.WithFilter(c.namespaces.FilterNamespace), sync.WithWorkers(c.kubernetes.WorkersOf("namespaces")),
+			sync.WithResync(c.kubernetes.ResyncOf("namespaces")), observe("namespaces"))...)
 	})
-	g.Go(func() error {
-		pods := make(chan any)
-		deletePodIds := make(chan interface{})
-		defer close(pods)
-		defer close(deletePodIds)
+	// Containers are synchronized from the pods forwarded by the pods controller, in a task of their own,
+	// so that either can be restarted without the other.
+	pods := make(chan any)
+	deletePodIds := make(chan interface{})
+	if enabled("pods") {
+		sup.Go("containers", supervisor.OnFailure, func() error {
+			g, ctx := errgroup.WithContext(ctx)
+			schemav1.SyncContainers(ctx, db, g, pods, deletePodIds, c.containerLogs)
 
-		schemav1.SyncContainers(ctx, db, g, pods, deletePodIds)
+			return g.Wait()
+		})
+	}
+	goSync("pods", func() error {
+		// With once, the pods controller isn't restarted, and containers are done once all pods have been forwarded.
+		if once {
+			defer close(pods)
+			defer close(deletePodIds)
+		}
 
-		f := schemav1.NewPodFactory(clientset)
-		s := syncv1.NewSync(db, factory.Core().V1().Pods().Informer(), log.WithName("pods"), f.New)
+		h, _ := registry.Lookup("pods")
+		newPod := h.Factory(env)
+		informer := s.debugServer.Track(path.Join(c.name, "pods"), namespacedFactory.Core().V1().Pods().Informer())
+		s := syncv1.NewSync(db, clusterUuid, informer, log.WithName("pods"), newPod)
+		evictions := history.NewEvictions(db, clusterUuid, nodeUuid)
+		if err := drains.Watch(informer); err != nil {
+			return err
+		}
+		imagePulls := imagepull.NewPulls(db, clusterUuid)
+		stateHistory, err := withStateHistory(newPod, informer)
+		if err != nil {
+			return err
+		}
 
-		return s.Run(ctx, sync.WithOnUpsert(com.ForwardBulk(pods)), sync.WithOnDelete(com.ForwardBulk(deletePodIds)))
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Apps().V1().Deployments().Informer(), log.WithName("deployments"), schemav1.NewDeployment)
+		detector := problem.NewDetector(db, clientset, clusterUuid, informer.GetStore(), env.Thresholds,
+			func(pod *kcorev1.Pod) bool {
+				now := time.Now()
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Apps().V1().DaemonSets().Informer(), log.WithName("daemon-sets"), schemav1.NewDaemonSet)
+				// Pods replacing those evicted from draining nodes can't be scheduled until capacity is available.
+				return downtimes.In(pod.Namespace, pod.Spec.NodeName, pod.Annotations, now) || drains.Evicted(pod, now)
+			},
+			func(p *schemav1.Problem) {
+				// Problems raised in downtime are neither notified when raised nor when cleared,
+				// and problems of flapping pods are not notified to prevent notification storms.
+				notify(p, p.InDowntime.Bool || flapping.Is(p.PodUuid))
+			},
+			log.WithName("problems"))
+		if err := detector.Load(ctx); err != nil {
+			return err
+		}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Apps().V1().ReplicaSets().Informer(), log.WithName("replica-sets"), schemav1.NewReplicaSet)
+		jobFailures := problem.NewJobFailures(
+			db, clientset, clusterUuid, informer.GetStore(), log.WithName("job-failures"))
+		if err := jobFailures.Load(ctx); err != nil {
+			return err
+		}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Apps().V1().StatefulSets().Informer(), log.WithName("stateful-sets"), schemav1.NewStatefulSet)
+		g, ctx := errgroup.WithContext(ctx)
+		// Pending pods are evaluated again periodically, which is meaningless for a single synchronization.
+		if !once {
+			g.Go(func() error {
+				return detector.Run(ctx)
+			})
+		}
+		g.Go(func() error {
+			return s.Run(ctx, append(
+				namespaced("pods"), sync.WithOnUpsert(com.ForwardBulk(pods)), sync.WithOnDelete(com.ForwardBulk(deletePodIds)),
+				sync.WithOnUpsert(restarts.Upserted), sync.WithOnDelete(restarts.Deleted),
+				sync.WithOnUpsert(evictions.Upserted), sync.WithOnDelete(evictions.Deleted),
+				stateHistory, sync.WithOnUpsert(detector.Upserted), sync.WithOnDelete(detector.Deleted),
+				sync.WithOnUpsert(jobFailures.Upserted), sync.WithOnDelete(jobFailures.Deleted),
+				sync.WithOnUpsert(imagePulls.Pods),
+				sync.WithWorkers(c.kubernetes.WorkersOf("pods")), observe("pods"))...)
+		})
 
-		return s.Run(ctx)
+		return g.Wait()
 	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Core().V1().Services().Informer(), log.WithName("services"), schemav1.NewService)
+	// Comments are annotated onto the pods cached by the informer run by the pods controller.
+	if enabled("pods") && c.acknowledgements.Annotate && !once {
+		sup.Go("annotator", supervisor.OnFailure, func() error {
+			return problem.NewAnnotator(
+				db, clientset, clusterUuid, namespacedFactory.Core().V1().Pods().Informer().GetStore(),
+				log.WithName("annotator"),
+			).Run(ctx)
+		})
+	}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Discovery().V1().EndpointSlices().Informer(), log.WithName("endpoints"), schemav1.NewEndpointSlice)
+	// Like SLAs, costs are estimated for complete hours.
+	if c.cost.Enabled() && enabled("pods") && !once {
+		sup.Go("cost", supervisor.OnFailure, func() error {
+			return cost.NewEstimator(db, clusterUuid, c.cost, log.WithName("cost")).Run(ctx)
+		})
+	}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Core().V1().Secrets().Informer(), log.WithName("secrets"), schemav1.NewSecret)
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Core().V1().ConfigMaps().Informer(), log.WithName("config-maps"), schemav1.NewConfigMap)
+	// SLAs are computed from the state history of complete days, which is meaningless for a single synchronization.
+	if enabled("deployments") && !once {
+		sup.Go("sla", supervisor.OnFailure, func() error {
+			return history.NewSla(db, clusterUuid, log.WithName("sla")).Run(ctx)
+		})
+	}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Events().V1().Events().Informer(), log.WithName("events"), schemav1.NewEvent)
+	// Certificates aren't synchronized by any controller, but read every hour.
+	if enabled("certificates") && !once {
+		sup.Go("certificates", supervisor.OnFailure, func() error {
+			return certificate.NewTracker(
+				clientset, c.kconfig.Host, db, clusterUuid, c.certificates, c.namespaces.Allowed,
+				func(p *schemav1.CertificateProblem) {
+					notify(p, false)
+				},
+				log.WithName("certificates"),
+			).Run(ctx)
+		})
+	}
 
-		return s.Run(ctx, sync.WithNoDelete(), sync.WithNoWarumup())
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Core().V1().PersistentVolumeClaims().Informer(), log.WithName("pvcs"), schemav1.NewPvc)
+	// Cron jobs are checked against their schedules every minute, which is meaningless for a single synchronization,
+	// and read from the informer run by the cron-jobs controller.
+	if enabled("cron-jobs") && !once {
+		sup.Go("cron-job-problems", supervisor.OnFailure, func() error {
+			return cronjob.NewTracker(
+				db, clusterUuid, c.namespaces.Allowed,
+				func(p *schemav1.CronJobProblem) {
+					notify(p, false)
+				},
+				log.WithName("cron-job-problems"),
+			).Run(ctx, namespacedFactory.Batch().V1().CronJobs().Informer())
+		})
+	}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Core().V1().PersistentVolumes().Informer(), log.WithName("persistent-volumes"), schemav1.NewPersistentVolume)
+	// Resource quotas aren't synchronized by any controller, but read every hour to record their usage.
+	if enabled("quota-forecast") && !once {
+		sup.Go("quota-forecast", supervisor.OnFailure, func() error {
+			return capacity.NewQuotaForecaster(
+				clientset, db, clusterUuid, c.capacity, c.namespaces.Allowed,
+				func(p *schemav1.ResourceQuotaProblem) {
+					notify(p, false)
+				},
+				log.WithName("quota-forecast"),
+			).Run(ctx)
+		})
+	}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Batch().V1().Jobs().Informer(), log.WithName("jobs"), schemav1.NewJob)
+	// Image pull secrets are audited every hour against the pods cached by the informer run by the pods controller.
+	if enabled("pods") && !once {
+		sup.Go("pull-secrets", supervisor.OnFailure, func() error {
+			return pullsecret.NewAuditor(clientset, db, clusterUuid, c.namespaces.Allowed, log.WithName("pull-secrets")).
+				Run(ctx, namespacedFactory.Core().V1().Pods().Informer())
+		})
+	}
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Batch().V1().CronJobs().Informer(), log.WithName("cron-jobs"), schemav1.NewCronJob)
+	// Node drains are simulated against pod disruption budgets every five minutes,
+	// using the nodes and pods cached by the informers run by the nodes and pods controllers.
+	if enabled("nodes") && enabled("pods") && !once {
+		sup.Go("drain-risk", supervisor.OnFailure, func() error {
+			return disruption.NewAnalyzer(clientset, db, clusterUuid, c.namespaces.Allowed, log.WithName("drain-risk")).
+				Run(ctx, factory.Core().V1().Nodes().Informer(), namespacedFactory.Core().V1().Pods().Informer())
+		})
 
-		return s.Run(ctx)
-	})
-	g.Go(func() error {
-		s := syncv1.NewSync(db, factory.Networking().V1().Ingresses().Informer(), log.WithName("ingresses"), schemav1.NewIngress)
+		// The fragmentation of nodes is reported from the same nodes and pods every five minutes.
+		sup.Go("fragmentation", supervisor.OnFailure, func() error {
+			return capacity.NewFragmentationReporter(db, clusterUuid, log.WithName("fragmentation")).
+				Run(ctx, factory.Core().V1().Nodes().Informer(), namespacedFactory.Core().V1().Pods().Informer())
+		})
+	}
 
-		return s.Run(ctx)
-	})
+	// Daemon sets are checked for nodes that miss their pods every five minutes,
+	// using the objects cached by the informers run by the daemon-sets, nodes and pods controllers.
+	if enabled("daemon-sets") && enabled("nodes") && enabled("pods") && !once {
+		sup.Go("daemon-set-coverage", supervisor.OnFailure, func() error {
+			return daemonset.NewAnalyzer(db, clusterUuid, c.namespaces.Allowed, log.WithName("daemon-set-coverage")).Run(
+				ctx,
+				namespacedFactory.Apps().V1().DaemonSets().Informer(),
+				factory.Core().V1().Nodes().Informer(),
+				namespacedFactory.Core().V1().Pods().Informer(),
+			)
+		})
+	}
 
-	g.Go(func() error {
-		return db.PeriodicCleanup(ctx, database.CleanupStmt{
-			Table:  "event",
-			PK:     "uuid",
-			Column: "created",
+	// Services are checked for ready endpoints every minute,
+	// using the objects cached by the informers run by the services and endpoints controllers.
+	if enabled("services") && enabled("endpoints") && !once {
+		sup.Go("service-problems", supervisor.OnFailure, func() error {
+			return service.NewTracker(
+				db, clusterUuid, c.namespaces.Allowed,
+				func(p *schemav1.ServiceProblem) {
+					notify(p, false)
+				},
+				log.WithName("service-problems"),
+			).Run(
+				ctx,
+				namespacedFactory.Core().V1().Services().Informer(),
+				namespacedFactory.Discovery().V1().EndpointSlices().Informer(),
+			)
 		})
-	})
+	}
 
-	g.Go(func() error {
-		return db.PeriodicCleanup(ctx, database.CleanupStmt{
-			Table:  "prometheus_cluster_metric",
-			PK:     "(cluster_uuid, timestamp, category, name)",
-			Column: "timestamp",
+	// Ingresses are checked for conflicting rules every five minutes,
+	// using the ingresses cached by the informer run by the ingresses controller.
+	if enabled("ingresses") && !once {
+		sup.Go("ingress-conflicts", supervisor.OnFailure, func() error {
+			return ingress.NewAnalyzer(db, clusterUuid, c.namespaces.Allowed, log.WithName("ingress-conflicts")).
+				Run(ctx, namespacedFactory.Networking().V1().Ingresses().Informer())
 		})
-	})
+	}
 
-	g.Go(func() error {
-		return db.PeriodicCleanup(ctx, database.CleanupStmt{
-			Table:  "prometheus_node_metric",
-			PK:     "(node_uuid, timestamp, category, name)",
-			Column: "timestamp",
+	// Upgrade readiness is checked against all objects in the cluster, not only those of the enabled controllers.
+	if enabled("upgrade") && !once {
+		sup.Go("upgrade", supervisor.OnFailure, func() error {
+			return upgrade.NewChecker(
+				clientset, metadataClient, db, clusterUuid, c.namespaces, log.WithName("upgrade"),
+			).Run(ctx)
 		})
-	})
+	}
 
-	g.Go(func() error {
-		return db.PeriodicCleanup(ctx, database.CleanupStmt{
-			Table:  "prometheus_pod_metric",
-			PK:     "(pod_uuid, timestamp, category, name)",
-			Column: "timestamp",
+	// Objects of all resources are counted, not only those of the enabled controllers, as they all take up space in etcd.
+	if enabled("etcd-inventory") && !once {
+		sup.Go("etcd-inventory", supervisor.OnFailure, func() error {
+			return etcd.NewInventory(clientset, metadataClient, db, clusterUuid, log.WithName("etcd-inventory")).Run(ctx)
 		})
-	})
+	}
+
+	// All other resources, including those registered downstream, are synchronized the same way.
+	for _, h := range registry.Handlers() {
+		if h.Name == "namespaces" || h.Name == "pods" {
+			continue
+		}
 
-	g.Go(func() error {
-		return db.PeriodicCleanup(ctx, database.CleanupStmt{
-			Table:  "prometheus_container_metric",
-			PK:     "(container_uuid, timestamp, category, name)",
-			Column: "timestamp",
+		goSync(h.Name, func() error {
+			if ok, err := served(h); err != nil {
+				return err
+			} else if !ok {
+				log.Info("Not synchronizing resources that the API server doesn't serve", "controller", h.Name)
+
+				return nil
+			}
+
+			informer, err := newInformer(h)
+			if err != nil {
+				return err
+			}
+			informer = s.debugServer.Track(path.Join(c.name, h.Name), informer)
+			newResource := h.Factory(env)
+			s := syncv1.NewSync(db, clusterUuid, informer, log.WithName(h.Name), newResource)
+
+			hf := namespaced(h.Name)
+			if h.ClusterScoped {
+				hf = append(features, sync.WithResync(c.kubernetes.ResyncOf(h.Name)))
+			}
+			hf = append(hf, h.Features...)
+			if h.ClusterFeatures != nil {
+				hf = append(hf, h.ClusterFeatures(env)...)
+			}
+
+			if h.StateHistory {
+				stateHistory, err := withStateHistory(newResource, informer)
+				if err != nil {
+					return err
+				}
+
+				hf = append(hf, stateHistory)
+			}
+
+			return s.Run(ctx, append(
+				hf, sync.WithWorkers(c.kubernetes.WorkersOf(h.Name)), observe(h.Name))...)
 		})
-	})
+	}
 
-	if err := g.Wait(); err != nil {
-		klog.Fatal(err)
+	return g.Wait()
+}
+
+// getCluster returns the cluster clientset is connected to.
+// Its UUID is derived from name if configured, otherwise from the UID of the kube-system namespace,
+// which is unique per cluster and doesn't change over its lifetime.
+func getCluster(ctx context.Context, clientset *kubernetes.Clientset, name string) (*schemav1.Cluster, error) {
+	if name != "" {
+		return &schemav1.Cluster{
+			Uuid: schemav1.NewUUID(types.UUID{UUID: schemav1.NameSpaceKubernetes}, name),
+			Name: schemav1.NewNullableString(name),
+		}, nil
+	}
+
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, kmetav1.NamespaceSystem, kmetav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't retrieve kube-system namespace")
+	}
+
+	return &schemav1.Cluster{Uuid: schemav1.EnsureUUID(namespace.UID)}, nil
+}
+
+// dbUpgradeSchema applies the upgrade scripts required to upgrade the schema from its current version to the one
+// of this release. It refuses to start with schemas that are newer or whose version is unknown.
+// Scripts can't be applied in a transaction, as MySQL commits DDL statements implicitly,
+// so a script that fails midway leaves a partly upgraded schema, which must be repaired manually.
+func dbUpgradeSchema(db *database.Database, dbLog logr.Logger) error {
+	var versions []string
+	if err := db.Select(&versions, "SELECT version FROM kubernetes_schema WHERE success = 'y' ORDER BY id DESC LIMIT 1"); err != nil {
+		return errors.Wrap(err, "can't query schema version")
+	}
+
+	if len(versions) < 1 {
+		return errors.New("schema version missing, please import the schema again")
+	}
+
+	upgrades, err := k8sMysql.Upgrades(versions[0])
+	if err != nil {
+		return err
+	}
+
+	for _, u := range upgrades {
+		dbLog.Info("Upgrading schema", "version", u.Version)
+
+		for _, ddl := range strings.Split(u.Script, ";") {
+			if ddl = strings.TrimSpace(ddl); ddl != "" {
+				if _, err := db.Exec(ddl); err != nil {
+					return errors.Wrapf(err,
+						"can't upgrade schema to %s, please apply the remaining statements of its upgrade script manually",
+						u.Version)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// adoptRows assigns the rows that have been written before the upgrade to schema version 0.2.0, which introduced
+// clusters, to the cluster with the given UUID, so that its controllers warm them up and delete those of objects
+// that don't exist in the cluster, including their relations. The rows are adopted by the first cluster that starts,
+// as they were synchronized from a single cluster, and the presence of namespaces without a cluster indicates
+// that there are rows to adopt, as namespaces are adopted last.
+func adoptRows(ctx context.Context, db *database.Database, clusterUuid types.UUID, log logr.Logger) error {
+	var orphans []int
+	if err := db.SelectContext(ctx, &orphans, db.Rebind(
+		"SELECT 1 FROM namespace WHERE cluster_uuid=? LIMIT 1"), types.UUID{}); err != nil {
+		return errors.Wrap(err, "can't query namespaces without cluster")
 	}
+
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	log.Info("Adopting rows written before the upgrade to schema version 0.2.0")
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't start transaction")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, table := range k8sMysql.AdoptedTables {
+		if _, err := tx.ExecContext(ctx, tx.Rebind(
+			"UPDATE "+table+" SET cluster_uuid=? WHERE cluster_uuid=?"), clusterUuid, types.UUID{}); err != nil {
+			return errors.Wrapf(err, "can't adopt rows of %s", table)
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "can't commit transaction")
 }
 
 // dbHasSchema queries via db whether the database dbName has a table named "kubernetes_schema".
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/snapshot"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"time"
+)
+
+// runSnapshot implements the snapshot subcommand, which exports the synchronized data of the database
+// to a portable archive with "snapshot export" or imports such an archive with "snapshot import".
+// It returns 1 if the export or import fails, 0 otherwise.
+func runSnapshot(args []string) int {
+	var cmd command
+	var file string
+	var namespaces []string
+
+	err := func() error {
+		if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+			return errors.New("usage: snapshot export|import [flags]")
+		}
+		command := args[0]
+
+		flags := pflag.NewFlagSet("snapshot "+command, pflag.ContinueOnError)
+		cmd.addFlags(flags, time.Hour, "timeout of the export or import")
+		flags.StringVarP(&file, "file", "f", "-", "path to the snapshot, - for stdout or stdin")
+		if command == "export" {
+			flags.StringSliceVar(&namespaces, "namespace", nil, "namespaces to export, all if not set")
+		}
+
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		return withDatabase(&cmd, func(ctx context.Context, _ *internal.Config, db *database.Database) error {
+			if command == "export" {
+				var w io.Writer = os.Stdout
+				if file != "-" {
+					f, err := os.Create(file)
+					if err != nil {
+						return errors.WithStack(err)
+					}
+					defer func() { _ = f.Close() }()
+
+					w = f
+				}
+
+				if err := snapshot.Export(ctx, db, w, namespaces); err != nil {
+					return err
+				}
+
+				if f, ok := w.(*os.File); ok && f != os.Stdout {
+					return errors.WithStack(f.Close())
+				}
+
+				return nil
+			}
+
+			var r io.Reader = os.Stdin
+			if file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				defer func() { _ = f.Close() }()
+
+				r = f
+			}
+
+			header, err := snapshot.Import(ctx, db, r)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "Imported snapshot created at %s.\n",
+				time.UnixMilli(header.Created).Format(time.RFC3339))
+
+			return nil
+		})
+	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/status"
+	"github.com/spf13/pflag"
+	"os"
+	"time"
+)
+
+// runStatus implements the status subcommand, which prints the synchronization state of the clusters
+// as recorded in the database, and returns the exit code.
+func runStatus(args []string) int {
+	var cmd command
+	var cluster string
+
+	flags := pflag.NewFlagSet("status", pflag.ContinueOnError)
+	cmd.addFlags(flags, time.Minute, "timeout of the status queries")
+	flags.StringVar(&cluster, "cluster", "", "name of the cluster to report, all clusters if not set")
+
+	err := func() error {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		return withDatabase(&cmd, func(ctx context.Context, _ *internal.Config, db *database.Database) error {
+			report, err := status.Gather(ctx, db, cluster)
+			if err != nil {
+				return err
+			}
+
+			return report.Print(os.Stdout, time.Now())
+		})
+	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/internal"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/verify"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	kclientcmd "k8s.io/client-go/tools/clientcmd"
+	"os"
+	"slices"
+	"time"
+)
+
+// runVerify implements the verify subcommand, which checks the database schema version, the consistency of relations,
+// that running pods have metrics and, unless disabled, the synchronized objects against the live clusters.
+// It prints all discrepancies found and returns 1 if there are any or verification fails, 0 otherwise.
+func runVerify(args []string) int {
+	var cmd command
+	var kubeconfig string
+	var kubecontext string
+	var live bool
+
+	flags := pflag.NewFlagSet("verify", pflag.ContinueOnError)
+	cmd.addFlags(flags, 5*time.Minute, "timeout of the verification")
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "path to a kube config, ignored if clusters are configured")
+	flags.StringVar(&kubecontext, "context", "", "kube config context to use, ignored if clusters are configured")
+	flags.BoolVar(&live, "live", true, "compare the synchronized objects with the live clusters")
+
+	var discrepancies []verify.Discrepancy
+	err := func() error {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		return withDatabase(&cmd, func(ctx context.Context, cfg *internal.Config, db *database.Database) error {
+			for _, check := range []func(context.Context, *database.Database) ([]verify.Discrepancy, error){
+				verify.Schema, verify.Relations, verify.Metrics,
+			} {
+				d, err := check(ctx, db)
+				if err != nil {
+					return err
+				}
+
+				discrepancies = append(discrepancies, d...)
+			}
+
+			if !live {
+				return nil
+			}
+
+			type cluster struct {
+				name        string
+				kubeconfig  string
+				context     string
+				controllers []string
+			}
+
+			clusters := []cluster{{cfg.ClusterName, kubeconfig, kubecontext, cfg.Controllers}}
+			if len(cfg.Clusters) > 0 {
+				clusters = clusters[:0]
+				for _, c := range cfg.Clusters {
+					controllers := cfg.Controllers
+					if len(c.Controllers) > 0 {
+						controllers = c.Controllers
+					}
+
+					clusters = append(clusters, cluster{c.Name, c.Kubeconfig, c.Context, controllers})
+				}
+			}
+
+			for _, c := range clusters {
+				resources := make(map[string]verify.Resource)
+				for name, r := range verify.Resources() {
+					if len(c.controllers) == 0 || slices.Contains(c.controllers, name) {
+						resources[name] = r
+					}
+				}
+
+				rules := kclientcmd.NewDefaultClientConfigLoadingRules()
+				rules.ExplicitPath = c.kubeconfig
+
+				kconfig, err := newKubeConfig(kclientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+					rules, &kclientcmd.ConfigOverrides{CurrentContext: c.context}))
+				if err != nil {
+					return err
+				}
+				cfg.Kubernetes.Apply(kconfig)
+
+				clientset, err := kubernetes.NewForConfig(kconfig)
+				if err != nil {
+					return errors.Wrap(err, "can't create Kubernetes client")
+				}
+
+				metadataClient, err := metadata.NewForConfig(kconfig)
+				if err != nil {
+					return errors.Wrap(err, "can't create Kubernetes metadata client")
+				}
+
+				clusterEntity, err := getCluster(ctx, clientset, c.name)
+				if err != nil {
+					return err
+				}
+
+				name := c.name
+				if name == "" {
+					name = clusterEntity.Uuid.String()
+				}
+
+				d, err := verify.Live(ctx, db, metadataClient, name, clusterEntity.Uuid, &cfg.Namespaces, resources)
+				if err != nil {
+					return errors.Wrapf(err, "cluster %s", name)
+				}
+				discrepancies = append(discrepancies, d...)
+			}
+
+			return nil
+		})
+	}()
+
+	for _, d := range discrepancies {
+		fmt.Println(d)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	if len(discrepancies) > 0 {
+		return 1
+	}
+
+	fmt.Println("No discrepancies found.")
+
+	return 0
+}
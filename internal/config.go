@@ -3,29 +3,470 @@ package internal
 import (
 	"github.com/icinga/icinga-go-library/database"
 	"github.com/icinga/icinga-go-library/logging"
+	"github.com/icinga/icinga-kubernetes/pkg/api"
+	"github.com/icinga/icinga-kubernetes/pkg/archive"
+	"github.com/icinga/icinga-kubernetes/pkg/bus"
+	"github.com/icinga/icinga-kubernetes/pkg/canary"
+	"github.com/icinga/icinga-kubernetes/pkg/capacity"
+	"github.com/icinga/icinga-kubernetes/pkg/certificate"
+	"github.com/icinga/icinga-kubernetes/pkg/cost"
+	k8sDatabase "github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/debug"
+	"github.com/icinga/icinga-kubernetes/pkg/downtime"
+	"github.com/icinga/icinga-kubernetes/pkg/exporter"
+	"github.com/icinga/icinga-kubernetes/pkg/history"
+	"github.com/icinga/icinga-kubernetes/pkg/icinga2"
 	"github.com/icinga/icinga-kubernetes/pkg/metrics"
+	"github.com/icinga/icinga-kubernetes/pkg/plugin"
+	"github.com/icinga/icinga-kubernetes/pkg/probe"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	"github.com/icinga/icinga-kubernetes/pkg/rightsizing"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+	"github.com/icinga/icinga-kubernetes/pkg/webhook"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/rest"
+	"maps"
+	"slices"
+	"time"
 )
 
+// Tasks are the names of the tasks that aren't tied to any controller, but are enabled via Controllers like them.
+var Tasks = []string{"api-requests", "api-warnings", "certificates", "etcd-inventory", "quota-forecast", "upgrade"}
+
 // Config defines Icinga Kubernetes config.
 type Config struct {
-	Database   database.Config          `yaml:"database"`
-	Logging    logging.Config           `yaml:"logging"`
-	Prometheus metrics.PrometheusConfig `yaml:"prometheus"`
+	Database database.Config `yaml:"database"`
+	// WriteLimit limits the rate of writes to the database, e.g. if it is shared with Icinga DB.
+	WriteLimit k8sDatabase.WriteLimitConfig `yaml:"write_limit"`
+	Logging    logging.Config               `yaml:"logging"`
+	Kubernetes KubernetesConfig             `yaml:"kubernetes"`
+	Debug      debug.Config                 `yaml:"debug"`
+	Api        api.Config                   `yaml:"api"`
+	Exporter   exporter.Config              `yaml:"exporter"`
+	Prometheus metrics.PrometheusConfig     `yaml:"prometheus"`
+	Namespaces sync.NamespacesConfig        `yaml:"namespaces"`
+	Thresholds schemav1.Thresholds          `yaml:"thresholds"`
+	Icinga2    icinga2.Config               `yaml:"icinga2"`
+	Downtimes  []downtime.Window            `yaml:"downtimes"`
+	Flapping   history.FlappingConfig       `yaml:"flapping"`
+	Webhooks   []webhook.Config             `yaml:"webhooks"`
+	EventBus   bus.Config                   `yaml:"event_bus"`
+	Plugins    []plugin.Config              `yaml:"plugins"`
+	// NamespaceOverrides override thresholds, controllers and resyncs for the matching namespaces.
+	NamespaceOverrides []NamespaceOverrides `yaml:"namespace_overrides"`
+	// Archive configures object storage to which rows are archived before the retention deletes them.
+	Archive archive.Config `yaml:"archive"`
+	// Cost configures the prices from which the costs of namespaces and workloads are estimated.
+	Cost cost.Config `yaml:"cost"`
+	// Capacity configures how the exhaustion of node pools, namespaces and PVCs is forecast.
+	Capacity capacity.Config `yaml:"capacity"`
+	// Rightsizing configures how requests and limits of containers are recommended.
+	Rightsizing rightsizing.Config `yaml:"rightsizing"`
+	// Certificates configures when problems are raised for expiring certificates.
+	Certificates certificate.Config `yaml:"certificates"`
+	// Probes configures how the reachability of services and ingresses is probed.
+	Probes probe.Config `yaml:"probes"`
+	// Canary configures the scheduling canary.
+	Canary canary.Config `yaml:"canary"`
+	// Acknowledgements configures what happens with acknowledgements and comments of problems.
+	Acknowledgements problem.AcknowledgementsConfig `yaml:"acknowledgements"`
+	// ClusterName identifies the cluster in the database. If not set, the UID of the kube-system namespace is used.
+	ClusterName string `yaml:"cluster_name"`
+	// Controllers restricts synchronization to the listed controllers and Tasks, so that the load of large clusters
+	// can be spread across multiple instances. If not set, all controllers and tasks are run.
+	Controllers []string `yaml:"controllers"`
+	// Clusters configures multiple clusters to be synchronized concurrently.
+	// If set, the Kubernetes CLI flags, ClusterName and Prometheus are ignored.
+	Clusters []ClusterConfig `yaml:"clusters"`
+	// Profile presets the values of options that aren't set, e.g. edge for a reduced footprint.
+	Profile string `yaml:"profile"`
+	// ContainerLogs enables the periodic collection of the logs of running containers.
+	ContainerLogs *bool `yaml:"container_logs" default:"true"`
+	// MemoryLimit is the soft memory limit of the Go runtime as Kubernetes quantity, e.g. 900Mi.
+	// Garbage collection becomes more aggressive when approaching it. Ignored if GOMEMLIMIT is set.
+	MemoryLimit string `yaml:"memory_limit"`
 }
 
 // Validate checks constraints in the supplied configuration and returns an error if they are violated.
 func (c *Config) Validate() error {
+	if err := validateProfile(c.Profile); err != nil {
+		return err
+	}
+
 	if err := c.Database.Validate(); err != nil {
 		return err
 	}
 
+	if err := c.WriteLimit.Validate(); err != nil {
+		return err
+	}
+
 	if err := c.Logging.Validate(); err != nil {
 		return err
 	}
 
+	if err := c.Kubernetes.Validate(); err != nil {
+		return err
+	}
+
 	if err := c.Prometheus.Validate(); err != nil {
 		return err
 	}
 
+	if err := c.Debug.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Api.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Exporter.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Namespaces.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Thresholds.Validate(); err != nil {
+		return errors.Wrap(err, "invalid thresholds")
+	}
+
+	for i := range c.NamespaceOverrides {
+		if err := c.NamespaceOverrides[i].Validate(); err != nil {
+			return errors.Wrapf(err, "invalid namespace_overrides %d", i+1)
+		}
+	}
+
+	if err := c.Icinga2.Validate(); err != nil {
+		return err
+	}
+
+	for i := range c.Downtimes {
+		if err := c.Downtimes[i].Validate(); err != nil {
+			return errors.Wrapf(err, "invalid downtime %d", i+1)
+		}
+	}
+
+	if err := c.Flapping.Validate(); err != nil {
+		return err
+	}
+
+	for i := range c.Webhooks {
+		if err := c.Webhooks[i].Validate(); err != nil {
+			return errors.Wrapf(err, "invalid webhook %d", i+1)
+		}
+	}
+
+	if err := c.EventBus.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Archive.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Cost.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Capacity.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Rightsizing.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Certificates.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Probes.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Canary.Validate(); err != nil {
+		return err
+	}
+
+	plugins := make(map[string]struct{}, len(c.Plugins))
+	for i := range c.Plugins {
+		if err := c.Plugins[i].Validate(); err != nil {
+			return errors.Wrapf(err, "invalid plugin %d", i+1)
+		}
+
+		if _, ok := plugins[c.Plugins[i].Name]; ok {
+			return errors.Errorf("duplicate plugin name %q", c.Plugins[i].Name)
+		}
+
+		plugins[c.Plugins[i].Name] = struct{}{}
+	}
+
+	if err := validateControllers(c.Controllers); err != nil {
+		return err
+	}
+
+	names := make(map[string]struct{}, len(c.Clusters))
+	for i := range c.Clusters {
+		if err := c.Clusters[i].Validate(); err != nil {
+			return errors.Wrapf(err, "invalid cluster %d", i+1)
+		}
+
+		if _, ok := names[c.Clusters[i].Name]; ok {
+			return errors.Errorf("duplicate cluster name %q", c.Clusters[i].Name)
+		}
+
+		names[c.Clusters[i].Name] = struct{}{}
+	}
+
+	if c.MemoryLimit != "" {
+		limit, err := resource.ParseQuantity(c.MemoryLimit)
+		if err != nil {
+			return errors.Wrap(err, "invalid memory_limit")
+		}
+
+		if limit.Sign() <= 0 {
+			return errors.New("memory_limit must be positive")
+		}
+	}
+
 	return nil
 }
+
+// validateControllers checks that the given controllers are registered controllers or Tasks.
+func validateControllers(controllers []string) error {
+	for _, controller := range controllers {
+		if !slices.Contains(registry.Names(), controller) && !slices.Contains(Tasks, controller) {
+			return errors.Errorf("unknown controller %q", controller)
+		}
+	}
+
+	return nil
+}
+
+// ContainerLogsEnabled returns whether the logs of running containers are collected.
+func (c *Config) ContainerLogsEnabled() bool {
+	return c.ContainerLogs == nil || *c.ContainerLogs
+}
+
+// MemoryLimitBytes returns the configured memory limit in bytes and whether it is set.
+func (c *Config) MemoryLimitBytes() (int64, bool) {
+	if c.MemoryLimit == "" {
+		return 0, false
+	}
+
+	limit, err := resource.ParseQuantity(c.MemoryLimit)
+	if err != nil {
+		return 0, false
+	}
+
+	return limit.Value(), true
+}
+
+// KubernetesConfig defines the Kubernetes client configuration.
+type KubernetesConfig struct {
+	// Qps is the maximum number of requests per second to the API server.
+	Qps float32 `yaml:"qps" default:"5"`
+	// Burst is the maximum number of requests sent at once, exceeding Qps.
+	Burst int `yaml:"burst" default:"10"`
+	// UserAgent is sent with every request. If not set, the client-go default is used.
+	UserAgent string `yaml:"user_agent"`
+	// Resync is the interval in which all cached objects are synchronized again. Zero disables resyncs.
+	Resync time.Duration `yaml:"resync"`
+	// ControllerResync overrides Resync for individual controllers by name, e.g. pods.
+	ControllerResync map[string]time.Duration `yaml:"controller_resync"`
+	// Debounce is the window within which consecutive updates of the same object are coalesced
+	// into a single database write. Zero disables debouncing.
+	Debounce time.Duration `yaml:"debounce" default:"1s"`
+	// Workers is the number of objects each controller processes concurrently.
+	Workers int `yaml:"workers" default:"1"`
+	// ControllerWorkers overrides Workers for individual controllers by name, e.g. pods.
+	ControllerWorkers map[string]int `yaml:"controller_workers"`
+	// RelationWorkers is the number of objects whose relations, e.g. labels, each controller upserts concurrently.
+	RelationWorkers int `yaml:"relation_workers" default:"4"`
+	// MetadataOnly lists controllers, e.g. secrets, whose objects are watched with metadata-only informers,
+	// which neither transfer nor cache anything but metadata at the expense of the remaining columns.
+	MetadataOnly []string `yaml:"metadata_only"`
+}
+
+// Validate checks constraints in the supplied Kubernetes configuration and returns an error if they are violated.
+func (c *KubernetesConfig) Validate() error {
+	if c.Qps <= 0 {
+		return errors.New("kubernetes qps must be positive")
+	}
+
+	if c.Burst < 1 {
+		return errors.New("kubernetes burst must be at least 1")
+	}
+
+	if c.Resync < 0 {
+		return errors.New("kubernetes resync must not be negative")
+	}
+
+	for controller, resync := range c.ControllerResync {
+		if !slices.Contains(registry.Names(), controller) {
+			return errors.Errorf("unknown controller %q in kubernetes controller_resync", controller)
+		}
+
+		if resync < 0 {
+			return errors.Errorf("kubernetes controller_resync of %s must not be negative", controller)
+		}
+	}
+
+	if c.Debounce < 0 {
+		return errors.New("kubernetes debounce must not be negative")
+	}
+
+	if c.Workers < 1 {
+		return errors.New("kubernetes workers must be at least 1")
+	}
+
+	if c.RelationWorkers < 1 {
+		return errors.New("kubernetes relation_workers must be at least 1")
+	}
+
+	for controller, workers := range c.ControllerWorkers {
+		if !slices.Contains(registry.Names(), controller) {
+			return errors.Errorf("unknown controller %q in kubernetes controller_workers", controller)
+		}
+
+		if workers < 1 {
+			return errors.Errorf("kubernetes controller_workers of %s must be at least 1", controller)
+		}
+	}
+
+	for _, controller := range c.MetadataOnly {
+		h, ok := registry.Lookup(controller)
+		if !ok {
+			return errors.Errorf("unknown controller %q in kubernetes metadata_only", controller)
+		}
+
+		if !h.PartialMetadata {
+			return errors.Errorf("controller %q doesn't support kubernetes metadata_only", controller)
+		}
+	}
+
+	return nil
+}
+
+// WorkersOf returns the number of objects the given controller processes concurrently.
+func (c *KubernetesConfig) WorkersOf(controller string) int {
+	if workers, ok := c.ControllerWorkers[controller]; ok {
+		return workers
+	}
+
+	return c.Workers
+}
+
+// ResyncOf returns the interval in which the given controller synchronizes all cached objects again.
+func (c *KubernetesConfig) ResyncOf(controller string) time.Duration {
+	if resync, ok := c.ControllerResync[controller]; ok {
+		return resync
+	}
+
+	return c.Resync
+}
+
+// ResyncCheck returns the shortest resync interval of all controllers, or zero if no controller resyncs.
+// Informers check in this interval which of their event handlers are due for a resync.
+func (c *KubernetesConfig) ResyncCheck() time.Duration {
+	check := c.Resync
+	for _, resync := range c.ControllerResync {
+		if resync > 0 && (check == 0 || resync < check) {
+			check = resync
+		}
+	}
+
+	return check
+}
+
+// Apply sets the configured rate limits and user agent on the given client configuration.
+func (c *KubernetesConfig) Apply(kconfig *rest.Config) {
+	kconfig.QPS = c.Qps
+	kconfig.Burst = c.Burst
+
+	if c.UserAgent != "" {
+		kconfig.UserAgent = c.UserAgent
+	}
+}
+
+// ClusterConfig defines the connection configuration of a single cluster.
+type ClusterConfig struct {
+	// Name identifies the cluster in the database.
+	Name string `yaml:"name"`
+	// Kubeconfig is the path to a kubeconfig file. If not set, the default loading rules apply.
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Context is the kubeconfig context to use. If not set, the current context is used.
+	Context    string                   `yaml:"context"`
+	Prometheus metrics.PrometheusConfig `yaml:"prometheus"`
+	// Thresholds override the top-level thresholds for this cluster field by field.
+	Thresholds schemav1.Thresholds `yaml:"thresholds"`
+	// NamespaceOverrides override the configuration for the matching namespaces of this cluster
+	// and take precedence over the top-level ones.
+	NamespaceOverrides []NamespaceOverrides `yaml:"namespace_overrides"`
+	// Controllers overrides the top-level controllers for this cluster.
+	Controllers []string `yaml:"controllers"`
+	// Resync overrides the Kubernetes resync interval for this cluster.
+	Resync *time.Duration `yaml:"resync"`
+	// ControllerResync overrides the Kubernetes resync interval of individual controllers for this cluster,
+	// merged with the top-level ones.
+	ControllerResync map[string]time.Duration `yaml:"controller_resync"`
+}
+
+// Validate checks constraints in the supplied cluster configuration and returns an error if they are violated.
+func (c *ClusterConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("cluster name missing")
+	}
+
+	if err := c.Thresholds.Validate(); err != nil {
+		return errors.Wrap(err, "invalid thresholds")
+	}
+
+	for i := range c.NamespaceOverrides {
+		if err := c.NamespaceOverrides[i].Validate(); err != nil {
+			return errors.Wrapf(err, "invalid namespace_overrides %d", i+1)
+		}
+	}
+
+	if err := validateControllers(c.Controllers); err != nil {
+		return err
+	}
+
+	if c.Resync != nil && *c.Resync < 0 {
+		return errors.New("resync must not be negative")
+	}
+
+	for controller, resync := range c.ControllerResync {
+		if !slices.Contains(registry.Names(), controller) {
+			return errors.Errorf("unknown controller %q in controller_resync", controller)
+		}
+
+		if resync < 0 {
+			return errors.Errorf("controller_resync of %s must not be negative", controller)
+		}
+	}
+
+	return c.Prometheus.Validate()
+}
+
+// KubernetesOf returns the given top-level Kubernetes configuration with the overrides of this cluster applied.
+func (c *ClusterConfig) KubernetesOf(k KubernetesConfig) KubernetesConfig {
+	if c.Resync != nil {
+		k.Resync = *c.Resync
+	}
+
+	if len(c.ControllerResync) > 0 {
+		resync := make(map[string]time.Duration, len(k.ControllerResync)+len(c.ControllerResync))
+		maps.Copy(resync, k.ControllerResync)
+		maps.Copy(resync, c.ControllerResync)
+		k.ControllerResync = resync
+	}
+
+	return k
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"path"
+	"slices"
+	"time"
+)
+
+// NamespaceOverrides overrides the configuration for the namespaces matching any of the given patterns.
+// All matching entries apply in order, so that later entries take precedence over earlier ones.
+type NamespaceOverrides struct {
+	// Namespaces are names or shell patterns of names of namespaces, e.g. ci-*.
+	Namespaces []string `yaml:"namespaces"`
+	// Thresholds override the inherited thresholds field by field.
+	Thresholds schemav1.Thresholds `yaml:"thresholds"`
+	// Controllers restricts the namespaced controllers synchronizing objects of the matching namespaces.
+	// Objects of other controllers are not synchronized for these namespaces.
+	Controllers []string `yaml:"controllers"`
+	// Resync overrides the Kubernetes resync interval of objects of the matching namespaces.
+	// Zero disables resyncs for these namespaces.
+	Resync *time.Duration `yaml:"resync"`
+}
+
+// Validate checks constraints in the supplied namespace overrides and returns an error if they are violated.
+func (o *NamespaceOverrides) Validate() error {
+	if len(o.Namespaces) == 0 {
+		return errors.New("namespaces missing")
+	}
+
+	for _, pattern := range o.Namespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("invalid namespace pattern %q", pattern)
+		}
+	}
+
+	if err := o.Thresholds.Validate(); err != nil {
+		return errors.Wrap(err, "invalid thresholds")
+	}
+
+	for _, controller := range o.Controllers {
+		if h, ok := registry.Lookup(controller); !ok || h.ClusterScoped {
+			return errors.Errorf("unknown namespaced controller %q", controller)
+		}
+	}
+
+	if o.Resync != nil && *o.Resync < 0 {
+		return errors.New("resync must not be negative")
+	}
+
+	return nil
+}
+
+// Matches returns whether the overrides apply to the given namespace.
+func (o *NamespaceOverrides) Matches(namespace string) bool {
+	if namespace == "" {
+		return false
+	}
+
+	for _, pattern := range o.Namespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ThresholdsOf returns the given thresholds merged with the thresholds of all overrides matching the given namespace.
+func ThresholdsOf(
+	thresholds schemav1.Thresholds, overrides []NamespaceOverrides, namespace string,
+) schemav1.Thresholds {
+	for i := range overrides {
+		if overrides[i].Matches(namespace) {
+			thresholds = thresholds.Merge(overrides[i].Thresholds)
+		}
+	}
+
+	return thresholds
+}
+
+// ControllerEnabledIn returns whether the given controller synchronizes objects of the given namespace,
+// as restricted by the last of the overrides matching the namespace that lists controllers.
+func ControllerEnabledIn(overrides []NamespaceOverrides, controller, namespace string) bool {
+	for i := len(overrides) - 1; i >= 0; i-- {
+		if len(overrides[i].Controllers) > 0 && overrides[i].Matches(namespace) {
+			return slices.Contains(overrides[i].Controllers, controller)
+		}
+	}
+
+	return true
+}
+
+// ResyncIn returns the resync interval of the last of the overrides matching the given namespace that sets one,
+// or false if none does.
+func ResyncIn(overrides []NamespaceOverrides, namespace string) (time.Duration, bool) {
+	for i := len(overrides) - 1; i >= 0; i-- {
+		if overrides[i].Resync != nil && overrides[i].Matches(namespace) {
+			return *overrides[i].Resync, true
+		}
+	}
+
+	return 0, false
+}
+
+// NamespaceResyncCheck returns the shortest of the given resync interval and those of the given overrides,
+// ignoring zero intervals, so that resyncs overridden for namespaces are checked frequently enough.
+func NamespaceResyncCheck(resync time.Duration, overrides []NamespaceOverrides) time.Duration {
+	for i := range overrides {
+		if r := overrides[i].Resync; r != nil && *r > 0 && (resync == 0 || *r < resync) {
+			resync = *r
+		}
+	}
+
+	return resync
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"testing"
+	"time"
+)
+
+// TestThresholdsOf verifies that the thresholds of clusters and namespaces are merged field by field
+// with the inherited ones, so that partial overrides keep the inherited values.
+func TestThresholdsOf(t *testing.T) {
+	global := schemav1.Thresholds{
+		PodPendingAge:      schemav1.Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+		PodRestartsPerHour: schemav1.Threshold[float64]{Warning: 3, Critical: 10},
+	}
+	cluster := global.Merge(schemav1.Thresholds{
+		PodRestartsPerHour: schemav1.Threshold[float64]{Critical: 20},
+	})
+	overrides := []NamespaceOverrides{
+		{
+			Namespaces: []string{"dev"},
+			Thresholds: schemav1.Thresholds{
+				PodPendingAge: schemav1.Threshold[time.Duration]{Warning: 30 * time.Minute},
+			},
+		},
+		{
+			Namespaces: []string{"ci-*"},
+			Thresholds: schemav1.Thresholds{
+				PodPendingAge: schemav1.Threshold[time.Duration]{Warning: 2 * time.Hour},
+			},
+		},
+		{
+			Namespaces: []string{"ci-nightly"},
+			Thresholds: schemav1.Thresholds{
+				PodRestartsPerHour: schemav1.Threshold[float64]{Warning: 5},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		pending   schemav1.Threshold[time.Duration]
+		restarts  schemav1.Threshold[float64]
+	}{
+		{
+			name:      "cluster override keeps inherited values",
+			namespace: "default",
+			pending:   schemav1.Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+			restarts:  schemav1.Threshold[float64]{Warning: 3, Critical: 20},
+		},
+		{
+			name:      "namespace override keeps inherited values",
+			namespace: "dev",
+			pending:   schemav1.Threshold[time.Duration]{Warning: 30 * time.Minute, Critical: time.Hour},
+			restarts:  schemav1.Threshold[float64]{Warning: 3, Critical: 20},
+		},
+		{
+			name:      "invalid merge replaces inherited threshold",
+			namespace: "ci-1",
+			pending:   schemav1.Threshold[time.Duration]{Warning: 2 * time.Hour},
+			restarts:  schemav1.Threshold[float64]{Warning: 3, Critical: 20},
+		},
+		{
+			name:      "all matching overrides apply",
+			namespace: "ci-nightly",
+			pending:   schemav1.Threshold[time.Duration]{Warning: 2 * time.Hour},
+			restarts:  schemav1.Threshold[float64]{Warning: 5, Critical: 20},
+		},
+		{
+			name:     "cluster-scoped objects keep cluster thresholds",
+			pending:  schemav1.Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+			restarts: schemav1.Threshold[float64]{Warning: 3, Critical: 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thresholds := ThresholdsOf(cluster, overrides, tt.namespace)
+
+			if thresholds.PodPendingAge != tt.pending {
+				t.Errorf("pod_pending_age is %+v, expected %+v", thresholds.PodPendingAge, tt.pending)
+			}
+			if thresholds.PodRestartsPerHour != tt.restarts {
+				t.Errorf("pod_restarts_per_hour is %+v, expected %+v", thresholds.PodRestartsPerHour, tt.restarts)
+			}
+		})
+	}
+}
+
+// TestNamespaceOverrides verifies that the last matching entry restricting controllers or overriding the resync
+// applies to a namespace.
+func TestNamespaceOverrides(t *testing.T) {
+	hour := time.Hour
+	never := time.Duration(0)
+	overrides := []NamespaceOverrides{
+		{Namespaces: []string{"ci-*"}, Controllers: []string{"pods"}, Resync: &hour},
+		{Namespaces: []string{"ci-nightly"}, Controllers: []string{"pods", "jobs"}, Resync: &never},
+	}
+
+	tests := []struct {
+		namespace  string
+		controller string
+		enabled    bool
+		resync     time.Duration
+		overridden bool
+	}{
+		{namespace: "default", controller: "jobs", enabled: true},
+		{namespace: "ci-1", controller: "pods", enabled: true, resync: time.Hour, overridden: true},
+		{namespace: "ci-1", controller: "jobs", resync: time.Hour, overridden: true},
+		{namespace: "ci-nightly", controller: "jobs", enabled: true, overridden: true},
+	}
+
+	for _, tt := range tests {
+		if enabled := ControllerEnabledIn(overrides, tt.controller, tt.namespace); enabled != tt.enabled {
+			t.Errorf("%s of %s enabled is %t, expected %t", tt.controller, tt.namespace, enabled, tt.enabled)
+		}
+
+		resync, overridden := ResyncIn(overrides, tt.namespace)
+		if resync != tt.resync || overridden != tt.overridden {
+			t.Errorf("resync of %s is %s (%t), expected %s (%t)",
+				tt.namespace, resync, overridden, tt.resync, tt.overridden)
+		}
+	}
+
+	if check := NamespaceResyncCheck(0, overrides); check != time.Hour {
+		t.Errorf("resync check is %s, expected %s", check, time.Hour)
+	}
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"github.com/goccy/go-yaml"
+	"github.com/icinga/icinga-go-library/config"
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	"github.com/pkg/errors"
+	"os"
+	"slices"
+	"time"
+)
+
+// ProfileEdge reduces the footprint of Icinga for Kubernetes, e.g. for k3s clusters on ARM edge devices,
+// at the expense of the freshness and completeness of the synchronized data.
+// It doesn't change the database, which must still be MySQL or MariaDB.
+const ProfileEdge = "edge"
+
+// profiles maps the names of profiles to functions that preset their values on a Config before it is loaded.
+var profiles = map[string]func(*Config){
+	ProfileEdge: func(c *Config) {
+		c.Kubernetes.Qps = 2
+		c.Kubernetes.Burst = 5
+		c.Kubernetes.Debounce = 10 * time.Second
+		c.Kubernetes.RelationWorkers = 1
+		for _, controller := range registry.Names() {
+			if h, _ := registry.Lookup(controller); h.PartialMetadata {
+				c.Kubernetes.MetadataOnly = append(c.Kubernetes.MetadataOnly, controller)
+			}
+		}
+		c.Prometheus.Buffer = 100
+		c.Prometheus.Interval = 5 * time.Minute
+		c.Prometheus.Compact = true
+		c.ContainerLogs = new(bool)
+	},
+}
+
+// FromYAMLFile loads the configuration from the given YAML file into c.
+// If the file selects a profile, its values are preset before the file is loaded again,
+// so that options set in the file take precedence over the profile, which in turn takes precedence over the defaults.
+func FromYAMLFile(name string, c *Config) error {
+	if err := config.FromYAMLFile(name, c); err != nil {
+		return err
+	}
+
+	preset, ok := profiles[c.Profile]
+	if !ok {
+		return nil
+	}
+
+	*c = Config{}
+	preset(c)
+
+	if err := config.FromYAMLFile(name, c); err != nil {
+		return err
+	}
+
+	return presetClusters(name, c, preset)
+}
+
+// presetClusters presets the prometheus options of the clusters configured in the given YAML file,
+// which can't be done by loading it again, as list entries are decoded from scratch.
+// Instead, the prometheus options of each cluster are decoded again onto the preset ones.
+func presetClusters(name string, c *Config, preset func(*Config)) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return errors.Wrap(err, "can't read YAML file "+name)
+	}
+
+	var file struct {
+		Clusters []struct {
+			Prometheus map[string]any `yaml:"prometheus"`
+		} `yaml:"clusters"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return errors.Wrap(err, "can't parse YAML file "+name)
+	}
+
+	for i := range c.Clusters {
+		var profile Config
+		preset(&profile)
+
+		if i < len(file.Clusters) && file.Clusters[i].Prometheus != nil {
+			prometheus, err := yaml.Marshal(file.Clusters[i].Prometheus)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if err := yaml.Unmarshal(prometheus, &profile.Prometheus); err != nil {
+				return errors.Wrapf(err, "can't parse prometheus options of cluster %s", c.Clusters[i].Name)
+			}
+		}
+
+		c.Clusters[i].Prometheus = profile.Prometheus
+	}
+
+	return nil
+}
+
+// validateProfile returns an error if the given profile is not known.
+func validateProfile(profile string) error {
+	if profile == "" {
+		return nil
+	}
+
+	if _, ok := profiles[profile]; !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		return errors.Errorf("unknown profile %q, must be one of %v", profile, names)
+	}
+
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package apipb contains the protobuf types and the gRPC service of the API generated from api.proto.
+package apipb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative api.proto
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/com"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sync"
+)
+
+const (
+	// Upsert is the type of changes of created or updated objects.
+	Upsert = "upsert"
+	// Delete is the type of changes of deleted objects.
+	Delete = "delete"
+)
+
+// subscriberQueueSize is the number of changes buffered per subscriber.
+// Subscribers that can't keep up are disconnected, so that they don't delay synchronization.
+const subscriberQueueSize = 1024
+
+// Change is streamed to subscribers once a synchronized object has been written to the database.
+type Change struct {
+	Type      string     `json:"type"`
+	Cluster   string     `json:"cluster,omitempty"`
+	Resource  string     `json:"resource"`
+	Id        types.UUID `json:"id"`
+	Namespace string     `json:"namespace,omitempty"`
+	Name      string     `json:"name,omitempty"`
+}
+
+// Changes distributes the changes processed by the controllers to subscribers.
+// All methods are no-ops on a nil Changes, so that it can be passed around unconditionally.
+type Changes struct {
+	mu          sync.Mutex
+	subscribers map[chan Change]struct{}
+}
+
+// NewChanges creates a new Changes.
+func NewChanges() *Changes {
+	return &Changes{subscribers: make(map[chan Change]struct{})}
+}
+
+// Upserted returns a com.ProcessBulk publishing the upserted objects of the given resource and cluster,
+// to be used with sync.WithOnUpsert.
+func (c *Changes) Upserted(cluster, resource string) com.ProcessBulk[any] {
+	return func(_ context.Context, bulk []any) error {
+		if c == nil {
+			return nil
+		}
+
+		for _, entity := range bulk {
+			obj := entity.(kmetav1.Object)
+			c.publish(Change{
+				Type:      Upsert,
+				Cluster:   cluster,
+				Resource:  resource,
+				Id:        schemav1.EnsureUUID(obj.GetUID()),
+				Namespace: obj.GetNamespace(),
+				Name:      obj.GetName(),
+			})
+		}
+
+		return nil
+	}
+}
+
+// Deleted returns a com.ProcessBulk publishing the deleted objects of the given resource and cluster by their IDs,
+// to be used with sync.WithOnDelete.
+func (c *Changes) Deleted(cluster, resource string) com.ProcessBulk[any] {
+	return func(_ context.Context, bulk []any) error {
+		if c == nil {
+			return nil
+		}
+
+		for _, id := range bulk {
+			c.publish(Change{Type: Delete, Cluster: cluster, Resource: resource, Id: id.(types.UUID)})
+		}
+
+		return nil
+	}
+}
+
+// Subscribe returns a channel receiving all changes published from now on and a function to unsubscribe.
+// The channel is closed once unsubscribed or if the subscriber can't keep up.
+func (c *Changes) Subscribe() (<-chan Change, func()) {
+	ch := make(chan Change, subscriberQueueSize)
+
+	c.mu.Lock()
+	c.subscribers[ch] = struct{}{}
+	c.mu.Unlock()
+
+	return ch, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.unsubscribe(ch)
+	}
+}
+
+func (c *Changes) publish(change Change) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for ch := range c.subscribers {
+		select {
+		case ch <- change:
+		default:
+			c.unsubscribe(ch)
+		}
+	}
+}
+
+// unsubscribe removes and closes the given subscriber, if not done already. Must be called with mu held.
+func (c *Changes) unsubscribe(ch chan Change) {
+	if _, ok := c.subscribers[ch]; ok {
+		delete(c.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"net"
+)
+
+// Config defines the configuration of the REST and gRPC API.
+type Config struct {
+	// Listen is the address to listen on for REST requests. If not set, the REST API is disabled.
+	Listen string `yaml:"listen"`
+	// GrpcListen is the address to listen on for gRPC requests. If not set, the gRPC API is disabled.
+	GrpcListen string `yaml:"grpc_listen"`
+	// Token is required as bearer token in the Authorization header or metadata of requests, if set.
+	// It must be set unless the API only listens on loopback addresses, as it serves container logs and manifests.
+	Token string `yaml:"token"`
+}
+
+// Enabled returns whether the API listens for REST or gRPC requests.
+func (c *Config) Enabled() bool {
+	return c.Listen != "" || c.GrpcListen != ""
+}
+
+// Validate checks constraints in the supplied API configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if err := c.validateListen("listen", c.Listen); err != nil {
+		return err
+	}
+
+	return c.validateListen("grpc_listen", c.GrpcListen)
+}
+
+func (c *Config) validateListen(key, listen string) error {
+	if listen == "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return errors.Wrapf(err, "invalid api %s address", key)
+	}
+
+	if c.Token == "" && !loopback(host) {
+		return errors.Errorf(
+			"api token required unless %s is a loopback address, e.g. localhost:8080", key)
+	}
+
+	return nil
+}
+
+// loopback returns whether the given host is localhost or a loopback IP address.
+// An empty host listens on all addresses.
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/icinga/icinga-kubernetes/pkg/api/apipb"
+	"github.com/icinga/icinga-kubernetes/pkg/export"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// grpcServer implements the Inventory service of the gRPC API on top of the queries of the REST API.
+type grpcServer struct {
+	apipb.UnimplementedInventoryServer
+
+	server *Server
+}
+
+// ListenAndServeGrpc serves gRPC requests on the configured grpc_listen address until ctx is canceled
+// or an error occurs. See api.proto in the apipb package for the service.
+func (s *Server) ListenAndServeGrpc(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.GrpcListen)
+	if err != nil {
+		return errors.Wrap(err, "can't listen for API gRPC requests")
+	}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.authenticateUnary),
+		grpc.ChainStreamInterceptor(s.authenticateStream))
+	apipb.RegisterInventoryServer(server, &grpcServer{server: s})
+
+	go func() {
+		<-ctx.Done()
+
+		// Streams of changes don't end by themselves, so they are canceled if they don't end in time.
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			server.Stop()
+		}
+	}()
+
+	if err := server.Serve(listener); err != nil {
+		return errors.Wrap(err, "can't serve API gRPC requests")
+	}
+
+	return ctx.Err()
+}
+
+func (g *grpcServer) List(ctx context.Context, req *apipb.ListRequest) (*apipb.ListResponse, error) {
+	p, err := g.server.listResource(
+		ctx, req.Resource, filters(req.Filters), limit(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, g.server.grpcErr(err)
+	}
+
+	return g.server.listResponse(p)
+}
+
+func (g *grpcServer) Get(ctx context.Context, req *apipb.GetRequest) (*structpb.Struct, error) {
+	item, err := g.server.get(ctx, req.Resource, req.Id)
+	if err != nil {
+		return nil, g.server.grpcErr(err)
+	}
+
+	s, err := toStruct(item)
+	if err != nil {
+		return nil, g.server.grpcErr(err)
+	}
+
+	return s, nil
+}
+
+func (g *grpcServer) ListMetrics(ctx context.Context, req *apipb.ListMetricsRequest) (*apipb.ListResponse, error) {
+	p, err := g.server.listMetrics(
+		ctx, req.Resource, req.Id, req.From, req.To, filters(req.Filters), limit(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, g.server.grpcErr(err)
+	}
+
+	return g.server.listResponse(p)
+}
+
+func (g *grpcServer) GetManifest(ctx context.Context, req *apipb.GetManifestRequest) (*apipb.Manifest, error) {
+	format := req.Format
+	if format == "" {
+		format = export.Yaml
+	}
+
+	manifest, err := g.server.manifest(ctx, req.Resource, req.Id, format)
+	if err != nil {
+		return nil, g.server.grpcErr(err)
+	}
+
+	return &apipb.Manifest{Data: manifest, Format: format}, nil
+}
+
+// WatchChanges streams changes matching the request until the client disconnects.
+// Clients that can't keep up are disconnected and have to reconnect, refetching the resources they display.
+func (g *grpcServer) WatchChanges(req *apipb.WatchChangesRequest, stream apipb.Inventory_WatchChangesServer) error {
+	f := changeFilter{clusters: req.Clusters, resources: req.Resources, namespaces: req.Namespaces}
+
+	changes, unsubscribe := g.server.changes.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case change, more := <-changes:
+			if !more {
+				return status.Error(codes.ResourceExhausted, "client can't keep up with changes")
+			}
+
+			if !f.matches(change) {
+				continue
+			}
+
+			t := apipb.Change_UPSERT
+			if change.Type == Delete {
+				t = apipb.Change_DELETE
+			}
+
+			if err := stream.Send(&apipb.Change{
+				Type:      t,
+				Cluster:   change.Cluster,
+				Resource:  change.Resource,
+				Id:        change.Id.String(),
+				Namespace: change.Namespace,
+				Name:      change.Name,
+			}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// authenticateUnary requires the configured token, if any, as bearer token in the authorization metadata.
+func (s *Server) authenticateUnary(
+	ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (any, error) {
+	if err := s.authenticateGrpc(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// authenticateStream requires the configured token, if any, as bearer token in the authorization metadata.
+func (s *Server) authenticateStream(
+	srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if err := s.authenticateGrpc(stream.Context()); err != nil {
+		return err
+	}
+
+	return handler(srv, stream)
+}
+
+func (s *Server) authenticateGrpc(ctx context.Context) error {
+	if s.config.Token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid or missing bearer token")
+}
+
+// grpcErr returns the gRPC status of the given error if it is caused by the request,
+// otherwise it logs the error and returns an internal error.
+func (s *Server) grpcErr(err error) error {
+	var re requestError
+	if errors.As(err, &re) {
+		code := codes.InvalidArgument
+		if re.status == http.StatusNotFound {
+			code = codes.NotFound
+		}
+
+		return status.Error(code, re.message)
+	}
+
+	s.log.Error(err, "Can't serve API gRPC request")
+
+	return status.Error(codes.Internal, "internal server error")
+}
+
+// listResponse converts the given page into a ListResponse.
+func (s *Server) listResponse(p *page) (*apipb.ListResponse, error) {
+	resp := &apipb.ListResponse{Total: uint64(p.Total), Limit: uint32(p.Limit), Offset: uint32(p.Offset)}
+	for _, item := range p.Items {
+		st, err := toStruct(item)
+		if err != nil {
+			return nil, s.grpcErr(err)
+		}
+
+		resp.Items = append(resp.Items, st)
+	}
+
+	return resp, nil
+}
+
+// toStruct converts the given row into a Struct with the same values as its JSON representation of the REST API.
+func toStruct(item map[string]any) (*structpb.Struct, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, s); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return s, nil
+}
+
+// filters converts the given filters into a map from column names to values.
+func filters(fs []*apipb.Filter) map[string][]string {
+	m := make(map[string][]string, len(fs))
+	for _, f := range fs {
+		m[f.Column] = append(m[f.Column], f.Values...)
+	}
+
+	return m
+}
+
+// limit returns the given limit, or DefaultLimit if it isn't set.
+func limit(l uint32) int {
+	if l == 0 {
+		return DefaultLimit
+	}
+
+	return int(l)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"sigs.k8s.io/yaml"
+)
+
+// OpenApi is the OpenAPI specification of the REST API as YAML.
+//
+//go:embed openapi.yaml
+var OpenApi []byte
+
+// serveOpenApi responds with the OpenAPI specification as YAML or, if requested via openapi.json, as JSON.
+func (s *Server) serveOpenApi(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/openapi.yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(OpenApi)
+
+		return
+	}
+
+	spec, err := yaml.YAMLToJSON(OpenApi)
+	if err != nil {
+		s.fail(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(spec)
+}
@@ -0,0 +1,722 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/export"
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	"github.com/pkg/errors"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLimit is the number of items returned per page if no limit is requested.
+	DefaultLimit = 100
+	// MaxLimit is the maximum number of items returned per page.
+	MaxLimit = 1000
+)
+
+// resources maps the resource names of the API, which match the controller names where applicable, to their tables.
+var resources = map[string]string{
+	"namespaces":           "namespace",
+	"nodes":                "node",
+	"node-disks":           "node_disk",
+	"pods":                 "pod",
+	"containers":           "container",
+	"deployments":          "deployment",
+	"daemon-sets":          "daemon_set",
+	"replica-sets":         "replica_set",
+	"stateful-sets":        "stateful_set",
+	"services":             "service",
+	"endpoints":            "endpoint_slice",
+	"secrets":              "secret",
+	"config-maps":          "config_map",
+	"events":               "event",
+	"pvcs":                 "pvc",
+	"persistent-volumes":   "persistent_volume",
+	"jobs":                 "job",
+	"cron-jobs":            "cron_job",
+	"hpas":                 "hpa",
+	"ingresses":            "ingress",
+	"routes":               "route",
+	"job-failures":         "job_failure",
+	"cron-job-problems":    "cron_job_problem",
+	"hpa-scalings":         "hpa_scaling",
+	"hpa-problems":         "hpa_problem",
+	"image-pulls":          "image_pull",
+	"ingress-conflicts":    "ingress_conflict",
+	"node-drain-risks":     "node_drain_risk",
+	"node-drain-risk-pdbs": "node_drain_risk_pdb",
+	"node-fragmentations":  "node_fragmentation",
+	"service-problems":     "service_problem",
+	"api-warnings":         "api_warning",
+	"etcd-object-counts":   "etcd_object_count",
+	"etcd-sizes":           "etcd_size",
+	"problems":             "problem",
+	"state-history":        "state_history",
+	"clusters":             "cluster",
+
+	// Resources of Istio are only synchronized if it is installed.
+	"istio-virtual-services": "istio_virtual_service",
+	"istio-gateways":         "istio_gateway",
+
+	// Resources of Cilium are only synchronized if it is installed.
+	"cilium-endpoints": "cilium_endpoint",
+
+	// Resources of Velero are only synchronized if it is installed.
+	"velero-backups":   "velero_backup",
+	"velero-restores":  "velero_restore",
+	"velero-schedules": "velero_schedule",
+
+	// Resources of GitOps tools are only synchronized if they are installed.
+	"argo-applications":   "argo_application",
+	"flux-kustomizations": "flux_kustomization",
+	"gitops-problems":     "gitops_problem",
+
+	// Resources of the Operator Lifecycle Manager are only synchronized if it is installed.
+	"olm-subscriptions":            "olm_subscription",
+	"olm-cluster-service-versions": "olm_cluster_service_version",
+}
+
+// resourceTable returns the table of the given resource,
+// which may also be the name of a resource handler registered downstream.
+func resourceTable(resource string) (string, bool) {
+	if table, ok := resources[resource]; ok {
+		return table, true
+	}
+
+	if h, ok := registry.Lookup(resource); ok {
+		return h.Table(), true
+	}
+
+	return "", false
+}
+
+// metrics maps the resource names of the API to their Prometheus metric tables and foreign keys.
+var metrics = map[string][2]string{
+	"nodes":      {"prometheus_node_metric", "node_uuid"},
+	"pods":       {"prometheus_pod_metric", "pod_uuid"},
+	"containers": {"prometheus_container_metric", "container_uuid"},
+	"services":   {"prometheus_service_metric", "service_uuid"},
+}
+
+// Server serves the synchronized data read-only as JSON via HTTP, so that it can be consumed without SQL access:
+//
+//	GET /api/v1/{resource}               lists resources, filtered by any of their columns, e.g. ?namespace=default
+//	GET /api/v1/{resource}/{id}          returns a single resource by its UUID
+//	GET /api/v1/{resource}/{id}/metrics  lists the Prometheus metrics of nodes, pods and containers
+//	GET /api/v1/{resource}/{id}/manifest returns the stored manifest of a resource as YAML, or JSON with ?format=json
+//	GET /api/v1/changes                  streams changes as server-sent events, e.g. ?resource=pods&namespace=default
+//	GET /api/v1/openapi.yaml             returns the OpenAPI specification of the API, also as openapi.json
+//
+// Lists are paginated with the limit and offset query parameters.
+// Metrics can additionally be restricted to a time range with the from and to query parameters in Unix milliseconds.
+type Server struct {
+	config  Config
+	db      *database.Database
+	changes *Changes
+	log     logr.Logger
+
+	mu      sync.Mutex
+	columns map[string][]string
+}
+
+// NewServer creates a new Server for the given database, streaming the given changes.
+func NewServer(config Config, db *database.Database, changes *Changes, log logr.Logger) *Server {
+	return &Server{
+		config:  config,
+		db:      db,
+		changes: changes,
+		log:     log,
+		columns: make(map[string][]string),
+	}
+}
+
+// ListenAndServe serves HTTP requests until ctx is canceled or an error occurs.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/changes", s.serveChanges)
+	mux.HandleFunc("GET /api/v1/openapi.yaml", s.serveOpenApi)
+	mux.HandleFunc("GET /api/v1/openapi.json", s.serveOpenApi)
+	mux.HandleFunc("GET /api/v1/{resource}", s.serveList)
+	mux.HandleFunc("GET /api/v1/{resource}/{id}", s.serveGet)
+	mux.HandleFunc("GET /api/v1/{resource}/{id}/metrics", s.serveMetrics)
+	mux.HandleFunc("GET /api/v1/{resource}/{id}/manifest", s.serveManifest)
+
+	server := &http.Server{
+		Addr:              s.config.Listen,
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "can't serve API HTTP requests")
+	}
+
+	return ctx.Err()
+}
+
+// authenticate requires the configured token, if any, as bearer token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.config.Token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestError is caused by an invalid request and reported to clients with its HTTP status.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e requestError) Error() string {
+	return e.message
+}
+
+func badRequest(message string) error {
+	return requestError{status: http.StatusBadRequest, message: message}
+}
+
+func notFound(message string) error {
+	return requestError{status: http.StatusNotFound, message: message}
+}
+
+// page is a page of a list of rows.
+type page struct {
+	Items  []map[string]any `json:"items"`
+	Total  int              `json:"total"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+}
+
+// changeFilter restricts the streamed changes to the given clusters, resources and namespaces, if set.
+type changeFilter struct {
+	clusters   []string
+	resources  []string
+	namespaces []string
+}
+
+// matches returns whether the given change matches the filter.
+// The namespace of deleted objects is unknown, so they match any namespace.
+func (f changeFilter) matches(change Change) bool {
+	if len(f.clusters) > 0 && !slices.Contains(f.clusters, change.Cluster) {
+		return false
+	}
+
+	if len(f.resources) > 0 && !slices.Contains(f.resources, change.Resource) {
+		return false
+	}
+
+	return change.Type == Delete || len(f.namespaces) == 0 || slices.Contains(f.namespaces, change.Namespace)
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, offset, err := pagination(query)
+	if err != nil {
+		s.writeErr(w, err)
+
+		return
+	}
+
+	p, err := s.listResource(r.Context(), r.PathValue("resource"), query, limit, offset)
+	if err != nil {
+		s.writeErr(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) serveGet(w http.ResponseWriter, r *http.Request) {
+	item, err := s.get(r.Context(), r.PathValue("resource"), r.PathValue("id"))
+	if err != nil {
+		s.writeErr(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, offset, err := pagination(query)
+	if err != nil {
+		s.writeErr(w, err)
+
+		return
+	}
+
+	var bounds [2]*int64
+	for i, param := range []string{"from", "to"} {
+		if v := query.Get(param); v != "" {
+			ms, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+param)
+
+				return
+			}
+
+			bounds[i] = &ms
+		}
+
+		query.Del(param)
+	}
+
+	p, err := s.listMetrics(
+		r.Context(), r.PathValue("resource"), r.PathValue("id"), bounds[0], bounds[1], query, limit, offset)
+	if err != nil {
+		s.writeErr(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) serveManifest(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.Yaml
+	}
+
+	manifest, err := s.manifest(r.Context(), r.PathValue("resource"), r.PathValue("id"), format)
+	if err != nil {
+		s.writeErr(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/"+format)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(manifest)
+}
+
+// serveChanges streams changes matching the request's cluster, resource and namespace query parameters,
+// if given, as server-sent events until the client disconnects.
+// Clients that can't keep up are disconnected and have to reconnect, refetching the resources they display.
+func (s *Server) serveChanges(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+
+		return
+	}
+
+	query := r.URL.Query()
+	f := changeFilter{clusters: query["cluster"], resources: query["resource"], namespaces: query["namespace"]}
+
+	changes, unsubscribe := s.changes.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments keep idle connections from being closed by proxies.
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case change, more := <-changes:
+			if !more {
+				return
+			}
+
+			if !f.matches(change) {
+				continue
+			}
+
+			data, err := json.Marshal(change)
+			if err != nil {
+				s.log.Error(errors.WithStack(err), "Can't marshal change")
+
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", change.Type, data); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// pagination returns the limit and offset query parameters, or their defaults, and removes them from query.
+func pagination(query url.Values) (int, int, error) {
+	limit, offset := DefaultLimit, 0
+
+	var err error
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return 0, 0, badRequest(fmt.Sprintf("limit must be between 1 and %d", MaxLimit))
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			return 0, 0, badRequest("offset must not be negative")
+		}
+	}
+	query.Del("limit")
+	query.Del("offset")
+
+	return limit, offset, nil
+}
+
+// listResource returns the given page of the rows of the given resource whose columns match filters.
+func (s *Server) listResource(
+	ctx context.Context, resource string, filters map[string][]string, limit, offset int,
+) (*page, error) {
+	table, ok := resourceTable(resource)
+	if !ok {
+		return nil, notFound("unknown resource")
+	}
+
+	return s.list(ctx, table, "uuid", filters, limit, offset, nil)
+}
+
+// get returns the row of the resource with the given ID.
+func (s *Server) get(ctx context.Context, resource, id string) (map[string]any, error) {
+	table, ok := resourceTable(resource)
+	if !ok {
+		return nil, notFound("unknown resource")
+	}
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, badRequest("invalid id")
+	}
+
+	columns, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.query(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE uuid = ?", strings.Join(columns, ", "), table), uid[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, notFound("not found")
+	}
+
+	return items[0], nil
+}
+
+// listMetrics returns the given page of the Prometheus metrics of the resource with the given ID
+// whose columns match filters, optionally restricted to the time range from and to in Unix milliseconds.
+func (s *Server) listMetrics(
+	ctx context.Context, resource, id string, from, to *int64, filters map[string][]string, limit, offset int,
+) (*page, error) {
+	m, ok := metrics[resource]
+	if !ok {
+		return nil, notFound("resource has no metrics")
+	}
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, badRequest("invalid id")
+	}
+
+	var f filter
+	// Compacted rows cover all timestamps up to their until column, so they are included if they end after from.
+	if from != nil {
+		f.where = append(f.where, "until >= ?")
+		f.args = append(f.args, *from)
+	}
+	if to != nil {
+		f.where = append(f.where, "timestamp < ?")
+		f.args = append(f.args, *to)
+	}
+
+	filters = maps.Clone(filters)
+	if filters == nil {
+		filters = make(map[string][]string)
+	}
+	filters[m[1]] = []string{uid.String()}
+
+	return s.list(ctx, m[0], "timestamp", filters, limit, offset, &f)
+}
+
+// manifest returns the stored manifest of the resource with the given ID in the given format.
+func (s *Server) manifest(ctx context.Context, resource, id, format string) ([]byte, error) {
+	table, ok := resourceTable(resource)
+	if !ok || !export.HasManifest(table) {
+		return nil, notFound("resource has no manifest")
+	}
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, badRequest("invalid id")
+	}
+
+	if format != export.Yaml && format != export.Json {
+		return nil, badRequest("format must be yaml or json")
+	}
+
+	var manifest []byte
+	query := s.db.Rebind(fmt.Sprintf("SELECT yaml FROM %s WHERE uuid = ?", table))
+	if err := s.db.GetContext(ctx, &manifest, query, uid[:]); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, notFound("not found")
+		}
+
+		return nil, database.CantPerformQuery(err, query)
+	}
+
+	if len(manifest) == 0 {
+		return nil, notFound("no manifest stored")
+	}
+
+	return export.Convert(manifest, format)
+}
+
+// filter restricts lists in addition to the filters by column.
+type filter struct {
+	where []string
+	args  []any
+}
+
+// list returns the given page of the rows of the given table whose columns match filters,
+// which map column names to the values of which any must match.
+func (s *Server) list(
+	ctx context.Context, table, orderBy string, filters map[string][]string, limit, offset int, f *filter,
+) (*page, error) {
+	if limit < 1 || limit > MaxLimit {
+		return nil, badRequest(fmt.Sprintf("limit must be between 1 and %d", MaxLimit))
+	}
+	if offset < 0 {
+		return nil, badRequest("offset must not be negative")
+	}
+
+	columns, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []any
+	if f != nil {
+		where = append(where, f.where...)
+		args = append(args, f.args...)
+	}
+
+	for column, values := range filters {
+		if !slices.Contains(columns, column) {
+			return nil, badRequest("unknown filter " + column)
+		}
+
+		var in []string
+		for _, v := range values {
+			var arg any = v
+			if isUuidColumn(column) {
+				id, err := uuid.Parse(v)
+				if err != nil {
+					return nil, badRequest("invalid " + column)
+				}
+
+				arg = id[:]
+			}
+
+			in = append(in, "?")
+			args = append(args, arg)
+		}
+
+		where = append(where, fmt.Sprintf("%s IN (%s)", column, strings.Join(in, ", ")))
+	}
+
+	var cond string
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.GetContext(
+		ctx, &total, s.db.Rebind(fmt.Sprintf("SELECT COUNT(*) FROM %s%s", table, cond)), args...,
+	); err != nil {
+		return nil, errors.Wrap(err, "can't count rows")
+	}
+
+	items, err := s.query(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s%s ORDER BY %s LIMIT %d OFFSET %d",
+		strings.Join(columns, ", "), table, cond, orderBy, limit, offset), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page{Items: items, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// tableColumns returns the columns of the given table, except for the YAML of resources, which may be large.
+func (s *Server) tableColumns(ctx context.Context, table string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if columns, ok := s.columns[table]; ok {
+		return columns, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", table))
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't query columns of table %s", table)
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't query columns of table %s", table)
+	}
+
+	columns = slices.DeleteFunc(columns, func(column string) bool { return column == "yaml" })
+	s.columns[table] = columns
+
+	return columns, nil
+}
+
+// query returns the rows of the given query as maps from column names to JSON-friendly values.
+func (s *Server) query(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+	rows, err := s.db.QueryxContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		return nil, database.CantPerformQuery(err, query)
+	}
+	defer func() { _ = rows.Close() }()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	items := make([]map[string]any, 0)
+	for rows.Next() {
+		item := make(map[string]any, len(types))
+		if err := rows.MapScan(item); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for _, t := range types {
+			item[t.Name()] = convert(t.Name(), t.DatabaseTypeName(), item[t.Name()])
+		}
+
+		items = append(items, item)
+	}
+
+	return items, errors.WithStack(rows.Err())
+}
+
+// writeErr responds with the status of the given error if it is caused by the request,
+// otherwise it logs the error and responds with an internal server error.
+func (s *Server) writeErr(w http.ResponseWriter, err error) {
+	var re requestError
+	if errors.As(err, &re) {
+		writeError(w, re.status, re.message)
+
+		return
+	}
+
+	s.fail(w, err)
+}
+
+// fail logs the given error and responds with an internal server error.
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	s.log.Error(err, "Can't serve API request")
+
+	writeError(w, http.StatusInternalServerError, "internal server error")
+}
+
+// convert converts raw column values returned by the database driver into values that are marshaled into JSON
+// according to their database type, e.g. binary UUIDs into their string representation.
+func convert(column, databaseType string, v any) any {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+
+	switch databaseType {
+	case "BINARY", "VARBINARY", "BYTEA":
+		if id, err := uuid.FromBytes(b); err == nil && isUuidColumn(column) {
+			return id.String()
+		}
+
+		return b
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "INT2", "INT4", "INT8":
+		if i, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return i
+		}
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		if i, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+			return i
+		}
+	case "FLOAT", "DOUBLE", "DECIMAL", "FLOAT4", "FLOAT8", "NUMERIC":
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
+		}
+	}
+
+	return string(b)
+}
+
+// isUuidColumn returns whether the given column holds binary UUIDs.
+func isUuidColumn(column string) bool {
+	return column == "uuid" || strings.HasSuffix(column, "_uuid")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,215 @@
+// Package apimetrics records the latency and errors of the requests to the Kubernetes API server
+// made by Icinga for Kubernetes itself, which indicate the health of the API server from the perspective
+// of a workload in the cluster.
+package apimetrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interval in which the recorded requests are stored, aligned with the Prometheus metrics.
+const interval = time.Minute
+
+// key identifies the requests of a verb to a resource.
+type key struct {
+	verb     string
+	resource string
+}
+
+// stats are the recorded requests of a key since they have last been stored.
+type stats struct {
+	requests   int64
+	errors     int64
+	latencySum time.Duration
+	latencyMax time.Duration
+}
+
+// Recorder records the requests made via the transports it wraps
+// and stores them per verb and resource every minute in the api_request table.
+// Requests fail if they can't be sent or the API server responds with a server error or too many requests.
+type Recorder struct {
+	mu    sync.Mutex
+	stats map[key]*stats
+}
+
+// NewRecorder creates a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{stats: make(map[key]*stats)}
+}
+
+// Wrap wraps the given transport so that its requests are recorded.
+// It is supposed to be passed to rest.Config.Wrap.
+func (r *Recorder) Wrap(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		res, err := rt.RoundTrip(req)
+		failed := err != nil || res.StatusCode >= http.StatusInternalServerError ||
+			res.StatusCode == http.StatusTooManyRequests
+		r.record(verb(req), resource(req.URL.Path), time.Since(start), failed)
+
+		return res, err
+	})
+}
+
+// Run stores the recorded requests every minute until ctx is canceled.
+func (r *Recorder) Run(ctx context.Context, db *database.Database, clusterUuid types.UUID) error {
+	for {
+		select {
+		case <-time.After(time.Until(time.Now().Truncate(interval).Add(interval))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// The requests have been recorded in the minute that just ended.
+		if err := r.store(ctx, db, clusterUuid, time.Now().Add(-interval)); err != nil {
+			return err
+		}
+	}
+}
+
+// record records a request with the given verb, resource and latency.
+func (r *Recorder) record(verb, resource string, latency time.Duration, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := key{verb: verb, resource: resource}
+	s, ok := r.stats[k]
+	if !ok {
+		s = &stats{}
+		r.stats[k] = s
+	}
+
+	s.requests++
+	if failed {
+		s.errors++
+	}
+	s.latencySum += latency
+	s.latencyMax = max(s.latencyMax, latency)
+}
+
+// store stores the requests recorded so far as the requests of the given minute and resets them.
+func (r *Recorder) store(ctx context.Context, db *database.Database, clusterUuid types.UUID, minute time.Time) error {
+	r.mu.Lock()
+	recorded := r.stats
+	r.stats = make(map[key]*stats, len(recorded))
+	r.mu.Unlock()
+
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	timestamp := schemav1.MetricTimestamp(minute)
+	entities := make(chan interface{}, len(recorded))
+	for k, s := range recorded {
+		entities <- &schemav1.ApiRequest{
+			Uuid:        schemav1.NewUUID(clusterUuid, fmt.Sprintf("%d/%s/%s", timestamp, k.verb, k.resource)),
+			ClusterUuid: clusterUuid,
+			Timestamp:   timestamp,
+			Verb:        k.verb,
+			Resource:    k.resource,
+			Requests:    s.requests,
+			Errors:      s.errors,
+			LatencyAvg:  (s.latencySum / time.Duration(s.requests)).Milliseconds(),
+			LatencyMax:  s.latencyMax.Milliseconds(),
+		}
+	}
+	close(entities)
+
+	return errors.Wrap(db.UpsertStreamed(ctx, entities), "can't store API requests")
+}
+
+// verb returns the Kubernetes verb of the given request, e.g. list or watch.
+func verb(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet:
+		if req.URL.Query().Get("watch") == "true" {
+			return "watch"
+		}
+
+		if _, name, _ := parse(req.URL.Path); name == "" {
+			return "list"
+		}
+
+		return "get"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		if _, name, _ := parse(req.URL.Path); name == "" {
+			return "deletecollection"
+		}
+
+		return "delete"
+	default:
+		return strings.ToLower(req.Method)
+	}
+}
+
+// resource returns the resource of the given request path as <resource>[.<group>][/<subresource>],
+// e.g. deployments.apps or pods/log, or the path itself if it isn't a resource path, e.g. /metrics.
+func resource(path string) string {
+	resource, _, ok := parse(path)
+	if !ok {
+		return path
+	}
+
+	return resource
+}
+
+// parse parses the given request path of a resource, i.e. /api/<version>/... or /apis/<group>/<version>/...,
+// optionally followed by namespaces/<namespace>, and returns its resource and the name of the requested object,
+// which is empty for requests of collections.
+func parse(path string) (resource, name string, ok bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var group string
+	switch {
+	case len(segments) >= 3 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 4 && segments[0] == "apis":
+		group = segments[1]
+		segments = segments[3:]
+	default:
+		return "", "", false
+	}
+
+	// Namespaced resources, except namespaces themselves and their subresources.
+	if len(segments) >= 3 && segments[0] == "namespaces" && segments[2] != "status" && segments[2] != "finalize" {
+		segments = segments[2:]
+	}
+
+	resource = segments[0]
+	if group != "" {
+		resource += "." + group
+	}
+
+	if len(segments) >= 2 {
+		name = segments[1]
+	}
+
+	if len(segments) >= 3 {
+		resource += "/" + segments[2]
+	}
+
+	return resource, name, true
+}
+
+// roundTripperFunc is an adapter to allow the use of ordinary functions as http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements the http.RoundTripper interface.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
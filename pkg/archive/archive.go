@@ -0,0 +1,139 @@
+// Package archive archives rows to S3-compatible object storage before the retention deletes them.
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Archiver archives the rows to delete as gzip-compressed NDJSON objects, one per table and cleanup,
+// named <prefix><table>/<yyyy>/<mm>/<dd>/<hhmmss>.ndjson.gz after the time the rows are older than.
+// UUIDs are archived as strings.
+type Archiver struct {
+	config *Config
+	client *minio.Client
+	log    logr.Logger
+}
+
+// NewArchiver creates a new Archiver for the configured object storage.
+func NewArchiver(c *Config, log logr.Logger) (*Archiver, error) {
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.IAM{},
+	})
+	if c.AccessKeyId != "" {
+		creds = credentials.NewStaticV4(c.AccessKeyId, c.SecretAccessKey, "")
+	}
+
+	client, err := minio.New(c.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !c.Insecure,
+		Region: c.Region,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create object storage client")
+	}
+
+	return &Archiver{config: c, client: client, log: log}, nil
+}
+
+// For returns a as database.Archiver if rows of the given table are archived, otherwise nil.
+func (a *Archiver) For(table string) database.Archiver {
+	if a == nil || !a.config.Archives(table) {
+		return nil
+	}
+
+	return a
+}
+
+// Archive implements database.Archiver.
+func (a *Archiver) Archive(ctx context.Context, db *database.Database, stmt database.CleanupStmt, olderThan time.Time) error {
+	f, err := os.CreateTemp("", "icinga-kubernetes-archive-*.ndjson.gz")
+	if err != nil {
+		return errors.Wrap(err, "can't create temporary file")
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	n, err := a.dump(ctx, db, stmt, olderThan, f)
+	if err != nil || n == 0 {
+		return err
+	}
+
+	key := path.Join(a.config.Prefix, stmt.Table, olderThan.UTC().Format("2006/01/02/150405")+".ndjson.gz")
+	if _, err := a.client.FPutObject(ctx, a.config.Bucket, key, f.Name(), minio.PutObjectOptions{
+		ContentType: "application/gzip",
+	}); err != nil {
+		return errors.Wrapf(err, "can't upload %s", key)
+	}
+
+	a.log.Info("Archived rows", "table", stmt.Table, "rows", n, "object", key)
+
+	return nil
+}
+
+// dump writes all rows of the table of stmt older than the given time to f and returns their number.
+func (a *Archiver) dump(
+	ctx context.Context, db *database.Database, stmt database.CleanupStmt, olderThan time.Time, f *os.File,
+) (int, error) {
+	q := db.Rebind(fmt.Sprintf(
+		`SELECT * FROM %[1]s WHERE %[2]s < ? ORDER BY %[2]s`, stmt.Table, stmt.Column))
+
+	rows, err := db.QueryxContext(ctx, q, types.UnixMilli(olderThan))
+	if err != nil {
+		return 0, database.CantPerformQuery(err, q)
+	}
+	defer func() { _ = rows.Close() }()
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+
+	var n int
+	for rows.Next() {
+		row := make(map[string]any)
+		if err := rows.MapScan(row); err != nil {
+			return 0, errors.Wrapf(err, "can't scan row of %s", stmt.Table)
+		}
+
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				if (column == "uuid" || strings.HasSuffix(column, "_uuid")) && len(b) == 16 {
+					row[column] = uuid.UUID(b).String()
+				} else {
+					row[column] = string(b)
+				}
+			}
+		}
+
+		if err := enc.Encode(row); err != nil {
+			return 0, errors.Wrap(err, "can't write row")
+		}
+
+		n++
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, database.CantPerformQuery(err, q)
+	}
+
+	if err := gz.Close(); err != nil {
+		return 0, errors.Wrap(err, "can't write row")
+	}
+
+	return n, nil
+}
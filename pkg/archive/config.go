@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"github.com/pkg/errors"
+	"slices"
+)
+
+// Tables lists the tables whose rows can be archived before the retention deletes them.
+var Tables = []string{
+	"event", "state_history", "problem", "problem_comment", "certificate_problem", "cron_job_problem",
+	"gitops_problem", "hpa_problem", "resource_quota_problem", "service_problem", "flapping_history",
+	"prometheus_cluster_metric", "prometheus_node_metric", "prometheus_pod_metric", "prometheus_container_metric",
+	"prometheus_service_metric",
+	"cost_namespace", "cost_workload", "resource_quota_usage", "container_restart", "pod_eviction",
+	"job_failure", "hpa_scaling", "image_pull",
+	"canary_run", "api_request", "etcd_object_count", "etcd_size",
+}
+
+// Config defines the S3-compatible object storage to which aged rows are archived.
+type Config struct {
+	// Endpoint of the object storage as host[:port], e.g. s3.amazonaws.com. If not set, nothing is archived.
+	Endpoint string `yaml:"endpoint"`
+	// Bucket to store the archives in, which must exist.
+	Bucket string `yaml:"bucket"`
+	// Prefix of the object keys, e.g. icinga-kubernetes/.
+	Prefix string `yaml:"prefix"`
+	Region string `yaml:"region"`
+	// AccessKeyId and SecretAccessKey authenticate requests. If not set, credentials are taken from the
+	// AWS environment variables or, on EC2, from the instance metadata.
+	AccessKeyId     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// Insecure disables TLS, e.g. for a local MinIO.
+	Insecure bool `yaml:"insecure"`
+	// Tables to archive. If not set, all Tables are archived.
+	Tables []string `yaml:"tables"`
+}
+
+// Validate checks constraints in the supplied archive configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Endpoint == "" {
+		return nil
+	}
+
+	if c.Bucket == "" {
+		return errors.New("archive bucket missing")
+	}
+
+	if (c.AccessKeyId == "") != (c.SecretAccessKey == "") {
+		return errors.New("archive access_key_id and secret_access_key must be set together")
+	}
+
+	for _, table := range c.Tables {
+		if !slices.Contains(Tables, table) {
+			return errors.Errorf("unknown archive table %q", table)
+		}
+	}
+
+	return nil
+}
+
+// Archives returns whether rows of the given table are archived.
+func (c *Config) Archives(table string) bool {
+	return c.Endpoint != "" && (len(c.Tables) == 0 || slices.Contains(c.Tables, table))
+}
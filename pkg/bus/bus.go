@@ -0,0 +1,220 @@
+// Package bus publishes resource changes and problem events to a message broker,
+// so that other systems can subscribe to them instead of polling the database.
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/backoff"
+	"github.com/icinga/icinga-kubernetes/pkg/plugin"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	"github.com/icinga/icinga-kubernetes/pkg/retry"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/webhook"
+	"github.com/pkg/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// Supported broker types.
+const (
+	Kafka = "kafka"
+	Nats  = "nats"
+)
+
+// queueSize is the number of messages buffered. Further messages are dropped while the broker is unavailable.
+const queueSize = 4096
+
+// batchSize is the maximum number of messages published at once.
+const batchSize = 256
+
+// message is a JSON value to publish to a topic. Messages with the same key, i.e. the UUID of the object,
+// end up in the same Kafka partition, so that they are consumed in order.
+type message struct {
+	topic string
+	key   string
+	value any
+}
+
+// record is an encoded message.
+type record struct {
+	topic string
+	key   []byte
+	value []byte
+}
+
+// publisher publishes records to a broker.
+type publisher interface {
+	// publish publishes the given records and blocks until the broker has received them.
+	publish(ctx context.Context, records []record) error
+	close() error
+}
+
+// Bus publishes resource changes as plugin.Event and problem events as webhook.Event in the background,
+// so that an unavailable broker doesn't delay synchronization.
+type Bus struct {
+	config    *Config
+	publisher publisher
+	queue     chan message
+	log       logr.Logger
+}
+
+// NewBus creates a new Bus for the configured broker.
+func NewBus(c *Config, log logr.Logger) (*Bus, error) {
+	var p publisher
+	var err error
+	switch c.Type {
+	case Kafka:
+		p = newKafkaPublisher(c.Addresses)
+	case Nats:
+		p, err = newNatsPublisher(c.Addresses)
+	default:
+		err = errors.Errorf("unknown event bus type %q", c.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bus{
+		config:    c,
+		publisher: p,
+		queue:     make(chan message, queueSize),
+		log:       log,
+	}, nil
+}
+
+// Publishes returns whether changes of the given controller are published.
+func (b *Bus) Publishes(controller string) bool {
+	return b.config.Publishes(controller)
+}
+
+// Watch publishes changes of the objects cached by informer that are accepted by filter, if set.
+// controller is the name of the controller running informer in the cluster with the given name and UUID.
+func (b *Bus) Watch(
+	cluster string, clusterUuid types.UUID, controller string,
+	informer kcache.SharedIndexInformer, filter func(kmetav1.Object) bool,
+) error {
+	topic := b.config.Topic + "." + controller
+	publish := func(e plugin.Event) {
+		e.Cluster = cluster
+		e.ClusterUuid = clusterUuid.String()
+		e.Controller = controller
+		b.notify(message{topic: topic, key: e.Uuid, value: e})
+	}
+
+	upsert := func(obj any) {
+		// The store may also contain placeholders from warmup, which are replaced by the listed objects.
+		if _, placeholder := obj.(schemav1.Resource); placeholder {
+			return
+		}
+
+		if o := obj.(kmetav1.Object); filter == nil || filter(o) {
+			publish(plugin.Event{Type: plugin.Upsert, Uuid: schemav1.EnsureUUID(o.GetUID()).String(), Object: o})
+		}
+	}
+
+	_, err := informer.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+		AddFunc: upsert,
+		UpdateFunc: func(_, obj any) {
+			upsert(obj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(kcache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if o, ok := obj.(kmetav1.Object); ok && (filter == nil || filter(o)) {
+				publish(plugin.Event{Type: plugin.Delete, Uuid: schemav1.EnsureUUID(o.GetUID()).String()})
+			}
+		},
+	})
+
+	return errors.Wrapf(err, "can't watch %s for event bus", controller)
+}
+
+// Problem publishes the given problem of the cluster with the given name, e.g. a *schemav1.Problem,
+// as opened or closed, depending on whether it has been cleared.
+// Nothing is published if b is nil, so that callers don't have to check whether the bus is configured.
+func (b *Bus) Problem(cluster string, p problem.Problem) {
+	if b == nil {
+		return
+	}
+
+	b.notify(message{
+		topic: b.config.Topic + ".problems", key: p.GetUuid().String(), value: webhook.NewEvent(cluster, p),
+	})
+}
+
+// Run publishes queued messages until ctx is canceled.
+// Messages that can't be published for five minutes are dropped.
+func (b *Bus) Run(ctx context.Context) error {
+	defer func() { _ = b.publisher.close() }()
+
+	for {
+		var batch []record
+
+		select {
+		case m := <-b.queue:
+			batch = b.append(batch, m)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+	Drain:
+		for len(batch) < batchSize {
+			select {
+			case m := <-b.queue:
+				batch = b.append(batch, m)
+			default:
+				break Drain
+			}
+		}
+
+		if len(batch) == 0 {
+			continue
+		}
+
+		err := retry.WithBackoff(
+			ctx,
+			func(ctx context.Context) error {
+				return b.publisher.publish(ctx, batch)
+			},
+			// Brokers report unavailability in their own ways, so every error is retried until the timeout.
+			func(error) bool { return true },
+			backoff.NewExponentialWithJitter(time.Second, time.Minute),
+			retry.Settings{Timeout: 5 * time.Minute},
+		)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			b.log.Error(err, "Can't publish messages to event bus", "messages", len(batch))
+		}
+	}
+}
+
+// notify queues the given message. If the queue is full, the message is dropped.
+func (b *Bus) notify(m message) {
+	select {
+	case b.queue <- m:
+	default:
+		b.log.Info("Dropping message, as the event bus can't keep up", "topic", m.topic, "key", m.key)
+	}
+}
+
+// append encodes the given message as JSON and appends it to records.
+// Messages that can't be encoded are dropped.
+func (b *Bus) append(records []record, m message) []record {
+	value, err := json.Marshal(m.value)
+	if err != nil {
+		b.log.Error(errors.WithStack(err), "Can't marshal message", "topic", m.topic, "key", m.key)
+
+		return records
+	}
+
+	return append(records, record{topic: m.topic, key: []byte(m.key), value: value})
+}
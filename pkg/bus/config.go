@@ -0,0 +1,61 @@
+package bus
+
+import (
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	"github.com/pkg/errors"
+	"net/url"
+	"slices"
+)
+
+// Config defines a message broker to which resource changes and problem events are published.
+type Config struct {
+	// Type of the broker, either Kafka or Nats. If not set, nothing is published.
+	Type string `yaml:"type"`
+	// Addresses of the brokers, i.e. host:port for Kafka and URLs for NATS.
+	Addresses []string `yaml:"addresses"`
+	// Topic is the prefix of the topics published to. Changes of resources are published to <topic>.<controller>,
+	// e.g. icinga-kubernetes.pods, and problem events to <topic>.problems.
+	Topic string `yaml:"topic" default:"icinga-kubernetes"`
+	// Controllers whose changes are published. If not set, changes of all enabled controllers are published.
+	Controllers []string `yaml:"controllers"`
+}
+
+// Validate checks constraints in the supplied event bus configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	switch c.Type {
+	case "":
+		return nil
+	case Kafka, Nats:
+	default:
+		return errors.Errorf("event_bus type must be either %s or %s", Kafka, Nats)
+	}
+
+	if len(c.Addresses) == 0 {
+		return errors.New("event_bus addresses missing")
+	}
+
+	if c.Type == Nats {
+		for _, address := range c.Addresses {
+			if _, err := url.Parse(address); err != nil {
+				return errors.Wrap(err, "invalid event_bus address")
+			}
+		}
+	}
+
+	if c.Topic == "" {
+		return errors.New("event_bus topic missing")
+	}
+
+	for _, controller := range c.Controllers {
+		if !slices.Contains(registry.Names(), controller) {
+			return errors.Errorf("unknown event_bus controller %q", controller)
+		}
+	}
+
+	return nil
+}
+
+// Publishes returns whether changes of the given controller are published.
+func (c *Config) Publishes(controller string) bool {
+	return len(c.Controllers) == 0 || slices.Contains(c.Controllers, controller)
+}
@@ -0,0 +1,39 @@
+package bus
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// kafkaPublisher publishes records to Kafka topics, which are created if they don't exist.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(addresses []string) *kafkaPublisher {
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr: kafka.TCP(addresses...),
+		// Records with the same key, i.e. of the same object, are written to the same partition.
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		// Records are already batched by the Bus, so don't wait for more.
+		BatchTimeout: time.Millisecond,
+		BatchSize:    batchSize,
+	}}
+}
+
+func (p *kafkaPublisher) publish(ctx context.Context, records []record) error {
+	messages := make([]kafka.Message, 0, len(records))
+	for _, r := range records {
+		messages = append(messages, kafka.Message{Topic: r.topic, Key: r.key, Value: r.value})
+	}
+
+	return errors.Wrap(p.writer.WriteMessages(ctx, messages...), "can't write messages to Kafka")
+}
+
+func (p *kafkaPublisher) close() error {
+	return errors.WithStack(p.writer.Close())
+}
@@ -0,0 +1,45 @@
+package bus
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// natsPublisher publishes records to NATS subjects. Keys aren't sent, as the UUIDs are part of the records.
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+func newNatsPublisher(addresses []string) (*natsPublisher, error) {
+	// The connection is established in the background and reestablished whenever it is lost,
+	// so that an unavailable server doesn't prevent starting up.
+	conn, err := nats.Connect(
+		strings.Join(addresses, ","),
+		nats.Name("Icinga for Kubernetes"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't connect to NATS")
+	}
+
+	return &natsPublisher{conn: conn}, nil
+}
+
+func (p *natsPublisher) publish(ctx context.Context, records []record) error {
+	for _, r := range records {
+		if err := p.conn.Publish(r.topic, r.value); err != nil {
+			return errors.Wrap(err, "can't publish message to NATS")
+		}
+	}
+
+	return errors.Wrap(p.conn.FlushWithContext(ctx), "can't flush messages to NATS")
+}
+
+func (p *natsPublisher) close() error {
+	p.conn.Close()
+
+	return nil
+}
@@ -0,0 +1,229 @@
+// Package canary periodically creates a tiny pod and measures how long it takes until it is running,
+// which is an end-to-end test of the scheduler, image pulls and the container network.
+package canary
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+	"time"
+)
+
+const (
+	// label marks canary pods, so that leftovers, e.g. after a crash, can be deleted.
+	label = "icinga-kubernetes.icinga.com/canary"
+	// deleteTimeout limits deleting a canary pod, which is also done after ctx has been canceled.
+	deleteTimeout = 30 * time.Second
+)
+
+// Canary creates a canary pod in the configured interval, waits until it is running and deletes it.
+// Each run is stored in the canary_run table with the time until the pod has been scheduled and is running,
+// or the error if the pod isn't running within the configured timeout.
+type Canary struct {
+	db          *database.Database
+	clientset   kubernetes.Interface
+	clusterUuid types.UUID
+	config      *Config
+	log         logr.Logger
+}
+
+// NewCanary creates a new Canary for the cluster with the given UUID.
+func NewCanary(
+	db *database.Database, clientset kubernetes.Interface, clusterUuid types.UUID, c *Config, log logr.Logger,
+) *Canary {
+	return &Canary{
+		db:          db,
+		clientset:   clientset,
+		clusterUuid: clusterUuid,
+		config:      c,
+		log:         log,
+	}
+}
+
+// Run runs the canary in the configured interval until ctx is canceled.
+func (c *Canary) Run(ctx context.Context) error {
+	if err := c.clientset.CoreV1().Pods(c.config.Namespace).DeleteCollection(
+		ctx,
+		kmetav1.DeleteOptions{GracePeriodSeconds: ptr.To[int64](0)},
+		kmetav1.ListOptions{LabelSelector: label},
+	); err != nil {
+		c.log.Error(err, "Can't delete leftover canary pods")
+	}
+
+	for {
+		run := c.run(ctx)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !run.Success.Bool {
+			c.log.Info("Canary pod failed", "pod", run.PodName, "error", run.Error.String)
+		}
+
+		stmt, _ := c.db.BuildUpsertStmt(run)
+		if _, err := c.db.NamedExecContext(ctx, stmt, run); err != nil {
+			return errors.Wrap(err, "can't store canary run")
+		}
+
+		select {
+		case <-time.After(c.config.Interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// run creates a canary pod, waits until it is running or the timeout expires, deletes it and returns the run.
+func (c *Canary) run(ctx context.Context) *schemav1.CanaryRun {
+	start := time.Now()
+	run := &schemav1.CanaryRun{
+		Uuid:        schemav1.NewUUID(c.clusterUuid, fmt.Sprintf("canary:%d", start.UnixNano())),
+		ClusterUuid: c.clusterUuid,
+		Namespace:   c.config.Namespace,
+		Started:     types.UnixMilli(start),
+	}
+
+	pod, err := c.clientset.CoreV1().Pods(c.config.Namespace).Create(ctx, c.pod(), kmetav1.CreateOptions{})
+	if err != nil {
+		c.fail(run, errors.Wrap(err, "can't create canary pod"))
+
+		return run
+	}
+	run.PodName = pod.Name
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteTimeout)
+		defer cancel()
+
+		if err := c.clientset.CoreV1().Pods(pod.Namespace).Delete(
+			ctx, pod.Name, kmetav1.DeleteOptions{GracePeriodSeconds: ptr.To[int64](0)},
+		); err != nil {
+			c.log.Error(err, "Can't delete canary pod", "pod", pod.Name)
+		}
+	}()
+
+	if err := c.await(ctx, pod, start, run); err != nil {
+		c.fail(run, err)
+
+		return run
+	}
+
+	run.Success = types.Bool{Bool: true, Valid: true}
+
+	return run
+}
+
+// await watches the given pod until it is running and sets the times until it has been scheduled and is running.
+func (c *Canary) await(ctx context.Context, pod *kcorev1.Pod, start time.Time, run *schemav1.CanaryRun) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	w, err := c.clientset.CoreV1().Pods(pod.Namespace).Watch(ctx, kmetav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", pod.Name).String(),
+		ResourceVersion: pod.ResourceVersion,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't watch canary pod")
+	}
+	defer w.Stop()
+
+	// waiting is the last reason why the container of the pod isn't running, e.g. ImagePullBackOff.
+	var waiting string
+	for {
+		select {
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return errors.New("watch of canary pod closed")
+			}
+
+			if event.Type == watch.Error {
+				return errors.Errorf("can't watch canary pod: %v", event.Object)
+			}
+
+			pod, ok := event.Object.(*kcorev1.Pod)
+			if !ok {
+				continue
+			}
+
+			if !run.SchedulingTime.Valid && pod.Spec.NodeName != "" {
+				run.NodeName = schemav1.NewNullableString(pod.Spec.NodeName)
+				run.SchedulingTime.Int64 = time.Since(start).Milliseconds()
+				run.SchedulingTime.Valid = true
+			}
+
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+					waiting = status.State.Waiting.Reason
+				}
+			}
+
+			switch pod.Status.Phase {
+			case kcorev1.PodRunning:
+				run.RunningTime.Int64 = time.Since(start).Milliseconds()
+				run.RunningTime.Valid = true
+
+				return nil
+			case kcorev1.PodFailed, kcorev1.PodSucceeded:
+				return errors.Errorf("canary pod %s: %s", pod.Status.Phase, pod.Status.Reason)
+			}
+		case <-ctx.Done():
+			if !run.SchedulingTime.Valid {
+				return errors.Errorf("canary pod not scheduled within %s", c.config.Timeout)
+			}
+
+			if waiting != "" {
+				return errors.Errorf("canary pod not running within %s: %s", c.config.Timeout, waiting)
+			}
+
+			return errors.Errorf("canary pod not running within %s", c.config.Timeout)
+		}
+	}
+}
+
+// pod returns the canary pod to create, which requests as few resources as possible
+// and always pulls its image.
+func (c *Canary) pod() *kcorev1.Pod {
+	return &kcorev1.Pod{
+		ObjectMeta: kmetav1.ObjectMeta{
+			GenerateName: "icinga-kubernetes-canary-",
+			Namespace:    c.config.Namespace,
+			Labels:       map[string]string{label: "true"},
+		},
+		Spec: kcorev1.PodSpec{
+			Containers: []kcorev1.Container{{
+				Name:            "canary",
+				Image:           c.config.Image,
+				ImagePullPolicy: kcorev1.PullAlways,
+				Resources: kcorev1.ResourceRequirements{
+					Requests: kcorev1.ResourceList{
+						kcorev1.ResourceCPU:    resource.MustParse("1m"),
+						kcorev1.ResourceMemory: resource.MustParse("8Mi"),
+					},
+					Limits: kcorev1.ResourceList{
+						kcorev1.ResourceMemory: resource.MustParse("8Mi"),
+					},
+				},
+			}},
+			RestartPolicy:                 kcorev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: ptr.To[int64](0),
+			AutomountServiceAccountToken:  ptr.To(false),
+		},
+	}
+}
+
+// fail sets the given run as failed due to err.
+func (c *Canary) fail(run *schemav1.CanaryRun, err error) {
+	run.Success = types.Bool{Bool: false, Valid: true}
+	run.Error = schemav1.NewNullableString(err.Error())
+}
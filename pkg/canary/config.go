@@ -0,0 +1,52 @@
+package canary
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Config defines how the scheduling canary is run.
+type Config struct {
+	// Interval in which a canary pod is created. If not set, no canary pods are created.
+	Interval time.Duration `yaml:"interval"`
+	// Namespace in which canary pods are created.
+	Namespace string `yaml:"namespace" default:"icinga-kubernetes"`
+	// Image of the canary pods, which should be tiny and is pulled on each run to test image pulls as well.
+	Image string `yaml:"image" default:"registry.k8s.io/pause:3.10"`
+	// Timeout after which a canary pod that isn't running is considered failed.
+	Timeout time.Duration `yaml:"timeout" default:"2m"`
+}
+
+// Validate checks constraints in the supplied canary configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("canary interval must not be negative")
+	}
+
+	if c.Interval == 0 {
+		return nil
+	}
+
+	if c.Namespace == "" {
+		return errors.New("canary namespace missing")
+	}
+
+	if c.Image == "" {
+		return errors.New("canary image missing")
+	}
+
+	if c.Timeout <= 0 {
+		return errors.New("canary timeout must be positive")
+	}
+
+	if c.Timeout >= c.Interval {
+		return errors.New("canary timeout must be less than the interval")
+	}
+
+	return nil
+}
+
+// Enabled returns whether an interval is configured, so that canary pods are created.
+func (c *Config) Enabled() bool {
+	return c.Interval > 0
+}
@@ -0,0 +1,344 @@
+// Package capacity forecasts when node pools, namespaces and PVCs run out of capacity
+// from the trend of the synchronized Prometheus metrics, and when resource quotas are exhausted
+// from the trend of their usage.
+package capacity
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// window is the period whose metrics the trends are computed from, as metrics are only kept for a day.
+const window = 24 * time.Hour
+
+// interval is the interval in which forecasts are computed.
+const interval = time.Hour
+
+// Forecaster computes the capacity forecasts of a cluster and stores them in the capacity_forecast table,
+// replacing the previous ones:
+//   - For node pools, the CPU and memory usage of their nodes is compared to their allocatable resources.
+//   - For namespaces, the CPU and memory usage of their pods is compared to the resources of the cluster
+//     that are neither used by them nor by other namespaces, i.e. how long the cluster lasts if only they grow.
+//   - For PVCs, the used storage and inodes are compared to their capacity,
+//     as volumes with many small files may run out of inodes first.
+type Forecaster struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	config      *Config
+	log         logr.Logger
+}
+
+// NewForecaster creates a new Forecaster for the cluster with the given UUID.
+func NewForecaster(db *database.Database, clusterUuid types.UUID, c *Config, log logr.Logger) *Forecaster {
+	return &Forecaster{
+		db:          db,
+		clusterUuid: clusterUuid,
+		config:      c,
+		log:         log,
+	}
+}
+
+// Run computes the forecasts every hour until ctx is canceled.
+func (f *Forecaster) Run(ctx context.Context) error {
+	for {
+		if err := f.Forecast(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Forecast computes and stores the forecasts of the cluster from the metrics before the given time.
+func (f *Forecaster) Forecast(ctx context.Context, now time.Time) error {
+	f.log.V(1).Info("Forecasting capacity")
+
+	since := now.Add(-window).UnixMilli()
+	var forecasts []*schemav1.CapacityForecast
+	add := func(scope, namespace, name, resource string, capacity float64, usage series) {
+		fc := &schemav1.CapacityForecast{
+			ClusterUuid: f.clusterUuid,
+			Scope:       scope,
+			Namespace:   namespace,
+			Name:        name,
+			Resource:    resource,
+			Capacity:    capacity,
+			Usage:       usage.last(),
+			Computed:    types.UnixMilli(now),
+		}
+
+		if growth, ok := usage.trend(); ok {
+			fc.GrowthPerDay = sql.NullFloat64{Float64: growth, Valid: true}
+			if growth > 0 {
+				fc.DaysUntilExhaustion = sql.NullFloat64{Float64: max(capacity-fc.Usage, 0) / growth, Valid: true}
+			}
+		}
+
+		forecasts = append(forecasts, fc)
+	}
+
+	pools, err := f.nodePools(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	var clusterCpu, clusterMemory float64
+	var clusterCpuUsage, clusterMemoryUsage series
+	for name, p := range pools {
+		add(schemav1.CapacityScopeNodePool, "", name, "cpu", p.cpu, p.cpuUsage)
+		add(schemav1.CapacityScopeNodePool, "", name, "memory", p.memory, p.memoryUsage)
+
+		clusterCpu += p.cpu
+		clusterMemory += p.memory
+		clusterCpuUsage = clusterCpuUsage.plus(p.cpuUsage)
+		clusterMemoryUsage = clusterMemoryUsage.plus(p.memoryUsage)
+	}
+
+	namespaces, err := f.namespaces(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	for name, ns := range namespaces {
+		// Namespaces may grow into the resources that are free in the cluster.
+		add(schemav1.CapacityScopeNamespace, name, "", "cpu",
+			clusterCpu-clusterCpuUsage.last()+ns.cpuUsage.last(), ns.cpuUsage)
+		add(schemav1.CapacityScopeNamespace, name, "", "memory",
+			clusterMemory-clusterMemoryUsage.last()+ns.memoryUsage.last(), ns.memoryUsage)
+	}
+
+	pvcs, err := f.pvcs(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	for key, p := range pvcs {
+		add(schemav1.CapacityScopePvc, key[0], key[1], "storage", p.capacity, p.usage)
+
+		// Filesystems without a fixed number of inodes report none.
+		if inodes := p.inodes.last(); inodes > 0 {
+			add(schemav1.CapacityScopePvc, key[0], key[1], "inodes", inodes, p.inodesUsage)
+		}
+	}
+
+	entities := make(chan interface{}, len(forecasts))
+	for _, fc := range forecasts {
+		entities <- fc
+	}
+	close(entities)
+
+	if err := f.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store capacity forecasts")
+	}
+
+	// Forecasts of node pools, namespaces and PVCs that don't exist anymore are removed.
+	_, err = f.db.ExecContext(ctx, f.db.Rebind(
+		"DELETE FROM capacity_forecast WHERE cluster_uuid = ? AND computed < ?"), f.clusterUuid, now.UnixMilli())
+
+	return errors.Wrap(err, "can't delete outdated capacity forecasts")
+}
+
+// pool are the allocatable resources of the nodes of a pool and their usage.
+type pool struct {
+	cpu         float64
+	memory      float64
+	cpuUsage    series
+	memoryUsage series
+}
+
+// nodePools returns the node pools of the cluster by the value of the pool label of their nodes
+// with their usage since the given time.
+func (f *Forecaster) nodePools(ctx context.Context, since int64) (map[string]*pool, error) {
+	var nodes []struct {
+		Uuid              types.UUID
+		CpuCapacity       int64
+		CpuAllocatable    int64
+		MemoryCapacity    int64
+		MemoryAllocatable int64
+		Pool              string
+	}
+	if err := f.db.SelectContext(ctx, &nodes, f.db.Rebind(
+		"SELECT node.uuid, node.cpu_capacity, node.cpu_allocatable, node.memory_capacity, node.memory_allocatable,"+
+			" COALESCE(MAX(label.value), '') AS pool FROM node"+
+			" LEFT JOIN node_label ON node_label.node_uuid = node.uuid"+
+			" LEFT JOIN label ON label.uuid = node_label.label_uuid AND label.name = ?"+
+			" WHERE node.cluster_uuid = ?"+
+			" GROUP BY node.uuid, node.cpu_capacity, node.cpu_allocatable, node.memory_capacity, node.memory_allocatable"),
+		f.config.PoolLabel, f.clusterUuid); err != nil {
+		return nil, errors.Wrap(err, "can't query nodes")
+	}
+
+	var metrics []struct {
+		NodeUuid  types.UUID
+		Timestamp int64
+		Category  string
+		Value     float64
+	}
+	if err := f.db.SelectContext(ctx, &metrics, f.db.Rebind(
+		"SELECT m.node_uuid, m.timestamp, m.category, m.value FROM prometheus_node_metric m"+
+			" INNER JOIN node ON node.uuid = m.node_uuid"+
+			" WHERE node.cluster_uuid = ? AND m.category IN ('cpu.usage', 'memory.usage') AND m.timestamp >= ?"),
+		f.clusterUuid, since); err != nil {
+		return nil, errors.Wrap(err, "can't query node metrics")
+	}
+
+	type node struct {
+		pool        *pool
+		cpuCapacity float64
+		memCapacity float64
+	}
+
+	pools := make(map[string]*pool)
+	byUuid := make(map[types.UUID]node, len(nodes))
+	for _, n := range nodes {
+		p, ok := pools[n.Pool]
+		if !ok {
+			p = &pool{}
+			pools[n.Pool] = p
+		}
+
+		// CPU is stored in millicores and memory in millibytes.
+		p.cpu += float64(n.CpuAllocatable) / 1000
+		p.memory += float64(n.MemoryAllocatable) / 1000
+		byUuid[n.Uuid] = node{pool: p, cpuCapacity: float64(n.CpuCapacity) / 1000, memCapacity: float64(n.MemoryCapacity) / 1000}
+	}
+
+	// Node usage is stored as fraction of the capacity.
+	for _, m := range metrics {
+		n, ok := byUuid[m.NodeUuid]
+		if !ok {
+			continue
+		}
+
+		if m.Category == "cpu.usage" {
+			n.pool.cpuUsage = n.pool.cpuUsage.add(m.Timestamp, m.Value*n.cpuCapacity)
+		} else {
+			n.pool.memoryUsage = n.pool.memoryUsage.add(m.Timestamp, m.Value*n.memCapacity)
+		}
+	}
+
+	return pools, nil
+}
+
+// namespaceUsage is the CPU and memory usage of the pods of a namespace.
+type namespaceUsage struct {
+	cpuUsage    series
+	memoryUsage series
+}
+
+// namespaces returns the usage of the namespaces of the cluster since the given time.
+func (f *Forecaster) namespaces(ctx context.Context, since int64) (map[string]*namespaceUsage, error) {
+	var metrics []struct {
+		Namespace string
+		Timestamp int64
+		Category  string
+		Value     float64
+	}
+	if err := f.db.SelectContext(ctx, &metrics, f.db.Rebind(
+		"SELECT pod.namespace, m.timestamp, m.category, SUM(m.value) AS value FROM prometheus_pod_metric m"+
+			" INNER JOIN pod ON pod.uuid = m.pod_uuid"+
+			" WHERE pod.cluster_uuid = ? AND m.category IN ('cpu.usage.cores', 'memory.usage.bytes')"+
+			" AND m.timestamp >= ? GROUP BY pod.namespace, m.timestamp, m.category"),
+		f.clusterUuid, since); err != nil {
+		return nil, errors.Wrap(err, "can't query pod metrics")
+	}
+
+	namespaces := make(map[string]*namespaceUsage)
+	for _, m := range metrics {
+		ns, ok := namespaces[m.Namespace]
+		if !ok {
+			ns = &namespaceUsage{}
+			namespaces[m.Namespace] = ns
+		}
+
+		if m.Category == "cpu.usage.cores" {
+			ns.cpuUsage = ns.cpuUsage.add(m.Timestamp, m.Value)
+		} else {
+			ns.memoryUsage = ns.memoryUsage.add(m.Timestamp, m.Value)
+		}
+	}
+
+	return namespaces, nil
+}
+
+// pvc is the capacity of a PVC and its usage. Unlike the storage, the number of inodes is only known from the metrics.
+type pvc struct {
+	capacity    float64
+	usage       series
+	inodes      series
+	inodesUsage series
+}
+
+// pvcs returns the bound PVCs of the cluster by namespace and name with their usage since the given time.
+// PVCs whose usage isn't known are not included.
+func (f *Forecaster) pvcs(ctx context.Context, since int64) (map[[2]string]*pvc, error) {
+	var claims []struct {
+		Namespace      string
+		Name           string
+		ActualCapacity int64
+	}
+	if err := f.db.SelectContext(ctx, &claims, f.db.Rebind(
+		"SELECT namespace, name, actual_capacity FROM pvc WHERE cluster_uuid = ? AND actual_capacity IS NOT NULL"),
+		f.clusterUuid); err != nil {
+		return nil, errors.Wrap(err, "can't query PVCs")
+	}
+
+	// The usage of PVCs is stored for each pod mounting them, named after the PVC.
+	var metrics []struct {
+		Namespace string
+		Name      string
+		Timestamp int64
+		Category  string
+		Value     float64
+	}
+	if err := f.db.SelectContext(ctx, &metrics, f.db.Rebind(
+		"SELECT pod.namespace, m.name, m.timestamp, m.category, MAX(m.value) AS value FROM prometheus_pod_metric m"+
+			" INNER JOIN pod ON pod.uuid = m.pod_uuid"+
+			" WHERE pod.cluster_uuid = ? AND m.category IN ('pvc.usage.bytes', 'pvc.inodes.used', 'pvc.inodes')"+
+			" AND m.timestamp >= ? GROUP BY pod.namespace, m.name, m.timestamp, m.category"),
+		f.clusterUuid, since); err != nil {
+		return nil, errors.Wrap(err, "can't query PVC metrics")
+	}
+
+	capacities := make(map[[2]string]float64, len(claims))
+	for _, c := range claims {
+		// Storage is stored in millibytes.
+		capacities[[2]string{c.Namespace, c.Name}] = float64(c.ActualCapacity) / 1000
+	}
+
+	pvcs := make(map[[2]string]*pvc)
+	for _, m := range metrics {
+		key := [2]string{m.Namespace, m.Name}
+		capacity, ok := capacities[key]
+		if !ok {
+			continue
+		}
+
+		p, ok := pvcs[key]
+		if !ok {
+			p = &pvc{capacity: capacity}
+			pvcs[key] = p
+		}
+
+		switch m.Category {
+		case "pvc.usage.bytes":
+			p.usage = p.usage.add(m.Timestamp, m.Value)
+		case "pvc.inodes.used":
+			p.inodesUsage = p.inodesUsage.add(m.Timestamp, m.Value)
+		default:
+			p.inodes = p.inodes.add(m.Timestamp, m.Value)
+		}
+	}
+
+	return pvcs, nil
+}
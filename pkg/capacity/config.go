@@ -0,0 +1,27 @@
+package capacity
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Config defines how capacity is forecast.
+type Config struct {
+	// PoolLabel is the node label whose values group nodes into pools. Nodes without it form a pool of their own.
+	PoolLabel string `yaml:"pool_label" default:"node.kubernetes.io/instance-type"`
+	// QuotaHorizon is the time before the projected exhaustion of a resource quota from which problems are raised.
+	QuotaHorizon time.Duration `yaml:"quota_horizon" default:"168h"`
+}
+
+// Validate checks constraints in the supplied capacity configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.PoolLabel == "" {
+		return errors.New("capacity pool_label missing")
+	}
+
+	if c.QuotaHorizon < 0 {
+		return errors.New("capacity quota_horizon must not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package capacity
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// fragmentationInterval is the interval in which the fragmentation of nodes is reported.
+// Unlike forecasts, it changes with every scheduled pod.
+const fragmentationInterval = 5 * time.Minute
+
+// FragmentationReporter reports the free capacity of the nodes of a cluster every five minutes and stores it
+// in the node_fragmentation table, replacing the previous reports, e.g. to explain pending pods
+// although the cluster as a whole has enough free resources: The scheduler places pods by their requests,
+// not by usage, and a pod only fits on a node whose free CPU and memory both cover its requests.
+// Nodes and pods are taken from the informers run by the nodes and pods controllers,
+// so pods of namespaces that are not synchronized are not taken into account.
+type FragmentationReporter struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	log         logr.Logger
+}
+
+// NewFragmentationReporter creates a new FragmentationReporter for the cluster with the given UUID.
+func NewFragmentationReporter(db *database.Database, clusterUuid types.UUID, log logr.Logger) *FragmentationReporter {
+	return &FragmentationReporter{
+		db:          db,
+		clusterUuid: clusterUuid,
+		log:         log,
+	}
+}
+
+// Run reports the fragmentation of the nodes and pods cached by the given informers every five minutes
+// until ctx is canceled.
+func (r *FragmentationReporter) Run(ctx context.Context, nodes, pods kcache.SharedIndexInformer) error {
+	if !kcache.WaitForCacheSync(ctx.Done(), nodes.HasSynced, pods.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	for {
+		if err := r.Report(ctx, nodes.GetStore(), pods.GetStore(), time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(fragmentationInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Report computes the fragmentation of the nodes and pods in the given stores and stores it at the given time.
+func (r *FragmentationReporter) Report(ctx context.Context, nodes, pods kcache.Store, now time.Time) error {
+	r.log.V(1).Info("Reporting node fragmentation")
+
+	reports := make(map[string]*schemav1.NodeFragmentation)
+	for _, obj := range nodes.List() {
+		node, ok := obj.(*kcorev1.Node)
+		if !ok {
+			continue
+		}
+
+		nodeUuid := schemav1.EnsureUUID(node.UID)
+		reports[node.Name] = &schemav1.NodeFragmentation{
+			Uuid:                schemav1.NewUUID(nodeUuid, "fragmentation"),
+			NodeUuid:            nodeUuid,
+			ClusterUuid:         r.clusterUuid,
+			NodeName:            node.Name,
+			CpuAllocatable:      node.Status.Allocatable.Cpu().MilliValue(),
+			MemoryAllocatable:   node.Status.Allocatable.Memory().Value(),
+			PodsAllocatable:     node.Status.Allocatable.Pods().Value(),
+			UnschedulableReason: schemav1.NewNullableString(unschedulable(node)),
+			Computed:            types.UnixMilli(now),
+		}
+	}
+
+	for _, obj := range pods.List() {
+		pod, ok := obj.(*kcorev1.Pod)
+		if !ok || pod.Status.Phase == kcorev1.PodSucceeded || pod.Status.Phase == kcorev1.PodFailed {
+			continue
+		}
+
+		report, ok := reports[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+
+		cpu, memory := requests(pod)
+		report.CpuRequests += cpu
+		report.MemoryRequests += memory
+		report.Pods++
+	}
+
+	entities := make(chan interface{}, len(reports))
+	for _, report := range reports {
+		if !report.UnschedulableReason.Valid && report.Pods >= report.PodsAllocatable {
+			report.UnschedulableReason = schemav1.NewNullableString(schemav1.NodeFragmentationPodsExceeded)
+		}
+
+		if !report.UnschedulableReason.Valid {
+			report.LargestPodCpu = max(report.CpuAllocatable-report.CpuRequests, 0)
+			report.LargestPodMemory = max(report.MemoryAllocatable-report.MemoryRequests, 0)
+		}
+
+		entities <- report
+	}
+	close(entities)
+
+	if err := r.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store node fragmentation")
+	}
+
+	// Reports of nodes that don't exist anymore are removed.
+	_, err := r.db.ExecContext(ctx, r.db.Rebind(
+		"DELETE FROM node_fragmentation WHERE cluster_uuid = ? AND computed < ?"), r.clusterUuid, now.UnixMilli())
+
+	return errors.Wrap(err, "can't delete outdated node fragmentation")
+}
+
+// unschedulable returns why the given node can't schedule pods without tolerations,
+// or an empty string if it can.
+func unschedulable(node *kcorev1.Node) string {
+	ready := false
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == kcorev1.NodeReady {
+			ready = condition.Status == kcorev1.ConditionTrue
+		}
+	}
+
+	switch {
+	case !ready:
+		return schemav1.NodeFragmentationNotReady
+	case node.Spec.Unschedulable:
+		return schemav1.NodeFragmentationCordoned
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == kcorev1.TaintEffectNoSchedule || taint.Effect == kcorev1.TaintEffectNoExecute {
+			return schemav1.NodeFragmentationTainted
+		}
+	}
+
+	return ""
+}
+
+// requests returns the CPU in millicores and memory in bytes that the scheduler reserves for the given pod.
+// As for the scheduler, these are the requests of its containers and sidecars, i.e. init containers that keep running,
+// or of its largest init container plus the sidecars started before it, whichever is greater,
+// plus the overhead of its runtime class.
+func requests(pod *kcorev1.Pod) (int64, int64) {
+	var cpu, memory, sidecarCpu, sidecarMemory, initCpu, initMemory int64
+	for _, c := range pod.Spec.Containers {
+		cpu += c.Resources.Requests.Cpu().MilliValue()
+		memory += c.Resources.Requests.Memory().Value()
+	}
+
+	for _, c := range pod.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == kcorev1.ContainerRestartPolicyAlways {
+			sidecarCpu += c.Resources.Requests.Cpu().MilliValue()
+			sidecarMemory += c.Resources.Requests.Memory().Value()
+
+			continue
+		}
+
+		initCpu = max(initCpu, sidecarCpu+c.Resources.Requests.Cpu().MilliValue())
+		initMemory = max(initMemory, sidecarMemory+c.Resources.Requests.Memory().Value())
+	}
+
+	cpu = max(cpu+sidecarCpu, initCpu) + pod.Spec.Overhead.Cpu().MilliValue()
+	memory = max(memory+sidecarMemory, initMemory) + pod.Spec.Overhead.Memory().Value()
+
+	return cpu, memory
+}
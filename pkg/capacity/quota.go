@@ -0,0 +1,272 @@
+package capacity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// QuotaExhausting is the reason of problems of resource quotas that are projected to be exhausted
+	// within the configured horizon.
+	QuotaExhausting = "QuotaExhausting"
+	// QuotaExhausted is the reason of problems of resource quotas that are exhausted,
+	// i.e. requests that would exceed them are already forbidden.
+	QuotaExhausted = "QuotaExhausted"
+
+	// quotaWindow is the period whose usage the trends of resource quotas are computed from and for which it is kept.
+	// Quotas are consumed by deployments rather than by load, so their usage grows over days rather than hours.
+	quotaWindow = 7 * 24 * time.Hour
+)
+
+// quotaKey identifies a resource of a resource quota by namespace, name of the quota and resource.
+type quotaKey [3]string
+
+// QuotaForecaster records the usage of the resource quotas of a cluster every hour in the resource_quota_usage table,
+// forecasts from it when each of their resources is exhausted and stores the forecasts in the resource_quota_forecast
+// table, replacing the previous ones. It raises and clears problems in the resource_quota_problem table
+// for resources that are exhausted or projected to be exhausted within the configured horizon,
+// as requests that would exceed a quota, e.g. to create pods of a deployment, are forbidden.
+// Unlike the other forecasts, the usage is read from the quotas themselves and doesn't require the metric sync.
+type QuotaForecaster struct {
+	clientset   kubernetes.Interface
+	db          *database.Database
+	clusterUuid types.UUID
+	config      *Config
+	namespaces  func(string) bool
+	problems    *problem.Tracker[quotaKey, *schemav1.ResourceQuotaProblem]
+	log         logr.Logger
+}
+
+// NewQuotaForecaster creates a new QuotaForecaster for the cluster with the given UUID.
+// Quotas of namespaces for which namespaces returns false are not forecast.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewQuotaForecaster(
+	clientset kubernetes.Interface, db *database.Database, clusterUuid types.UUID, c *Config,
+	namespaces func(string) bool, notify func(*schemav1.ResourceQuotaProblem), log logr.Logger,
+) *QuotaForecaster {
+	return &QuotaForecaster{
+		clientset:   clientset,
+		db:          db,
+		clusterUuid: clusterUuid,
+		config:      c,
+		namespaces:  namespaces,
+		problems: problem.NewTracker(
+			db,
+			"resource quota problem",
+			func(p *schemav1.ResourceQuotaProblem) quotaKey { return quotaKey{p.Namespace, p.Name, p.Resource} },
+			func(p *schemav1.ResourceQuotaProblem) []any {
+				return []any{"quota", p.Namespace + "/" + p.Name, "resource", p.Resource}
+			},
+			notify,
+			log),
+		log: log,
+	}
+}
+
+// Run loads the open problems and computes the forecasts every hour until ctx is canceled.
+func (f *QuotaForecaster) Run(ctx context.Context) error {
+	if err := f.problems.Load(ctx, "cluster_uuid = ?", f.clusterUuid); err != nil {
+		return err
+	}
+
+	for {
+		if err := f.Forecast(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Forecast records the current usage of the resource quotas, computes and stores their forecasts
+// from the usage before the given time, and raises and clears their problems.
+// Problems of quotas and resources that no longer exist are cleared.
+func (f *QuotaForecaster) Forecast(ctx context.Context, now time.Time) error {
+	f.log.V(1).Info("Forecasting resource quotas")
+
+	quotas, err := f.clientset.CoreV1().ResourceQuotas(kmetav1.NamespaceAll).List(ctx, kmetav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "can't list resource quotas")
+	}
+
+	var usages []*schemav1.ResourceQuotaUsage
+	for _, quota := range quotas.Items {
+		if !f.namespaces(quota.Namespace) {
+			continue
+		}
+
+		for resource, hard := range quota.Status.Hard {
+			// Resources limited to zero are forbidden on purpose rather than exhausted.
+			if hard.IsZero() {
+				continue
+			}
+
+			used := quota.Status.Used[resource]
+
+			usages = append(usages, &schemav1.ResourceQuotaUsage{
+				ClusterUuid: f.clusterUuid,
+				Namespace:   quota.Namespace,
+				Name:        quota.Name,
+				Resource:    string(resource),
+				Timestamp:   types.UnixMilli(now),
+				Hard:        hard.AsApproximateFloat64(),
+				Used:        used.AsApproximateFloat64(),
+			})
+		}
+	}
+
+	entities := make(chan interface{}, len(usages))
+	for _, u := range usages {
+		entities <- u
+	}
+	close(entities)
+
+	if err := f.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store resource quota usage")
+	}
+
+	history, err := f.history(ctx, now.Add(-quotaWindow).UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[quotaKey]struct{}, len(usages))
+	forecasts := make(chan interface{}, len(usages))
+	for _, u := range usages {
+		key := quotaKey{u.Namespace, u.Name, u.Resource}
+		seen[key] = struct{}{}
+
+		fc := &schemav1.ResourceQuotaForecast{
+			ClusterUuid: f.clusterUuid,
+			Namespace:   u.Namespace,
+			Name:        u.Name,
+			Resource:    u.Resource,
+			Hard:        u.Hard,
+			Used:        u.Used,
+			Computed:    types.UnixMilli(now),
+		}
+
+		if growth, ok := history[key].trend(); ok {
+			fc.GrowthPerDay = sql.NullFloat64{Float64: growth, Valid: true}
+		}
+
+		switch {
+		case u.Used >= u.Hard:
+			fc.DaysUntilExhaustion = sql.NullFloat64{Float64: 0, Valid: true}
+		case fc.GrowthPerDay.Float64 > 0:
+			fc.DaysUntilExhaustion = sql.NullFloat64{Float64: (u.Hard - u.Used) / fc.GrowthPerDay.Float64, Valid: true}
+		}
+
+		forecasts <- fc
+
+		if err := f.update(ctx, key, fc, now); err != nil {
+			return err
+		}
+	}
+	close(forecasts)
+
+	if err := f.db.UpsertStreamed(ctx, forecasts); err != nil {
+		return errors.Wrap(err, "can't store resource quota forecasts")
+	}
+
+	if err := f.problems.ClearFunc(ctx, func(key quotaKey, _ *schemav1.ResourceQuotaProblem) bool {
+		_, ok := seen[key]
+
+		return !ok
+	}, now); err != nil {
+		return err
+	}
+
+	// Forecasts of quotas and resources that don't exist anymore are removed.
+	_, err = f.db.ExecContext(ctx, f.db.Rebind(
+		"DELETE FROM resource_quota_forecast WHERE cluster_uuid = ? AND computed < ?"), f.clusterUuid, now.UnixMilli())
+
+	return errors.Wrap(err, "can't delete outdated resource quota forecasts")
+}
+
+// history returns the usage of the resources of the resource quotas of the cluster since the given time.
+func (f *QuotaForecaster) history(ctx context.Context, since int64) (map[quotaKey]series, error) {
+	var usages []*schemav1.ResourceQuotaUsage
+	if err := f.db.SelectContext(ctx, &usages, f.db.Rebind(
+		f.db.BuildSelectStmt(&schemav1.ResourceQuotaUsage{}, &schemav1.ResourceQuotaUsage{})+
+			" WHERE cluster_uuid = ? AND timestamp >= ?"),
+		f.clusterUuid, since); err != nil {
+		return nil, errors.Wrap(err, "can't query resource quota usage")
+	}
+
+	history := make(map[quotaKey]series)
+	for _, u := range usages {
+		key := quotaKey{u.Namespace, u.Name, u.Resource}
+		history[key] = history[key].add(u.Timestamp.Time().UnixMilli(), u.Used)
+	}
+
+	return history, nil
+}
+
+// update raises or clears the problem of the given forecast of a resource quota.
+// An open problem with a different reason is cleared first.
+func (f *QuotaForecaster) update(
+	ctx context.Context, key quotaKey, fc *schemav1.ResourceQuotaForecast, now time.Time,
+) error {
+	var reason string
+	switch {
+	case !fc.DaysUntilExhaustion.Valid:
+	case fc.DaysUntilExhaustion.Float64 == 0:
+		reason = QuotaExhausted
+	case fc.DaysUntilExhaustion.Float64*24*float64(time.Hour) <= float64(f.config.QuotaHorizon):
+		reason = QuotaExhausting
+	}
+
+	return f.problems.Update(ctx, key, reason, nil, func() *schemav1.ResourceQuotaProblem {
+		exhausted := now.Add(time.Duration(math.Round(fc.DaysUntilExhaustion.Float64 * 24 * float64(time.Hour))))
+		quota := fc.Namespace + "/" + fc.Name
+
+		var message string
+		if reason == QuotaExhausted {
+			message = fmt.Sprintf(
+				"Resource quota %s is exhausted: %s of %s %s used. Requests that exceed it are forbidden.",
+				quota, formatFloat(fc.Used), formatFloat(fc.Hard), fc.Resource)
+		} else {
+			message = fmt.Sprintf(
+				"Resource quota %s will be exhausted in %.1f days: %s of %s %s used, growing by %s per day.",
+				quota, fc.DaysUntilExhaustion.Float64, formatFloat(fc.Used), formatFloat(fc.Hard), fc.Resource,
+				formatFloat(math.Round(fc.GrowthPerDay.Float64*100)/100))
+		}
+
+		return &schemav1.ResourceQuotaProblem{
+			Uuid: schemav1.NewUUID(
+				f.clusterUuid, fmt.Sprintf("%s:%s:%s:%d", reason, quota, fc.Resource, now.UnixMilli())),
+			ClusterUuid: f.clusterUuid,
+			Namespace:   fc.Namespace,
+			Name:        fc.Name,
+			Resource:    fc.Resource,
+			Reason:      reason,
+			Message:     schemav1.NewNullableString(message),
+			Hard:        fc.Hard,
+			Used:        fc.Used,
+			Exhausted:   types.UnixMilli(exhausted),
+			Started:     types.UnixMilli(now),
+		}
+	}, now)
+}
+
+// formatFloat formats the given value of a resource without exponent, e.g. 1073741824 for 1Gi of memory.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,83 @@
+package capacity
+
+import (
+	"slices"
+	"time"
+)
+
+// sample is the value of a series at a timestamp in milliseconds.
+type sample struct {
+	timestamp int64
+	value     float64
+}
+
+// series is a time series whose values at the same timestamp are summed up.
+type series []sample
+
+// add adds value to the sample at the given timestamp and returns the updated series.
+func (s series) add(timestamp int64, value float64) series {
+	i, found := slices.BinarySearchFunc(s, timestamp, func(e sample, t int64) int {
+		switch {
+		case e.timestamp < t:
+			return -1
+		case e.timestamp > t:
+			return 1
+		default:
+			return 0
+		}
+	})
+	if found {
+		s[i].value += value
+
+		return s
+	}
+
+	return slices.Insert(s, i, sample{timestamp: timestamp, value: value})
+}
+
+// plus returns the sum of s and o.
+func (s series) plus(o series) series {
+	sum := slices.Clone(s)
+	for _, e := range o {
+		sum = sum.add(e.timestamp, e.value)
+	}
+
+	return sum
+}
+
+// last returns the latest value or zero if the series is empty.
+func (s series) last() float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	return s[len(s)-1].value
+}
+
+// trend returns the slope of the least squares regression line of the series per day
+// and whether there are enough samples to compute it.
+func (s series) trend() (float64, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+
+	day := float64(24 * time.Hour / time.Millisecond)
+	t0 := s[0].timestamp
+
+	var sumX, sumY, sumXY, sumXX float64
+	for _, e := range s {
+		x := float64(e.timestamp-t0) / day
+		sumX += x
+		sumY += e.value
+		sumXY += x * e.value
+		sumXX += x * x
+	}
+
+	n := float64(len(s))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
@@ -0,0 +1,418 @@
+// Package certificate tracks the expiry of the serving certificates of the API server and admission webhooks,
+// of the TLS secrets of ingresses and of the credentials in service account token and kubeconfig secrets,
+// and raises problems for certificates and tokens that are about to expire.
+package certificate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kadmissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Expiring is the reason of problems of certificates that expire within the horizon.
+	Expiring = "CertificateExpiring"
+	// Expired is the reason of problems of certificates that have expired.
+	Expired = "CertificateExpired"
+	// TokenExpiring is the reason of problems of tokens that expire within the horizon.
+	TokenExpiring = "TokenExpiring"
+	// TokenExpired is the reason of problems of tokens that have expired.
+	TokenExpired = "TokenExpired"
+
+	// interval is the interval in which certificates are checked.
+	interval = time.Hour
+	// probeTimeout limits the time to connect to the API server or a webhook.
+	probeTimeout = 10 * time.Second
+)
+
+// Tracker checks the certificates and tokens of a cluster every hour, stores them in the certificate table
+// and raises and clears problems in the certificate_problem table.
+// Serving certificates are read from a TLS handshake, which is not verified, as only their expiry is of interest.
+// Webhooks that are served in the cluster are only reachable if Icinga for Kubernetes runs in the cluster, too.
+type Tracker struct {
+	clientset   kubernetes.Interface
+	host        string
+	db          *database.Database
+	clusterUuid types.UUID
+	config      *Config
+	namespaces  func(string) bool
+	problems    *problem.Tracker[types.UUID, *schemav1.CertificateProblem]
+	log         logr.Logger
+}
+
+// NewTracker creates a new Tracker for the cluster with the given UUID whose API server is served at host.
+// Ingresses and secrets of namespaces for which namespaces returns false are not checked.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewTracker(
+	clientset kubernetes.Interface,
+	host string,
+	db *database.Database,
+	clusterUuid types.UUID,
+	c *Config,
+	namespaces func(string) bool,
+	notify func(*schemav1.CertificateProblem),
+	log logr.Logger,
+) *Tracker {
+	return &Tracker{
+		clientset:   clientset,
+		host:        host,
+		db:          db,
+		clusterUuid: clusterUuid,
+		config:      c,
+		namespaces:  namespaces,
+		problems: problem.NewTracker(
+			db,
+			"certificate problem",
+			func(p *schemav1.CertificateProblem) types.UUID { return p.CertificateUuid },
+			func(p *schemav1.CertificateProblem) []any { return []any{"source", p.Source, "target", p.Target} },
+			notify,
+			log),
+		log: log,
+	}
+}
+
+// Run loads the open problems and checks the certificates every hour until ctx is canceled.
+func (t *Tracker) Run(ctx context.Context) error {
+	if err := t.problems.Load(ctx, "cluster_uuid = ?", t.clusterUuid); err != nil {
+		return err
+	}
+
+	for {
+		if err := t.Check(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Check checks all certificates at the given time, stores them and raises and clears their problems.
+// Certificates that can't be retrieved are logged and treated as if they weren't referenced anymore.
+func (t *Tracker) Check(ctx context.Context, now time.Time) error {
+	t.log.V(1).Info("Checking certificates")
+
+	var certificates []*schemav1.Certificate
+	store := func(c *schemav1.Certificate) {
+		c.Uuid = schemav1.NewUUID(t.clusterUuid, strings.Join([]string{c.Source, c.Namespace, c.Name, c.Target}, "/"))
+		c.ClusterUuid = t.clusterUuid
+		c.Checked = types.UnixMilli(now)
+		certificates = append(certificates, c)
+	}
+	add := func(source, namespace, name, target string, cert *x509.Certificate) {
+		store(&schemav1.Certificate{
+			Source:    source,
+			Type:      schemav1.CertificateTypeCertificate,
+			Namespace: namespace,
+			Name:      name,
+			Target:    target,
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DnsNames:  schemav1.NewNullableString(strings.Join(cert.DNSNames, ", ")),
+			NotBefore: types.UnixMilli(cert.NotBefore),
+			NotAfter:  types.UnixMilli(cert.NotAfter),
+		})
+	}
+
+	if addr, serverName, err := address(t.host); err != nil {
+		t.log.Error(err, "Can't parse API server address", "host", t.host)
+	} else if cert, err := probe(ctx, addr, serverName); err != nil {
+		t.log.Error(err, "Can't probe API server certificate", "address", addr)
+	} else {
+		add(schemav1.CertificateSourceApiServer, "", "", addr, cert)
+	}
+
+	if err := t.webhooks(ctx, add); err != nil {
+		return err
+	}
+
+	if err := t.ingresses(ctx, add); err != nil {
+		return err
+	}
+
+	if err := t.secrets(ctx, add, store); err != nil {
+		return err
+	}
+
+	entities := make(chan interface{}, len(certificates))
+	checked := make(map[types.UUID]struct{}, len(certificates))
+	for _, c := range certificates {
+		entities <- c
+		checked[c.Uuid] = struct{}{}
+	}
+	close(entities)
+
+	if err := t.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store certificates")
+	}
+
+	if _, err := t.db.ExecContext(ctx, t.db.Rebind(
+		"DELETE FROM certificate WHERE cluster_uuid = ? AND checked < ?"), t.clusterUuid, now.UnixMilli(),
+	); err != nil {
+		return errors.Wrap(err, "can't delete outdated certificates")
+	}
+
+	for _, c := range certificates {
+		if err := t.update(ctx, c, now); err != nil {
+			return err
+		}
+	}
+
+	return t.problems.ClearFunc(ctx, func(id types.UUID, _ *schemav1.CertificateProblem) bool {
+		_, ok := checked[id]
+
+		return !ok
+	}, now)
+}
+
+// update raises or clears the problem of the given certificate.
+// An open problem with a different reason is cleared first.
+func (t *Tracker) update(ctx context.Context, c *schemav1.Certificate, now time.Time) error {
+	kind, expiring, expired := "Certificate", Expiring, Expired
+	if c.Type == schemav1.CertificateTypeToken {
+		kind, expiring, expired = "Token", TokenExpiring, TokenExpired
+	}
+
+	var reason string
+	switch notAfter := c.NotAfter.Time(); {
+	case !notAfter.After(now):
+		reason = expired
+	case notAfter.Sub(now) <= t.config.Horizon:
+		reason = expiring
+	}
+
+	// A renewed certificate that expires within the horizon again is a new problem.
+	return t.problems.Update(ctx, c.Uuid, reason, func(open *schemav1.CertificateProblem) bool {
+		return open.NotAfter.Time().Equal(c.NotAfter.Time())
+	}, func() *schemav1.CertificateProblem {
+		notAfter := c.NotAfter.Time().UTC().Format(time.RFC3339)
+		message := fmt.Sprintf("%s %q expires at %s", kind, c.Subject, notAfter)
+		if reason == expired {
+			message = fmt.Sprintf("%s %q expired at %s", kind, c.Subject, notAfter)
+		}
+
+		return &schemav1.CertificateProblem{
+			Uuid:            schemav1.NewUUID(c.Uuid, fmt.Sprintf("%s:%d", reason, now.UnixMilli())),
+			ClusterUuid:     t.clusterUuid,
+			CertificateUuid: c.Uuid,
+			Source:          c.Source,
+			Namespace:       c.Namespace,
+			Name:            c.Name,
+			Target:          c.Target,
+			Reason:          reason,
+			Message:         schemav1.NewNullableString(message),
+			NotAfter:        c.NotAfter,
+			Started:         types.UnixMilli(now),
+		}
+	}, now)
+}
+
+// webhookConfig are the client configs of the webhooks of a validating or mutating webhook configuration.
+type webhookConfig struct {
+	name          string
+	clientConfigs []kadmissionregistrationv1.WebhookClientConfig
+}
+
+// webhooks probes the serving certificates of all validating and mutating admission webhooks.
+func (t *Tracker) webhooks(
+	ctx context.Context, add func(source, namespace, name, target string, cert *x509.Certificate),
+) error {
+	validating, err := t.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(
+		ctx, kmetav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "can't list validating webhook configurations")
+	}
+
+	mutating, err := t.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(
+		ctx, kmetav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "can't list mutating webhook configurations")
+	}
+
+	var configs []webhookConfig
+	for _, c := range validating.Items {
+		wc := webhookConfig{name: c.Name}
+		for _, w := range c.Webhooks {
+			wc.clientConfigs = append(wc.clientConfigs, w.ClientConfig)
+		}
+
+		configs = append(configs, wc)
+	}
+	for _, c := range mutating.Items {
+		wc := webhookConfig{name: c.Name}
+		for _, w := range c.Webhooks {
+			wc.clientConfigs = append(wc.clientConfigs, w.ClientConfig)
+		}
+
+		configs = append(configs, wc)
+	}
+
+	for _, c := range configs {
+		// Webhooks of a configuration are often served by the same service, which is probed once.
+		probed := make(map[string]struct{})
+		for _, cc := range c.clientConfigs {
+			var addr, serverName string
+			switch {
+			case cc.URL != nil:
+				addr, serverName, err = address(*cc.URL)
+				if err != nil {
+					t.log.Error(err, "Can't parse webhook URL", "webhook", c.name, "url", *cc.URL)
+
+					continue
+				}
+			case cc.Service != nil:
+				port := int32(443)
+				if cc.Service.Port != nil {
+					port = *cc.Service.Port
+				}
+
+				serverName = cc.Service.Name + "." + cc.Service.Namespace + ".svc"
+				addr = net.JoinHostPort(serverName, strconv.Itoa(int(port)))
+			default:
+				continue
+			}
+
+			if _, ok := probed[addr]; ok {
+				continue
+			}
+			probed[addr] = struct{}{}
+
+			cert, err := probe(ctx, addr, serverName)
+			if err != nil {
+				t.log.V(1).Info("Can't probe webhook certificate", "webhook", c.name, "address", addr, "error", err)
+
+				continue
+			}
+
+			add(schemav1.CertificateSourceWebhook, "", c.name, addr, cert)
+		}
+	}
+
+	return nil
+}
+
+// ingresses reads the certificates from the TLS secrets of all ingresses.
+func (t *Tracker) ingresses(
+	ctx context.Context, add func(source, namespace, name, target string, cert *x509.Certificate),
+) error {
+	ingresses, err := t.clientset.NetworkingV1().Ingresses(kcorev1.NamespaceAll).List(ctx, kmetav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "can't list ingresses")
+	}
+
+	for _, ingress := range ingresses.Items {
+		if !t.namespaces(ingress.Namespace) {
+			continue
+		}
+
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName == "" {
+				continue
+			}
+
+			// The data of secrets isn't cached by the informers, so it is read here.
+			secret, err := t.clientset.CoreV1().Secrets(ingress.Namespace).Get(ctx, tls.SecretName, kmetav1.GetOptions{})
+			if err != nil {
+				if kerrors.IsNotFound(err) {
+					continue
+				}
+
+				return errors.Wrapf(err, "can't get secret %s/%s", ingress.Namespace, tls.SecretName)
+			}
+
+			cert, err := parse(secret.Data[kcorev1.TLSCertKey])
+			if err != nil {
+				t.log.V(1).Info("Can't parse ingress certificate",
+					"ingress", ingress.Namespace+"/"+ingress.Name, "secret", tls.SecretName, "error", err)
+
+				continue
+			}
+
+			add(schemav1.CertificateSourceIngress, ingress.Namespace, ingress.Name, tls.SecretName, cert)
+		}
+	}
+
+	return nil
+}
+
+// address returns the host and port to connect to and the server name of the given URL or host.
+func address(rawUrl string) (addr, serverName string, err error) {
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), u.Hostname(), nil
+}
+
+// probe returns the certificate presented by the server at the given address in a TLS handshake.
+func probe(ctx context.Context, addr, serverName string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName: serverName,
+		// Only the expiry is read from the certificate, which is not trusted for anything else.
+		InsecureSkipVerify: true, // #nosec G402
+	}}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate presented")
+	}
+
+	return certs[0], nil
+}
+
+// parse returns the first certificate of the given PEM data, which is the leaf of a chain.
+func parse(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no certificate found")
+		}
+
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+
+			return cert, errors.WithStack(err)
+		}
+	}
+}
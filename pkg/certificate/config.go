@@ -0,0 +1,28 @@
+package certificate
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Config defines when problems are raised for expiring certificates and tokens.
+type Config struct {
+	// Horizon is the time before expiry from which problems are raised.
+	Horizon time.Duration `yaml:"horizon" default:"720h"`
+	// LegacyTokenCleanupPeriod is the time after which unused legacy service account tokens are invalidated,
+	// as configured for the kube-controller-manager via --legacy-service-account-token-clean-up-period.
+	LegacyTokenCleanupPeriod time.Duration `yaml:"legacy_token_cleanup_period" default:"8760h"`
+}
+
+// Validate checks constraints in the supplied certificates configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Horizon < 0 {
+		return errors.New("certificates horizon must not be negative")
+	}
+
+	if c.LegacyTokenCleanupPeriod <= 0 {
+		return errors.New("certificates legacy_token_cleanup_period must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/icinga/icinga-go-library/types"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"strings"
+	"time"
+)
+
+const (
+	// legacyTokenLastUsedLabel is set by the API server to the date on which a legacy service account token
+	// was last used.
+	legacyTokenLastUsedLabel = "kubernetes.io/legacy-token-last-used"
+	// legacyTokenInvalidSinceLabel is set by the kube-controller-manager to the date since which
+	// a legacy service account token is invalid because it hasn't been used for the cleanup period.
+	legacyTokenInvalidSinceLabel = "kubernetes.io/legacy-token-invalid-since"
+	// labelDateFormat is the format of the dates of the legacy token labels.
+	labelDateFormat = "2006-01-02"
+
+	// kubeconfigKey is the conventional key of kubeconfigs in secrets.
+	kubeconfigKey = "kubeconfig"
+	// clusterApiSecretType is the type of the secrets in which Cluster API stores the kubeconfigs
+	// of workload clusters, named <cluster>-kubeconfig with the kubeconfig in the value key.
+	clusterApiSecretType kcorev1.SecretType = "cluster.x-k8s.io/secret"
+)
+
+// secrets reads the tokens of service account token secrets and the client certificates and tokens
+// of kubeconfigs stored in secrets, i.e. in a kubeconfig key, a key with the .kubeconfig suffix
+// or a Cluster API kubeconfig secret.
+func (t *Tracker) secrets(
+	ctx context.Context,
+	add func(source, namespace, name, target string, cert *x509.Certificate),
+	store func(*schemav1.Certificate),
+) error {
+	// The data of secrets isn't cached by the informers, so they are listed here,
+	// in small pages as secrets may be large, e.g. Helm releases.
+	options := kmetav1.ListOptions{Limit: 100}
+	for {
+		l, err := t.clientset.CoreV1().Secrets(kcorev1.NamespaceAll).List(ctx, options)
+		if err != nil {
+			return errors.Wrap(err, "can't list secrets")
+		}
+
+		for i := range l.Items {
+			secret := &l.Items[i]
+			if !t.namespaces(secret.Namespace) {
+				continue
+			}
+
+			if secret.Type == kcorev1.SecretTypeServiceAccountToken {
+				t.serviceAccountToken(secret, store)
+
+				continue
+			}
+
+			for key, data := range secret.Data {
+				if key == kubeconfigKey || strings.HasSuffix(key, "."+kubeconfigKey) ||
+					(secret.Type == clusterApiSecretType && strings.HasSuffix(secret.Name, "-"+kubeconfigKey) && key == "value") {
+					t.kubeconfig(secret, key, data, add, store)
+				}
+			}
+		}
+
+		if options.Continue = l.Continue; options.Continue == "" {
+			break
+		}
+	}
+
+	return nil
+}
+
+// serviceAccountToken stores the token of the given service account token secret if its expiry is known,
+// i.e. it expires itself or it is a legacy token that is tracked by the API server
+// and invalidated by the kube-controller-manager once it hasn't been used for the cleanup period.
+func (t *Tracker) serviceAccountToken(secret *kcorev1.Secret, store func(*schemav1.Certificate)) {
+	serviceAccount := secret.Annotations[kcorev1.ServiceAccountNameKey]
+	c := &schemav1.Certificate{
+		Source:    schemav1.CertificateSourceServiceAccountToken,
+		Type:      schemav1.CertificateTypeToken,
+		Namespace: secret.Namespace,
+		Name:      secret.Name,
+		Target:    serviceAccount,
+		Subject:   "system:serviceaccount:" + secret.Namespace + ":" + serviceAccount,
+		NotBefore: types.UnixMilli(secret.CreationTimestamp.Time),
+	}
+
+	if tc, err := parseClaims(secret.Data[kcorev1.ServiceAccountTokenKey]); err == nil {
+		c.Issuer = tc.Issuer
+		if tc.IssuedAt > 0 {
+			c.NotBefore = unix(tc.IssuedAt)
+		}
+
+		if tc.Expiry > 0 {
+			c.NotAfter = unix(tc.Expiry)
+			store(c)
+
+			return
+		}
+	}
+
+	if invalidSince, err := time.Parse(labelDateFormat, secret.Labels[legacyTokenInvalidSinceLabel]); err == nil {
+		c.NotAfter = types.UnixMilli(invalidSince)
+	} else if lastUsed, err := time.Parse(labelDateFormat, secret.Labels[legacyTokenLastUsedLabel]); err == nil {
+		c.NotAfter = types.UnixMilli(lastUsed.Add(t.config.LegacyTokenCleanupPeriod))
+	} else {
+		// Without tracking, e.g. in clusters before Kubernetes 1.28, legacy tokens are not invalidated.
+		return
+	}
+
+	store(c)
+}
+
+// kubeconfig stores the client certificates of the users of the given kubeconfig from the given key of the secret,
+// or their tokens if they expire.
+func (t *Tracker) kubeconfig(
+	secret *kcorev1.Secret,
+	key string,
+	data []byte,
+	add func(source, namespace, name, target string, cert *x509.Certificate),
+	store func(*schemav1.Certificate),
+) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		t.log.V(1).Info("Can't parse kubeconfig", "secret", secret.Namespace+"/"+secret.Name, "key", key, "error", err)
+
+		return
+	}
+
+	for user, auth := range config.AuthInfos {
+		// Users authenticate either with a client certificate or a token.
+		if len(auth.ClientCertificateData) > 0 {
+			cert, err := parse(auth.ClientCertificateData)
+			if err != nil {
+				t.log.V(1).Info("Can't parse kubeconfig client certificate",
+					"secret", secret.Namespace+"/"+secret.Name, "key", key, "user", user, "error", err)
+
+				continue
+			}
+
+			add(schemav1.CertificateSourceKubeconfig, secret.Namespace, secret.Name, user, cert)
+		} else if tc, err := parseClaims([]byte(auth.Token)); err == nil && tc.Expiry > 0 {
+			c := &schemav1.Certificate{
+				Source:    schemav1.CertificateSourceKubeconfig,
+				Type:      schemav1.CertificateTypeToken,
+				Namespace: secret.Namespace,
+				Name:      secret.Name,
+				Target:    user,
+				Subject:   tc.Subject,
+				Issuer:    tc.Issuer,
+				NotBefore: types.UnixMilli(secret.CreationTimestamp.Time),
+				NotAfter:  unix(tc.Expiry),
+			}
+			if tc.IssuedAt > 0 {
+				c.NotBefore = unix(tc.IssuedAt)
+			}
+
+			store(c)
+		}
+	}
+}
+
+// claims are the registered claims of a JSON Web Token that are of interest.
+type claims struct {
+	Issuer  string `json:"iss"`
+	Subject string `json:"sub"`
+	// Expiry and IssuedAt are in seconds since the epoch, which may be fractional.
+	Expiry   float64 `json:"exp"`
+	IssuedAt float64 `json:"iat"`
+}
+
+// unix returns the time of the given seconds since the epoch.
+func unix(seconds float64) types.UnixMilli {
+	return types.UnixMilli(time.UnixMilli(int64(seconds * 1000)))
+}
+
+// parseClaims returns the claims of the given JSON Web Token, whose signature is not verified,
+// as only its expiry is read from it, which is not trusted for anything else.
+func parseClaims(token []byte) (*claims, error) {
+	parts := bytes.Split(bytes.TrimSpace(token), []byte("."))
+	if len(parts) != 3 {
+		return nil, errors.New("not a JSON Web Token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &c, nil
+}
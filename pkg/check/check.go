@@ -0,0 +1,376 @@
+package check
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Metric is reported as performance data. Value and Max are SQL expressions evaluated per resource,
+// in which the checked resource's table is available as r.
+type Metric struct {
+	Label string
+	Uom   string
+	Value string
+	Max   string
+}
+
+// Kind describes where resources of a kind and their performance data are stored in the database.
+// LastSuccess is the column of the time of the last success of the resources in Unix milliseconds, if any,
+// whose age is checked against Options.MaxSuccessAge.
+type Kind struct {
+	Table       string
+	Namespaced  bool
+	Metrics     []Metric
+	LastSuccess string
+}
+
+// Kinds contains all resource kinds that can be checked.
+var Kinds = map[string]Kind{
+	"pod": {
+		Table:      "pod",
+		Namespaced: true,
+		Metrics: []Metric{{
+			Label: "restarts",
+			Value: "(SELECT COALESCE(SUM(restart_count), 0) FROM container WHERE container.pod_uuid = r.uuid)",
+		}},
+	},
+	"node": {
+		Table: "node",
+		Metrics: []Metric{{
+			Label: "pods",
+			Value: "(SELECT COUNT(*) FROM pod WHERE pod.cluster_uuid = r.cluster_uuid AND pod.node_name = r.name)",
+			Max:   "r.pod_capacity",
+		}},
+	},
+	"deployment": {
+		Table:      "deployment",
+		Namespaced: true,
+		Metrics:    replicas("r.available_replicas", "r.desired_replicas"),
+	},
+	"replica-set": {
+		Table:      "replica_set",
+		Namespaced: true,
+		Metrics:    replicas("r.available_replicas", "r.desired_replicas"),
+	},
+	"stateful-set": {
+		Table:      "stateful_set",
+		Namespaced: true,
+		Metrics:    replicas("r.available_replicas", "r.desired_replicas"),
+	},
+	"daemon-set": {
+		Table:      "daemon_set",
+		Namespaced: true,
+		Metrics: append(
+			replicas("r.number_available", "r.desired_number_scheduled"),
+			Metric{
+				Label: "coverage_gaps",
+				Value: "(SELECT COUNT(*) FROM daemon_set_coverage_gap g WHERE g.daemon_set_uuid = r.uuid)",
+			},
+		),
+	},
+	"job": {
+		Table:      "job",
+		Namespaced: true,
+		Metrics: []Metric{
+			{Label: "active", Value: "r.active"},
+			{Label: "succeeded", Value: "r.succeeded", Max: "r.completions"},
+			{Label: "failed", Value: "r.failed"},
+		},
+	},
+	"pvc": {
+		Table:      "pvc",
+		Namespaced: true,
+		Metrics: []Metric{
+			{Label: "capacity", Uom: "B", Value: "r.actual_capacity / 1000"},
+			{Label: "growth_per_day", Uom: "B", Value: pvcForecast("storage", "growth_per_day")},
+			{Label: "days_until_full", Value: pvcForecast("storage", "days_until_exhaustion")},
+			{Label: "days_until_inodes_exhausted", Value: pvcForecast("inodes", "days_until_exhaustion")},
+		},
+	},
+	"velero-backup": {
+		Table:      "velero_backup",
+		Namespaced: true,
+		Metrics: []Metric{
+			{Label: "items_backed_up", Value: "r.items_backed_up", Max: "r.total_items"},
+			{Label: "errors", Value: "r.errors"},
+			{Label: "warnings", Value: "r.warnings"},
+		},
+	},
+	"velero-schedule": {
+		Table:       "velero_schedule",
+		Namespaced:  true,
+		LastSuccess: "r.last_successful_backup",
+	},
+	"argo-application": {
+		Table:      "argo_application",
+		Namespaced: true,
+		Metrics: []Metric{{
+			Label: "resources_out_of_sync",
+			Value: "(SELECT COUNT(*) FROM argo_application_resource a" +
+				" WHERE a.argo_application_uuid = r.uuid AND a.sync_status = 'OutOfSync')",
+			Max: "(SELECT COUNT(*) FROM argo_application_resource a WHERE a.argo_application_uuid = r.uuid)",
+		}},
+	},
+	"flux-kustomization": {
+		Table:      "flux_kustomization",
+		Namespaced: true,
+		Metrics: []Metric{{
+			Label: "resources",
+			Value: "(SELECT COUNT(*) FROM flux_kustomization_resource f WHERE f.flux_kustomization_uuid = r.uuid)",
+		}},
+	},
+	"olm-subscription": {
+		Table:      "olm_subscription",
+		Namespaced: true,
+	},
+	"olm-cluster-service-version": {
+		Table:      "olm_cluster_service_version",
+		Namespaced: true,
+	},
+}
+
+// KindNames returns the sorted names of all resource kinds that can be checked.
+func KindNames() []string {
+	names := make([]string, 0, len(Kinds))
+	for name := range Kinds {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// pvcForecast returns the SQL expression of the given column of the capacity forecast of the resource of a PVC,
+// which is NULL if there is none yet or the usage doesn't grow.
+func pvcForecast(resource, column string) string {
+	return "(SELECT f." + column + " FROM capacity_forecast f WHERE f.cluster_uuid = r.cluster_uuid" +
+		" AND f.scope = 'pvc' AND f.namespace = r.namespace AND f.name = r.name AND f.resource = '" + resource + "')"
+}
+
+func replicas(available, desired string) []Metric {
+	return []Metric{{Label: "available_replicas", Value: available, Max: desired}}
+}
+
+// Perfdata is a single value of performance data in the plugin output format.
+type Perfdata struct {
+	Label string
+	Uom   string
+	Value float64
+	Max   sql.NullFloat64
+}
+
+func (p Perfdata) String() string {
+	s := fmt.Sprintf("'%s'=%g%s;;;0;", p.Label, p.Value, p.Uom)
+	if p.Max.Valid {
+		s += fmt.Sprintf("%g", p.Max.Float64)
+	}
+
+	return s
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	State    schemav1.IcingaState
+	Output   string
+	Perfdata []Perfdata
+}
+
+// Unknown returns a Result with the Unknown state for a check that could not be performed due to err.
+func Unknown(err error) Result {
+	return Result{State: schemav1.Unknown, Output: err.Error()}
+}
+
+// ExitCode returns the plugin exit code of the result's state.
+// Pending resources are reported as unknown, since their state can't be determined yet.
+func (r Result) ExitCode() int {
+	switch r.State {
+	case schemav1.Ok:
+		return 0
+	case schemav1.Warning:
+		return 1
+	case schemav1.Critical:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// String returns the result in the plugin output format.
+func (r Result) String() string {
+	state := "UNKNOWN"
+	switch r.State {
+	case schemav1.Ok:
+		state = "OK"
+	case schemav1.Warning:
+		state = "WARNING"
+	case schemav1.Critical:
+		state = "CRITICAL"
+	}
+
+	output := state + " - " + r.Output
+	if len(r.Perfdata) > 0 {
+		perfdata := make([]string, 0, len(r.Perfdata))
+		for _, p := range r.Perfdata {
+			perfdata = append(perfdata, p.String())
+		}
+
+		output += " | " + strings.Join(perfdata, " ")
+	}
+
+	return output
+}
+
+// Options select the resource to check.
+type Options struct {
+	Kind      string
+	Cluster   string
+	Namespace string
+	Name      string
+	// MaxAge is the maximum age of the heartbeat of the Icinga for Kubernetes instance synchronizing the cluster.
+	// Older data is considered stale and reported as unknown.
+	MaxAge time.Duration
+	// MaxSuccessAge is the maximum age of the last success of resources of kinds that record it,
+	// e.g. the last successful backup of Velero schedules. Older or missing successes are reported as critical.
+	MaxSuccessAge time.Duration
+}
+
+// Check evaluates the state of the resource selected by opts as synchronized to the database.
+func Check(ctx context.Context, db *database.Database, opts Options) (Result, error) {
+	kind, ok := Kinds[opts.Kind]
+	if !ok {
+		return Result{}, errors.Errorf("unknown kind %q, must be one of %s", opts.Kind, strings.Join(KindNames(), ", "))
+	}
+
+	object := opts.Name
+	if kind.Namespaced {
+		object = opts.Namespace + "/" + opts.Name
+	}
+
+	columns := []string{"r.cluster_uuid", "r.icinga_state", "r.icinga_state_reason"}
+	for _, m := range kind.Metrics {
+		max := m.Max
+		if max == "" {
+			max = "NULL"
+		}
+
+		columns = append(columns, m.Value, max)
+	}
+
+	lastSuccess := kind.LastSuccess
+	if lastSuccess == "" {
+		lastSuccess = "NULL"
+	}
+	columns = append(columns, lastSuccess)
+
+	query := fmt.Sprintf("SELECT %s FROM %s r", strings.Join(columns, ", "), kind.Table)
+	var where []string
+	var args []any
+
+	if opts.Cluster != "" {
+		query += " INNER JOIN cluster c ON c.uuid = r.cluster_uuid"
+		where = append(where, "c.name = ?")
+		args = append(args, opts.Cluster)
+	}
+	if kind.Namespaced {
+		where = append(where, "r.namespace = ?")
+		args = append(args, opts.Namespace)
+	}
+	where = append(where, "r.name = ?")
+	args = append(args, opts.Name)
+
+	query += " WHERE " + strings.Join(where, " AND ")
+
+	rows, err := db.QueryContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "can't query database")
+	}
+	defer func() { _ = rows.Close() }()
+
+	var clusterUuid []byte
+	var state string
+	var reason sql.NullString
+	var success sql.NullInt64
+	values := make([]sql.NullFloat64, 2*len(kind.Metrics))
+
+	dest := []any{&clusterUuid, &state, &reason}
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+	dest = append(dest, &success)
+
+	var found int
+	for rows.Next() {
+		if found++; found > 1 {
+			return Result{}, errors.Errorf("%s %s exists in multiple clusters, select one with --cluster", opts.Kind, object)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return Result{}, errors.Wrap(err, "can't scan row")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Result{}, errors.Wrap(err, "can't query database")
+	}
+
+	if found == 0 {
+		return Result{}, errors.Errorf("%s %s not found", opts.Kind, object)
+	}
+
+	if opts.MaxAge > 0 {
+		var heartbeat sql.NullInt64
+		err := db.QueryRowContext(
+			ctx, db.Rebind("SELECT MAX(heartbeat) FROM kubernetes_instance WHERE cluster_uuid = ?"), clusterUuid,
+		).Scan(&heartbeat)
+		if err != nil {
+			return Result{}, errors.Wrap(err, "can't query heartbeat")
+		}
+
+		if !heartbeat.Valid || time.Since(time.UnixMilli(heartbeat.Int64)) > opts.MaxAge {
+			return Result{}, errors.Errorf(
+				"no Icinga for Kubernetes instance has synchronized the cluster of %s %s within the last %s",
+				opts.Kind, object, opts.MaxAge)
+		}
+	}
+
+	// Unknown states are reported as such.
+	parsed, _ := schemav1.ParseIcingaState(state)
+	result := Result{State: parsed, Output: reason.String}
+	if result.Output == "" {
+		result.Output = fmt.Sprintf("%s %s is %s.", opts.Kind, object, state)
+	}
+
+	if kind.LastSuccess != "" && opts.MaxSuccessAge > 0 {
+		if !success.Valid {
+			result.State = schemav1.Critical
+			result.Output += fmt.Sprintf(" %s %s has never succeeded.", opts.Kind, object)
+		} else if age := time.Since(time.UnixMilli(success.Int64)); age > opts.MaxSuccessAge {
+			result.State = schemav1.Critical
+			result.Output += fmt.Sprintf(
+				" %s %s last succeeded %s ago, longer than %s.",
+				opts.Kind, object, age.Truncate(time.Second), opts.MaxSuccessAge)
+		}
+	}
+
+	for i, m := range kind.Metrics {
+		if !values[2*i].Valid {
+			continue
+		}
+
+		result.Perfdata = append(result.Perfdata, Perfdata{
+			Label: m.Label,
+			Uom:   m.Uom,
+			Value: values[2*i].Float64,
+			Max:   values[2*i+1],
+		})
+	}
+
+	return result, nil
+}
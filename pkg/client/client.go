@@ -0,0 +1,343 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resource is one of the resources served by the API.
+type Resource string
+
+// Resources served by the API.
+const (
+	Namespaces         Resource = "namespaces"
+	Nodes              Resource = "nodes"
+	NodeDisks          Resource = "node-disks"
+	Pods               Resource = "pods"
+	Containers         Resource = "containers"
+	Deployments        Resource = "deployments"
+	DaemonSets         Resource = "daemon-sets"
+	ReplicaSets        Resource = "replica-sets"
+	StatefulSets       Resource = "stateful-sets"
+	Services           Resource = "services"
+	Endpoints          Resource = "endpoints"
+	Secrets            Resource = "secrets"
+	ConfigMaps         Resource = "config-maps"
+	Events             Resource = "events"
+	Pvcs               Resource = "pvcs"
+	PersistentVolumes  Resource = "persistent-volumes"
+	Jobs               Resource = "jobs"
+	CronJobs           Resource = "cron-jobs"
+	Hpas               Resource = "hpas"
+	Ingresses          Resource = "ingresses"
+	Routes             Resource = "routes"
+	JobFailures        Resource = "job-failures"
+	CronJobProblems    Resource = "cron-job-problems"
+	HpaScalings        Resource = "hpa-scalings"
+	HpaProblems        Resource = "hpa-problems"
+	ImagePulls         Resource = "image-pulls"
+	IngressConflicts   Resource = "ingress-conflicts"
+	NodeDrainRisks     Resource = "node-drain-risks"
+	NodeDrainRiskPdbs  Resource = "node-drain-risk-pdbs"
+	NodeFragmentations Resource = "node-fragmentations"
+	ServiceProblems    Resource = "service-problems"
+	ApiWarnings        Resource = "api-warnings"
+	EtcdObjectCounts   Resource = "etcd-object-counts"
+	EtcdSizes          Resource = "etcd-sizes"
+	Problems           Resource = "problems"
+	StateHistory       Resource = "state-history"
+	Clusters           Resource = "clusters"
+
+	// Resources of Istio are only synchronized if it is installed.
+	IstioVirtualServices Resource = "istio-virtual-services"
+	IstioGateways        Resource = "istio-gateways"
+
+	// Resources of Cilium are only synchronized if it is installed.
+	CiliumEndpoints Resource = "cilium-endpoints"
+
+	// Resources of Velero are only synchronized if it is installed.
+	VeleroBackups   Resource = "velero-backups"
+	VeleroRestores  Resource = "velero-restores"
+	VeleroSchedules Resource = "velero-schedules"
+
+	// Resources of GitOps tools are only synchronized if they are installed.
+	ArgoApplications   Resource = "argo-applications"
+	FluxKustomizations Resource = "flux-kustomizations"
+	GitopsProblems     Resource = "gitops-problems"
+
+	// Resources of the Operator Lifecycle Manager are only synchronized if it is installed.
+	OlmSubscriptions          Resource = "olm-subscriptions"
+	OlmClusterServiceVersions Resource = "olm-cluster-service-versions"
+)
+
+// Formats in which manifests can be requested.
+const (
+	Yaml = "yaml"
+	Json = "json"
+)
+
+// Item maps the column names of a resource to their values.
+// UUIDs are strings, timestamps are Unix milliseconds and numbers are float64.
+type Item map[string]any
+
+// List is a page of items.
+type List struct {
+	Items []Item `json:"items"`
+	// Total is the number of items matching the request.
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// ListOptions restrict the items listed.
+type ListOptions struct {
+	// Filters map column names to the values to match, e.g. {"namespace": {"default"}}.
+	Filters url.Values
+	// Limit defaults to 100 if zero.
+	Limit  int
+	Offset int
+}
+
+// MetricsOptions restrict the metrics listed.
+type MetricsOptions struct {
+	ListOptions
+	// From and To restrict metrics to a time range, if not zero.
+	From time.Time
+	To   time.Time
+}
+
+// ChangesOptions restrict the changes streamed. Empty lists match everything.
+type ChangesOptions struct {
+	Clusters  []string
+	Resources []Resource
+	// Namespaces don't apply to deleted objects, whose namespace is unknown.
+	Namespaces []string
+}
+
+// Change is streamed once a synchronized object has been written to the database.
+type Change struct {
+	// Type is either upsert or delete.
+	Type      string    `json:"type"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Resource  Resource  `json:"resource"`
+	Id        uuid.UUID `json:"id"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name,omitempty"`
+}
+
+// Error is returned if the API responds with an unsuccessful status code.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("API responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// Client is a typed client of the REST API served by Icinga for Kubernetes, as described by its OpenAPI specification.
+type Client struct {
+	baseUrl *url.URL
+	token   string
+	http    *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken sends the given bearer token with each request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHttpClient sends requests with the given HTTP client instead of http.DefaultClient.
+func WithHttpClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.http = client
+	}
+}
+
+// New creates a new Client for the API served at baseUrl, e.g. http://localhost:8080.
+func New(baseUrl string, options ...Option) (*Client, error) {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid API url")
+	}
+
+	c := &Client{baseUrl: u.JoinPath("api", "v1"), http: http.DefaultClient}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c, nil
+}
+
+// List lists the items of the given resource.
+func (c *Client) List(ctx context.Context, resource Resource, opts ListOptions) (*List, error) {
+	var list List
+	if err := c.getJSON(ctx, opts.query(), &list, string(resource)); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// Get returns the item of the given resource with the given ID.
+func (c *Client) Get(ctx context.Context, resource Resource, id uuid.UUID) (Item, error) {
+	var item Item
+	if err := c.getJSON(ctx, nil, &item, string(resource), id.String()); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ListMetrics lists the Prometheus metrics of the node, pod or container with the given ID.
+func (c *Client) ListMetrics(ctx context.Context, resource Resource, id uuid.UUID, opts MetricsOptions) (*List, error) {
+	query := opts.query()
+	if !opts.From.IsZero() {
+		query.Set("from", strconv.FormatInt(opts.From.UnixMilli(), 10))
+	}
+	if !opts.To.IsZero() {
+		query.Set("to", strconv.FormatInt(opts.To.UnixMilli(), 10))
+	}
+
+	var list List
+	if err := c.getJSON(ctx, query, &list, string(resource), id.String(), "metrics"); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// GetManifest returns the stored manifest of the item of the given resource with the given ID in the given format.
+func (c *Client) GetManifest(ctx context.Context, resource Resource, id uuid.UUID, format string) ([]byte, error) {
+	res, err := c.get(ctx, url.Values{"format": {format}}, string(resource), id.String(), "manifest")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	manifest, err := io.ReadAll(res.Body)
+
+	return manifest, errors.Wrap(err, "can't read manifest")
+}
+
+// WatchChanges calls fn for each change matching opts until ctx is canceled, fn returns an error or
+// the API closes the stream, e.g. because the client can't keep up.
+// In the latter case, an error is returned and callers should refetch the data they display before watching again.
+func (c *Client) WatchChanges(ctx context.Context, opts ChangesOptions, fn func(Change) error) error {
+	query := url.Values{"cluster": opts.Clusters, "namespace": opts.Namespaces}
+	for _, resource := range opts.Resources {
+		query.Add("resource", string(resource))
+	}
+
+	res, err := c.get(ctx, query, "changes")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			// Event names are also part of the data, and comments only keep the connection alive.
+			continue
+		}
+
+		var change Change
+		if err := json.Unmarshal([]byte(data), &change); err != nil {
+			return errors.Wrap(err, "can't parse change")
+		}
+
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return errors.Wrap(err, "can't read changes")
+	}
+
+	return errors.New("API closed the stream of changes")
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	for column, values := range o.Filters {
+		query[column] = values
+	}
+
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		query.Set("offset", strconv.Itoa(o.Offset))
+	}
+
+	return query
+}
+
+// getJSON requests the given path and decodes the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, query url.Values, v any, path ...string) error {
+	res, err := c.get(ctx, query, path...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	return errors.Wrap(json.NewDecoder(res.Body).Decode(v), "can't decode response")
+}
+
+// get requests the given path and returns the response if successful.
+// Otherwise, an *Error is returned.
+func (c *Client) get(ctx context.Context, query url.Values, path ...string) (*http.Response, error) {
+	u := c.baseUrl.JoinPath(path...)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create request")
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't send request")
+	}
+
+	if res.StatusCode >= 300 {
+		defer func() { _ = res.Body.Close() }()
+
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&body); err != nil || body.Error == "" {
+			body.Error = res.Status
+		}
+
+		return nil, errors.WithStack(&Error{StatusCode: res.StatusCode, Message: body.Error})
+	}
+
+	return res, nil
+}
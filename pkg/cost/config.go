@@ -0,0 +1,67 @@
+package cost
+
+import "github.com/pkg/errors"
+
+// Config defines the prices from which costs are estimated.
+type Config struct {
+	// Cpu is the price per core and hour.
+	Cpu float64 `yaml:"cpu"`
+	// Memory is the price per GiB and hour.
+	Memory float64 `yaml:"memory"`
+	// Currency is stored with the costs, e.g. for reports.
+	Currency string `yaml:"currency" default:"USD"`
+	// Nodes overrides Cpu and Memory for nodes with matching labels. The first matching entry applies.
+	Nodes []NodePricing `yaml:"nodes"`
+}
+
+// NodePricing defines the prices of the nodes with all the given labels,
+// e.g. node.kubernetes.io/instance-type: m5.large.
+type NodePricing struct {
+	Labels map[string]string `yaml:"labels"`
+	Cpu    float64           `yaml:"cpu"`
+	Memory float64           `yaml:"memory"`
+}
+
+// Validate checks constraints in the supplied cost configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Cpu < 0 || c.Memory < 0 {
+		return errors.New("cost prices must not be negative")
+	}
+
+	if len(c.Currency) > 3 {
+		return errors.New("cost currency must be an ISO 4217 code, e.g. USD")
+	}
+
+	for i, n := range c.Nodes {
+		if len(n.Labels) == 0 {
+			return errors.Errorf("cost node pricing %d: labels missing", i+1)
+		}
+
+		if n.Cpu < 0 || n.Memory < 0 {
+			return errors.Errorf("cost node pricing %d: prices must not be negative", i+1)
+		}
+	}
+
+	return nil
+}
+
+// Enabled returns whether any prices are configured, so that costs are estimated.
+func (c *Config) Enabled() bool {
+	return c.Cpu > 0 || c.Memory > 0 || len(c.Nodes) > 0
+}
+
+// prices returns the prices per core and hour and per GiB and hour of a node with the given labels.
+func (c *Config) prices(labels map[string]string) (cpu, memory float64) {
+Nodes:
+	for _, n := range c.Nodes {
+		for name, value := range n.Labels {
+			if labels[name] != value {
+				continue Nodes
+			}
+		}
+
+		return n.Cpu, n.Memory
+	}
+
+	return c.Cpu, c.Memory
+}
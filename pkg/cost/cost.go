@@ -0,0 +1,282 @@
+// Package cost estimates the costs of namespaces and workloads from the resources of their pods
+// and the prices of the nodes they run on, e.g. for chargeback reports.
+package cost
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/workload"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// backlog is how far back costs are estimated after a restart, as pod metrics are only kept for a day.
+const backlog = 24 * time.Hour
+
+// gib is the number of bytes per GiB.
+const gib = 1 << 30
+
+// Estimator estimates the hourly costs of the namespaces and workloads of a cluster
+// and stores them in the cost_namespace and cost_workload tables.
+// Each running pod is charged for the greater of its requests and its average usage
+// of CPU and memory, if known from Prometheus, at the prices of its node.
+// Only pods that are still running when costs are estimated are taken into account.
+type Estimator struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	config      *Config
+	log         logr.Logger
+}
+
+// NewEstimator creates a new Estimator for the cluster with the given UUID.
+func NewEstimator(db *database.Database, clusterUuid types.UUID, c *Config, log logr.Logger) *Estimator {
+	return &Estimator{
+		db:          db,
+		clusterUuid: clusterUuid,
+		config:      c,
+		log:         log,
+	}
+}
+
+// Run estimates the costs of all hours that have passed since the last estimated hour, at most a day back,
+// and then of each hour once it has passed, until ctx is canceled.
+func (e *Estimator) Run(ctx context.Context) error {
+	for {
+		current := time.Now().Truncate(time.Hour)
+
+		var last int64
+		if err := e.db.QueryRowContext(
+			ctx, e.db.Rebind("SELECT COALESCE(MAX(hour), 0) FROM cost_namespace WHERE cluster_uuid = ?"), e.clusterUuid,
+		).Scan(&last); err != nil {
+			return errors.Wrap(err, "can't query last estimated hour")
+		}
+
+		next := current.Add(-time.Hour)
+		if last > 0 {
+			next = time.UnixMilli(last).Add(time.Hour)
+		}
+		if oldest := current.Add(-backlog); next.Before(oldest) {
+			next = oldest
+		}
+
+		for ; next.Before(current); next = next.Add(time.Hour) {
+			if err := e.Estimate(ctx, next); err != nil {
+				return err
+			}
+		}
+
+		// Wait a few minutes longer, so that the metrics of the end of the hour have been synchronized.
+		select {
+		case <-time.After(time.Until(current.Add(time.Hour + 5*time.Minute))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Estimate estimates and stores the costs of all namespaces and workloads of the cluster
+// for the hour starting at the given time.
+func (e *Estimator) Estimate(ctx context.Context, start time.Time) error {
+	start = start.Truncate(time.Hour)
+	end := start.Add(time.Hour)
+
+	e.log.V(1).Info("Estimating costs", "hour", start)
+
+	type pod struct {
+		Uuid           types.UUID
+		Namespace      string
+		Name           string
+		NodeName       sql.NullString
+		CpuRequests    sql.NullInt64
+		MemoryRequests sql.NullInt64
+		Created        types.UnixMilli
+	}
+
+	var pods []pod
+	if err := e.db.SelectContext(ctx, &pods, e.db.Rebind(
+		"SELECT uuid, namespace, name, node_name, cpu_requests, memory_requests, created FROM pod"+
+			" WHERE cluster_uuid = ? AND phase = 'Running' AND node_name IS NOT NULL AND created < ?"),
+		e.clusterUuid, end.UnixMilli()); err != nil {
+		return errors.Wrap(err, "can't query pods")
+	}
+
+	usage, err := e.usage(ctx, start, end)
+	if err != nil {
+		return err
+	}
+
+	prices, err := e.nodePrices(ctx)
+	if err != nil {
+		return err
+	}
+
+	workloads, err := workload.Resolve(ctx, e.db, e.clusterUuid)
+	if err != nil {
+		return err
+	}
+
+	namespaceCosts := make(map[string]*schemav1.CostNamespace)
+	workloadCosts := make(map[[3]string]*schemav1.CostWorkload)
+	for _, p := range pods {
+		from := start
+		if p.Created.Time().After(from) {
+			from = p.Created.Time()
+		}
+		hours := end.Sub(from).Hours()
+
+		// Requests are stored in millicores and millibytes.
+		cores := float64(p.CpuRequests.Int64) / 1000
+		bytes := float64(p.MemoryRequests.Int64) / 1000
+		if u, ok := usage[p.Uuid]; ok {
+			cores = max(cores, u.cores)
+			bytes = max(bytes, u.bytes)
+		}
+
+		price, ok := prices[p.NodeName.String]
+		if !ok {
+			price.cpu, price.memory = e.config.prices(nil)
+		}
+
+		cpuCost := cores * hours * price.cpu
+		memoryCost := bytes / gib * hours * price.memory
+
+		nc, ok := namespaceCosts[p.Namespace]
+		if !ok {
+			nc = &schemav1.CostNamespace{
+				ClusterUuid: e.clusterUuid,
+				Namespace:   p.Namespace,
+				Hour:        types.UnixMilli(start),
+				Currency:    e.config.Currency,
+			}
+			namespaceCosts[p.Namespace] = nc
+		}
+		nc.CpuCost += cpuCost
+		nc.MemoryCost += memoryCost
+		nc.Cost = nc.CpuCost + nc.MemoryCost
+
+		w, ok := workloads[p.Uuid]
+		if !ok {
+			w = workload.Workload{Kind: "Pod", Name: p.Name}
+		}
+
+		key := [3]string{p.Namespace, w.Kind, w.Name}
+		wc, ok := workloadCosts[key]
+		if !ok {
+			wc = &schemav1.CostWorkload{
+				ClusterUuid: e.clusterUuid,
+				Namespace:   p.Namespace,
+				Kind:        w.Kind,
+				Name:        w.Name,
+				Hour:        types.UnixMilli(start),
+				Currency:    e.config.Currency,
+			}
+			workloadCosts[key] = wc
+		}
+		wc.CpuCost += cpuCost
+		wc.MemoryCost += memoryCost
+		wc.Cost = wc.CpuCost + wc.MemoryCost
+	}
+
+	// Workloads are stored first, as the last estimated hour is determined from the namespace costs.
+	wcs := make(chan interface{}, len(workloadCosts))
+	for _, wc := range workloadCosts {
+		wcs <- wc
+	}
+	close(wcs)
+
+	if err := e.db.UpsertStreamed(ctx, wcs); err != nil {
+		return errors.Wrap(err, "can't store workload costs")
+	}
+
+	ncs := make(chan interface{}, len(namespaceCosts))
+	for _, nc := range namespaceCosts {
+		ncs <- nc
+	}
+	close(ncs)
+
+	return errors.Wrap(e.db.UpsertStreamed(ctx, ncs), "can't store namespace costs")
+}
+
+// resources are the average CPU cores and memory bytes used by a pod.
+type resources struct {
+	cores float64
+	bytes float64
+}
+
+// usage returns the average resources used by the pods of the cluster between start and end
+// from the synchronized Prometheus metrics, if any.
+func (e *Estimator) usage(ctx context.Context, start, end time.Time) (map[types.UUID]resources, error) {
+	var rows []struct {
+		PodUuid  types.UUID
+		Category string
+		Value    float64
+	}
+	if err := e.db.SelectContext(ctx, &rows, e.db.Rebind(
+		"SELECT m.pod_uuid, m.category, AVG(m.value) AS value FROM prometheus_pod_metric m"+
+			" INNER JOIN pod ON pod.uuid = m.pod_uuid"+
+			" WHERE pod.cluster_uuid = ? AND m.category IN ('cpu.usage.cores', 'memory.usage.bytes')"+
+			" AND m.timestamp >= ? AND m.timestamp < ? GROUP BY m.pod_uuid, m.category"),
+		e.clusterUuid, start.UnixMilli(), end.UnixMilli()); err != nil {
+		return nil, errors.Wrap(err, "can't query pod metrics")
+	}
+
+	usage := make(map[types.UUID]resources)
+	for _, r := range rows {
+		u := usage[r.PodUuid]
+		if r.Category == "cpu.usage.cores" {
+			u.cores = r.Value
+		} else {
+			u.bytes = r.Value
+		}
+		usage[r.PodUuid] = u
+	}
+
+	return usage, nil
+}
+
+// price is the price per core and hour and per GiB and hour.
+type price struct {
+	cpu    float64
+	memory float64
+}
+
+// nodePrices returns the prices of the nodes of the cluster by name.
+func (e *Estimator) nodePrices(ctx context.Context) (map[string]price, error) {
+	var rows []struct {
+		Name       string
+		LabelName  sql.NullString
+		LabelValue sql.NullString
+	}
+	if err := e.db.SelectContext(ctx, &rows, e.db.Rebind(
+		"SELECT node.name, label.name AS label_name, label.value AS label_value FROM node"+
+			" LEFT JOIN node_label ON node_label.node_uuid = node.uuid"+
+			" LEFT JOIN label ON label.uuid = node_label.label_uuid"+
+			" WHERE node.cluster_uuid = ?"),
+		e.clusterUuid); err != nil {
+		return nil, errors.Wrap(err, "can't query nodes")
+	}
+
+	labels := make(map[string]map[string]string)
+	for _, r := range rows {
+		if labels[r.Name] == nil {
+			labels[r.Name] = make(map[string]string)
+		}
+
+		if r.LabelName.Valid {
+			labels[r.Name][r.LabelName.String] = r.LabelValue.String
+		}
+	}
+
+	prices := make(map[string]price, len(labels))
+	for name, l := range labels {
+		var p price
+		p.cpu, p.memory = e.config.prices(l)
+		prices[name] = p
+	}
+
+	return prices, nil
+}
@@ -0,0 +1,209 @@
+// Package cronjob compares the schedules of cron jobs with the times they were last scheduled
+// and raises problems for cron jobs whose runs are missed or skipped because the previous run is still active.
+// The cron job controller doesn't record runs that it didn't start, so they don't show up anywhere else.
+package cronjob
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	kbatchv1 "k8s.io/api/batch/v1"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+const (
+	// MissedSchedule is the reason of problems of cron jobs that didn't start their scheduled runs.
+	MissedSchedule = "MissedSchedule"
+	// Overlapping is the reason of problems of cron jobs that skip their scheduled runs
+	// because the previous run is still active and concurrent runs are forbidden.
+	Overlapping = "Overlapping"
+
+	// interval is the interval in which cron jobs are checked.
+	interval = time.Minute
+	// grace is the time after which a scheduled run that hasn't been started is considered missed,
+	// as the cron job controller doesn't start runs exactly on time.
+	grace = 2 * time.Minute
+	// maxMissed limits how many missed runs are counted, e.g. of cron jobs scheduled every minute.
+	maxMissed = 100
+)
+
+// Tracker checks the cron jobs of a cluster every minute and raises and clears problems in the cron_job_problem table.
+// A cron job has at most one open problem, which is replaced once its reason or first missed run changes.
+// Suspended cron jobs don't miss runs.
+type Tracker struct {
+	clusterUuid types.UUID
+	namespaces  func(string) bool
+	problems    *problem.Tracker[types.UUID, *schemav1.CronJobProblem]
+}
+
+// NewTracker creates a new Tracker for the cluster with the given UUID.
+// Cron jobs of namespaces for which namespaces returns false are not checked.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewTracker(
+	db *database.Database,
+	clusterUuid types.UUID,
+	namespaces func(string) bool,
+	notify func(*schemav1.CronJobProblem),
+	log logr.Logger,
+) *Tracker {
+	return &Tracker{
+		clusterUuid: clusterUuid,
+		namespaces:  namespaces,
+		problems: problem.NewTracker(
+			db,
+			"cron job problem",
+			func(p *schemav1.CronJobProblem) types.UUID { return p.CronJobUuid },
+			func(p *schemav1.CronJobProblem) []any { return []any{"cron-job", p.Namespace + "/" + p.Name} },
+			notify,
+			log),
+	}
+}
+
+// Run loads the open problems and checks the cron jobs cached by the given informer every minute
+// until ctx is canceled.
+func (t *Tracker) Run(ctx context.Context, informer kcache.SharedIndexInformer) error {
+	if err := t.problems.Load(ctx, "cluster_uuid = ?", t.clusterUuid); err != nil {
+		return err
+	}
+
+	if !kcache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	for {
+		if err := t.Check(ctx, informer.GetStore(), time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Check checks the cron jobs in the given store at the given time and raises and clears their problems.
+// Problems of cron jobs that no longer exist are cleared.
+func (t *Tracker) Check(ctx context.Context, store kcache.Store, now time.Time) error {
+	seen := make(map[types.UUID]struct{})
+	for _, obj := range store.List() {
+		cronJob, ok := obj.(*kbatchv1.CronJob)
+		if !ok || !t.namespaces(cronJob.Namespace) {
+			continue
+		}
+
+		id := schemav1.EnsureUUID(cronJob.UID)
+		seen[id] = struct{}{}
+
+		if err := t.update(ctx, id, cronJob, now); err != nil {
+			return err
+		}
+	}
+
+	return t.problems.ClearFunc(ctx, func(id types.UUID, _ *schemav1.CronJobProblem) bool {
+		_, ok := seen[id]
+
+		return !ok
+	}, now)
+}
+
+// update raises or clears the problem of the given cron job.
+// An open problem with a different reason or first missed run is cleared first.
+func (t *Tracker) update(ctx context.Context, id types.UUID, cronJob *kbatchv1.CronJob, now time.Time) error {
+	reason, message, scheduled := evaluate(cronJob, now)
+
+	return t.problems.Update(ctx, id, reason, func(open *schemav1.CronJobProblem) bool {
+		return open.Scheduled.Time().Equal(scheduled)
+	}, func() *schemav1.CronJobProblem {
+		return &schemav1.CronJobProblem{
+			Uuid:        schemav1.NewUUID(id, fmt.Sprintf("%s:%d", reason, scheduled.UnixMilli())),
+			ClusterUuid: t.clusterUuid,
+			CronJobUuid: id,
+			Namespace:   cronJob.Namespace,
+			Name:        cronJob.Name,
+			Reason:      reason,
+			Message:     schemav1.NewNullableString(message),
+			Scheduled:   types.UnixMilli(scheduled),
+			Started:     types.UnixMilli(now),
+		}
+	}, now)
+}
+
+// evaluate returns the reason and message of the problem of the given cron job at the given time
+// and the time of its first missed run, or an empty reason if it has no problem.
+// Runs scheduled after the last scheduled run, or after the creation of cron jobs that haven't run yet,
+// are missed if they haven't been started within the grace period. The cron job controller neither starts
+// nor records runs while the previous run is active and concurrent runs are forbidden, so they overlap instead.
+// Schedules that can't be parsed are not evaluated, as the cron job controller doesn't run them either.
+func evaluate(cronJob *kbatchv1.CronJob, now time.Time) (string, string, time.Time) {
+	if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+		return "", "", time.Time{}
+	}
+
+	schedule, err := cron.ParseStandard(format(cronJob))
+	if err != nil {
+		return "", "", time.Time{}
+	}
+
+	last := cronJob.CreationTimestamp.Time
+	if cronJob.Status.LastScheduleTime != nil {
+		last = cronJob.Status.LastScheduleTime.Time
+	}
+
+	first := schedule.Next(last)
+	if first.IsZero() || first.Add(grace).After(now) {
+		return "", "", time.Time{}
+	}
+
+	missed := 0
+	for next := first; !next.IsZero() && !next.Add(grace).After(now) && missed < maxMissed; next = schedule.Next(next) {
+		missed++
+	}
+
+	name := cronJob.Namespace + "/" + cronJob.Name
+	runs := "the run scheduled at " + first.UTC().Format(time.RFC3339)
+	if missed > 1 {
+		count := fmt.Sprintf("%d", missed)
+		if missed == maxMissed {
+			count = "at least " + count
+		}
+
+		runs = fmt.Sprintf("%s runs scheduled since %s", count, first.UTC().Format(time.RFC3339))
+	}
+
+	if cronJob.Spec.ConcurrencyPolicy == kbatchv1.ForbidConcurrent && len(cronJob.Status.Active) > 0 {
+		return Overlapping, fmt.Sprintf(
+			"Cron job %s skipped %s, as job %s is still active and concurrent runs are forbidden.",
+			name, runs, cronJob.Status.Active[0].Name), first
+	}
+
+	message := fmt.Sprintf("Cron job %s missed %s", name, runs)
+	if d := cronJob.Spec.StartingDeadlineSeconds; d != nil && first.Add(time.Duration(*d)*time.Second).Before(now) {
+		message += fmt.Sprintf(", whose starting deadline of %ds has passed", *d)
+	}
+	if cronJob.Status.LastSuccessfulTime != nil {
+		message += fmt.Sprintf(
+			". The last successful run finished at %s", cronJob.Status.LastSuccessfulTime.UTC().Format(time.RFC3339))
+	}
+
+	return MissedSchedule, message + ".", first
+}
+
+// format returns the schedule of the given cron job in the time zone of the cron job, if any,
+// as the cron job controller does. Cron jobs without time zone are scheduled in the local time zone
+// of the controller, which is assumed to be the same as ours.
+func format(cronJob *kbatchv1.CronJob) string {
+	if cronJob.Spec.TimeZone != nil {
+		return "TZ=" + *cronJob.Spec.TimeZone + " " + cronJob.Spec.Schedule
+	}
+
+	return cronJob.Spec.Schedule
+}
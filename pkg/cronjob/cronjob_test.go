@@ -0,0 +1,135 @@
+package cronjob
+
+import (
+	kbatchv1 "k8s.io/api/batch/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEvaluate verifies that cron jobs miss runs that haven't been started within the grace period
+// and overlap if the previous run is still active and concurrent runs are forbidden.
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 30, 0, time.UTC)
+	suspend := true
+	utc := "UTC"
+	deadline := int64(60)
+
+	tests := []struct {
+		name     string
+		schedule string
+		suspend  *bool
+		deadline *int64
+		last     time.Time
+		policy   kbatchv1.ConcurrencyPolicy
+		active   bool
+		reason   string
+		first    time.Time
+		message  string
+	}{
+		{
+			name:     "run within grace period isn't missed",
+			schedule: "0 12 * * *",
+			last:     now.Add(-24 * time.Hour),
+		},
+		{
+			name:     "run after grace period is missed",
+			schedule: "58 11 * * *",
+			last:     now.Add(-24 * time.Hour),
+			reason:   MissedSchedule,
+			first:    time.Date(2024, 6, 1, 11, 58, 0, 0, time.UTC),
+			message:  "missed the run scheduled at 2024-06-01T11:58:00Z.",
+		},
+		{
+			name:     "missed runs are counted",
+			schedule: "*/10 * * * *",
+			last:     time.Date(2024, 6, 1, 11, 20, 0, 0, time.UTC),
+			reason:   MissedSchedule,
+			first:    time.Date(2024, 6, 1, 11, 30, 0, 0, time.UTC),
+			message:  "missed 3 runs scheduled since 2024-06-01T11:30:00Z.",
+		},
+		{
+			name:     "missed runs are limited",
+			schedule: "* * * * *",
+			last:     now.Add(-24 * time.Hour),
+			reason:   MissedSchedule,
+			first:    time.Date(2024, 5, 31, 12, 1, 0, 0, time.UTC),
+			message:  "missed at least 100 runs",
+		},
+		{
+			name:     "passed starting deadline is mentioned",
+			schedule: "58 11 * * *",
+			deadline: &deadline,
+			last:     now.Add(-24 * time.Hour),
+			reason:   MissedSchedule,
+			first:    time.Date(2024, 6, 1, 11, 58, 0, 0, time.UTC),
+			message:  "whose starting deadline of 60s has passed.",
+		},
+		{
+			name:     "active run with forbidden concurrency overlaps",
+			schedule: "58 11 * * *",
+			last:     now.Add(-24 * time.Hour),
+			policy:   kbatchv1.ForbidConcurrent,
+			active:   true,
+			reason:   Overlapping,
+			first:    time.Date(2024, 6, 1, 11, 58, 0, 0, time.UTC),
+			message:  "as job backup-1 is still active",
+		},
+		{
+			name:     "active run with allowed concurrency misses",
+			schedule: "58 11 * * *",
+			last:     now.Add(-24 * time.Hour),
+			policy:   kbatchv1.AllowConcurrent,
+			active:   true,
+			reason:   MissedSchedule,
+			first:    time.Date(2024, 6, 1, 11, 58, 0, 0, time.UTC),
+		},
+		{
+			name:     "suspended cron job doesn't miss runs",
+			schedule: "58 11 * * *",
+			suspend:  &suspend,
+			last:     now.Add(-24 * time.Hour),
+		},
+		{
+			name:     "invalid schedule isn't evaluated",
+			schedule: "every minute",
+			last:     now.Add(-24 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cronJob := &kbatchv1.CronJob{
+				ObjectMeta: kmetav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              "backup",
+					CreationTimestamp: kmetav1.NewTime(tt.last),
+				},
+				Spec: kbatchv1.CronJobSpec{
+					Schedule:                tt.schedule,
+					TimeZone:                &utc,
+					Suspend:                 tt.suspend,
+					StartingDeadlineSeconds: tt.deadline,
+					ConcurrencyPolicy:       tt.policy,
+				},
+			}
+			if tt.active {
+				cronJob.Status.Active = []kcorev1.ObjectReference{{Name: "backup-1"}}
+			}
+
+			reason, message, first := evaluate(cronJob, now)
+
+			if reason != tt.reason {
+				t.Errorf("reason is %q, expected %q", reason, tt.reason)
+			}
+			if !first.Equal(tt.first) {
+				t.Errorf("first missed run is %s, expected %s", first, tt.first)
+			}
+			if !strings.Contains(message, tt.message) {
+				t.Errorf("message %q doesn't contain %q", message, tt.message)
+			}
+		})
+	}
+}
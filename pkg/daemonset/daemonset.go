@@ -0,0 +1,294 @@
+// Package daemonset finds the nodes that should, but don't run a pod of a daemon set,
+// e.g. because the pod can't be scheduled or keeps crashing, which silently leaves nodes without the monitoring,
+// logging or networking agents that are usually deployed as daemon sets.
+package daemonset
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kappsv1 "k8s.io/api/apps/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+const (
+	// interval is the interval in which the coverage of daemon sets is checked.
+	interval = 5 * time.Minute
+	// grace is the time nodes and daemon sets get to start their pods before gaps are reported.
+	grace = 5 * time.Minute
+)
+
+// Analyzer checks every five minutes which nodes of a cluster should, but don't run a pod of each daemon set
+// and stores them in the daemon_set_coverage_gap table, replacing the previous ones.
+// A node should run a pod of a daemon set if the node selector, required node affinity and tolerations
+// of its pod template match the node, taking into account the tolerations the daemon set controller adds to its pods.
+// Nodes that aren't ready are skipped, as none of their pods run anyway.
+// Daemon sets, nodes and pods are taken from the informers run by the daemon-sets, nodes and pods controllers.
+type Analyzer struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	namespaces  func(string) bool
+	log         logr.Logger
+}
+
+// NewAnalyzer creates a new Analyzer for the cluster with the given UUID.
+// Daemon sets of namespaces for which namespaces returns false are not checked.
+func NewAnalyzer(db *database.Database, clusterUuid types.UUID, namespaces func(string) bool, log logr.Logger) *Analyzer {
+	return &Analyzer{
+		db:          db,
+		clusterUuid: clusterUuid,
+		namespaces:  namespaces,
+		log:         log,
+	}
+}
+
+// Run checks the coverage of the daemon sets, nodes and pods cached by the given informers every five minutes
+// until ctx is canceled.
+func (a *Analyzer) Run(ctx context.Context, daemonSets, nodes, pods kcache.SharedIndexInformer) error {
+	if !kcache.WaitForCacheSync(ctx.Done(), daemonSets.HasSynced, nodes.HasSynced, pods.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	for {
+		if err := a.Analyze(ctx, daemonSets.GetStore(), nodes.GetStore(), pods.GetStore(), time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Analyze checks the coverage of the daemon sets, nodes and pods in the given stores
+// and stores the gaps at the given time.
+func (a *Analyzer) Analyze(ctx context.Context, daemonSets, nodes, pods kcache.Store, now time.Time) error {
+	a.log.V(1).Info("Checking daemon set coverage")
+
+	var ready []*kcorev1.Node
+	for _, obj := range nodes.List() {
+		if node, ok := obj.(*kcorev1.Node); ok && isReady(node) && node.DeletionTimestamp == nil &&
+			node.CreationTimestamp.Add(grace).Before(now) {
+			ready = append(ready, node)
+		}
+	}
+
+	// Pods of daemon sets by the UID of their daemon set and the name of their node.
+	daemonPods := make(map[[2]string]*kcorev1.Pod)
+	for _, obj := range pods.List() {
+		pod, ok := obj.(*kcorev1.Pod)
+		if !ok || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		owner := kmetav1.GetControllerOf(pod)
+		if owner == nil || owner.Kind != "DaemonSet" || owner.APIVersion != kappsv1.SchemeGroupVersion.String() {
+			continue
+		}
+
+		key := [2]string{string(owner.UID), nodeOf(pod)}
+		// Pods that run are preferred over others for the same node, e.g. while they are replaced.
+		if other, ok := daemonPods[key]; !ok || other.Status.Phase != kcorev1.PodRunning {
+			daemonPods[key] = pod
+		}
+	}
+
+	entities := make(chan interface{}, len(ready)*len(daemonSets.ListKeys()))
+	for _, obj := range daemonSets.List() {
+		ds, ok := obj.(*kappsv1.DaemonSet)
+		if !ok || !a.namespaces(ds.Namespace) || ds.DeletionTimestamp != nil || ds.CreationTimestamp.Add(grace).After(now) {
+			continue
+		}
+
+		for _, node := range ready {
+			if !shouldRun(ds, node) {
+				continue
+			}
+
+			gap := &schemav1.DaemonSetCoverageGap{
+				DaemonSetUuid: schemav1.EnsureUUID(ds.UID),
+				NodeUuid:      schemav1.EnsureUUID(node.UID),
+				ClusterUuid:   a.clusterUuid,
+				Namespace:     ds.Namespace,
+				DaemonSetName: ds.Name,
+				NodeName:      node.Name,
+				Computed:      types.UnixMilli(now),
+			}
+
+			pod, ok := daemonPods[[2]string{string(ds.UID), node.Name}]
+			switch {
+			case !ok:
+				gap.Reason = schemav1.DaemonSetCoverageMissing
+			case pod.Status.Phase != kcorev1.PodRunning && pod.CreationTimestamp.Add(grace).Before(now):
+				gap.Reason = schemav1.DaemonSetCoverageNotRunning
+				gap.PodName = schemav1.NewNullableString(pod.Name)
+				gap.PodPhase = schemav1.NewNullableString(string(pod.Status.Phase))
+			default:
+				continue
+			}
+
+			entities <- gap
+		}
+	}
+	close(entities)
+
+	if err := a.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store daemon set coverage gaps")
+	}
+
+	// Gaps that have been closed and gaps of daemon sets and nodes that don't exist anymore are removed.
+	_, err := a.db.ExecContext(ctx, a.db.Rebind(
+		"DELETE FROM daemon_set_coverage_gap WHERE cluster_uuid = ? AND computed < ?"), a.clusterUuid, now.UnixMilli())
+
+	return errors.Wrap(err, "can't delete outdated daemon set coverage gaps")
+}
+
+// shouldRun returns whether a pod of the given daemon set should run on the given node.
+func shouldRun(ds *kappsv1.DaemonSet, node *kcorev1.Node) bool {
+	spec := ds.Spec.Template.Spec
+
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	if affinity := spec.Affinity; affinity != nil && affinity.NodeAffinity != nil &&
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil &&
+		!matchesNodeSelector(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution, node) {
+		return false
+	}
+
+	tolerations := append(daemonTolerations(spec.HostNetwork), spec.Tolerations...)
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect != kcorev1.TaintEffectNoSchedule && taint.Effect != kcorev1.TaintEffectNoExecute {
+			continue
+		}
+
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+
+				break
+			}
+		}
+
+		if !tolerated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// daemonTolerations returns the tolerations that the daemon set controller adds to the pods of daemon sets,
+// so that they run on nodes that are cordoned or under pressure, for example.
+func daemonTolerations(hostNetwork bool) []kcorev1.Toleration {
+	tolerations := []kcorev1.Toleration{
+		{Key: kcorev1.TaintNodeNotReady, Operator: kcorev1.TolerationOpExists, Effect: kcorev1.TaintEffectNoExecute},
+		{Key: kcorev1.TaintNodeUnreachable, Operator: kcorev1.TolerationOpExists, Effect: kcorev1.TaintEffectNoExecute},
+		{Key: kcorev1.TaintNodeDiskPressure, Operator: kcorev1.TolerationOpExists, Effect: kcorev1.TaintEffectNoSchedule},
+		{Key: kcorev1.TaintNodeMemoryPressure, Operator: kcorev1.TolerationOpExists, Effect: kcorev1.TaintEffectNoSchedule},
+		{Key: kcorev1.TaintNodePIDPressure, Operator: kcorev1.TolerationOpExists, Effect: kcorev1.TaintEffectNoSchedule},
+		{Key: kcorev1.TaintNodeUnschedulable, Operator: kcorev1.TolerationOpExists, Effect: kcorev1.TaintEffectNoSchedule},
+	}
+
+	if hostNetwork {
+		tolerations = append(tolerations, kcorev1.Toleration{
+			Key: kcorev1.TaintNodeNetworkUnavailable, Operator: kcorev1.TolerationOpExists,
+			Effect: kcorev1.TaintEffectNoSchedule,
+		})
+	}
+
+	return tolerations
+}
+
+// matchesNodeSelector returns whether the given node matches any of the terms of the given node selector.
+// Terms without requirements match no nodes.
+func matchesNodeSelector(selector *kcorev1.NodeSelector, node *kcorev1.Node) bool {
+	for _, term := range selector.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+
+		if matchesRequirements(term.MatchExpressions, node.Labels) &&
+			matchesRequirements(term.MatchFields, map[string]string{"metadata.name": node.Name}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesRequirements returns whether the given labels or fields match all of the given requirements.
+// Requirements that are invalid match nothing, as for the scheduler.
+func matchesRequirements(requirements []kcorev1.NodeSelectorRequirement, set map[string]string) bool {
+	for _, r := range requirements {
+		var op selection.Operator
+		switch r.Operator {
+		case kcorev1.NodeSelectorOpIn:
+			op = selection.In
+		case kcorev1.NodeSelectorOpNotIn:
+			op = selection.NotIn
+		case kcorev1.NodeSelectorOpExists:
+			op = selection.Exists
+		case kcorev1.NodeSelectorOpDoesNotExist:
+			op = selection.DoesNotExist
+		case kcorev1.NodeSelectorOpGt:
+			op = selection.GreaterThan
+		case kcorev1.NodeSelectorOpLt:
+			op = selection.LessThan
+		default:
+			return false
+		}
+
+		requirement, err := labels.NewRequirement(r.Key, op, r.Values)
+		if err != nil || !requirement.Matches(labels.Set(set)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nodeOf returns the name of the node of the given pod of a daemon set. Pods that haven't been scheduled yet
+// are bound to their node via the node affinity that the daemon set controller sets.
+func nodeOf(pod *kcorev1.Pod) string {
+	if pod.Spec.NodeName != "" {
+		return pod.Spec.NodeName
+	}
+
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil &&
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			for _, field := range term.MatchFields {
+				if field.Key == "metadata.name" && field.Operator == kcorev1.NodeSelectorOpIn && len(field.Values) == 1 {
+					return field.Values[0]
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// isReady returns whether the given node is ready.
+func isReady(node *kcorev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == kcorev1.NodeReady {
+			return condition.Status == kcorev1.ConditionTrue
+		}
+	}
+
+	return false
+}
@@ -17,6 +17,17 @@ type CleanupStmt struct {
 	Table  string
 	PK     string
 	Column string
+	// Retention is the duration for which rows are kept. Defaults to one day.
+	Retention time.Duration
+	// Archiver, if set, archives the rows before they are deleted.
+	Archiver Archiver
+}
+
+// Archiver archives rows before they are deleted by the retention, e.g. for long-term compliance.
+type Archiver interface {
+	// Archive archives all rows of the table of stmt that are older than the given time.
+	// If it fails, the rows are not deleted until the next cleanup.
+	Archive(ctx context.Context, db *Database, stmt CleanupStmt, olderThan time.Time) error
 }
 
 // Build assembles the cleanup statement for the specified database driver with the given limit.
@@ -114,6 +125,20 @@ func (db *Database) PeriodicCleanup(ctx context.Context, stmt CleanupStmt) error
 
 	periodic.Start(ctx, time.Hour, func(tick periodic.Tick) {
 		olderThan := tick.Time.AddDate(0, 0, -1)
+		if stmt.Retention > 0 {
+			olderThan = tick.Time.Add(-stmt.Retention)
+		}
+
+		if stmt.Archiver != nil {
+			// Rows that can't be archived are kept until the next round, e.g. while the archive is unavailable.
+			if err := stmt.Archiver.Archive(ctx, db, stmt, olderThan); err != nil {
+				if ctx.Err() == nil {
+					db.log.Error(err, "Can't archive rows, not deleting them", "table", stmt.Table)
+				}
+
+				return
+			}
+		}
 
 		_, err := db.CleanupOlderThan(
 			ctx, stmt, 5000, olderThan,
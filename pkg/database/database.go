@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/go-sql-driver/mysql"
@@ -20,6 +21,7 @@ import (
 	"net"
 	"net/url"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -43,6 +45,8 @@ type Database struct {
 	tableSemaphoresMu sync.Mutex
 
 	quoter *Quoter
+
+	writeLimiter *WriteLimiter
 }
 
 // NewFromConfig returns a new Database connection from the given Config.
@@ -110,6 +114,12 @@ func NewFromConfig(c *database.Config, log logr.Logger) (*Database, error) {
 	db.SetMaxIdleConns(c.Options.MaxConnections / 3)
 	db.SetMaxOpenConns(c.Options.MaxConnections)
 
+	return New(db, c.Options, log), nil
+}
+
+// New returns a new Database using the given connection pool, whose driver name must be MySQL or PostgreSQL,
+// e.g. to run against another driver in tests.
+func New(db *sqlx.DB, options database.Options, log logr.Logger) *Database {
 	db.Mapper = reflectx.NewMapperFunc("db", func(s string) string {
 		return strcase.Snake(s)
 	})
@@ -118,10 +128,39 @@ func NewFromConfig(c *database.Config, log logr.Logger) (*Database, error) {
 		DB:              db,
 		log:             log,
 		columnMap:       database.NewColumnMap(db.Mapper),
-		Options:         c.Options,
+		Options:         options,
 		tableSemaphores: make(map[string]*semaphore.Weighted),
 		quoter:          NewQuoter(db),
-	}, nil
+	}
+}
+
+// SetWriteLimiter limits the rate of all writes of the database to the given WriteLimiter,
+// which may be shared with other writers. Writes are not limited if it is nil.
+func (db *Database) SetWriteLimiter(limiter *WriteLimiter) {
+	db.writeLimiter = limiter
+}
+
+// WriteLimiter returns the WriteLimiter set by SetWriteLimiter, if any.
+func (db *Database) WriteLimiter() *WriteLimiter {
+	return db.writeLimiter
+}
+
+// ExecContext executes the query as soon as the WriteLimiter permits writing a row.
+func (db *Database) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if err := db.writeLimiter.Wait(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+// NamedExecContext executes the named query as soon as the WriteLimiter permits writing a row.
+func (db *Database) NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error) {
+	if err := db.writeLimiter.Wait(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	return db.DB.NamedExecContext(ctx, query, arg)
 }
 
 // BatchSizeByPlaceholders returns how often the specified number of placeholders fits
@@ -182,6 +221,16 @@ func (db *Database) BuildUpsertStmt(subject interface{}) (stmt string, placehold
 		updateColumns = insertColumns
 	}
 
+	return db.buildUpsertStmt(table, insertColumns, updateColumns), len(insertColumns)
+}
+
+// BuildUpsertColumnsStmt returns an upsert statement with named placeholders for the given columns of table,
+// e.g. for rows not backed by a struct.
+func (db *Database) BuildUpsertColumnsStmt(table string, columns []string) string {
+	return db.buildUpsertStmt(table, columns, columns)
+}
+
+func (db *Database) buildUpsertStmt(table string, insertColumns, updateColumns []string) string {
 	var clause, setFormat string
 	quoted := db.quoter.QuoteIdentifier("%[1]s")
 	switch db.DriverName() {
@@ -206,7 +255,7 @@ func (db *Database) BuildUpsertStmt(subject interface{}) (stmt string, placehold
 		fmt.Sprintf(":%s", strings.Join(insertColumns, ", :")),
 		clause,
 		strings.Join(set, ", "),
-	), len(insertColumns)
+	)
 }
 
 // BulkExec bulk executes queries with a single slice placeholder in the form of `IN (?)`.
@@ -214,7 +263,8 @@ func (db *Database) BuildUpsertStmt(subject interface{}) (stmt string, placehold
 // derives and expands a query and executes it with this set of arguments until the arg stream has been processed.
 // The derived queries are executed in a separate goroutine with a weighting of 1
 // and can be executed concurrently to the extent allowed by the semaphore passed in sem.
-// Arguments for which the query ran successfully will be passed to onSuccess.
+// Arguments for which the query ran successfully will be passed to onSuccess,
+// arguments for which it failed with a non-retryable error to onError, if set.
 func (db *Database) BulkExec(
 	ctx context.Context, query string, count int, sem *semaphore.Weighted, arg <-chan interface{}, features ...Feature,
 ) error {
@@ -244,7 +294,11 @@ func (db *Database) BulkExec(
 				return func() error {
 					defer sem.Release(n)
 
-					return retry.WithBackoff(
+					if err := db.writeLimiter.Wait(ctx, len(b)); err != nil {
+						return err
+					}
+
+					err := retry.WithBackoff(
 						ctx,
 						func(context.Context) error {
 							stmt, args, err := sqlx.In(query, b)
@@ -253,25 +307,34 @@ func (db *Database) BulkExec(
 							}
 
 							stmt = db.Rebind(stmt)
-							_, err = db.ExecContext(ctx, stmt, args...)
+							_, err = db.DB.ExecContext(ctx, stmt, args...)
 							if err != nil {
 								return CantPerformQuery(err, query)
 							}
 
-							counter.Add(uint64(len(b)))
-
-							if f.onSuccess != nil {
-								if err := f.onSuccess(ctx, b); err != nil {
-									return err
-								}
-							}
-
 							return nil
 						},
 						IsRetryable,
 						backoff.NewExponentialWithJitter(1*time.Millisecond, 1*time.Second),
 						retry.Settings{},
 					)
+					if err != nil {
+						if f.onError == nil || ctx.Err() != nil {
+							return err
+						}
+
+						return f.onError(ctx, b, err)
+					}
+
+					counter.Add(uint64(len(b)))
+
+					if f.onSuccess != nil {
+						if err := f.onSuccess(ctx, b); err != nil {
+							return err
+						}
+					}
+
+					return nil
 				}
 			}(b))
 		}
@@ -299,7 +362,8 @@ func (db *Database) Connect() bool {
 // this set of arguments, until the arg stream has been processed.
 // The queries are executed in a separate goroutine with a weighting of 1
 // and can be executed concurrently to the extent allowed by the semaphore passed in sem.
-// Entities for which the query ran successfully will be passed to onSuccess.
+// Entities for which the query ran successfully will be passed to onSuccess,
+// entities for which it failed with a non-retryable error to onError, if set.
 func (db *Database) NamedBulkExec(
 	ctx context.Context, query string, count int, sem *semaphore.Weighted, arg <-chan interface{},
 	splitPolicyFactory com.BulkChunkSplitPolicyFactory[interface{}], features ...Feature,
@@ -331,28 +395,41 @@ func (db *Database) NamedBulkExec(
 						defer runtime.HandleCrash()
 						defer sem.Release(1)
 
-						return retry.WithBackoff(
+						if err := db.writeLimiter.Wait(ctx, len(b)); err != nil {
+							return err
+						}
+
+						err := retry.WithBackoff(
 							ctx,
 							func(ctx context.Context) error {
-								_, err := db.NamedExecContext(ctx, query, b)
+								_, err := db.DB.NamedExecContext(ctx, query, b)
 								if err != nil {
 									return CantPerformQuery(err, query)
 								}
 
-								counter.Add(uint64(len(b)))
-
-								if with.onSuccess != nil {
-									if err := with.onSuccess(ctx, b); err != nil {
-										return err
-									}
-								}
-
 								return nil
 							},
 							IsRetryable,
 							backoff.NewExponentialWithJitter(1*time.Millisecond, 1*time.Second),
 							retry.Settings{},
 						)
+						if err != nil {
+							if with.onError == nil || ctx.Err() != nil {
+								return err
+							}
+
+							return with.onError(ctx, b, err)
+						}
+
+						counter.Add(uint64(len(b)))
+
+						if with.onSuccess != nil {
+							if err := with.onSuccess(ctx, b); err != nil {
+								return err
+							}
+						}
+
+						return nil
 					}
 				}(b))
 			case <-ctx.Done():
@@ -402,7 +479,6 @@ func (db *Database) DeleteStreamed(
 			ch := make(chan interface{})
 			g.Go(func() error {
 				defer runtime.HandleCrash()
-				defer close(ch)
 
 				return db.DeleteStreamed(ctx, relation, ch, features...)
 			})
@@ -443,6 +519,8 @@ func (db *Database) DeleteStreamed(
 
 		g.Go(func() error {
 			defer runtime.HandleCrash()
+			// The relation streams are only fed from here, so close them once dup is exhausted.
+			defer closeAll(streams)
 
 			for {
 				select {
@@ -494,6 +572,8 @@ func (db *Database) DeleteStreamed(
 // The upsert statement is created using BuildUpsertStmt with the first entity from the entities stream.
 // Bulk size is controlled via Options.MaxPlaceholdersPerStatement and
 // concurrency is controlled via Options.MaxConnectionsPerTable.
+// With WithCascading, the relations of the entities are upserted after the entities themselves,
+// by as many workers as set via WithRelationWorkers.
 func (db *Database) UpsertStreamed(
 	ctx context.Context, entities <-chan interface{}, features ...Feature,
 ) error {
@@ -516,74 +596,58 @@ func (db *Database) UpsertStreamed(
 			ch := make(chan interface{})
 			g.Go(func() error {
 				defer runtime.HandleCrash()
-				defer close(ch)
 
-				return db.UpsertStreamed(ctx, ch, WithCascading())
+				return db.UpsertStreamed(ctx, ch, WithCascading(), WithRelationWorkers(with.RelationWorkers()))
 			})
 			streams[TableName(relation)] = ch
 		}
 
-		source := forward
-		forward := make(chan interface{})
-		dup := make(chan interface{})
-
-		g.Go(func() error {
-			defer close(forward)
-			defer close(dup)
-
-			for {
-				select {
-				case entity, more := <-source:
-					if !more {
-						return nil
-					}
+		// Relations are only streamed once the entities they belong to have been written,
+		// so that they never refer to missing rows, and only those of a limited number of entities at once.
+		relationSem := semaphore.NewWeighted(int64(with.RelationWorkers()))
+		var pending sync.WaitGroup
 
-					select {
-					case forward <- entity:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
+		onSuccess := func(bulkCtx context.Context, bulk []any) error {
+			for _, entity := range bulk {
+				entity := entity
 
-					select {
-					case dup <- entity:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-				case <-ctx.Done():
-					return ctx.Err()
+				if err := relationSem.Acquire(bulkCtx, 1); err != nil {
+					return errors.Wrap(err, "can't acquire semaphore")
 				}
-			}
-		})
 
-		g.Go(func() error {
-			defer runtime.HandleCrash()
+				pending.Add(1)
+				g.Go(func() error {
+					defer runtime.HandleCrash()
+					defer pending.Done()
+					defer relationSem.Release(1)
 
-			for {
-				select {
-				case entity, more := <-dup:
-					if !more {
-						return nil
+					for _, relation := range entity.(HasRelations).Relations() {
+						if err := relation.StreamInto(ctx, streams[TableName(relation)]); err != nil {
+							return err
+						}
 					}
 
-					for _, relation := range entity.(HasRelations).Relations() {
-						relation := relation
-						g.Go(func() error {
-							defer runtime.HandleCrash()
+					return nil
+				})
+			}
 
-							return relation.StreamInto(ctx, streams[TableName(relation)])
-						})
-					}
-				case <-ctx.Done():
-					return ctx.Err()
-				}
+			if with.onSuccess != nil {
+				return with.onSuccess(bulkCtx, bulk)
 			}
-		})
+
+			return nil
+		}
 
 		g.Go(func() error {
 			defer runtime.HandleCrash()
+			// The relation streams are only fed from onSuccess, so close them once all entities have been written
+			// and all pending relations have been streamed.
+			defer closeAll(streams)
+			defer pending.Wait()
 
 			return db.NamedBulkExec(
-				ctx, stmt, db.BatchSizeByPlaceholders(placeholders), sem, forward, com.NeverSplit[any], features...)
+				ctx, stmt, db.BatchSizeByPlaceholders(placeholders), sem, forward, com.NeverSplit[any],
+				append(slices.Clip(features), WithOnSuccess(onSuccess))...)
 		})
 
 		return g.Wait()
@@ -658,6 +722,13 @@ func (db *Database) query(ctx context.Context, query string, scope ...interface{
 	return
 }
 
+// closeAll closes all the given channels.
+func closeAll(channels map[string]chan interface{}) {
+	for _, ch := range channels {
+		close(ch)
+	}
+}
+
 func IsStruct(subject interface{}) bool {
 	v := reflect.ValueOf(subject)
 	switch v.Kind() {
@@ -1,15 +1,18 @@
 package database
 
 import (
+	"context"
 	"github.com/icinga/icinga-kubernetes/pkg/com"
 )
 
 type Feature func(*Features)
 
 type Features struct {
-	blocking  bool
-	cascading bool
-	onSuccess com.ProcessBulk[any]
+	blocking        bool
+	cascading       bool
+	onError         func(ctx context.Context, bulk []any, err error) error
+	onSuccess       com.ProcessBulk[any]
+	relationWorkers int
 }
 
 func NewFeatures(features ...Feature) *Features {
@@ -21,6 +24,11 @@ func NewFeatures(features ...Feature) *Features {
 	return f
 }
 
+// RelationWorkers returns the number of relations streamed concurrently when cascading, at least 1.
+func (f *Features) RelationWorkers() int {
+	return max(f.relationWorkers, 1)
+}
+
 func WithBlocking() Feature {
 	return func(f *Features) {
 		f.blocking = true
@@ -38,3 +46,18 @@ func WithOnSuccess(fn com.ProcessBulk[any]) Feature {
 		f.onSuccess = fn
 	}
 }
+
+// WithOnError passes bulks for which the query failed with a non-retryable error to fn
+// instead of failing the whole operation. The operation only fails if fn returns an error.
+func WithOnError(fn func(ctx context.Context, bulk []any, err error) error) Feature {
+	return func(f *Features) {
+		f.onError = fn
+	}
+}
+
+// WithRelationWorkers streams the relations of up to n written entities concurrently when cascading.
+func WithRelationWorkers(n int) Feature {
+	return func(f *Features) {
+		f.relationWorkers = n
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// WriteLimitConfig defines the rate at which rows are written to the database.
+type WriteLimitConfig struct {
+	// RowsPerSecond is the maximum number of rows written per second by all writers together.
+	// Statements that don't refer to individual rows count as one row. Zero disables the limit.
+	RowsPerSecond float64 `yaml:"rows_per_second"`
+	// Burst is the maximum number of rows written at once, exceeding RowsPerSecond.
+	// If not set, one second's worth of rows is allowed.
+	Burst int `yaml:"burst"`
+}
+
+// Validate checks constraints in the supplied write limit configuration and returns an error if they are violated.
+func (c *WriteLimitConfig) Validate() error {
+	if c.RowsPerSecond < 0 {
+		return errors.New("write_limit rows_per_second must not be negative")
+	}
+
+	if c.Burst < 0 {
+		return errors.New("write_limit burst must not be negative")
+	}
+
+	return nil
+}
+
+// WriteLimiter is a token bucket shared by all writers, so that resynchronizations don't starve
+// other applications using the same database server. A nil WriteLimiter doesn't limit anything.
+type WriteLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewWriteLimiter returns a new WriteLimiter from the given configuration, or nil if the limit is disabled.
+func NewWriteLimiter(c WriteLimitConfig) *WriteLimiter {
+	if c.RowsPerSecond == 0 {
+		return nil
+	}
+
+	burst := c.Burst
+	if burst == 0 {
+		burst = max(int(c.RowsPerSecond), 1)
+	}
+
+	return &WriteLimiter{limiter: rate.NewLimiter(rate.Limit(c.RowsPerSecond), burst)}
+}
+
+// Wait blocks until the given number of rows may be written or ctx is done.
+// Numbers of rows exceeding the burst are waited for in portions.
+func (l *WriteLimiter) Wait(ctx context.Context, rows int) error {
+	if l == nil {
+		return nil
+	}
+
+	for rows > 0 {
+		n := min(rows, l.limiter.Burst())
+		if err := l.limiter.WaitN(ctx, n); err != nil {
+			return errors.WithStack(err)
+		}
+
+		rows -= n
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package debug
+
+import (
+	"github.com/pkg/errors"
+	"net"
+)
+
+// Config defines the configuration of the debug HTTP server.
+type Config struct {
+	Listen string `yaml:"listen"`
+}
+
+// Validate checks constraints in the supplied debug configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		return errors.Wrap(err, "invalid debug listen address")
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package debug
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	kcache "k8s.io/client-go/tools/cache"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+)
+
+// Server serves pprof profiles, including goroutine dumps, and informer cache statistics via HTTP.
+// All methods are no-ops on a nil Server, so that it can be passed around unconditionally.
+type Server struct {
+	listen string
+
+	mu     sync.Mutex
+	caches map[string]kcache.Store
+}
+
+// NewServer creates a new Server listening on the given address.
+func NewServer(listen string) *Server {
+	return &Server{
+		listen: listen,
+		caches: make(map[string]kcache.Store),
+	}
+}
+
+// Track reports the number of objects cached by informer under the given name and returns informer.
+func (s *Server) Track(name string, informer kcache.SharedIndexInformer) kcache.SharedIndexInformer {
+	if s == nil {
+		return informer
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.caches[name] = informer.GetStore()
+
+	return informer
+}
+
+// ListenAndServe serves HTTP requests until an error occurs.
+func (s *Server) ListenAndServe() error {
+	if s == nil {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/caches", s.serveCaches)
+
+	server := &http.Server{
+		Addr:              s.listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return errors.Wrap(server.ListenAndServe(), "can't serve debug HTTP requests")
+}
+
+// serveCaches responds with the number of cached objects per tracked informer as JSON.
+func (s *Server) serveCaches(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	sizes := make(map[string]int, len(s.caches))
+	for name, store := range s.caches {
+		sizes[name] = len(store.ListKeys())
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sizes)
+}
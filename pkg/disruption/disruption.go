@@ -0,0 +1,213 @@
+// Package disruption simulates drains of the nodes of a cluster against its pod disruption budgets
+// and reports which drains would violate the availability of the workloads on them.
+package disruption
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kappsv1 "k8s.io/api/apps/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// interval is the interval in which drains are simulated.
+const interval = 5 * time.Minute
+
+// Analyzer simulates a drain of each node of a cluster and stores its risk to violate pod disruption budgets
+// in the node_drain_risk table, and the budgets covering pods on the node in the node_drain_risk_pdb table,
+// replacing the previous ones. Like kubectl drain, pods of daemon sets and mirror pods are not evicted.
+// Evicting a healthy pod consumes a disruption of each budget that covers it,
+// so that a drain violates a budget if more of its healthy pods are on the node than it currently allows to disrupt.
+// Pods are taken from the informers run by the nodes and pods controllers, whereas budgets are listed every time.
+type Analyzer struct {
+	clientset   kubernetes.Interface
+	db          *database.Database
+	clusterUuid types.UUID
+	namespaces  func(string) bool
+	log         logr.Logger
+}
+
+// NewAnalyzer creates a new Analyzer for the cluster with the given UUID.
+// Budgets of namespaces for which namespaces returns false are not considered.
+func NewAnalyzer(
+	clientset kubernetes.Interface, db *database.Database, clusterUuid types.UUID, namespaces func(string) bool,
+	log logr.Logger,
+) *Analyzer {
+	return &Analyzer{
+		clientset:   clientset,
+		db:          db,
+		clusterUuid: clusterUuid,
+		namespaces:  namespaces,
+		log:         log,
+	}
+}
+
+// Run simulates the drains of the nodes and pods cached by the given informers every five minutes
+// until ctx is canceled.
+func (a *Analyzer) Run(ctx context.Context, nodes, pods kcache.SharedIndexInformer) error {
+	if !kcache.WaitForCacheSync(ctx.Done(), nodes.HasSynced, pods.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	for {
+		if err := a.Analyze(ctx, nodes.GetStore(), pods.GetStore(), time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Analyze simulates the drains of the nodes and pods in the given stores and stores their risks at the given time.
+func (a *Analyzer) Analyze(ctx context.Context, nodes, pods kcache.Store, now time.Time) error {
+	a.log.V(1).Info("Simulating node drains")
+
+	pdbs, err := a.clientset.PolicyV1().PodDisruptionBudgets(kmetav1.NamespaceAll).List(ctx, kmetav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "can't list pod disruption budgets")
+	}
+
+	risks := make(map[string]*schemav1.NodeDrainRisk)
+	for _, obj := range nodes.List() {
+		node, ok := obj.(*kcorev1.Node)
+		if !ok {
+			continue
+		}
+
+		nodeUuid := schemav1.EnsureUUID(node.UID)
+		risks[node.Name] = &schemav1.NodeDrainRisk{
+			Uuid:        schemav1.NewUUID(nodeUuid, "drain-risk"),
+			NodeUuid:    nodeUuid,
+			ClusterUuid: a.clusterUuid,
+			Computed:    types.UnixMilli(now),
+		}
+	}
+
+	evicted := make(map[string][]*kcorev1.Pod)
+	for _, obj := range pods.List() {
+		if pod, ok := obj.(*kcorev1.Pod); ok && evictsHealthy(pod) {
+			evicted[pod.Namespace] = append(evicted[pod.Namespace], pod)
+		}
+	}
+
+	var covering []interface{}
+	for _, pdb := range pdbs.Items {
+		if !a.namespaces(pdb.Namespace) {
+			continue
+		}
+
+		// A budget without selector selects no pods.
+		selector, err := kmetav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			a.log.Error(err, "Can't parse selector of pod disruption budget", "pdb", pdb.Namespace+"/"+pdb.Name)
+
+			continue
+		}
+
+		covered := make(map[string]int32)
+		for _, pod := range evicted[pdb.Namespace] {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				covered[pod.Spec.NodeName]++
+			}
+		}
+
+		for name, count := range covered {
+			risk, ok := risks[name]
+			if !ok {
+				continue
+			}
+
+			excess := max(count-pdb.Status.DisruptionsAllowed, 0)
+
+			risk.Pods += count
+			if excess > 0 {
+				risk.ViolatingPods += excess
+				risk.ViolatedPdbs++
+			}
+
+			covering = append(covering, &schemav1.NodeDrainRiskPdb{
+				Uuid:               schemav1.NewUUID(risk.NodeUuid, pdb.Namespace+"/"+pdb.Name),
+				NodeUuid:           risk.NodeUuid,
+				ClusterUuid:        a.clusterUuid,
+				Namespace:          pdb.Namespace,
+				PdbName:            pdb.Name,
+				Pods:               count,
+				DisruptionsAllowed: pdb.Status.DisruptionsAllowed,
+				Excess:             excess,
+				Computed:           types.UnixMilli(now),
+			})
+		}
+	}
+
+	entities := make(chan interface{}, len(risks))
+	for _, risk := range risks {
+		if risk.Pods > 0 {
+			risk.Score = float64(risk.ViolatingPods) / float64(risk.Pods) * 100
+		}
+
+		entities <- risk
+	}
+	close(entities)
+
+	if err := a.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store node drain risks")
+	}
+
+	entities = make(chan interface{}, len(covering))
+	for _, pdb := range covering {
+		entities <- pdb
+	}
+	close(entities)
+
+	if err := a.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store pod disruption budgets of node drain risks")
+	}
+
+	// Risks of nodes that don't exist anymore and budgets that no longer cover pods on a node are removed.
+	for _, table := range []string{"node_drain_risk", "node_drain_risk_pdb"} {
+		if _, err := a.db.ExecContext(ctx, a.db.Rebind(
+			"DELETE FROM "+table+" WHERE cluster_uuid = ? AND computed < ?"), a.clusterUuid, now.UnixMilli(),
+		); err != nil {
+			return errors.Wrapf(err, "can't delete outdated %s", table)
+		}
+	}
+
+	return nil
+}
+
+// evictsHealthy returns whether the given pod is healthy and would be evicted by a drain of its node,
+// i.e. is scheduled, running and ready, and neither a pod of a daemon set nor a mirror pod.
+func evictsHealthy(pod *kcorev1.Pod) bool {
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil || pod.Status.Phase != kcorev1.PodRunning {
+		return false
+	}
+
+	if _, ok := pod.Annotations[kcorev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+
+	if owner := kmetav1.GetControllerOf(pod); owner != nil &&
+		owner.Kind == "DaemonSet" && owner.APIVersion == kappsv1.SchemeGroupVersion.String() {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == kcorev1.PodReady {
+			return condition.Status == kcorev1.ConditionTrue
+		}
+	}
+
+	return false
+}
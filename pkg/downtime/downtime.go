@@ -0,0 +1,145 @@
+package downtime
+
+import (
+	"github.com/pkg/errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Annotation puts the annotated namespace, workload, pod or node in downtime during the given interval,
+// formatted as <start>/<end> in RFC 3339, e.g. 2024-06-01T22:00:00Z/2024-06-02T02:00:00Z.
+// Downtimes of namespaces apply to all objects in them and downtimes of nodes also to their pods.
+const Annotation = "kubernetes.icinga.com/downtime"
+
+// DrainAnnotation flags a maintenance window of the annotated node, formatted like Annotation,
+// in which it is cordoned and drained. During the window, the node and its pods are in downtime,
+// and pods that can't be scheduled and replace pods evicted from the node are considered to be evicted by the drain.
+const DrainAnnotation = "kubernetes.icinga.com/drain"
+
+// Window defines a downtime during which problems are suppressed, while data is still synchronized.
+type Window struct {
+	Start   time.Time `yaml:"start"`
+	End     time.Time `yaml:"end"`
+	Comment string    `yaml:"comment"`
+	// Namespaces restricts the downtime to objects in the listed namespaces.
+	Namespaces []string `yaml:"namespaces"`
+	// Nodes restricts the downtime to the listed nodes and the pods running on them.
+	Nodes []string `yaml:"nodes"`
+}
+
+// Validate checks constraints in the supplied downtime window and returns an error if they are violated.
+func (w *Window) Validate() error {
+	if w.Start.IsZero() || w.End.IsZero() {
+		return errors.New("downtime start and end required")
+	}
+
+	if !w.End.After(w.Start) {
+		return errors.New("downtime end must be after start")
+	}
+
+	return nil
+}
+
+// Active returns whether t is within the window.
+func (w *Window) Active(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// matches returns whether the window applies to objects in the given namespace or on the given node.
+// Windows without namespaces and nodes apply to all objects.
+func (w *Window) matches(namespace, node string) bool {
+	if len(w.Namespaces) == 0 && len(w.Nodes) == 0 {
+		return true
+	}
+
+	return (namespace != "" && slices.Contains(w.Namespaces, namespace)) || (node != "" && slices.Contains(w.Nodes, node))
+}
+
+// ParseAnnotation parses the value of a downtime annotation.
+func ParseAnnotation(value string) (Window, error) {
+	start, end, ok := strings.Cut(value, "/")
+	if !ok {
+		return Window{}, errors.Errorf("invalid downtime %q, expected <start>/<end>", value)
+	}
+
+	var w Window
+	var err error
+
+	if w.Start, err = time.Parse(time.RFC3339, strings.TrimSpace(start)); err != nil {
+		return Window{}, errors.Wrapf(err, "invalid downtime start %q", start)
+	}
+
+	if w.End, err = time.Parse(time.RFC3339, strings.TrimSpace(end)); err != nil {
+		return Window{}, errors.Wrapf(err, "invalid downtime end %q", end)
+	}
+
+	return w, w.Validate()
+}
+
+// Downtimes determines whether objects are in downtime,
+// either due to a configured window or a downtime annotation.
+type Downtimes struct {
+	windows              []Window
+	namespaceAnnotations func(namespace string) map[string]string
+	nodeAnnotations      func(node string) map[string]string
+}
+
+// NewDowntimes creates a new Downtimes from the given windows.
+// namespaceAnnotations and nodeAnnotations return the annotations of namespaces and nodes, if known.
+func NewDowntimes(
+	windows []Window, namespaceAnnotations, nodeAnnotations func(string) map[string]string,
+) *Downtimes {
+	return &Downtimes{
+		windows:              windows,
+		namespaceAnnotations: namespaceAnnotations,
+		nodeAnnotations:      nodeAnnotations,
+	}
+}
+
+// In returns whether the object in the given namespace, which is empty for cluster-scoped objects,
+// with the given annotations is in downtime at t.
+// For pods, node is the node they are running on and for nodes, their name.
+func (d *Downtimes) In(namespace, node string, annotations map[string]string, t time.Time) bool {
+	for i := range d.windows {
+		if d.windows[i].Active(t) && d.windows[i].matches(namespace, node) {
+			return true
+		}
+	}
+
+	if annotated(annotations, Annotation, t) {
+		return true
+	}
+
+	if namespace != "" && d.namespaceAnnotations != nil && annotated(d.namespaceAnnotations(namespace), Annotation, t) {
+		return true
+	}
+
+	if node != "" && d.nodeAnnotations != nil {
+		nodeAnnotations := d.nodeAnnotations(node)
+		if annotated(nodeAnnotations, Annotation, t) || Draining(nodeAnnotations, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Draining returns whether the given annotations of a node contain a drain window active at t.
+// Invalid drain annotations are ignored.
+func Draining(annotations map[string]string, t time.Time) bool {
+	return annotated(annotations, DrainAnnotation, t)
+}
+
+// annotated returns whether the given annotations contain a window in the given annotation active at t.
+// Invalid annotations are ignored.
+func annotated(annotations map[string]string, annotation string, t time.Time) bool {
+	value, ok := annotations[annotation]
+	if !ok {
+		return false
+	}
+
+	w, err := ParseAnnotation(value)
+
+	return err == nil && w.Active(t)
+}
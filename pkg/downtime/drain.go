@@ -0,0 +1,105 @@
+package downtime
+
+import (
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	kcache "k8s.io/client-go/tools/cache"
+	"sync"
+	"time"
+)
+
+// Drains tracks pods removed from nodes within their drain window, so that their replacements,
+// which can't be scheduled until capacity is available again, are in downtime as well.
+// Replacements are identified by the controller of the removed pods, e.g. their replica set or stateful set.
+type Drains struct {
+	nodeAnnotations func(node string) map[string]string
+	mu              sync.Mutex
+	// controllers maps the UIDs of the controllers of removed pods to the end of the drain window.
+	controllers map[ktypes.UID]time.Time
+}
+
+// NewDrains creates a new Drains. nodeAnnotations returns the annotations of nodes, if known.
+func NewDrains(nodeAnnotations func(node string) map[string]string) *Drains {
+	return &Drains{
+		nodeAnnotations: nodeAnnotations,
+		controllers:     make(map[ktypes.UID]time.Time),
+	}
+}
+
+// Watch tracks the pods cached by informer that are deleted or marked for deletion, e.g. by an eviction.
+func (d *Drains) Watch(informer kcache.SharedIndexInformer) error {
+	_, err := informer.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, obj any) {
+			if pod, ok := obj.(*kcorev1.Pod); ok && pod.DeletionTimestamp != nil {
+				d.removed(pod, time.Now())
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(kcache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if pod, ok := obj.(*kcorev1.Pod); ok {
+				d.removed(pod, time.Now())
+			}
+		},
+	})
+
+	return errors.Wrap(err, "can't watch pods for drains")
+}
+
+// Evicted returns whether the given pod can't be scheduled and replaces a pod
+// removed from a node within its drain window, which is still active at t.
+func (d *Drains) Evicted(pod *kcorev1.Pod, t time.Time) bool {
+	if pod.Spec.NodeName != "" {
+		return false
+	}
+
+	controller := kmetav1.GetControllerOf(pod)
+	if controller == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	end, ok := d.controllers[controller.UID]
+	if ok && !t.Before(end) {
+		delete(d.controllers, controller.UID)
+
+		return false
+	}
+
+	return ok
+}
+
+// removed records the controller of the given pod removed at t if its node is within its drain window.
+func (d *Drains) removed(pod *kcorev1.Pod, t time.Time) {
+	if pod.Spec.NodeName == "" || d.nodeAnnotations == nil {
+		return
+	}
+
+	controller := kmetav1.GetControllerOf(pod)
+	if controller == nil {
+		return
+	}
+
+	value, ok := d.nodeAnnotations(pod.Spec.NodeName)[DrainAnnotation]
+	if !ok {
+		return
+	}
+
+	w, err := ParseAnnotation(value)
+	if err != nil || !w.Active(t) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if w.End.After(d.controllers[controller.UID]) {
+		d.controllers[controller.UID] = w.End
+	}
+}
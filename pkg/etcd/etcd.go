@@ -0,0 +1,258 @@
+// Package etcd records how many objects of each resource the API server stores in etcd and how large
+// its etcd databases are, so that growth, e.g. of leaked events, secrets of Helm releases or custom resources,
+// can be tracked per resource before etcd runs into its size limit.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"slices"
+	"strings"
+	"time"
+)
+
+// interval is the interval in which the inventory is recorded.
+const interval = time.Hour
+
+// Metrics of the API server that report the stored objects and the size of etcd,
+// by their current and their names before Kubernetes 1.21 and 1.28, respectively.
+var (
+	objectsMetrics = []string{"apiserver_storage_objects", "etcd_object_counts"}
+	sizeMetrics    = []string{"apiserver_storage_size_bytes", "etcd_db_total_size_in_bytes"}
+)
+
+// Inventory records the number of objects of each resource in the etcd_object_count table
+// and the size of the etcd databases in the etcd_size table every hour.
+// Both are read from the metrics of the API server, which requires permission to get the /metrics endpoint.
+// If its metrics can't be read, objects are counted by listing their metadata instead,
+// which requires permission to list them, and sizes are not recorded.
+type Inventory struct {
+	clientset   kubernetes.Interface
+	metadata    metadata.Interface
+	db          *database.Database
+	clusterUuid types.UUID
+	log         logr.Logger
+	forbidden   bool
+}
+
+// NewInventory creates a new Inventory for the cluster with the given UUID.
+func NewInventory(
+	clientset kubernetes.Interface,
+	metadataClient metadata.Interface,
+	db *database.Database,
+	clusterUuid types.UUID,
+	log logr.Logger,
+) *Inventory {
+	return &Inventory{
+		clientset:   clientset,
+		metadata:    metadataClient,
+		db:          db,
+		clusterUuid: clusterUuid,
+		log:         log,
+	}
+}
+
+// Run records the inventory every hour until ctx is canceled.
+func (i *Inventory) Run(ctx context.Context) error {
+	for {
+		if err := i.Record(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Record records the current number of objects per resource and the size of etcd at the given time.
+func (i *Inventory) Record(ctx context.Context, now time.Time) error {
+	i.log.V(1).Info("Recording etcd inventory")
+
+	families, err := i.metrics(ctx)
+	if err != nil {
+		return err
+	}
+
+	source := schemav1.EtcdObjectCountSourceMetrics
+	counts := gauges(families, objectsMetrics, "resource")
+	if len(counts) == 0 {
+		source = schemav1.EtcdObjectCountSourceList
+		if counts, err = i.list(ctx); err != nil {
+			return err
+		}
+	}
+
+	entities := make(chan interface{}, len(counts))
+	for resource, objects := range counts {
+		entities <- &schemav1.EtcdObjectCount{
+			Uuid:        schemav1.NewUUID(i.clusterUuid, fmt.Sprintf("%d/%s", now.UnixMilli(), resource)),
+			ClusterUuid: i.clusterUuid,
+			Timestamp:   types.UnixMilli(now),
+			Resource:    resource,
+			Objects:     objects,
+			Source:      source,
+		}
+	}
+	close(entities)
+
+	if err := i.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store etcd object counts")
+	}
+
+	// The current metric identifies etcd clusters by ID, the former one by endpoint.
+	sizes := gauges(families, sizeMetrics[:1], "storage_cluster_id")
+	if len(sizes) == 0 {
+		sizes = gauges(families, sizeMetrics[1:], "endpoint")
+	}
+
+	entities = make(chan interface{}, len(sizes))
+	for storageCluster, size := range sizes {
+		entities <- &schemav1.EtcdSize{
+			Uuid:           schemav1.NewUUID(i.clusterUuid, fmt.Sprintf("%d/%s", now.UnixMilli(), storageCluster)),
+			ClusterUuid:    i.clusterUuid,
+			Timestamp:      types.UnixMilli(now),
+			StorageCluster: storageCluster,
+			Size:           size,
+		}
+	}
+	close(entities)
+
+	return errors.Wrap(i.db.UpsertStreamed(ctx, entities), "can't store etcd sizes")
+}
+
+// metrics returns the metrics of the API server, or nothing if it isn't permitted to get them.
+func (i *Inventory) metrics(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	raw, err := i.clientset.Discovery().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		if kerrors.IsForbidden(err) {
+			if !i.forbidden {
+				i.log.Info("Not permitted to get API server metrics. Objects are counted by listing them")
+				i.forbidden = true
+			}
+
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "can't get API server metrics")
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(raw))
+
+	return families, errors.Wrap(err, "can't parse API server metrics")
+}
+
+// list counts the objects of all resources that can be listed by listing their metadata,
+// mostly in a single request per resource, as the API server reports how many objects remain.
+// Resources that can't be listed, e.g. because of missing permissions or unavailable aggregated APIs, are skipped.
+func (i *Inventory) list(ctx context.Context) (map[string]int64, error) {
+	preferred, err := discovery.ServerPreferredResources(i.clientset.Discovery())
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, errors.Wrap(err, "can't discover API resources")
+	}
+
+	counts := make(map[string]int64)
+	for _, list := range preferred {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") || !slices.Contains(r.Verbs, "list") {
+				continue
+			}
+
+			gr := schema.GroupResource{Group: gv.Group, Resource: r.Name}
+			objects, err := i.count(ctx, gv.WithResource(r.Name))
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+
+				i.log.V(1).Info("Can't count objects", "resource", gr.String(), "error", err)
+
+				continue
+			}
+
+			counts[gr.String()] = objects
+		}
+	}
+
+	return counts, nil
+}
+
+// count returns the number of objects of the given resource.
+// Objects are only paged through if the API server doesn't report the number of remaining objects.
+func (i *Inventory) count(ctx context.Context, gvr schema.GroupVersionResource) (int64, error) {
+	var objects int64
+	options := kmetav1.ListOptions{Limit: 1}
+	for {
+		l, err := i.metadata.Resource(gvr).List(ctx, options)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		objects += int64(len(l.Items))
+		if l.RemainingItemCount != nil {
+			return objects + *l.RemainingItemCount, nil
+		}
+
+		if options.Continue = l.Continue; options.Continue == "" {
+			return objects, nil
+		}
+
+		options.Limit = 500
+	}
+}
+
+// gauges returns the values of the first of the given gauge metrics that is present by the given label.
+// Negative values, which the API server reports for resources it couldn't count, are skipped.
+func gauges(families map[string]*dto.MetricFamily, names []string, label string) map[string]int64 {
+	values := make(map[string]int64)
+	for _, name := range names {
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			// Metrics are untyped if the API server doesn't expose their type.
+			value := m.GetGauge().GetValue()
+			if m.Untyped != nil {
+				value = m.GetUntyped().GetValue()
+			}
+
+			if value < 0 {
+				continue
+			}
+
+			for _, l := range m.GetLabel() {
+				if l.GetName() == label {
+					values[l.GetValue()] = int64(value)
+				}
+			}
+		}
+
+		return values
+	}
+
+	return values
+}
@@ -0,0 +1,162 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+	"slices"
+	"strings"
+)
+
+// Kind describes where the manifests of resources of a kind are stored in the database.
+type Kind struct {
+	Table      string
+	Namespaced bool
+}
+
+// Kinds contains all resource kinds whose manifests are stored and can be exported.
+var Kinds = map[string]Kind{
+	"namespace":         {Table: "namespace"},
+	"node":              {Table: "node"},
+	"persistent-volume": {Table: "persistent_volume"},
+	"pod":               {Table: "pod", Namespaced: true},
+	"deployment":        {Table: "deployment", Namespaced: true},
+	"replica-set":       {Table: "replica_set", Namespaced: true},
+	"stateful-set":      {Table: "stateful_set", Namespaced: true},
+	"daemon-set":        {Table: "daemon_set", Namespaced: true},
+	"job":               {Table: "job", Namespaced: true},
+	"cron-job":          {Table: "cron_job", Namespaced: true},
+	"hpa":               {Table: "hpa", Namespaced: true},
+	"service":           {Table: "service", Namespaced: true},
+	"ingress":           {Table: "ingress", Namespaced: true},
+	"pvc":               {Table: "pvc", Namespaced: true},
+	"event":             {Table: "event", Namespaced: true},
+}
+
+// KindNames returns the sorted names of all resource kinds that can be exported.
+func KindNames() []string {
+	names := make([]string, 0, len(Kinds))
+	for name := range Kinds {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// HasManifest returns whether the manifests of resources are stored in the given table.
+func HasManifest(table string) bool {
+	for _, kind := range Kinds {
+		if kind.Table == table {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Formats in which manifests can be exported.
+const (
+	Yaml = "yaml"
+	Json = "json"
+)
+
+// Options select the resource to export.
+type Options struct {
+	Kind      string
+	Cluster   string
+	Namespace string
+	Name      string
+	Format    string
+}
+
+// Export returns the manifest of the resource selected by opts in the requested format,
+// as last synchronized to the database.
+func Export(ctx context.Context, db *database.Database, opts Options) ([]byte, error) {
+	kind, ok := Kinds[opts.Kind]
+	if !ok {
+		return nil, errors.Errorf("unknown kind %q, must be one of %s", opts.Kind, strings.Join(KindNames(), ", "))
+	}
+
+	object := opts.Name
+	if kind.Namespaced {
+		object = opts.Namespace + "/" + opts.Name
+	}
+
+	query := fmt.Sprintf("SELECT r.yaml FROM %s r", kind.Table)
+	var where []string
+	var args []any
+
+	if opts.Cluster != "" {
+		query += " INNER JOIN cluster c ON c.uuid = r.cluster_uuid"
+		where = append(where, "c.name = ?")
+		args = append(args, opts.Cluster)
+	}
+	if kind.Namespaced {
+		where = append(where, "r.namespace = ?")
+		args = append(args, opts.Namespace)
+	}
+	where = append(where, "r.name = ?")
+	args = append(args, opts.Name)
+
+	query += " WHERE " + strings.Join(where, " AND ")
+
+	rows, err := db.QueryContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't query database")
+	}
+	defer func() { _ = rows.Close() }()
+
+	var manifest []byte
+	var found int
+	for rows.Next() {
+		if found++; found > 1 {
+			return nil, errors.Errorf("%s %s exists in multiple clusters, select one with --cluster", opts.Kind, object)
+		}
+
+		if err := rows.Scan(&manifest); err != nil {
+			return nil, errors.Wrap(err, "can't scan row")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't query database")
+	}
+
+	if found == 0 {
+		return nil, errors.Errorf("%s %s not found", opts.Kind, object)
+	}
+
+	if len(manifest) == 0 {
+		return nil, errors.Errorf("%s %s has no stored manifest", opts.Kind, object)
+	}
+
+	return Convert(manifest, opts.Format)
+}
+
+// Convert converts a manifest stored as YAML into the given format.
+func Convert(manifest []byte, format string) ([]byte, error) {
+	switch format {
+	case Yaml, "":
+		return manifest, nil
+	case Json:
+		j, err := yaml.YAMLToJSON(manifest)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't convert manifest to JSON")
+		}
+
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, j, "", "  "); err != nil {
+			return nil, errors.Wrap(err, "can't indent JSON manifest")
+		}
+		indented.WriteByte('\n')
+
+		return indented.Bytes(), nil
+	default:
+		return nil, errors.Errorf("unknown format %q, must be %s or %s", format, Yaml, Json)
+	}
+}
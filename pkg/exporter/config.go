@@ -0,0 +1,25 @@
+package exporter
+
+import (
+	"github.com/pkg/errors"
+	"net"
+)
+
+// Config defines the configuration of the Prometheus exporter.
+type Config struct {
+	// Listen is the address to listen on. If not set, the exporter is disabled.
+	Listen string `yaml:"listen"`
+}
+
+// Validate checks constraints in the supplied exporter configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		return errors.Wrap(err, "invalid exporter listen address")
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package exporter
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+	"time"
+)
+
+// timeout is the maximum duration of the queries of a single scrape.
+const timeout = 10 * time.Second
+
+// states maps the resource names of the API to the tables of resources with an Icinga state.
+var states = map[string]string{
+	"nodes":         "node",
+	"node-disks":    "node_disk",
+	"pods":          "pod",
+	"deployments":   "deployment",
+	"daemon-sets":   "daemon_set",
+	"replica-sets":  "replica_set",
+	"stateful-sets": "stateful_set",
+	"jobs":          "job",
+	"pvcs":          "pvc",
+
+	// Resources of Velero are only synchronized if it is installed.
+	"velero-backups":   "velero_backup",
+	"velero-restores":  "velero_restore",
+	"velero-schedules": "velero_schedule",
+
+	// Resources of GitOps tools are only synchronized if they are installed.
+	"argo-applications":   "argo_application",
+	"flux-kustomizations": "flux_kustomization",
+
+	// Resources of the Operator Lifecycle Manager are only synchronized if it is installed.
+	"olm-subscriptions":            "olm_subscription",
+	"olm-cluster-service-versions": "olm_cluster_service_version",
+}
+
+var (
+	podsDesc = prometheus.NewDesc(
+		"icinga_kubernetes_pods", "Number of pods by phase.",
+		[]string{"cluster", "namespace", "phase"}, nil)
+	objectsDesc = prometheus.NewDesc(
+		"icinga_kubernetes_objects", "Number of objects by Icinga state.",
+		[]string{"cluster", "resource", "state"}, nil)
+	problemsDesc = prometheus.NewDesc(
+		"icinga_kubernetes_problems_open", "Number of open problems by reason.",
+		[]string{"cluster", "namespace", "reason"}, nil)
+	heartbeatDesc = prometheus.NewDesc(
+		"icinga_kubernetes_heartbeat_age_seconds",
+		"Time since the latest heartbeat of the instances synchronizing the cluster.",
+		[]string{"cluster"}, nil)
+	lagDesc = prometheus.NewDesc(
+		"icinga_kubernetes_controller_lag_seconds", "Time since the last successful synchronization of the controller.",
+		[]string{"cluster", "controller"}, nil)
+	errorsDesc = prometheus.NewDesc(
+		"icinga_kubernetes_controller_errors", "Number of synchronization errors of the controller since its start.",
+		[]string{"cluster", "controller"}, nil)
+	eventLagDesc = prometheus.NewDesc(
+		"icinga_kubernetes_controller_event_lag_seconds", "Time since the controller last processed an event.",
+		[]string{"cluster", "controller"}, nil)
+	queueDepthDesc = prometheus.NewDesc(
+		"icinga_kubernetes_controller_queue_depth", "Number of events waiting to be processed by the controller.",
+		[]string{"cluster", "controller"}, nil)
+	queryLagDesc = prometheus.NewDesc(
+		"icinga_kubernetes_metric_query_lag_seconds",
+		"Time since the Prometheus metric category has last been queried successfully.",
+		[]string{"cluster", "kind", "category"}, nil)
+	etcdObjectsDesc = prometheus.NewDesc(
+		"icinga_kubernetes_etcd_objects", "Number of objects of the resource in etcd, as last recorded.",
+		[]string{"cluster", "resource"}, nil)
+	etcdSizeDesc = prometheus.NewDesc(
+		"icinga_kubernetes_etcd_size_bytes", "Size of the etcd database, as last recorded.",
+		[]string{"cluster", "storage_cluster"}, nil)
+)
+
+// Server serves the states and counts derived from the synchronized data as Prometheus metrics via HTTP
+// under /metrics, so that they can be consumed by existing alerting pipelines.
+// Metrics are queried from the database on each scrape.
+type Server struct {
+	config Config
+	db     *database.Database
+	log    logr.Logger
+}
+
+// NewServer creates a new Server for the given database.
+func NewServer(config Config, db *database.Database, log logr.Logger) *Server {
+	return &Server{
+		config: config,
+		db:     db,
+		log:    log,
+	}
+}
+
+// ListenAndServe serves HTTP requests until ctx is canceled or an error occurs.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(s); err != nil {
+		return errors.Wrap(err, "can't register exporter")
+	}
+
+	if err := registry.Register(metrics.Backlog); err != nil {
+		return errors.Wrap(err, "can't register metrics backlog")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: s}))
+
+	server := &http.Server{
+		Addr:              s.config.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "can't serve exporter HTTP requests")
+	}
+
+	return ctx.Err()
+}
+
+// Describe implements prometheus.Collector.
+func (s *Server) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		podsDesc, objectsDesc, problemsDesc, heartbeatDesc, lagDesc, errorsDesc, eventLagDesc, queueDepthDesc, queryLagDesc,
+		etcdObjectsDesc, etcdSizeDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+// If the database can't be queried, the scrape fails with the error.
+func (s *Server) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.collect(ctx, ch); err != nil {
+		ch <- prometheus.NewInvalidMetric(podsDesc, err)
+	}
+}
+
+// Println implements promhttp.Logger.
+func (s *Server) Println(v ...any) {
+	s.log.Info("Can't serve metrics", "error", v)
+}
+
+func (s *Server) collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var rows []struct {
+		Uuid []byte
+		Name sql.NullString
+	}
+	if err := s.db.SelectContext(ctx, &rows, "SELECT uuid, name FROM cluster"); err != nil {
+		return errors.Wrap(err, "can't query clusters")
+	}
+
+	// clusters maps binary cluster UUIDs to their names, or their UUIDs if they don't have a name.
+	clusters := make(map[string]string, len(rows))
+	for _, r := range rows {
+		name := r.Name.String
+		if name == "" {
+			id, _ := uuid.FromBytes(r.Uuid)
+			name = id.String()
+		}
+
+		clusters[string(r.Uuid)] = name
+	}
+
+	// gauges sends a gauge per row of the given query, which selects the cluster UUID, further labels and the value.
+	// Labels in prefix are added after the cluster, before the selected labels.
+	// Values are converted with convert, if set.
+	gauges := func(desc *prometheus.Desc, prefix []string, convert func(float64) float64, query string) error {
+		rows, err := s.db.QueryContext(ctx, query)
+		if err != nil {
+			return database.CantPerformQuery(err, query)
+		}
+		defer func() { _ = rows.Close() }()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for rows.Next() {
+			var clusterUuid []byte
+			var value float64
+			labels := make([]string, len(columns)-2)
+
+			dest := []any{&clusterUuid}
+			for i := range labels {
+				dest = append(dest, &labels[i])
+			}
+			dest = append(dest, &value)
+
+			if err := rows.Scan(dest...); err != nil {
+				return errors.Wrap(err, "can't scan row")
+			}
+
+			if convert != nil {
+				value = convert(value)
+			}
+
+			labels = append(append([]string{clusters[string(clusterUuid)]}, prefix...), labels...)
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+		}
+
+		return errors.Wrap(rows.Err(), "can't query metrics")
+	}
+
+	if err := gauges(podsDesc, nil, nil,
+		"SELECT cluster_uuid, namespace, phase, COUNT(*) FROM pod GROUP BY cluster_uuid, namespace, phase"); err != nil {
+		return err
+	}
+
+	for resource, table := range states {
+		if err := gauges(objectsDesc, []string{resource}, nil,
+			"SELECT cluster_uuid, icinga_state, COUNT(*) FROM "+table+" GROUP BY cluster_uuid, icinga_state"); err != nil {
+			return err
+		}
+	}
+
+	if err := gauges(problemsDesc, nil, nil,
+		"SELECT cluster_uuid, namespace, reason, COUNT(*) FROM problem WHERE cleared IS NULL"+
+			" GROUP BY cluster_uuid, namespace, reason"); err != nil {
+		return err
+	}
+
+	// Lags are computed relative to our clock, as timestamps are written by Icinga for Kubernetes, not the database.
+	now := time.Now()
+	since := func(ms float64) float64 {
+		return now.Sub(time.UnixMilli(int64(ms))).Seconds()
+	}
+
+	if err := gauges(heartbeatDesc, nil, since,
+		"SELECT cluster_uuid, MAX(heartbeat) FROM kubernetes_instance GROUP BY cluster_uuid"); err != nil {
+		return err
+	}
+
+	// If controllers are spread across multiple instances, the instance with the latest synchronization counts.
+	if err := gauges(lagDesc, nil, since,
+		"SELECT i.cluster_uuid, c.name, MAX(c.last_sync) FROM kubernetes_instance_controller c"+
+			" INNER JOIN kubernetes_instance i ON i.uuid = c.instance_uuid WHERE c.last_sync IS NOT NULL"+
+			" GROUP BY i.cluster_uuid, c.name"); err != nil {
+		return err
+	}
+
+	if err := gauges(errorsDesc, nil, nil,
+		"SELECT i.cluster_uuid, c.name, SUM(c.errors) FROM kubernetes_instance_controller c"+
+			" INNER JOIN kubernetes_instance i ON i.uuid = c.instance_uuid GROUP BY i.cluster_uuid, c.name"); err != nil {
+		return err
+	}
+
+	if err := gauges(eventLagDesc, nil, since,
+		"SELECT i.cluster_uuid, c.name, MAX(c.last_event) FROM kubernetes_instance_controller c"+
+			" INNER JOIN kubernetes_instance i ON i.uuid = c.instance_uuid WHERE c.last_event IS NOT NULL"+
+			" GROUP BY i.cluster_uuid, c.name"); err != nil {
+		return err
+	}
+
+	if err := gauges(queueDepthDesc, nil, nil,
+		"SELECT i.cluster_uuid, c.name, SUM(c.queue_depth) FROM kubernetes_instance_controller c"+
+			" INNER JOIN kubernetes_instance i ON i.uuid = c.instance_uuid GROUP BY i.cluster_uuid, c.name"); err != nil {
+		return err
+	}
+
+	if err := gauges(queryLagDesc, nil, since,
+		"SELECT i.cluster_uuid, m.kind, m.category, MAX(m.last_query) FROM kubernetes_instance_metric m"+
+			" INNER JOIN kubernetes_instance i ON i.uuid = m.instance_uuid GROUP BY i.cluster_uuid, m.kind, m.category",
+	); err != nil {
+		return err
+	}
+
+	// Only the latest recording of the etcd inventory of each cluster is reported.
+	if err := gauges(etcdObjectsDesc, nil, nil,
+		"SELECT c.cluster_uuid, c.resource, c.objects FROM etcd_object_count c"+
+			" WHERE c.timestamp = (SELECT MAX(timestamp) FROM etcd_object_count WHERE cluster_uuid = c.cluster_uuid)",
+	); err != nil {
+		return err
+	}
+
+	return gauges(etcdSizeDesc, nil, nil,
+		"SELECT s.cluster_uuid, s.storage_cluster, s.size FROM etcd_size s"+
+			" WHERE s.timestamp = (SELECT MAX(timestamp) FROM etcd_size WHERE cluster_uuid = s.cluster_uuid)")
+}
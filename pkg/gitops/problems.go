@@ -0,0 +1,112 @@
+// Package gitops raises and clears problems of the applications of GitOps tools, i.e. Argo CD applications
+// and Flux kustomizations, so that drifted and unhealthy applications show up like other problems.
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"sync"
+	"time"
+)
+
+// Problems maintains the problems of the applications of one type in the gitops_problem table.
+// Its callbacks are used as upsert and delete callbacks of the synchronization of the applications.
+// An application has at most one open problem, which is replaced once its reason changes.
+type Problems struct {
+	clusterUuid  types.UUID
+	resourceType string
+	mu           sync.Mutex
+	problems     *problem.Tracker[types.UUID, *schemav1.GitopsProblem]
+}
+
+// NewProblems creates a new Problems for the applications of the given type, e.g. argo_application,
+// of the cluster with the given UUID.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewProblems(
+	db *database.Database, clusterUuid types.UUID, resourceType string, notify func(*schemav1.GitopsProblem),
+) *Problems {
+	return &Problems{
+		clusterUuid:  clusterUuid,
+		resourceType: resourceType,
+		problems: problem.NewTracker(
+			db,
+			"GitOps problem",
+			func(p *schemav1.GitopsProblem) types.UUID { return p.ResourceUuid },
+			func(p *schemav1.GitopsProblem) []any { return []any{"application", p.Namespace + "/" + p.Name} },
+			notify,
+			logr.Discard()),
+	}
+}
+
+// Upserted raises and clears the problems of the upserted applications.
+func (p *Problems) Upserted(ctx context.Context, bulk []any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.problems.Load(
+		ctx, "cluster_uuid = ? AND resource_type = ?", p.clusterUuid, p.resourceType,
+	); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, entity := range bulk {
+		app, ok := entity.(schemav1.GitopsApp)
+		if !ok {
+			continue
+		}
+
+		if err := p.update(ctx, app, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deleted clears the problems of the deleted applications.
+func (p *Problems) Deleted(ctx context.Context, ids []any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.problems.Load(
+		ctx, "cluster_uuid = ? AND resource_type = ?", p.clusterUuid, p.resourceType,
+	); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		if err := p.problems.Clear(ctx, id.(types.UUID), now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// update raises or clears the problem of the given application. Must be called with mu held.
+// An open problem with a different reason is cleared first.
+func (p *Problems) update(ctx context.Context, app schemav1.GitopsApp, now time.Time) error {
+	id := schemav1.EnsureUUID(app.GetUID())
+	reason, message := app.Problem()
+
+	return p.problems.Update(ctx, id, reason, nil, func() *schemav1.GitopsProblem {
+		return &schemav1.GitopsProblem{
+			Uuid:         schemav1.NewUUID(id, fmt.Sprintf("%s:%d", reason, now.UnixMilli())),
+			ClusterUuid:  p.clusterUuid,
+			ResourceType: p.resourceType,
+			ResourceUuid: id,
+			Namespace:    app.GetNamespace(),
+			Name:         app.GetName(),
+			Reason:       reason,
+			Message:      schemav1.NewNullableString(message),
+			Started:      types.UnixMilli(now),
+		}
+	}, now)
+}
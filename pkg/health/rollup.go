@@ -0,0 +1,272 @@
+// Package health rolls up the Icinga states of the resources of namespaces,
+// so that consumers can show an overview of namespaces without aggregating all resources.
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/com"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// key identifies a row of the namespace_health table of a cluster.
+type key struct {
+	resourceType string
+	namespace    string
+}
+
+// resourceState is the last known state of a resource in a namespace.
+type resourceState struct {
+	namespace string
+	state     schemav1.IcingaState
+}
+
+// Rollup maintains the health of namespaces in the namespace_health table, i.e. for each type of resource
+// the worst Icinga state and the number of resources per state, updated as the states of resources change.
+// Its callbacks are used as upsert and delete callbacks of the synchronization of namespaced resources
+// for which a state is evaluated.
+type Rollup struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	mu          sync.Mutex
+	// writeMu serializes writes, so that the health computed last is stored last.
+	writeMu sync.Mutex
+	states  map[string]map[types.UUID]resourceState
+	counts  map[key]*[schemav1.Critical + 1]int
+}
+
+// NewRollup creates a new Rollup for the cluster with the given UUID.
+func NewRollup(db *database.Database, clusterUuid types.UUID) *Rollup {
+	return &Rollup{
+		db:          db,
+		clusterUuid: clusterUuid,
+		states:      make(map[string]map[types.UUID]resourceState),
+		counts:      make(map[key]*[schemav1.Critical + 1]int),
+	}
+}
+
+// Load loads the states of the resources of the given type stored in the database
+// and replaces the health of namespaces for this type, which may be outdated.
+// Must be called before the synchronization of the resources starts.
+func (r *Rollup) Load(ctx context.Context, resourceType string) error {
+	rows, err := r.db.QueryContext(ctx, r.db.Rebind(fmt.Sprintf(
+		"SELECT uuid, namespace, icinga_state FROM %s WHERE cluster_uuid = ?", resourceType)), r.clusterUuid)
+	if err != nil {
+		return errors.Wrapf(err, "can't load %s states", resourceType)
+	}
+	defer func() { _ = rows.Close() }()
+
+	states := make(map[types.UUID]resourceState)
+	for rows.Next() {
+		var id types.UUID
+		var namespace, state string
+		if err := rows.Scan(&id.UUID, &namespace, &state); err != nil {
+			return errors.Wrapf(err, "can't load %s states", resourceType)
+		}
+
+		// Cluster-scoped resources, i.e. nodes, don't belong to any namespace.
+		if namespace == "" {
+			continue
+		}
+
+		s, _ := schemav1.ParseIcingaState(state)
+		states[id] = resourceState{namespace: namespace, state: s}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "can't load %s states", resourceType)
+	}
+
+	var changed []key
+	func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.states[resourceType] = make(map[types.UUID]resourceState)
+		for id, s := range states {
+			changed = append(changed, r.set(resourceType, id, s)...)
+		}
+	}()
+
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(
+		"DELETE FROM namespace_health WHERE cluster_uuid = ? AND resource_type = ?"), r.clusterUuid, resourceType,
+	); err != nil {
+		return errors.Wrap(err, "can't delete namespace health")
+	}
+
+	return r.write(ctx, changed)
+}
+
+// Upserted returns a callback that updates the health of the namespaces of the upserted resources of the given type.
+func (r *Rollup) Upserted(resourceType string) com.ProcessBulk[any] {
+	return func(ctx context.Context, bulk []any) error {
+		var changed []key
+		func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			for _, entity := range bulk {
+				resource, ok := entity.(schemav1.Stater)
+				if !ok || resource.GetNamespace() == "" {
+					continue
+				}
+
+				state, _ := resource.State()
+				changed = append(changed, r.set(resourceType, schemav1.EnsureUUID(resource.GetUID()), resourceState{
+					namespace: resource.GetNamespace(),
+					state:     state,
+				})...)
+			}
+		}()
+
+		return r.write(ctx, changed)
+	}
+}
+
+// Deleted returns a callback that updates the health of the namespaces of the deleted resources of the given type.
+func (r *Rollup) Deleted(resourceType string) com.ProcessBulk[any] {
+	return func(ctx context.Context, ids []any) error {
+		var changed []key
+		func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			for _, id := range ids {
+				if k, ok := r.remove(resourceType, id.(types.UUID)); ok {
+					changed = append(changed, k)
+				}
+			}
+		}()
+
+		return r.write(ctx, changed)
+	}
+}
+
+// set sets the state of the resource of the given type with the given ID
+// and returns the keys whose counts changed. Must be called with mu held.
+func (r *Rollup) set(resourceType string, id types.UUID, s resourceState) []key {
+	if r.states[resourceType] == nil {
+		r.states[resourceType] = make(map[types.UUID]resourceState)
+	}
+
+	previous, known := r.states[resourceType][id]
+	if known && previous == s {
+		return nil
+	}
+
+	var changed []key
+	if known {
+		k, _ := r.remove(resourceType, id)
+		changed = append(changed, k)
+	}
+
+	k := key{resourceType: resourceType, namespace: s.namespace}
+	if r.counts[k] == nil {
+		r.counts[k] = new([schemav1.Critical + 1]int)
+	}
+	r.counts[k][s.state]++
+	r.states[resourceType][id] = s
+
+	return append(changed, k)
+}
+
+// remove removes the resource of the given type with the given ID and returns the key whose counts changed,
+// if the resource was known. Must be called with mu held.
+func (r *Rollup) remove(resourceType string, id types.UUID) (key, bool) {
+	s, ok := r.states[resourceType][id]
+	if !ok {
+		return key{}, false
+	}
+
+	delete(r.states[resourceType], id)
+
+	k := key{resourceType: resourceType, namespace: s.namespace}
+	if counts := r.counts[k]; counts != nil {
+		counts[s.state]--
+	}
+
+	return k, true
+}
+
+// write stores the health of the namespaces with the given keys, or deletes it if they don't contain resources anymore.
+func (r *Rollup) write(ctx context.Context, keys []key) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	now := types.UnixMilli(time.Now())
+
+	var upserts []*schemav1.NamespaceHealth
+	var deletes []key
+	func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		seen := make(map[key]struct{}, len(keys))
+		for _, k := range keys {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+
+			counts := r.counts[k]
+			var total int
+			if counts != nil {
+				for _, n := range counts {
+					total += n
+				}
+			}
+
+			if total == 0 {
+				delete(r.counts, k)
+				deletes = append(deletes, k)
+
+				continue
+			}
+
+			h := &schemav1.NamespaceHealth{
+				ClusterUuid:  r.clusterUuid,
+				Namespace:    k.namespace,
+				ResourceType: k.resourceType,
+				Ok:           counts[schemav1.Ok],
+				Pending:      counts[schemav1.Pending],
+				Unknown:      counts[schemav1.Unknown],
+				Warning:      counts[schemav1.Warning],
+				Critical:     counts[schemav1.Critical],
+				Updated:      now,
+			}
+			for state, n := range counts {
+				if n > 0 {
+					h.IcingaState = schemav1.IcingaState(state)
+				}
+			}
+
+			upserts = append(upserts, h)
+		}
+	}()
+
+	for _, h := range upserts {
+		stmt, _ := r.db.BuildUpsertStmt(h)
+		if _, err := r.db.NamedExecContext(ctx, stmt, h); err != nil {
+			return errors.Wrap(err, "can't store namespace health")
+		}
+	}
+
+	for _, k := range deletes {
+		if _, err := r.db.ExecContext(ctx, r.db.Rebind(
+			"DELETE FROM namespace_health WHERE cluster_uuid = ? AND namespace = ? AND resource_type = ?"),
+			r.clusterUuid, k.namespace, k.resourceType,
+		); err != nil {
+			return errors.Wrap(err, "can't delete namespace health")
+		}
+	}
+
+	return nil
+}
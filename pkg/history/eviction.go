@@ -0,0 +1,149 @@
+package history
+
+import (
+	"context"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	"sync"
+	"time"
+)
+
+// evictedReason is the status reason of pods evicted by the kubelet due to node pressure.
+const evictedReason = "Evicted"
+
+// disruptionKinds maps the reasons of the DisruptionTarget condition of pods to the kind of eviction.
+var disruptionKinds = map[string]string{
+	"TerminationByKubelet":   schemav1.EvictionNodePressure,
+	"PreemptionByScheduler":  schemav1.EvictionPreemption,
+	"EvictionByEvictionAPI":  schemav1.EvictionApi,
+	"DeletionByTaintManager": schemav1.EvictionTaint,
+	"DeletionByPodGC":        schemav1.EvictionPodGc,
+}
+
+// Evictions records evictions and preemptions of pods to the pod_eviction table, linked to the pod and its node,
+// so that disruptions due to capacity are distinguishable from failures of the pods themselves.
+// Evictions are derived from the DisruptionTarget condition of pods, which is set since Kubernetes 1.26,
+// and from the Evicted status reason set by the kubelet.
+// It is used as upsert and delete callback of the synchronization of pods.
+type Evictions struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	nodeUuid    func(name string) (types.UUID, bool)
+	mu          sync.Mutex
+	recorded    map[types.UUID]struct{}
+}
+
+// NewEvictions creates a new Evictions for the pods of the cluster with the given UUID.
+// nodeUuid returns the UUID of the node with the given name, if known.
+func NewEvictions(db *database.Database, clusterUuid types.UUID, nodeUuid func(name string) (types.UUID, bool)) *Evictions {
+	return &Evictions{
+		db:          db,
+		clusterUuid: clusterUuid,
+		nodeUuid:    nodeUuid,
+		recorded:    make(map[types.UUID]struct{}),
+	}
+}
+
+// Upserted records the evictions of the given upserted pods. Each pod is evicted at most once.
+func (e *Evictions) Upserted(ctx context.Context, bulk []any) error {
+	var evictions []*schemav1.PodEviction
+	func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		for _, entity := range bulk {
+			pod, ok := entity.(*schemav1.Pod)
+			if !ok {
+				continue
+			}
+
+			if _, ok := e.recorded[pod.Uuid]; ok {
+				continue
+			}
+
+			if eviction := e.eviction(pod); eviction != nil {
+				evictions = append(evictions, eviction)
+				e.recorded[pod.Uuid] = struct{}{}
+			}
+		}
+	}()
+
+	for _, eviction := range evictions {
+		stmt, _ := e.db.BuildUpsertStmt(eviction)
+		if _, err := e.db.NamedExecContext(ctx, stmt, eviction); err != nil {
+			return errors.Wrap(err, "can't insert pod eviction")
+		}
+	}
+
+	return nil
+}
+
+// Deleted forgets the pods with the given IDs.
+func (e *Evictions) Deleted(_ context.Context, ids []any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, id := range ids {
+		delete(e.recorded, id.(types.UUID))
+	}
+
+	return nil
+}
+
+// eviction returns the eviction of the given pod, or nil if it hasn't been evicted.
+// The eviction is identified by the pod, so that it is only stored once even across restarts.
+func (e *Evictions) eviction(pod *schemav1.Pod) *schemav1.PodEviction {
+	eviction := &schemav1.PodEviction{
+		Uuid:        schemav1.NewUUID(pod.Uuid, "eviction"),
+		ClusterUuid: e.clusterUuid,
+		PodUuid:     pod.Uuid,
+		Namespace:   pod.Namespace,
+		PodName:     pod.Name,
+		NodeName:    pod.NodeName,
+	}
+
+	var ready *schemav1.PodCondition
+	for i, c := range pod.Conditions {
+		switch kcorev1.PodConditionType(c.Type) {
+		case kcorev1.DisruptionTarget:
+			if kind, ok := disruptionKinds[c.Reason]; ok && c.Status == string(kcorev1.ConditionTrue) {
+				eviction.Kind = kind
+				eviction.Reason = c.Reason
+				eviction.Message = schemav1.NewNullableString(c.Message)
+				eviction.EventTime = c.LastTransition
+			}
+		case kcorev1.PodReady:
+			ready = &pod.Conditions[i]
+		}
+	}
+
+	// Before Kubernetes 1.26, only evictions due to node pressure are visible in the status of pods,
+	// as of when they became not ready.
+	if eviction.Kind == "" {
+		if pod.Phase != string(kcorev1.PodFailed) || pod.Reason.String != evictedReason {
+			return nil
+		}
+
+		eviction.Kind = schemav1.EvictionNodePressure
+		eviction.Reason = evictedReason
+		eviction.Message = pod.Message
+		if ready != nil {
+			eviction.EventTime = ready.LastTransition
+		}
+	}
+
+	if eviction.EventTime.Time().IsZero() {
+		eviction.EventTime = types.UnixMilli(time.Now())
+	}
+
+	if e.nodeUuid != nil && pod.NodeName.Valid {
+		if id, ok := e.nodeUuid(pod.NodeName.String); ok {
+			eviction.NodeUuid = id.UUID[:]
+		}
+	}
+
+	return eviction
+}
@@ -0,0 +1,216 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// FlappingConfig defines when resources are considered flapping.
+type FlappingConfig struct {
+	// Interval in which state changes are counted.
+	Interval time.Duration `yaml:"interval" default:"1h"`
+	// ThresholdHigh is the number of state changes within Interval from which on resources start flapping.
+	ThresholdHigh int `yaml:"threshold_high" default:"6"`
+	// ThresholdLow is the number of state changes within Interval below which resources stop flapping.
+	ThresholdLow int `yaml:"threshold_low" default:"3"`
+}
+
+// Validate checks constraints in the supplied flapping configuration and returns an error if they are violated.
+func (c *FlappingConfig) Validate() error {
+	if c.Interval <= 0 {
+		return errors.New("flapping interval must be positive")
+	}
+
+	if c.ThresholdLow < 1 || c.ThresholdHigh <= c.ThresholdLow {
+		return errors.New("flapping thresholds must be positive and threshold_high must be greater than threshold_low")
+	}
+
+	return nil
+}
+
+// Flapping detects resources whose state changes frequently, similar to the flapping detection of Icinga 2,
+// and records in the flapping_history table when they start and stop flapping.
+// Resources are flapping once they changed their state ThresholdHigh times within Interval
+// and stop flapping once they changed it less than ThresholdLow times.
+type Flapping struct {
+	config      FlappingConfig
+	db          *database.Database
+	clusterUuid types.UUID
+	mu          sync.Mutex
+	changes     map[types.UUID][]time.Time
+	flapping    map[types.UUID]*schemav1.FlappingHistory
+}
+
+// NewFlapping creates a new Flapping for the resources of the cluster with the given UUID.
+func NewFlapping(config FlappingConfig, db *database.Database, clusterUuid types.UUID) *Flapping {
+	return &Flapping{
+		config:      config,
+		db:          db,
+		clusterUuid: clusterUuid,
+		changes:     make(map[types.UUID][]time.Time),
+		flapping:    make(map[types.UUID]*schemav1.FlappingHistory),
+	}
+}
+
+// Load loads the resources that are flapping and all state changes within the interval,
+// so that flapping is detected across restarts. Must be called before state changes are recorded.
+func (f *Flapping) Load(ctx context.Context) error {
+	var flapping []*schemav1.FlappingHistory
+	if err := f.db.SelectContext(ctx, &flapping, f.db.Rebind(
+		f.db.BuildSelectStmt(&schemav1.FlappingHistory{}, &schemav1.FlappingHistory{})+
+			" WHERE cluster_uuid = ? AND end_time IS NULL"), f.clusterUuid); err != nil {
+		return errors.Wrap(err, "can't load flapping resources")
+	}
+
+	var changes []struct {
+		ResourceUuid types.UUID
+		EventTime    types.UnixMilli
+	}
+	if err := f.db.SelectContext(ctx, &changes, f.db.Rebind(
+		"SELECT resource_uuid, event_time FROM state_history WHERE cluster_uuid = ? AND event_time >= ?"+
+			" ORDER BY event_time"),
+		f.clusterUuid, time.Now().Add(-f.config.Interval).UnixMilli()); err != nil {
+		return errors.Wrap(err, "can't load state changes")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, h := range flapping {
+		f.flapping[h.ResourceUuid] = h
+	}
+
+	for _, c := range changes {
+		f.changes[c.ResourceUuid] = append(f.changes[c.ResourceUuid], c.EventTime.Time())
+	}
+
+	return nil
+}
+
+// Is returns whether the resource with the given ID is flapping.
+func (f *Flapping) Is(id types.UUID) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.flapping[id]
+
+	return ok
+}
+
+// Record records a state change of the resource of the given type with the given ID at t.
+func (f *Flapping) Record(ctx context.Context, resourceType string, id types.UUID, t time.Time) error {
+	f.mu.Lock()
+	f.changes[id] = append(f.changes[id], t)
+	changes := f.expire(id, t)
+	start := changes >= f.config.ThresholdHigh && f.flapping[id] == nil
+	f.mu.Unlock()
+
+	if !start {
+		return nil
+	}
+
+	h := &schemav1.FlappingHistory{
+		Uuid:         schemav1.NewUUID(id, fmt.Sprintf("flapping:%d", t.UnixMilli())),
+		ClusterUuid:  f.clusterUuid,
+		ResourceType: resourceType,
+		ResourceUuid: id,
+		StartTime:    types.UnixMilli(t),
+		StateChanges: changes,
+	}
+
+	stmt, _ := f.db.BuildUpsertStmt(h)
+	if _, err := f.db.NamedExecContext(ctx, stmt, h); err != nil {
+		return errors.Wrap(err, "can't insert flapping history")
+	}
+
+	f.mu.Lock()
+	f.flapping[id] = h
+	f.mu.Unlock()
+
+	return nil
+}
+
+// Forget ends flapping of the resource with the given ID, e.g. because it has been deleted.
+func (f *Flapping) Forget(ctx context.Context, id types.UUID) error {
+	f.mu.Lock()
+	h := f.flapping[id]
+	delete(f.flapping, id)
+	delete(f.changes, id)
+	f.mu.Unlock()
+
+	if h == nil {
+		return nil
+	}
+
+	return f.end(ctx, h)
+}
+
+// Run ends flapping of resources whose state hasn't changed often enough within the interval anymore,
+// until ctx is canceled.
+func (f *Flapping) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			var ended []*schemav1.FlappingHistory
+
+			f.mu.Lock()
+			for id := range f.changes {
+				if n := f.expire(id, now); n < f.config.ThresholdLow && f.flapping[id] != nil {
+					ended = append(ended, f.flapping[id])
+					delete(f.flapping, id)
+				}
+			}
+			// Resources may still be flapping after a restart without changes within the interval.
+			for id, h := range f.flapping {
+				if _, ok := f.changes[id]; !ok {
+					ended = append(ended, h)
+					delete(f.flapping, id)
+				}
+			}
+			f.mu.Unlock()
+
+			for _, h := range ended {
+				if err := f.end(ctx, h); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// expire removes the state changes of the resource with the given ID that are older than the interval before now
+// and returns the number of remaining ones. Must be called with mu held.
+func (f *Flapping) expire(id types.UUID, now time.Time) int {
+	changes := f.changes[id]
+
+	var i int
+	for i < len(changes) && !changes[i].After(now.Add(-f.config.Interval)) {
+		i++
+	}
+
+	if changes = changes[i:]; len(changes) > 0 {
+		f.changes[id] = changes
+	} else {
+		delete(f.changes, id)
+	}
+
+	return len(changes)
+}
+
+func (f *Flapping) end(ctx context.Context, h *schemav1.FlappingHistory) error {
+	_, err := f.db.ExecContext(ctx, f.db.Rebind("UPDATE flapping_history SET end_time = ? WHERE uuid = ?"),
+		types.UnixMilli(time.Now()), h.Uuid)
+
+	return errors.Wrap(err, "can't update flapping history")
+}
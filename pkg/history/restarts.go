@@ -0,0 +1,216 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// restartWindow is the time for which restarts are counted.
+const restartWindow = 24 * time.Hour
+
+// containerRestarts is the last known restart count of a container and its restarts within the restart window.
+type containerRestarts struct {
+	podUuid types.UUID
+	count   int32
+	times   []time.Time
+}
+
+// Restarts records restarts of containers, derived from the increase of their restart counts,
+// to the container_restart table and counts their restarts within the last hour and day,
+// so that restart rates are known without Prometheus and kube-state-metrics.
+// It is used as upsert and delete callback of the synchronization of pods.
+type Restarts struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	mu          sync.Mutex
+	containers  map[types.UUID]*containerRestarts
+}
+
+// NewRestarts creates a new Restarts for the containers of the cluster with the given UUID.
+func NewRestarts(db *database.Database, clusterUuid types.UUID) *Restarts {
+	return &Restarts{
+		db:          db,
+		clusterUuid: clusterUuid,
+		containers:  make(map[types.UUID]*containerRestarts),
+	}
+}
+
+// Load loads the restart counts stored in the database and the restarts within the last day,
+// so that restarts since the last run are recorded as well. Must be called before the synchronization starts.
+func (r *Restarts) Load(ctx context.Context) error {
+	var counts []struct {
+		Uuid         types.UUID
+		PodUuid      types.UUID
+		RestartCount int32
+	}
+	if err := r.db.SelectContext(ctx, &counts, r.db.Rebind(
+		"SELECT container.uuid, container.pod_uuid, container.restart_count FROM container"+
+			" INNER JOIN pod ON pod.uuid = container.pod_uuid WHERE pod.cluster_uuid = ?"), r.clusterUuid); err != nil {
+		return errors.Wrap(err, "can't load container restart counts")
+	}
+
+	var restarts []struct {
+		ContainerUuid types.UUID
+		EventTime     types.UnixMilli
+	}
+	if err := r.db.SelectContext(ctx, &restarts, r.db.Rebind(
+		"SELECT container_uuid, event_time FROM container_restart WHERE cluster_uuid = ? AND event_time >= ?"+
+			" ORDER BY event_time"),
+		r.clusterUuid, time.Now().Add(-restartWindow).UnixMilli()); err != nil {
+		return errors.Wrap(err, "can't load container restarts")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range counts {
+		r.containers[c.Uuid] = &containerRestarts{podUuid: c.PodUuid, count: c.RestartCount}
+	}
+
+	for _, restart := range restarts {
+		if c, ok := r.containers[restart.ContainerUuid]; ok {
+			c.times = append(c.times, restart.EventTime.Time())
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of restarts of the container with the given ID within the last hour and day,
+// given its current restart count and the time it was last terminated.
+// Restarts that haven't been recorded yet are counted as of the last termination.
+func (r *Restarts) Count(id types.UUID, restartCount int32, lastTermination time.Time) (hour, day int32) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var times []time.Time
+	var known int32
+	if c, ok := r.containers[id]; ok {
+		times = c.times
+		known = c.count
+	}
+
+	for _, t := range times {
+		if t.After(now.Add(-restartWindow)) {
+			day++
+
+			if t.After(now.Add(-time.Hour)) {
+				hour++
+			}
+		}
+	}
+
+	if unrecorded := restartCount - known; unrecorded > 0 {
+		if lastTermination.IsZero() {
+			lastTermination = now
+		}
+
+		if lastTermination.After(now.Add(-restartWindow)) {
+			day += unrecorded
+
+			if lastTermination.After(now.Add(-time.Hour)) {
+				hour += unrecorded
+			}
+		}
+	}
+
+	return
+}
+
+// Upserted records the restarts of the containers of the given upserted pods.
+// Multiple restarts between two synchronizations are all recorded as of the last termination,
+// which is the only one whose time, reason and exit code are known.
+func (r *Restarts) Upserted(ctx context.Context, bulk []any) error {
+	now := time.Now()
+
+	var restarts []*schemav1.ContainerRestart
+	func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for _, entity := range bulk {
+			pod, ok := entity.(*schemav1.Pod)
+			if !ok {
+				continue
+			}
+
+			for _, container := range pod.Containers {
+				c, ok := r.containers[container.Uuid]
+				if !ok {
+					c = &containerRestarts{podUuid: pod.Uuid}
+					r.containers[container.Uuid] = c
+				}
+
+				for n := c.count + 1; n <= container.RestartCount; n++ {
+					restart := &schemav1.ContainerRestart{
+						Uuid:          schemav1.NewUUID(container.Uuid, fmt.Sprintf("restart:%d", n)),
+						ClusterUuid:   r.clusterUuid,
+						ContainerUuid: container.Uuid,
+						PodUuid:       pod.Uuid,
+						RestartCount:  n,
+						EventTime:     types.UnixMilli(now),
+					}
+
+					if t := container.LastTermination; t != nil {
+						if !t.FinishedAt.IsZero() {
+							restart.EventTime = types.UnixMilli(t.FinishedAt.Time)
+						}
+
+						if n == container.RestartCount {
+							restart.Reason = schemav1.NewNullableString(t.Reason)
+							restart.ExitCode.Int32 = t.ExitCode
+							restart.ExitCode.Valid = true
+						}
+					}
+
+					restarts = append(restarts, restart)
+					c.times = append(c.times, restart.EventTime.Time())
+				}
+
+				c.count = container.RestartCount
+
+				var i int
+				for i < len(c.times) && !c.times[i].After(now.Add(-restartWindow)) {
+					i++
+				}
+				c.times = c.times[i:]
+			}
+		}
+	}()
+
+	for _, restart := range restarts {
+		stmt, _ := r.db.BuildUpsertStmt(restart)
+		if _, err := r.db.NamedExecContext(ctx, stmt, restart); err != nil {
+			return errors.Wrap(err, "can't insert container restart")
+		}
+	}
+
+	return nil
+}
+
+// Deleted forgets the containers of the pods with the given IDs.
+func (r *Restarts) Deleted(_ context.Context, ids []any) error {
+	deleted := make(map[types.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		deleted[id.(types.UUID)] = struct{}{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, c := range r.containers {
+		if _, ok := deleted[c.podUuid]; ok {
+			delete(r.containers, id)
+		}
+	}
+
+	return nil
+}
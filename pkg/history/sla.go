@@ -0,0 +1,173 @@
+package history
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// day is the period for which SLAs are computed.
+const day = 24 * time.Hour
+
+// Sla computes the daily availability of the deployments of a cluster from their state history
+// and stores it in the deployment_sla table.
+// Deployments are available while they are ok, i.e. all their desired replicas are available,
+// and while they are in downtime. Pending time isn't taken into account.
+type Sla struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	log         logr.Logger
+}
+
+// NewSla creates a new Sla for the deployments of the cluster with the given UUID.
+func NewSla(db *database.Database, clusterUuid types.UUID, log logr.Logger) *Sla {
+	return &Sla{
+		db:          db,
+		clusterUuid: clusterUuid,
+		log:         log,
+	}
+}
+
+// Run computes the SLAs of all days that have passed since the last computed day, at most 30 days back
+// as older state history is deleted, and then of each day once it has passed, until ctx is canceled.
+func (s *Sla) Run(ctx context.Context) error {
+	for {
+		today := time.Now().UTC().Truncate(day)
+
+		var last int64
+		if err := s.db.QueryRowContext(
+			ctx, s.db.Rebind("SELECT COALESCE(MAX(day), 0) FROM deployment_sla WHERE cluster_uuid = ?"), s.clusterUuid,
+		).Scan(&last); err != nil {
+			return errors.Wrap(err, "can't query last computed SLA")
+		}
+
+		next := today.Add(-day)
+		if last > 0 {
+			next = time.UnixMilli(last).UTC().Add(day)
+		}
+		if oldest := today.Add(-30 * day); next.Before(oldest) {
+			next = oldest
+		}
+
+		for ; next.Before(today); next = next.Add(day) {
+			if err := s.Compute(ctx, next); err != nil {
+				return err
+			}
+		}
+
+		// Wait a minute longer, so that transitions at the end of the day have been recorded.
+		select {
+		case <-time.After(time.Until(today.Add(day + time.Minute))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Compute computes and stores the SLAs of all deployments of the cluster for the day starting at the given time.
+func (s *Sla) Compute(ctx context.Context, start time.Time) error {
+	start = start.UTC().Truncate(day)
+	end := start.Add(day)
+
+	s.log.V(1).Info("Computing SLAs", "day", start.Format(time.DateOnly))
+
+	type deployment struct {
+		Uuid        types.UUID
+		Created     types.UnixMilli
+		IcingaState string
+	}
+
+	var deployments []deployment
+	if err := s.db.SelectContext(ctx, &deployments, s.db.Rebind(
+		"SELECT uuid, created, icinga_state FROM deployment WHERE cluster_uuid = ? AND created < ?"),
+		s.clusterUuid, end.UnixMilli()); err != nil {
+		return errors.Wrap(err, "can't query deployments")
+	}
+
+	type transition struct {
+		ResourceUuid  types.UUID
+		EventTime     types.UnixMilli
+		PreviousState string
+		State         string
+		InDowntime    types.Bool
+	}
+
+	var rows []transition
+	if err := s.db.SelectContext(ctx, &rows, s.db.Rebind(
+		"SELECT resource_uuid, event_time, previous_state, state, in_downtime FROM state_history"+
+			" WHERE cluster_uuid = ? AND resource_type = 'deployment' AND event_time >= ? ORDER BY event_time"),
+		s.clusterUuid, start.UnixMilli()); err != nil {
+		return errors.Wrap(err, "can't query state history")
+	}
+
+	transitions := make(map[types.UUID][]transition)
+	for _, t := range rows {
+		transitions[t.ResourceUuid] = append(transitions[t.ResourceUuid], t)
+	}
+
+	slas := make(chan interface{}, len(deployments))
+	for _, d := range deployments {
+		windowStart := start
+		if d.Created.Time().After(start) {
+			windowStart = d.Created.Time()
+		}
+
+		// The state at the start of the window is the previous state of the first transition since then,
+		// or the current state if there hasn't been any.
+		history := transitions[d.Uuid]
+		for len(history) > 0 && history[0].EventTime.Time().Before(windowStart) {
+			history = history[1:]
+		}
+
+		state, _ := schemav1.ParseIcingaState(d.IcingaState)
+		if len(history) > 0 {
+			state, _ = schemav1.ParseIcingaState(history[0].PreviousState)
+		}
+
+		sla := &schemav1.DeploymentSla{
+			DeploymentUuid: d.Uuid,
+			ClusterUuid:    s.clusterUuid,
+			Day:            types.UnixMilli(start),
+		}
+
+		var inDowntime bool
+		since := windowStart
+		add := func(until time.Time) {
+			if state == schemav1.Pending {
+				return
+			}
+
+			duration := until.Sub(since).Milliseconds()
+			sla.Observed += duration
+			if state == schemav1.Ok || inDowntime {
+				sla.Available += duration
+			}
+		}
+
+		for _, t := range history {
+			if !t.EventTime.Time().Before(end) {
+				break
+			}
+
+			add(t.EventTime.Time())
+			state, _ = schemav1.ParseIcingaState(t.State)
+			inDowntime = t.InDowntime.Bool
+			since = t.EventTime.Time()
+		}
+		add(end)
+
+		if sla.Observed > 0 {
+			sla.Availability.Float64 = float64(sla.Available) / float64(sla.Observed) * 100
+			sla.Availability.Valid = true
+		}
+
+		slas <- sla
+	}
+	close(slas)
+
+	return errors.Wrap(s.db.UpsertStreamed(ctx, slas), "can't store SLAs")
+}
@@ -0,0 +1,157 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// StateHistory records transitions of the Icinga state of resources of a single type to the state_history table.
+// It is used as upsert and delete callback of the synchronization of the resources.
+type StateHistory struct {
+	db           *database.Database
+	clusterUuid  types.UUID
+	resourceType string
+	inDowntime   func(schemav1.Resource) bool
+	flapping     *Flapping
+	mu           sync.Mutex
+	states       map[types.UUID]schemav1.IcingaState
+}
+
+// NewStateHistory creates a new StateHistory for resources of the same type as resource.
+// Transitions of resources for which inDowntime, if set, returns true are marked as in downtime.
+// Transitions are also recorded to flapping, if set, to detect resources whose state changes frequently.
+func NewStateHistory(
+	db *database.Database,
+	clusterUuid types.UUID,
+	resource schemav1.Stater,
+	inDowntime func(schemav1.Resource) bool,
+	flapping *Flapping,
+) *StateHistory {
+	return &StateHistory{
+		db:           db,
+		clusterUuid:  clusterUuid,
+		resourceType: database.TableName(resource),
+		inDowntime:   inDowntime,
+		flapping:     flapping,
+		states:       make(map[types.UUID]schemav1.IcingaState),
+	}
+}
+
+// Load loads the states stored in the database, so that transitions since the last run are recorded as well.
+// Must be called before the synchronization starts.
+func (h *StateHistory) Load(ctx context.Context) error {
+	rows, err := h.db.QueryContext(ctx, h.db.Rebind(fmt.Sprintf(
+		"SELECT uuid, icinga_state FROM %s WHERE cluster_uuid = ?", h.resourceType)), h.clusterUuid)
+	if err != nil {
+		return errors.Wrapf(err, "can't load %s states", h.resourceType)
+	}
+	defer func() { _ = rows.Close() }()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for rows.Next() {
+		var id types.UUID
+		var state string
+		if err := rows.Scan(&id.UUID, &state); err != nil {
+			return errors.Wrapf(err, "can't load %s states", h.resourceType)
+		}
+
+		h.states[id], _ = schemav1.ParseIcingaState(state)
+	}
+
+	return errors.Wrapf(rows.Err(), "can't load %s states", h.resourceType)
+}
+
+// Upserted records the state transitions of the given upserted resources.
+// New resources are only recorded if they are not ok, as a transition from pending.
+func (h *StateHistory) Upserted(ctx context.Context, bulk []any) error {
+	now := types.UnixMilli(time.Now())
+
+	var transitions []schemav1.StateHistory
+	func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		for _, entity := range bulk {
+			resource, ok := entity.(schemav1.Stater)
+			if !ok {
+				continue
+			}
+
+			id := schemav1.EnsureUUID(resource.GetUID())
+			state, reason := resource.State()
+			previous, known := h.states[id]
+			h.states[id] = state
+
+			if !known {
+				if state == schemav1.Ok {
+					continue
+				}
+
+				previous = schemav1.Pending
+			} else if previous == state {
+				continue
+			}
+
+			transitions = append(transitions, schemav1.StateHistory{
+				Uuid:          schemav1.NewUUID(id, fmt.Sprintf("%d:%s", now.Time().UnixMilli(), state)),
+				ClusterUuid:   h.clusterUuid,
+				ResourceType:  h.resourceType,
+				ResourceUuid:  id,
+				EventTime:     now,
+				PreviousState: previous,
+				State:         state,
+				Reason:        schemav1.NewNullableString(reason),
+				InDowntime: types.Bool{
+					Bool:  h.inDowntime != nil && h.inDowntime(resource),
+					Valid: true,
+				},
+			})
+		}
+	}()
+
+	for _, transition := range transitions {
+		stmt, _ := h.db.BuildUpsertStmt(transition)
+		if _, err := h.db.NamedExecContext(ctx, stmt, transition); err != nil {
+			return errors.Wrap(err, "can't insert state history")
+		}
+
+		// Transitions from pending, which include the initial ones of new resources, don't count as state changes.
+		if h.flapping != nil && transition.PreviousState != schemav1.Pending {
+			if err := h.flapping.Record(ctx, h.resourceType, transition.ResourceUuid, now.Time()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Deleted forgets the states of the resources with the given IDs.
+func (h *StateHistory) Deleted(ctx context.Context, ids []any) error {
+	func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		for _, id := range ids {
+			delete(h.states, id.(types.UUID))
+		}
+	}()
+
+	if h.flapping != nil {
+		for _, id := range ids {
+			if err := h.flapping.Forget(ctx, id.(types.UUID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
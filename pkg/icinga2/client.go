@@ -0,0 +1,119 @@
+package icinga2
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client manages objects via the Icinga 2 API.
+type Client struct {
+	config *Config
+	http   *http.Client
+}
+
+// NewClient creates a new Client from the given configuration.
+func NewClient(c *Config) (*Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.Insecure}
+
+	if c.Ca != "" {
+		ca, err := os.ReadFile(c.Ca)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read icinga2 CA certificate")
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("can't parse icinga2 CA certificate %s", c.Ca)
+		}
+	}
+
+	return &Client{
+		config: c,
+		http: &http.Client{
+			Timeout:   time.Minute,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Upsert updates the attributes of the object of the given type, e.g. hosts, with the given name,
+// or creates it if it doesn't exist yet. Services are named host!service.
+func (c *Client) Upsert(ctx context.Context, typ, name string, attrs map[string]any) error {
+	status, err := c.do(ctx, http.MethodPost, typ, name, nil, map[string]any{"attrs": attrs})
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusNotFound {
+		return nil
+	}
+
+	_, err = c.do(ctx, http.MethodPut, typ, name, nil, map[string]any{"attrs": attrs})
+
+	return err
+}
+
+// Delete deletes the object of the given type with the given name, including dependent objects.
+// Objects that don't exist are ignored.
+func (c *Client) Delete(ctx context.Context, typ, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, typ, name, url.Values{"cascade": {"1"}}, nil)
+
+	return err
+}
+
+// do sends the given request and returns its status code. 404 is not considered an error.
+func (c *Client) do(ctx context.Context, method, typ, name string, query url.Values, body any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, errors.Wrap(err, "can't marshal request")
+		}
+
+		reader = bytes.NewReader(b)
+	}
+
+	u := fmt.Sprintf("%s/v1/objects/%s/%s", strings.TrimSuffix(c.config.Url, "/"), typ, url.PathEscape(name))
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't create request")
+	}
+
+	req.SetBasicAuth(c.config.Username, c.config.Password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't %s %s %s", method, typ, name)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusNotFound {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+		return res.StatusCode, errors.Errorf(
+			"can't %s %s %s: %s: %s", method, typ, name, res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	return res.StatusCode, nil
+}
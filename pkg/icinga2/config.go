@@ -0,0 +1,51 @@
+package icinga2
+
+import (
+	"github.com/pkg/errors"
+	"net/url"
+	"slices"
+)
+
+// Workloads lists the names of the controllers whose objects can be registered as services.
+var Workloads = []string{"deployments", "daemon-sets", "stateful-sets"}
+
+// Config defines the connection to the Icinga 2 API and which objects are registered.
+type Config struct {
+	// Url of the Icinga 2 API, e.g. https://localhost:5665. If not set, registration is disabled.
+	Url      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Ca is the path to the CA certificate used to verify the Icinga 2 API.
+	Ca string `yaml:"ca"`
+	// Insecure disables the verification of the Icinga 2 API certificate.
+	Insecure bool `yaml:"insecure"`
+	// CheckCommand is the check command of all hosts and services, which runs the check subcommand.
+	CheckCommand string `yaml:"check_command" default:"icinga-kubernetes"`
+	// Workloads lists the controllers whose objects are registered as services of the cluster host.
+	Workloads []string `yaml:"workloads" default:"[\"deployments\", \"daemon-sets\", \"stateful-sets\"]"`
+}
+
+// Validate checks constraints in the supplied Icinga 2 configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Url == "" {
+		return nil
+	}
+
+	if u, err := url.Parse(c.Url); err != nil {
+		return errors.Wrap(err, "invalid icinga2 url")
+	} else if u.Scheme != "https" {
+		return errors.New("icinga2 url must use https")
+	}
+
+	if c.CheckCommand == "" {
+		return errors.New("icinga2 check_command missing")
+	}
+
+	for _, workload := range c.Workloads {
+		if !slices.Contains(Workloads, workload) {
+			return errors.Errorf("unknown icinga2 workload %q", workload)
+		}
+	}
+
+	return nil
+}
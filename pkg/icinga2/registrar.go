@@ -0,0 +1,232 @@
+package icinga2
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-kubernetes/pkg/backoff"
+	"github.com/icinga/icinga-kubernetes/pkg/retry"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"time"
+)
+
+// maxRetries is the number of times an object is retried before it is dropped.
+const maxRetries = 5
+
+// checkTypes maps the controllers whose objects can be registered to the types of the check subcommand.
+var checkTypes = map[string]string{
+	"nodes":         "node",
+	"deployments":   "deployment",
+	"daemon-sets":   "daemon-set",
+	"stateful-sets": "stateful-set",
+}
+
+// item identifies an object to register by the name of its controller and its key.
+type item struct {
+	controller string
+	key        string
+}
+
+// Registrar registers nodes as hosts and workloads as services of a host representing the cluster in Icinga 2.
+// Objects are registered whenever they are added or changed in the informers passed to Watch,
+// and deleted from Icinga 2 once they are deleted from Kubernetes or filtered out.
+type Registrar struct {
+	client    *Client
+	cluster   string
+	host      string
+	filter    func(kmetav1.Object) bool
+	informers map[string]cache.SharedIndexInformer
+	log       logr.Logger
+	queue     workqueue.RateLimitingInterface
+}
+
+// NewRegistrar creates a new Registrar for the cluster with the given name, which may be empty,
+// and UUID. Namespaced objects for which filter returns false are not registered.
+func NewRegistrar(
+	client *Client, cluster string, clusterUuid fmt.Stringer, filter func(kmetav1.Object) bool, log logr.Logger,
+) *Registrar {
+	host := cluster
+	if host == "" {
+		host = "kubernetes-" + clusterUuid.String()
+	}
+
+	return &Registrar{
+		client:    client,
+		cluster:   cluster,
+		host:      host,
+		filter:    filter,
+		informers: make(map[string]cache.SharedIndexInformer),
+		log:       log,
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+}
+
+// Watch registers the objects of the given informer, which belongs to the controller with the given name.
+// The informer is not started, as it is run by its controller.
+func (r *Registrar) Watch(controller string, informer cache.SharedIndexInformer) error {
+	if _, ok := checkTypes[controller]; !ok {
+		return errors.Errorf("can't register objects of controller %q", controller)
+	}
+
+	r.informers[controller] = informer
+
+	enqueue := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			r.log.Error(errors.WithStack(err), "Can't get key of object")
+
+			return
+		}
+
+		r.queue.Add(item{controller: controller, key: key})
+	}
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Registered attributes don't depend on the status of objects, which is checked by Icinga 2 itself.
+			// Only objects replacing placeholders from the database are registered, as they haven't been added.
+			if _, ok := oldObj.(schemav1.Resource); ok {
+				enqueue(newObj)
+			}
+		},
+		DeleteFunc: enqueue,
+	})
+
+	return err
+}
+
+// Run creates the cluster host and registers objects until ctx is canceled.
+func (r *Registrar) Run(ctx context.Context) error {
+	go func() {
+		defer runtime.HandleCrash()
+
+		<-ctx.Done()
+		r.queue.ShutDown()
+	}()
+
+	// Services can't be registered without the cluster host, so keep trying until Icinga 2 is available.
+	err := retry.WithBackoff(
+		ctx,
+		func(ctx context.Context) error {
+			return r.client.Upsert(ctx, "hosts", r.host, map[string]any{
+				"check_command": "dummy",
+				"display_name":  "Kubernetes cluster " + r.host,
+				"vars":          r.vars("", "", ""),
+			})
+		},
+		func(error) bool { return true },
+		backoff.NewExponentialWithJitter(time.Second, time.Minute),
+		retry.Settings{
+			OnError: func(_ time.Duration, _ uint64, err, lastErr error) {
+				if lastErr == nil || err.Error() != lastErr.Error() {
+					r.log.Error(err, "Can't register cluster host. Retrying")
+				}
+			},
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "can't register cluster host")
+	}
+
+	for {
+		obj, shutdown := r.queue.Get()
+		if shutdown {
+			return ctx.Err()
+		}
+
+		i := obj.(item)
+		if err := r.register(ctx, i); err != nil {
+			if r.queue.NumRequeues(i) < maxRetries {
+				r.log.Error(err, "Registering object failed. Retrying", "key", i.key)
+
+				r.queue.AddRateLimited(i)
+			} else {
+				r.log.Error(err, "Registering object failed. Giving up", "key", i.key)
+
+				r.queue.Forget(i)
+			}
+		} else {
+			r.queue.Forget(i)
+		}
+
+		r.queue.Done(i)
+	}
+}
+
+func (r *Registrar) register(ctx context.Context, i item) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(i.key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	typ := checkTypes[i.controller]
+
+	var kind, object string
+	var attrs map[string]any
+	if typ == "node" {
+		kind = "hosts"
+		object = name
+		if r.cluster != "" {
+			object = r.cluster + "-" + name
+		}
+
+		attrs = map[string]any{
+			"check_command": r.client.config.CheckCommand,
+			"display_name":  name,
+			"vars":          r.vars(typ, "", name),
+		}
+	} else {
+		kind = "services"
+		object = fmt.Sprintf("%s!%s-%s-%s", r.host, typ, namespace, name)
+		attrs = map[string]any{
+			"check_command": r.client.config.CheckCommand,
+			"display_name":  fmt.Sprintf("%s %s/%s", typ, namespace, name),
+			"vars":          r.vars(typ, namespace, name),
+		}
+	}
+
+	obj, exists, err := r.informers[i.controller].GetStore().GetByKey(i.key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Objects from the database that haven't been listed yet only exist as placeholders.
+	if _, placeholder := obj.(schemav1.Resource); exists && placeholder {
+		return nil
+	}
+
+	if !exists || (namespace != "" && r.filter != nil && !r.filter(obj.(kmetav1.Object))) {
+		r.log.V(1).Info("Deleting object", "type", kind, "name", object)
+
+		return r.client.Delete(ctx, kind, object)
+	}
+
+	r.log.V(1).Info("Registering object", "type", kind, "name", object)
+
+	return r.client.Upsert(ctx, kind, object, attrs)
+}
+
+func (r *Registrar) vars(typ, namespace, name string) map[string]any {
+	vars := map[string]any{}
+
+	if typ != "" {
+		vars["kubernetes_type"] = typ
+	}
+	if r.cluster != "" {
+		vars["kubernetes_cluster"] = r.cluster
+	}
+	if namespace != "" {
+		vars["kubernetes_namespace"] = namespace
+	}
+	if name != "" {
+		vars["kubernetes_name"] = name
+	}
+
+	return vars
+}
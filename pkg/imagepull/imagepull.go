@@ -0,0 +1,254 @@
+// Package imagepull records the image pulls of pods with their durations and failures, derived from the events
+// of the kubelet and the states of containers, so that slow registries and broken registry credentials show up
+// per image and registry rather than only in the events of single pods.
+package imagepull
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// pulledRe matches the notes of Pulled events of the kubelet, e.g.
+	// Successfully pulled image "nginx" in 1.2s (3.4s including waiting). Image size: 1234 bytes.
+	// Older kubelets report neither the time including waiting nor the size.
+	pulledRe = regexp.MustCompile(`^Successfully pulled image "([^"]+)" in (\S+?)(?: \(\S+ including waiting\))?\.?(?: Image size: (\d+) bytes\.)?$`)
+	// failedRe matches the notes of Failed events of the kubelet for pulls, e.g.
+	// Failed to pull image "nginx": rpc error: code = NotFound desc = ...
+	failedRe = regexp.MustCompile(`^Failed to pull image "([^"]+)": (.*)$`)
+)
+
+// Pulls records image pulls to the image_pull table, with one row for the successful and one for the failed pulls
+// of each image of a pod. Its callbacks are used as upsert callbacks of the synchronization of events and pods:
+//   - Pulled events of pods become successful pulls with the duration and size reported by the kubelet.
+//   - Failed events of pods for pulls become failed pulls with the number of attempts and the error.
+//   - Containers waiting for their image because its pull failed become failed pulls, too,
+//     as events may be dropped or not synchronized, but don't override the attempts counted from events.
+type Pulls struct {
+	db          *database.Database
+	clusterUuid types.UUID
+}
+
+// NewPulls creates a new Pulls for the cluster with the given UUID.
+func NewPulls(db *database.Database, clusterUuid types.UUID) *Pulls {
+	return &Pulls{
+		db:          db,
+		clusterUuid: clusterUuid,
+	}
+}
+
+// Events records the image pulls of the upserted events.
+func (p *Pulls) Events(ctx context.Context, bulk []any) error {
+	for _, entity := range bulk {
+		event, ok := entity.(*schemav1.Event)
+		if !ok || event.ReferenceKind != "Pod" {
+			continue
+		}
+
+		pull := p.fromEvent(event)
+		if pull == nil {
+			continue
+		}
+
+		stmt, _ := p.db.BuildUpsertStmt(pull)
+		if _, err := p.db.NamedExecContext(ctx, stmt, pull); err != nil {
+			return errors.Wrap(err, "can't upsert image pull")
+		}
+	}
+
+	return nil
+}
+
+// Pods records the failed image pulls of the containers of the upserted pods.
+func (p *Pulls) Pods(ctx context.Context, bulk []any) error {
+	now := time.Now()
+	for _, entity := range bulk {
+		pod, ok := entity.(*schemav1.Pod)
+		if !ok {
+			continue
+		}
+
+		for _, c := range pod.Containers {
+			pull := p.fromContainer(pod, c, now)
+			if pull == nil {
+				continue
+			}
+
+			stmt, _ := p.db.BuildUpsertStmt(pull)
+			if _, err := p.db.NamedExecContext(ctx, stmt, pull); err != nil {
+				return errors.Wrap(err, "can't upsert image pull")
+			}
+		}
+	}
+
+	return nil
+}
+
+// fromEvent returns the image pull reported by the given event of a pod, or nil if it doesn't report one,
+// e.g. if the image was already present on the node.
+func (p *Pulls) fromEvent(event *schemav1.Event) *schemav1.ImagePull {
+	pull := &schemav1.ImagePull{
+		ClusterUuid: p.clusterUuid,
+		PodUuid:     event.ReferentUuid,
+		Namespace:   event.ReferenceNamespace.String,
+		PodName:     event.ReferenceName,
+		FirstSeen:   event.FirstSeen,
+		LastSeen:    event.LastSeen,
+	}
+
+	switch event.Reason {
+	case "Pulled":
+		m := pulledRe.FindStringSubmatch(event.Note)
+		if m == nil {
+			return nil
+		}
+
+		pull.Image = m[1]
+		pull.Succeeded = types.Bool{Bool: true, Valid: true}
+		if d, err := time.ParseDuration(m[2]); err == nil {
+			pull.Duration = sql.NullInt64{Int64: d.Milliseconds(), Valid: true}
+		}
+		if size, err := strconv.ParseInt(m[3], 10, 64); err == nil {
+			pull.Size = sql.NullInt64{Int64: size, Valid: true}
+		}
+	case "Failed":
+		m := failedRe.FindStringSubmatch(event.Note)
+		if m == nil {
+			return nil
+		}
+
+		pull.Image = m[1]
+		pull.Succeeded = types.Bool{Bool: false, Valid: true}
+		pull.Attempts = event.Count
+		pull.Failure = schemav1.NewNullableString(Classify(m[2]))
+		pull.Error = schemav1.NewNullableString(m[2])
+	default:
+		return nil
+	}
+
+	pull.Uuid = uuid(pull)
+	pull.Registry = Registry(pull.Image)
+
+	return pull
+}
+
+// fromContainer returns the failed image pull of the given container, or nil if it isn't waiting for its image
+// because its pull failed.
+func (p *Pulls) fromContainer(pod *schemav1.Pod, c *schemav1.Container, now time.Time) *containerFailure {
+	if c.State.String != "waiting" {
+		return nil
+	}
+
+	var waiting kcorev1.ContainerStateWaiting
+	if err := json.Unmarshal([]byte(c.StateDetails.String), &waiting); err != nil {
+		return nil
+	}
+
+	if waiting.Reason != "ErrImagePull" && waiting.Reason != "ImagePullBackOff" {
+		return nil
+	}
+
+	// Back-offs only carry the error of the failed pull in newer Kubernetes versions.
+	message := waiting.Message
+	if _, cause, ok := strings.Cut(message, ": "); ok && strings.HasPrefix(message, "Back-off pulling image") {
+		message = cause
+	} else if waiting.Reason == "ImagePullBackOff" {
+		message = ""
+	}
+
+	pull := schemav1.ImagePull{
+		ClusterUuid: p.clusterUuid,
+		PodUuid:     pod.Uuid,
+		Namespace:   pod.Namespace,
+		PodName:     pod.Name,
+		Image:       c.Image,
+		Registry:    Registry(c.Image),
+		Succeeded:   types.Bool{Bool: false, Valid: true},
+		Attempts:    1,
+		FirstSeen:   types.UnixMilli(now),
+		LastSeen:    types.UnixMilli(now),
+	}
+	if message != "" {
+		pull.Failure = schemav1.NewNullableString(Classify(message))
+		pull.Error = schemav1.NewNullableString(message)
+	}
+	pull.Uuid = uuid(&pull)
+
+	return &containerFailure{pull}
+}
+
+// containerFailure is a failed image pull derived from the state of a container,
+// which only updates the time it was last seen of a failed pull that is already recorded.
+type containerFailure struct {
+	schemav1.ImagePull
+}
+
+// TableName implements the database.TableNamer interface.
+func (containerFailure) TableName() string {
+	return "image_pull"
+}
+
+// Upsert implements the database.Upserter interface.
+func (f *containerFailure) Upsert() interface{} {
+	return struct{ LastSeen types.UnixMilli }{f.LastSeen}
+}
+
+// uuid returns the UUID of the successful or failed pulls of the image of the given pull for its pod.
+func uuid(pull *schemav1.ImagePull) types.UUID {
+	if pull.Succeeded.Bool {
+		return schemav1.NewUUID(pull.PodUuid, "Pulled:"+pull.Image)
+	}
+
+	return schemav1.NewUUID(pull.PodUuid, "Failed:"+pull.Image)
+}
+
+// Registry returns the host of the registry of the given image reference,
+// which is docker.io for references without host, as for the container runtimes.
+func Registry(image string) string {
+	host, _, ok := strings.Cut(image, "/")
+	if !ok || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return "docker.io"
+	}
+
+	return host
+}
+
+// Classify returns the class of failure of the given error of an image pull.
+func Classify(err string) string {
+	err = strings.ToLower(err)
+
+	contains := func(substrings ...string) bool {
+		for _, s := range substrings {
+			if strings.Contains(err, s) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch {
+	case contains("toomanyrequests", "too many requests", "rate limit"):
+		return schemav1.ImagePullRateLimited
+	case contains("unauthorized", "authentication required", "access denied", "denied:", "forbidden"):
+		return schemav1.ImagePullUnauthorized
+	case contains("not found", "manifest unknown", "name unknown"):
+		return schemav1.ImagePullNotFound
+	case contains("timeout", "timed out", "deadline exceeded"):
+		return schemav1.ImagePullTimeout
+	case contains("no such host", "connection refused", "connection reset", "network is unreachable", "x509", "tls"):
+		return schemav1.ImagePullNetwork
+	default:
+		return schemav1.ImagePullOther
+	}
+}
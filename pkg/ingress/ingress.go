@@ -0,0 +1,223 @@
+// Package ingress finds rules of ingresses that claim the same host and path as rules of other ingresses
+// with different backends. Ingress controllers merge such rules in their own, often undocumented order,
+// so that traffic silently goes to the wrong service, e.g. after an ingress has been copied to another namespace.
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	knetworkingv1 "k8s.io/api/networking/v1"
+	kcache "k8s.io/client-go/tools/cache"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// interval is the interval in which ingresses are checked for conflicts.
+	interval = 5 * time.Minute
+	// classAnnotation is the deprecated annotation that sets the ingress class of ingresses without ingressClassName.
+	classAnnotation = "kubernetes.io/ingress.class"
+)
+
+// claim is a path of a rule of an ingress with its backend.
+type claim struct {
+	ingress  *knetworkingv1.Ingress
+	ruleUuid types.UUID
+	host     string
+	path     string
+	pathType string
+	backend  string
+}
+
+// Analyzer checks the ingresses of a cluster for conflicts every five minutes and stores them
+// in the ingress_conflict table, replacing the previous ones. Rules conflict if they belong to different ingresses
+// of the same ingress class and have the same host, path and path type but different backends.
+// Ingresses without class are assumed to be of the same class, i.e. the default one.
+// Ingresses are taken from the informer run by the ingresses controller.
+type Analyzer struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	namespaces  func(string) bool
+	log         logr.Logger
+}
+
+// NewAnalyzer creates a new Analyzer for the cluster with the given UUID.
+// Ingresses of namespaces for which namespaces returns false are not checked.
+func NewAnalyzer(db *database.Database, clusterUuid types.UUID, namespaces func(string) bool, log logr.Logger) *Analyzer {
+	return &Analyzer{
+		db:          db,
+		clusterUuid: clusterUuid,
+		namespaces:  namespaces,
+		log:         log,
+	}
+}
+
+// Run checks the ingresses cached by the given informer for conflicts every five minutes until ctx is canceled.
+func (a *Analyzer) Run(ctx context.Context, ingresses kcache.SharedIndexInformer) error {
+	if !kcache.WaitForCacheSync(ctx.Done(), ingresses.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	for {
+		if err := a.Analyze(ctx, ingresses.GetStore(), time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Analyze checks the ingresses in the given store for conflicts and stores them at the given time.
+func (a *Analyzer) Analyze(ctx context.Context, ingresses kcache.Store, now time.Time) error {
+	a.log.V(1).Info("Checking ingresses for conflicts")
+
+	conflicts := a.conflicts(ingresses, now)
+
+	entities := make(chan interface{}, len(conflicts))
+	for _, c := range conflicts {
+		entities <- c
+	}
+	close(entities)
+
+	if err := a.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store ingress conflicts")
+	}
+
+	// Conflicts that have been resolved and conflicts of ingresses that don't exist anymore are removed.
+	_, err := a.db.ExecContext(ctx, a.db.Rebind(
+		"DELETE FROM ingress_conflict WHERE cluster_uuid = ? AND computed < ?"), a.clusterUuid, now.UnixMilli())
+
+	return errors.Wrap(err, "can't delete outdated ingress conflicts")
+}
+
+// conflicts returns the conflicts of the ingresses in the given store by ID, computed at the given time.
+func (a *Analyzer) conflicts(ingresses kcache.Store, now time.Time) map[types.UUID]*schemav1.IngressConflict {
+	// Claims by ingress class, host, path type and path.
+	claims := make(map[[4]string][]claim)
+	for _, obj := range ingresses.List() {
+		ingress, ok := obj.(*knetworkingv1.Ingress)
+		if !ok || !a.namespaces(ingress.Namespace) || ingress.DeletionTimestamp != nil {
+			continue
+		}
+
+		for _, c := range claimsOf(ingress) {
+			key := [4]string{class(ingress), c.host, c.pathType, c.path}
+			claims[key] = append(claims[key], c)
+		}
+	}
+
+	conflicts := make(map[types.UUID]*schemav1.IngressConflict)
+	for key, cs := range claims {
+		for _, c := range cs {
+			var conflicting []string
+			for _, other := range cs {
+				if other.ingress.UID != c.ingress.UID && other.backend != c.backend {
+					conflicting = append(conflicting, fmt.Sprintf(
+						"%s/%s (%s)", other.ingress.Namespace, other.ingress.Name, other.backend))
+				}
+			}
+
+			if len(conflicting) == 0 {
+				continue
+			}
+
+			slices.Sort(conflicting)
+
+			ingressUuid := schemav1.EnsureUUID(c.ingress.UID)
+			id := schemav1.NewUUID(ingressUuid, strings.Join([]string{c.pathType, c.host, c.path, c.backend}, "/"))
+			conflicts[id] = &schemav1.IngressConflict{
+				Uuid:                 id,
+				ClusterUuid:          a.clusterUuid,
+				IngressUuid:          ingressUuid,
+				IngressRuleUuid:      c.ruleUuid,
+				Namespace:            c.ingress.Namespace,
+				Name:                 c.ingress.Name,
+				IngressClass:         schemav1.NewNullableString(key[0]),
+				Host:                 c.host,
+				Path:                 c.path,
+				PathType:             c.pathType,
+				Backend:              c.backend,
+				ConflictingIngresses: strings.Join(slices.Compact(conflicting), ", "),
+				Computed:             types.UnixMilli(now),
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// claimsOf returns the claims of the rules of the given ingress.
+// Paths of the Prefix type are matched by path elements, so that a trailing slash doesn't make a difference.
+func claimsOf(ingress *knetworkingv1.Ingress) []claim {
+	ingressUuid := schemav1.EnsureUUID(ingress.UID)
+
+	var claims []claim
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		for _, p := range rule.HTTP.Paths {
+			c := claim{
+				ingress:  ingress,
+				host:     rule.Host,
+				path:     p.Path,
+				pathType: string(knetworkingv1.PathTypeImplementationSpecific),
+			}
+
+			if p.PathType != nil {
+				c.pathType = string(*p.PathType)
+			}
+
+			if c.pathType == string(knetworkingv1.PathTypePrefix) {
+				c.path = "/" + strings.Trim(c.path, "/")
+			}
+
+			// The UUIDs of rules are derived the same way as when ingresses are synchronized.
+			switch {
+			case p.Backend.Service != nil:
+				port := p.Backend.Service.Port.Name
+				if port == "" {
+					port = strconv.Itoa(int(p.Backend.Service.Port.Number))
+				}
+
+				c.ruleUuid = schemav1.NewUUID(ingressUuid, rule.Host+p.Path+p.Backend.Service.Name)
+				c.backend = ingress.Namespace + "/" + p.Backend.Service.Name + ":" + port
+			case p.Backend.Resource != nil:
+				kind := p.Backend.Resource.Kind
+				if group := p.Backend.Resource.APIGroup; group != nil && *group != "" {
+					kind += "." + *group
+				}
+
+				c.ruleUuid = schemav1.NewUUID(ingressUuid, rule.Host+p.Path+p.Backend.Resource.Name)
+				c.backend = ingress.Namespace + "/" + kind + "/" + p.Backend.Resource.Name
+			default:
+				continue
+			}
+
+			claims = append(claims, c)
+		}
+	}
+
+	return claims
+}
+
+// class returns the ingress class of the given ingress, or an empty string if it has none.
+func class(ingress *knetworkingv1.Ingress) string {
+	if ingress.Spec.IngressClassName != nil {
+		return *ingress.Spec.IngressClassName
+	}
+
+	return ingress.Annotations[classAnnotation]
+}
@@ -0,0 +1,127 @@
+package ingress
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	knetworkingv1 "k8s.io/api/networking/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	kcache "k8s.io/client-go/tools/cache"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestConflicts verifies that rules of different ingresses of the same class conflict
+// if they claim the same host, path and path type with different backends.
+func TestConflicts(t *testing.T) {
+	prefix := knetworkingv1.PathTypePrefix
+	exact := knetworkingv1.PathTypeExact
+	nginx := "nginx"
+	traefik := "traefik"
+
+	// ingress returns an ingress with a single rule routing host and path to the given service.
+	ingress := func(namespace, name string, class *string, host, path string, pathType *knetworkingv1.PathType,
+		service string) *knetworkingv1.Ingress {
+		return &knetworkingv1.Ingress{
+			ObjectMeta: kmetav1.ObjectMeta{Namespace: namespace, Name: name, UID: ktypes.UID(namespace + "/" + name)},
+			Spec: knetworkingv1.IngressSpec{
+				IngressClassName: class,
+				Rules: []knetworkingv1.IngressRule{{
+					Host: host,
+					IngressRuleValue: knetworkingv1.IngressRuleValue{HTTP: &knetworkingv1.HTTPIngressRuleValue{
+						Paths: []knetworkingv1.HTTPIngressPath{{
+							Path:     path,
+							PathType: pathType,
+							Backend: knetworkingv1.IngressBackend{Service: &knetworkingv1.IngressServiceBackend{
+								Name: service,
+								Port: knetworkingv1.ServiceBackendPort{Number: 80},
+							}},
+						}},
+					}},
+				}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		ingresses []*knetworkingv1.Ingress
+		conflicts []string
+	}{
+		{
+			name: "different backends conflict",
+			ingresses: []*knetworkingv1.Ingress{
+				ingress("a", "web", &nginx, "example.com", "/", &prefix, "web"),
+				ingress("b", "web", &nginx, "example.com", "/", &prefix, "web"),
+			},
+			conflicts: []string{"a/web", "b/web"},
+		},
+		{
+			name: "same backend doesn't conflict",
+			ingresses: []*knetworkingv1.Ingress{
+				ingress("a", "web", &nginx, "example.com", "/", &prefix, "web"),
+				ingress("a", "web-copy", &nginx, "example.com", "/", &prefix, "web"),
+			},
+		},
+		{
+			name: "trailing slash of prefix paths doesn't matter",
+			ingresses: []*knetworkingv1.Ingress{
+				ingress("a", "api", &nginx, "example.com", "/api/", &prefix, "api"),
+				ingress("a", "api-v2", &nginx, "example.com", "/api", &prefix, "api-v2"),
+			},
+			conflicts: []string{"a/api", "a/api-v2"},
+		},
+		{
+			name: "different path types don't conflict",
+			ingresses: []*knetworkingv1.Ingress{
+				ingress("a", "api", &nginx, "example.com", "/api", &prefix, "api"),
+				ingress("a", "api-v2", &nginx, "example.com", "/api", &exact, "api-v2"),
+			},
+		},
+		{
+			name: "different classes don't conflict",
+			ingresses: []*knetworkingv1.Ingress{
+				ingress("a", "web", &nginx, "example.com", "/", &prefix, "web"),
+				ingress("a", "web-v2", &traefik, "example.com", "/", &prefix, "web-v2"),
+			},
+		},
+		{
+			name: "different hosts don't conflict",
+			ingresses: []*knetworkingv1.Ingress{
+				ingress("a", "web", nil, "example.com", "/", &prefix, "web"),
+				ingress("a", "web-v2", nil, "example.org", "/", &prefix, "web-v2"),
+			},
+		},
+		{
+			name: "ingresses of excluded namespaces don't conflict",
+			ingresses: []*knetworkingv1.Ingress{
+				ingress("a", "web", nil, "example.com", "/", &prefix, "web"),
+				ingress("excluded", "web", nil, "example.com", "/", &prefix, "web-v2"),
+			},
+		},
+	}
+
+	a := NewAnalyzer(nil, types.UUID{}, func(namespace string) bool { return namespace != "excluded" }, logr.Discard())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := kcache.NewStore(kcache.MetaNamespaceKeyFunc)
+			for _, i := range tt.ingresses {
+				if err := store.Add(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var conflicts []string
+			for _, c := range a.conflicts(store, time.Now()) {
+				conflicts = append(conflicts, c.Namespace+"/"+c.Name)
+			}
+			slices.Sort(conflicts)
+
+			if !slices.Equal(conflicts, tt.conflicts) {
+				t.Errorf("conflicting ingresses are %v, expected %v", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
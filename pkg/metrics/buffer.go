@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"github.com/icinga/icinga-go-library/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"sync/atomic"
+)
+
+// Overflow policies define what happens if a buffer is full.
+const (
+	// Block delays queries until the buffered metrics have been written.
+	Block = "block"
+	// DropOldest discards the oldest buffered metric to make room for the new one.
+	DropOldest = "drop-oldest"
+)
+
+var (
+	backlogDesc = prometheus.NewDesc(
+		"icinga_kubernetes_metrics_backlog", "Number of Prometheus metrics waiting to be written to the database.",
+		[]string{"cluster", "kind"}, nil)
+	droppedDesc = prometheus.NewDesc(
+		"icinga_kubernetes_metrics_dropped_total",
+		"Number of Prometheus metrics dropped because the database couldn't keep up.",
+		[]string{"cluster", "kind"}, nil)
+)
+
+// Backlog is a prometheus.Collector reporting the backlog and dropped metrics of all buffers.
+var Backlog prometheus.Collector = &buffers
+
+// buffers holds all buffers in use.
+var buffers backlog
+
+// buffer decouples the query loops of a kind of metrics, e.g. nodes, from the database writer,
+// so that slow database writes don't delay queries until the buffer is full.
+type buffer struct {
+	ch       chan database.Entity
+	cluster  string
+	kind     string
+	overflow string
+	dropped  atomic.Uint64
+}
+
+// newBuffer returns a new registered buffer for the given kind of metrics according to the configuration.
+func (pms *PromMetricSync) newBuffer(kind string) *buffer {
+	b := &buffer{
+		ch:       make(chan database.Entity, pms.config.Buffer),
+		cluster:  pms.cluster,
+		kind:     kind,
+		overflow: pms.config.Overflow,
+	}
+	buffers.add(b)
+
+	return b
+}
+
+// send buffers the given entity. If the buffer is full, it waits for room or drops the oldest entity,
+// depending on the overflow policy.
+func (b *buffer) send(ctx context.Context, entity database.Entity) error {
+	for {
+		select {
+		case b.ch <- entity:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if b.overflow != DropOldest {
+			select {
+			case b.ch <- entity:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-b.ch:
+			b.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// close closes the buffer once no more entities are sent and unregisters it.
+func (b *buffer) close() {
+	close(b.ch)
+	buffers.remove(b)
+}
+
+// backlog collects the backlog and dropped metrics of its buffers.
+type backlog struct {
+	mu  sync.Mutex
+	all map[*buffer]struct{}
+}
+
+func (bl *backlog) add(b *buffer) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	if bl.all == nil {
+		bl.all = make(map[*buffer]struct{})
+	}
+	bl.all[b] = struct{}{}
+}
+
+func (bl *backlog) remove(b *buffer) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	delete(bl.all, b)
+}
+
+// Describe implements prometheus.Collector.
+func (bl *backlog) Describe(ch chan<- *prometheus.Desc) {
+	ch <- backlogDesc
+	ch <- droppedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (bl *backlog) Collect(ch chan<- prometheus.Metric) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	for b := range bl.all {
+		ch <- prometheus.MustNewConstMetric(backlogDesc, prometheus.GaugeValue, float64(len(b.ch)), b.cluster, b.kind)
+		ch <- prometheus.MustNewConstMetric(
+			droppedDesc, prometheus.CounterValue, float64(b.dropped.Load()), b.cluster, b.kind)
+	}
+}
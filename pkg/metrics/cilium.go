@@ -0,0 +1,33 @@
+package metrics
+
+// The health of the Cilium agents is queried from their metrics, which are scraped from the host network
+// and therefore identified by the address of the node they run on.
+// Endpoints are counted by their state, e.g. ready, and the rate of dropped packets is stored per reason
+// reported by Hubble, e.g. Policy denied.
+var promQueriesCiliumNode = []PromQuery{
+	{
+		"cilium.controllers.failing",
+		`sum by (instance) (cilium_controllers_failing)`,
+		"",
+	},
+	{
+		"cilium.unreachable.nodes",
+		`sum by (instance) (cilium_unreachable_nodes)`,
+		"",
+	},
+	{
+		"cilium.unreachable.health.endpoints",
+		`sum by (instance) (cilium_unreachable_health_endpoints)`,
+		"",
+	},
+	{
+		"cilium.endpoints",
+		`sum by (instance, endpoint_state) (cilium_endpoint_state)`,
+		"endpoint_state",
+	},
+	{
+		"cilium.dropped.packets",
+		`sum by (instance, reason) (rate(hubble_drop_total[2m]))`,
+		"reason",
+	},
+}
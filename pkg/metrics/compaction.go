@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRange is the maximum time a single row of a compacted metric covers,
+// so that its rows are still deleted by the retention in time and charts don't lack recent timestamps for long.
+const maxRange = time.Hour
+
+// compacted lists the categories of slowly changing metrics, i.e. requests, limits and counts,
+// whose consecutive samples with identical values are stored as a single row if compaction is enabled.
+var compacted = map[string]struct{}{
+	"node.count":                          {},
+	"namespace.count":                     {},
+	"pod.running":                         {},
+	"pod.pending":                         {},
+	"pod.failed":                          {},
+	"pod.succeeded":                       {},
+	"qos_by_class":                        {},
+	"cpu.request":                         {},
+	"cpu.request.percentage":              {},
+	"cpu.limit":                           {},
+	"cpu.limit.percentage":                {},
+	"memory.request":                      {},
+	"memory.request.percentage":           {},
+	"memory.limit":                        {},
+	"memory.limit.percentage":             {},
+	"cilium.controllers.failing":          {},
+	"cilium.unreachable.nodes":            {},
+	"cilium.unreachable.health.endpoints": {},
+	"cilium.endpoints":                    {},
+}
+
+// valueRange is the range of timestamps in which a series had the same value.
+type valueRange struct {
+	start int64
+	until int64
+	value float64
+}
+
+// compactor tracks the current range of each series of compacted metrics.
+type compactor struct {
+	mu     sync.Mutex
+	ranges map[string]*valueRange
+	// pruned is the latest timestamp at which ranges that ended long ago were pruned.
+	pruned int64
+}
+
+// compact returns the timestamp and until of the row of the given sample of the series identified by key:
+// If its value equals the one of the current range of the series, which doesn't exceed maxRange,
+// the range is extended to the sample, so that its row is updated instead of a new one being written.
+func (c *compactor) compact(key string, timestamp int64, value float64) (int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ranges == nil {
+		c.ranges = make(map[string]*valueRange)
+	}
+
+	// Ranges of series that have not been continued, e.g. of deleted pods, are pruned every maxRange.
+	if timestamp-c.pruned > maxRange.Milliseconds() {
+		for k, r := range c.ranges {
+			if timestamp-r.until > maxRange.Milliseconds() {
+				delete(c.ranges, k)
+			}
+		}
+
+		c.pruned = timestamp
+	}
+
+	r, ok := c.ranges[key]
+	if ok && timestamp < r.until {
+		// Samples older than the current range, e.g. of overlapping range queries, are stored as is.
+		return timestamp, timestamp
+	}
+
+	if ok && r.value == value && timestamp-r.start < maxRange.Milliseconds() {
+		r.until = timestamp
+
+		return r.start, r.until
+	}
+
+	c.ranges[key] = &valueRange{start: timestamp, until: timestamp, value: value}
+
+	return timestamp, timestamp
+}
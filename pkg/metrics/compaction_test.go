@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCompact verifies that consecutive samples with identical values extend the current range of their series
+// up to maxRange, while other values, older samples and other series start or keep rows of their own.
+func TestCompact(t *testing.T) {
+	minute := time.Minute.Milliseconds()
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+
+	var c compactor
+
+	tests := []struct {
+		name      string
+		key       string
+		timestamp int64
+		value     float64
+		start     int64
+		until     int64
+	}{
+		{name: "first sample starts range", key: "a", timestamp: start, value: 1, start: start, until: start},
+		{
+			name: "identical value extends range", key: "a", timestamp: start + minute, value: 1,
+			start: start, until: start + minute,
+		},
+		{
+			name: "other series starts its own range", key: "b", timestamp: start + minute, value: 1,
+			start: start + minute, until: start + minute,
+		},
+		{
+			name: "older sample is stored as is", key: "a", timestamp: start, value: 1,
+			start: start, until: start,
+		},
+		{
+			name: "changed value starts range", key: "a", timestamp: start + 2*minute, value: 2,
+			start: start + 2*minute, until: start + 2*minute,
+		},
+		{
+			name: "identical value extends new range", key: "a", timestamp: start + 3*minute, value: 2,
+			start: start + 2*minute, until: start + 3*minute,
+		},
+		{
+			name: "range doesn't exceed maxRange", key: "a", timestamp: start + 2*minute + maxRange.Milliseconds(),
+			value: 2, start: start + 2*minute + maxRange.Milliseconds(), until: start + 2*minute + maxRange.Milliseconds(),
+		},
+		{
+			name: "pruned series starts range", key: "b", timestamp: start + 5*minute + maxRange.Milliseconds(),
+			value: 1, start: start + 5*minute + maxRange.Milliseconds(), until: start + 5*minute + maxRange.Milliseconds(),
+		},
+	}
+
+	for _, tt := range tests {
+		if s, u := c.compact(tt.key, tt.timestamp, tt.value); s != tt.start || u != tt.until {
+			t.Errorf("%s: row covers %d to %d, expected %d to %d", tt.name, s-start, u-start, tt.start-start, tt.until-start)
+		}
+	}
+}
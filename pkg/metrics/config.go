@@ -1,11 +1,54 @@
 package metrics
 
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// defaultBuffer is the default number of metrics buffered per kind.
+const defaultBuffer = 1000
+
+// defaultInterval is the default interval in which metrics are queried.
+const defaultInterval = time.Minute
+
 // PrometheusConfig defines Prometheus configuration.
 type PrometheusConfig struct {
 	Url string `yaml:"url"`
+	// Buffer is the number of metrics of each kind, e.g. nodes, buffered while the database is slow.
+	Buffer int `yaml:"buffer" default:"1000"`
+	// Overflow defines what happens if a buffer is full, either Block or DropOldest.
+	Overflow string `yaml:"overflow" default:"block"`
+	// Interval in which each query is executed.
+	Interval time.Duration `yaml:"interval" default:"1m"`
+	// Compact stores consecutive samples of requests, limits and counts with the same value as a single row.
+	Compact bool `yaml:"compact"`
 }
 
 // Validate checks constraints in the supplied Prometheus configuration and returns an error if they are violated.
 func (c *PrometheusConfig) Validate() error {
+	if c.Buffer < 0 {
+		return errors.New("prometheus buffer must not be negative")
+	}
+
+	switch c.Overflow {
+	case "", Block, DropOldest:
+	default:
+		return errors.Errorf("prometheus overflow must be either %s or %s", Block, DropOldest)
+	}
+
+	if c.Interval < 0 {
+		return errors.New("prometheus interval must not be negative")
+	}
+
 	return nil
 }
+
+// IntervalOrDefault returns the configured interval, or the default interval if not set,
+// e.g. for clusters whose Prometheus configuration doesn't specify one.
+func (c *PrometheusConfig) IntervalOrDefault() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+
+	return defaultInterval
+}
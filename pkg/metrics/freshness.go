@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Freshness describes how up to date a metric category of a kind of metrics, e.g. nodes, is.
+type Freshness struct {
+	Kind     string
+	Category string
+	// LastQuery is the time the category has last been queried successfully.
+	LastQuery time.Time
+	// Backlog is the number of metrics of the kind waiting to be written to the database.
+	Backlog int
+}
+
+// freshness tracks the Freshness of the metric categories of a PromMetricSync.
+type freshness struct {
+	mu         sync.Mutex
+	categories map[[2]string]*Freshness
+	buffers    map[string]*buffer
+}
+
+// queried records that the given category of the metrics buffered in b has been queried successfully at t.
+func (f *freshness) queried(b *buffer, category string, t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.categories == nil {
+		f.categories = make(map[[2]string]*Freshness)
+		f.buffers = make(map[string]*buffer)
+	}
+
+	key := [2]string{b.kind, category}
+	if _, ok := f.categories[key]; !ok {
+		f.categories[key] = &Freshness{Kind: b.kind, Category: category}
+	}
+
+	f.categories[key].LastQuery = t
+	f.buffers[b.kind] = b
+}
+
+// Freshness returns the Freshness of all metric categories queried so far, ordered by kind and category.
+func (pms *PromMetricSync) Freshness() []Freshness {
+	f := &pms.freshness
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	all := make([]Freshness, 0, len(f.categories))
+	for _, c := range f.categories {
+		c := *c
+		c.Backlog = len(f.buffers[c.Kind].ch)
+		all = append(all, c)
+	}
+
+	slices.SortFunc(all, func(a, b Freshness) int {
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Category, b.Category)
+	})
+
+	return all
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-go-library/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"golang.org/x/sync/errgroup"
+	kcache "k8s.io/client-go/tools/cache"
+)
+
+// Request rate, errors and latency of services are queried from the standard metrics of the Istio sidecars,
+// as reported by the destination, so that requests from outside the mesh are also taken into account.
+// Errors are responses with a 5xx status code, and latencies are in milliseconds.
+var promQueriesService = []PromQuery{
+	{
+		"request.rate",
+		`sum by (destination_service_namespace, destination_service_name) (rate(istio_requests_total{reporter="destination"}[2m]))`,
+		"",
+	},
+	{
+		"request.error.percentage",
+		`sum by (destination_service_namespace, destination_service_name) (rate(istio_requests_total{reporter="destination", response_code=~"5.."}[2m])) / sum by (destination_service_namespace, destination_service_name) (rate(istio_requests_total{reporter="destination"}[2m]))`,
+		"",
+	},
+	{
+		"request.duration.p50",
+		`histogram_quantile(0.5, sum by (destination_service_namespace, destination_service_name, le) (rate(istio_request_duration_milliseconds_bucket{reporter="destination"}[2m])))`,
+		"",
+	},
+	{
+		"request.duration.p95",
+		`histogram_quantile(0.95, sum by (destination_service_namespace, destination_service_name, le) (rate(istio_request_duration_milliseconds_bucket{reporter="destination"}[2m])))`,
+		"",
+	},
+	{
+		"request.duration.p99",
+		`histogram_quantile(0.99, sum by (destination_service_namespace, destination_service_name, le) (rate(istio_request_duration_milliseconds_bucket{reporter="destination"}[2m])))`,
+		"",
+	},
+}
+
+// promMetricServiceUpsertStmt returns database upsert statement to upsert service metrics
+func (pms *PromMetricSync) promMetricServiceUpsertStmt() string {
+	return fmt.Sprintf(
+		`INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s`,
+		`prometheus_service_metric`,
+		"service_uuid, timestamp, until, category, name, value",
+		`:service_uuid, :timestamp, :until, :category, :name, :value`,
+		`value=VALUES(value), until=GREATEST(until, VALUES(until))`,
+	)
+}
+
+// Services synchronizes the Istio request metrics of the services cached by the given informer.
+func (pms *PromMetricSync) Services(ctx context.Context, informer kcache.SharedIndexInformer) error {
+	if !kcache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	if err := pms.loadPersisted(ctx, "prometheus_service_metric", "service_uuid",
+		"INNER JOIN service ON service.uuid = m.service_uuid WHERE service.cluster_uuid = ?"); err != nil {
+		return err
+	}
+
+	upsertMetrics := pms.newBuffer("services")
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		defer upsertMetrics.close()
+
+		return pms.run(
+			ctx,
+			promQueriesService,
+			nil,
+			upsertMetrics,
+			func(query PromQuery, res *model.Sample) database.Entity {
+				namespace := string(res.Metric["destination_service_namespace"])
+				if res.Value.String() == "NaN" || !pms.namespaceAllowed(namespace) {
+					return nil
+				}
+
+				serviceUuid, exists := schemav1.ServiceUUIDByName(
+					informer.GetStore(), namespace, string(res.Metric["destination_service_name"]))
+				if !exists {
+					return nil
+				}
+
+				timestamp, until, ok := pms.timestamps(serviceUuid.String(), query, "", res)
+				if !ok {
+					return nil
+				}
+
+				return &schemav1.PrometheusServiceMetric{
+					ServiceUuid: serviceUuid,
+					Timestamp:   timestamp,
+					Until:       until,
+					Category:    query.metricCategory,
+					Value:       float64(res.Value),
+				}
+			},
+		)
+	})
+
+	g.Go(func() error {
+		return pms.upsert(ctx, pms.promMetricServiceUpsertStmt(), upsertMetrics.ch)
+	})
+
+	return g.Wait()
+}
@@ -6,19 +6,17 @@ import (
 	"github.com/icinga/icinga-go-library/backoff"
 	"github.com/icinga/icinga-go-library/database"
 	"github.com/icinga/icinga-go-library/logging"
-	"github.com/icinga/icinga-go-library/periodic"
 	"github.com/icinga/icinga-go-library/retry"
 	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/com"
+	k8sDatabase "github.com/icinga/icinga-kubernetes/pkg/database"
 	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
 	"github.com/pkg/errors"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	kcorev1 "k8s.io/api/core/v1"
 	kcache "k8s.io/client-go/tools/cache"
-	"net"
-	"strings"
 	"sync"
 	"time"
 )
@@ -30,6 +28,13 @@ type PromQuery struct {
 	nameLabel      model.LabelName
 }
 
+// optionalQueries are queries that are only executed as long as active returns true,
+// e.g. for Windows nodes, which may join the cluster at any time.
+type optionalQueries struct {
+	queries []PromQuery
+	active  func() bool
+}
+
 var (
 	promQueriesCluster = []PromQuery{
 		{
@@ -164,25 +169,27 @@ var (
 		},
 	}
 
+	// Usage of pods and containers only takes the series of containers into account,
+	// as the series of the pod's cgroup (container="") and its pause container (POD) would count usage twice.
 	promQueriesPod = []PromQuery{
 		{
 			"cpu.usage",
-			`sum by (instance, namespace, pod) (rate(container_cpu_usage_seconds_total[2m]))`,
+			`sum by (instance, namespace, pod) (rate(container_cpu_usage_seconds_total{container!="", container!="POD"}[2m]))`,
 			"",
 		},
 		{
 			"memory.usage",
-			`sum by (instance, namespace, pod) (container_memory_usage_bytes) / on () group_left() label_replace(node_memory_MemTotal_bytes, "instance", "$1", "node", "(.*)")`,
+			`sum by (instance, namespace, pod) (container_memory_usage_bytes{container!="", container!="POD"}) / on () group_left() label_replace(node_memory_MemTotal_bytes, "instance", "$1", "node", "(.*)")`,
 			"",
 		},
 		{
 			"cpu.usage.cores",
-			`sum by (namespace, pod) (rate(container_cpu_usage_seconds_total[2m]))`,
+			`sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{container!="", container!="POD"}[2m]))`,
 			"",
 		},
 		{
 			"memory.usage.bytes",
-			`sum by (namespace, pod) (container_memory_usage_bytes)`,
+			`sum by (namespace, pod) (container_memory_usage_bytes{container!="", container!="POD"})`,
 			"",
 		},
 		{
@@ -225,9 +232,34 @@ var (
 			`sum by (node, namespace, pod) (kube_pod_container_resource_limits{resource="memory"}) / on(node) group_left() (sum by (node) (machine_memory_bytes))`,
 			"",
 		},
+		{
+			"pvc.usage.bytes",
+			`max by (namespace, pod, persistentvolumeclaim) (kube_pod_spec_volumes_persistentvolumeclaims_info * on (namespace, persistentvolumeclaim) group_left() kubelet_volume_stats_used_bytes)`,
+			"persistentvolumeclaim",
+		},
+		{
+			"pvc.inodes.used",
+			`max by (namespace, pod, persistentvolumeclaim) (kube_pod_spec_volumes_persistentvolumeclaims_info * on (namespace, persistentvolumeclaim) group_left() kubelet_volume_stats_inodes_used)`,
+			"persistentvolumeclaim",
+		},
+		{
+			"pvc.inodes",
+			`max by (namespace, pod, persistentvolumeclaim) (kube_pod_spec_volumes_persistentvolumeclaims_info * on (namespace, persistentvolumeclaim) group_left() kubelet_volume_stats_inodes)`,
+			"persistentvolumeclaim",
+		},
 	}
 
 	promQueriesContainer = []PromQuery{
+		{
+			"cpu.usage.cores",
+			`sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{container!="", container!="POD"}[2m]))`,
+			"",
+		},
+		{
+			"memory.usage.bytes",
+			`sum by (namespace, pod, container) (container_memory_usage_bytes{container!="", container!="POD"})`,
+			"",
+		},
 		{
 			"cpu.request",
 			`sum by (node, namespace, pod, container) (kube_pod_container_resource_requests{resource="cpu"})`,
@@ -273,18 +305,100 @@ var (
 
 // PromMetricSync synchronizes prometheus metrics from the prometheus API to the database
 type PromMetricSync struct {
-	promApiClient v1.API
-	db            *database.DB
-	logger        *logging.Logger
+	promApiClient    v1.API
+	db               *database.DB
+	writeLimiter     *k8sDatabase.WriteLimiter
+	logger           *logging.Logger
+	cluster          string
+	clusterUuid      types.UUID
+	namespaceAllowed func(string) bool
+	config           *PrometheusConfig
+	once             bool
+	timeRange        *v1.Range
+	nodeMemoryUsage  sync.Map
+	freshness        freshness
+	compactor        compactor
+	persisted        persisted
 }
 
-// NewPromMetricSync creates a new PromMetricSync
-func NewPromMetricSync(promApiClient v1.API, db *database.DB, logger *logging.Logger) *PromMetricSync {
+// NewPromMetricSync creates a new PromMetricSync.
+// Cluster metrics are stored for the cluster identified by clusterUuid, which is reported as cluster
+// in the Backlog metrics. Pod and container metrics are only synchronized for namespaces
+// for which namespaceAllowed returns true. Metrics are buffered as configured in config
+// and written as soon as writeLimiter permits, which may be nil.
+// If once is true, each query is only executed a single time instead of periodically.
+func NewPromMetricSync(
+	promApiClient v1.API,
+	db *database.DB,
+	writeLimiter *k8sDatabase.WriteLimiter,
+	logger *logging.Logger,
+	cluster string,
+	clusterUuid types.UUID,
+	namespaceAllowed func(string) bool,
+	config *PrometheusConfig,
+	once bool,
+) *PromMetricSync {
 	return &PromMetricSync{
-		promApiClient: promApiClient,
-		db:            db,
-		logger:        logger,
+		promApiClient:    promApiClient,
+		db:               db,
+		writeLimiter:     writeLimiter,
+		logger:           logger,
+		cluster:          cluster,
+		clusterUuid:      clusterUuid,
+		namespaceAllowed: namespaceAllowed,
+		config:           config,
+		once:             once,
+	}
+}
+
+// NewPromMetricBackfill creates a new PromMetricSync that executes range queries over r once
+// instead of periodically querying the current values, in order to fill in historical metrics.
+// Metrics are only stored for nodes and pods that are known to the informers passed to its methods.
+func NewPromMetricBackfill(
+	promApiClient v1.API,
+	db *database.DB,
+	writeLimiter *k8sDatabase.WriteLimiter,
+	logger *logging.Logger,
+	cluster string,
+	clusterUuid types.UUID,
+	namespaceAllowed func(string) bool,
+	r v1.Range,
+) *PromMetricSync {
+	// Historical metrics are never dropped, as there is no hurry to write them.
+	config := &PrometheusConfig{Buffer: defaultBuffer, Overflow: Block}
+	pms := NewPromMetricSync(promApiClient, db, writeLimiter, logger, cluster, clusterUuid, namespaceAllowed, config, true)
+	pms.timeRange = &r
+
+	return pms
+}
+
+// NodeMemoryUsage returns the latest memory usage ratio of the node with the given UUID, if already known.
+func (pms *PromMetricSync) NodeMemoryUsage(uuid types.UUID) (float64, bool) {
+	usage, ok := pms.nodeMemoryUsage.Load(uuid)
+	if !ok {
+		return 0, false
 	}
+
+	return usage.(float64), true
+}
+
+// timestamps returns the timestamp and until of the row of the given sample of the series of the given query
+// of the object with the given ID and the given name, compacting the series if enabled and its category is compacted.
+// It returns false if the sample has already been written before the PromMetricSync started.
+func (pms *PromMetricSync) timestamps(id string, query PromQuery, name string, res *model.Sample) (int64, int64, bool) {
+	key := id + "/" + query.metricCategory + "/" + name
+	timestamp := schemav1.MetricTimestamp(res.Timestamp.Time())
+	if pms.persisted.exists(key, timestamp) {
+		return 0, 0, false
+	}
+
+	if _, ok := compacted[query.metricCategory]; !ok || !pms.config.Compact {
+		return timestamp, timestamp, true
+	}
+
+	timestamp, until := pms.compactor.compact(key, timestamp, float64(res.Value))
+
+	return timestamp, until, true
 }
 
 // promMetricClusterUpsertStmt returns database upsert statement to upsert cluster metrics
@@ -292,9 +406,9 @@ func (pms *PromMetricSync) promMetricClusterUpsertStmt() string {
 	return fmt.Sprintf(
 		`INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s`,
 		`prometheus_cluster_metric`,
-		"cluster_id, timestamp, category, name, value",
-		`:cluster_id, :timestamp, :category, :name, :value`,
-		`value=VALUES(value)`,
+		"cluster_uuid, timestamp, until, category, name, value",
+		`:cluster_uuid, :timestamp, :until, :category, :name, :value`,
+		`value=VALUES(value), until=GREATEST(until, VALUES(until))`,
 	)
 }
 
@@ -303,9 +417,9 @@ func (pms *PromMetricSync) promMetricNodeUpsertStmt() string {
 	return fmt.Sprintf(
 		`INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s`,
 		`prometheus_node_metric`,
-		"node_uuid, timestamp, category, name, value",
-		`:node_uuid, :timestamp, :category, :name, :value`,
-		`value=VALUES(value)`,
+		"node_uuid, timestamp, until, category, name, value",
+		`:node_uuid, :timestamp, :until, :category, :name, :value`,
+		`value=VALUES(value), until=GREATEST(until, VALUES(until))`,
 	)
 }
 
@@ -314,9 +428,9 @@ func (pms *PromMetricSync) promMetricPodUpsertStmt() string {
 	return fmt.Sprintf(
 		`INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s`,
 		`prometheus_pod_metric`,
-		"pod_uuid, timestamp, category, name, value",
-		`:pod_uuid, :timestamp, :category, :name, :value`,
-		`value=VALUES(value)`,
+		"pod_uuid, timestamp, until, category, name, value",
+		`:pod_uuid, :timestamp, :until, :category, :name, :value`,
+		`value=VALUES(value), until=GREATEST(until, VALUES(until))`,
 	)
 }
 
@@ -325,142 +439,295 @@ func (pms *PromMetricSync) promMetricContainerUpsertStmt() string {
 	return fmt.Sprintf(
 		`INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s`,
 		`prometheus_container_metric`,
-		"container_id, timestamp, category, name, value",
-		`:container_id, :timestamp, :category, :name, :value`,
-		`value=VALUES(value)`,
+		"container_uuid, timestamp, until, category, name, value",
+		`:container_uuid, :timestamp, :until, :category, :name, :value`,
+		`value=VALUES(value), until=GREATEST(until, VALUES(until))`,
 	)
 }
 
+// upsert streams the entities into the database using the given upsert statement,
+// each as soon as the write limiter permits.
+// Unlike database.Upsert#Stream, it also returns if entities is closed before any entity has been sent.
+func (pms *PromMetricSync) upsert(ctx context.Context, stmt string, entities <-chan database.Entity) error {
+	first, forward, err := com.CopyFirst(ctx, entities)
+	if first == nil {
+		return err
+	}
+
+	if pms.writeLimiter == nil {
+		return database.NewUpsert(pms.db, database.WithStatement(stmt, 5)).Stream(ctx, forward)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	limited := make(chan database.Entity)
+
+	g.Go(func() error {
+		defer close(limited)
+
+		for {
+			select {
+			case entity, more := <-forward:
+				if !more {
+					return nil
+				}
+
+				if err := pms.writeLimiter.Wait(ctx, 1); err != nil {
+					return err
+				}
+
+				select {
+				case limited <- entity:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+
+	g.Go(func() error {
+		return database.NewUpsert(pms.db, database.WithStatement(stmt, 5)).Stream(ctx, limited)
+	})
+
+	return g.Wait()
+}
+
+// maxRangePoints is the maximum number of points per series of a single range query.
+// Prometheus rejects queries resulting in more than 11,000 points per series.
+const maxRangePoints = 10000
+
+// run executes the given queries and, as long as they are active, the given optional queries
+// and sends the entities returned from getEntity for their samples to upsertMetrics.
 func (pms *PromMetricSync) run(
 	ctx context.Context,
 	promQueries []PromQuery,
-	upsertMetrics chan<- database.Entity,
+	optional []optionalQueries,
+	upsertMetrics *buffer,
 	getEntity func(query PromQuery, res *model.Sample) database.Entity,
 ) error {
 	g, ctx := errgroup.WithContext(ctx)
 
-	for _, promQuery := range promQueries {
-		promQuery := promQuery
+	groups := append([]optionalQueries{{queries: promQueries, active: func() bool { return true }}}, optional...)
+	for _, group := range groups {
+		for _, promQuery := range group.queries {
+			pms.runQuery(ctx, g, promQuery, group.active, upsertMetrics, getEntity)
+		}
+	}
 
-		g.Go(func() error {
-			var result model.Value
-			var warnings v1.Warnings
-			var err error
+	return g.Wait()
+}
 
-			for {
-				err := retry.WithBackoff(
-					ctx,
-					func(ctx context.Context) error {
-						result, warnings, err = pms.promApiClient.Query(
-							ctx,
-							promQuery.query,
-							time.Time{},
-						)
+// runQuery executes promQuery in g as long as active returns true
+// and sends the entities returned from getEntity for its samples to upsertMetrics.
+func (pms *PromMetricSync) runQuery(
+	ctx context.Context,
+	g *errgroup.Group,
+	promQuery PromQuery,
+	active func() bool,
+	upsertMetrics *buffer,
+	getEntity func(query PromQuery, res *model.Sample) database.Entity,
+) {
+	g.Go(func() error {
+		send := func(res *model.Sample) error {
+			entity := getEntity(promQuery, res)
+			if entity == nil {
+				return nil
+			}
 
-						return err
-					},
-					retry.Retryable,
-					backoff.NewExponentialWithJitter(1*time.Millisecond, 1*time.Second),
-					retry.Settings{
-						Timeout: retry.DefaultTimeout,
-						OnRetryableError: func(_ time.Duration, _ uint64, err, lastErr error) {
-							if lastErr == nil || err.Error() != lastErr.Error() {
-								pms.logger.Warnw("Can't execute prometheus query. Retrying", zap.Error(err))
-							}
-						},
-						OnSuccess: func(elapsed time.Duration, attempt uint64, lastErr error) {
-							if attempt > 1 {
-								pms.logger.Infow("Query retried successfully after error",
-									zap.Duration("after", elapsed),
-									zap.Uint64("attempts", attempt),
-									zap.NamedError("recovered_error", lastErr))
-							}
-						},
-					},
-				)
-				if err != nil {
-					return errors.Wrap(err, "error querying Prometheus")
-				}
+			return upsertMetrics.send(ctx, entity)
+		}
 
-				if len(warnings) > 0 {
-					pms.logger.Warnf("Prometheus warnings: %v\n", warnings)
-				}
+		if pms.timeRange != nil {
+			if !active() {
+				return nil
+			}
 
-				if result == nil {
+			return pms.backfill(ctx, promQuery, send)
+		}
+
+		for {
+			if !active() {
+				// The queries may become active at any time.
+				select {
+				case <-time.After(pms.config.IntervalOrDefault()):
 					continue
+				case <-ctx.Done():
+					return ctx.Err()
 				}
+			}
+
+			result, err := pms.query(ctx, func(ctx context.Context) (model.Value, v1.Warnings, error) {
+				return pms.promApiClient.Query(ctx, promQuery.query, time.Time{})
+			})
+			if err != nil {
+				return err
+			}
 
+			if result != nil {
 				for _, res := range result.(model.Vector) {
-					entity := getEntity(promQuery, res)
-					if entity == nil {
-						continue
+					if err := send(res); err != nil {
+						return err
 					}
+				}
+			}
+
+			pms.freshness.queried(upsertMetrics, promQuery.metricCategory, time.Now())
+
+			if pms.once {
+				return nil
+			}
+
+			select {
+			case <-time.After(pms.config.IntervalOrDefault()):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
 
-					select {
-					case upsertMetrics <- entity:
-					case <-ctx.Done():
-						return ctx.Err()
+// backfill executes promQuery as range query over the configured time range and passes each sample to send.
+// Long ranges are split into multiple queries so as not to exceed the maximum number of points per series.
+func (pms *PromMetricSync) backfill(ctx context.Context, promQuery PromQuery, send func(*model.Sample) error) error {
+	r := *pms.timeRange
+
+	for start := r.Start; !start.After(r.End); {
+		end := start.Add(r.Step * (maxRangePoints - 1))
+		if end.After(r.End) {
+			end = r.End
+		}
+
+		result, err := pms.query(ctx, func(ctx context.Context) (model.Value, v1.Warnings, error) {
+			return pms.promApiClient.QueryRange(ctx, promQuery.query, v1.Range{Start: start, End: end, Step: r.Step})
+		})
+		if err != nil {
+			return err
+		}
+
+		if result != nil {
+			for _, stream := range result.(model.Matrix) {
+				for _, point := range stream.Values {
+					if err := send(&model.Sample{
+						Metric:    stream.Metric,
+						Value:     point.Value,
+						Timestamp: point.Timestamp,
+					}); err != nil {
+						return err
 					}
 				}
+			}
+		}
 
-				select {
-				case <-time.After(time.Second * 60):
-				case <-ctx.Done():
-					return ctx.Err()
+		start = end.Add(r.Step)
+	}
+
+	return nil
+}
+
+// query executes the given Prometheus query with retries and logs any warnings.
+func (pms *PromMetricSync) query(
+	ctx context.Context, query func(context.Context) (model.Value, v1.Warnings, error),
+) (model.Value, error) {
+	var result model.Value
+	var warnings v1.Warnings
+
+	err := retry.WithBackoff(
+		ctx,
+		func(ctx context.Context) (err error) {
+			result, warnings, err = query(ctx)
+
+			return err
+		},
+		retry.Retryable,
+		backoff.NewExponentialWithJitter(1*time.Millisecond, 1*time.Second),
+		retry.Settings{
+			Timeout: retry.DefaultTimeout,
+			OnRetryableError: func(_ time.Duration, _ uint64, err, lastErr error) {
+				if lastErr == nil || err.Error() != lastErr.Error() {
+					pms.logger.Warnw("Can't execute prometheus query. Retrying", zap.Error(err))
 				}
-			}
-		})
+			},
+			OnSuccess: func(elapsed time.Duration, attempt uint64, lastErr error) {
+				if attempt > 1 {
+					pms.logger.Infow("Query retried successfully after error",
+						zap.Duration("after", elapsed),
+						zap.Uint64("attempts", attempt),
+						zap.NamedError("recovered_error", lastErr))
+				}
+			},
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying Prometheus")
 	}
 
-	return g.Wait()
+	if len(warnings) > 0 {
+		pms.logger.Warnf("Prometheus warnings: %v\n", warnings)
+	}
+
+	return result, nil
 }
 
-func (pms *PromMetricSync) Nodes(ctx context.Context, informer kcache.SharedIndexInformer) error {
+// Query executes the given instant Prometheus query with retries, e.g. for aggregations over long time ranges
+// that aren't synchronized.
+func (pms *PromMetricSync) Query(ctx context.Context, query string) (model.Vector, error) {
+	result, err := pms.query(ctx, func(ctx context.Context) (model.Value, v1.Warnings, error) {
+		return pms.promApiClient.Query(ctx, query, time.Time{})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vector, _ := result.(model.Vector)
+
+	return vector, nil
+}
+
+// Nodes synchronizes the metrics of the nodes cached by the given informer,
+// including the health of their Cilium agents if cilium is true.
+func (pms *PromMetricSync) Nodes(ctx context.Context, informer kcache.SharedIndexInformer, cilium bool) error {
 	if !kcache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
 		return errors.New("timed out waiting for caches to sync")
 	}
 
-	nodes := sync.Map{}
-	defer periodic.Start(ctx, 1*time.Hour, func(tick periodic.Tick) {
-		for _, item := range informer.GetStore().List() {
-			node := item.(*kcorev1.Node)
-			uuid := schemav1.EnsureUUID(node.UID)
-			nodes.Store(node.Name, uuid)
-			for _, address := range node.Status.Addresses {
-				if address.Type == kcorev1.NodeInternalIP {
-					nodes.Store(address.Address, uuid)
-				}
-			}
-		}
-	}, periodic.Immediate()).Stop()
+	if err := pms.loadPersisted(ctx, "prometheus_node_metric", "node_uuid",
+		"INNER JOIN node ON node.uuid = m.node_uuid WHERE node.cluster_uuid = ?"); err != nil {
+		return err
+	}
 
-	upsertMetrics := make(chan database.Entity)
+	nodes := newNodeIndex()
+	registration, err := informer.AddEventHandler(nodes.handler())
+	if err != nil {
+		return errors.Wrap(err, "can't add node event handler")
+	}
+	defer func() { _ = informer.RemoveEventHandler(registration) }()
+
+	upsertMetrics := pms.newBuffer("nodes")
 
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
+		defer upsertMetrics.close()
+
 		return pms.run(
 			ctx,
 			promQueriesNode,
+			[]optionalQueries{
+				{promQueriesWindowsNode, windowsNodes(informer.GetStore())},
+				{promQueriesCiliumNode, func() bool { return cilium }},
+			},
 			upsertMetrics,
 			func(query PromQuery, res *model.Sample) database.Entity {
 				if res.Value.String() == "NaN" {
 					return nil
 				}
 
-				nodeName := string(res.Metric["node"])
-				if nodeName == "" {
-					if strings.Contains(string(res.Metric["instance"]), ":") {
-						if host, _, err := net.SplitHostPort(string(res.Metric["instance"])); err == nil {
-							nodeName = host
-						} else {
-							return nil
-						}
-					} else {
-						nodeName = string(res.Metric["instance"])
-					}
+				// Node metrics are identified either by node name or by the address of the scraped instance.
+				uuid, exists := nodes.lookup(string(res.Metric["node"]))
+				if !exists {
+					uuid, exists = nodes.lookup(string(res.Metric["instance"]))
 				}
-				uuid, exists := nodes.Load(nodeName)
 				if !exists {
 					return nil
 				}
@@ -470,9 +737,18 @@ func (pms *PromMetricSync) Nodes(ctx context.Context, informer kcache.SharedInde
 					name = string(res.Metric[query.nameLabel])
 				}
 
+				if query.metricCategory == "memory.usage" {
+					pms.nodeMemoryUsage.Store(uuid, float64(res.Value))
+				}
+
+				timestamp, until, ok := pms.timestamps(uuid.String(), query, name, res)
+				if !ok {
+					return nil
+				}
 				newNodeMetric := &schemav1.PrometheusNodeMetric{
-					NodeUuid:  uuid.(types.UUID),
-					Timestamp: (res.Timestamp.UnixNano() - res.Timestamp.UnixNano()%(60*1000000000)) / 1000000,
+					NodeUuid:  uuid,
+					Timestamp: timestamp,
+					Until:     until,
 					Category:  query.metricCategory,
 					Name:      name,
 					Value:     float64(res.Value),
@@ -484,7 +760,7 @@ func (pms *PromMetricSync) Nodes(ctx context.Context, informer kcache.SharedInde
 	})
 
 	g.Go(func() error {
-		return database.NewUpsert(pms.db, database.WithStatement(pms.promMetricNodeUpsertStmt(), 5)).Stream(ctx, upsertMetrics)
+		return pms.upsert(ctx, pms.promMetricNodeUpsertStmt(), upsertMetrics.ch)
 	})
 
 	return g.Wait()
@@ -495,39 +771,47 @@ func (pms *PromMetricSync) Pods(ctx context.Context, informer kcache.SharedIndex
 		return errors.New("timed out waiting for caches to sync")
 	}
 
-	upsertMetrics := make(chan database.Entity)
+	if err := pms.loadPersisted(ctx, "prometheus_pod_metric", "pod_uuid",
+		"INNER JOIN pod ON pod.uuid = m.pod_uuid WHERE pod.cluster_uuid = ?"); err != nil {
+		return err
+	}
+
+	upsertMetrics := pms.newBuffer("pods")
 
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
+		defer upsertMetrics.close()
+
 		return pms.run(
 			ctx,
 			promQueriesPod,
+			[]optionalQueries{{promQueriesWindowsPod, windowsPods(informer.GetStore())}},
 			upsertMetrics,
 			func(query PromQuery, res *model.Sample) database.Entity {
-				if res.Metric["pod"] == "" {
+				if res.Metric["pod"] == "" || !pms.namespaceAllowed(string(res.Metric["namespace"])) {
 					return nil
 				}
 
-				obj, exists, err := informer.GetStore().GetByKey(
-					kcache.NewObjectName(string(res.Metric["namespace"]), string(res.Metric["pod"])).String())
-				if err != nil {
-					//return errors.Wrap(err, "can't get pod from store")
-					return nil
-				}
+				podUuid, exists := schemav1.PodUUIDByName(
+					informer.GetStore(), string(res.Metric["namespace"]), string(res.Metric["pod"]))
 				if !exists {
 					return nil
 				}
-				pod := obj.(*kcorev1.Pod)
 
 				name := ""
 				if query.nameLabel != "" {
 					name = string(res.Metric[query.nameLabel])
 				}
 
+				timestamp, until, ok := pms.timestamps(podUuid.String(), query, name, res)
+				if !ok {
+					return nil
+				}
 				newPodMetric := &schemav1.PrometheusPodMetric{
-					PodUuid:   schemav1.EnsureUUID(pod.UID),
-					Timestamp: (res.Timestamp.UnixNano() - res.Timestamp.UnixNano()%(60*1000000000)) / 1000000,
+					PodUuid:   podUuid,
+					Timestamp: timestamp,
+					Until:     until,
 					Category:  query.metricCategory,
 					Name:      name,
 					Value:     float64(res.Value),
@@ -539,7 +823,7 @@ func (pms *PromMetricSync) Pods(ctx context.Context, informer kcache.SharedIndex
 	})
 
 	g.Go(func() error {
-		return database.NewUpsert(pms.db, database.WithStatement(pms.promMetricPodUpsertStmt(), 5)).Stream(ctx, upsertMetrics)
+		return pms.upsert(ctx, pms.promMetricPodUpsertStmt(), upsertMetrics.ch)
 	})
 
 	return g.Wait()
@@ -547,37 +831,56 @@ func (pms *PromMetricSync) Pods(ctx context.Context, informer kcache.SharedIndex
 
 func (pms *PromMetricSync) Containers(ctx context.Context, informer kcache.SharedIndexInformer) error {
 	if !kcache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
-		pms.logger.Fatal("timed out waiting for caches to sync")
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	if err := pms.loadPersisted(ctx, "prometheus_container_metric", "container_uuid",
+		"INNER JOIN container ON container.uuid = m.container_uuid INNER JOIN pod ON pod.uuid = container.pod_uuid"+
+			" WHERE pod.cluster_uuid = ?"); err != nil {
+		return err
 	}
 
-	upsertMetrics := make(chan database.Entity)
+	upsertMetrics := pms.newBuffer("containers")
 
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
+		defer upsertMetrics.close()
+
 		return pms.run(
 			ctx,
 			promQueriesContainer,
+			[]optionalQueries{{promQueriesWindowsContainer, windowsPods(informer.GetStore())}},
 			upsertMetrics,
 			func(query PromQuery, res *model.Sample) database.Entity {
-				if res.Value.String() == "NaN" {
+				if res.Value.String() == "NaN" || res.Metric["pod"] == "" || res.Metric["container"] == "" ||
+					!pms.namespaceAllowed(string(res.Metric["namespace"])) {
 					return nil
 				}
 
-				//containerId := sha1.Sum([]byte(res.Metric["namespace"] + "/" + res.Metric["pod"] + "/" + res.Metric["container"]))
+				podUuid, exists := schemav1.PodUUIDByName(
+					informer.GetStore(), string(res.Metric["namespace"]), string(res.Metric["pod"]))
+				if !exists {
+					return nil
+				}
 
 				name := ""
-
 				if query.nameLabel != "" {
 					name = string(res.Metric[query.nameLabel])
 				}
 
+				containerUuid := schemav1.ContainerUUID(podUuid, string(res.Metric["container"]))
+				timestamp, until, ok := pms.timestamps(containerUuid.String(), query, name, res)
+				if !ok {
+					return nil
+				}
 				newContainerMetric := &schemav1.PrometheusContainerMetric{
-					// TODO uuid
-					Timestamp: (res.Timestamp.UnixNano() - res.Timestamp.UnixNano()%(60*1000000000)) / 1000000,
-					Category:  query.metricCategory,
-					Name:      name,
-					Value:     float64(res.Value),
+					ContainerUuid: containerUuid,
+					Timestamp:     timestamp,
+					Until:         until,
+					Category:      query.metricCategory,
+					Name:          name,
+					Value:         float64(res.Value),
 				}
 
 				return newContainerMetric
@@ -586,7 +889,7 @@ func (pms *PromMetricSync) Containers(ctx context.Context, informer kcache.Share
 	})
 
 	g.Go(func() error {
-		return database.NewUpsert(pms.db, database.WithStatement(pms.promMetricContainerUpsertStmt(), 5)).Stream(ctx, upsertMetrics)
+		return pms.upsert(ctx, pms.promMetricContainerUpsertStmt(), upsertMetrics.ch)
 	})
 
 	return g.Wait()
@@ -597,34 +900,44 @@ func (pms *PromMetricSync) Clusters(ctx context.Context, informer kcache.SharedI
 		pms.logger.Fatal("timed out waiting for caches to sync")
 	}
 
-	upsertMetrics := make(chan database.Entity)
+	if err := pms.loadPersisted(ctx, "prometheus_cluster_metric", "cluster_uuid", "WHERE m.cluster_uuid = ?"); err != nil {
+		return err
+	}
+
+	upsertMetrics := pms.newBuffer("clusters")
 
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
+		defer upsertMetrics.close()
+
 		return pms.run(
 			ctx,
 			promQueriesCluster,
+			nil,
 			upsertMetrics,
 			func(query PromQuery, res *model.Sample) database.Entity {
 				if res.Value.String() == "NaN" {
 					return nil
 				}
 
-				//clusterId := sha1.Sum([]byte(""))
-
 				name := ""
 
 				if query.nameLabel != "" {
 					name = string(res.Metric[query.nameLabel])
 				}
 
+				timestamp, until, ok := pms.timestamps(pms.clusterUuid.String(), query, name, res)
+				if !ok {
+					return nil
+				}
 				newClusterMetric := &schemav1.PrometheusClusterMetric{
-					// TODO uuid
-					Timestamp: (res.Timestamp.UnixNano() - res.Timestamp.UnixNano()%(60*1000000000)) / 1000000,
-					Category:  query.metricCategory,
-					Name:      name,
-					Value:     float64(res.Value),
+					ClusterUuid: pms.clusterUuid,
+					Timestamp:   timestamp,
+					Until:       until,
+					Category:    query.metricCategory,
+					Name:        name,
+					Value:       float64(res.Value),
 				}
 
 				return newClusterMetric
@@ -633,7 +946,7 @@ func (pms *PromMetricSync) Clusters(ctx context.Context, informer kcache.SharedI
 	})
 
 	g.Go(func() error {
-		return database.NewUpsert(pms.db, database.WithStatement(pms.promMetricClusterUpsertStmt(), 5)).Stream(ctx, upsertMetrics)
+		return pms.upsert(ctx, pms.promMetricClusterUpsertStmt(), upsertMetrics.ch)
 	})
 
 	return g.Wait()
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"github.com/icinga/icinga-go-library/types"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kcache "k8s.io/client-go/tools/cache"
+	"net"
+	"strings"
+	"sync"
+)
+
+// nodeIndex maps the names and addresses of nodes to their IDs, so that node metrics can be joined
+// to the synchronized nodes regardless of whether Prometheus identifies them by name or by address.
+// It is kept up to date by the event handler returned from handler.
+type nodeIndex struct {
+	mu  sync.RWMutex
+	ids map[string]types.UUID
+	// short maps the short host names of nodes to their IDs, which are only looked up
+	// if no node has the same name or address, as they are ambiguous.
+	short map[string]types.UUID
+	keys  map[types.UUID][]string
+}
+
+func newNodeIndex() *nodeIndex {
+	return &nodeIndex{
+		ids:   make(map[string]types.UUID),
+		short: make(map[string]types.UUID),
+		keys:  make(map[types.UUID][]string),
+	}
+}
+
+// handler returns an event handler which keeps the index up to date with the nodes of an informer.
+func (ni *nodeIndex) handler() kcache.ResourceEventHandler {
+	return kcache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*kcorev1.Node); ok {
+				ni.store(node)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if node, ok := obj.(*kcorev1.Node); ok {
+				ni.store(node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(kcache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if node, ok := obj.(*kcorev1.Node); ok {
+				ni.delete(schemav1.NodeUUID(node))
+			}
+		},
+	}
+}
+
+// lookup returns the ID of the node identified by the given Prometheus label value,
+// e.g. the node name, an address or an instance in the form host:port, and whether it is known.
+func (ni *nodeIndex) lookup(label string) (types.UUID, bool) {
+	ni.mu.RLock()
+	defer ni.mu.RUnlock()
+
+	for _, key := range nodeKeys(label) {
+		if id, ok := ni.ids[key]; ok {
+			return id, true
+		}
+
+		if id, ok := ni.short[key]; ok {
+			return id, true
+		}
+	}
+
+	return types.UUID{}, false
+}
+
+func (ni *nodeIndex) store(node *kcorev1.Node) {
+	id := schemav1.NodeUUID(node)
+
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+
+	ni.deleteLocked(id)
+
+	values := []string{node.Name}
+	for _, address := range node.Status.Addresses {
+		values = append(values, address.Address)
+	}
+
+	var keys []string
+	for _, value := range values {
+		for i, key := range nodeKeys(value) {
+			// Short host names of different nodes may be the same, in which case the first one is kept.
+			if i == 0 {
+				ni.ids[key] = id
+			} else if _, ok := ni.short[key]; !ok {
+				ni.short[key] = id
+			}
+
+			keys = append(keys, key)
+		}
+	}
+
+	ni.keys[id] = keys
+}
+
+func (ni *nodeIndex) delete(id types.UUID) {
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+
+	ni.deleteLocked(id)
+}
+
+func (ni *nodeIndex) deleteLocked(id types.UUID) {
+	for _, key := range ni.keys[id] {
+		if ni.ids[key] == id {
+			delete(ni.ids, key)
+		}
+
+		if ni.short[key] == id {
+			delete(ni.short, key)
+		}
+	}
+
+	delete(ni.keys, id)
+}
+
+// nodeKeys returns the normalized forms of the given node name, address or instance, most specific first:
+// the value without port in lower case and, for fully qualified host names, the first label.
+func nodeKeys(value string) []string {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+
+	value = strings.ToLower(value)
+	if value == "" {
+		return nil
+	}
+
+	keys := []string{value}
+	if net.ParseIP(value) == nil {
+		if short, _, ok := strings.Cut(value, "."); ok && short != "" {
+			keys = append(keys, short)
+		}
+	}
+
+	return keys
+}
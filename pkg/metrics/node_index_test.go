@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"slices"
+	"testing"
+)
+
+// TestNodeKeys verifies that node names, addresses and instances are normalized to the same keys.
+func TestNodeKeys(t *testing.T) {
+	tests := []struct {
+		value string
+		keys  []string
+	}{
+		{value: "worker-1", keys: []string{"worker-1"}},
+		{value: "Worker-1", keys: []string{"worker-1"}},
+		{value: "worker-1.example.com", keys: []string{"worker-1.example.com", "worker-1"}},
+		{value: "worker-1.example.com:9100", keys: []string{"worker-1.example.com", "worker-1"}},
+		{value: "10.0.0.1", keys: []string{"10.0.0.1"}},
+		{value: "10.0.0.1:9100", keys: []string{"10.0.0.1"}},
+		{value: "[fd00::1]:9100", keys: []string{"fd00::1"}},
+		{value: ".example.com", keys: []string{".example.com"}},
+		{value: ""},
+	}
+
+	for _, tt := range tests {
+		if keys := nodeKeys(tt.value); !slices.Equal(keys, tt.keys) {
+			t.Errorf("keys of %q are %v, expected %v", tt.value, keys, tt.keys)
+		}
+	}
+}
+
+// TestNodeIndex verifies that nodes are looked up by name, address and instance,
+// that short host names don't shadow the names of other nodes and that deleted nodes are forgotten.
+func TestNodeIndex(t *testing.T) {
+	node := func(name, uid string, addresses ...string) *kcorev1.Node {
+		n := &kcorev1.Node{ObjectMeta: kmetav1.ObjectMeta{Name: name, UID: ktypes.UID(uid)}}
+		for _, address := range addresses {
+			n.Status.Addresses = append(n.Status.Addresses, kcorev1.NodeAddress{Address: address})
+		}
+
+		return n
+	}
+
+	first := node("worker-1.example.com", "1", "10.0.0.1")
+	second := node("worker-1", "2", "10.0.0.2")
+
+	ni := newNodeIndex()
+	ni.store(first)
+	ni.store(second)
+
+	tests := []struct {
+		label string
+		node  *kcorev1.Node
+	}{
+		{label: "worker-1.example.com", node: first},
+		{label: "10.0.0.1:9100", node: first},
+		{label: "WORKER-1.EXAMPLE.COM:9100", node: first},
+		{label: "worker-1", node: second},
+		{label: "10.0.0.2", node: second},
+		{label: "worker-2"},
+	}
+
+	for _, tt := range tests {
+		id, ok := ni.lookup(tt.label)
+		if tt.node == nil {
+			if ok {
+				t.Errorf("%q found, expected none", tt.label)
+			}
+
+			continue
+		}
+
+		if !ok || id != schemav1.NodeUUID(tt.node) {
+			t.Errorf("%q not found as %s", tt.label, tt.node.Name)
+		}
+	}
+
+	// Updated addresses replace the previous ones.
+	ni.store(node("worker-1.example.com", "1", "10.0.0.3"))
+	if _, ok := ni.lookup("10.0.0.1"); ok {
+		t.Errorf("previous address of updated node still found")
+	}
+	if id, ok := ni.lookup("10.0.0.3"); !ok || id != schemav1.NodeUUID(first) {
+		t.Errorf("new address of updated node not found")
+	}
+
+	ni.delete(schemav1.NodeUUID(first))
+	if _, ok := ni.lookup("10.0.0.3"); ok {
+		t.Errorf("deleted node still found")
+	}
+	// The short host name of the deleted node is now that of the other node.
+	if id, ok := ni.lookup("worker-1.example.com"); !ok || id != schemav1.NodeUUID(second) {
+		t.Errorf("other node not found by short host name after delete")
+	}
+	if id, ok := ni.lookup("worker-1"); !ok || id != schemav1.NodeUUID(second) {
+		t.Errorf("other node not found after delete")
+	}
+}
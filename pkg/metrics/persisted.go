@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// persisted holds the timestamp of the latest point of each series written before a PromMetricSync started,
+// so that points that already exist aren't written again after a restart. Otherwise, the first queries would
+// rewrite the points of all series in the current minute at once, as timestamps are truncated to the minute.
+type persisted struct {
+	mu     sync.Mutex
+	latest map[string]int64
+}
+
+// exists returns whether the point of the series identified by key at the given timestamp has already been written.
+// Series are forgotten as soon as a newer point arrives, as none of their further points can have been written.
+func (p *persisted) exists(key string, timestamp int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	latest, ok := p.latest[key]
+	if !ok {
+		return false
+	}
+
+	if timestamp <= latest {
+		return true
+	}
+
+	delete(p.latest, key)
+
+	return false
+}
+
+// loadPersisted loads the latest points of the series of the given metric table, whose rows reference objects by fk,
+// that have been written recently. The given join must restrict the rows to the cluster by a placeholder.
+// Backfills don't load anything, as they fill in points before the latest ones.
+func (pms *PromMetricSync) loadPersisted(ctx context.Context, table, fk, join string) error {
+	if pms.timeRange != nil {
+		return nil
+	}
+
+	// Compacted rows cover points up to maxRange after their timestamp.
+	since := time.Now().Add(-maxRange - pms.config.IntervalOrDefault())
+
+	var series []struct {
+		Uuid     types.UUID
+		Category string
+		Name     string
+		Until    int64
+	}
+	if err := pms.db.SelectContext(ctx, &series, pms.db.Rebind(fmt.Sprintf(
+		"SELECT m.%[2]s AS uuid, m.category, m.name, MAX(m.until) AS until FROM %[1]s m %[3]s"+
+			" AND m.timestamp >= ? GROUP BY m.%[2]s, m.category, m.name", table, fk, join)),
+		pms.clusterUuid, since.UnixMilli()); err != nil {
+		return errors.Wrapf(err, "can't query latest points of %s", table)
+	}
+
+	pms.persisted.mu.Lock()
+	defer pms.persisted.mu.Unlock()
+
+	if pms.persisted.latest == nil {
+		pms.persisted.latest = make(map[string]int64, len(series))
+	}
+
+	for _, s := range series {
+		pms.persisted.latest[s.Uuid.String()+"/"+s.Category+"/"+s.Name] = s.Until
+	}
+
+	return nil
+}
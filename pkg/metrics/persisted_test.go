@@ -0,0 +1,35 @@
+package metrics
+
+import "testing"
+
+// TestPersistedExists verifies that points up to the latest persisted one of a series exist
+// and that series are forgotten once a newer point arrives.
+func TestPersistedExists(t *testing.T) {
+	p := persisted{latest: map[string]int64{"a": 100, "b": 100}}
+
+	tests := []struct {
+		name      string
+		key       string
+		timestamp int64
+		exists    bool
+	}{
+		{name: "older point exists", key: "a", timestamp: 50, exists: true},
+		{name: "latest point exists", key: "a", timestamp: 100, exists: true},
+		{name: "newer point doesn't exist", key: "a", timestamp: 150},
+		{name: "series is forgotten after newer point", key: "a", timestamp: 50},
+		{name: "other series is kept", key: "b", timestamp: 100, exists: true},
+		{name: "unknown series doesn't exist", key: "c", timestamp: 50},
+	}
+
+	for _, tt := range tests {
+		if exists := p.exists(tt.key, tt.timestamp); exists != tt.exists {
+			t.Errorf("%s: exists is %t, expected %t", tt.name, exists, tt.exists)
+		}
+	}
+
+	// Nothing is persisted if the latest points haven't been loaded.
+	var empty persisted
+	if empty.exists("a", 50) {
+		t.Errorf("point of empty persisted exists")
+	}
+}
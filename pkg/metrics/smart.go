@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"github.com/icinga/icinga-go-library/database"
+	"github.com/icinga/icinga-go-library/types"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// smartQuery queries a SMART attribute of the disks of the nodes and sets it on the disk of each sample.
+type smartQuery struct {
+	query string
+	set   func(disk *schemav1.NodeDisk, sample *model.Sample)
+}
+
+// SMART attributes are exposed by node-exporter if its textfile collector is fed by the smartmon script,
+// which labels them with the device of the disk. The shell version of the script exposes a metric per attribute,
+// whereas the Python version exposes the attributes by name, so both are queried.
+var smartQueries = []smartQuery{
+	{
+		`max by (instance, node, disk) (smartmon_device_smart_healthy)`,
+		func(disk *schemav1.NodeDisk, sample *model.Sample) {
+			disk.Healthy = types.Bool{Bool: sample.Value == 1, Valid: true}
+		},
+	},
+	{
+		`max by (instance, node, disk, device_model, serial_number) (smartmon_device_info)`,
+		func(disk *schemav1.NodeDisk, sample *model.Sample) {
+			disk.Model = schemav1.NewNullableString(string(sample.Metric["device_model"]))
+			disk.Serial = schemav1.NewNullableString(string(sample.Metric["serial_number"]))
+		},
+	},
+	{
+		smartAttribute("temperature_celsius"),
+		func(disk *schemav1.NodeDisk, sample *model.Sample) {
+			disk.Temperature = sql.NullFloat64{Float64: float64(sample.Value), Valid: true}
+		},
+	},
+	{
+		smartAttribute("power_on_hours"),
+		func(disk *schemav1.NodeDisk, sample *model.Sample) {
+			disk.PowerOnHours = smartCount(sample)
+		},
+	},
+	{
+		smartAttribute("reallocated_sector_ct"),
+		func(disk *schemav1.NodeDisk, sample *model.Sample) {
+			disk.ReallocatedSectors = smartCount(sample)
+		},
+	},
+	{
+		smartAttribute("current_pending_sector"),
+		func(disk *schemav1.NodeDisk, sample *model.Sample) {
+			disk.PendingSectors = smartCount(sample)
+		},
+	},
+	{
+		smartAttribute("offline_uncorrectable"),
+		func(disk *schemav1.NodeDisk, sample *model.Sample) {
+			disk.OfflineUncorrectable = smartCount(sample)
+		},
+	},
+}
+
+// smartAttribute returns the query of the raw value of the SMART attribute with the given name.
+func smartAttribute(name string) string {
+	return `max by (instance, node, disk) (smartmon_` + name + `_raw_value or smartmon_attr_raw_value{name="` + name + `"})`
+}
+
+func smartCount(sample *model.Sample) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(sample.Value), Valid: true}
+}
+
+// NodeDisks synchronizes the local disks of the nodes cached by the given informer with their SMART attributes
+// and health, replacing the disks of the cluster that are no longer reported.
+func (pms *PromMetricSync) NodeDisks(ctx context.Context, informer kcache.SharedIndexInformer) error {
+	if !kcache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	nodes := newNodeIndex()
+	registration, err := informer.AddEventHandler(nodes.handler())
+	if err != nil {
+		return errors.Wrap(err, "can't add node event handler")
+	}
+	defer func() { _ = informer.RemoveEventHandler(registration) }()
+
+	for {
+		if err := pms.nodeDisks(ctx, nodes, time.Now()); err != nil {
+			return err
+		}
+
+		if pms.once {
+			return nil
+		}
+
+		select {
+		case <-time.After(pms.config.IntervalOrDefault()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// nodeDisks queries the SMART attributes of the disks of the nodes in the given index and stores them.
+func (pms *PromMetricSync) nodeDisks(ctx context.Context, nodes *nodeIndex, now time.Time) error {
+	disks := make(map[types.UUID]*schemav1.NodeDisk)
+	for _, q := range smartQueries {
+		samples, err := pms.Query(ctx, q.query)
+		if err != nil {
+			return err
+		}
+
+		for _, sample := range samples {
+			if sample.Value.String() == "NaN" {
+				continue
+			}
+
+			// Like node metrics, disks are identified either by node name or by the address of the scraped instance.
+			nodeUuid, exists := nodes.lookup(string(sample.Metric["node"]))
+			if !exists {
+				nodeUuid, exists = nodes.lookup(string(sample.Metric["instance"]))
+			}
+			if !exists {
+				continue
+			}
+
+			disk := schemav1.NewNodeDisk(pms.clusterUuid, nodeUuid, string(sample.Metric["disk"]))
+			if d, ok := disks[disk.Uuid]; ok {
+				disk = d
+			} else {
+				disks[disk.Uuid] = disk
+			}
+
+			q.set(disk, sample)
+		}
+	}
+
+	// Upsert#Stream doesn't return without any entity, which is the case if SMART attributes aren't exposed.
+	if len(disks) > 0 {
+		entities := make(chan database.Entity, len(disks))
+		for _, disk := range disks {
+			disk.Evaluate()
+			disk.Updated = types.UnixMilli(now)
+
+			entities <- disk
+		}
+		close(entities)
+
+		// There are only a few disks per node, so they are not subject to the write limiter.
+		if err := database.NewUpsert(pms.db).Stream(ctx, entities); err != nil {
+			return errors.Wrap(err, "can't store node disks")
+		}
+	}
+
+	_, err := pms.db.ExecContext(ctx, pms.db.Rebind(
+		"DELETE FROM node_disk WHERE cluster_uuid = ? AND updated < ?"), pms.clusterUuid, now.UnixMilli())
+
+	return errors.Wrap(err, "can't delete node disks that are no longer reported")
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	kcorev1 "k8s.io/api/core/v1"
+	kcache "k8s.io/client-go/tools/cache"
+)
+
+// Windows nodes don't run node_exporter and their kubelet doesn't expose cAdvisor container metrics,
+// so their usage is queried from windows_exporter with its node and container collectors instead.
+// Filesystems of Windows nodes are volumes, e.g. C:, and volumes without a drive letter are ignored.
+// Containers are identified by their ID only and are joined to their pods via kube-state-metrics.
+// The categories are the same as those of Linux nodes, so that charts don't depend on the operating system.
+var (
+	promQueriesWindowsNode = []PromQuery{
+		{
+			"cpu.usage",
+			`avg by (instance) (sum by (instance, core) (rate(windows_cpu_time_total{mode!="idle"}[2m])))`,
+			"",
+		},
+		{
+			"memory.usage",
+			`1 - sum by (instance) (windows_memory_available_bytes) / sum by (instance) (windows_memory_physical_total_bytes or windows_cs_physical_memory_bytes)`,
+			"",
+		},
+		{
+			"network.received.bytes",
+			`sum by (instance) (rate(windows_net_bytes_received_total[2m]))`,
+			"",
+		},
+		{
+			"network.transmitted.bytes",
+			`- sum by (instance) (rate(windows_net_bytes_sent_total[2m]))`,
+			"",
+		},
+		{
+			"filesystem.usage",
+			`sum by (instance, volume) (1 - (windows_logical_disk_free_bytes{volume!~"HarddiskVolume.*"} / windows_logical_disk_size_bytes{volume!~"HarddiskVolume.*"}))`,
+			"volume",
+		},
+	}
+
+	promQueriesWindowsPod = []PromQuery{
+		{
+			"cpu.usage",
+			`sum by (instance, namespace, pod) (rate(windows_container_cpu_usage_seconds_total[2m]) * on (container_id) group_left (namespace, pod) max by (container_id, namespace, pod) (kube_pod_container_info))`,
+			"",
+		},
+		{
+			"memory.usage",
+			`sum by (instance, namespace, pod) (windows_container_memory_usage_private_working_set_bytes * on (container_id) group_left (namespace, pod) max by (container_id, namespace, pod) (kube_pod_container_info)) / on (instance) group_left() (windows_memory_physical_total_bytes or windows_cs_physical_memory_bytes)`,
+			"",
+		},
+		{
+			"cpu.usage.cores",
+			`sum by (namespace, pod) (rate(windows_container_cpu_usage_seconds_total[2m]) * on (container_id) group_left (namespace, pod) max by (container_id, namespace, pod) (kube_pod_container_info))`,
+			"",
+		},
+		{
+			"memory.usage.bytes",
+			`sum by (namespace, pod) (windows_container_memory_usage_private_working_set_bytes * on (container_id) group_left (namespace, pod) max by (container_id, namespace, pod) (kube_pod_container_info))`,
+			"",
+		},
+	}
+
+	promQueriesWindowsContainer = []PromQuery{
+		{
+			"cpu.usage.cores",
+			`sum by (namespace, pod, container) (rate(windows_container_cpu_usage_seconds_total[2m]) * on (container_id) group_left (namespace, pod, container) max by (container_id, namespace, pod, container) (kube_pod_container_info))`,
+			"",
+		},
+		{
+			"memory.usage.bytes",
+			`sum by (namespace, pod, container) (windows_container_memory_usage_private_working_set_bytes * on (container_id) group_left (namespace, pod, container) max by (container_id, namespace, pod, container) (kube_pod_container_info))`,
+			"",
+		},
+	}
+)
+
+// windowsNodes returns a function that reports whether any node in the given store runs Windows
+// according to its operating system label.
+func windowsNodes(store kcache.Store) func() bool {
+	return func() bool {
+		for _, obj := range store.List() {
+			if node, ok := obj.(*kcorev1.Node); ok && node.Labels[kcorev1.LabelOSStable] == string(kcorev1.Windows) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// windowsPods returns a function that reports whether any pod in the given store runs on Windows,
+// i.e. it selects Windows nodes by their operating system label or it specifies Windows as its operating system.
+func windowsPods(store kcache.Store) func() bool {
+	return func() bool {
+		for _, obj := range store.List() {
+			pod, ok := obj.(*kcorev1.Pod)
+			if !ok {
+				continue
+			}
+
+			if pod.Spec.NodeSelector[kcorev1.LabelOSStable] == string(kcorev1.Windows) ||
+				(pod.Spec.OS != nil && pod.Spec.OS.Name == kcorev1.Windows) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	"github.com/pkg/errors"
+	"regexp"
+	"slices"
+)
+
+// identifier matches the names of tables and columns plugins may write to.
+var identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Config defines an external plugin process, which receives the objects of controllers and emits rows.
+type Config struct {
+	// Name identifies the plugin in logs.
+	Name string `yaml:"name"`
+	// Command is the path of the plugin's executable.
+	Command string `yaml:"command"`
+	// Args are passed to Command.
+	Args []string `yaml:"args"`
+	// Controllers whose objects are sent to the plugin.
+	Controllers []string `yaml:"controllers"`
+	// Tables the plugin may write to.
+	Tables []string `yaml:"tables"`
+}
+
+// Validate checks constraints in the supplied plugin configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Name == "" {
+		return errors.New("plugin name missing")
+	}
+
+	if c.Command == "" {
+		return errors.New("plugin command missing")
+	}
+
+	if len(c.Controllers) == 0 {
+		return errors.New("plugin controllers missing")
+	}
+
+	for _, controller := range c.Controllers {
+		if !slices.Contains(registry.Names(), controller) {
+			return errors.Errorf("unknown plugin controller %q", controller)
+		}
+	}
+
+	if len(c.Tables) == 0 {
+		return errors.New("plugin tables missing")
+	}
+
+	for _, table := range c.Tables {
+		if !identifier.MatchString(table) {
+			return errors.Errorf("invalid plugin table %q", table)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kcache "k8s.io/client-go/tools/cache"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+const (
+	// Upsert is the type of events of created or updated objects and of rows to insert or update.
+	Upsert = "upsert"
+	// Delete is the type of events of deleted objects and of rows to delete.
+	Delete = "delete"
+)
+
+// queueSize is the number of events buffered per plugin. Further events are dropped while the plugin can't keep up.
+const queueSize = 1024
+
+// maxLineSize is the maximum size of a row emitted by a plugin.
+const maxLineSize = 16 << 20
+
+// Event is written to the standard input of plugins as a single line of JSON
+// when an object of one of their controllers is created, updated or deleted.
+type Event struct {
+	Type        string `json:"type"`
+	Cluster     string `json:"cluster,omitempty"`
+	ClusterUuid string `json:"cluster_uuid"`
+	Controller  string `json:"controller"`
+	// Uuid of the object in the database, which rows of plugins can refer to.
+	Uuid string `json:"uuid"`
+	// Object is the Kubernetes object, except for deleted objects.
+	Object any `json:"object,omitempty"`
+}
+
+// Row is read from the standard output of plugins as a single line of JSON.
+// For upserts, Columns are inserted into Table or updated if the row already exists.
+// For deletes, all rows of Table matching all Columns are deleted.
+// Columns named uuid or ending with _uuid are converted from strings to binary UUIDs.
+type Row struct {
+	Type    string         `json:"type"`
+	Table   string         `json:"table"`
+	Columns map[string]any `json:"columns"`
+}
+
+// Plugin runs an external process, which receives the objects of controllers as Events and emits Rows
+// to write to the database, e.g. to enrich the synchronized objects with site-specific data.
+type Plugin struct {
+	config      *Config
+	db          *database.Database
+	cluster     string
+	clusterUuid types.UUID
+	queue       chan Event
+	log         logr.Logger
+}
+
+// NewPlugin creates a new Plugin for the cluster with the given name and UUID.
+func NewPlugin(c *Config, db *database.Database, cluster string, clusterUuid types.UUID, log logr.Logger) *Plugin {
+	return &Plugin{
+		config:      c,
+		db:          db,
+		cluster:     cluster,
+		clusterUuid: clusterUuid,
+		queue:       make(chan Event, queueSize),
+		log:         log,
+	}
+}
+
+// Watch sends the objects cached by informer that are accepted by filter, if set, to the plugin.
+// controller is the name of the controller running informer.
+func (p *Plugin) Watch(controller string, informer kcache.SharedIndexInformer, filter func(kmetav1.Object) bool) error {
+	upsert := func(obj any) {
+		// The store may also contain placeholders from warmup, which are replaced by the listed objects.
+		if _, placeholder := obj.(schemav1.Resource); placeholder {
+			return
+		}
+
+		if o := obj.(kmetav1.Object); filter == nil || filter(o) {
+			p.notify(Event{Type: Upsert, Controller: controller, Uuid: schemav1.EnsureUUID(o.GetUID()).String(), Object: o})
+		}
+	}
+
+	_, err := informer.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+		AddFunc: upsert,
+		UpdateFunc: func(_, obj any) {
+			upsert(obj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(kcache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if o, ok := obj.(kmetav1.Object); ok {
+				p.notify(Event{Type: Delete, Controller: controller, Uuid: schemav1.EnsureUUID(o.GetUID()).String()})
+			}
+		},
+	})
+
+	return errors.Wrapf(err, "can't watch %s for plugin %s", controller, p.config.Name)
+}
+
+// Run runs the plugin process until it exits or ctx is canceled. Processes that exit are supposed to be
+// restarted by running Run again, e.g. supervised. Events queued meanwhile are sent to the new process.
+func (p *Plugin) Run(ctx context.Context) error {
+	err := p.run(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return errors.Wrapf(err, "plugin %s exited", p.config.Name)
+}
+
+// notify queues the given event. If the queue is full, the event is dropped.
+func (p *Plugin) notify(e Event) {
+	e.Cluster = p.cluster
+	e.ClusterUuid = p.clusterUuid.String()
+
+	select {
+	case p.queue <- e:
+	default:
+		p.log.Info("Dropping event, as the plugin can't keep up", "controller", e.Controller, "uuid", e.Uuid)
+	}
+}
+
+// run runs the plugin process once until it exits or ctx is canceled.
+func (p *Plugin) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.config.Command, p.config.Args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "can't start plugin")
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	// Kill the process as soon as it can't be communicated with anymore, so that its output is closed.
+	context.AfterFunc(gCtx, cancel)
+
+	g.Go(func() error {
+		// Closing stdin signals the plugin to exit once the process isn't needed anymore.
+		defer func() { _ = stdin.Close() }()
+
+		enc := json.NewEncoder(stdin)
+		for {
+			select {
+			case e := <-p.queue:
+				if err := enc.Encode(e); err != nil {
+					return errors.Wrap(err, "can't write event to plugin")
+				}
+			case <-gCtx.Done():
+				return gCtx.Err()
+			}
+		}
+	})
+
+	g.Go(func() error {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, maxLineSize)
+
+		for scanner.Scan() {
+			var row Row
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				p.log.Error(errors.WithStack(err), "Can't parse row emitted by plugin")
+
+				continue
+			}
+
+			if err := p.write(gCtx, row); err != nil {
+				if gCtx.Err() != nil {
+					return gCtx.Err()
+				}
+
+				p.log.Error(err, "Can't write row emitted by plugin", "table", row.Table)
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return errors.Wrap(err, "can't read rows from plugin")
+		}
+
+		return errors.New("plugin closed its standard output")
+	})
+
+	g.Go(func() error {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			p.log.Info(scanner.Text())
+		}
+
+		return nil
+	})
+
+	err = g.Wait()
+	if waitErr := cmd.Wait(); waitErr != nil {
+		return errors.Wrap(waitErr, "plugin exited")
+	}
+
+	return err
+}
+
+// write writes the given row to the database.
+func (p *Plugin) write(ctx context.Context, row Row) error {
+	if !slices.Contains(p.config.Tables, row.Table) {
+		return errors.Errorf("table %q not allowed", row.Table)
+	}
+
+	if len(row.Columns) == 0 {
+		return errors.New("no columns")
+	}
+
+	columns := make([]string, 0, len(row.Columns))
+	values := make(map[string]any, len(row.Columns))
+	for column, value := range row.Columns {
+		if !identifier.MatchString(column) {
+			return errors.Errorf("invalid column %q", column)
+		}
+
+		if s, ok := value.(string); ok && (column == "uuid" || strings.HasSuffix(column, "_uuid")) {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				return errors.Wrapf(err, "invalid %s", column)
+			}
+
+			value = id[:]
+		}
+
+		columns = append(columns, column)
+		values[column] = value
+	}
+
+	slices.Sort(columns)
+
+	var stmt string
+	switch row.Type {
+	case Upsert:
+		stmt = p.db.BuildUpsertColumnsStmt(row.Table, columns)
+	case Delete:
+		where := make([]string, 0, len(columns))
+		for _, column := range columns {
+			where = append(where, fmt.Sprintf("%[1]s = :%[1]s", column))
+		}
+
+		stmt = fmt.Sprintf("DELETE FROM %s WHERE %s", row.Table, strings.Join(where, " AND "))
+	default:
+		return errors.Errorf("unknown row type %q", row.Type)
+	}
+
+	if _, err := p.db.NamedExecContext(ctx, stmt, values); err != nil {
+		return database.CantPerformQuery(err, stmt)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package probe
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Config defines how services and ingresses are probed.
+type Config struct {
+	// Interval in which services and ingresses are probed. If not set, nothing is probed.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout of each probe.
+	Timeout time.Duration `yaml:"timeout" default:"5s"`
+	// DnsNames are resolved via the cluster DNS in addition to kubernetes.default.
+	DnsNames []string `yaml:"dns_names"`
+}
+
+// Validate checks constraints in the supplied probes configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("probes interval must not be negative")
+	}
+
+	if c.Timeout <= 0 {
+		return errors.New("probes timeout must be positive")
+	}
+
+	if c.Interval > 0 && c.Timeout >= c.Interval {
+		return errors.New("probes timeout must be less than the interval")
+	}
+
+	return nil
+}
+
+// Enabled returns whether an interval is configured, so that services and ingresses are probed.
+func (c *Config) Enabled() bool {
+	return c.Interval > 0
+}
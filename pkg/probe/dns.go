@@ -0,0 +1,99 @@
+package probe
+
+import (
+	"context"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"strconv"
+)
+
+const (
+	// dnsService is the name of the cluster DNS service in the kube-system namespace,
+	// which CoreDNS keeps for compatibility with kube-dns.
+	dnsService = "kube-dns"
+	// defaultDnsName is always resolved, as it exists in every cluster.
+	defaultDnsName = "kubernetes.default"
+)
+
+// dnsTargets returns the probes of the default and configured names, resolved via the cluster DNS service.
+// If the service can't be retrieved, the probes fail with the reason as error.
+func (p *Prober) dnsTargets(ctx context.Context) []*schemav1.Probe {
+	server, err := p.dnsServer(ctx)
+
+	names := append([]string{defaultDnsName}, p.config.DnsNames...)
+	probes := make([]*schemav1.Probe, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		probe := &schemav1.Probe{
+			Kind:     schemav1.ProbeKindDns,
+			Name:     name,
+			Target:   server,
+			Protocol: schemav1.ProbeProtocolDns,
+		}
+		if err != nil {
+			p.fail(probe, err)
+		}
+
+		probes = append(probes, probe)
+	}
+
+	return probes
+}
+
+// dnsServer returns the address of the cluster DNS service.
+func (p *Prober) dnsServer(ctx context.Context) (string, error) {
+	service, err := p.clientset.CoreV1().Services(kmetav1.NamespaceSystem).Get(ctx, dnsService, kmetav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, "can't retrieve cluster DNS service")
+	}
+
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == kcorev1.ClusterIPNone {
+		return "", errors.New("cluster DNS service doesn't have a cluster IP")
+	}
+
+	port := "53"
+	for _, p := range service.Spec.Ports {
+		if p.Protocol == kcorev1.ProtocolUDP || p.Protocol == "" {
+			port = strconv.Itoa(int(p.Port))
+
+			break
+		}
+	}
+
+	return net.JoinHostPort(service.Spec.ClusterIP, port), nil
+}
+
+// resolve resolves the name of the given probe via its DNS server.
+// The search domains of the pod apply, so that short names such as kubernetes.default are resolvable.
+func (p *Prober) resolve(ctx context.Context, probe *schemav1.Probe) error {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := &net.Dialer{Timeout: p.config.Timeout}
+
+			return dialer.DialContext(ctx, network, probe.Target)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	addrs, err := resolver.LookupHost(ctx, probe.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(addrs) == 0 {
+		return errors.Errorf("no addresses found for %q", probe.Name)
+	}
+
+	return nil
+}
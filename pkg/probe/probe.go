@@ -0,0 +1,302 @@
+// Package probe checks the reachability of services and ingresses from the perspective of Icinga for Kubernetes,
+// which complements the status of the objects with end-to-end reachability,
+// and the resolution of names via the cluster DNS, whose failure affects all workloads of a cluster.
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	kcorev1 "k8s.io/api/core/v1"
+	knetworkingv1 "k8s.io/api/networking/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kcache "k8s.io/client-go/tools/cache"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// concurrency limits the number of simultaneous probes.
+const concurrency = 16
+
+// InCluster returns whether the API server at host is the one of the cluster Icinga for Kubernetes runs in,
+// so that cluster IPs of its services are reachable.
+func InCluster(host string) bool {
+	h, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if h == "" || port == "" {
+		return false
+	}
+
+	return strings.TrimSuffix(host, "/") == "https://"+net.JoinHostPort(h, port)
+}
+
+// Prober probes the ports of services via their cluster IP and the hosts of ingresses in the configured interval
+// and stores the results in the probe table, replacing the previous ones.
+// HTTP ports and ingress hosts are probed with a GET request of the root path, other ports by connecting via TCP.
+// Any HTTP response counts as reachable, its status code is stored as well.
+// Redirects are not followed and certificates are not verified, as only reachability is of interest.
+// If a clientset is set, kubernetes.default and the configured names are also resolved via the cluster DNS service.
+type Prober struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	config      *Config
+	services    kcache.Store
+	ingresses   kcache.Store
+	filter      func(kmetav1.Object) bool
+	clientset   kubernetes.Interface
+	client      *http.Client
+	log         logr.Logger
+}
+
+// NewProber creates a new Prober for the cluster with the given UUID that probes the services and ingresses
+// cached in the given stores, either of which may be nil, for which filter, if set, returns true.
+// DNS is only probed if clientset is not nil, which is used to look up the cluster DNS service.
+func NewProber(
+	db *database.Database,
+	clusterUuid types.UUID,
+	c *Config,
+	services kcache.Store,
+	ingresses kcache.Store,
+	filter func(kmetav1.Object) bool,
+	clientset kubernetes.Interface,
+	log logr.Logger,
+) *Prober {
+	return &Prober{
+		db:          db,
+		clusterUuid: clusterUuid,
+		config:      c,
+		services:    services,
+		ingresses:   ingresses,
+		filter:      filter,
+		clientset:   clientset,
+		client: &http.Client{
+			Transport: &http.Transport{
+				// Connections are not reused, so that each probe includes connecting.
+				DisableKeepAlives: true,
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, // #nosec G402
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Timeout: c.Timeout,
+		},
+		log: log,
+	}
+}
+
+// Run probes in the configured interval until ctx is canceled.
+func (p *Prober) Run(ctx context.Context) error {
+	for {
+		if err := p.Probe(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(p.config.Interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Probe probes all services, ingresses and DNS names and stores the results checked at the given time.
+func (p *Prober) Probe(ctx context.Context, now time.Time) error {
+	probes := p.targets()
+	if p.clientset != nil {
+		probes = append(probes, p.dnsTargets(ctx)...)
+	}
+	p.log.V(1).Info("Probing services, ingresses and DNS", "targets", len(probes))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, probe := range probes {
+		g.Go(func() error {
+			// Probes may already have failed, e.g. if the DNS server is unknown.
+			if !probe.Reachable.Valid {
+				p.probe(gctx, probe)
+			}
+			probe.Uuid = schemav1.NewUUID(
+				p.clusterUuid, strings.Join([]string{probe.Kind, probe.Namespace, probe.Name, probe.Target}, "/"))
+			probe.ClusterUuid = p.clusterUuid
+			probe.Checked = types.UnixMilli(now)
+
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entities := make(chan interface{}, len(probes))
+	for _, probe := range probes {
+		entities <- probe
+	}
+	close(entities)
+
+	if err := p.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store probes")
+	}
+
+	if _, err := p.db.ExecContext(ctx, p.db.Rebind(
+		"DELETE FROM probe WHERE cluster_uuid = ? AND checked < ?"), p.clusterUuid, now.UnixMilli(),
+	); err != nil {
+		return errors.Wrap(err, "can't delete outdated probes")
+	}
+
+	return nil
+}
+
+// targets returns the probes of the TCP ports of services with a cluster IP and of the hosts of ingresses,
+// except for wildcard hosts.
+func (p *Prober) targets() []*schemav1.Probe {
+	var probes []*schemav1.Probe
+
+	if p.services != nil {
+		for _, obj := range p.services.List() {
+			// The store may also contain placeholders from warmup.
+			service, ok := obj.(*kcorev1.Service)
+			if !ok || (p.filter != nil && !p.filter(service)) ||
+				service.Spec.ClusterIP == "" || service.Spec.ClusterIP == kcorev1.ClusterIPNone {
+				continue
+			}
+
+			for _, port := range service.Spec.Ports {
+				if port.Protocol != "" && port.Protocol != kcorev1.ProtocolTCP {
+					continue
+				}
+
+				protocol := serviceProtocol(port)
+				target := net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port.Port)))
+				if protocol != schemav1.ProbeProtocolTcp {
+					target = protocol + "://" + target + "/"
+				}
+
+				probes = append(probes, &schemav1.Probe{
+					Kind:      schemav1.ProbeKindService,
+					Namespace: service.Namespace,
+					Name:      service.Name,
+					Target:    target,
+					Protocol:  protocol,
+				})
+			}
+		}
+	}
+
+	if p.ingresses != nil {
+		for _, obj := range p.ingresses.List() {
+			ingress, ok := obj.(*knetworkingv1.Ingress)
+			if !ok || (p.filter != nil && !p.filter(ingress)) {
+				continue
+			}
+
+			tlsHosts := make(map[string]struct{})
+			for _, t := range ingress.Spec.TLS {
+				for _, host := range t.Hosts {
+					tlsHosts[host] = struct{}{}
+				}
+			}
+
+			probed := make(map[string]struct{})
+			for _, rule := range ingress.Spec.Rules {
+				if rule.Host == "" || strings.HasPrefix(rule.Host, "*") {
+					continue
+				}
+
+				if _, ok := probed[rule.Host]; ok {
+					continue
+				}
+				probed[rule.Host] = struct{}{}
+
+				protocol := schemav1.ProbeProtocolHttp
+				if _, ok := tlsHosts[rule.Host]; ok {
+					protocol = schemav1.ProbeProtocolHttps
+				}
+
+				probes = append(probes, &schemav1.Probe{
+					Kind:      schemav1.ProbeKindIngress,
+					Namespace: ingress.Namespace,
+					Name:      ingress.Name,
+					Target:    protocol + "://" + rule.Host + "/",
+					Protocol:  protocol,
+				})
+			}
+		}
+	}
+
+	return probes
+}
+
+// probe probes the target of the given probe and sets the result.
+func (p *Prober) probe(ctx context.Context, probe *schemav1.Probe) {
+	start := time.Now()
+
+	var err error
+	switch probe.Protocol {
+	case schemav1.ProbeProtocolDns:
+		err = p.resolve(ctx, probe)
+	case schemav1.ProbeProtocolTcp:
+		dialer := &net.Dialer{Timeout: p.config.Timeout}
+
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", probe.Target); err == nil {
+			_ = conn.Close()
+		}
+	default:
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, probe.Target, nil); err == nil {
+			var res *http.Response
+			if res, err = p.client.Do(req); err == nil {
+				_ = res.Body.Close()
+				probe.StatusCode.Int32 = int32(res.StatusCode)
+				probe.StatusCode.Valid = true
+			}
+		}
+	}
+
+	if err != nil {
+		p.fail(probe, err)
+
+		return
+	}
+
+	probe.Reachable = types.Bool{Bool: true, Valid: true}
+	probe.ResponseTime.Int64 = time.Since(start).Milliseconds()
+	probe.ResponseTime.Valid = true
+}
+
+// fail sets the given probe as unreachable due to err.
+func (p *Prober) fail(probe *schemav1.Probe, err error) {
+	probe.Reachable = types.Bool{Bool: false, Valid: true}
+	probe.Error = schemav1.NewNullableString(err.Error())
+}
+
+// serviceProtocol returns the protocol with which the given service port is probed,
+// derived from its application protocol or its name, e.g. http or https-metrics.
+func serviceProtocol(port kcorev1.ServicePort) string {
+	names := []string{port.Name}
+	if port.AppProtocol != nil {
+		names = append([]string{*port.AppProtocol}, names...)
+	}
+
+	for _, name := range names {
+		switch {
+		case name == "https" || strings.HasPrefix(name, "https-"):
+			return schemav1.ProbeProtocolHttps
+		case name == "http" || strings.HasPrefix(name, "http-"):
+			return schemav1.ProbeProtocolHttp
+		}
+	}
+
+	return schemav1.ProbeProtocolTcp
+}
@@ -0,0 +1,131 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+const (
+	// AcknowledgedAnnotation is set on pods to the author and comment of the latest acknowledgement of their problems.
+	AcknowledgedAnnotation = "kubernetes.icinga.com/acknowledged"
+	// CommentAnnotation is set on pods to the author and text of the latest comment of their problems.
+	CommentAnnotation = "kubernetes.icinga.com/comment"
+
+	// pollInterval is the interval in which new comments are polled from the database.
+	pollInterval = 10 * time.Second
+)
+
+// Annotator annotates acknowledgements and comments of problems, which are recorded in the problem_comment table,
+// e.g. by Icinga for Kubernetes Web, onto the pods of the problems.
+type Annotator struct {
+	db          *database.Database
+	clientset   *kubernetes.Clientset
+	clusterUuid types.UUID
+	pods        kcache.Store
+	log         logr.Logger
+}
+
+// NewAnnotator creates a new Annotator for the problems of the pods cached in the given store.
+func NewAnnotator(
+	db *database.Database, clientset *kubernetes.Clientset, clusterUuid types.UUID, pods kcache.Store, log logr.Logger,
+) *Annotator {
+	return &Annotator{
+		db:          db,
+		clientset:   clientset,
+		clusterUuid: clusterUuid,
+		pods:        pods,
+		log:         log,
+	}
+}
+
+// Run polls comments that haven't been annotated yet and annotates them until ctx is canceled.
+func (a *Annotator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.annotate(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (a *Annotator) annotate(ctx context.Context) error {
+	var comments []struct {
+		schemav1.ProblemComment
+		PodUuid   types.UUID
+		Namespace string
+		PodName   string
+	}
+	if err := a.db.SelectContext(ctx, &comments, a.db.Rebind(
+		"SELECT c.uuid, c.author, c.comment, c.acknowledgement, p.pod_uuid, p.namespace, p.pod_name"+
+			" FROM problem_comment c INNER JOIN problem p ON p.uuid = c.problem_uuid"+
+			" WHERE p.cluster_uuid = ? AND c.annotated IS NULL ORDER BY c.created"), a.clusterUuid); err != nil {
+		return errors.Wrap(err, "can't query problem comments")
+	}
+
+	for _, c := range comments {
+		key := CommentAnnotation
+		if c.Acknowledgement.Bool {
+			key = AcknowledgedAnnotation
+		}
+
+		if err := a.patch(ctx, c.PodUuid, c.Namespace, c.PodName, key, c.Author+": "+c.Comment); err != nil {
+			// Comments are retried with the next poll, unless the pod is gone for good.
+			if !kerrors.IsNotFound(err) {
+				a.log.Error(err, "Can't annotate problem comment", "pod", c.Namespace+"/"+c.PodName)
+
+				continue
+			}
+		}
+
+		if _, err := a.db.ExecContext(ctx, a.db.Rebind("UPDATE problem_comment SET annotated = ? WHERE uuid = ?"),
+			types.UnixMilli(time.Now()), c.Uuid); err != nil {
+			return errors.Wrap(err, "can't update problem comment")
+		}
+	}
+
+	return nil
+}
+
+// patch sets the given annotation on the pod with the given UUID, namespace and name.
+// Returns a NotFound error if the pod doesn't exist anymore, even if a pod with the same name has been created since.
+func (a *Annotator) patch(ctx context.Context, podUuid types.UUID, namespace, name, key, value string) error {
+	pod, ok := schemav1.LookupPod(a.pods, namespace, name)
+	if !ok || schemav1.PodUUID(pod) != podUuid {
+		return kerrors.NewNotFound(kcorev1.Resource("pods"), name)
+	}
+
+	// The UID makes the patch fail if the pod has been replaced meanwhile.
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"uid":         pod.UID,
+			"annotations": map[string]string{key: value},
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = a.clientset.CoreV1().Pods(namespace).Patch(ctx, name, ktypes.MergePatchType, patch, kmetav1.PatchOptions{})
+
+	return errors.WithStack(err)
+}
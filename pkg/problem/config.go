@@ -0,0 +1,8 @@
+package problem
+
+// AcknowledgementsConfig defines what happens with acknowledgements and comments of problems.
+type AcknowledgementsConfig struct {
+	// Annotate annotates acknowledgements and comments onto the pods of the problems,
+	// which requires permission to patch pods.
+	Annotate bool `yaml:"annotate"`
+}
@@ -0,0 +1,401 @@
+package problem
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"io"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kcache "k8s.io/client-go/tools/cache"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Unschedulable is the reason of problems of pods that can't be scheduled to any node.
+	Unschedulable = "Unschedulable"
+	// DefaultPendingAge is the time after which pending pods are considered unschedulable
+	// if no pod_pending_age threshold is configured.
+	DefaultPendingAge = 5 * time.Minute
+
+	// logLines is the number of log lines of the previous container instance captured with a problem
+	// and of failed containers of jobs.
+	logLines = 50
+	// maxEvents is the number of most recent events of the pod captured with a problem.
+	maxEvents = 10
+	// captureTimeout limits the time to capture logs and events, so that they don't block the synchronization.
+	captureTimeout = 10 * time.Second
+	// recheckInterval is the interval in which pending pods are evaluated again,
+	// as they become unschedulable once pending for long enough, without being updated.
+	recheckInterval = time.Minute
+)
+
+// reasons maps the waiting reasons of containers for which problems are raised to the reported reason.
+// ErrImagePull and ImagePullBackOff alternate while pulling is retried, so they are reported as the same problem.
+var reasons = map[string]string{
+	"CrashLoopBackOff":           "CrashLoopBackOff",
+	schemav1.ErrImagePull:        schemav1.ErrImagePullBackOff,
+	schemav1.ErrImagePullBackOff: schemav1.ErrImagePullBackOff,
+	"InvalidImageName":           "InvalidImageName",
+	"CreateContainerConfigError": "CreateContainerConfigError",
+	"CreateContainerError":       "CreateContainerError",
+}
+
+// Detector raises problems for containers waiting for one of the reasons above and for pods that can't be scheduled,
+// and clears them once resolved. It is used as upsert and delete callback of the pod synchronization.
+type Detector struct {
+	clientset   kubernetes.Interface
+	clusterUuid types.UUID
+	pods        kcache.Store
+	thresholds  func(namespace string) schemav1.Thresholds
+	inDowntime  func(*kcorev1.Pod) bool
+	log         logr.Logger
+	// problems contains the problems that haven't been cleared yet by the UUID of their container,
+	// or of their pod for problems of pods.
+	problems *Tracker[types.UUID, *schemav1.Problem]
+	// subjects serializes the evaluation of the same container or pod by updates and rechecks,
+	// striped by the first byte of its UUID.
+	subjects [16]sync.Mutex
+}
+
+// NewDetector creates a new Detector for the pods cached in the given store.
+// Pods are considered unschedulable once they have been pending for their pod_pending_age threshold,
+// the warning one if set, as returned by thresholds.
+// Problems of pods for which inDowntime, if set, returns true are marked as in downtime.
+// Pods annotated to be ignored don't have problems.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewDetector(
+	db *database.Database,
+	clientset kubernetes.Interface,
+	clusterUuid types.UUID,
+	pods kcache.Store,
+	thresholds func(namespace string) schemav1.Thresholds,
+	inDowntime func(*kcorev1.Pod) bool,
+	notify func(*schemav1.Problem),
+	log logr.Logger,
+) *Detector {
+	return &Detector{
+		clientset:   clientset,
+		clusterUuid: clusterUuid,
+		pods:        pods,
+		thresholds:  thresholds,
+		inDowntime:  inDowntime,
+		log:         log,
+		problems: NewTracker(db, "problem", subject, func(p *schemav1.Problem) []any {
+			return []any{"pod", p.Namespace + "/" + p.PodName, "container", p.ContainerName.String}
+		}, notify, log),
+	}
+}
+
+// Load loads the problems that haven't been cleared yet, so that they are cleared if resolved since the last run.
+// Must be called before the synchronization starts.
+func (d *Detector) Load(ctx context.Context) error {
+	return d.problems.Load(ctx, "cluster_uuid = ?", d.clusterUuid)
+}
+
+// Run evaluates the pending pods cached in the store again every minute until ctx is canceled,
+// so that they are considered unschedulable once pending for long enough even if they are not updated meanwhile.
+func (d *Detector) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-time.After(recheckInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := d.recheck(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// recheck evaluates the pending pods cached in the store again.
+func (d *Detector) recheck(ctx context.Context) error {
+	for _, obj := range d.pods.List() {
+		// The store may also contain placeholders from warmup, which are replaced by the listed objects.
+		k8s, ok := obj.(*kcorev1.Pod)
+		if !ok || k8s.Status.Phase != kcorev1.PodPending || schemav1.Ignored(k8s) {
+			continue
+		}
+
+		pod := &schemav1.Pod{}
+		pod.Uuid = schemav1.EnsureUUID(k8s.UID)
+		pod.Namespace = k8s.Namespace
+		pod.Name = k8s.Name
+
+		if err := d.updatePod(ctx, pod, k8s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Upserted raises and clears the problems of the given upserted pods and their containers.
+func (d *Detector) Upserted(ctx context.Context, bulk []any) error {
+	for _, entity := range bulk {
+		pod, ok := entity.(*schemav1.Pod)
+		if !ok {
+			continue
+		}
+
+		obj, exists, err := d.pods.GetByKey(pod.Namespace + "/" + pod.Name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// The pod may have been replaced or deleted meanwhile, which is handled by its own upsert or delete.
+		k8s, ok := obj.(*kcorev1.Pod)
+		if !exists || !ok || k8s.UID != pod.Uid {
+			continue
+		}
+
+		// Problems aren't raised for ignored pods and are cleared once pods are ignored.
+		if schemav1.Ignored(k8s) {
+			if err := d.Deleted(ctx, []any{pod.Uuid}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := d.updatePod(ctx, pod, k8s); err != nil {
+			return err
+		}
+
+		statuses := slices.Concat(k8s.Status.InitContainerStatuses, k8s.Status.ContainerStatuses)
+		for _, status := range statuses {
+			if err := d.updateContainer(ctx, pod, k8s, status); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Deleted clears the problems of the pods with the given IDs and their containers.
+func (d *Detector) Deleted(ctx context.Context, ids []any) error {
+	deleted := make(map[types.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		deleted[id.(types.UUID)] = struct{}{}
+	}
+
+	return d.problems.ClearFunc(ctx, func(_ types.UUID, p *schemav1.Problem) bool {
+		_, ok := deleted[p.PodUuid]
+
+		return ok
+	}, time.Now())
+}
+
+// updatePod raises or clears the unschedulable problem of the given pod.
+func (d *Detector) updatePod(ctx context.Context, pod *schemav1.Pod, k8s *kcorev1.Pod) error {
+	var reason, message string
+	if k8s.Status.Phase == kcorev1.PodPending && time.Since(k8s.CreationTimestamp.Time) >= d.pendingAge(k8s) {
+		for _, condition := range k8s.Status.Conditions {
+			if condition.Type == kcorev1.PodScheduled && condition.Status == kcorev1.ConditionFalse &&
+				condition.Reason == kcorev1.PodReasonUnschedulable {
+				reason = Unschedulable
+				message = condition.Message
+			}
+		}
+	}
+
+	return d.set(ctx, pod.Uuid, reason, k8s, func(_ context.Context, events []kcorev1.Event) *schemav1.Problem {
+		// The most recent FailedScheduling event explains why the scheduler couldn't place the pod
+		// in its latest attempt, whereas the condition may not have been updated since.
+		for _, e := range events {
+			if e.Reason == "FailedScheduling" {
+				message = e.Message
+
+				break
+			}
+		}
+
+		p := d.newProblem(pod, reason, message, k8s)
+		if c, ok := parseSchedulingFailure(message); ok {
+			p.BlockingConstraint = schemav1.NewNullableString(c.Type)
+			p.BlockingConstraintDetail = schemav1.NewNullableString(c.Detail)
+		}
+
+		return p
+	})
+}
+
+// updateContainer raises or clears the problem of the container with the given status.
+func (d *Detector) updateContainer(
+	ctx context.Context, pod *schemav1.Pod, k8s *kcorev1.Pod, status kcorev1.ContainerStatus,
+) error {
+	containerUuid := schemav1.ContainerUUID(pod.Uuid, status.Name)
+
+	var reason, message string
+	if status.State.Waiting != nil {
+		reason = reasons[status.State.Waiting.Reason]
+		message = status.State.Waiting.Message
+	}
+
+	return d.set(ctx, containerUuid, reason, k8s, func(ctx context.Context, _ []kcorev1.Event) *schemav1.Problem {
+		p := d.newProblem(pod, reason, message, k8s)
+		p.ContainerUuid = containerUuid.UUID[:]
+		p.ContainerName = schemav1.NewNullableString(status.Name)
+
+		// Crashing containers have been running before, so their last logs usually explain why.
+		if reason == "CrashLoopBackOff" {
+			logs, err := captureLogs(ctx, d.clientset, k8s, status.Name, true)
+			if err != nil {
+				d.log.Error(err, "Can't capture logs of crashing container",
+					"pod", pod.Namespace+"/"+pod.Name, "container", status.Name)
+			}
+			p.Logs = schemav1.NewNullableString(logs)
+		}
+
+		return p
+	})
+}
+
+// set raises a problem with the given reason for the container or pod with the given UUID unless one is already open.
+// An open problem with a different reason is cleared first, so an empty reason only clears.
+// newProblem creates the problem to raise from the most recent events of the given pod.
+func (d *Detector) set(
+	ctx context.Context,
+	id types.UUID,
+	reason string,
+	k8s *kcorev1.Pod,
+	newProblem func(context.Context, []kcorev1.Event) *schemav1.Problem,
+) error {
+	lock := &d.subjects[int(id.UUID[0])%len(d.subjects)]
+	lock.Lock()
+	defer lock.Unlock()
+
+	return d.problems.Update(ctx, id, reason, nil, func() *schemav1.Problem {
+		captureCtx, cancel := context.WithTimeout(ctx, captureTimeout)
+		defer cancel()
+
+		events, err := captureEvents(captureCtx, d.clientset, k8s.Namespace, k8s.UID)
+		if err != nil {
+			d.log.Error(err, "Can't capture events of pod", "pod", k8s.Namespace+"/"+k8s.Name)
+		}
+
+		p := newProblem(captureCtx, events)
+		p.Uuid = schemav1.NewUUID(id, fmt.Sprintf("%s:%d", reason, p.Started.Time().UnixMilli()))
+		p.Events = schemav1.NewNullableString(formatEvents(events))
+
+		return p
+	}, time.Now())
+}
+
+// newProblem returns a problem of the given pod started now.
+func (d *Detector) newProblem(pod *schemav1.Pod, reason, message string, k8s *kcorev1.Pod) *schemav1.Problem {
+	return &schemav1.Problem{
+		ClusterUuid: d.clusterUuid,
+		PodUuid:     pod.Uuid,
+		Namespace:   pod.Namespace,
+		PodName:     pod.Name,
+		Reason:      reason,
+		Message:     schemav1.NewNullableString(message),
+		InDowntime: types.Bool{
+			Bool:  d.inDowntime != nil && d.inDowntime(k8s),
+			Valid: true,
+		},
+		Started: types.UnixMilli(time.Now()),
+	}
+}
+
+// pendingAge returns the time after which the given pending pod is considered unschedulable.
+func (d *Detector) pendingAge(pod *kcorev1.Pod) time.Duration {
+	if d.thresholds != nil {
+		threshold := d.thresholds(pod.Namespace).WithAnnotations(pod.Annotations).PodPendingAge
+		if threshold.Warning > 0 {
+			return threshold.Warning
+		}
+		if threshold.Critical > 0 {
+			return threshold.Critical
+		}
+	}
+
+	return DefaultPendingAge
+}
+
+// captureLogs returns the last log lines of the given container, or of its previous instance if previous is true.
+func captureLogs(
+	ctx context.Context, clientset kubernetes.Interface, pod *kcorev1.Pod, container string, previous bool,
+) (string, error) {
+	tailLines := int64(logLines)
+	body, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &kcorev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+		TailLines: &tailLines,
+	}).Stream(ctx)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer func() { _ = body.Close() }()
+
+	logs, err := io.ReadAll(io.LimitReader(body, schemav1.MaxLogLength))
+
+	return string(logs), errors.WithStack(err)
+}
+
+// captureEvents returns the events of the object with the given namespace and UID, most recent first.
+func captureEvents(
+	ctx context.Context, clientset kubernetes.Interface, namespace string, uid ktypes.UID,
+) ([]kcorev1.Event, error) {
+	list, err := clientset.CoreV1().Events(namespace).List(ctx, kmetav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.uid", string(uid)).String(),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	events := list.Items
+	slices.SortFunc(events, func(a, b kcorev1.Event) int {
+		return lastSeen(b).Compare(lastSeen(a))
+	})
+
+	return events, nil
+}
+
+// formatEvents returns the most recent of the given events, one per line.
+func formatEvents(events []kcorev1.Event) string {
+	lines := make([]string, 0, maxEvents)
+	for _, e := range events[:min(len(events), maxEvents)] {
+		lines = append(lines, fmt.Sprintf(
+			"%s %s %s (x%d): %s", lastSeen(e).UTC().Format(time.RFC3339), e.Type, e.Reason, max(e.Count, 1), e.Message))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// lastSeen returns when the given event was last observed.
+func lastSeen(e kcorev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case e.Series != nil:
+		return e.Series.LastObservedTime.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
+
+// subject returns the UUID of the container of the given problem, or of its pod for problems of pods.
+func subject(p *schemav1.Problem) types.UUID {
+	if id, err := uuid.FromBytes(p.ContainerUuid); err == nil {
+		return types.UUID{UUID: id}
+	}
+
+	return p.PodUuid
+}
@@ -0,0 +1,211 @@
+package problem
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/go-logr/logr"
+	igldatabase "github.com/icinga/icinga-go-library/database"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/jmoiron/sqlx"
+	"io"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kcache "k8s.io/client-go/tools/cache"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDetectorRecheck verifies that pods become unschedulable once pending for their threshold without being updated.
+func TestDetectorRecheck(t *testing.T) {
+	ctx := context.Background()
+	db, stmts := newTestDatabase(t)
+
+	pod := &kcorev1.Pod{
+		ObjectMeta: kmetav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "pending",
+			UID:               "pending",
+			CreationTimestamp: kmetav1.Now(),
+		},
+		Status: kcorev1.PodStatus{
+			Phase: kcorev1.PodPending,
+			Conditions: []kcorev1.PodCondition{{
+				Type:    kcorev1.PodScheduled,
+				Status:  kcorev1.ConditionFalse,
+				Reason:  kcorev1.PodReasonUnschedulable,
+				Message: "0/3 nodes are available: 3 Insufficient cpu.",
+			}},
+		},
+	}
+
+	pods := kcache.NewStore(kcache.MetaNamespaceKeyFunc)
+	if err := pods.Add(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	var raised []*schemav1.Problem
+	d := NewDetector(
+		db, fake.NewSimpleClientset(), types.UUID{}, pods,
+		func(string) schemav1.Thresholds {
+			return schemav1.Thresholds{PodPendingAge: schemav1.Threshold[time.Duration]{Warning: 100 * time.Millisecond}}
+		},
+		nil,
+		func(p *schemav1.Problem) { raised = append(raised, p) },
+		logr.Discard())
+
+	if err := d.recheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(raised) != 0 {
+		t.Fatalf("pod that has just been created is unschedulable: %v", raised[0].Message.String)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if err := d.recheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(raised) != 1 || raised[0].Reason != Unschedulable {
+		t.Fatalf("pod pending longer than its threshold raised %d problems, expected 1 unschedulable one", len(raised))
+	}
+	if c := raised[0].BlockingConstraint.String; c != InsufficientResources {
+		t.Errorf("blocking constraint is %q, expected %q", c, InsufficientResources)
+	}
+	if n := stmts.count("INSERT INTO `problem`"); n != 1 {
+		t.Errorf("problem inserted %d times, expected once", n)
+	}
+
+	// Open problems aren't raised again.
+	if err := d.recheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(raised) != 1 {
+		t.Errorf("open problem raised again")
+	}
+}
+
+// statements records the statements executed by the database returned by newTestDatabase
+// and holds the rows returned by its queries.
+type statements struct {
+	mu    sync.Mutex
+	stmts []string
+	// columns and rows are the result of every query.
+	columns []string
+	rows    [][]driver.Value
+}
+
+// result sets the result of every query.
+func (s *statements) result(columns []string, rows ...[]driver.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.columns = columns
+	s.rows = rows
+}
+
+// count returns the number of executed statements with the given prefix.
+func (s *statements) count(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, stmt := range s.stmts {
+		if strings.HasPrefix(stmt, prefix) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// newTestDatabase returns a MySQL database that records executed statements instead of executing them.
+func newTestDatabase(t *testing.T) (*database.Database, *statements) {
+	stmts := &statements{}
+	db := sqlx.NewDb(sql.OpenDB(connector{stmts}), database.MySQL)
+	t.Cleanup(func() { _ = db.Close() })
+
+	return database.New(db, igldatabase.Options{}, logr.Discard()), stmts
+}
+
+type connector struct {
+	stmts *statements
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return conn(c), nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return nil
+}
+
+// conn records statements executed via ExecContext and QueryContext and fails everything else.
+type conn struct {
+	stmts *statements
+}
+
+func (c conn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.stmts.mu.Lock()
+	defer c.stmts.mu.Unlock()
+
+	c.stmts.stmts = append(c.stmts.stmts, query)
+
+	return driver.RowsAffected(1), nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.stmts.mu.Lock()
+	defer c.stmts.mu.Unlock()
+
+	c.stmts.stmts = append(c.stmts.stmts, query)
+
+	return &rows{columns: c.stmts.columns, rows: c.stmts.rows}, nil
+}
+
+// CheckNamedValue accepts all arguments, as they are not used.
+func (c conn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c conn) Prepare(string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c conn) Close() error {
+	return nil
+}
+
+func (c conn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+// rows returns the given rows in order.
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package problem
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kbatchv1 "k8s.io/api/batch/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kcache "k8s.io/client-go/tools/cache"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobFailures records failed pods of jobs to the job_failure table along with the final logs of their failed
+// containers and the events of the pods and their jobs, so that failed batch jobs can be triaged
+// even after their pods have been deleted. It is used as upsert and delete callback of the pod synchronization.
+type JobFailures struct {
+	db          *database.Database
+	clientset   *kubernetes.Clientset
+	clusterUuid types.UUID
+	pods        kcache.Store
+	log         logr.Logger
+	mu          sync.Mutex
+	recorded    map[types.UUID]struct{}
+}
+
+// NewJobFailures creates a new JobFailures for the pods cached in the given store.
+func NewJobFailures(
+	db *database.Database, clientset *kubernetes.Clientset, clusterUuid types.UUID, pods kcache.Store, log logr.Logger,
+) *JobFailures {
+	return &JobFailures{
+		db:          db,
+		clientset:   clientset,
+		clusterUuid: clusterUuid,
+		pods:        pods,
+		log:         log,
+		recorded:    make(map[types.UUID]struct{}),
+	}
+}
+
+// Load loads the pods whose failures have already been recorded, so that their logs and events aren't captured again.
+// Must be called before the synchronization starts.
+func (j *JobFailures) Load(ctx context.Context) error {
+	var failures []struct {
+		PodUuid types.UUID
+	}
+	if err := j.db.SelectContext(ctx, &failures, j.db.Rebind(
+		"SELECT pod_uuid FROM job_failure WHERE cluster_uuid = ?"), j.clusterUuid); err != nil {
+		return errors.Wrap(err, "can't load job failures")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, f := range failures {
+		j.recorded[f.PodUuid] = struct{}{}
+	}
+
+	return nil
+}
+
+// Upserted records the failures of the given upserted pods of jobs. Each pod fails at most once.
+func (j *JobFailures) Upserted(ctx context.Context, bulk []any) error {
+	for _, entity := range bulk {
+		pod, ok := entity.(*schemav1.Pod)
+		if !ok || pod.Phase != string(kcorev1.PodFailed) {
+			continue
+		}
+
+		j.mu.Lock()
+		_, recorded := j.recorded[pod.Uuid]
+		j.mu.Unlock()
+		if recorded {
+			continue
+		}
+
+		obj, exists, err := j.pods.GetByKey(pod.Namespace + "/" + pod.Name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// The pod may have been replaced or deleted meanwhile, so that its logs are gone anyway.
+		k8s, ok := obj.(*kcorev1.Pod)
+		if !exists || !ok || k8s.UID != pod.Uid {
+			continue
+		}
+
+		job := kmetav1.GetControllerOf(k8s)
+		if job == nil || job.Kind != "Job" || job.APIVersion != kbatchv1.SchemeGroupVersion.String() {
+			continue
+		}
+
+		failure := j.capture(ctx, pod, k8s, job)
+
+		stmt, _ := j.db.BuildUpsertStmt(failure)
+		if _, err := j.db.NamedExecContext(ctx, stmt, failure); err != nil {
+			return errors.Wrap(err, "can't insert job failure")
+		}
+
+		j.mu.Lock()
+		j.recorded[pod.Uuid] = struct{}{}
+		j.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Deleted forgets the pods with the given IDs.
+func (j *JobFailures) Deleted(_ context.Context, ids []any) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, id := range ids {
+		delete(j.recorded, id.(types.UUID))
+	}
+
+	return nil
+}
+
+// capture returns the failure of the given pod of the given job with the logs of its failed containers
+// and the events of the pod and the job. Logs and events that can't be captured are logged and left out.
+func (j *JobFailures) capture(
+	ctx context.Context, pod *schemav1.Pod, k8s *kcorev1.Pod, job *kmetav1.OwnerReference,
+) *schemav1.JobFailure {
+	failure := &schemav1.JobFailure{
+		Uuid:        schemav1.NewUUID(pod.Uuid, "job-failure"),
+		ClusterUuid: j.clusterUuid,
+		JobUuid:     schemav1.EnsureUUID(job.UID),
+		PodUuid:     pod.Uuid,
+		Namespace:   pod.Namespace,
+		JobName:     job.Name,
+		PodName:     pod.Name,
+		Reason:      k8s.Status.Reason,
+		Message:     schemav1.NewNullableString(k8s.Status.Message),
+		Failed:      types.UnixMilli(time.Now()),
+	}
+
+	captureCtx, cancel := context.WithTimeout(ctx, captureTimeout)
+	defer cancel()
+
+	var logs []string
+	for _, status := range slices.Concat(k8s.Status.InitContainerStatuses, k8s.Status.ContainerStatuses) {
+		terminated := status.State.Terminated
+		if terminated == nil || terminated.ExitCode == 0 {
+			continue
+		}
+
+		if !failure.ContainerName.Valid {
+			failure.ContainerName = schemav1.NewNullableString(status.Name)
+			failure.ExitCode = sql.NullInt32{Int32: terminated.ExitCode, Valid: true}
+			if failure.Reason == "" {
+				failure.Reason = terminated.Reason
+			}
+			if !failure.Message.Valid {
+				failure.Message = schemav1.NewNullableString(terminated.Message)
+			}
+			if !terminated.FinishedAt.IsZero() {
+				failure.Failed = types.UnixMilli(terminated.FinishedAt.Time)
+			}
+		}
+
+		l, err := captureLogs(captureCtx, j.clientset, k8s, status.Name, false)
+		if err != nil {
+			j.log.Error(err, "Can't capture logs of failed container of job",
+				"pod", pod.Namespace+"/"+pod.Name, "container", status.Name)
+		}
+		if l != "" {
+			logs = append(logs, fmt.Sprintf("==> %s <==\n%s", status.Name, l))
+		}
+	}
+	failure.Logs = schemav1.NewNullableString(strings.Join(logs, "\n"))
+
+	if failure.Reason == "" {
+		failure.Reason = string(kcorev1.PodFailed)
+	}
+
+	var events []kcorev1.Event
+	for _, uid := range []ktypes.UID{k8s.UID, job.UID} {
+		e, err := captureEvents(captureCtx, j.clientset, k8s.Namespace, uid)
+		if err != nil {
+			j.log.Error(err, "Can't capture events of failed pod of job", "pod", pod.Namespace+"/"+pod.Name)
+		}
+
+		events = append(events, e...)
+	}
+	slices.SortFunc(events, func(a, b kcorev1.Event) int {
+		return lastSeen(b).Compare(lastSeen(a))
+	})
+	failure.Events = schemav1.NewNullableString(formatEvents(events))
+
+	return failure
+}
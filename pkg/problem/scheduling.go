@@ -0,0 +1,107 @@
+package problem
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Types of constraints that prevent pods from being scheduled.
+const (
+	InsufficientResources = "insufficient_resources"
+	Taint                 = "taint"
+	NodeAffinity          = "node_affinity"
+	PodAffinity           = "pod_affinity"
+	Volume                = "volume"
+	Other                 = "other"
+)
+
+// constraint prevents a pod from being scheduled to a number of nodes.
+type constraint struct {
+	Type string
+	// Detail is the insufficient resource, the untolerated taint or the unmatched rule, if known.
+	Detail string
+	Nodes  int
+}
+
+// parseSchedulingFailure returns the constraint that prevents the pod from being scheduled to most nodes
+// according to the given scheduler message, e.g. "0/3 nodes are available: 1 Insufficient cpu,
+// 2 node(s) had untolerated taint {node-role.kubernetes.io/control-plane: }. preemption: ...".
+func parseSchedulingFailure(message string) (constraint, bool) {
+	_, reasons, ok := strings.Cut(message, "are available: ")
+	if !ok {
+		if message == "" {
+			return constraint{}, false
+		}
+
+		return constraint{Type: Other, Detail: truncate(message)}, true
+	}
+
+	// The scheduler appends the outcome of preemption, which doesn't explain why the pod doesn't fit.
+	reasons, _, _ = strings.Cut(reasons, " preemption:")
+	reasons = strings.TrimSuffix(strings.TrimSpace(reasons), ".")
+
+	var blocking constraint
+	var found bool
+	for _, reason := range strings.Split(reasons, ", ") {
+		c := parseConstraint(strings.TrimSpace(reason))
+		if !found || c.Nodes > blocking.Nodes {
+			blocking = c
+			found = true
+		}
+	}
+
+	return blocking, found
+}
+
+// parseConstraint parses a single reason of a scheduler message, e.g. "1 Insufficient cpu".
+func parseConstraint(reason string) constraint {
+	var c constraint
+	if count, rest, ok := strings.Cut(reason, " "); ok {
+		if n, err := strconv.Atoi(count); err == nil {
+			c.Nodes = n
+			reason = rest
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(reason, "Insufficient "):
+		c.Type = InsufficientResources
+		c.Detail = strings.TrimPrefix(reason, "Insufficient ")
+	case reason == "Too many pods":
+		c.Type = InsufficientResources
+		c.Detail = "pods"
+	case strings.Contains(reason, "taint"):
+		c.Type = Taint
+		if start := strings.Index(reason, "{"); start >= 0 {
+			taint := strings.TrimSuffix(reason[start+1:], "}")
+			taint, _, _ = strings.Cut(taint, ":")
+			c.Detail = strings.TrimSpace(taint)
+		}
+	case strings.Contains(reason, "node affinity/selector"):
+		c.Type = NodeAffinity
+	case strings.Contains(reason, "volume") || strings.Contains(reason, "PersistentVolumeClaim"):
+		// Also covers volume node affinity conflicts, which are due to the volume rather than the pod.
+		c.Type = Volume
+		c.Detail = reason
+	case strings.Contains(reason, "affinity") || strings.Contains(reason, "spread constraints"):
+		// Pod affinity and anti-affinity rules as well as topology spread constraints relate to other pods.
+		c.Type = PodAffinity
+		c.Detail = reason
+	default:
+		c.Type = Other
+		c.Detail = reason
+	}
+
+	c.Detail = truncate(c.Detail)
+
+	return c
+}
+
+// truncate truncates s to the length of the blocking_constraint_detail column.
+func truncate(s string) string {
+	if r := []rune(s); len(r) > 255 {
+		return string(r[:255])
+	}
+
+	return s
+}
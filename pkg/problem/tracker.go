@@ -0,0 +1,194 @@
+package problem
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// Problem is a row of a problem table with a uuid, reason and cleared column, e.g. *schemav1.CronJobProblem.
+type Problem interface {
+	GetUuid() types.UUID
+	GetReason() string
+	SetCleared(types.UnixMilli)
+}
+
+// Tracker raises and clears the problems of a problem table, in which each subject, e.g. a cron job,
+// has at most one open problem. Subjects are identified by the key of their problems and evaluated by the caller,
+// which passes the reason of the problem of a subject, if any, to Update.
+// Updates of the same subject must not be concurrent.
+type Tracker[K comparable, P Problem] struct {
+	db       *database.Database
+	noun     string
+	key      func(P) K
+	describe func(P) []any
+	notify   func(P)
+	log      logr.Logger
+	mu       sync.Mutex
+	// open contains the problems that haven't been cleared yet by the key of their subject.
+	open   map[K]P
+	loaded bool
+}
+
+// NewTracker creates a new Tracker whose problems are referred to as noun, e.g. "cron job problem",
+// in log messages and errors. key returns the key of the subject of a problem
+// and describe the key-value pairs that identify a problem in log messages.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewTracker[K comparable, P Problem](
+	db *database.Database, noun string, key func(P) K, describe func(P) []any, notify func(P), log logr.Logger,
+) *Tracker[K, P] {
+	return &Tracker[K, P]{
+		db:       db,
+		noun:     noun,
+		key:      key,
+		describe: describe,
+		notify:   notify,
+		log:      log,
+		open:     make(map[K]P),
+	}
+}
+
+// Load loads the problems that haven't been cleared yet and whose rows match the given condition,
+// e.g. "cluster_uuid = ?", with the given arguments, unless already loaded.
+func (t *Tracker[K, P]) Load(ctx context.Context, where string, args ...any) error {
+	t.mu.Lock()
+	loaded := t.loaded
+	t.mu.Unlock()
+
+	if loaded {
+		return nil
+	}
+
+	var subject P
+	var problems []P
+	if err := t.db.SelectContext(ctx, &problems, t.db.Rebind(
+		t.db.BuildSelectStmt(subject, subject)+" WHERE "+where+" AND cleared IS NULL"), args...); err != nil {
+		return errors.Wrapf(err, "can't load %ss", t.noun)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range problems {
+		t.open[t.key(p)] = p
+	}
+	t.loaded = true
+
+	return nil
+}
+
+// Open returns the open problem of the subject with the given key, if any.
+func (t *Tracker[K, P]) Open(key K) (P, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.open[key]
+
+	return p, ok
+}
+
+// Update raises a problem with the given reason for the subject with the given key unless one is already open.
+// An open problem with a different reason, or for which current, if set, returns false, is cleared first,
+// so an empty reason only clears. newProblem creates the problem to raise.
+func (t *Tracker[K, P]) Update(
+	ctx context.Context, key K, reason string, current func(P) bool, newProblem func() P, now time.Time,
+) error {
+	if open, ok := t.Open(key); ok {
+		if open.GetReason() == reason && (current == nil || current(open)) {
+			return nil
+		}
+
+		if err := t.clear(ctx, key, open, now); err != nil {
+			return err
+		}
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	p := newProblem()
+
+	t.log.V(1).Info("Raising "+t.noun, append(t.describe(p), "reason", reason)...)
+
+	stmt, _ := t.db.BuildUpsertStmt(p)
+	if _, err := t.db.NamedExecContext(ctx, stmt, p); err != nil {
+		return errors.Wrapf(err, "can't insert %s", t.noun)
+	}
+
+	t.mu.Lock()
+	t.open[key] = p
+	t.mu.Unlock()
+
+	if t.notify != nil {
+		t.notify(p)
+	}
+
+	return nil
+}
+
+// Clear clears the open problem of the subject with the given key, if any.
+func (t *Tracker[K, P]) Clear(ctx context.Context, key K, now time.Time) error {
+	if open, ok := t.Open(key); ok {
+		return t.clear(ctx, key, open, now)
+	}
+
+	return nil
+}
+
+// ClearFunc clears the open problems for which clear returns true, e.g. of subjects that no longer exist.
+// They are forgotten at once, so that concurrent updates of their subjects don't clear them again.
+func (t *Tracker[K, P]) ClearFunc(ctx context.Context, clear func(K, P) bool, now time.Time) error {
+	t.mu.Lock()
+	var cleared []P
+	for key, p := range t.open {
+		if clear(key, p) {
+			cleared = append(cleared, p)
+			delete(t.open, key)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, p := range cleared {
+		if err := t.markCleared(ctx, p, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clear clears the given open problem of the subject with the given key.
+func (t *Tracker[K, P]) clear(ctx context.Context, key K, p P, now time.Time) error {
+	if err := t.markCleared(ctx, p, now); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	delete(t.open, key)
+	t.mu.Unlock()
+
+	return nil
+}
+
+// markCleared marks the given problem as cleared at the given time.
+func (t *Tracker[K, P]) markCleared(ctx context.Context, p P, now time.Time) error {
+	t.log.V(1).Info("Clearing "+t.noun, append(t.describe(p), "reason", p.GetReason())...)
+
+	p.SetCleared(types.UnixMilli(now))
+	if _, err := t.db.ExecContext(ctx, t.db.Rebind(
+		"UPDATE "+database.TableName(p)+" SET cleared = ? WHERE uuid = ?"), types.UnixMilli(now), p.GetUuid(),
+	); err != nil {
+		return errors.Wrapf(err, "can't clear %s", t.noun)
+	}
+
+	if t.notify != nil {
+		t.notify(p)
+	}
+
+	return nil
+}
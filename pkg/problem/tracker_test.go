@@ -0,0 +1,128 @@
+package problem
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"testing"
+	"time"
+)
+
+// TestTracker verifies that loaded problems are kept open, that a subject has at most one open problem,
+// which is replaced once its reason changes, and that problems are cleared individually and by predicate.
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	db, stmts := newTestDatabase(t)
+
+	var notified []*schemav1.CronJobProblem
+	tracker := NewTracker(
+		db,
+		"cron job problem",
+		func(p *schemav1.CronJobProblem) types.UUID { return p.CronJobUuid },
+		func(p *schemav1.CronJobProblem) []any { return nil },
+		func(p *schemav1.CronJobProblem) { notified = append(notified, p) },
+		logr.Discard())
+
+	loaded := schemav1.NewUUID(types.UUID{}, "loaded")
+	raised := schemav1.NewUUID(types.UUID{}, "raised")
+	open := schemav1.NewUUID(loaded, "MissedSchedule")
+	now := time.Now()
+
+	stmts.result(
+		[]string{"uuid", "cron_job_uuid", "reason", "scheduled", "started"},
+		[]driver.Value{
+			open.UUID[:], loaded.UUID[:], "MissedSchedule",
+			now.Add(-time.Hour).UnixMilli(), now.Add(-time.Hour).UnixMilli(),
+		})
+
+	for i := 0; i < 2; i++ {
+		if err := tracker.Load(ctx, "cluster_uuid = ?", types.UUID{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := stmts.count("SELECT"); n != 1 {
+		t.Errorf("problems loaded %d times, expected once", n)
+	}
+	if p, ok := tracker.Open(loaded); !ok || p.Reason != "MissedSchedule" {
+		t.Fatalf("loaded problem is not open")
+	}
+
+	update := func(id types.UUID, reason string) error {
+		return tracker.Update(ctx, id, reason, nil, func() *schemav1.CronJobProblem {
+			return &schemav1.CronJobProblem{Uuid: schemav1.NewUUID(id, reason), CronJobUuid: id, Reason: reason}
+		}, now)
+	}
+
+	tests := []struct {
+		name     string
+		id       types.UUID
+		reason   string
+		inserted int
+		cleared  int
+	}{
+		{name: "loaded problem isn't raised again", id: loaded, reason: "MissedSchedule"},
+		{name: "changed reason replaces loaded problem", id: loaded, reason: "Overlapping", inserted: 1, cleared: 1},
+		{name: "new problem is raised", id: raised, reason: "MissedSchedule", inserted: 2, cleared: 1},
+		{name: "open problem isn't raised again", id: raised, reason: "MissedSchedule", inserted: 2, cleared: 1},
+		{name: "empty reason clears", id: raised, inserted: 2, cleared: 2},
+		{name: "empty reason without open problem is a no-op", id: raised, inserted: 2, cleared: 2},
+	}
+
+	for _, tt := range tests {
+		if err := update(tt.id, tt.reason); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := stmts.count("INSERT INTO `cron_job_problem`"); n != tt.inserted {
+			t.Errorf("%s: problems inserted %d times, expected %d", tt.name, n, tt.inserted)
+		}
+		if n := stmts.count("UPDATE cron_job_problem SET cleared"); n != tt.cleared {
+			t.Errorf("%s: problems cleared %d times, expected %d", tt.name, n, tt.cleared)
+		}
+	}
+
+	if len(notified) != 4 {
+		t.Fatalf("notified of %d problems, expected 4", len(notified))
+	}
+	if notified[0].Cleared.Time().IsZero() || notified[0].CronJobUuid != loaded {
+		t.Errorf("first notification isn't of the cleared loaded problem")
+	}
+	if !notified[1].Cleared.Time().IsZero() || notified[1].Reason != "Overlapping" {
+		t.Errorf("second notification isn't of the raised replacement")
+	}
+
+	if err := update(raised, "MissedSchedule"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracker.Clear(ctx, raised, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Open(raised); ok {
+		t.Errorf("cleared problem is still open")
+	}
+
+	if err := tracker.ClearFunc(ctx, func(id types.UUID, _ *schemav1.CronJobProblem) bool {
+		return id == loaded
+	}, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Open(loaded); ok {
+		t.Errorf("problem cleared by predicate is still open")
+	}
+
+	// Neither Clear nor ClearFunc clear anything if no problem is open.
+	if err := tracker.Clear(ctx, raised, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.ClearFunc(ctx, func(types.UUID, *schemav1.CronJobProblem) bool { return true }, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := stmts.count("UPDATE cron_job_problem SET cleared"); n != 4 {
+		t.Errorf("problems cleared %d times, expected 4", n)
+	}
+}
@@ -0,0 +1,341 @@
+// Package pullsecret audits the image pull secrets of a cluster, i.e. which workloads reference which secrets,
+// which workloads pull from private registries without a secret and which secrets are referenced by nothing.
+package pullsecret
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/imagepull"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/workload"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kcache "k8s.io/client-go/tools/cache"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// interval is the interval in which image pull secrets are audited.
+	interval = time.Hour
+	// unauthorizedWindow is the time for which unauthorized image pulls mark their registry as private.
+	unauthorizedWindow = 30 * 24 * time.Hour
+)
+
+// secret is an image pull secret with the registries it has credentials for.
+type secret struct {
+	namespace  string
+	name       string
+	registries map[string]struct{}
+}
+
+// Auditor audits the image pull secrets of a cluster every hour and stores which workloads reference which secrets
+// in the image_pull_secret_usage table and its findings in the image_pull_secret_issue table,
+// replacing the previous ones. Registries are considered private if any image pull secret has credentials for them
+// or pulls from them recently failed as unauthorized. As nodes may have credentials for registries themselves,
+// e.g. via credential providers of cloud registries, workloads without secret are not necessarily broken.
+// Pods are taken from the informer run by the pods controller, whereas secrets and service accounts are listed
+// every time, as the data of secrets isn't cached by the informers.
+type Auditor struct {
+	clientset   kubernetes.Interface
+	db          *database.Database
+	clusterUuid types.UUID
+	namespaces  func(string) bool
+	log         logr.Logger
+}
+
+// NewAuditor creates a new Auditor for the cluster with the given UUID.
+// Pods and secrets of namespaces for which namespaces returns false are not audited.
+func NewAuditor(
+	clientset kubernetes.Interface, db *database.Database, clusterUuid types.UUID, namespaces func(string) bool,
+	log logr.Logger,
+) *Auditor {
+	return &Auditor{
+		clientset:   clientset,
+		db:          db,
+		clusterUuid: clusterUuid,
+		namespaces:  namespaces,
+		log:         log,
+	}
+}
+
+// Run audits the image pull secrets of the pods cached by the given informer every hour until ctx is canceled.
+func (a *Auditor) Run(ctx context.Context, pods kcache.SharedIndexInformer) error {
+	if !kcache.WaitForCacheSync(ctx.Done(), pods.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	for {
+		if err := a.Audit(ctx, pods.GetStore(), time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Audit audits the image pull secrets of the pods in the given store and stores the results at the given time.
+func (a *Auditor) Audit(ctx context.Context, pods kcache.Store, now time.Time) error {
+	a.log.V(1).Info("Auditing image pull secrets")
+
+	secrets, err := a.secrets(ctx)
+	if err != nil {
+		return err
+	}
+
+	private, err := a.privateRegistries(ctx, secrets, now)
+	if err != nil {
+		return err
+	}
+
+	workloads, err := workload.Resolve(ctx, a.db, a.clusterUuid)
+	if err != nil {
+		return err
+	}
+
+	referenced, err := a.serviceAccountSecrets(ctx)
+	if err != nil {
+		return err
+	}
+
+	usages := make(map[[4]string]*schemav1.ImagePullSecretUsage)
+	issues := make(map[types.UUID]*schemav1.ImagePullSecretIssue)
+	issue := func(kind, namespace string, w workload.Workload, secretName, registry, image string) {
+		id := schemav1.NewUUID(a.clusterUuid, strings.Join(
+			[]string{kind, namespace, w.Kind, w.Name, secretName, registry, image}, "/"))
+		issues[id] = &schemav1.ImagePullSecretIssue{
+			Uuid:         id,
+			ClusterUuid:  a.clusterUuid,
+			Kind:         kind,
+			Namespace:    namespace,
+			WorkloadKind: schemav1.NewNullableString(w.Kind),
+			WorkloadName: schemav1.NewNullableString(w.Name),
+			SecretName:   schemav1.NewNullableString(secretName),
+			Registry:     schemav1.NewNullableString(registry),
+			Image:        schemav1.NewNullableString(image),
+			Computed:     types.UnixMilli(now),
+		}
+	}
+
+	for _, obj := range pods.List() {
+		pod, ok := obj.(*kcorev1.Pod)
+		if !ok || !a.namespaces(pod.Namespace) {
+			continue
+		}
+
+		w, ok := workloads[schemav1.EnsureUUID(pod.UID)]
+		if !ok {
+			w = workload.Workload{Kind: "Pod", Name: pod.Name}
+		}
+
+		covered := make(map[string]struct{})
+		for _, ref := range pod.Spec.ImagePullSecrets {
+			key := pod.Namespace + "/" + ref.Name
+			referenced[key] = struct{}{}
+
+			s, ok := secrets[key]
+			if !ok {
+				issue(schemav1.ImagePullSecretIssueMissing, pod.Namespace, w, ref.Name, "", "")
+
+				continue
+			}
+
+			for registry := range s.registries {
+				covered[registry] = struct{}{}
+			}
+
+			usage, ok := usages[[4]string{pod.Namespace, ref.Name, w.Kind, w.Name}]
+			if !ok {
+				usage = &schemav1.ImagePullSecretUsage{
+					ClusterUuid:  a.clusterUuid,
+					Namespace:    pod.Namespace,
+					SecretName:   ref.Name,
+					WorkloadKind: w.Kind,
+					WorkloadName: w.Name,
+					Computed:     types.UnixMilli(now),
+				}
+				usages[[4]string{pod.Namespace, ref.Name, w.Kind, w.Name}] = usage
+			}
+			usage.Pods++
+		}
+
+		for _, c := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+			registry := imagepull.Registry(c.Image)
+			if _, ok := private[registry]; !ok {
+				continue
+			}
+
+			if _, ok := covered[registry]; !ok {
+				issue(schemav1.ImagePullSecretIssueNoSecret, pod.Namespace, w, "", registry, c.Image)
+			}
+		}
+	}
+
+	for key, s := range secrets {
+		if _, ok := referenced[key]; !ok {
+			issue(schemav1.ImagePullSecretIssueUnused, s.namespace, workload.Workload{}, s.name, "", "")
+		}
+	}
+
+	entities := make(chan interface{}, len(usages))
+	for _, usage := range usages {
+		entities <- usage
+	}
+	close(entities)
+
+	if err := a.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store image pull secret usages")
+	}
+
+	entities = make(chan interface{}, len(issues))
+	for _, i := range issues {
+		entities <- i
+	}
+	close(entities)
+
+	if err := a.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store image pull secret issues")
+	}
+
+	// Usages and issues that no longer apply are removed.
+	for _, table := range []string{"image_pull_secret_usage", "image_pull_secret_issue"} {
+		if _, err := a.db.ExecContext(ctx, a.db.Rebind(
+			"DELETE FROM "+table+" WHERE cluster_uuid = ? AND computed < ?"), a.clusterUuid, now.UnixMilli(),
+		); err != nil {
+			return errors.Wrapf(err, "can't delete outdated %s", table)
+		}
+	}
+
+	return nil
+}
+
+// secrets returns the image pull secrets of the cluster by namespace and name.
+// Secrets whose credentials can't be parsed have no registries.
+func (a *Auditor) secrets(ctx context.Context) (map[string]*secret, error) {
+	secrets := make(map[string]*secret)
+	for _, typ := range []kcorev1.SecretType{kcorev1.SecretTypeDockerConfigJson, kcorev1.SecretTypeDockercfg} {
+		// Secrets are listed in small pages as they may be large.
+		options := kmetav1.ListOptions{FieldSelector: "type=" + string(typ), Limit: 100}
+		for {
+			l, err := a.clientset.CoreV1().Secrets(kcorev1.NamespaceAll).List(ctx, options)
+			if err != nil {
+				return nil, errors.Wrap(err, "can't list image pull secrets")
+			}
+
+			for _, s := range l.Items {
+				if !a.namespaces(s.Namespace) {
+					continue
+				}
+
+				secrets[s.Namespace+"/"+s.Name] = &secret{
+					namespace:  s.Namespace,
+					name:       s.Name,
+					registries: registries(&s),
+				}
+			}
+
+			if l.Continue == "" {
+				break
+			}
+
+			options.Continue = l.Continue
+		}
+	}
+
+	return secrets, nil
+}
+
+// serviceAccountSecrets returns the image pull secrets referenced by service accounts by namespace and name.
+func (a *Auditor) serviceAccountSecrets(ctx context.Context) (map[string]struct{}, error) {
+	accounts, err := a.clientset.CoreV1().ServiceAccounts(kcorev1.NamespaceAll).List(ctx, kmetav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't list service accounts")
+	}
+
+	referenced := make(map[string]struct{})
+	for _, sa := range accounts.Items {
+		for _, ref := range sa.ImagePullSecrets {
+			referenced[sa.Namespace+"/"+ref.Name] = struct{}{}
+		}
+	}
+
+	return referenced, nil
+}
+
+// privateRegistries returns the registries that any of the given secrets has credentials for
+// and the registries pulls from which failed as unauthorized since the unauthorized window.
+func (a *Auditor) privateRegistries(
+	ctx context.Context, secrets map[string]*secret, now time.Time,
+) (map[string]struct{}, error) {
+	var unauthorized []string
+	if err := a.db.SelectContext(ctx, &unauthorized, a.db.Rebind(
+		"SELECT DISTINCT registry FROM image_pull WHERE cluster_uuid = ? AND failure = ? AND last_seen >= ?"),
+		a.clusterUuid, schemav1.ImagePullUnauthorized, now.Add(-unauthorizedWindow).UnixMilli()); err != nil {
+		return nil, errors.Wrap(err, "can't query unauthorized image pulls")
+	}
+
+	private := make(map[string]struct{})
+	for _, registry := range unauthorized {
+		private[registry] = struct{}{}
+	}
+
+	for _, s := range secrets {
+		for registry := range s.registries {
+			private[registry] = struct{}{}
+		}
+	}
+
+	return private, nil
+}
+
+// registries returns the registries the given image pull secret has credentials for.
+func registries(s *kcorev1.Secret) map[string]struct{} {
+	var auths map[string]json.RawMessage
+	if s.Type == kcorev1.SecretTypeDockerConfigJson {
+		var config struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(s.Data[kcorev1.DockerConfigJsonKey], &config); err != nil {
+			return nil
+		}
+
+		auths = config.Auths
+	} else if err := json.Unmarshal(s.Data[kcorev1.DockerConfigKey], &auths); err != nil {
+		return nil
+	}
+
+	registries := make(map[string]struct{}, len(auths))
+	for server := range auths {
+		registries[normalize(server)] = struct{}{}
+	}
+
+	return registries
+}
+
+// normalize returns the registry host of the given server of docker credentials, which may be a URL,
+// and docker.io for the various servers of Docker Hub, as returned by imagepull.Registry.
+func normalize(server string) string {
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		server = u.Host
+	}
+
+	server, _, _ = strings.Cut(server, "/")
+
+	switch server {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	default:
+		return server
+	}
+}
@@ -0,0 +1,88 @@
+package registry
+
+import (
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+	kschema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The built-in handlers. Namespaces and pods are wired up separately when synchronizing a cluster,
+// as namespace filtering, containers and problem detection depend on them.
+func init() {
+	core := func(resource string) kschema.GroupVersionResource {
+		return kschema.GroupVersionResource{Version: "v1", Resource: resource}
+	}
+	apps := func(resource string) kschema.GroupVersionResource {
+		return kschema.GroupVersionResource{Group: "apps", Version: "v1", Resource: resource}
+	}
+	batch := func(resource string) kschema.GroupVersionResource {
+		return kschema.GroupVersionResource{Group: "batch", Version: "v1", Resource: resource}
+	}
+
+	RegisterResource("namespaces", core("namespaces"), Static(schemav1.NewNamespace), ClusterScoped())
+	RegisterResource("nodes", core("nodes"), func(env Env) func() schemav1.Resource {
+		return schemav1.NewNodeFactory(env.Thresholds(""), env.NodeMemoryUsage).New
+	}, ClusterScoped(), WithStateHistory())
+	RegisterResource("pods", core("pods"), func(env Env) func() schemav1.Resource {
+		return schemav1.NewPodFactory(env.Clientset, env.Thresholds, env.ContainerRestarts).New
+	}, WithStateHistory())
+	RegisterResource("deployments", apps("deployments"), Static(schemav1.NewDeployment), WithStateHistory())
+	RegisterResource("daemon-sets", apps("daemonsets"), Static(schemav1.NewDaemonSet), WithStateHistory())
+	RegisterResource("replica-sets", apps("replicasets"), Static(schemav1.NewReplicaSet), WithStateHistory())
+	RegisterResource("stateful-sets", apps("statefulsets"), Static(schemav1.NewStatefulSet), WithStateHistory())
+	RegisterResource("services", core("services"), Static(schemav1.NewService))
+	RegisterResource("endpoints", kschema.GroupVersionResource{
+		Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices",
+	}, Static(schemav1.NewEndpointSlice))
+	RegisterResource("secrets", core("secrets"), Static(schemav1.NewSecret), WithPartialMetadata())
+	RegisterResource("config-maps", core("configmaps"), Static(schemav1.NewConfigMap), WithPartialMetadata())
+	RegisterResource("events", kschema.GroupVersionResource{
+		Group: "events.k8s.io", Version: "v1", Resource: "events",
+	}, Static(schemav1.NewEvent), WithFeatures(sync.WithNoDelete(), sync.WithNoWarumup()),
+		WithClusterFeatures(imagePulls))
+	RegisterResource("pvcs", core("persistentvolumeclaims"), Static(schemav1.NewPvc), WithStateHistory())
+	RegisterResource("persistent-volumes", core("persistentvolumes"), Static(schemav1.NewPersistentVolume), ClusterScoped())
+	RegisterResource("jobs", batch("jobs"), Static(schemav1.NewJob), WithStateHistory())
+	RegisterResource("cron-jobs", batch("cronjobs"), Static(schemav1.NewCronJob))
+	RegisterResource("hpas", kschema.GroupVersionResource{
+		Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers",
+	}, Static(schemav1.NewHpa), WithClusterFeatures(hpaScalings))
+	RegisterResource("ingresses", kschema.GroupVersionResource{
+		Group: "networking.k8s.io", Version: "v1", Resource: "ingresses",
+	}, Static(schemav1.NewIngress))
+	RegisterResource("routes", kschema.GroupVersionResource{
+		Group: "route.openshift.io", Version: "v1", Resource: "routes",
+	}, Static(schemav1.NewRoute), Optional())
+	istio := func(resource string) kschema.GroupVersionResource {
+		return kschema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: resource}
+	}
+	RegisterResource("istio-virtual-services", istio("virtualservices"), Static(schemav1.NewIstioVirtualService), Optional())
+	RegisterResource("istio-gateways", istio("gateways"), Static(schemav1.NewIstioGateway), Optional())
+	RegisterResource("cilium-endpoints", kschema.GroupVersionResource{
+		Group: "cilium.io", Version: "v2", Resource: "ciliumendpoints",
+	}, Static(schemav1.NewCiliumEndpoint), Optional())
+	velero := func(resource string) kschema.GroupVersionResource {
+		return kschema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: resource}
+	}
+	RegisterResource("velero-backups", velero("backups"), Static(schemav1.NewVeleroBackup),
+		WithStateHistory(), Optional(), WithClusterFeatures(veleroSchedules))
+	RegisterResource("velero-restores", velero("restores"), Static(schemav1.NewVeleroRestore),
+		WithStateHistory(), Optional())
+	RegisterResource("velero-schedules", velero("schedules"), Static(schemav1.NewVeleroSchedule),
+		WithStateHistory(), Optional(), WithClusterFeatures(veleroSchedules))
+	RegisterResource("argo-applications", kschema.GroupVersionResource{
+		Group: "argoproj.io", Version: "v1alpha1", Resource: "applications",
+	}, Static(schemav1.NewArgoApplication),
+		WithStateHistory(), Optional(), WithClusterFeatures(gitopsProblems("argo_application")))
+	RegisterResource("flux-kustomizations", kschema.GroupVersionResource{
+		Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Resource: "kustomizations",
+	}, Static(schemav1.NewFluxKustomization),
+		WithStateHistory(), Optional(), WithClusterFeatures(gitopsProblems("flux_kustomization")))
+	olm := func(resource string) kschema.GroupVersionResource {
+		return kschema.GroupVersionResource{Group: "operators.coreos.com", Version: "v1alpha1", Resource: resource}
+	}
+	RegisterResource("olm-subscriptions", olm("subscriptions"), Static(schemav1.NewOlmSubscription),
+		WithStateHistory(), Optional())
+	RegisterResource("olm-cluster-service-versions", olm("clusterserviceversions"),
+		Static(schemav1.NewOlmClusterServiceVersion), WithStateHistory(), Optional())
+}
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/icinga/icinga-kubernetes/pkg/gitops"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+)
+
+// gitopsProblems returns a function that returns the features raising and clearing the problems
+// of the applications of the given type, e.g. argo_application.
+func gitopsProblems(resourceType string) func(env Env) []sync.Feature {
+	return func(env Env) []sync.Feature {
+		problems := gitops.NewProblems(env.Db, env.ClusterUuid, resourceType, func(p *schemav1.GitopsProblem) {
+			env.Notify(p)
+		})
+
+		return []sync.Feature{sync.WithOnUpsert(problems.Upserted), sync.WithOnDelete(problems.Deleted)}
+	}
+}
@@ -0,0 +1,11 @@
+package registry
+
+import (
+	"github.com/icinga/icinga-kubernetes/pkg/imagepull"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+)
+
+// imagePulls returns the features that record the image pulls reported by the events of the kubelet.
+func imagePulls(env Env) []sync.Feature {
+	return []sync.Feature{sync.WithOnUpsert(imagepull.NewPulls(env.Db, env.ClusterUuid).Events)}
+}
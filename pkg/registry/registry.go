@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+	kschema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	gosync "sync"
+	"time"
+)
+
+// Env provides factories with the cluster being synchronized.
+type Env struct {
+	ClusterUuid types.UUID
+	Clientset   *kubernetes.Clientset
+	// Db is the database the resources are synchronized to.
+	Db *database.Database
+	// Thresholds returns the thresholds of the given namespace, or of the cluster if namespace is empty.
+	Thresholds func(namespace string) schemav1.Thresholds
+	// NodeMemoryUsage returns the memory usage of nodes, if their metrics are synchronized from Prometheus.
+	NodeMemoryUsage func(types.UUID) (float64, bool)
+	// ContainerRestarts returns the restarts of containers within the last hour and day, if recorded.
+	ContainerRestarts func(id types.UUID, restartCount int32, lastTermination time.Time) (hour, day int32)
+	// Notify is called with each raised and cleared problem of the resources.
+	Notify func(problem.Problem)
+}
+
+// Factory returns a function that creates resources for the cluster described by env.
+// It is called once per synchronized cluster, and with a zero Env to determine the table of the resources.
+type Factory func(env Env) func() schemav1.Resource
+
+// Static returns a Factory that creates resources with newResource regardless of the cluster.
+func Static(newResource func() schemav1.Resource) Factory {
+	return func(Env) func() schemav1.Resource {
+		return newResource
+	}
+}
+
+// Handler describes how the objects of a Kubernetes resource are synchronized to the database.
+type Handler struct {
+	// Name identifies the controller running the handler, e.g. in the controllers configuration and the API.
+	Name    string
+	Gvr     kschema.GroupVersionResource
+	Factory Factory
+	// ClusterScoped resources are not subject to namespace filtering.
+	ClusterScoped bool
+	// StateHistory records the state transitions of the resources, which must implement schemav1.Stater.
+	StateHistory bool
+	// PartialMetadata resources can also obtain *kmetav1.PartialObjectMetadata,
+	// so that their objects can be watched with metadata-only informers if configured.
+	PartialMetadata bool
+	// Optional resources are only synchronized if the API server serves them,
+	// e.g. resources specific to a Kubernetes distribution.
+	Optional bool
+	// Features are passed to the controller in addition to the features all controllers share.
+	Features []sync.Feature
+	// ClusterFeatures returns further features for the cluster described by env, if set.
+	ClusterFeatures func(env Env) []sync.Feature
+}
+
+// Table returns the name of the table the resources are stored in.
+func (h Handler) Table() string {
+	return database.TableName(h.Factory(Env{})())
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// ClusterScoped marks the resource as cluster-scoped.
+func ClusterScoped() Option {
+	return func(h *Handler) {
+		h.ClusterScoped = true
+	}
+}
+
+// WithStateHistory records the state transitions of the resources.
+func WithStateHistory() Option {
+	return func(h *Handler) {
+		h.StateHistory = true
+	}
+}
+
+// WithPartialMetadata marks the resources as able to obtain *kmetav1.PartialObjectMetadata.
+func WithPartialMetadata() Option {
+	return func(h *Handler) {
+		h.PartialMetadata = true
+	}
+}
+
+// Optional marks the resource as only served by some API servers.
+func Optional() Option {
+	return func(h *Handler) {
+		h.Optional = true
+	}
+}
+
+// WithFeatures passes the given features to the controller.
+func WithFeatures(features ...sync.Feature) Option {
+	return func(h *Handler) {
+		h.Features = append(h.Features, features...)
+	}
+}
+
+// WithClusterFeatures passes the features returned from newFeatures for the synchronized cluster to the controller,
+// e.g. to maintain data derived from the resources in the database.
+func WithClusterFeatures(newFeatures func(env Env) []sync.Feature) Option {
+	return func(h *Handler) {
+		h.ClusterFeatures = newFeatures
+	}
+}
+
+var (
+	mu       gosync.Mutex
+	handlers []Handler
+)
+
+// RegisterResource registers a handler synchronizing the objects of the resource gvr,
+// which are converted by the resources created by factory, under the given controller name.
+// Relations of the resources to other tables are declared by implementing database.HasRelations.
+// Resources of types unknown to client-go, e.g. custom resources, are passed to the resources
+// as *unstructured.Unstructured. Handlers must be registered before the configuration is loaded,
+// usually in an init function, and panics if name is already registered.
+func RegisterResource(name string, gvr kschema.GroupVersionResource, factory Factory, options ...Option) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, h := range handlers {
+		if h.Name == name {
+			panic(fmt.Sprintf("resource handler %q already registered", name))
+		}
+	}
+
+	h := Handler{Name: name, Gvr: gvr, Factory: factory}
+	for _, option := range options {
+		option(&h)
+	}
+
+	handlers = append(handlers, h)
+}
+
+// Handlers returns all registered handlers in the order of their registration.
+func Handlers() []Handler {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return append([]Handler(nil), handlers...)
+}
+
+// Lookup returns the handler registered under the given name.
+func Lookup(name string) (Handler, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, h := range handlers {
+		if h.Name == name {
+			return h, true
+		}
+	}
+
+	return Handler{}, false
+}
+
+// Names returns the names of all registered handlers in the order of their registration.
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(handlers))
+	for _, h := range handlers {
+		names = append(names, h.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,17 @@
+package registry
+
+import (
+	"github.com/icinga/icinga-kubernetes/pkg/scaling"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+)
+
+// hpaScalings returns the features that record the scalings of horizontal pod autoscalers
+// and raise and clear their thrash problems.
+func hpaScalings(env Env) []sync.Feature {
+	scalings := scaling.NewScalings(env.Db, env.ClusterUuid, env.Thresholds, func(p *schemav1.HpaProblem) {
+		env.Notify(p)
+	})
+
+	return []sync.Feature{sync.WithOnUpsert(scalings.Upserted), sync.WithOnDelete(scalings.Deleted)}
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"github.com/icinga/icinga-go-library/types"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+	"github.com/pkg/errors"
+)
+
+// veleroLastSuccessfulBackup updates the completion time of the last successful backup of schedules
+// as their backups complete, or as the schedules themselves are synchronized,
+// so that it is also set if the backups are synchronized first.
+const veleroLastSuccessfulBackup = `UPDATE velero_schedule SET last_successful_backup = (
+  SELECT MAX(b.completed) FROM velero_backup b WHERE b.cluster_uuid = velero_schedule.cluster_uuid
+  AND b.namespace = velero_schedule.namespace AND b.schedule_name = velero_schedule.name AND b.phase = 'Completed'
+) WHERE cluster_uuid = ? AND namespace = ? AND name = ?`
+
+// veleroSchedules returns the features that maintain the last successful backup of the schedules
+// of the upserted Velero backups or schedules.
+func veleroSchedules(env Env) []sync.Feature {
+	return []sync.Feature{sync.WithOnUpsert(func(ctx context.Context, bulk []any) error {
+		type schedule struct {
+			clusterUuid types.UUID
+			namespace   string
+			name        string
+		}
+
+		seen := make(map[schedule]struct{})
+		for _, entity := range bulk {
+			var s schedule
+			switch e := entity.(type) {
+			case *schemav1.VeleroBackup:
+				if !e.ScheduleName.Valid || e.Phase.String != "Completed" {
+					continue
+				}
+
+				s = schedule{e.ClusterUuid, e.Namespace, e.ScheduleName.String}
+			case *schemav1.VeleroSchedule:
+				s = schedule{e.ClusterUuid, e.Namespace, e.Name}
+			default:
+				continue
+			}
+
+			if _, ok := seen[s]; ok {
+				continue
+			}
+			seen[s] = struct{}{}
+
+			if _, err := env.Db.ExecContext(
+				ctx, env.Db.Rebind(veleroLastSuccessfulBackup), s.clusterUuid, s.namespace, s.name,
+			); err != nil {
+				return errors.Wrap(err, "can't update last successful backup of Velero schedule")
+			}
+		}
+
+		return nil
+	})}
+}
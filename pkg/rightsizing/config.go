@@ -0,0 +1,43 @@
+package rightsizing
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Config defines how requests and limits are recommended.
+type Config struct {
+	// Window is the period of usage from which recommendations are computed. If not set, nothing is recommended.
+	Window time.Duration `yaml:"window"`
+	// CpuPercentile and MemoryPercentile of the usage during the window that requests should cover.
+	CpuPercentile    float64 `yaml:"cpu_percentile" default:"0.9"`
+	MemoryPercentile float64 `yaml:"memory_percentile" default:"0.99"`
+	// Margin is the fraction added to the percentiles, e.g. 0.15 for 15%.
+	Margin float64 `yaml:"margin" default:"0.15"`
+}
+
+// Validate checks constraints in the supplied rightsizing configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	if c.Window < 0 {
+		return errors.New("rightsizing window must not be negative")
+	}
+
+	if c.Window > 0 && c.Window < time.Hour {
+		return errors.New("rightsizing window must be at least 1h")
+	}
+
+	if c.CpuPercentile <= 0 || c.CpuPercentile > 1 || c.MemoryPercentile <= 0 || c.MemoryPercentile > 1 {
+		return errors.New("rightsizing percentiles must be greater than 0 and at most 1")
+	}
+
+	if c.Margin < 0 {
+		return errors.New("rightsizing margin must not be negative")
+	}
+
+	return nil
+}
+
+// Enabled returns whether a window is configured, so that recommendations are computed.
+func (c *Config) Enabled() bool {
+	return c.Window > 0
+}
@@ -0,0 +1,222 @@
+// Package rightsizing recommends requests and limits of containers from percentiles of their observed usage,
+// similar to the recommender of the Vertical Pod Autoscaler, but without applying them.
+package rightsizing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/workload"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"math"
+	"time"
+)
+
+// interval is the interval in which recommendations are computed.
+const interval = time.Hour
+
+// Querier executes instant Prometheus queries.
+type Querier interface {
+	Query(ctx context.Context, query string) (model.Vector, error)
+}
+
+// Recommender computes the recommendations for the containers of the workloads of a cluster
+// and stores them in the container_recommendation table, replacing the previous ones.
+// As the usage of a container is taken from all pods of its workload that still exist,
+// recommendations cover the usage of the busiest pod.
+// Requests are recommended as the configured percentiles of the usage plus the margin,
+// and limits, if set, so that their ratio to the requests is kept.
+type Recommender struct {
+	db          *database.Database
+	prometheus  Querier
+	clusterUuid types.UUID
+	config      *Config
+	log         logr.Logger
+}
+
+// NewRecommender creates a new Recommender for the cluster with the given UUID,
+// which queries the usage from the given Prometheus.
+func NewRecommender(
+	db *database.Database, prometheus Querier, clusterUuid types.UUID, c *Config, log logr.Logger,
+) *Recommender {
+	return &Recommender{
+		db:          db,
+		prometheus:  prometheus,
+		clusterUuid: clusterUuid,
+		config:      c,
+		log:         log,
+	}
+}
+
+// Run computes the recommendations every hour until ctx is canceled.
+func (r *Recommender) Run(ctx context.Context) error {
+	for {
+		if err := r.Recommend(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// key identifies a container of a workload.
+type key struct {
+	namespace string
+	workload  workload.Workload
+	container string
+}
+
+// Recommend computes and stores the recommendations of the cluster at the given time.
+func (r *Recommender) Recommend(ctx context.Context, now time.Time) error {
+	r.log.V(1).Info("Recommending requests and limits")
+
+	window := model.Duration(r.config.Window).String()
+	// Like in the VPA, CPU is the rate over short intervals and memory the working set.
+	cpu, err := r.prometheus.Query(ctx, fmt.Sprintf(
+		`quantile_over_time(%g, sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{container!="", container!="POD"}[5m]))[%s:1m])`,
+		r.config.CpuPercentile, window))
+	if err != nil {
+		return errors.Wrap(err, "can't query CPU usage")
+	}
+
+	memory, err := r.prometheus.Query(ctx, fmt.Sprintf(
+		`quantile_over_time(%g, sum by (namespace, pod, container) (container_memory_working_set_bytes{container!="", container!="POD"})[%s:1m])`,
+		r.config.MemoryPercentile, window))
+	if err != nil {
+		return errors.Wrap(err, "can't query memory usage")
+	}
+
+	var containers []struct {
+		PodUuid        types.UUID
+		Namespace      string
+		PodName        string
+		Name           string
+		CpuRequests    sql.NullInt64
+		CpuLimits      sql.NullInt64
+		MemoryRequests sql.NullInt64
+		MemoryLimits   sql.NullInt64
+	}
+	if err := r.db.SelectContext(ctx, &containers, r.db.Rebind(
+		"SELECT pod.uuid AS pod_uuid, pod.namespace, pod.name AS pod_name, container.name,"+
+			" container.cpu_requests, container.cpu_limits, container.memory_requests, container.memory_limits"+
+			" FROM container INNER JOIN pod ON pod.uuid = container.pod_uuid WHERE pod.cluster_uuid = ?"),
+		r.clusterUuid); err != nil {
+		return errors.Wrap(err, "can't query containers")
+	}
+
+	workloads, err := workload.Resolve(ctx, r.db, r.clusterUuid)
+	if err != nil {
+		return err
+	}
+
+	// Recommendations are keyed by workload, but usage is queried by pod.
+	keys := make(map[[3]string]key, len(containers))
+	recommendations := make(map[key]*schemav1.ContainerRecommendation)
+	for _, c := range containers {
+		w, ok := workloads[c.PodUuid]
+		if !ok {
+			w = workload.Workload{Kind: "Pod", Name: c.PodName}
+		}
+
+		k := key{namespace: c.Namespace, workload: w, container: c.Name}
+		keys[[3]string{c.Namespace, c.PodName, c.Name}] = k
+
+		rec, ok := recommendations[k]
+		if !ok {
+			rec = &schemav1.ContainerRecommendation{
+				ClusterUuid:  r.clusterUuid,
+				Namespace:    c.Namespace,
+				WorkloadKind: w.Kind,
+				WorkloadName: w.Name,
+				Container:    c.Name,
+				Computed:     types.UnixMilli(now),
+			}
+			recommendations[k] = rec
+		}
+
+		// Pods of a workload may have different resources during a rollout, so the greatest are reported.
+		rec.CpuRequests = maxNull(rec.CpuRequests, c.CpuRequests)
+		rec.CpuLimits = maxNull(rec.CpuLimits, c.CpuLimits)
+		rec.MemoryRequests = maxNull(rec.MemoryRequests, c.MemoryRequests)
+		rec.MemoryLimits = maxNull(rec.MemoryLimits, c.MemoryLimits)
+	}
+
+	observed := make(map[key]struct{})
+	usage := func(samples model.Vector, set func(rec *schemav1.ContainerRecommendation, value float64)) {
+		for _, s := range samples {
+			k, ok := keys[[3]string{
+				string(s.Metric["namespace"]), string(s.Metric["pod"]), string(s.Metric["container"]),
+			}]
+			if !ok {
+				continue
+			}
+
+			observed[k] = struct{}{}
+			set(recommendations[k], float64(s.Value))
+		}
+	}
+	usage(cpu, func(rec *schemav1.ContainerRecommendation, value float64) {
+		rec.CpuUsage = max(rec.CpuUsage, value)
+	})
+	usage(memory, func(rec *schemav1.ContainerRecommendation, value float64) {
+		rec.MemoryUsage = max(rec.MemoryUsage, value)
+	})
+
+	entities := make(chan interface{}, len(observed))
+	for k := range observed {
+		rec := recommendations[k]
+		// At least one millicore and one byte is recommended, as zero means no request.
+		rec.RecommendedCpuRequests = max(int64(math.Ceil(rec.CpuUsage*(1+r.config.Margin)*1000)), 1)
+		rec.RecommendedMemoryRequests = max(int64(math.Ceil(rec.MemoryUsage*(1+r.config.Margin)))*1000, 1000)
+		rec.RecommendedCpuLimits = scale(rec.CpuLimits, rec.CpuRequests, rec.RecommendedCpuRequests)
+		rec.RecommendedMemoryLimits = scale(rec.MemoryLimits, rec.MemoryRequests, rec.RecommendedMemoryRequests)
+
+		entities <- rec
+	}
+	close(entities)
+
+	if err := r.db.UpsertStreamed(ctx, entities); err != nil {
+		return errors.Wrap(err, "can't store recommendations")
+	}
+
+	// Recommendations of containers that don't exist anymore are removed.
+	_, err = r.db.ExecContext(ctx, r.db.Rebind(
+		"DELETE FROM container_recommendation WHERE cluster_uuid = ? AND computed < ?"), r.clusterUuid, now.UnixMilli())
+
+	return errors.Wrap(err, "can't delete outdated recommendations")
+}
+
+// maxNull returns the greater of the valid values of a and b.
+func maxNull(a, b sql.NullInt64) sql.NullInt64 {
+	if !a.Valid || (b.Valid && b.Int64 > a.Int64) {
+		return b
+	}
+
+	return a
+}
+
+// scale returns the limit recommended along with the recommended requests, which keeps the ratio
+// of the current limits to the current requests. Without current limits, no limit is recommended,
+// and without current requests, the current limits are kept if they are not lower than the recommended requests.
+func scale(limits, requests sql.NullInt64, recommended int64) sql.NullInt64 {
+	if !limits.Valid {
+		return sql.NullInt64{}
+	}
+
+	if !requests.Valid || requests.Int64 == 0 {
+		return sql.NullInt64{Int64: max(limits.Int64, recommended), Valid: true}
+	}
+
+	ratio := float64(limits.Int64) / float64(requests.Int64)
+
+	return sql.NullInt64{Int64: int64(math.Ceil(float64(recommended) * ratio)), Valid: true}
+}
@@ -0,0 +1,298 @@
+// Package scaling records the scalings of horizontal pod autoscalers and raises problems for autoscalers
+// that thrash, i.e. scale their targets up and down again and again, e.g. because of a noisy metric
+// or a target that is too close to the usual load.
+package scaling
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Thrash is the reason of problems of horizontal pod autoscalers that scale too often.
+	Thrash = "ScalingThrash"
+
+	// DefaultScalingsPerHour is the number of scalings within the last hour from which on
+	// a horizontal pod autoscaler thrashes if the hpa_scalings_per_hour threshold is not set.
+	DefaultScalingsPerHour = 6
+
+	// window is the time for which scalings are counted.
+	window = time.Hour
+)
+
+// scaling is a recorded scaling of a horizontal pod autoscaler.
+type scaling struct {
+	time   time.Time
+	up     bool
+	metric sql.NullString
+}
+
+// hpaScalings are the last known scale time and desired replicas of a horizontal pod autoscaler
+// and its scalings within the window.
+type hpaScalings struct {
+	last     time.Time
+	desired  int32
+	scalings []scaling
+}
+
+// Scalings records the scalings of horizontal pod autoscalers, derived from the changes of their last scale time,
+// to the hpa_scaling table, and raises and clears thrash problems in the hpa_problem table.
+// Its callbacks are used as upsert and delete callbacks of the synchronization of horizontal pod autoscalers,
+// so that thrashing is only evaluated when they are synchronized.
+type Scalings struct {
+	db          *database.Database
+	clusterUuid types.UUID
+	thresholds  func(namespace string) schemav1.Thresholds
+	mu          sync.Mutex
+	// hpas contains the scalings by the UUID of their autoscaler and is nil until loaded from the database.
+	hpas     map[types.UUID]*hpaScalings
+	problems *problem.Tracker[types.UUID, *schemav1.HpaProblem]
+}
+
+// NewScalings creates a new Scalings for the horizontal pod autoscalers of the cluster with the given UUID.
+// thresholds returns the thresholds of a namespace, if configured.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewScalings(
+	db *database.Database,
+	clusterUuid types.UUID,
+	thresholds func(namespace string) schemav1.Thresholds,
+	notify func(*schemav1.HpaProblem),
+) *Scalings {
+	return &Scalings{
+		db:          db,
+		clusterUuid: clusterUuid,
+		thresholds:  thresholds,
+		problems: problem.NewTracker(
+			db,
+			"HPA problem",
+			func(p *schemav1.HpaProblem) types.UUID { return p.HpaUuid },
+			func(p *schemav1.HpaProblem) []any { return []any{"hpa", p.Namespace + "/" + p.Name} },
+			notify,
+			logr.Discard()),
+	}
+}
+
+// Upserted records the scalings of the upserted horizontal pod autoscalers and raises and clears their problems.
+func (s *Scalings) Upserted(ctx context.Context, bulk []any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, entity := range bulk {
+		hpa, ok := entity.(*schemav1.Hpa)
+		if !ok {
+			continue
+		}
+
+		if err := s.record(ctx, hpa, now); err != nil {
+			return err
+		}
+
+		if err := s.update(ctx, hpa, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deleted forgets the deleted horizontal pod autoscalers and clears their problems.
+func (s *Scalings) Deleted(ctx context.Context, ids []any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		delete(s.hpas, id.(types.UUID))
+
+		if err := s.problems.Clear(ctx, id.(types.UUID), now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load loads the last scale times, the scalings within the window and the open problems from the database,
+// unless already loaded. Must be called with mu held.
+func (s *Scalings) load(ctx context.Context) error {
+	if s.hpas != nil {
+		return nil
+	}
+
+	var last []struct {
+		HpaUuid   types.UUID
+		EventTime types.UnixMilli
+	}
+	if err := s.db.SelectContext(ctx, &last, s.db.Rebind(
+		"SELECT hpa_uuid, MAX(event_time) AS event_time FROM hpa_scaling WHERE cluster_uuid = ? GROUP BY hpa_uuid"),
+		s.clusterUuid); err != nil {
+		return errors.Wrap(err, "can't load last HPA scalings")
+	}
+
+	var scalings []*schemav1.HpaScaling
+	if err := s.db.SelectContext(ctx, &scalings, s.db.Rebind(
+		s.db.BuildSelectStmt(&schemav1.HpaScaling{}, &schemav1.HpaScaling{})+
+			" WHERE cluster_uuid = ? AND event_time >= ? ORDER BY event_time"),
+		s.clusterUuid, time.Now().Add(-window).UnixMilli()); err != nil {
+		return errors.Wrap(err, "can't load HPA scalings")
+	}
+
+	if err := s.problems.Load(ctx, "cluster_uuid = ?", s.clusterUuid); err != nil {
+		return err
+	}
+
+	s.hpas = make(map[types.UUID]*hpaScalings, len(last))
+	for _, l := range last {
+		s.hpas[l.HpaUuid] = &hpaScalings{last: l.EventTime.Time()}
+	}
+
+	for _, sc := range scalings {
+		if h, ok := s.hpas[sc.HpaUuid]; ok {
+			h.scalings = append(h.scalings, scaling{
+				time:   sc.EventTime.Time(),
+				up:     sc.DesiredReplicas > sc.PreviousReplicas,
+				metric: sc.ScalingMetric,
+			})
+		}
+	}
+
+	return nil
+}
+
+// record records the scaling of the given horizontal pod autoscaler if its last scale time changed
+// and forgets its scalings that are older than the window. Must be called with mu held.
+// The previous replicas are the desired replicas as of the last synchronization, if known,
+// as the current replicas may already have been scaled.
+func (s *Scalings) record(ctx context.Context, hpa *schemav1.Hpa, now time.Time) error {
+	h, ok := s.hpas[hpa.Uuid]
+	if !ok {
+		h = &hpaScalings{}
+		s.hpas[hpa.Uuid] = h
+	}
+
+	previous := h.desired
+	if previous == 0 {
+		previous = hpa.CurrentReplicas
+	}
+	h.desired = hpa.DesiredReplicas
+
+	if scaled := hpa.LastScaleTime.Time(); scaled.After(h.last) {
+		h.last = scaled
+
+		if previous != hpa.DesiredReplicas {
+			sc := &schemav1.HpaScaling{
+				Uuid:               schemav1.NewUUID(hpa.Uuid, strconv.FormatInt(scaled.UnixMilli(), 10)),
+				ClusterUuid:        s.clusterUuid,
+				HpaUuid:            hpa.Uuid,
+				PreviousReplicas:   previous,
+				DesiredReplicas:    hpa.DesiredReplicas,
+				ScalingMetric:      hpa.ScalingMetric,
+				ScalingMetricRatio: hpa.ScalingMetricRatio,
+				EventTime:          hpa.LastScaleTime,
+			}
+
+			stmt, _ := s.db.BuildUpsertStmt(sc)
+			if _, err := s.db.NamedExecContext(ctx, stmt, sc); err != nil {
+				return errors.Wrap(err, "can't insert HPA scaling")
+			}
+
+			h.scalings = append(h.scalings, scaling{
+				time:   scaled,
+				up:     hpa.DesiredReplicas > previous,
+				metric: hpa.ScalingMetric,
+			})
+		}
+	}
+
+	for len(h.scalings) > 0 && !h.scalings[0].time.After(now.Add(-window)) {
+		h.scalings = h.scalings[1:]
+	}
+
+	return nil
+}
+
+// update raises or clears the thrash problem of the given horizontal pod autoscaler. Must be called with mu held.
+func (s *Scalings) update(ctx context.Context, hpa *schemav1.Hpa, now time.Time) error {
+	scalings := s.hpas[hpa.Uuid].scalings
+
+	var reason string
+	if float64(len(scalings)) >= s.scalingsPerHour(hpa) {
+		reason = Thrash
+	}
+
+	return s.problems.Update(ctx, hpa.Uuid, reason, nil, func() *schemav1.HpaProblem {
+		var up int
+		counts := make(map[string]int)
+		var metric sql.NullString
+		for _, sc := range scalings {
+			if sc.up {
+				up++
+			}
+
+			if sc.metric.Valid {
+				counts[sc.metric.String]++
+				// Ties are resolved in favor of the metric of the latest scaling.
+				if counts[sc.metric.String] >= counts[metric.String] {
+					metric = sc.metric
+				}
+			}
+		}
+
+		message := fmt.Sprintf(
+			"Horizontal pod autoscaler %s/%s scaled %s %s %d times within the last hour, %d times up and %d times down",
+			hpa.Namespace, hpa.Name, hpa.ScaleTargetKind, hpa.ScaleTargetName, len(scalings), up, len(scalings)-up)
+		if metric.Valid {
+			message += fmt.Sprintf(", mostly because of its %s metric", metric.String)
+		}
+
+		return &schemav1.HpaProblem{
+			Uuid:            schemav1.NewUUID(hpa.Uuid, fmt.Sprintf("%s:%d", Thrash, now.UnixMilli())),
+			ClusterUuid:     s.clusterUuid,
+			HpaUuid:         hpa.Uuid,
+			Namespace:       hpa.Namespace,
+			Name:            hpa.Name,
+			ScaleTargetKind: hpa.ScaleTargetKind,
+			ScaleTargetName: hpa.ScaleTargetName,
+			Reason:          Thrash,
+			Message:         schemav1.NewNullableString(message + "."),
+			ScalingMetric:   metric,
+			Scalings:        int32(len(scalings)),
+			Started:         types.UnixMilli(now),
+		}
+	}, now)
+}
+
+// scalingsPerHour returns the number of scalings within the last hour from which on
+// the given horizontal pod autoscaler thrashes.
+func (s *Scalings) scalingsPerHour(hpa *schemav1.Hpa) float64 {
+	if s.thresholds != nil {
+		threshold := s.thresholds(hpa.Namespace).WithAnnotations(hpa.Annotations).HpaScalingsPerHour
+		if threshold.Warning > 0 {
+			return threshold.Warning
+		}
+		if threshold.Critical > 0 {
+			return threshold.Critical
+		}
+	}
+
+	return DefaultScalingsPerHour
+}
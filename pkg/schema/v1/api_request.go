@@ -0,0 +1,20 @@
+package v1
+
+import (
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// ApiRequest are the requests of a verb to a resource that Icinga for Kubernetes made to the API server in a minute.
+type ApiRequest struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	// Timestamp is the start of the minute in milliseconds since the epoch.
+	Timestamp int64
+	Verb      string
+	Resource  string
+	Requests  int64
+	Errors    int64
+	// LatencyAvg and LatencyMax in milliseconds.
+	LatencyAvg int64
+	LatencyMax int64
+}
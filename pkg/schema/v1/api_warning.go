@@ -0,0 +1,25 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// ApiWarning is the latest warning that the API server returned to requests of Icinga for Kubernetes to a resource,
+// e.g. because it is requested via a deprecated API version.
+type ApiWarning struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	// ApiVersion is the group and version of the requested API, e.g. batch/v1beta1.
+	ApiVersion string
+	Resource   string
+	Message    string
+	// RemovedIn is the minor version the API is removed in, if the warning announces its removal.
+	RemovedIn sql.NullString
+	// Replacement is the group and version to migrate to, if the warning names one.
+	Replacement sql.NullString
+	// Requests is the number of requests that received a warning since FirstSeen.
+	Requests  int64
+	FirstSeen types.UnixMilli
+	LastSeen  types.UnixMilli
+}
@@ -0,0 +1,23 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// CanaryRun is a run of the scheduling canary, i.e. a tiny pod that is created, awaited to be running and deleted.
+type CanaryRun struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	Namespace   string
+	// PodName is empty if the pod couldn't be created.
+	PodName  string
+	NodeName sql.NullString
+	Success  types.Bool
+	// SchedulingTime in milliseconds from creating the pod until it has been scheduled, NULL if it hasn't.
+	SchedulingTime sql.NullInt64
+	// RunningTime in milliseconds from creating the pod until it is running, NULL if it isn't.
+	RunningTime sql.NullInt64
+	Error       sql.NullString
+	Started     types.UnixMilli
+}
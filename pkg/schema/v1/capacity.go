@@ -0,0 +1,119 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Scopes of capacity forecasts.
+const (
+	CapacityScopeNodePool  = "node_pool"
+	CapacityScopeNamespace = "namespace"
+	CapacityScopePvc       = "pvc"
+)
+
+// CapacityForecast projects when a resource of a node pool, namespace or PVC is exhausted
+// if its usage keeps growing as it did recently.
+type CapacityForecast struct {
+	ClusterUuid types.UUID
+	Scope       string
+	// Namespace of namespace and PVC forecasts, empty for node pools.
+	Namespace string
+	// Name of the node pool or PVC, empty for namespaces.
+	Name string
+	// Resource is either cpu in cores, memory in bytes, storage in bytes or inodes of PVCs.
+	Resource string
+	Capacity float64
+	Usage    float64
+	// GrowthPerDay is the trend of the usage, NULL if there are too few metrics.
+	GrowthPerDay sql.NullFloat64
+	// DaysUntilExhaustion is NULL if the usage doesn't grow.
+	DaysUntilExhaustion sql.NullFloat64
+	Computed            types.UnixMilli
+}
+
+// ResourceQuotaUsage is the usage of a resource of a resource quota at a point in time,
+// e.g. requests.cpu in cores, requests.memory in bytes or count/deployments.apps.
+type ResourceQuotaUsage struct {
+	ClusterUuid types.UUID
+	Namespace   string
+	Name        string
+	Resource    string
+	Timestamp   types.UnixMilli
+	Hard        float64
+	Used        float64
+}
+
+// ResourceQuotaForecast projects when a resource of a resource quota is exhausted
+// if its usage keeps growing as it did recently.
+type ResourceQuotaForecast struct {
+	ClusterUuid types.UUID
+	Namespace   string
+	Name        string
+	Resource    string
+	Hard        float64
+	Used        float64
+	// GrowthPerDay is the trend of the usage, NULL if there is too little usage history.
+	GrowthPerDay sql.NullFloat64
+	// DaysUntilExhaustion is 0 if the quota is already exhausted and NULL if the usage doesn't grow.
+	DaysUntilExhaustion sql.NullFloat64
+	Computed            types.UnixMilli
+}
+
+// ResourceQuotaProblem is a problem of a resource of a resource quota that is exhausted or about to be exhausted.
+// Exhausted is the time at which the resource is projected to be exhausted as of the time the problem was raised.
+type ResourceQuotaProblem struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	Namespace   string
+	Name        string
+	Resource    string
+	Reason      string
+	Message     sql.NullString
+	Hard        float64
+	Used        float64
+	Exhausted   types.UnixMilli
+	Started     types.UnixMilli
+	Cleared     types.UnixMilli
+}
+
+func (r *ResourceQuotaProblem) GetUuid() types.UUID {
+	return r.Uuid
+}
+
+func (r *ResourceQuotaProblem) GetReason() string {
+	return r.Reason
+}
+
+func (r *ResourceQuotaProblem) SetCleared(cleared types.UnixMilli) {
+	r.Cleared = cleared
+}
+
+// Reasons why nodes can't schedule pods, as reported by node fragmentation.
+const (
+	NodeFragmentationNotReady     = "not_ready"
+	NodeFragmentationCordoned     = "cordoned"
+	NodeFragmentationTainted      = "tainted"
+	NodeFragmentationPodsExceeded = "pods_exceeded"
+)
+
+// NodeFragmentation is the free capacity of a node, i.e. its allocatable resources minus the requests
+// of the pods on it, and the largest pod that the scheduler could still place on it. CPU is in millicores
+// and memory in bytes. The largest pod is 0 if the node can't schedule pods without tolerations,
+// for the reason in UnschedulableReason, in which case its free capacity can't be used by such pods at all.
+type NodeFragmentation struct {
+	Uuid                types.UUID
+	NodeUuid            types.UUID
+	ClusterUuid         types.UUID
+	NodeName            string
+	CpuAllocatable      int64
+	CpuRequests         int64
+	MemoryAllocatable   int64
+	MemoryRequests      int64
+	PodsAllocatable     int64
+	Pods                int64
+	LargestPodCpu       int64
+	LargestPodMemory    int64
+	UnschedulableReason sql.NullString
+	Computed            types.UnixMilli
+}
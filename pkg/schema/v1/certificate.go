@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Sources of tracked certificates.
+const (
+	// CertificateSourceApiServer is the serving certificate of the API server.
+	CertificateSourceApiServer = "api_server"
+	// CertificateSourceWebhook is the serving certificate of an admission webhook.
+	CertificateSourceWebhook = "webhook"
+	// CertificateSourceIngress is a certificate from the TLS secret of an ingress.
+	CertificateSourceIngress = "ingress"
+	// CertificateSourceServiceAccountToken is a token from a service account token secret.
+	CertificateSourceServiceAccountToken = "service_account_token"
+	// CertificateSourceKubeconfig is a client certificate or token from a kubeconfig stored in a secret.
+	CertificateSourceKubeconfig = "kubeconfig"
+)
+
+// Types of tracked credentials.
+const (
+	CertificateTypeCertificate = "certificate"
+	CertificateTypeToken       = "token"
+)
+
+// Certificate is a certificate of the cluster PKI or a token whose expiry is tracked.
+type Certificate struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	Source      string
+	Type        string
+	// Namespace and Name are of the ingress or webhook configuration that references the certificate,
+	// or of the secret that contains it, both empty for the API server.
+	Namespace string
+	Name      string
+	// Target is the probed address of the API server or webhook, the TLS secret of the ingress,
+	// the service account of the token or the user of the kubeconfig.
+	Target    string
+	Subject   string
+	Issuer    string
+	DnsNames  sql.NullString
+	NotBefore types.UnixMilli
+	NotAfter  types.UnixMilli
+	Checked   types.UnixMilli
+}
+
+// CertificateProblem is raised for a certificate that expires within the configured horizon or has expired,
+// and cleared once it has been renewed or isn't referenced anymore.
+type CertificateProblem struct {
+	Uuid            types.UUID
+	ClusterUuid     types.UUID
+	CertificateUuid types.UUID
+	Source          string
+	Namespace       string
+	Name            string
+	Target          string
+	Reason          string
+	Message         sql.NullString
+	NotAfter        types.UnixMilli
+	Started         types.UnixMilli
+	Cleared         types.UnixMilli
+}
+
+func (c *CertificateProblem) GetUuid() types.UUID {
+	return c.Uuid
+}
+
+func (c *CertificateProblem) GetReason() string {
+	return c.Reason
+}
+
+func (c *CertificateProblem) SetCleared(cleared types.UnixMilli) {
+	c.Cleared = cleared
+}
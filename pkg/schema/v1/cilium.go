@@ -0,0 +1,105 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// CiliumEndpoint is the endpoint of a pod managed by the Cilium agent of its node.
+// State is the state of the endpoint in the agent, e.g. ready or waiting-for-identity,
+// and Health its overall health, e.g. OK or Failure.
+type CiliumEndpoint struct {
+	Meta
+	EndpointId       sql.NullInt64
+	IdentityId       sql.NullInt64
+	State            sql.NullString
+	Health           sql.NullString
+	NodeIp           sql.NullString
+	Ipv4             sql.NullString
+	Ipv6             sql.NullString
+	IngressEnforcing types.Bool
+	EgressEnforcing  types.Bool
+	Yaml             string
+}
+
+// ciliumEndpoint contains the fields of cilium.io/v2 endpoints that are synchronized,
+// as the Cilium API types are not a dependency.
+type ciliumEndpoint struct {
+	Status struct {
+		Id       int64 `json:"id"`
+		Identity *struct {
+			Id int64 `json:"id"`
+		} `json:"identity"`
+		State  string `json:"state"`
+		Health *struct {
+			OverallHealth string `json:"overallHealth"`
+		} `json:"health"`
+		Networking *struct {
+			Addressing []struct {
+				Ipv4 string `json:"ipv4"`
+				Ipv6 string `json:"ipv6"`
+			} `json:"addressing"`
+			Node string `json:"node"`
+		} `json:"networking"`
+		Policy *struct {
+			Ingress struct {
+				Enforcing bool `json:"enforcing"`
+			} `json:"ingress"`
+			Egress struct {
+				Enforcing bool `json:"enforcing"`
+			} `json:"egress"`
+		} `json:"policy"`
+	} `json:"status"`
+}
+
+func NewCiliumEndpoint() Resource {
+	return &CiliumEndpoint{}
+}
+
+func (e *CiliumEndpoint) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	e.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var ep ciliumEndpoint
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &ep); err != nil {
+		return
+	}
+
+	// Endpoints don't have an ID as long as the agent hasn't created them yet.
+	if ep.Status.Id != 0 {
+		e.EndpointId = sql.NullInt64{Int64: ep.Status.Id, Valid: true}
+	}
+	if ep.Status.Identity != nil {
+		e.IdentityId = sql.NullInt64{Int64: ep.Status.Identity.Id, Valid: true}
+	}
+	e.State = NewNullableString(ep.Status.State)
+	if ep.Status.Health != nil {
+		e.Health = NewNullableString(ep.Status.Health.OverallHealth)
+	}
+	if ep.Status.Networking != nil {
+		e.NodeIp = NewNullableString(ep.Status.Networking.Node)
+		for _, a := range ep.Status.Networking.Addressing {
+			if !e.Ipv4.Valid {
+				e.Ipv4 = NewNullableString(a.Ipv4)
+			}
+			if !e.Ipv6.Valid {
+				e.Ipv6 = NewNullableString(a.Ipv6)
+			}
+		}
+	}
+	if ep.Status.Policy != nil {
+		e.IngressEnforcing = types.Bool{Bool: ep.Status.Policy.Ingress.Enforcing, Valid: true}
+		e.EgressEnforcing = types.Bool{Bool: ep.Status.Policy.Egress.Enforcing, Valid: true}
+	}
+
+	output, _ := yaml.Marshal(u.Object)
+	e.Yaml = string(output)
+}
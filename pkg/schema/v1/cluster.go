@@ -0,0 +1,12 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Cluster identifies the Kubernetes cluster all synchronized rows belong to.
+type Cluster struct {
+	Uuid types.UUID
+	Name sql.NullString
+}
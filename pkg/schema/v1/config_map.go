@@ -31,21 +31,22 @@ func NewConfigMap() Resource {
 	return &ConfigMap{}
 }
 
-func (c *ConfigMap) Obtain(k8s kmetav1.Object) {
-	c.ObtainMeta(k8s)
+func (c *ConfigMap) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	c.ObtainMeta(k8s, clusterUuid)
 
-	configMap := k8s.(*kcorev1.ConfigMap)
-
-	var immutable bool
-	if configMap.Immutable != nil {
-		immutable = *configMap.Immutable
-	}
-	c.Immutable = types.Bool{
-		Bool:  immutable,
-		Valid: true,
+	// Config maps watched with metadata-only informers lack whether they are immutable.
+	if configMap, ok := k8s.(*kcorev1.ConfigMap); ok {
+		var immutable bool
+		if configMap.Immutable != nil {
+			immutable = *configMap.Immutable
+		}
+		c.Immutable = types.Bool{
+			Bool:  immutable,
+			Valid: true,
+		}
 	}
 
-	for labelName, labelValue := range configMap.Labels {
+	for labelName, labelValue := range k8s.GetLabels() {
 		labelUuid := NewUUID(c.Uuid, strings.ToLower(labelName+":"+labelValue))
 		c.Labels = append(c.Labels, Label{
 			Uuid:  labelUuid,
@@ -58,7 +59,7 @@ func (c *ConfigMap) Obtain(k8s kmetav1.Object) {
 		})
 	}
 
-	for annotationName, annotationValue := range configMap.Annotations {
+	for annotationName, annotationValue := range k8s.GetAnnotations() {
 		annotationUuid := NewUUID(c.Uuid, strings.ToLower(annotationName+":"+annotationValue))
 		c.Annotations = append(c.Annotations, Annotation{
 			Uuid:  annotationUuid,
@@ -58,7 +58,7 @@ type ContainerCommon struct {
 }
 
 func (c *ContainerCommon) Obtain(podUuid types.UUID, container kcorev1.Container, status kcorev1.ContainerStatus) {
-	c.Uuid = NewUUID(podUuid, container.Name)
+	c.Uuid = ContainerUUID(podUuid, container.Name)
 	c.PodUuid = podUuid
 	c.Name = container.Name
 	c.Image = container.Image
@@ -206,6 +206,11 @@ type Container struct {
 	ContainerCommon
 	ContainerResources
 	ContainerRestartable
+	// RestartsLastHour and RestartsLastDay are derived from the restart history,
+	// both NULL if restarts aren't recorded.
+	RestartsLastHour sql.NullInt32
+	RestartsLastDay  sql.NullInt32
+	LastTermination  *kcorev1.ContainerStateTerminated `db:"-"`
 }
 
 func NewContainer(podUuid types.UUID, container kcorev1.Container, status kcorev1.ContainerStatus) *Container {
@@ -213,10 +218,24 @@ func NewContainer(podUuid types.UUID, container kcorev1.Container, status kcorev
 	c.ContainerCommon.Obtain(podUuid, container, status)
 	c.ContainerResources.Obtain(container)
 	c.ContainerRestartable.Obtain(status)
+	c.LastTermination = status.LastTerminationState.Terminated
 
 	return c
 }
 
+// ContainerRestart is a restart of a container, derived from the increase of its restart count.
+type ContainerRestart struct {
+	Uuid          types.UUID
+	ClusterUuid   types.UUID
+	ContainerUuid types.UUID
+	PodUuid       types.UUID
+	RestartCount  int32
+	// Reason and ExitCode are of the termination before the restart, only known for the last one.
+	Reason    sql.NullString
+	ExitCode  sql.NullInt32
+	EventTime types.UnixMilli
+}
+
 type ContainerDevice struct {
 	ContainerUuid types.UUID
 	PodUuid       types.UUID
@@ -420,11 +439,12 @@ func GetContainerState(container kcorev1.Container, status kcorev1.ContainerStat
 }
 
 // SyncContainers consumes from the `upsertPods` and `deletePods` chans concurrently and schedules a job for
-// each of the containers (drawn from `upsertPods`) that periodically syncs the container logs with the database.
+// each of the containers (drawn from `upsertPods`) that periodically syncs the container logs with the database,
+// unless logs is false.
 // When pods are deleted, their IDs are streamed through the `deletePods` chan, and this fetches all the container
 // IDs matching the respective pod ID from the database and initiates a container deletion stream that cleans up all
 // container-related resources.
-func SyncContainers(ctx context.Context, db *database.Database, g *errgroup.Group, upsertPods <-chan interface{}, deletePods <-chan interface{}) {
+func SyncContainers(ctx context.Context, db *database.Database, g *errgroup.Group, upsertPods <-chan interface{}, deletePods <-chan interface{}, logs bool) {
 	type containerFingerprint struct {
 		Uuid    types.UUID
 		PodUuid types.UUID
@@ -454,6 +474,8 @@ func SyncContainers(ctx context.Context, db *database.Database, g *errgroup.Grou
 
 		scheduler.StartAsync()
 		defer scheduler.Stop()
+		// Jobs are scheduled again for the pods forwarded after a restart, as they use ctx.
+		defer scheduler.Clear()
 
 		query := db.BuildSelectStmt(&Container{}, containerFingerprint{}) + ` WHERE pod_uuid=:pod_uuid`
 
@@ -524,7 +546,7 @@ func SyncContainers(ctx context.Context, db *database.Database, g *errgroup.Grou
 						return err
 					}
 
-					if container.Started.Bool && err != nil {
+					if logs && container.Started.Bool && err != nil {
 						containerLog := &ContainerLog{
 							ContainerUuid: container.Uuid,
 							PodUuid:       container.PodUuid,
@@ -0,0 +1,32 @@
+package v1
+
+import "github.com/icinga/icinga-go-library/types"
+
+// CostNamespace is the estimated cost of the pods of a namespace during an hour.
+type CostNamespace struct {
+	ClusterUuid types.UUID
+	Namespace   string
+	// Hour is the start of the hour.
+	Hour       types.UnixMilli
+	CpuCost    float64
+	MemoryCost float64
+	// Cost is the sum of CpuCost and MemoryCost.
+	Cost     float64
+	Currency string
+}
+
+// CostWorkload is the estimated cost of the pods of a workload, e.g. a deployment, during an hour.
+// Pods are attributed to the top-level controller of their owner chain, or to themselves if they have none.
+type CostWorkload struct {
+	ClusterUuid types.UUID
+	Namespace   string
+	Kind        string
+	Name        string
+	// Hour is the start of the hour.
+	Hour       types.UnixMilli
+	CpuCost    float64
+	MemoryCost float64
+	// Cost is the sum of CpuCost and MemoryCost.
+	Cost     float64
+	Currency string
+}
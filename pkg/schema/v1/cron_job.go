@@ -14,6 +14,7 @@ import (
 
 type CronJob struct {
 	Meta
+	LastChange
 	Schedule                   string
 	Timezone                   sql.NullString
 	StartingDeadlineSeconds    sql.NullInt64
@@ -45,8 +46,9 @@ func NewCronJob() Resource {
 	return &CronJob{}
 }
 
-func (c *CronJob) Obtain(k8s kmetav1.Object) {
-	c.ObtainMeta(k8s)
+func (c *CronJob) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	c.ObtainMeta(k8s, clusterUuid)
+	c.ObtainLastChange(k8s)
 
 	cronJob := k8s.(*kbatchv1.CronJob)
 
@@ -119,3 +121,30 @@ func (c *CronJob) Relations() []database.Relation {
 		database.HasMany(c.Annotations, database.WithoutCascadeDelete()),
 	}
 }
+
+// CronJobProblem is a problem of a cron job whose runs are missed or overlap, raised by the cron job tracker.
+// Scheduled is the time of the first run that wasn't started.
+type CronJobProblem struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	CronJobUuid types.UUID
+	Namespace   string
+	Name        string
+	Reason      string
+	Message     sql.NullString
+	Scheduled   types.UnixMilli
+	Started     types.UnixMilli
+	Cleared     types.UnixMilli
+}
+
+func (c *CronJobProblem) GetUuid() types.UUID {
+	return c.Uuid
+}
+
+func (c *CronJobProblem) GetReason() string {
+	return c.Reason
+}
+
+func (c *CronJobProblem) SetCleared(cleared types.UnixMilli) {
+	c.Cleared = cleared
+}
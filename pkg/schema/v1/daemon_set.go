@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/icinga/icinga-go-library/strcase"
 	"github.com/icinga/icinga-go-library/types"
@@ -16,6 +17,7 @@ import (
 
 type DaemonSet struct {
 	Meta
+	LastChange
 	UpdateStrategy         string
 	MinReadySeconds        int32
 	DesiredNumberScheduled int32
@@ -65,12 +67,37 @@ type DaemonSetAnnotation struct {
 	AnnotationUuid types.UUID
 }
 
+// Reasons of daemon set coverage gaps.
+const (
+	// DaemonSetCoverageMissing is a node without pod of a daemon set that should run on it.
+	DaemonSetCoverageMissing = "missing"
+	// DaemonSetCoverageNotRunning is a node whose pod of a daemon set is not running.
+	DaemonSetCoverageNotRunning = "not_running"
+)
+
+// DaemonSetCoverageGap is a node that should, but doesn't run a pod of a daemon set,
+// as its node selector, required node affinity and tolerations match the node.
+// PodName and PodPhase are only set for pods that are not running.
+type DaemonSetCoverageGap struct {
+	DaemonSetUuid types.UUID
+	NodeUuid      types.UUID
+	ClusterUuid   types.UUID
+	Namespace     string
+	DaemonSetName string
+	NodeName      string
+	Reason        string
+	PodName       sql.NullString
+	PodPhase      sql.NullString
+	Computed      types.UnixMilli
+}
+
 func NewDaemonSet() Resource {
 	return &DaemonSet{}
 }
 
-func (d *DaemonSet) Obtain(k8s kmetav1.Object) {
-	d.ObtainMeta(k8s)
+func (d *DaemonSet) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	d.ObtainMeta(k8s, clusterUuid)
+	d.ObtainLastChange(k8s)
 
 	daemonSet := k8s.(*kappsv1.DaemonSet)
 
@@ -84,6 +111,7 @@ func (d *DaemonSet) Obtain(k8s kmetav1.Object) {
 	d.NumberAvailable = daemonSet.Status.NumberAvailable
 	d.NumberUnavailable = daemonSet.Status.NumberUnavailable
 	d.IcingaState, d.IcingaStateReason = d.getIcingaState()
+	d.IcingaState, d.IcingaStateReason = ignore(k8s, d.IcingaState, d.IcingaStateReason)
 
 	for _, condition := range daemonSet.Status.Conditions {
 		d.Conditions = append(d.Conditions, DaemonSetCondition{
@@ -154,6 +182,11 @@ func (d *DaemonSet) Obtain(k8s kmetav1.Object) {
 	d.Yaml = string(output)
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (d *DaemonSet) State() (IcingaState, string) {
+	return d.IcingaState, d.IcingaStateReason
+}
+
 func (d *DaemonSet) getIcingaState() (IcingaState, string) {
 	if d.DesiredNumberScheduled < 1 {
 		reason := fmt.Sprintf("DaemonSet %s/%s has an invalid desired node count: %d.", d.Namespace, d.Name, d.DesiredNumberScheduled)
@@ -17,6 +17,7 @@ import (
 
 type Deployment struct {
 	Meta
+	LastChange
 	Strategy                string
 	MinReadySeconds         int32
 	ProgressDeadlineSeconds int32
@@ -72,8 +73,9 @@ func NewDeployment() Resource {
 	return &Deployment{}
 }
 
-func (d *Deployment) Obtain(k8s kmetav1.Object) {
-	d.ObtainMeta(k8s)
+func (d *Deployment) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	d.ObtainMeta(k8s, clusterUuid)
+	d.ObtainLastChange(k8s)
 
 	deployment := k8s.(*kappsv1.Deployment)
 
@@ -95,6 +97,7 @@ func (d *Deployment) Obtain(k8s kmetav1.Object) {
 	d.ReadyReplicas = deployment.Status.ReadyReplicas
 	d.UnavailableReplicas = deployment.Status.UnavailableReplicas
 	d.IcingaState, d.IcingaStateReason = d.getIcingaState()
+	d.IcingaState, d.IcingaStateReason = ignore(k8s, d.IcingaState, d.IcingaStateReason)
 
 	for _, condition := range deployment.Status.Conditions {
 		d.Conditions = append(d.Conditions, DeploymentCondition{
@@ -166,6 +169,11 @@ func (d *Deployment) Obtain(k8s kmetav1.Object) {
 	d.Yaml = string(output)
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (d *Deployment) State() (IcingaState, string) {
+	return d.IcingaState, d.IcingaStateReason
+}
+
 func (d *Deployment) getIcingaState() (IcingaState, string) {
 	if gracePeriodReason := IsWithinGracePeriod(d); gracePeriodReason != nil {
 		return Ok, *gracePeriodReason
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/icinga/icinga-go-library/database"
+	"github.com/icinga/icinga-go-library/types"
+	"strings"
+)
+
+// NodeDisk is a local disk of a node with the SMART attributes that are the best predictors of disk failures.
+// Disks are not Kubernetes resources, so they are reported by node-exporter,
+// i.e. by its textfile collector with the smartmon script, and identified by their device, e.g. /dev/sda.
+// Attributes that the disk doesn't report are NULL.
+type NodeDisk struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	NodeUuid    types.UUID
+	Device      string
+	Model       sql.NullString
+	Serial      sql.NullString
+	// Healthy is the overall SMART self-assessment of the disk.
+	Healthy              types.Bool
+	Temperature          sql.NullFloat64
+	PowerOnHours         sql.NullInt64
+	ReallocatedSectors   sql.NullInt64
+	PendingSectors       sql.NullInt64
+	OfflineUncorrectable sql.NullInt64
+	IcingaState          IcingaState
+	IcingaStateReason    string
+	Updated              types.UnixMilli
+}
+
+// NewNodeDisk creates a new NodeDisk for the given device of the node with the given UUID.
+func NewNodeDisk(clusterUuid, nodeUuid types.UUID, device string) *NodeDisk {
+	return &NodeDisk{
+		Uuid:        NewUUID(nodeUuid, device),
+		ClusterUuid: clusterUuid,
+		NodeUuid:    nodeUuid,
+		Device:      device,
+	}
+}
+
+func (d *NodeDisk) ID() database.ID {
+	return compoundId{id: d.Uuid.String()}
+}
+
+func (d *NodeDisk) SetID(id database.ID) {
+	panic("Not expected to be called")
+}
+
+func (d *NodeDisk) Fingerprint() database.Fingerprinter {
+	return d
+}
+
+// Evaluate evaluates the Icinga state of the disk from its attributes.
+// Disks whose self-assessment failed are critical, and disks with reallocated, pending or uncorrectable sectors
+// are warnings, as these usually precede a failure.
+func (d *NodeDisk) Evaluate() {
+	var sectors []string
+	for _, s := range []struct {
+		name  string
+		count sql.NullInt64
+	}{
+		{"reallocated", d.ReallocatedSectors},
+		{"pending", d.PendingSectors},
+		{"offline uncorrectable", d.OfflineUncorrectable},
+	} {
+		if s.count.Int64 > 0 {
+			sectors = append(sectors, fmt.Sprintf("%d %s", s.count.Int64, s.name))
+		}
+	}
+
+	switch {
+	case d.Healthy.Valid && !d.Healthy.Bool:
+		d.IcingaState = Critical
+		d.IcingaStateReason = fmt.Sprintf("Disk %s failed its SMART self-assessment.", d.Device)
+	case len(sectors) > 0:
+		d.IcingaState = Warning
+		d.IcingaStateReason = fmt.Sprintf("Disk %s has %s sectors.", d.Device, strings.Join(sectors, ", "))
+	case !d.Healthy.Valid:
+		d.IcingaState = Unknown
+		d.IcingaStateReason = fmt.Sprintf("Disk %s doesn't report its SMART self-assessment.", d.Device)
+	default:
+		d.IcingaState = Ok
+		d.IcingaStateReason = fmt.Sprintf("Disk %s is healthy.", d.Device)
+	}
+}
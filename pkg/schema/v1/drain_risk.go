@@ -0,0 +1,35 @@
+package v1
+
+import (
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// NodeDrainRisk is the risk that draining a node violates the pod disruption budgets of the pods on it.
+// Pods are the healthy pods on the node that are covered by a pod disruption budget and would be evicted,
+// ViolatingPods those of them whose eviction exceeds the disruptions currently allowed by their budget,
+// and Score the percentage of Pods that are ViolatingPods.
+// A score above 0 means that a drain of the node blocks until the workloads have recovered on other nodes.
+type NodeDrainRisk struct {
+	Uuid          types.UUID
+	NodeUuid      types.UUID
+	ClusterUuid   types.UUID
+	Score         float64
+	Pods          int32
+	ViolatingPods int32
+	ViolatedPdbs  int32
+	Computed      types.UnixMilli
+}
+
+// NodeDrainRiskPdb is a pod disruption budget that covers healthy pods on a node,
+// with the number of its disruptions that a drain of the node would exceed, if any.
+type NodeDrainRiskPdb struct {
+	Uuid               types.UUID
+	NodeUuid           types.UUID
+	ClusterUuid        types.UUID
+	Namespace          string
+	PdbName            string
+	Pods               int32
+	DisruptionsAllowed int32
+	Excess             int32
+	Computed           types.UnixMilli
+}
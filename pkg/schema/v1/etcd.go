@@ -0,0 +1,35 @@
+package v1
+
+import (
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Sources of etcd object counts.
+const (
+	// EtcdObjectCountSourceMetrics is a count reported by the API server in its apiserver_storage_objects metric.
+	EtcdObjectCountSourceMetrics = "metrics"
+	// EtcdObjectCountSourceList is a count of the objects listed via the API, if the metrics can't be read.
+	EtcdObjectCountSourceList = "list"
+)
+
+// EtcdObjectCount is the number of objects of a resource stored in etcd at a point in time,
+// e.g. of pods or deployments.apps.
+type EtcdObjectCount struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	Timestamp   types.UnixMilli
+	Resource    string
+	Objects     int64
+	Source      string
+}
+
+// EtcdSize is the size in bytes of the database of an etcd cluster at a point in time,
+// as reported by the API server. StorageCluster identifies the etcd cluster, as the API server
+// may store resources in separate clusters, e.g. events.
+type EtcdSize struct {
+	Uuid           types.UUID
+	ClusterUuid    types.UUID
+	Timestamp      types.UnixMilli
+	StorageCluster string
+	Size           int64
+}
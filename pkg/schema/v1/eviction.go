@@ -0,0 +1,35 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Kinds of pod evictions.
+const (
+	// EvictionNodePressure is an eviction by the kubelet due to node pressure.
+	EvictionNodePressure = "node_pressure"
+	// EvictionPreemption is a preemption by the scheduler to make room for a pod with higher priority.
+	EvictionPreemption = "preemption"
+	// EvictionApi is an eviction via the eviction API, e.g. while nodes are drained.
+	EvictionApi = "api"
+	// EvictionTaint is a deletion by the taint manager due to a NoExecute taint of the node.
+	EvictionTaint = "taint"
+	// EvictionPodGc is a deletion by the pod garbage collector, e.g. of pods of nodes that are gone.
+	EvictionPodGc = "pod_gc"
+)
+
+// PodEviction is an eviction or preemption of a pod, i.e. a disruption not caused by the pod itself.
+type PodEviction struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	PodUuid     types.UUID
+	NodeUuid    types.Binary
+	Namespace   string
+	PodName     string
+	NodeName    sql.NullString
+	Kind        string
+	Reason      string
+	Message     sql.NullString
+	EventTime   types.UnixMilli
+}
@@ -0,0 +1,433 @@
+package v1
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// Health and sync statuses of Argo CD applications.
+const (
+	argoHealthy     = "Healthy"
+	argoDegraded    = "Degraded"
+	argoMissing     = "Missing"
+	argoProgressing = "Progressing"
+	argoSuspended   = "Suspended"
+	argoOutOfSync   = "OutOfSync"
+	argoSynced      = "Synced"
+)
+
+// fluxReady is the condition with which Flux reports whether the last reconciliation of an object succeeded.
+const fluxReady = "Ready"
+
+// GitopsApp is an application deployed by a GitOps tool, which has a problem if it is unhealthy or drifted
+// from its source. The resources it manages are stored with it, so that workloads can be linked to the application
+// owning them.
+type GitopsApp interface {
+	Stater
+	// Problem returns the reason and message of the problem of the application, or an empty reason if it has none.
+	Problem() (reason, message string)
+}
+
+// ArgoApplication is an Argo CD application, which deploys the resources of its source to its destination.
+type ArgoApplication struct {
+	Meta
+	Project              string
+	RepoUrl              sql.NullString
+	Path                 sql.NullString
+	TargetRevision       sql.NullString
+	DestinationServer    sql.NullString
+	DestinationNamespace sql.NullString
+	SyncStatus           sql.NullString
+	SyncRevision         sql.NullString
+	HealthStatus         sql.NullString
+	HealthMessage        sql.NullString
+	OperationPhase       sql.NullString
+	OperationMessage     sql.NullString
+	Yaml                 string
+	IcingaState          IcingaState
+	IcingaStateReason    string
+	Resources            []ArgoApplicationResource `db:"-"`
+	problemReason        string
+	problemMessage       string
+}
+
+// ArgoApplicationResource is a resource managed by an Argo CD application.
+type ArgoApplicationResource struct {
+	ArgoApplicationUuid types.UUID
+	ApiGroup            string
+	Kind                string
+	Namespace           string
+	Name                string
+	SyncStatus          sql.NullString
+	HealthStatus        sql.NullString
+}
+
+// FluxKustomization is a Flux kustomization, which applies the manifests built from the path of its source.
+type FluxKustomization struct {
+	Meta
+	SourceKind            string
+	SourceName            string
+	Path                  sql.NullString
+	Suspend               types.Bool
+	Ready                 types.Bool
+	ReadyReason           sql.NullString
+	ReadyMessage          sql.NullString
+	LastAppliedRevision   sql.NullString
+	LastAttemptedRevision sql.NullString
+	Yaml                  string
+	IcingaState           IcingaState
+	IcingaStateReason     string
+	Resources             []FluxKustomizationResource `db:"-"`
+}
+
+// FluxKustomizationResource is a resource in the inventory of a Flux kustomization.
+type FluxKustomizationResource struct {
+	FluxKustomizationUuid types.UUID
+	ApiGroup              string
+	Kind                  string
+	Namespace             string
+	Name                  string
+}
+
+// GitopsProblem is raised for an Argo CD application or a Flux kustomization that is unhealthy
+// or drifted from its source, and cleared once resolved or deleted.
+type GitopsProblem struct {
+	Uuid         types.UUID
+	ClusterUuid  types.UUID
+	ResourceType string
+	ResourceUuid types.UUID
+	Namespace    string
+	Name         string
+	Reason       string
+	Message      sql.NullString
+	Started      types.UnixMilli
+	Cleared      types.UnixMilli
+}
+
+func (g *GitopsProblem) GetUuid() types.UUID {
+	return g.Uuid
+}
+
+func (g *GitopsProblem) GetReason() string {
+	return g.Reason
+}
+
+func (g *GitopsProblem) SetCleared(cleared types.UnixMilli) {
+	g.Cleared = cleared
+}
+
+// argoApplication and fluxKustomization contain the fields of argoproj.io/v1alpha1 applications
+// and kustomize.toolkit.fluxcd.io/v1 kustomizations that are synchronized,
+// as the API types of Argo CD and Flux are not a dependency.
+type argoApplication struct {
+	Spec struct {
+		Project string `json:"project"`
+		Source  *struct {
+			RepoUrl        string `json:"repoURL"`
+			Path           string `json:"path"`
+			Chart          string `json:"chart"`
+			TargetRevision string `json:"targetRevision"`
+		} `json:"source"`
+		Destination struct {
+			Server    string `json:"server"`
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"destination"`
+	} `json:"spec"`
+	Status struct {
+		Sync struct {
+			Status   string `json:"status"`
+			Revision string `json:"revision"`
+		} `json:"sync"`
+		Health struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"health"`
+		OperationState *struct {
+			Phase   string `json:"phase"`
+			Message string `json:"message"`
+		} `json:"operationState"`
+		Resources []struct {
+			Group     string `json:"group"`
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+			Status    string `json:"status"`
+			Health    *struct {
+				Status string `json:"status"`
+			} `json:"health"`
+		} `json:"resources"`
+	} `json:"status"`
+}
+
+type fluxKustomization struct {
+	Spec struct {
+		SourceRef struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"sourceRef"`
+		Path    string `json:"path"`
+		Suspend bool   `json:"suspend"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+		LastAppliedRevision   string `json:"lastAppliedRevision"`
+		LastAttemptedRevision string `json:"lastAttemptedRevision"`
+		Inventory             *struct {
+			Entries []struct {
+				Id string `json:"id"`
+			} `json:"entries"`
+		} `json:"inventory"`
+	} `json:"status"`
+}
+
+func NewArgoApplication() Resource {
+	return &ArgoApplication{}
+}
+
+func (a *ArgoApplication) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	a.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var app argoApplication
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &app); err != nil {
+		return
+	}
+
+	a.Project = app.Spec.Project
+	if source := app.Spec.Source; source != nil {
+		a.RepoUrl = NewNullableString(source.RepoUrl)
+		a.Path = NewNullableString(source.Path)
+		if source.Chart != "" {
+			a.Path = NewNullableString(source.Chart)
+		}
+		a.TargetRevision = NewNullableString(source.TargetRevision)
+	}
+	a.DestinationServer = NewNullableString(app.Spec.Destination.Server)
+	if app.Spec.Destination.Name != "" {
+		a.DestinationServer = NewNullableString(app.Spec.Destination.Name)
+	}
+	a.DestinationNamespace = NewNullableString(app.Spec.Destination.Namespace)
+	a.SyncStatus = NewNullableString(app.Status.Sync.Status)
+	a.SyncRevision = NewNullableString(app.Status.Sync.Revision)
+	a.HealthStatus = NewNullableString(app.Status.Health.Status)
+	a.HealthMessage = NewNullableString(app.Status.Health.Message)
+	if app.Status.OperationState != nil {
+		a.OperationPhase = NewNullableString(app.Status.OperationState.Phase)
+		a.OperationMessage = NewNullableString(app.Status.OperationState.Message)
+	}
+
+	// Resources that are not healthy or not in sync are listed in problem messages.
+	var affected []string
+	for _, r := range app.Status.Resources {
+		resource := ArgoApplicationResource{
+			ArgoApplicationUuid: a.Uuid,
+			ApiGroup:            r.Group,
+			Kind:                r.Kind,
+			Namespace:           r.Namespace,
+			Name:                r.Name,
+			SyncStatus:          NewNullableString(r.Status),
+		}
+		if r.Health != nil {
+			resource.HealthStatus = NewNullableString(r.Health.Status)
+		}
+		a.Resources = append(a.Resources, resource)
+
+		if r.Status == argoOutOfSync || (r.Health != nil && r.Health.Status != argoHealthy) {
+			status := r.Status
+			if r.Health != nil {
+				status += ", " + r.Health.Status
+			}
+			affected = append(affected, fmt.Sprintf("%s %s (%s)", r.Kind, namespacedName(r.Namespace, r.Name), status))
+		}
+	}
+
+	a.IcingaState, a.IcingaStateReason = a.getIcingaState()
+	if a.IcingaState == Warning || a.IcingaState == Critical {
+		a.problemMessage = a.IcingaStateReason
+		if len(affected) > 0 {
+			a.problemMessage += " Affected resources: " + strings.Join(affected, ", ") + "."
+		}
+	}
+	a.IcingaState, a.IcingaStateReason = ignore(k8s, a.IcingaState, a.IcingaStateReason)
+
+	output, _ := yaml.Marshal(u.Object)
+	a.Yaml = string(output)
+}
+
+func (a *ArgoApplication) Relations() []database.Relation {
+	fk := database.WithForeignKey("argo_application_uuid")
+
+	return []database.Relation{
+		database.HasMany(a.Resources, fk),
+	}
+}
+
+func (a *ArgoApplication) State() (IcingaState, string) {
+	return a.IcingaState, a.IcingaStateReason
+}
+
+func (a *ArgoApplication) Problem() (string, string) {
+	if a.IcingaState != Warning && a.IcingaState != Critical {
+		return "", ""
+	}
+
+	return a.problemReason, a.problemMessage
+}
+
+// getIcingaState returns the Icinga state of the application and sets the reason of its problem, if any.
+// Unhealthy applications and failed syncs are critical, applications that drifted from their source are warnings.
+func (a *ArgoApplication) getIcingaState() (IcingaState, string) {
+	name := a.Namespace + "/" + a.Name
+
+	switch {
+	case a.HealthStatus.String == argoDegraded || a.HealthStatus.String == argoMissing:
+		a.problemReason = a.HealthStatus.String
+
+		return Critical, fmt.Sprintf("Application %s is %s: %s", name, strings.ToLower(a.HealthStatus.String),
+			strings.TrimSuffix(a.HealthMessage.String, ".")+".")
+	case a.OperationPhase.String == "Failed" || a.OperationPhase.String == "Error":
+		a.problemReason = "SyncFailed"
+
+		return Critical, fmt.Sprintf("Sync of application %s failed: %s", name,
+			strings.TrimSuffix(a.OperationMessage.String, ".")+".")
+	case a.SyncStatus.String == argoOutOfSync:
+		a.problemReason = argoOutOfSync
+
+		return Warning, fmt.Sprintf("Application %s is out of sync with revision %s of %s.",
+			name, a.TargetRevision.String, a.RepoUrl.String)
+	case !a.HealthStatus.Valid && !a.SyncStatus.Valid:
+		return Pending, fmt.Sprintf("Application %s has not been reconciled yet.", name)
+	case a.HealthStatus.String == argoProgressing:
+		return Pending, fmt.Sprintf("Application %s is progressing.", name)
+	case a.HealthStatus.String == argoSuspended:
+		return Ok, fmt.Sprintf("Application %s is suspended.", name)
+	case a.HealthStatus.String == argoHealthy && a.SyncStatus.String == argoSynced:
+		return Ok, fmt.Sprintf("Application %s is healthy and in sync.", name)
+	default:
+		return Unknown, fmt.Sprintf("Application %s has an unknown health or sync status.", name)
+	}
+}
+
+func NewFluxKustomization() Resource {
+	return &FluxKustomization{}
+}
+
+func (k *FluxKustomization) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	k.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var ks fluxKustomization
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &ks); err != nil {
+		return
+	}
+
+	k.SourceKind = ks.Spec.SourceRef.Kind
+	k.SourceName = ks.Spec.SourceRef.Name
+	k.Path = NewNullableString(ks.Spec.Path)
+	k.Suspend = types.Bool{Bool: ks.Spec.Suspend, Valid: true}
+	k.LastAppliedRevision = NewNullableString(ks.Status.LastAppliedRevision)
+	k.LastAttemptedRevision = NewNullableString(ks.Status.LastAttemptedRevision)
+
+	for _, c := range ks.Status.Conditions {
+		if c.Type != fluxReady {
+			continue
+		}
+
+		if c.Status != string(kmetav1.ConditionUnknown) {
+			k.Ready = types.Bool{Bool: c.Status == string(kmetav1.ConditionTrue), Valid: true}
+		}
+		k.ReadyReason = NewNullableString(c.Reason)
+		k.ReadyMessage = NewNullableString(c.Message)
+	}
+
+	if ks.Status.Inventory != nil {
+		for _, e := range ks.Status.Inventory.Entries {
+			// Entries are identified by <namespace>_<name>_<group>_<kind>, none of which contains underscores.
+			parts := strings.Split(e.Id, "_")
+			if len(parts) != 4 {
+				continue
+			}
+
+			k.Resources = append(k.Resources, FluxKustomizationResource{
+				FluxKustomizationUuid: k.Uuid,
+				ApiGroup:              parts[2],
+				Kind:                  parts[3],
+				Namespace:             parts[0],
+				Name:                  parts[1],
+			})
+		}
+	}
+
+	name := k.Namespace + "/" + k.Name
+	switch {
+	case ks.Spec.Suspend:
+		k.IcingaState = Ok
+		k.IcingaStateReason = fmt.Sprintf("Kustomization %s is suspended.", name)
+	case !k.Ready.Valid:
+		k.IcingaState = Pending
+		k.IcingaStateReason = fmt.Sprintf("Kustomization %s is being reconciled.", name)
+	case !k.Ready.Bool:
+		k.IcingaState = Critical
+		k.IcingaStateReason = fmt.Sprintf("Kustomization %s is not ready: %s: %s", name, k.ReadyReason.String,
+			strings.TrimSuffix(k.ReadyMessage.String, ".")+".")
+	default:
+		k.IcingaState = Ok
+		k.IcingaStateReason = fmt.Sprintf(
+			"Kustomization %s has applied revision %s.", name, k.LastAppliedRevision.String)
+	}
+	k.IcingaState, k.IcingaStateReason = ignore(k8s, k.IcingaState, k.IcingaStateReason)
+
+	output, _ := yaml.Marshal(u.Object)
+	k.Yaml = string(output)
+}
+
+func (k *FluxKustomization) Relations() []database.Relation {
+	fk := database.WithForeignKey("flux_kustomization_uuid")
+
+	return []database.Relation{
+		database.HasMany(k.Resources, fk),
+	}
+}
+
+func (k *FluxKustomization) State() (IcingaState, string) {
+	return k.IcingaState, k.IcingaStateReason
+}
+
+// Problem returns the reason of the Ready condition, e.g. HealthCheckFailed, if the kustomization is not ready.
+func (k *FluxKustomization) Problem() (string, string) {
+	if k.IcingaState != Critical {
+		return "", ""
+	}
+
+	return k.ReadyReason.String, k.IcingaStateReason
+}
+
+// namespacedName returns namespace/name, or name for cluster-scoped resources.
+func namespacedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+
+	return namespace + "/" + name
+}
@@ -0,0 +1,186 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+	kautoscalingv2 "k8s.io/api/autoscaling/v2"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	kserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	kjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+)
+
+// Hpa is a horizontal pod autoscaler.
+// ScalingMetric is the metric that proposes the most replicas and therefore determines the desired replicas,
+// and ScalingMetricRatio the ratio of its current to its target value, e.g. 1.5 if it is at 150% of its target.
+type Hpa struct {
+	Meta
+	ScaleTargetKind    string
+	ScaleTargetName    string
+	MinReplicas        int32
+	MaxReplicas        int32
+	CurrentReplicas    int32
+	DesiredReplicas    int32
+	LastScaleTime      types.UnixMilli
+	ScalingMetric      sql.NullString
+	ScalingMetricRatio sql.NullFloat64
+	Yaml               string
+	// Annotations are only kept to override thresholds.
+	Annotations map[string]string `db:"-"`
+}
+
+// HpaScaling is a change of the desired replicas of a horizontal pod autoscaler at its last scale time,
+// along with the metric that determined the desired replicas at that time.
+type HpaScaling struct {
+	Uuid               types.UUID
+	ClusterUuid        types.UUID
+	HpaUuid            types.UUID
+	PreviousReplicas   int32
+	DesiredReplicas    int32
+	ScalingMetric      sql.NullString
+	ScalingMetricRatio sql.NullFloat64
+	EventTime          types.UnixMilli
+}
+
+// HpaProblem is a problem of a horizontal pod autoscaler, i.e. a scaling thrash,
+// with the metric that determined most of its scalings.
+type HpaProblem struct {
+	Uuid            types.UUID
+	ClusterUuid     types.UUID
+	HpaUuid         types.UUID
+	Namespace       string
+	Name            string
+	ScaleTargetKind string
+	ScaleTargetName string
+	Reason          string
+	Message         sql.NullString
+	ScalingMetric   sql.NullString
+	Scalings        int32
+	Started         types.UnixMilli
+	Cleared         types.UnixMilli
+}
+
+func (h *HpaProblem) GetUuid() types.UUID {
+	return h.Uuid
+}
+
+func (h *HpaProblem) GetReason() string {
+	return h.Reason
+}
+
+func (h *HpaProblem) SetCleared(cleared types.UnixMilli) {
+	h.Cleared = cleared
+}
+
+func NewHpa() Resource {
+	return &Hpa{}
+}
+
+func (h *Hpa) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	h.ObtainMeta(k8s, clusterUuid)
+
+	hpa := k8s.(*kautoscalingv2.HorizontalPodAutoscaler)
+
+	h.ScaleTargetKind = hpa.Spec.ScaleTargetRef.Kind
+	h.ScaleTargetName = hpa.Spec.ScaleTargetRef.Name
+	// minReplicas defaults to 1 if not configured.
+	h.MinReplicas = 1
+	if hpa.Spec.MinReplicas != nil {
+		h.MinReplicas = *hpa.Spec.MinReplicas
+	}
+	h.MaxReplicas = hpa.Spec.MaxReplicas
+	h.CurrentReplicas = hpa.Status.CurrentReplicas
+	h.DesiredReplicas = hpa.Status.DesiredReplicas
+	if hpa.Status.LastScaleTime != nil {
+		h.LastScaleTime = types.UnixMilli(hpa.Status.LastScaleTime.Time)
+	}
+	h.Annotations = hpa.Annotations
+
+	targets := make(map[string]kautoscalingv2.MetricTarget, len(hpa.Spec.Metrics))
+	for _, m := range hpa.Spec.Metrics {
+		if name, target, ok := hpaMetricTarget(m); ok {
+			targets[name] = target
+		}
+	}
+
+	for _, m := range hpa.Status.CurrentMetrics {
+		name, current, ok := hpaMetricValue(m)
+		if !ok {
+			continue
+		}
+
+		target, ok := targets[name]
+		if !ok {
+			continue
+		}
+
+		ratio, ok := hpaMetricRatio(current, target)
+		if ok && (!h.ScalingMetricRatio.Valid || ratio > h.ScalingMetricRatio.Float64) {
+			h.ScalingMetric = NewNullableString(name)
+			h.ScalingMetricRatio = sql.NullFloat64{Float64: ratio, Valid: true}
+		}
+	}
+
+	scheme := kruntime.NewScheme()
+	_ = kautoscalingv2.AddToScheme(scheme)
+	codec := kserializer.NewCodecFactory(scheme).EncoderForVersion(kjson.NewYAMLSerializer(kjson.DefaultMetaFactory, scheme, scheme), kautoscalingv2.SchemeGroupVersion)
+	output, _ := kruntime.Encode(codec, hpa)
+	h.Yaml = string(output)
+}
+
+// hpaMetricTarget returns the name and target of the given metric of a horizontal pod autoscaler.
+// Metrics of containers are named after their container and resource, e.g. app/cpu.
+func hpaMetricTarget(m kautoscalingv2.MetricSpec) (string, kautoscalingv2.MetricTarget, bool) {
+	switch {
+	case m.Resource != nil:
+		return string(m.Resource.Name), m.Resource.Target, true
+	case m.ContainerResource != nil:
+		return m.ContainerResource.Container + "/" + string(m.ContainerResource.Name), m.ContainerResource.Target, true
+	case m.Pods != nil:
+		return m.Pods.Metric.Name, m.Pods.Target, true
+	case m.Object != nil:
+		return m.Object.Metric.Name, m.Object.Target, true
+	case m.External != nil:
+		return m.External.Metric.Name, m.External.Target, true
+	default:
+		return "", kautoscalingv2.MetricTarget{}, false
+	}
+}
+
+// hpaMetricValue returns the name and current value of the given metric of a horizontal pod autoscaler.
+func hpaMetricValue(m kautoscalingv2.MetricStatus) (string, kautoscalingv2.MetricValueStatus, bool) {
+	switch {
+	case m.Resource != nil:
+		return string(m.Resource.Name), m.Resource.Current, true
+	case m.ContainerResource != nil:
+		return m.ContainerResource.Container + "/" + string(m.ContainerResource.Name), m.ContainerResource.Current, true
+	case m.Pods != nil:
+		return m.Pods.Metric.Name, m.Pods.Current, true
+	case m.Object != nil:
+		return m.Object.Metric.Name, m.Object.Current, true
+	case m.External != nil:
+		return m.External.Metric.Name, m.External.Current, true
+	default:
+		return "", kautoscalingv2.MetricValueStatus{}, false
+	}
+}
+
+// hpaMetricRatio returns the ratio of the given current value of a metric to its target,
+// or false if the target is not set or zero.
+func hpaMetricRatio(current kautoscalingv2.MetricValueStatus, target kautoscalingv2.MetricTarget) (float64, bool) {
+	var c, t float64
+	switch {
+	case target.AverageUtilization != nil && current.AverageUtilization != nil:
+		c, t = float64(*current.AverageUtilization), float64(*target.AverageUtilization)
+	case target.AverageValue != nil && current.AverageValue != nil:
+		c, t = current.AverageValue.AsApproximateFloat64(), target.AverageValue.AsApproximateFloat64()
+	case target.Value != nil && current.Value != nil:
+		c, t = current.Value.AsApproximateFloat64(), target.Value.AsApproximateFloat64()
+	}
+
+	if t == 0 {
+		return 0, false
+	}
+
+	return c / t, true
+}
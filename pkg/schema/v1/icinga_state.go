@@ -3,6 +3,7 @@ package v1
 import (
 	"database/sql/driver"
 	"fmt"
+	"github.com/pkg/errors"
 )
 
 type IcingaState uint8
@@ -32,6 +33,17 @@ func (s IcingaState) String() string {
 	}
 }
 
+// ParseIcingaState returns the IcingaState with the given string representation, e.g. from the database.
+func ParseIcingaState(s string) (IcingaState, error) {
+	for _, state := range []IcingaState{Ok, Pending, Unknown, Warning, Critical} {
+		if state.String() == s {
+			return state, nil
+		}
+	}
+
+	return Unknown, errors.Errorf("invalid Icinga state %q", s)
+}
+
 // Value implements the driver.Valuer interface.
 func (s IcingaState) Value() (driver.Value, error) {
 	return s.String(), nil
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"github.com/icinga/icinga-go-library/types"
+	kcorev1 "k8s.io/api/core/v1"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// The following functions derive the IDs of objects, so that controllers and the metric sync
+// identify the same objects by the same keys.
+
+// NodeUUID returns the ID of the given node.
+func NodeUUID(node *kcorev1.Node) types.UUID {
+	return EnsureUUID(node.UID)
+}
+
+// PodUUID returns the ID of the given pod.
+func PodUUID(pod *kcorev1.Pod) types.UUID {
+	return EnsureUUID(pod.UID)
+}
+
+// ContainerUUID returns the ID of the container with the given name of the pod with the given ID.
+// Init containers are identified the same way as regular containers.
+func ContainerUUID(podUuid types.UUID, container string) types.UUID {
+	return NewUUID(podUuid, container)
+}
+
+// LookupPod returns the pod with the given namespace and name from store and whether it exists.
+func LookupPod(store kcache.Store, namespace, name string) (*kcorev1.Pod, bool) {
+	obj, exists, err := store.GetByKey(kcache.NewObjectName(namespace, name).String())
+	if err != nil || !exists {
+		return nil, false
+	}
+
+	pod, ok := obj.(*kcorev1.Pod)
+
+	return pod, ok
+}
+
+// PodUUIDByName returns the ID of the pod with the given namespace and name from store and whether it exists.
+func PodUUIDByName(store kcache.Store, namespace, name string) (types.UUID, bool) {
+	pod, ok := LookupPod(store, namespace, name)
+	if !ok {
+		return types.UUID{}, false
+	}
+
+	return PodUUID(pod), true
+}
+
+// ServiceUUIDByName returns the ID of the service with the given namespace and name from store and whether it exists.
+func ServiceUUIDByName(store kcache.Store, namespace, name string) (types.UUID, bool) {
+	obj, exists, err := store.GetByKey(kcache.NewObjectName(namespace, name).String())
+	if err != nil || !exists {
+		return types.UUID{}, false
+	}
+
+	service, ok := obj.(*kcorev1.Service)
+	if !ok {
+		return types.UUID{}, false
+	}
+
+	return EnsureUUID(service.UID), true
+}
+
+// MetricTimestamp returns t in milliseconds since the epoch, truncated to the minute,
+// so that samples of the same minute replace each other.
+func MetricTimestamp(t time.Time) int64 {
+	return t.Truncate(time.Minute).UnixMilli()
+}
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Failures of image pulls, classified by their error.
+const (
+	ImagePullUnauthorized = "unauthorized"
+	ImagePullNotFound     = "not_found"
+	ImagePullRateLimited  = "rate_limited"
+	ImagePullTimeout      = "timeout"
+	ImagePullNetwork      = "network"
+	ImagePullOther        = "other"
+)
+
+// ImagePull is the successful or failed pull of an image for a pod.
+// Registry is the host of the registry the image is pulled from, e.g. docker.io for images without host.
+// Duration is the time in milliseconds the successful pull took, excluding the time it waited for other pulls,
+// and Size the size of the pulled image in bytes, both NULL if not reported by the kubelet.
+// Attempts is the number of failed attempts, as reported by the kubelet.
+type ImagePull struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	PodUuid     types.UUID
+	Namespace   string
+	PodName     string
+	Image       string
+	Registry    string
+	Succeeded   types.Bool
+	Duration    sql.NullInt64
+	Size        sql.NullInt64
+	Attempts    int32
+	Failure     sql.NullString
+	Error       sql.NullString
+	FirstSeen   types.UnixMilli
+	LastSeen    types.UnixMilli
+}
+
+// Kinds of image pull secret issues.
+const (
+	// ImagePullSecretIssueNoSecret is a workload that pulls an image from a private registry
+	// without an image pull secret for it.
+	ImagePullSecretIssueNoSecret = "no_secret"
+	// ImagePullSecretIssueMissing is a workload that references an image pull secret that doesn't exist.
+	ImagePullSecretIssueMissing = "missing"
+	// ImagePullSecretIssueUnused is an image pull secret referenced by neither a pod nor a service account.
+	ImagePullSecretIssueUnused = "unused"
+)
+
+// ImagePullSecretUsage is the reference of an image pull secret by the pods of a workload,
+// including the secrets of their service account, which are added to pods on creation.
+// Pods without workload are their own workload.
+type ImagePullSecretUsage struct {
+	ClusterUuid  types.UUID
+	Namespace    string
+	SecretName   string
+	WorkloadKind string
+	WorkloadName string
+	Pods         int32
+	Computed     types.UnixMilli
+}
+
+// ImagePullSecretIssue is a finding of the audit of image pull secrets.
+// Workloads are empty for unused secrets, and registries and images are only set for workloads without secret.
+type ImagePullSecretIssue struct {
+	Uuid         types.UUID
+	ClusterUuid  types.UUID
+	Kind         string
+	Namespace    string
+	WorkloadKind sql.NullString
+	WorkloadName sql.NullString
+	SecretName   sql.NullString
+	Registry     sql.NullString
+	Image        sql.NullString
+	Computed     types.UnixMilli
+}
@@ -53,12 +53,32 @@ type IngressRule struct {
 	PathType    string
 }
 
+// IngressConflict is a rule of an ingress whose host and path are also claimed by rules of other ingresses
+// of the same ingress class with different backends, so that which backend receives the traffic depends
+// on the ingress controller. Backend is the backend of the rule, e.g. default/nginx:80 for services,
+// and ConflictingIngresses lists the other ingresses with their backends.
+type IngressConflict struct {
+	Uuid                 types.UUID
+	ClusterUuid          types.UUID
+	IngressUuid          types.UUID
+	IngressRuleUuid      types.UUID
+	Namespace            string
+	Name                 string
+	IngressClass         sql.NullString
+	Host                 string
+	Path                 string
+	PathType             string
+	Backend              string
+	ConflictingIngresses string
+	Computed             types.UnixMilli
+}
+
 func NewIngress() Resource {
 	return &Ingress{}
 }
 
-func (i *Ingress) Obtain(k8s kmetav1.Object) {
-	i.ObtainMeta(k8s)
+func (i *Ingress) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	i.ObtainMeta(k8s, clusterUuid)
 
 	ingress := k8s.(*networkingv1.Ingress)
 
@@ -7,6 +7,7 @@ import (
 
 type Instance struct {
 	Uuid                   types.Binary
+	ClusterUuid            types.UUID
 	Version                string
 	KubernetesVersion      sql.NullString
 	KubernetesHeartbeat    types.UnixMilli
@@ -18,3 +19,31 @@ type Instance struct {
 func (Instance) TableName() string {
 	return "kubernetes_instance"
 }
+
+// InstanceController is the synchronization status of a single controller of an Instance.
+type InstanceController struct {
+	InstanceUuid types.Binary
+	Name         string
+	LastSync     types.UnixMilli
+	LastEvent    types.UnixMilli
+	QueueDepth   int
+	Errors       uint64
+}
+
+func (InstanceController) TableName() string {
+	return "kubernetes_instance_controller"
+}
+
+// InstanceMetric is the freshness of a Prometheus metric category of a kind of metrics, e.g. nodes,
+// synchronized by an Instance.
+type InstanceMetric struct {
+	InstanceUuid types.Binary
+	Kind         string
+	Category     string
+	LastQuery    types.UnixMilli
+	Backlog      int
+}
+
+func (InstanceMetric) TableName() string {
+	return "kubernetes_instance_metric"
+}
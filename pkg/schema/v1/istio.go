@@ -0,0 +1,219 @@
+package v1
+
+import (
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IstioVirtualService is an Istio virtual service, which routes requests for its hosts to destinations.
+type IstioVirtualService struct {
+	Meta
+	Hosts        string
+	Gateways     string
+	HttpRoutes   int32
+	TcpRoutes    int32
+	TlsRoutes    int32
+	Yaml         string
+	Destinations []IstioVirtualServiceDestination `db:"-"`
+}
+
+// IstioVirtualServiceDestination is a destination of any route of a virtual service.
+// Weight is the highest weight of the destination across all routes.
+type IstioVirtualServiceDestination struct {
+	IstioVirtualServiceUuid types.UUID
+	Host                    string
+	Subset                  string
+	Port                    uint32
+	Weight                  int32
+}
+
+// IstioGateway is an Istio gateway, which configures the load balancers selected by Selector.
+type IstioGateway struct {
+	Meta
+	Selector string
+	Yaml     string
+	Servers  []IstioGatewayServer `db:"-"`
+}
+
+// IstioGatewayServer is a server of a gateway, i.e. a port and the hosts exposed through it.
+type IstioGatewayServer struct {
+	Uuid             types.UUID
+	IstioGatewayUuid types.UUID
+	PortNumber       uint32
+	PortName         string
+	Protocol         string
+	Hosts            string
+	TlsMode          string
+}
+
+// istioDestination is the destination of a route of a virtual service.
+type istioDestination struct {
+	Destination struct {
+		Host   string `json:"host"`
+		Subset string `json:"subset"`
+		Port   struct {
+			Number uint32 `json:"number"`
+		} `json:"port"`
+	} `json:"destination"`
+	Weight int32 `json:"weight"`
+}
+
+// istioRoutes contains the destinations of the routes of one protocol of a virtual service.
+type istioRoutes []struct {
+	Route []istioDestination `json:"route"`
+}
+
+// istioVirtualService and istioGateway contain the fields of networking.istio.io virtual services and gateways
+// that are synchronized, as the Istio API types are not a dependency.
+type istioVirtualService struct {
+	Spec struct {
+		Hosts    []string    `json:"hosts"`
+		Gateways []string    `json:"gateways"`
+		Http     istioRoutes `json:"http"`
+		Tcp      istioRoutes `json:"tcp"`
+		Tls      istioRoutes `json:"tls"`
+	} `json:"spec"`
+}
+
+type istioGateway struct {
+	Spec struct {
+		Selector map[string]string `json:"selector"`
+		Servers  []struct {
+			Port struct {
+				Number   uint32 `json:"number"`
+				Name     string `json:"name"`
+				Protocol string `json:"protocol"`
+			} `json:"port"`
+			Hosts []string `json:"hosts"`
+			Tls   *struct {
+				Mode string `json:"mode"`
+			} `json:"tls"`
+		} `json:"servers"`
+	} `json:"spec"`
+}
+
+func NewIstioVirtualService() Resource {
+	return &IstioVirtualService{}
+}
+
+func (v *IstioVirtualService) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	v.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var vs istioVirtualService
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &vs); err != nil {
+		return
+	}
+
+	v.Hosts = strings.Join(vs.Spec.Hosts, ", ")
+	v.Gateways = strings.Join(vs.Spec.Gateways, ", ")
+	v.HttpRoutes = int32(len(vs.Spec.Http))
+	v.TcpRoutes = int32(len(vs.Spec.Tcp))
+	v.TlsRoutes = int32(len(vs.Spec.Tls))
+
+	for _, routes := range []istioRoutes{vs.Spec.Http, vs.Spec.Tcp, vs.Spec.Tls} {
+		for _, r := range routes {
+			for _, d := range r.Route {
+				// A single destination without weight receives all requests of its route.
+				weight := d.Weight
+				if weight == 0 && len(r.Route) == 1 {
+					weight = 100
+				}
+
+				destination := IstioVirtualServiceDestination{
+					IstioVirtualServiceUuid: v.Uuid,
+					Host:                    d.Destination.Host,
+					Subset:                  d.Destination.Subset,
+					Port:                    d.Destination.Port.Number,
+					Weight:                  weight,
+				}
+
+				i := slices.IndexFunc(v.Destinations, func(other IstioVirtualServiceDestination) bool {
+					return other.Host == destination.Host && other.Subset == destination.Subset &&
+						other.Port == destination.Port
+				})
+				if i < 0 {
+					v.Destinations = append(v.Destinations, destination)
+				} else if weight > v.Destinations[i].Weight {
+					v.Destinations[i].Weight = weight
+				}
+			}
+		}
+	}
+
+	output, _ := yaml.Marshal(u.Object)
+	v.Yaml = string(output)
+}
+
+func (v *IstioVirtualService) Relations() []database.Relation {
+	fk := database.WithForeignKey("istio_virtual_service_uuid")
+
+	return []database.Relation{
+		database.HasMany(v.Destinations, fk),
+	}
+}
+
+func NewIstioGateway() Resource {
+	return &IstioGateway{}
+}
+
+func (g *IstioGateway) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	g.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var gw istioGateway
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &gw); err != nil {
+		return
+	}
+
+	selector := make([]string, 0, len(gw.Spec.Selector))
+	for k, v := range gw.Spec.Selector {
+		selector = append(selector, k+"="+v)
+	}
+	slices.Sort(selector)
+	g.Selector = strings.Join(selector, ", ")
+
+	for _, s := range gw.Spec.Servers {
+		hosts := strings.Join(s.Hosts, ", ")
+		server := IstioGatewayServer{
+			// Servers may share ports, e.g. 443 for different hosts.
+			Uuid:             NewUUID(g.Uuid, strconv.FormatUint(uint64(s.Port.Number), 10)+"/"+hosts),
+			IstioGatewayUuid: g.Uuid,
+			PortNumber:       s.Port.Number,
+			PortName:         s.Port.Name,
+			Protocol:         s.Port.Protocol,
+			Hosts:            hosts,
+		}
+		if s.Tls != nil {
+			server.TlsMode = s.Tls.Mode
+		}
+
+		g.Servers = append(g.Servers, server)
+	}
+
+	output, _ := yaml.Marshal(u.Object)
+	g.Yaml = string(output)
+}
+
+func (g *IstioGateway) Relations() []database.Relation {
+	fk := database.WithForeignKey("istio_gateway_uuid")
+
+	return []database.Relation{
+		database.HasMany(g.Servers, fk),
+	}
+}
@@ -18,6 +18,7 @@ import (
 
 type Job struct {
 	Meta
+	LastChange
 	Parallelism             sql.NullInt32
 	Completions             sql.NullInt32
 	ActiveDeadlineSeconds   sql.NullInt64
@@ -75,8 +76,9 @@ func NewJob() Resource {
 	return &Job{}
 }
 
-func (j *Job) Obtain(k8s kmetav1.Object) {
-	j.ObtainMeta(k8s)
+func (j *Job) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	j.ObtainMeta(k8s, clusterUuid)
+	j.ObtainLastChange(k8s)
 
 	job := k8s.(*kbatchv1.Job)
 
@@ -137,6 +139,7 @@ func (j *Job) Obtain(k8s kmetav1.Object) {
 	j.Succeeded = job.Status.Succeeded
 	j.Failed = job.Status.Failed
 	j.IcingaState, j.IcingaStateReason = j.getIcingaState(job)
+	j.IcingaState, j.IcingaStateReason = ignore(k8s, j.IcingaState, j.IcingaStateReason)
 
 	for _, condition := range job.Status.Conditions {
 		j.Conditions = append(j.Conditions, JobCondition{
@@ -208,6 +211,11 @@ func (j *Job) Obtain(k8s kmetav1.Object) {
 	j.Yaml = string(output)
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (j *Job) State() (IcingaState, string) {
+	return j.IcingaState, j.IcingaStateReason
+}
+
 func (j *Job) getIcingaState(job *kbatchv1.Job) (IcingaState, string) {
 	for _, condition := range job.Status.Conditions {
 		if condition.Status != kcorev1.ConditionTrue {
@@ -0,0 +1,27 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// JobFailure is a failed pod of a job with the final logs of its failed containers
+// and the events of the pod and its job, captured when the pod failed.
+// ContainerName and ExitCode are those of the first failed container, if any,
+// as pods may also fail without a failed container, e.g. if they are evicted.
+type JobFailure struct {
+	Uuid          types.UUID
+	ClusterUuid   types.UUID
+	JobUuid       types.UUID
+	PodUuid       types.UUID
+	Namespace     string
+	JobName       string
+	PodName       string
+	ContainerName sql.NullString
+	ExitCode      sql.NullInt32
+	Reason        string
+	Message       sql.NullString
+	Logs          sql.NullString
+	Events        sql.NullString
+	Failed        types.UnixMilli
+}
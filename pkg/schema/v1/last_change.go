@@ -0,0 +1,47 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// controllerManager is the field manager of the built-in controllers,
+// which e.g. update the revision annotation of deployments after they have been changed.
+const controllerManager = "kube-controller-manager"
+
+// LastChange is the last change of a workload by a client, e.g. kubectl, Helm or a GitOps controller,
+// derived from the managed fields of the workload. It is attributed to the field manager of the change,
+// which defaults to the name of the client, and not to a user, as Kubernetes doesn't record the user that made it.
+type LastChange struct {
+	LastChangeManager sql.NullString
+	LastChanged       types.UnixMilli
+}
+
+// ObtainLastChange obtains the last change from the managed fields of the given object.
+func (c *LastChange) ObtainLastChange(k8s kmetav1.Object) {
+	if entry := lastChange(k8s.GetManagedFields()); entry != nil {
+		c.LastChangeManager = NewNullableString(entry.Manager)
+		if entry.Time != nil {
+			c.LastChanged = types.UnixMilli(entry.Time.Time)
+		}
+	}
+}
+
+// lastChange returns the managed fields entry that was updated last by a client,
+// ignoring status updates and updates by the built-in controllers, or nil if there is none.
+func lastChange(entries []kmetav1.ManagedFieldsEntry) *kmetav1.ManagedFieldsEntry {
+	var last *kmetav1.ManagedFieldsEntry
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Subresource == "status" || entry.Manager == controllerManager {
+			continue
+		}
+
+		if last == nil || (entry.Time != nil && (last.Time == nil || entry.Time.After(last.Time.Time))) {
+			last = entry
+		}
+	}
+
+	return last
+}
@@ -6,9 +6,12 @@ import (
 	"strconv"
 )
 
+// PrometheusClusterMetric and the other Prometheus metrics cover the timestamps from Timestamp to Until,
+// which only differ if consecutive samples with the same value have been compacted into a single row.
 type PrometheusClusterMetric struct {
 	ClusterUuid types.UUID
 	Timestamp   int64
+	Until       int64
 	Category    string
 	Name        string
 	Value       float64
@@ -29,6 +32,7 @@ func (m *PrometheusClusterMetric) Fingerprint() database.Fingerprinter {
 type PrometheusNodeMetric struct {
 	NodeUuid  types.UUID
 	Timestamp int64
+	Until     int64
 	Category  string
 	Name      string
 	Value     float64
@@ -49,6 +53,7 @@ func (m *PrometheusNodeMetric) Fingerprint() database.Fingerprinter {
 type PrometheusPodMetric struct {
 	PodUuid   types.UUID
 	Timestamp int64
+	Until     int64
 	Category  string
 	Name      string
 	Value     float64
@@ -69,6 +74,7 @@ func (m *PrometheusPodMetric) Fingerprint() database.Fingerprinter {
 type PrometheusContainerMetric struct {
 	ContainerUuid types.UUID
 	Timestamp     int64
+	Until         int64
 	Category      string
 	Name          string
 	Value         float64
@@ -86,6 +92,27 @@ func (m *PrometheusContainerMetric) Fingerprint() database.Fingerprinter {
 	return m
 }
 
+type PrometheusServiceMetric struct {
+	ServiceUuid types.UUID
+	Timestamp   int64
+	Until       int64
+	Category    string
+	Name        string
+	Value       float64
+}
+
+func (m *PrometheusServiceMetric) ID() database.ID {
+	return compoundId{id: m.ServiceUuid.String() + strconv.FormatInt(m.Timestamp, 10) + m.Category + m.Name}
+}
+
+func (m *PrometheusServiceMetric) SetID(id database.ID) {
+	panic("Not expected to be called")
+}
+
+func (m *PrometheusServiceMetric) Fingerprint() database.Fingerprinter {
+	return m
+}
+
 type compoundId struct {
 	id string
 }
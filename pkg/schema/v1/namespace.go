@@ -13,6 +13,7 @@ import (
 
 type Namespace struct {
 	Meta
+	PodSecurityLevels
 	Phase                string
 	Yaml                 string
 	Conditions           []NamespaceCondition  `db:"-"`
@@ -45,12 +46,13 @@ func NewNamespace() Resource {
 	return &Namespace{}
 }
 
-func (n *Namespace) Obtain(k8s kmetav1.Object) {
-	n.ObtainMeta(k8s)
+func (n *Namespace) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	n.ObtainMeta(k8s, clusterUuid)
 
 	namespace := k8s.(*kcorev1.Namespace)
 
 	n.Phase = string(namespace.Status.Phase)
+	n.ObtainPodSecurityLevels(namespace.Labels)
 
 	for _, condition := range namespace.Status.Conditions {
 		n.Conditions = append(n.Conditions, NamespaceCondition{
@@ -107,3 +109,18 @@ func (n *Namespace) Relations() []database.Relation {
 		database.HasMany(n.Annotations, database.WithoutCascadeDelete()),
 	}
 }
+
+// NamespaceHealth is the health of a namespace regarding the resources of one type,
+// i.e. their worst Icinga state and the number of resources per state.
+type NamespaceHealth struct {
+	ClusterUuid  types.UUID
+	Namespace    string
+	ResourceType string
+	IcingaState  IcingaState
+	Ok           int
+	Pending      int
+	Unknown      int
+	Warning      int
+	Critical     int
+	Updated      types.UnixMilli
+}
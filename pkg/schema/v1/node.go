@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/icinga/icinga-go-library/types"
 	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/downtime"
 	"github.com/pkg/errors"
 	kcorev1 "k8s.io/api/core/v1"
 	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -12,14 +13,22 @@ import (
 	kjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
 	knet "k8s.io/utils/net"
 	"net"
+	"slices"
 	"strings"
+	"time"
 )
 
+type NodeFactory struct {
+	thresholds  Thresholds
+	memoryUsage func(uuid types.UUID) (float64, bool)
+}
+
 type Node struct {
 	Meta
 	PodCIDR                 string
 	NumIps                  int64
 	Unschedulable           types.Bool
+	Draining                types.Bool
 	Ready                   types.Bool
 	CpuCapacity             int64
 	CpuAllocatable          int64
@@ -46,6 +55,7 @@ type Node struct {
 	NodeLabels              []NodeLabel      `db:"-"`
 	Annotations             []Annotation     `db:"-"`
 	NodeAnnotations         []NodeAnnotation `db:"-"`
+	factory                 *NodeFactory
 }
 
 type NodeCondition struct {
@@ -79,8 +89,21 @@ func NewNode() Resource {
 	return &Node{}
 }
 
-func (n *Node) Obtain(k8s kmetav1.Object) {
-	n.ObtainMeta(k8s)
+// NewNodeFactory creates nodes whose states are additionally evaluated using thresholds and
+// the latest memory usage ratio returned by memoryUsage, which may be nil if metrics aren't synchronized.
+func NewNodeFactory(thresholds Thresholds, memoryUsage func(uuid types.UUID) (float64, bool)) *NodeFactory {
+	return &NodeFactory{
+		thresholds:  thresholds,
+		memoryUsage: memoryUsage,
+	}
+}
+
+func (f *NodeFactory) New() Resource {
+	return &Node{factory: f}
+}
+
+func (n *Node) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	n.ObtainMeta(k8s, clusterUuid)
 
 	node := k8s.(*kcorev1.Node)
 
@@ -96,6 +119,10 @@ func (n *Node) Obtain(k8s kmetav1.Object) {
 		Bool:  node.Spec.Unschedulable,
 		Valid: true,
 	}
+	n.Draining = types.Bool{
+		Bool:  isDraining(node, time.Now()),
+		Valid: true,
+	}
 	n.Ready = types.Bool{
 		Bool:  getNodeConditionStatus(node, kcorev1.NodeReady),
 		Valid: true,
@@ -126,6 +153,7 @@ func (n *Node) Obtain(k8s kmetav1.Object) {
 	n.Roles = strings.Join(roles, ", ")
 
 	n.IcingaState, n.IcingaStateReason = n.getIcingaState(node)
+	n.IcingaState, n.IcingaStateReason = ignore(k8s, n.IcingaState, n.IcingaStateReason)
 
 	for _, condition := range node.Status.Conditions {
 		n.Conditions = append(n.Conditions, NodeCondition{
@@ -190,6 +218,11 @@ func (n *Node) Obtain(k8s kmetav1.Object) {
 	}
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (n *Node) State() (IcingaState, string) {
+	return n.IcingaState, n.IcingaStateReason
+}
+
 func (n *Node) getIcingaState(node *kcorev1.Node) (IcingaState, string) {
 	//if node.Status.Phase == kcorev1.NodePending {
 	//	return Pending, fmt.Sprintf("Node %s is pending.", node.Name)
@@ -221,6 +254,17 @@ func (n *Node) getIcingaState(node *kcorev1.Node) (IcingaState, string) {
 		}
 	}
 
+	if n.factory != nil && n.factory.memoryUsage != nil {
+		threshold := n.factory.thresholds.WithAnnotations(node.Annotations).NodeMemoryUsage
+		if usage, ok := n.factory.memoryUsage(n.Uuid); ok && threshold.Enabled() {
+			usage *= 100
+			if s := threshold.State(usage); s != Ok {
+				state = max(state, s)
+				reason = append(reason, fmt.Sprintf("Node %s uses %.1f%% of its memory", node.Name, usage))
+			}
+		}
+	}
+
 	if state != Ok {
 		return state, strings.Join(reason, ". ") + "."
 	}
@@ -241,6 +285,25 @@ func (n *Node) Relations() []database.Relation {
 	}
 }
 
+// drainTaints are set by node autoscalers on nodes that they drain in order to remove them.
+var drainTaints = []string{"ToBeDeletedByClusterAutoscaler", "karpenter.sh/disrupted", "karpenter.sh/disruption"}
+
+// isDraining returns whether the given node is being drained at t, i.e. either cordoned
+// within a drain window flagged by an operator, or tainted by a node autoscaler that removes it.
+func isDraining(node *kcorev1.Node, t time.Time) bool {
+	if node.Spec.Unschedulable && downtime.Draining(node.Annotations, t) {
+		return true
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if slices.Contains(drainTaints, taint.Key) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func getNodeConditionStatus(node *kcorev1.Node, conditionType kcorev1.NodeConditionType) bool {
 	for _, condition := range node.Status.Conditions {
 		if condition.Type == conditionType {
@@ -0,0 +1,252 @@
+package v1
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// olmCopiedFrom is the label with which OLM marks the copies of cluster service versions
+// in the namespaces targeted by the operator group of an operator.
+const olmCopiedFrom = "olm.copiedFrom"
+
+// Phases of OLM cluster service versions.
+const (
+	olmSucceeded = "Succeeded"
+	olmFailed    = "Failed"
+	olmDeleting  = "Deleting"
+	olmUnknown   = "Unknown"
+)
+
+// olmSubscriptionFailures are the conditions of subscriptions that prevent their operator from being installed
+// or upgraded, and olmSubscriptionWarnings those that may do so.
+var (
+	olmSubscriptionFailures = []string{"ResolutionFailed", "InstallPlanFailed", "BundleUnpackFailed"}
+	olmSubscriptionWarnings = []string{"CatalogSourcesUnhealthy", "InstallPlanMissing"}
+)
+
+// OlmSubscription is a subscription of the Operator Lifecycle Manager,
+// which installs and upgrades an operator from a channel of a catalog.
+type OlmSubscription struct {
+	Meta
+	Package             string
+	Channel             sql.NullString
+	Source              string
+	SourceNamespace     string
+	InstallPlanApproval sql.NullString
+	Status              sql.NullString
+	CurrentCsv          sql.NullString
+	InstalledCsv        sql.NullString
+	InstallPlan         sql.NullString
+	Yaml                string
+	IcingaState         IcingaState
+	IcingaStateReason   string
+}
+
+// OlmClusterServiceVersion is a cluster service version of the Operator Lifecycle Manager,
+// i.e. a version of an operator that is installed or being installed.
+// CopiedFrom is the namespace of the original of a copied cluster service version.
+type OlmClusterServiceVersion struct {
+	Meta
+	DisplayName       sql.NullString
+	Version           sql.NullString
+	Replaces          sql.NullString
+	Phase             sql.NullString
+	Reason            sql.NullString
+	Message           sql.NullString
+	CopiedFrom        sql.NullString
+	Yaml              string
+	IcingaState       IcingaState
+	IcingaStateReason string
+}
+
+// olmSubscription and olmClusterServiceVersion contain the fields of operators.coreos.com/v1alpha1
+// subscriptions and cluster service versions that are synchronized, as the OLM API types are not a dependency.
+type olmSubscription struct {
+	Spec struct {
+		Package             string `json:"name"`
+		Channel             string `json:"channel"`
+		Source              string `json:"source"`
+		SourceNamespace     string `json:"sourceNamespace"`
+		InstallPlanApproval string `json:"installPlanApproval"`
+	} `json:"spec"`
+	Status struct {
+		State          string `json:"state"`
+		CurrentCsv     string `json:"currentCSV"`
+		InstalledCsv   string `json:"installedCSV"`
+		InstallPlanRef *struct {
+			Name string `json:"name"`
+		} `json:"installPlanRef"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+type olmClusterServiceVersion struct {
+	Spec struct {
+		DisplayName string `json:"displayName"`
+		Version     string `json:"version"`
+		Replaces    string `json:"replaces"`
+	} `json:"spec"`
+	Status struct {
+		Phase   string `json:"phase"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+func NewOlmSubscription() Resource {
+	return &OlmSubscription{}
+}
+
+func (s *OlmSubscription) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	s.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var sub olmSubscription
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &sub); err != nil {
+		return
+	}
+
+	s.Package = sub.Spec.Package
+	s.Channel = NewNullableString(sub.Spec.Channel)
+	s.Source = sub.Spec.Source
+	s.SourceNamespace = sub.Spec.SourceNamespace
+	s.InstallPlanApproval = NewNullableString(sub.Spec.InstallPlanApproval)
+	s.Status = NewNullableString(sub.Status.State)
+	s.CurrentCsv = NewNullableString(sub.Status.CurrentCsv)
+	s.InstalledCsv = NewNullableString(sub.Status.InstalledCsv)
+	if sub.Status.InstallPlanRef != nil {
+		s.InstallPlan = NewNullableString(sub.Status.InstallPlanRef.Name)
+	}
+
+	s.IcingaState, s.IcingaStateReason = s.getIcingaState(sub)
+	s.IcingaState, s.IcingaStateReason = ignore(k8s, s.IcingaState, s.IcingaStateReason)
+
+	output, _ := yaml.Marshal(u.Object)
+	s.Yaml = string(output)
+}
+
+func (s *OlmSubscription) State() (IcingaState, string) {
+	return s.IcingaState, s.IcingaStateReason
+}
+
+func (s *OlmSubscription) getIcingaState(sub olmSubscription) (IcingaState, string) {
+	var warning string
+	for _, c := range sub.Status.Conditions {
+		if c.Status != string(kmetav1.ConditionTrue) {
+			continue
+		}
+
+		for _, failure := range olmSubscriptionFailures {
+			if c.Type == failure {
+				return Critical, fmt.Sprintf(
+					"Subscription %s/%s can't install %s: %s: %s",
+					s.Namespace, s.Name, s.CurrentCsv.String, c.Reason, strings.TrimSuffix(c.Message, ".")+".")
+			}
+		}
+
+		for _, w := range olmSubscriptionWarnings {
+			if c.Type == w && warning == "" {
+				warning = fmt.Sprintf(
+					"Subscription %s/%s: %s: %s", s.Namespace, s.Name, c.Type, strings.TrimSuffix(c.Message, ".")+".")
+			}
+		}
+	}
+
+	if warning != "" {
+		return Warning, warning
+	}
+
+	switch {
+	case !s.InstalledCsv.Valid:
+		return Pending, fmt.Sprintf("Subscription %s/%s has not installed %s yet.", s.Namespace, s.Name, s.Package)
+	case s.CurrentCsv.Valid && s.CurrentCsv.String != s.InstalledCsv.String:
+		if s.InstallPlanApproval.String == "Manual" {
+			return Ok, fmt.Sprintf(
+				"Subscription %s/%s waits for the approval of the upgrade from %s to %s.",
+				s.Namespace, s.Name, s.InstalledCsv.String, s.CurrentCsv.String)
+		}
+
+		return Pending, fmt.Sprintf(
+			"Subscription %s/%s is upgrading from %s to %s.",
+			s.Namespace, s.Name, s.InstalledCsv.String, s.CurrentCsv.String)
+	default:
+		return Ok, fmt.Sprintf("Subscription %s/%s has installed %s.", s.Namespace, s.Name, s.InstalledCsv.String)
+	}
+}
+
+func NewOlmClusterServiceVersion() Resource {
+	return &OlmClusterServiceVersion{}
+}
+
+func (c *OlmClusterServiceVersion) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	c.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var csv olmClusterServiceVersion
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &csv); err != nil {
+		return
+	}
+
+	c.DisplayName = NewNullableString(csv.Spec.DisplayName)
+	c.Version = NewNullableString(csv.Spec.Version)
+	c.Replaces = NewNullableString(csv.Spec.Replaces)
+	c.Phase = NewNullableString(csv.Status.Phase)
+	c.Reason = NewNullableString(csv.Status.Reason)
+	c.Message = NewNullableString(csv.Status.Message)
+	c.CopiedFrom = NewNullableString(u.GetLabels()[olmCopiedFrom])
+
+	switch {
+	case c.CopiedFrom.Valid:
+		// Copies mirror the state of their original, which is evaluated instead.
+		c.IcingaState = Ok
+		c.IcingaStateReason = fmt.Sprintf(
+			"Cluster service version %s/%s is a copy of the one in namespace %s.",
+			c.Namespace, c.Name, c.CopiedFrom.String)
+	case csv.Status.Phase == olmSucceeded:
+		c.IcingaState = Ok
+		c.IcingaStateReason = fmt.Sprintf("Cluster service version %s/%s is installed.", c.Namespace, c.Name)
+	case csv.Status.Phase == olmFailed:
+		c.IcingaState = Critical
+		c.IcingaStateReason = fmt.Sprintf(
+			"Cluster service version %s/%s failed: %s: %s",
+			c.Namespace, c.Name, csv.Status.Reason, strings.TrimSuffix(csv.Status.Message, ".")+".")
+	case csv.Status.Phase == olmDeleting:
+		c.IcingaState = Ok
+		c.IcingaStateReason = fmt.Sprintf("Cluster service version %s/%s is being deleted.", c.Namespace, c.Name)
+	case csv.Status.Phase == olmUnknown:
+		c.IcingaState = Unknown
+		c.IcingaStateReason = fmt.Sprintf(
+			"Cluster service version %s/%s is in an unknown phase: %s.", c.Namespace, c.Name, csv.Status.Reason)
+	default:
+		c.IcingaState = Pending
+		c.IcingaStateReason = fmt.Sprintf(
+			"Cluster service version %s/%s is being installed: %s.", c.Namespace, c.Name, csv.Status.Phase)
+	}
+	c.IcingaState, c.IcingaStateReason = ignore(k8s, c.IcingaState, c.IcingaStateReason)
+
+	output, _ := yaml.Marshal(u.Object)
+	c.Yaml = string(output)
+}
+
+func (c *OlmClusterServiceVersion) State() (IcingaState, string) {
+	return c.IcingaState, c.IcingaStateReason
+}
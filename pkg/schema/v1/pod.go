@@ -14,14 +14,18 @@ import (
 	ktypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"strings"
+	"time"
 )
 
 type PodFactory struct {
-	clientset *kubernetes.Clientset
+	clientset  *kubernetes.Clientset
+	thresholds func(namespace string) Thresholds
+	restarts   func(id types.UUID, restartCount int32, lastTermination time.Time) (hour, day int32)
 }
 
 type Pod struct {
 	Meta
+	SecurityPosture
 	NodeName          sql.NullString
 	NominatedNodeName sql.NullString
 	Ip                sql.NullString
@@ -100,9 +104,18 @@ type PodPvc struct {
 	ReadOnly   types.Bool
 }
 
-func NewPodFactory(clientset *kubernetes.Clientset) *PodFactory {
+// NewPodFactory creates pods whose states are additionally evaluated using
+// the thresholds returned by thresholds for their namespace.
+// restarts, if set, returns the restarts of containers within the last hour and day.
+func NewPodFactory(
+	clientset *kubernetes.Clientset,
+	thresholds func(namespace string) Thresholds,
+	restarts func(id types.UUID, restartCount int32, lastTermination time.Time) (hour, day int32),
+) *PodFactory {
 	return &PodFactory{
-		clientset: clientset,
+		clientset:  clientset,
+		thresholds: thresholds,
+		restarts:   restarts,
 	}
 }
 
@@ -110,8 +123,8 @@ func (f *PodFactory) New() Resource {
 	return &Pod{factory: f}
 }
 
-func (p *Pod) Obtain(k8s kmetav1.Object) {
-	p.ObtainMeta(k8s)
+func (p *Pod) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	p.ObtainMeta(k8s, clusterUuid)
 
 	pod := k8s.(*kcorev1.Pod)
 
@@ -123,6 +136,7 @@ func (p *Pod) Obtain(k8s kmetav1.Object) {
 	p.Message = NewNullableString(pod.Status.Message)
 	p.RestartPolicy = string(pod.Spec.RestartPolicy)
 	p.Qos = NewNullableString(string(pod.Status.QOSClass))
+	p.ObtainSecurityPosture(pod)
 
 	for _, condition := range pod.Status.Conditions {
 		p.Conditions = append(p.Conditions, PodCondition{
@@ -137,8 +151,25 @@ func (p *Pod) Obtain(k8s kmetav1.Object) {
 	}
 
 	p.Containers = NewContainers[Container](p, pod.Spec.Containers, pod.Status.ContainerStatuses, NewContainer)
+	if p.factory != nil && p.factory.restarts != nil {
+		for _, c := range p.Containers {
+			var lastTermination time.Time
+			if c.LastTermination != nil {
+				lastTermination = c.LastTermination.FinishedAt.Time
+			}
+
+			hour, day := p.factory.restarts(c.Uuid, c.RestartCount, lastTermination)
+			c.RestartsLastHour = sql.NullInt32{Int32: hour, Valid: true}
+			c.RestartsLastDay = sql.NullInt32{Int32: day, Valid: true}
+		}
+	}
 
 	p.IcingaState, p.IcingaStateReason = p.getIcingaState(pod)
+	if p.factory != nil && p.factory.thresholds != nil {
+		p.IcingaState, p.IcingaStateReason = p.applyThresholds(
+			pod, p.factory.thresholds(pod.Namespace).WithAnnotations(pod.Annotations), p.IcingaState, p.IcingaStateReason)
+	}
+	p.IcingaState, p.IcingaStateReason = ignore(pod, p.IcingaState, p.IcingaStateReason)
 
 	for _, container := range pod.Spec.Containers {
 		if !container.Resources.Limits.Cpu().IsZero() {
@@ -271,6 +302,11 @@ func (p *Pod) Obtain(k8s kmetav1.Object) {
 	p.Yaml = string(output)
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (p *Pod) State() (IcingaState, string) {
+	return p.IcingaState, p.IcingaStateReason
+}
+
 func (p *Pod) getIcingaState(pod *kcorev1.Pod) (IcingaState, string) {
 	if pod.DeletionTimestamp != nil {
 		if pod.Status.Reason == "NodeLost" {
@@ -373,6 +409,53 @@ func (p *Pod) getIcingaState(pod *kcorev1.Pod) (IcingaState, string) {
 		strings.Join(reasons, "\n"))
 }
 
+// applyThresholds raises the given state if the pod exceeds any of the given thresholds.
+func (p *Pod) applyThresholds(pod *kcorev1.Pod, thresholds Thresholds, state IcingaState, reason string) (IcingaState, string) {
+	raise := func(s IcingaState, r string) {
+		if s > state {
+			state = s
+			reason = strings.TrimSpace(r + "\n" + reason)
+		}
+	}
+
+	switch pod.Status.Phase {
+	case kcorev1.PodPending:
+		if thresholds.PodPendingAge.Enabled() {
+			age := time.Since(pod.CreationTimestamp.Time).Truncate(time.Second)
+			raise(thresholds.PodPendingAge.State(age), fmt.Sprintf(
+				"Pod %s/%s has been pending for %s.", pod.Namespace, pod.Name, age))
+		}
+	case kcorev1.PodRunning:
+		if !thresholds.PodRestartsPerHour.Enabled() {
+			break
+		}
+
+		if p.factory != nil && p.factory.restarts != nil {
+			var restarts int32
+			for _, c := range p.Containers {
+				restarts += c.RestartsLastHour.Int32
+			}
+
+			raise(thresholds.PodRestartsPerHour.State(float64(restarts)), fmt.Sprintf(
+				"Pod %s/%s has restarted %d times within the last hour.", pod.Namespace, pod.Name, restarts))
+		} else if pod.Status.StartTime != nil {
+			var restarts int32
+			for _, status := range pod.Status.ContainerStatuses {
+				restarts += status.RestartCount
+			}
+
+			// Without restart history, restarts are averaged since the pod was started.
+			// Don't extrapolate restarts of pods that have been started less than an hour ago.
+			hours := max(time.Since(pod.Status.StartTime.Time).Hours(), 1)
+			perHour := float64(restarts) / hours
+			raise(thresholds.PodRestartsPerHour.State(perHour), fmt.Sprintf(
+				"Pod %s/%s has restarted %.1f times per hour.", pod.Namespace, pod.Name, perHour))
+		}
+	}
+
+	return state, reason
+}
+
 func NewContainers[T any](
 	p *Pod,
 	containers []kcorev1.Container,
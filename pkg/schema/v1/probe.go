@@ -0,0 +1,42 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Kinds of probed objects.
+const (
+	ProbeKindService = "service"
+	ProbeKindIngress = "ingress"
+	ProbeKindDns     = "dns"
+)
+
+// Protocols of probes.
+const (
+	ProbeProtocolTcp   = "tcp"
+	ProbeProtocolHttp  = "http"
+	ProbeProtocolHttps = "https"
+	ProbeProtocolDns   = "dns"
+)
+
+// Probe is the result of the last reachability check of a port of a service or a host of an ingress,
+// or of the last resolution of a name via the cluster DNS.
+type Probe struct {
+	Uuid        types.UUID
+	ClusterUuid types.UUID
+	Kind        string
+	// Namespace and Name are of the service or ingress, or the resolved name with an empty namespace.
+	Namespace string
+	Name      string
+	// Target is the probed address of a service, the URL of an ingress host or the address of the DNS server.
+	Target    string
+	Protocol  string
+	Reachable types.Bool
+	// StatusCode is the HTTP status code of the response, NULL for TCP probes and unreachable targets.
+	StatusCode sql.NullInt32
+	// ResponseTime in milliseconds, NULL for unreachable targets.
+	ResponseTime sql.NullInt64
+	Error        sql.NullString
+	Checked      types.UnixMilli
+}
@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Problem is raised for a container that is waiting for a problematic reason, e.g. CrashLoopBackOff,
+// or for a pod that can't be scheduled, and cleared once resolved. Logs and events are captured when raised.
+type Problem struct {
+	Uuid          types.UUID
+	ClusterUuid   types.UUID
+	PodUuid       types.UUID
+	ContainerUuid types.Binary
+	Namespace     string
+	PodName       string
+	ContainerName sql.NullString
+	Reason        string
+	Message       sql.NullString
+	// BlockingConstraint is the type of constraint that prevents an unschedulable pod from being scheduled
+	// to most nodes, e.g. insufficient_resources, and BlockingConstraintDetail the resource, taint or rule.
+	BlockingConstraint       sql.NullString
+	BlockingConstraintDetail sql.NullString
+	Logs                     sql.NullString
+	Events                   sql.NullString
+	InDowntime               types.Bool
+	Started                  types.UnixMilli
+	Cleared                  types.UnixMilli
+}
+
+func (p *Problem) GetUuid() types.UUID {
+	return p.Uuid
+}
+
+func (p *Problem) GetReason() string {
+	return p.Reason
+}
+
+func (p *Problem) SetCleared(cleared types.UnixMilli) {
+	p.Cleared = cleared
+}
+
+// ProblemComment is an acknowledgement or comment of a problem, e.g. from Icinga for Kubernetes Web.
+type ProblemComment struct {
+	Uuid            types.UUID
+	ProblemUuid     types.UUID
+	Author          string
+	Comment         string
+	Acknowledgement types.Bool
+	Created         types.UnixMilli
+	// Annotated is when the comment has been annotated onto the pod of the problem, if enabled.
+	Annotated types.UnixMilli
+}
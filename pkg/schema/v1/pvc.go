@@ -2,6 +2,7 @@ package v1
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/icinga/icinga-go-library/strcase"
 	"github.com/icinga/icinga-go-library/types"
 	"github.com/icinga/icinga-kubernetes/pkg/database"
@@ -44,6 +45,8 @@ type Pvc struct {
 	VolumeName         sql.NullString
 	VolumeMode         string
 	StorageClass       sql.NullString
+	IcingaState        IcingaState
+	IcingaStateReason  string
 	Yaml               string
 	Conditions         []PvcCondition  `db:"-"`
 	Labels             []Label         `db:"-"`
@@ -76,8 +79,8 @@ func NewPvc() Resource {
 	return &Pvc{}
 }
 
-func (p *Pvc) Obtain(k8s kmetav1.Object) {
-	p.ObtainMeta(k8s)
+func (p *Pvc) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	p.ObtainMeta(k8s, clusterUuid)
 
 	pvc := k8s.(*kcorev1.PersistentVolumeClaim)
 
@@ -105,6 +108,8 @@ func (p *Pvc) Obtain(k8s kmetav1.Object) {
 	}
 	p.VolumeMode = volumeMode
 	p.StorageClass = NewNullableString(pvc.Spec.StorageClassName)
+	p.IcingaState, p.IcingaStateReason = p.getIcingaState(pvc)
+	p.IcingaState, p.IcingaStateReason = ignore(k8s, p.IcingaState, p.IcingaStateReason)
 
 	for _, condition := range pvc.Status.Conditions {
 		p.Conditions = append(p.Conditions, PvcCondition{
@@ -151,6 +156,48 @@ func (p *Pvc) Obtain(k8s kmetav1.Object) {
 	p.Yaml = string(output)
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (p *Pvc) State() (IcingaState, string) {
+	return p.IcingaState, p.IcingaStateReason
+}
+
+func (p *Pvc) getIcingaState(pvc *kcorev1.PersistentVolumeClaim) (IcingaState, string) {
+	switch pvc.Status.Phase {
+	case kcorev1.ClaimLost:
+		return Critical, fmt.Sprintf("PVC %s/%s lost its underlying volume %s.", pvc.Namespace, pvc.Name, pvc.Spec.VolumeName)
+	case kcorev1.ClaimPending:
+		return Pending, fmt.Sprintf("PVC %s/%s is not yet bound to a volume.", pvc.Namespace, pvc.Name)
+	case kcorev1.ClaimBound:
+	default:
+		return Unknown, fmt.Sprintf("PVC %s/%s has an unknown phase %s.", pvc.Namespace, pvc.Name, pvc.Status.Phase)
+	}
+
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Status != kcorev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case kcorev1.PersistentVolumeClaimResizing, kcorev1.PersistentVolumeClaimFileSystemResizePending:
+			reason := fmt.Sprintf("PVC %s/%s is being resized", pvc.Namespace, pvc.Name)
+			if condition.Message != "" {
+				reason += ": " + condition.Message
+			}
+
+			return Ok, reason + "."
+		}
+	}
+
+	if p.MinimumCapacity.Valid && p.ActualCapacity.Valid && p.ActualCapacity.Int64 < p.MinimumCapacity.Int64 {
+		return Warning, fmt.Sprintf(
+			"PVC %s/%s only has a capacity of %s, although %s is requested.",
+			pvc.Namespace, pvc.Name,
+			pvc.Status.Capacity.Storage(), pvc.Spec.Resources.Requests.Storage())
+	}
+
+	return Ok, fmt.Sprintf("PVC %s/%s is bound to volume %s.", pvc.Namespace, pvc.Name, pvc.Spec.VolumeName)
+}
+
 func (p *Pvc) Relations() []database.Relation {
 	fk := database.WithForeignKey("pvc_uuid")
 
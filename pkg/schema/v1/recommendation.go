@@ -0,0 +1,31 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// ContainerRecommendation recommends the requests and limits of a container of a workload, e.g. a deployment,
+// from the observed usage of the container in its pods.
+// Like in Container, CPU is in millicores and memory in millibytes.
+type ContainerRecommendation struct {
+	ClusterUuid  types.UUID
+	Namespace    string
+	WorkloadKind string
+	WorkloadName string
+	Container    string
+	// CpuRequests, CpuLimits, MemoryRequests and MemoryLimits are the current resources of the container.
+	CpuRequests    sql.NullInt64
+	CpuLimits      sql.NullInt64
+	MemoryRequests sql.NullInt64
+	MemoryLimits   sql.NullInt64
+	// CpuUsage in cores and MemoryUsage in bytes are the configured percentiles of the observed usage.
+	CpuUsage    float64
+	MemoryUsage float64
+	// RecommendedCpuLimits and RecommendedMemoryLimits are NULL if the container has no limits.
+	RecommendedCpuRequests    int64
+	RecommendedCpuLimits      sql.NullInt64
+	RecommendedMemoryRequests int64
+	RecommendedMemoryLimits   sql.NullInt64
+	Computed                  types.UnixMilli
+}
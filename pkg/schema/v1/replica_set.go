@@ -17,6 +17,7 @@ import (
 
 type ReplicaSet struct {
 	Meta
+	LastChange
 	DesiredReplicas       int32
 	MinReadySeconds       int32
 	ActualReplicas        int32
@@ -67,8 +68,9 @@ func NewReplicaSet() Resource {
 	return &ReplicaSet{}
 }
 
-func (r *ReplicaSet) Obtain(k8s kmetav1.Object) {
-	r.ObtainMeta(k8s)
+func (r *ReplicaSet) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	r.ObtainMeta(k8s, clusterUuid)
+	r.ObtainLastChange(k8s)
 
 	replicaSet := k8s.(*kappsv1.ReplicaSet)
 
@@ -83,6 +85,7 @@ func (r *ReplicaSet) Obtain(k8s kmetav1.Object) {
 	r.ReadyReplicas = replicaSet.Status.ReadyReplicas
 	r.AvailableReplicas = replicaSet.Status.AvailableReplicas
 	r.IcingaState, r.IcingaStateReason = r.getIcingaState()
+	r.IcingaState, r.IcingaStateReason = ignore(k8s, r.IcingaState, r.IcingaStateReason)
 
 	for _, condition := range replicaSet.Status.Conditions {
 		r.Conditions = append(r.Conditions, ReplicaSetCondition{
@@ -153,6 +156,11 @@ func (r *ReplicaSet) Obtain(k8s kmetav1.Object) {
 	r.Yaml = string(output)
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (r *ReplicaSet) State() (IcingaState, string) {
+	return r.IcingaState, r.IcingaStateReason
+}
+
 func (r *ReplicaSet) getIcingaState() (IcingaState, string) {
 	if r.DesiredReplicas < 1 {
 		reason := fmt.Sprintf("ReplicaSet %s/%s has an invalid desired replica count: %d.", r.Namespace, r.Name, r.DesiredReplicas)
@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// routeAdmitted is the condition set by OpenShift routers on the routes they serve or reject.
+const routeAdmitted = "Admitted"
+
+// Route is an OpenShift route, which exposes a service via the routers of the cluster like an ingress.
+// Admitted is true if all routers that handled the route admitted it, false if any rejected it,
+// and not set as long as no router has handled it.
+type Route struct {
+	Meta
+	Host                          sql.NullString
+	Path                          sql.NullString
+	ServiceName                   string
+	TargetPort                    sql.NullString
+	TlsTermination                sql.NullString
+	InsecureEdgeTerminationPolicy sql.NullString
+	WildcardPolicy                sql.NullString
+	Admitted                      types.Bool
+	AdmittedReason                sql.NullString
+	Yaml                          string
+}
+
+// route contains the fields of route.openshift.io/v1 routes that are synchronized,
+// as the OpenShift API types are not a dependency.
+type route struct {
+	Spec struct {
+		Host string `json:"host"`
+		Path string `json:"path"`
+		To   struct {
+			Name string `json:"name"`
+		} `json:"to"`
+		Port *struct {
+			TargetPort intstr.IntOrString `json:"targetPort"`
+		} `json:"port"`
+		Tls *struct {
+			Termination                   string `json:"termination"`
+			InsecureEdgeTerminationPolicy string `json:"insecureEdgeTerminationPolicy"`
+		} `json:"tls"`
+		WildcardPolicy string `json:"wildcardPolicy"`
+	} `json:"spec"`
+	Status struct {
+		Ingress []struct {
+			RouterName string `json:"routerName"`
+			Conditions []struct {
+				Type    string `json:"type"`
+				Status  string `json:"status"`
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"conditions"`
+		} `json:"ingress"`
+	} `json:"status"`
+}
+
+func NewRoute() Resource {
+	return &Route{}
+}
+
+func (r *Route) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	r.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var rt route
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &rt); err != nil {
+		return
+	}
+
+	r.Host = NewNullableString(rt.Spec.Host)
+	r.Path = NewNullableString(rt.Spec.Path)
+	r.ServiceName = rt.Spec.To.Name
+	if rt.Spec.Port != nil {
+		r.TargetPort = NewNullableString(rt.Spec.Port.TargetPort.String())
+	}
+	if rt.Spec.Tls != nil {
+		r.TlsTermination = NewNullableString(strings.ToLower(rt.Spec.Tls.Termination))
+		r.InsecureEdgeTerminationPolicy = NewNullableString(rt.Spec.Tls.InsecureEdgeTerminationPolicy)
+	}
+	r.WildcardPolicy = NewNullableString(rt.Spec.WildcardPolicy)
+
+	for _, ingress := range rt.Status.Ingress {
+		for _, c := range ingress.Conditions {
+			if c.Type != routeAdmitted {
+				continue
+			}
+
+			if c.Status == string(kmetav1.ConditionTrue) {
+				if !r.Admitted.Valid {
+					r.Admitted = types.Bool{Bool: true, Valid: true}
+				}
+			} else if !r.Admitted.Valid || r.Admitted.Bool {
+				r.Admitted = types.Bool{Bool: false, Valid: true}
+				r.AdmittedReason = NewNullableString(strings.TrimSpace(
+					"Router " + ingress.RouterName + ": " + c.Reason + " " + c.Message))
+			}
+		}
+	}
+
+	output, _ := yaml.Marshal(u.Object)
+	r.Yaml = string(output)
+}
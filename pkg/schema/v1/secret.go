@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"database/sql"
 	"github.com/icinga/icinga-go-library/types"
 	"github.com/icinga/icinga-kubernetes/pkg/database"
 	kcorev1 "k8s.io/api/core/v1"
@@ -10,7 +11,7 @@ import (
 
 type Secret struct {
 	Meta
-	Type              string
+	Type              sql.NullString
 	Immutable         types.Bool
 	Labels            []Label            `db:"-"`
 	SecretLabels      []SecretLabel      `db:"-"`
@@ -32,23 +33,24 @@ func NewSecret() Resource {
 	return &Secret{}
 }
 
-func (s *Secret) Obtain(k8s kmetav1.Object) {
-	s.ObtainMeta(k8s)
+func (s *Secret) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	s.ObtainMeta(k8s, clusterUuid)
 
-	secret := k8s.(*kcorev1.Secret)
+	// Secrets watched with metadata-only informers lack their type and whether they are immutable.
+	if secret, ok := k8s.(*kcorev1.Secret); ok {
+		s.Type = NewNullableString(string(secret.Type))
 
-	s.Type = string(secret.Type)
-
-	var immutable bool
-	if secret.Immutable != nil {
-		immutable = *secret.Immutable
-	}
-	s.Immutable = types.Bool{
-		Bool:  immutable,
-		Valid: true,
+		var immutable bool
+		if secret.Immutable != nil {
+			immutable = *secret.Immutable
+		}
+		s.Immutable = types.Bool{
+			Bool:  immutable,
+			Valid: true,
+		}
 	}
 
-	for labelName, labelValue := range secret.Labels {
+	for labelName, labelValue := range k8s.GetLabels() {
 		labelUuid := NewUUID(s.Uuid, strings.ToLower(labelName+":"+labelValue))
 		s.Labels = append(s.Labels, Label{
 			Uuid:  labelUuid,
@@ -61,7 +63,7 @@ func (s *Secret) Obtain(k8s kmetav1.Object) {
 		})
 	}
 
-	for annotationName, annotationValue := range secret.Annotations {
+	for annotationName, annotationValue := range k8s.GetAnnotations() {
 		annotationUuid := NewUUID(s.Uuid, strings.ToLower(annotationName+":"+annotationValue))
 		s.Annotations = append(s.Annotations, Annotation{
 			Uuid:  annotationUuid,
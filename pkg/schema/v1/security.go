@@ -0,0 +1,247 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+	kcorev1 "k8s.io/api/core/v1"
+	"slices"
+	"strings"
+)
+
+// Levels of the Pod Security Standards.
+const (
+	PodSecurityPrivileged = "privileged"
+	PodSecurityBaseline   = "baseline"
+	PodSecurityRestricted = "restricted"
+)
+
+// Labels with which namespaces configure the Pod Security Standards level enforced, audited and warned about
+// by the PodSecurity admission controller.
+const (
+	podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+	podSecurityAuditLabel   = "pod-security.kubernetes.io/audit"
+	podSecurityWarnLabel    = "pod-security.kubernetes.io/warn"
+)
+
+// baselineCapabilities are the capabilities that may be added to containers under the baseline level.
+var baselineCapabilities = []string{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD", "NET_BIND_SERVICE",
+	"SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// SecurityPosture is the effective security posture of a pod, combined from the security contexts
+// of the pod and all of its containers, so that privileged workloads can be reported.
+type SecurityPosture struct {
+	// Privileged is whether any container is privileged.
+	Privileged types.Bool
+	// RunAsRoot is whether any container may run as root, i.e. neither runAsNonRoot nor a non-root user is set.
+	RunAsRoot   types.Bool
+	HostNetwork types.Bool
+	HostPid     types.Bool
+	HostIpc     types.Bool
+	// AllowPrivilegeEscalation is whether any container doesn't explicitly disallow privilege escalation.
+	AllowPrivilegeEscalation types.Bool
+	// Capabilities are the capabilities added to any container, comma-separated.
+	Capabilities sql.NullString
+	// SeccompProfile is the least restrictive seccomp profile type of any container,
+	// NULL if not set for some container, which means Unconfined unless the kubelet defaults to RuntimeDefault.
+	SeccompProfile sql.NullString
+	// PodSecurityLevel is the most restrictive Pod Security Standards level the pod complies with,
+	// evaluated on the most relevant controls, i.e. without AppArmor, SELinux and sysctls.
+	PodSecurityLevel string
+}
+
+// ObtainSecurityPosture obtains the security posture from the spec of the given pod.
+func (s *SecurityPosture) ObtainSecurityPosture(pod *kcorev1.Pod) {
+	spec := &pod.Spec
+	podContext := spec.SecurityContext
+	if podContext == nil {
+		podContext = &kcorev1.PodSecurityContext{}
+	}
+
+	var privileged, runAsRoot, escalation, unsetSeccomp bool
+	baseline, restricted := true, true
+	capabilities := make(map[string]struct{})
+	// seccomp is the index of the least restrictive seccomp profile type in seccompTypes.
+	seccomp := -1
+
+	containers := append(append([]kcorev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		sc := c.SecurityContext
+		if sc == nil {
+			sc = &kcorev1.SecurityContext{}
+		}
+
+		if sc.Privileged != nil && *sc.Privileged {
+			privileged = true
+		}
+
+		if !runsAsNonRoot(podContext, sc) {
+			runAsRoot = true
+		}
+
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			escalation = true
+		}
+
+		if sc.ProcMount != nil && *sc.ProcMount == kcorev1.UnmaskedProcMount {
+			baseline = false
+		}
+
+		dropsAll := false
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Add {
+				name := strings.TrimPrefix(strings.ToUpper(string(capability)), "CAP_")
+				capabilities[name] = struct{}{}
+
+				if !slices.Contains(baselineCapabilities, name) {
+					baseline = false
+				}
+
+				if name != "NET_BIND_SERVICE" {
+					restricted = false
+				}
+			}
+
+			for _, capability := range sc.Capabilities.Drop {
+				if strings.ToUpper(string(capability)) == "ALL" {
+					dropsAll = true
+				}
+			}
+		}
+		if !dropsAll {
+			restricted = false
+		}
+
+		profile := podContext.SeccompProfile
+		if sc.SeccompProfile != nil {
+			profile = sc.SeccompProfile
+		}
+		if profile == nil {
+			unsetSeccomp = true
+			restricted = false
+		} else {
+			seccomp = max(seccomp, seccompRank(profile.Type))
+			if profile.Type == kcorev1.SeccompProfileTypeUnconfined {
+				baseline = false
+			}
+		}
+
+		for _, port := range c.Ports {
+			if port.HostPort != 0 {
+				baseline = false
+			}
+		}
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			baseline = false
+		}
+
+		if !restrictedVolume(volume.VolumeSource) {
+			restricted = false
+		}
+	}
+
+	if privileged || spec.HostNetwork || spec.HostPID || spec.HostIPC {
+		baseline = false
+	}
+
+	if runAsRoot || escalation {
+		restricted = false
+	}
+
+	s.Privileged = types.Bool{Bool: privileged, Valid: true}
+	s.RunAsRoot = types.Bool{Bool: runAsRoot, Valid: true}
+	s.HostNetwork = types.Bool{Bool: spec.HostNetwork, Valid: true}
+	s.HostPid = types.Bool{Bool: spec.HostPID, Valid: true}
+	s.HostIpc = types.Bool{Bool: spec.HostIPC, Valid: true}
+	s.AllowPrivilegeEscalation = types.Bool{Bool: escalation, Valid: true}
+
+	if len(capabilities) > 0 {
+		names := make([]string, 0, len(capabilities))
+		for name := range capabilities {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		s.Capabilities = NewNullableString(strings.Join(names, ","))
+	}
+
+	// An explicitly unconfined container outweighs containers without a profile, whose confinement is unknown.
+	if seccomp >= 0 && (!unsetSeccomp || seccompTypes[seccomp] == kcorev1.SeccompProfileTypeUnconfined) {
+		s.SeccompProfile = NewNullableString(string(seccompTypes[seccomp]))
+	}
+
+	switch {
+	case baseline && restricted:
+		s.PodSecurityLevel = PodSecurityRestricted
+	case baseline:
+		s.PodSecurityLevel = PodSecurityBaseline
+	default:
+		s.PodSecurityLevel = PodSecurityPrivileged
+	}
+}
+
+// seccompTypes are the seccomp profile types from the most to the least restrictive.
+var seccompTypes = []kcorev1.SeccompProfileType{
+	kcorev1.SeccompProfileTypeRuntimeDefault, kcorev1.SeccompProfileTypeLocalhost, kcorev1.SeccompProfileTypeUnconfined,
+}
+
+// seccompRank returns the index of the given type in seccompTypes, treating unknown types as unconfined.
+func seccompRank(t kcorev1.SeccompProfileType) int {
+	if i := slices.Index(seccompTypes, t); i >= 0 {
+		return i
+	}
+
+	return len(seccompTypes) - 1
+}
+
+// restrictedVolume returns whether the given volume may be used under the restricted level.
+func restrictedVolume(v kcorev1.VolumeSource) bool {
+	return v.ConfigMap != nil || v.CSI != nil || v.DownwardAPI != nil || v.EmptyDir != nil || v.Ephemeral != nil ||
+		v.PersistentVolumeClaim != nil || v.Projected != nil || v.Secret != nil
+}
+
+// runsAsNonRoot returns whether a container with the given security context in a pod with the given one
+// is guaranteed not to run as root, with the container's settings taking precedence.
+func runsAsNonRoot(pod *kcorev1.PodSecurityContext, container *kcorev1.SecurityContext) bool {
+	user := pod.RunAsUser
+	if container.RunAsUser != nil {
+		user = container.RunAsUser
+	}
+	if user != nil {
+		return *user != 0
+	}
+
+	nonRoot := pod.RunAsNonRoot
+	if container.RunAsNonRoot != nil {
+		nonRoot = container.RunAsNonRoot
+	}
+
+	return nonRoot != nil && *nonRoot
+}
+
+// PodSecurityLevels are the Pod Security Standards levels a namespace configures via its labels.
+type PodSecurityLevels struct {
+	PodSecurityEnforce sql.NullString
+	PodSecurityAudit   sql.NullString
+	PodSecurityWarn    sql.NullString
+}
+
+// ObtainPodSecurityLevels obtains the levels from the given labels of a namespace, ignoring invalid ones.
+func (l *PodSecurityLevels) ObtainPodSecurityLevels(labels map[string]string) {
+	l.PodSecurityEnforce = podSecurityLevel(labels[podSecurityEnforceLabel])
+	l.PodSecurityAudit = podSecurityLevel(labels[podSecurityAuditLabel])
+	l.PodSecurityWarn = podSecurityLevel(labels[podSecurityWarnLabel])
+}
+
+// podSecurityLevel returns the given level if it is valid, NULL otherwise.
+func podSecurityLevel(level string) sql.NullString {
+	switch level {
+	case PodSecurityPrivileged, PodSecurityBaseline, PodSecurityRestricted:
+		return NewNullableString(level)
+	default:
+		return sql.NullString{}
+	}
+}
@@ -75,12 +75,40 @@ type ServiceAnnotation struct {
 	AnnotationUuid types.UUID
 }
 
+// ServiceProblem is a problem of a service whose selector matches no ready endpoints, raised by the service tracker.
+// NotReadyEndpoints is the number of endpoints of the service that are not ready,
+// e.g. of pods that fail their readiness probes, and zero if the selector matches no pods at all.
+type ServiceProblem struct {
+	Uuid              types.UUID
+	ClusterUuid       types.UUID
+	ServiceUuid       types.UUID
+	Namespace         string
+	Name              string
+	Reason            string
+	Message           sql.NullString
+	NotReadyEndpoints int32
+	Started           types.UnixMilli
+	Cleared           types.UnixMilli
+}
+
+func (s *ServiceProblem) GetUuid() types.UUID {
+	return s.Uuid
+}
+
+func (s *ServiceProblem) GetReason() string {
+	return s.Reason
+}
+
+func (s *ServiceProblem) SetCleared(cleared types.UnixMilli) {
+	s.Cleared = cleared
+}
+
 func NewService() Resource {
 	return &Service{}
 }
 
-func (s *Service) Obtain(k8s kmetav1.Object) {
-	s.ObtainMeta(k8s)
+func (s *Service) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	s.ObtainMeta(k8s, clusterUuid)
 
 	service := k8s.(*kcorev1.Service)
 
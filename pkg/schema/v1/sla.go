@@ -0,0 +1,21 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// DeploymentSla is the availability of a deployment during a day,
+// i.e. the time in which all its desired replicas were available.
+type DeploymentSla struct {
+	DeploymentUuid types.UUID
+	ClusterUuid    types.UUID
+	// Day is the start of the day in UTC.
+	Day types.UnixMilli
+	// Observed is the time in milliseconds in which the deployment existed and its state was known.
+	Observed int64
+	// Available is the time in milliseconds in which the deployment was available or in downtime.
+	Available int64
+	// Availability is Available in percent of Observed, NULL if the deployment wasn't observed.
+	Availability sql.NullFloat64
+}
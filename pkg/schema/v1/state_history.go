@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Stater is implemented by resources for which an Icinga state is evaluated.
+type Stater interface {
+	Resource
+	State() (IcingaState, string)
+}
+
+// StateHistory is a transition of the Icinga state of a resource,
+// modeled after the state history of Icinga DB.
+type StateHistory struct {
+	Uuid          types.UUID
+	ClusterUuid   types.UUID
+	ResourceType  string
+	ResourceUuid  types.UUID
+	EventTime     types.UnixMilli
+	PreviousState IcingaState
+	State         IcingaState
+	Reason        sql.NullString
+	InDowntime    types.Bool
+}
+
+// FlappingHistory records when a resource started and stopped flapping, i.e. changing its state frequently.
+type FlappingHistory struct {
+	Uuid         types.UUID
+	ClusterUuid  types.UUID
+	ResourceType string
+	ResourceUuid types.UUID
+	StartTime    types.UnixMilli
+	EndTime      types.UnixMilli
+	// StateChanges is the number of state changes within the flapping interval when flapping started.
+	StateChanges int
+}
@@ -16,6 +16,7 @@ import (
 
 type StatefulSet struct {
 	Meta
+	LastChange
 	DesiredReplicas                                 int32
 	ServiceName                                     string
 	PodManagementPolicy                             string
@@ -73,8 +74,9 @@ func NewStatefulSet() Resource {
 	return &StatefulSet{}
 }
 
-func (s *StatefulSet) Obtain(k8s kmetav1.Object) {
-	s.ObtainMeta(k8s)
+func (s *StatefulSet) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	s.ObtainMeta(k8s, clusterUuid)
+	s.ObtainLastChange(k8s)
 
 	statefulSet := k8s.(*kappsv1.StatefulSet)
 
@@ -108,6 +110,7 @@ func (s *StatefulSet) Obtain(k8s kmetav1.Object) {
 	s.UpdatedReplicas = statefulSet.Status.UpdatedReplicas
 	s.AvailableReplicas = statefulSet.Status.AvailableReplicas
 	s.IcingaState, s.IcingaStateReason = s.getIcingaState()
+	s.IcingaState, s.IcingaStateReason = ignore(k8s, s.IcingaState, s.IcingaStateReason)
 
 	for _, condition := range statefulSet.Status.Conditions {
 		s.Conditions = append(s.Conditions, StatefulSetCondition{
@@ -178,6 +181,11 @@ func (s *StatefulSet) Obtain(k8s kmetav1.Object) {
 	s.Yaml = string(output)
 }
 
+// State returns the evaluated Icinga state and its reason.
+func (s *StatefulSet) State() (IcingaState, string) {
+	return s.IcingaState, s.IcingaStateReason
+}
+
 func (s *StatefulSet) getIcingaState() (IcingaState, string) {
 	if gracePeriodReason := IsWithinGracePeriod(s); gracePeriodReason != nil {
 		return Ok, *gracePeriodReason
@@ -0,0 +1,185 @@
+package v1
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/pkg/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"time"
+)
+
+// ThresholdAnnotationPrefix prefixes annotations of namespaces and objects that override thresholds
+// for the namespace or object, e.g. kubernetes.icinga.com/pod-pending-age-warning: 10m.
+const ThresholdAnnotationPrefix = "kubernetes.icinga.com/"
+
+// IgnoreAnnotation marks objects whose Icinga state is always OK if set to true,
+// e.g. for pods that are expected to fail.
+const IgnoreAnnotation = ThresholdAnnotationPrefix + "ignore"
+
+// Threshold defines from which value on a metric is considered warning or critical.
+// A zero value disables the respective state.
+type Threshold[T cmp.Ordered] struct {
+	Warning  T `yaml:"warning"`
+	Critical T `yaml:"critical"`
+}
+
+// State returns the state of value according to the threshold.
+func (t Threshold[T]) State(value T) IcingaState {
+	var zero T
+
+	switch {
+	case t.Critical != zero && value >= t.Critical:
+		return Critical
+	case t.Warning != zero && value >= t.Warning:
+		return Warning
+	default:
+		return Ok
+	}
+}
+
+// Enabled returns whether a warning or critical value is set.
+func (t Threshold[T]) Enabled() bool {
+	var zero T
+
+	return t.Warning != zero || t.Critical != zero
+}
+
+// Validate checks constraints in the supplied threshold and returns an error if they are violated.
+func (t Threshold[T]) Validate() error {
+	var zero T
+
+	if t.Warning < zero || t.Critical < zero {
+		return errors.New("thresholds must not be negative")
+	}
+
+	if t.Warning != zero && t.Critical != zero && t.Critical < t.Warning {
+		return errors.New("critical must not be less than warning")
+	}
+
+	return nil
+}
+
+// Thresholds configures the thresholds applied in addition to the built-in state evaluation.
+// Thresholds are evaluated whenever an object is synchronized.
+type Thresholds struct {
+	// NodeMemoryUsage is the memory usage of nodes in percent, as reported by Prometheus.
+	NodeMemoryUsage Threshold[float64] `yaml:"node_memory_usage"`
+
+	// PodPendingAge is the time pods spend in the Pending phase.
+	PodPendingAge Threshold[time.Duration] `yaml:"pod_pending_age"`
+
+	// PodRestartsPerHour is the number of container restarts of pods within the last hour,
+	// or per hour since they were started if restarts aren't recorded.
+	PodRestartsPerHour Threshold[float64] `yaml:"pod_restarts_per_hour"`
+
+	// HpaScalingsPerHour is the number of scalings of horizontal pod autoscalers within the last hour.
+	HpaScalingsPerHour Threshold[float64] `yaml:"hpa_scalings_per_hour"`
+}
+
+// Validate checks constraints in the supplied thresholds and returns an error if they are violated.
+func (t *Thresholds) Validate() error {
+	if err := t.NodeMemoryUsage.Validate(); err != nil {
+		return errors.Wrap(err, "invalid node_memory_usage")
+	}
+
+	if err := t.PodPendingAge.Validate(); err != nil {
+		return errors.Wrap(err, "invalid pod_pending_age")
+	}
+
+	if err := t.PodRestartsPerHour.Validate(); err != nil {
+		return errors.Wrap(err, "invalid pod_restarts_per_hour")
+	}
+
+	if err := t.HpaScalingsPerHour.Validate(); err != nil {
+		return errors.Wrap(err, "invalid hpa_scalings_per_hour")
+	}
+
+	return nil
+}
+
+// Merge returns a copy of t in which the warning and critical values set in override replace those of t.
+// Values not set in override are inherited from t. If the merged threshold would be invalid,
+// e.g. because only the warning value is raised above the inherited critical value,
+// the threshold of override replaces the one of t as a whole.
+func (t Thresholds) Merge(override Thresholds) Thresholds {
+	mergeThreshold(&t.NodeMemoryUsage, override.NodeMemoryUsage)
+	mergeThreshold(&t.PodPendingAge, override.PodPendingAge)
+	mergeThreshold(&t.PodRestartsPerHour, override.PodRestartsPerHour)
+	mergeThreshold(&t.HpaScalingsPerHour, override.HpaScalingsPerHour)
+
+	return t
+}
+
+// WithAnnotations returns a copy of t in which the thresholds are overridden by the given annotations
+// of a namespace or an object. Annotations with invalid values are ignored.
+func (t Thresholds) WithAnnotations(annotations map[string]string) Thresholds {
+	overrideThreshold(&t.NodeMemoryUsage, "node-memory-usage", annotations, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+	overrideThreshold(&t.PodPendingAge, "pod-pending-age", annotations, time.ParseDuration)
+	overrideThreshold(&t.PodRestartsPerHour, "pod-restarts-per-hour", annotations, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+	overrideThreshold(&t.HpaScalingsPerHour, "hpa-scalings-per-hour", annotations, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+
+	return t
+}
+
+func mergeThreshold[T cmp.Ordered](t *Threshold[T], override Threshold[T]) {
+	var zero T
+
+	merged := *t
+	if override.Warning != zero {
+		merged.Warning = override.Warning
+	}
+	if override.Critical != zero {
+		merged.Critical = override.Critical
+	}
+
+	if merged.Validate() == nil {
+		*t = merged
+	} else {
+		*t = override
+	}
+}
+
+func overrideThreshold[T cmp.Ordered](
+	t *Threshold[T], name string, annotations map[string]string, parse func(string) (T, error),
+) {
+	override := *t
+
+	for state, value := range map[string]*T{"warning": &override.Warning, "critical": &override.Critical} {
+		if annotation, ok := annotations[fmt.Sprintf("%s%s-%s", ThresholdAnnotationPrefix, name, state)]; ok {
+			v, err := parse(annotation)
+			if err != nil {
+				return
+			}
+
+			*value = v
+		}
+	}
+
+	if override.Validate() == nil {
+		*t = override
+	}
+}
+
+// Ignored returns whether the given object is annotated to be ignored by the state evaluation.
+func Ignored(k8s kmetav1.Object) bool {
+	ignore, err := strconv.ParseBool(k8s.GetAnnotations()[IgnoreAnnotation])
+
+	return err == nil && ignore
+}
+
+// ignore returns OK instead of the given state if the given object is annotated to be ignored,
+// keeping the reason of the evaluated state.
+func ignore(k8s kmetav1.Object, state IcingaState, reason string) (IcingaState, string) {
+	if state == Ok || !Ignored(k8s) {
+		return state, reason
+	}
+
+	return Ok, fmt.Sprintf("Ignored via the %s annotation. The state would be %s: %s", IgnoreAnnotation, state, reason)
+}
@@ -0,0 +1,84 @@
+package v1
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWithAnnotations verifies that annotations override thresholds value by value
+// and that invalid annotations leave the thresholds unchanged.
+func TestWithAnnotations(t *testing.T) {
+	thresholds := Thresholds{
+		PodPendingAge:      Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+		PodRestartsPerHour: Threshold[float64]{Warning: 3, Critical: 10},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		pending     Threshold[time.Duration]
+		restarts    Threshold[float64]
+	}{
+		{
+			name:     "no annotations",
+			pending:  Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+			restarts: Threshold[float64]{Warning: 3, Critical: 10},
+		},
+		{
+			name:        "warning is overridden",
+			annotations: map[string]string{"kubernetes.icinga.com/pod-pending-age-warning": "30m"},
+			pending:     Threshold[time.Duration]{Warning: 30 * time.Minute, Critical: time.Hour},
+			restarts:    Threshold[float64]{Warning: 3, Critical: 10},
+		},
+		{
+			name: "both values are overridden",
+			annotations: map[string]string{
+				"kubernetes.icinga.com/pod-restarts-per-hour-warning":  "20",
+				"kubernetes.icinga.com/pod-restarts-per-hour-critical": "50.5",
+			},
+			pending:  Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+			restarts: Threshold[float64]{Warning: 20, Critical: 50.5},
+		},
+		{
+			name:        "zero disables",
+			annotations: map[string]string{"kubernetes.icinga.com/pod-pending-age-critical": "0s"},
+			pending:     Threshold[time.Duration]{Warning: 10 * time.Minute},
+			restarts:    Threshold[float64]{Warning: 3, Critical: 10},
+		},
+		{
+			name:        "unparsable value is ignored",
+			annotations: map[string]string{"kubernetes.icinga.com/pod-pending-age-warning": "soon"},
+			pending:     Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+			restarts:    Threshold[float64]{Warning: 3, Critical: 10},
+		},
+		{
+			name:        "invalid threshold is ignored",
+			annotations: map[string]string{"kubernetes.icinga.com/pod-restarts-per-hour-warning": "20"},
+			pending:     Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+			restarts:    Threshold[float64]{Warning: 3, Critical: 10},
+		},
+		{
+			name:        "negative value is ignored",
+			annotations: map[string]string{"kubernetes.icinga.com/pod-restarts-per-hour-critical": "-1"},
+			pending:     Threshold[time.Duration]{Warning: 10 * time.Minute, Critical: time.Hour},
+			restarts:    Threshold[float64]{Warning: 3, Critical: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overridden := thresholds.WithAnnotations(tt.annotations)
+
+			if overridden.PodPendingAge != tt.pending {
+				t.Errorf("pod_pending_age is %+v, expected %+v", overridden.PodPendingAge, tt.pending)
+			}
+			if overridden.PodRestartsPerHour != tt.restarts {
+				t.Errorf("pod_restarts_per_hour is %+v, expected %+v", overridden.PodRestartsPerHour, tt.restarts)
+			}
+		})
+	}
+
+	if thresholds.PodPendingAge.Warning != 10*time.Minute {
+		t.Errorf("annotations changed the original thresholds")
+	}
+}
@@ -0,0 +1,59 @@
+package v1
+
+import (
+	kappsv1 "k8s.io/api/apps/v1"
+	kbatchv1 "k8s.io/api/batch/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// lastAppliedConfigAnnotation is set by kubectl apply and contains a copy of the whole object.
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Trim is a cache.TransformFunc that strips bulky object parts which are not synchronized to the database
+// before objects are cached by informers, i.e. managed fields, the last applied configuration
+// and the data of secrets and config maps.
+// Of workloads, only the managed fields entry of their last change is kept without its fields.
+func Trim(obj interface{}) (interface{}, error) {
+	// Only Kubernetes objects embed ObjectMeta, whereas the Meta objects used to warm up informers
+	// can also be passed here but must not be modified.
+	if o, ok := obj.(kmetav1.ObjectMetaAccessor); ok {
+		meta := o.GetObjectMeta()
+
+		var managedFields []kmetav1.ManagedFieldsEntry
+		switch obj.(type) {
+		case *kappsv1.Deployment, *kappsv1.DaemonSet, *kappsv1.StatefulSet, *kappsv1.ReplicaSet,
+			*kbatchv1.Job, *kbatchv1.CronJob:
+			if entry := lastChange(meta.GetManagedFields()); entry != nil {
+				trimmed := *entry
+				trimmed.FieldsV1 = nil
+				managedFields = []kmetav1.ManagedFieldsEntry{trimmed}
+			}
+		}
+		meta.SetManagedFields(managedFields)
+
+		if annotations := meta.GetAnnotations(); annotations != nil {
+			delete(annotations, lastAppliedConfigAnnotation)
+		}
+	}
+
+	switch o := obj.(type) {
+	case *unstructured.Unstructured:
+		// Custom resources watched with dynamic informers don't implement ObjectMetaAccessor.
+		o.SetManagedFields(nil)
+
+		if annotations := o.GetAnnotations(); annotations != nil {
+			delete(annotations, lastAppliedConfigAnnotation)
+			o.SetAnnotations(annotations)
+		}
+	case *kcorev1.Secret:
+		o.Data = nil
+		o.StringData = nil
+	case *kcorev1.ConfigMap:
+		o.Data = nil
+		o.BinaryData = nil
+	}
+
+	return obj, nil
+}
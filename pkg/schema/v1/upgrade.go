@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"database/sql"
+	"github.com/icinga/icinga-go-library/types"
+)
+
+// Sources of upgrade readiness issues.
+const (
+	// UpgradeIssueSourceObject means that an object was last written via an API that is removed.
+	UpgradeIssueSourceObject = "object"
+	// UpgradeIssueSourceRequest means that the API server was requested via an API that is removed.
+	UpgradeIssueSourceRequest = "request"
+	// UpgradeIssueSourceWarning means that the API server warned Icinga for Kubernetes about a request to an API
+	// that is removed.
+	UpgradeIssueSourceWarning = "warning"
+)
+
+// UpgradeReadiness is the report whether a cluster can be upgraded to a Kubernetes minor version
+// without clients or manifests breaking due to removed APIs.
+type UpgradeReadiness struct {
+	ClusterUuid types.UUID
+	// TargetVersion is the minor version, e.g. 1.32.
+	TargetVersion  string
+	CurrentVersion string
+	// Ready is true if there are no issues.
+	Ready    types.Bool
+	Issues   int
+	Computed types.UnixMilli
+}
+
+// UpgradeReadinessIssue is a usage of an API that is removed in or before the target version of its report.
+// Namespace and Name are empty for cluster-scoped objects and requests, which aren't attributed to objects.
+type UpgradeReadinessIssue struct {
+	ClusterUuid   types.UUID
+	TargetVersion string
+	Source        string
+	// ApiVersion is the group and version of the removed API, e.g. batch/v1beta1.
+	ApiVersion string
+	Resource   string
+	Namespace  string
+	Name       string
+	// Manager is the field manager that wrote the object via the removed API, e.g. kubectl.
+	Manager sql.NullString
+	// RemovedIn is the minor version the API is removed in.
+	RemovedIn   string
+	Replacement sql.NullString
+	Computed    types.UnixMilli
+}
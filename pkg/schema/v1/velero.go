@@ -0,0 +1,299 @@
+package v1
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// veleroScheduleName is the label with which Velero marks the backups created by a schedule.
+const veleroScheduleName = "velero.io/schedule-name"
+
+// Phases of Velero backups, restores and schedules.
+const (
+	veleroCompleted        = "Completed"
+	veleroPartiallyFailed  = "PartiallyFailed"
+	veleroFailed           = "Failed"
+	veleroFailedValidation = "FailedValidation"
+	veleroDeleting         = "Deleting"
+	veleroEnabled          = "Enabled"
+)
+
+// VeleroBackup is a backup of Velero, either created manually or by a schedule.
+type VeleroBackup struct {
+	Meta
+	Phase             sql.NullString
+	ScheduleName      sql.NullString
+	StorageLocation   sql.NullString
+	Started           types.UnixMilli
+	Completed         types.UnixMilli
+	Expiration        types.UnixMilli
+	TotalItems        int32
+	ItemsBackedUp     int32
+	Errors            int32
+	Warnings          int32
+	FailureReason     sql.NullString
+	Yaml              string
+	IcingaState       IcingaState
+	IcingaStateReason string
+}
+
+// VeleroRestore is a restore of a Velero backup.
+type VeleroRestore struct {
+	Meta
+	Phase             sql.NullString
+	BackupName        sql.NullString
+	ScheduleName      sql.NullString
+	Started           types.UnixMilli
+	Completed         types.UnixMilli
+	TotalItems        int32
+	ItemsRestored     int32
+	Errors            int32
+	Warnings          int32
+	FailureReason     sql.NullString
+	Yaml              string
+	IcingaState       IcingaState
+	IcingaStateReason string
+}
+
+// VeleroSchedule is a schedule of Velero, which creates backups periodically.
+// The completion time of the last successful backup of the schedule is not part of the schedule itself,
+// so it is stored in the last_successful_backup column whenever schedules or their backups are synchronized.
+type VeleroSchedule struct {
+	Meta
+	Schedule          string
+	Paused            types.Bool
+	Phase             sql.NullString
+	LastBackup        types.UnixMilli
+	Yaml              string
+	IcingaState       IcingaState
+	IcingaStateReason string
+}
+
+// veleroStatus contains the status fields Velero backups and restores have in common.
+type veleroStatus struct {
+	Phase               string        `json:"phase"`
+	ValidationErrors    []string      `json:"validationErrors"`
+	StartTimestamp      *kmetav1.Time `json:"startTimestamp"`
+	CompletionTimestamp *kmetav1.Time `json:"completionTimestamp"`
+	Errors              int32         `json:"errors"`
+	Warnings            int32         `json:"warnings"`
+	FailureReason       string        `json:"failureReason"`
+}
+
+// veleroBackup, veleroRestore and veleroSchedule contain the fields of velero.io/v1 backups, restores and schedules
+// that are synchronized, as the Velero API types are not a dependency.
+type veleroBackup struct {
+	Spec struct {
+		StorageLocation string `json:"storageLocation"`
+	} `json:"spec"`
+	Status struct {
+		veleroStatus `json:",inline"`
+		Expiration   *kmetav1.Time `json:"expiration"`
+		Progress     *struct {
+			TotalItems    int32 `json:"totalItems"`
+			ItemsBackedUp int32 `json:"itemsBackedUp"`
+		} `json:"progress"`
+	} `json:"status"`
+}
+
+type veleroRestore struct {
+	Spec struct {
+		BackupName   string `json:"backupName"`
+		ScheduleName string `json:"scheduleName"`
+	} `json:"spec"`
+	Status struct {
+		veleroStatus `json:",inline"`
+		Progress     *struct {
+			TotalItems    int32 `json:"totalItems"`
+			ItemsRestored int32 `json:"itemsRestored"`
+		} `json:"progress"`
+	} `json:"status"`
+}
+
+type veleroSchedule struct {
+	Spec struct {
+		Schedule string `json:"schedule"`
+		Paused   bool   `json:"paused"`
+	} `json:"spec"`
+	Status struct {
+		Phase            string        `json:"phase"`
+		LastBackup       *kmetav1.Time `json:"lastBackup"`
+		ValidationErrors []string      `json:"validationErrors"`
+	} `json:"status"`
+}
+
+func NewVeleroBackup() Resource {
+	return &VeleroBackup{}
+}
+
+func (b *VeleroBackup) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	b.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var backup veleroBackup
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &backup); err != nil {
+		return
+	}
+
+	b.Phase = NewNullableString(backup.Status.Phase)
+	b.ScheduleName = NewNullableString(u.GetLabels()[veleroScheduleName])
+	b.StorageLocation = NewNullableString(backup.Spec.StorageLocation)
+	b.Started, b.Completed = veleroTimes(backup.Status.veleroStatus)
+	if backup.Status.Expiration != nil {
+		b.Expiration = types.UnixMilli(backup.Status.Expiration.Time)
+	}
+	if backup.Status.Progress != nil {
+		b.TotalItems = backup.Status.Progress.TotalItems
+		b.ItemsBackedUp = backup.Status.Progress.ItemsBackedUp
+	}
+	b.Errors = backup.Status.Errors
+	b.Warnings = backup.Status.Warnings
+	b.FailureReason = NewNullableString(backup.Status.FailureReason)
+
+	b.IcingaState, b.IcingaStateReason = veleroState("Backup", b.Namespace, b.Name, backup.Status.veleroStatus)
+	b.IcingaState, b.IcingaStateReason = ignore(k8s, b.IcingaState, b.IcingaStateReason)
+
+	output, _ := yaml.Marshal(u.Object)
+	b.Yaml = string(output)
+}
+
+func (b *VeleroBackup) State() (IcingaState, string) {
+	return b.IcingaState, b.IcingaStateReason
+}
+
+func NewVeleroRestore() Resource {
+	return &VeleroRestore{}
+}
+
+func (r *VeleroRestore) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	r.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var restore veleroRestore
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &restore); err != nil {
+		return
+	}
+
+	r.Phase = NewNullableString(restore.Status.Phase)
+	r.BackupName = NewNullableString(restore.Spec.BackupName)
+	r.ScheduleName = NewNullableString(restore.Spec.ScheduleName)
+	r.Started, r.Completed = veleroTimes(restore.Status.veleroStatus)
+	if restore.Status.Progress != nil {
+		r.TotalItems = restore.Status.Progress.TotalItems
+		r.ItemsRestored = restore.Status.Progress.ItemsRestored
+	}
+	r.Errors = restore.Status.Errors
+	r.Warnings = restore.Status.Warnings
+	r.FailureReason = NewNullableString(restore.Status.FailureReason)
+
+	r.IcingaState, r.IcingaStateReason = veleroState("Restore", r.Namespace, r.Name, restore.Status.veleroStatus)
+	r.IcingaState, r.IcingaStateReason = ignore(k8s, r.IcingaState, r.IcingaStateReason)
+
+	output, _ := yaml.Marshal(u.Object)
+	r.Yaml = string(output)
+}
+
+func (r *VeleroRestore) State() (IcingaState, string) {
+	return r.IcingaState, r.IcingaStateReason
+}
+
+func NewVeleroSchedule() Resource {
+	return &VeleroSchedule{}
+}
+
+func (s *VeleroSchedule) Obtain(k8s kmetav1.Object, clusterUuid types.UUID) {
+	s.ObtainMeta(k8s, clusterUuid)
+
+	u, ok := k8s.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	var schedule veleroSchedule
+	if err := kruntime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &schedule); err != nil {
+		return
+	}
+
+	s.Schedule = schedule.Spec.Schedule
+	s.Paused = types.Bool{Bool: schedule.Spec.Paused, Valid: true}
+	s.Phase = NewNullableString(schedule.Status.Phase)
+	if schedule.Status.LastBackup != nil {
+		s.LastBackup = types.UnixMilli(schedule.Status.LastBackup.Time)
+	}
+
+	switch {
+	case schedule.Status.Phase == veleroFailedValidation:
+		s.IcingaState = Critical
+		s.IcingaStateReason = fmt.Sprintf(
+			"Schedule %s/%s failed validation: %s.",
+			s.Namespace, s.Name, strings.Join(schedule.Status.ValidationErrors, ", "))
+	case schedule.Spec.Paused:
+		s.IcingaState = Ok
+		s.IcingaStateReason = fmt.Sprintf("Schedule %s/%s is paused.", s.Namespace, s.Name)
+	case schedule.Status.Phase == veleroEnabled:
+		s.IcingaState = Ok
+		s.IcingaStateReason = fmt.Sprintf("Schedule %s/%s is enabled.", s.Namespace, s.Name)
+	default:
+		s.IcingaState = Pending
+		s.IcingaStateReason = fmt.Sprintf("Schedule %s/%s has not been validated yet.", s.Namespace, s.Name)
+	}
+	s.IcingaState, s.IcingaStateReason = ignore(k8s, s.IcingaState, s.IcingaStateReason)
+
+	output, _ := yaml.Marshal(u.Object)
+	s.Yaml = string(output)
+}
+
+func (s *VeleroSchedule) State() (IcingaState, string) {
+	return s.IcingaState, s.IcingaStateReason
+}
+
+// veleroTimes returns the start and completion time of a Velero backup or restore.
+func veleroTimes(status veleroStatus) (started, completed types.UnixMilli) {
+	if status.StartTimestamp != nil {
+		started = types.UnixMilli(status.StartTimestamp.Time)
+	}
+	if status.CompletionTimestamp != nil {
+		completed = types.UnixMilli(status.CompletionTimestamp.Time)
+	}
+
+	return
+}
+
+// veleroState returns the Icinga state of a Velero backup or restore, e.g. "Backup", with the given status.
+// Partially failed operations are warnings, as the resources without errors have been processed,
+// and operations that haven't finished yet are pending.
+func veleroState(kind, namespace, name string, status veleroStatus) (IcingaState, string) {
+	switch status.Phase {
+	case veleroCompleted:
+		return Ok, fmt.Sprintf(
+			"%s %s/%s completed with %d warnings.", kind, namespace, name, status.Warnings)
+	case veleroPartiallyFailed:
+		return Warning, fmt.Sprintf(
+			"%s %s/%s partially failed with %d errors and %d warnings.",
+			kind, namespace, name, status.Errors, status.Warnings)
+	case veleroFailed:
+		return Critical, fmt.Sprintf(
+			"%s %s/%s failed: %s.", kind, namespace, name, status.FailureReason)
+	case veleroFailedValidation:
+		return Critical, fmt.Sprintf(
+			"%s %s/%s failed validation: %s.", kind, namespace, name, strings.Join(status.ValidationErrors, ", "))
+	case veleroDeleting:
+		return Ok, fmt.Sprintf("%s %s/%s is being deleted.", kind, namespace, name)
+	default:
+		return Pending, fmt.Sprintf("%s %s/%s is in progress.", kind, namespace, name)
+	}
+}
@@ -0,0 +1,205 @@
+// Package service raises problems for services whose selector matches no ready endpoints,
+// i.e. services that accept connections but have no pod to forward them to.
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	kcorev1 "k8s.io/api/core/v1"
+	kdiscoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kcache "k8s.io/client-go/tools/cache"
+	"time"
+)
+
+const (
+	// NoReadyEndpoints is the reason of problems of services whose selector matches no ready endpoints.
+	NoReadyEndpoints = "NoReadyEndpoints"
+
+	// interval is the interval in which services are checked.
+	interval = time.Minute
+	// grace is the time a service must have no ready endpoints before a problem is raised,
+	// so that services that are just created or whose pods are replaced at once don't raise problems.
+	grace = 2 * time.Minute
+)
+
+// Tracker checks the services of a cluster every minute and raises and clears problems in the service_problem table.
+// Headless services, services of type ExternalName and services without selector are not checked,
+// as they either don't forward connections to their endpoints or their endpoints are not managed by Kubernetes.
+// Services and endpoint slices are taken from the informers run by the services and endpoints controllers.
+type Tracker struct {
+	clusterUuid types.UUID
+	namespaces  func(string) bool
+	problems    *problem.Tracker[types.UUID, *schemav1.ServiceProblem]
+	// since contains the time from which services without ready endpoints have had none by their UUID.
+	since map[types.UUID]time.Time
+}
+
+// NewTracker creates a new Tracker for the cluster with the given UUID.
+// Services of namespaces for which namespaces returns false are not checked.
+// notify, if set, is called with each raised and cleared problem. Cleared problems have Cleared set.
+func NewTracker(
+	db *database.Database,
+	clusterUuid types.UUID,
+	namespaces func(string) bool,
+	notify func(*schemav1.ServiceProblem),
+	log logr.Logger,
+) *Tracker {
+	return &Tracker{
+		clusterUuid: clusterUuid,
+		namespaces:  namespaces,
+		problems: problem.NewTracker(
+			db,
+			"service problem",
+			func(p *schemav1.ServiceProblem) types.UUID { return p.ServiceUuid },
+			func(p *schemav1.ServiceProblem) []any { return []any{"service", p.Namespace + "/" + p.Name} },
+			notify,
+			log),
+		since: make(map[types.UUID]time.Time),
+	}
+}
+
+// Run loads the open problems and checks the services and endpoint slices cached by the given informers every minute
+// until ctx is canceled.
+func (t *Tracker) Run(ctx context.Context, services, endpointSlices kcache.SharedIndexInformer) error {
+	if err := t.problems.Load(ctx, "cluster_uuid = ?", t.clusterUuid); err != nil {
+		return err
+	}
+
+	if !kcache.WaitForCacheSync(ctx.Done(), services.HasSynced, endpointSlices.HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	for {
+		if err := t.Check(ctx, services.GetStore(), endpointSlices.GetStore(), time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Check checks the services and endpoint slices in the given stores at the given time
+// and raises and clears the problems of the services. Problems of services that no longer exist are cleared.
+func (t *Tracker) Check(ctx context.Context, services, endpointSlices kcache.Store, now time.Time) error {
+	// Ready and not ready endpoints by the namespace and name of their service.
+	ready := make(map[string]int)
+	notReady := make(map[string]int)
+	for _, obj := range endpointSlices.List() {
+		slice, ok := obj.(*kdiscoveryv1.EndpointSlice)
+		if !ok || slice.Labels[kdiscoveryv1.LabelServiceName] == "" {
+			continue
+		}
+
+		key := slice.Namespace + "/" + slice.Labels[kdiscoveryv1.LabelServiceName]
+		for _, e := range slice.Endpoints {
+			// Endpoints whose readiness is unknown are to be interpreted as ready.
+			if e.Conditions.Ready == nil || *e.Conditions.Ready {
+				ready[key]++
+			} else {
+				notReady[key]++
+			}
+		}
+	}
+
+	seen := make(map[types.UUID]struct{})
+	for _, obj := range services.List() {
+		svc, ok := obj.(*kcorev1.Service)
+		if !ok || !t.namespaces(svc.Namespace) || !checked(svc) {
+			continue
+		}
+
+		id := schemav1.EnsureUUID(svc.UID)
+		key := svc.Namespace + "/" + svc.Name
+
+		if ready[key] > 0 {
+			delete(t.since, id)
+
+			continue
+		}
+
+		seen[id] = struct{}{}
+
+		since, ok := t.since[id]
+		if !ok {
+			since = now
+			// Services with an open problem, e.g. raised before a restart, have had no ready endpoints since then.
+			if open, ok := t.problems.Open(id); ok {
+				since = open.Started.Time()
+			}
+			t.since[id] = since
+		}
+
+		if now.Sub(since) < grace {
+			continue
+		}
+
+		if err := t.raise(ctx, id, svc, notReady[key], since, now); err != nil {
+			return err
+		}
+	}
+
+	for id := range t.since {
+		if _, ok := seen[id]; !ok {
+			delete(t.since, id)
+		}
+	}
+
+	return t.problems.ClearFunc(ctx, func(id types.UUID, _ *schemav1.ServiceProblem) bool {
+		_, ok := seen[id]
+
+		return !ok
+	}, now)
+}
+
+// raise raises a problem for the given service, which has had no ready endpoints since the given time,
+// unless one is already open.
+func (t *Tracker) raise(
+	ctx context.Context, id types.UUID, svc *kcorev1.Service, notReady int, since, now time.Time,
+) error {
+	return t.problems.Update(ctx, id, NoReadyEndpoints, nil, func() *schemav1.ServiceProblem {
+		name := svc.Namespace + "/" + svc.Name
+
+		var message string
+		if notReady > 0 {
+			message = fmt.Sprintf(
+				"Service %s has no ready endpoints, as none of the %d endpoints of the pods matched by its selector %s"+
+					" is ready.",
+				name, notReady, labels.SelectorFromSet(svc.Spec.Selector))
+		} else {
+			message = fmt.Sprintf(
+				"Service %s has no ready endpoints, as its selector %s matches no pods.",
+				name, labels.SelectorFromSet(svc.Spec.Selector))
+		}
+
+		return &schemav1.ServiceProblem{
+			Uuid:              schemav1.NewUUID(id, fmt.Sprintf("%s:%d", NoReadyEndpoints, since.UnixMilli())),
+			ClusterUuid:       t.clusterUuid,
+			ServiceUuid:       id,
+			Namespace:         svc.Namespace,
+			Name:              svc.Name,
+			Reason:            NoReadyEndpoints,
+			Message:           schemav1.NewNullableString(message),
+			NotReadyEndpoints: int32(notReady),
+			Started:           types.UnixMilli(since),
+		}
+	}, now)
+}
+
+// checked returns whether the endpoints of the given service are checked, i.e. whether it is neither headless
+// nor of type ExternalName and has a selector, so that its endpoints are managed by Kubernetes.
+func checked(svc *kcorev1.Service) bool {
+	return svc.Spec.Type != kcorev1.ServiceTypeExternalName &&
+		svc.Spec.ClusterIP != kcorev1.ClusterIPNone &&
+		len(svc.Spec.Selector) > 0
+}
@@ -0,0 +1,378 @@
+// Package snapshot exports the synchronized data as portable archive and imports it into another database.
+//
+// A snapshot is a gzip-compressed stream of JSON lines. The first line is the Header,
+// followed by a Table line for each table, which in turn is followed by a line per row.
+// Rows are arrays of the values of the table's columns, either null or a string,
+// which is base64-encoded for binary columns.
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	k8sMysql "github.com/icinga/icinga-kubernetes/schema/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// importBatchSize is the number of rows imported per transaction.
+const importBatchSize = 1000
+
+// Header describes a snapshot.
+type Header struct {
+	// SchemaVersion is the version of the database schema the snapshot has been exported from.
+	SchemaVersion string `json:"schema_version"`
+	// Created is the time of the export in milliseconds since the epoch.
+	Created int64 `json:"created"`
+	// Namespaces are the namespaces the snapshot is restricted to, if any.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Table introduces the rows of a table in a snapshot.
+type Table struct {
+	Table   string   `json:"table"`
+	Columns []Column `json:"columns"`
+}
+
+// Column describes a column of a table in a snapshot.
+type Column struct {
+	Name   string `json:"name"`
+	Binary bool   `json:"binary,omitempty"`
+}
+
+// tablePattern matches the tables in the schema.
+var tablePattern = regexp.MustCompile(`CREATE TABLE (\w+) \(`)
+
+// Tables returns the tables included in snapshots in schema order,
+// i.e. all tables except the schema version history, which is specific to a database.
+func Tables() []string {
+	var tables []string
+	for _, m := range tablePattern.FindAllStringSubmatch(k8sMysql.Schema, -1) {
+		if m[1] != "kubernetes_schema" {
+			tables = append(tables, m[1])
+		}
+	}
+
+	return tables
+}
+
+// Export writes a snapshot of all tables to w. If namespaces are given, objects of other namespaces
+// and rows referring to them are omitted. Cluster-scoped objects, labels, annotations and
+// rows not referring to objects by their table are always included.
+func Export(ctx context.Context, db *database.Database, w io.Writer, namespaces []string) error {
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	if err := enc.Encode(Header{
+		SchemaVersion: version,
+		Created:       time.Now().UnixMilli(),
+		Namespaces:    namespaces,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	tables := Tables()
+	columns := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		rows, err := db.QueryxContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+		if err != nil {
+			return errors.Wrapf(err, "can't query columns of table %s", table)
+		}
+
+		columns[table], err = rows.Columns()
+		_ = rows.Close()
+		if err != nil {
+			return errors.Wrapf(err, "can't query columns of table %s", table)
+		}
+	}
+
+	f := filter{columns: columns, conditions: make(map[string]string)}
+	for _, table := range tables {
+		query := fmt.Sprintf("SELECT * FROM %s", table)
+		var args []interface{}
+
+		if len(namespaces) > 0 {
+			if condition := f.condition(table); condition != "" {
+				query += " WHERE " + condition
+				for i := strings.Count(condition, "?"); i > 0; i-- {
+					args = append(args, namespaces)
+				}
+
+				query, args, err = sqlx.In(query, args...)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		}
+
+		if err := exportTable(ctx, db, enc, table, db.Rebind(query), args...); err != nil {
+			return errors.Wrapf(err, "can't export table %s", table)
+		}
+	}
+
+	return errors.WithStack(gz.Close())
+}
+
+// Import reads a snapshot from r and upserts its rows into the database,
+// which must have the same schema version as the database the snapshot has been exported from.
+func Import(ctx context.Context, db *database.Database, r io.Reader) (Header, error) {
+	var header Header
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return header, errors.Wrap(err, "not a snapshot")
+	}
+	defer func() { _ = gz.Close() }()
+
+	scanner := bufio.NewScanner(gz)
+	// Rows may contain manifests and logs, which easily exceed the default maximum line length.
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+
+	if !scanner.Scan() {
+		return header, errors.Wrap(scanErr(scanner), "can't read snapshot header")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return header, errors.Wrap(err, "can't parse snapshot header")
+	}
+
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return header, err
+	}
+	if header.SchemaVersion != version {
+		return header, errors.Errorf(
+			"snapshot has schema version %s, but the database has %s", header.SchemaVersion, version)
+	}
+
+	tables := Tables()
+	var table *Table
+	var stmt string
+	var batch []map[string]interface{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		for _, row := range batch {
+			if _, err := tx.NamedExecContext(ctx, stmt, row); err != nil {
+				return errors.Wrapf(err, "can't import into table %s", table.Table)
+			}
+		}
+
+		batch = batch[:0]
+
+		return errors.WithStack(tx.Commit())
+	}
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		if len(line) > 0 && line[0] == '{' {
+			if err := flush(); err != nil {
+				return header, err
+			}
+
+			table = &Table{}
+			if err := json.Unmarshal(line, table); err != nil {
+				return header, errors.Wrap(err, "can't parse table")
+			}
+
+			if !slices.Contains(tables, table.Table) {
+				return header, errors.Errorf("unknown table %s", table.Table)
+			}
+
+			names := make([]string, 0, len(table.Columns))
+			for _, c := range table.Columns {
+				names = append(names, c.Name)
+			}
+			stmt = db.BuildUpsertColumnsStmt(table.Table, names)
+
+			continue
+		}
+
+		if table == nil {
+			return header, errors.New("snapshot has rows without table")
+		}
+
+		var values []*string
+		if err := json.Unmarshal(line, &values); err != nil {
+			return header, errors.Wrapf(err, "can't parse row of table %s", table.Table)
+		}
+		if len(values) != len(table.Columns) {
+			return header, errors.Errorf("row of table %s has %d values, but %d columns are expected",
+				table.Table, len(values), len(table.Columns))
+		}
+
+		row := make(map[string]interface{}, len(values))
+		for i, c := range table.Columns {
+			switch {
+			case values[i] == nil:
+				row[c.Name] = nil
+			case c.Binary:
+				b, err := base64.StdEncoding.DecodeString(*values[i])
+				if err != nil {
+					return header, errors.Wrapf(err, "can't decode column %s of table %s", c.Name, table.Table)
+				}
+				row[c.Name] = b
+			default:
+				row[c.Name] = *values[i]
+			}
+		}
+
+		if batch = append(batch, row); len(batch) >= importBatchSize {
+			if err := flush(); err != nil {
+				return header, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return header, errors.Wrap(err, "can't read snapshot")
+	}
+
+	return header, flush()
+}
+
+// exportTable writes the Table line and the rows returned by the given query to enc.
+func exportTable(ctx context.Context, db *database.Database, enc *json.Encoder, table, query string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	t := Table{Table: table, Columns: make([]Column, 0, len(types))}
+	for _, ct := range types {
+		name := strings.ToUpper(ct.DatabaseTypeName())
+		t.Columns = append(t.Columns, Column{
+			Name:   ct.Name(),
+			Binary: strings.Contains(name, "BINARY") || strings.Contains(name, "BLOB") || name == "BYTEA",
+		})
+	}
+
+	if err := enc.Encode(t); err != nil {
+		return errors.WithStack(err)
+	}
+
+	raw := make([][]byte, len(t.Columns))
+	dest := make([]interface{}, len(raw))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+
+	values := make([]*string, len(raw))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return errors.WithStack(err)
+		}
+
+		for i, b := range raw {
+			switch {
+			case b == nil:
+				values[i] = nil
+			case t.Columns[i].Binary:
+				s := base64.StdEncoding.EncodeToString(b)
+				values[i] = &s
+			default:
+				s := string(b)
+				values[i] = &s
+			}
+		}
+
+		if err := enc.Encode(values); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(rows.Err())
+}
+
+// filter builds conditions restricting tables to the rows of objects of certain namespaces.
+type filter struct {
+	columns    map[string][]string
+	conditions map[string]string
+}
+
+// condition returns the WHERE condition restricting table to the rows of objects of the namespaces
+// bound to each of its placeholders, or an empty string if its rows can't be attributed to namespaces.
+// Rows are attributed by the namespace column, or by referring to a row of another table that is attributed,
+// e.g. containers via their pod_uuid column.
+func (f filter) condition(table string) string {
+	if condition, ok := f.conditions[table]; ok {
+		return condition
+	}
+
+	// Guard against cyclic references.
+	f.conditions[table] = ""
+
+	var condition string
+	switch {
+	case table == "namespace":
+		condition = "name IN (?)"
+	case slices.Contains(f.columns[table], "namespace"):
+		condition = "namespace IN (?)"
+	default:
+		for _, column := range f.columns[table] {
+			referenced, ok := strings.CutSuffix(column, "_uuid")
+			if !ok || referenced == table || f.columns[referenced] == nil {
+				continue
+			}
+
+			if c := f.condition(referenced); c != "" {
+				condition = fmt.Sprintf("%s IN (SELECT uuid FROM %s WHERE %s)", column, referenced, c)
+
+				break
+			}
+		}
+	}
+
+	f.conditions[table] = condition
+
+	return condition
+}
+
+// schemaVersion returns the version of the database schema.
+func schemaVersion(ctx context.Context, db *database.Database) (string, error) {
+	var version string
+	if err := db.GetContext(ctx, &version,
+		"SELECT version FROM kubernetes_schema WHERE success = 'y' ORDER BY id DESC LIMIT 1"); err != nil {
+		return "", errors.Wrap(err, "can't query schema version")
+	}
+
+	return version, nil
+}
+
+// scanErr returns the error of scanner or io.ErrUnexpectedEOF if it stopped at the end of input.
+func scanErr(scanner *bufio.Scanner) error {
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,249 @@
+package status
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Tables lists the tables whose rows are counted per cluster.
+var Tables = []string{
+	"namespace", "node", "pod", "deployment", "daemon_set", "replica_set", "stateful_set", "service",
+	"endpoint_slice", "secret", "config_map", "event", "pvc", "persistent_volume", "job", "cron_job", "ingress",
+	"problem", "state_history",
+}
+
+// Report describes the synchronization state of all clusters in the database.
+type Report struct {
+	// SchemaVersion is the version of the latest successfully imported or migrated database schema.
+	SchemaVersion string
+	Clusters      []Cluster
+}
+
+// Cluster describes the synchronization state of a single cluster.
+type Cluster struct {
+	Uuid      types.UUID
+	Name      sql.NullString
+	Instances []Instance
+	// Metrics maps Prometheus metric categories to the time of their latest synchronized value.
+	Metrics []Metric
+	// Rows maps Tables to the number of rows of the cluster.
+	Rows []Rows
+}
+
+// Instance describes an Icinga for Kubernetes instance synchronizing a cluster.
+type Instance struct {
+	Uuid                   types.UUID
+	Version                string
+	KubernetesVersion      string
+	KubernetesHeartbeat    types.UnixMilli
+	KubernetesApiReachable types.Bool
+	Message                sql.NullString
+	Heartbeat              types.UnixMilli
+	Controllers            []Controller
+	// Queries describes the freshness of the Prometheus metric categories queried by the instance.
+	Queries []Query
+}
+
+// Controller describes a controller run by an Instance.
+type Controller struct {
+	Name     string
+	LastSync types.UnixMilli
+	// LastEvent is the time the controller last processed an event.
+	LastEvent types.UnixMilli
+	// QueueDepth is the number of events waiting to be processed.
+	QueueDepth uint64
+	Errors     uint64
+}
+
+// Query describes the freshness of a Prometheus metric category of a kind of metrics, e.g. nodes,
+// queried by an Instance.
+type Query struct {
+	Kind      string
+	Category  string
+	LastQuery types.UnixMilli
+	// Backlog is the number of metrics of the kind waiting to be written to the database.
+	Backlog uint64
+}
+
+// Metric is the time of the latest synchronized value of a Prometheus metric category.
+type Metric struct {
+	Category string
+	Last     types.UnixMilli
+}
+
+// Rows is the number of rows of a cluster in a table.
+type Rows struct {
+	Table string
+	Count uint64
+}
+
+// Gather queries the synchronization state of the clusters from the database.
+// If cluster is not empty, only the cluster with that name is reported.
+func Gather(ctx context.Context, db *database.Database, cluster string) (*Report, error) {
+	if err := db.PingContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "can't connect to database")
+	}
+
+	r := &Report{}
+
+	if err := db.GetContext(ctx, &r.SchemaVersion,
+		"SELECT version FROM kubernetes_schema WHERE success = 'y' ORDER BY id DESC LIMIT 1"); err != nil {
+		return nil, errors.Wrap(err, "can't query schema version")
+	}
+
+	query := "SELECT uuid, name FROM cluster"
+	var args []any
+	if cluster != "" {
+		query += " WHERE name = ?"
+		args = append(args, cluster)
+	}
+	query += " ORDER BY name"
+
+	if err := db.SelectContext(ctx, &r.Clusters, db.Rebind(query), args...); err != nil {
+		return nil, errors.Wrap(err, "can't query clusters")
+	}
+
+	if cluster != "" && len(r.Clusters) == 0 {
+		return nil, errors.Errorf("cluster %q not found", cluster)
+	}
+
+	for i := range r.Clusters {
+		if err := gatherCluster(ctx, db, &r.Clusters[i]); err != nil {
+			return nil, errors.Wrapf(err, "cluster %s", r.Clusters[i].Uuid)
+		}
+	}
+
+	return r, nil
+}
+
+func gatherCluster(ctx context.Context, db *database.Database, c *Cluster) error {
+	if err := db.SelectContext(ctx, &c.Instances, db.Rebind(
+		"SELECT uuid, version, kubernetes_version, kubernetes_heartbeat, kubernetes_api_reachable, message, heartbeat"+
+			" FROM kubernetes_instance WHERE cluster_uuid = ? ORDER BY heartbeat DESC"), c.Uuid); err != nil {
+		return errors.Wrap(err, "can't query instances")
+	}
+
+	for i := range c.Instances {
+		if err := db.SelectContext(ctx, &c.Instances[i].Controllers, db.Rebind(
+			"SELECT name, last_sync, last_event, queue_depth, errors FROM kubernetes_instance_controller"+
+				" WHERE instance_uuid = ? ORDER BY name"),
+			c.Instances[i].Uuid); err != nil {
+			return errors.Wrap(err, "can't query instance controllers")
+		}
+
+		if err := db.SelectContext(ctx, &c.Instances[i].Queries, db.Rebind(
+			"SELECT kind, category, last_query, backlog FROM kubernetes_instance_metric"+
+				" WHERE instance_uuid = ? ORDER BY kind, category"),
+			c.Instances[i].Uuid); err != nil {
+			return errors.Wrap(err, "can't query instance metrics")
+		}
+	}
+
+	if err := db.SelectContext(ctx, &c.Metrics, db.Rebind(
+		"SELECT category, MAX(last) AS last FROM ("+
+			"SELECT category, MAX(until) AS last FROM prometheus_cluster_metric WHERE cluster_uuid = ? GROUP BY category"+
+			" UNION ALL SELECT m.category, MAX(m.until) FROM prometheus_node_metric m"+
+			" INNER JOIN node n ON n.uuid = m.node_uuid WHERE n.cluster_uuid = ? GROUP BY m.category"+
+			" UNION ALL SELECT m.category, MAX(m.until) FROM prometheus_pod_metric m"+
+			" INNER JOIN pod p ON p.uuid = m.pod_uuid WHERE p.cluster_uuid = ? GROUP BY m.category"+
+			" UNION ALL SELECT m.category, MAX(m.until) FROM prometheus_service_metric m"+
+			" INNER JOIN service s ON s.uuid = m.service_uuid WHERE s.cluster_uuid = ? GROUP BY m.category"+
+			") metrics GROUP BY category ORDER BY category"), c.Uuid, c.Uuid, c.Uuid, c.Uuid); err != nil {
+		return errors.Wrap(err, "can't query metrics")
+	}
+
+	for _, table := range Tables {
+		rows := Rows{Table: table}
+		if err := db.GetContext(ctx, &rows.Count, db.Rebind(
+			fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE cluster_uuid = ?", table)), c.Uuid); err != nil {
+			return errors.Wrapf(err, "can't count rows of table %s", table)
+		}
+
+		c.Rows = append(c.Rows, rows)
+	}
+
+	return nil
+}
+
+// Print writes the report to w in a human-readable format.
+// Lags are relative to now, which is the time the report has been gathered.
+func (r *Report) Print(w io.Writer, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	since := func(t types.UnixMilli) string {
+		if t.Time().IsZero() {
+			return "never"
+		}
+
+		return now.Sub(t.Time()).Truncate(time.Second).String() + " ago"
+	}
+
+	fmt.Fprintf(tw, "Database: reachable, schema version %s\n", r.SchemaVersion)
+
+	for _, c := range r.Clusters {
+		name := c.Name.String
+		if name == "" {
+			name = c.Uuid.String()
+		}
+
+		fmt.Fprintf(tw, "\nCluster %s\n", name)
+
+		if len(c.Instances) == 0 {
+			fmt.Fprintln(tw, "  No instance is synchronizing the cluster.")
+		}
+
+		for _, i := range c.Instances {
+			api := "reachable"
+			if !i.KubernetesApiReachable.Bool {
+				api = "unreachable"
+				if i.Message.Valid {
+					api += ": " + i.Message.String
+				}
+			}
+
+			fmt.Fprintf(tw, "  Instance %s\n", i.Uuid)
+			fmt.Fprintf(tw, "    Version:\t%s\n", i.Version)
+			fmt.Fprintf(tw, "    Heartbeat:\t%s\n", since(i.Heartbeat))
+			fmt.Fprintf(tw, "    Kubernetes API:\t%s, version %s, last contact %s\n",
+				api, i.KubernetesVersion, since(i.KubernetesHeartbeat))
+
+			if len(i.Controllers) > 0 {
+				fmt.Fprintln(tw, "    Controller\tLast sync\tLast event\tQueue\tErrors")
+			}
+			for _, ctrl := range i.Controllers {
+				fmt.Fprintf(tw, "    %s\t%s\t%s\t%d\t%d\n",
+					ctrl.Name, since(ctrl.LastSync), since(ctrl.LastEvent), ctrl.QueueDepth, ctrl.Errors)
+			}
+
+			if len(i.Queries) > 0 {
+				fmt.Fprintln(tw, "    Metric query\tLast query\tBacklog")
+			}
+			for _, q := range i.Queries {
+				fmt.Fprintf(tw, "    %s/%s\t%s\t%d\n", q.Kind, q.Category, since(q.LastQuery), q.Backlog)
+			}
+		}
+
+		if len(c.Metrics) > 0 {
+			fmt.Fprintln(tw, "  Prometheus metric\tLast value")
+		}
+		for _, m := range c.Metrics {
+			fmt.Fprintf(tw, "  %s\t%s\n", m.Category, since(m.Last))
+		}
+
+		var rows []string
+		for _, row := range c.Rows {
+			rows = append(rows, fmt.Sprintf("%s=%d", row.Table, row.Count))
+		}
+		fmt.Fprintf(tw, "  Rows: %s\n", strings.Join(rows, " "))
+	}
+
+	return errors.Wrap(tw.Flush(), "can't write report")
+}
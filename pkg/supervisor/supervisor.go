@@ -0,0 +1,144 @@
+// Package supervisor runs long-running tasks and restarts them if they fail,
+// so that a single failing task doesn't stop unrelated ones.
+package supervisor
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-kubernetes/pkg/backoff"
+	"golang.org/x/sync/errgroup"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthyAfter is the time a restarted task must run without failing to be considered healthy again.
+// Its restart backoff is also reset then.
+const healthyAfter = 5 * time.Minute
+
+// Policy defines what happens when a task fails.
+type Policy int
+
+const (
+	// Never propagates the error of the task to the group, which stops all other tasks.
+	Never Policy = iota
+	// OnFailure restarts the task with exponential backoff.
+	OnFailure
+)
+
+// Health describes the health of a task.
+type Health struct {
+	Name string
+	// Failures is the number of times the task has failed.
+	Failures uint64
+	// LastError is the error the task last failed with, if any.
+	LastError error
+	// LastFailure is the time the task last failed or the zero time if it never failed.
+	LastFailure time.Time
+}
+
+// Healthy returns whether the task hasn't failed within the last five minutes.
+func (h Health) Healthy() bool {
+	return h.LastFailure.IsZero() || time.Since(h.LastFailure) >= healthyAfter
+}
+
+// Supervisor runs tasks in an errgroup and restarts them according to their Policy.
+type Supervisor struct {
+	ctx     context.Context
+	g       *errgroup.Group
+	log     logr.Logger
+	restart bool
+
+	mu     sync.Mutex
+	health map[string]*Health
+}
+
+// New returns a Supervisor running tasks in g, which must have been created with ctx.
+// If restart is false, e.g. when synchronizing only once, tasks are never restarted regardless of their Policy.
+func New(ctx context.Context, g *errgroup.Group, restart bool, log logr.Logger) *Supervisor {
+	return &Supervisor{
+		ctx:     ctx,
+		g:       g,
+		log:     log,
+		restart: restart,
+		health:  make(map[string]*Health),
+	}
+}
+
+// Go runs fn as task with the given name. If it fails and policy is OnFailure, it is called again after a backoff,
+// unless the context has been canceled. fn must therefore be able to start over, releasing what it acquired.
+// Tasks that return nil are not restarted.
+func (s *Supervisor) Go(name string, policy Policy, fn func() error) {
+	s.mu.Lock()
+	s.health[name] = &Health{Name: name}
+	s.mu.Unlock()
+
+	b := backoff.NewExponentialWithJitter(time.Second, 5*time.Minute)
+
+	s.g.Go(func() error {
+		var attempt uint64
+		for {
+			started := time.Now()
+			err := fn()
+			if err == nil || policy == Never || !s.restart || s.ctx.Err() != nil {
+				return err
+			}
+
+			if time.Since(started) >= healthyAfter {
+				attempt = 0
+			}
+
+			delay := b(attempt)
+			attempt++
+			s.failed(name, err)
+			s.log.Error(err, "Task failed. Restarting", "task", name, "after", delay)
+
+			select {
+			case <-time.After(delay):
+			case <-s.ctx.Done():
+				return s.ctx.Err()
+			}
+		}
+	})
+}
+
+// Health returns the health of all tasks ordered by name.
+func (s *Supervisor) Health() []Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health := make([]Health, 0, len(s.health))
+	for _, h := range s.health {
+		health = append(health, *h)
+	}
+
+	slices.SortFunc(health, func(a, b Health) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return health
+}
+
+// Unhealthy returns a message listing all tasks that aren't healthy with their last error,
+// or an empty string if all tasks are healthy.
+func (s *Supervisor) Unhealthy() string {
+	var unhealthy []string
+	for _, h := range s.Health() {
+		if !h.Healthy() {
+			unhealthy = append(unhealthy, h.Name+" failed: "+h.LastError.Error())
+		}
+	}
+
+	return strings.Join(unhealthy, "; ")
+}
+
+func (s *Supervisor) failed(name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.health[name]
+	h.Failures++
+	h.LastError = err
+	h.LastFailure = time.Now()
+}
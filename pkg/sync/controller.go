@@ -4,28 +4,42 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	"time"
 )
 
+// maxRetries is the number of times an item is retried before its error is reported.
+const maxRetries = 5
+
 type Controller struct {
+	features *Features
 	informer cache.SharedIndexInformer
 	log      logr.Logger
 	queue    workqueue.RateLimitingInterface
+	// retries tracks items requeued because they couldn't be written to the database.
+	// It is separate from the queue's rate limiter, since items are forgotten there as soon as they are fetched.
+	retries workqueue.RateLimiter
 }
 
 func NewController(
 	informer cache.SharedIndexInformer,
 	log logr.Logger,
+	features ...Feature,
 ) *Controller {
 
 	return &Controller{
+		features: NewFeatures(features...),
 		informer: informer,
 		log:      log,
 		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		retries:  workqueue.NewItemExponentialFailureRateLimiter(time.Second, 5*time.Minute),
 	}
 }
 
@@ -34,11 +48,25 @@ func (c *Controller) Announce(obj interface{}) error {
 }
 
 func (c *Controller) Stream(ctx context.Context, sink *Sink) error {
-	_, err := c.informer.AddEventHandler(NewEventHandler(c.queue, c.log.WithName("events")))
+	// Debounced updates are not reflected in the queue length,
+	// so they can't be waited for when only processing the initial list.
+	var debounce time.Duration
+	if !c.features.Once() {
+		debounce = c.features.Debounce()
+	}
+
+	registration, err := c.informer.AddEventHandlerWithResyncPeriod(
+		NewEventHandler(c.queue, debounce, c.features.Resync(), c.features.ResyncOf(), c.log.WithName("events")),
+		c.features.Resync())
 	if err != nil {
 		return err
 	}
 
+	// Remove the handler when done, as the informer outlives the controller if it's restarted.
+	defer func() { _ = c.informer.RemoveEventHandler(registration) }()
+
+	c.features.Status().Watch(c.queue)
+
 	go func() {
 		defer runtime.HandleCrash()
 
@@ -46,22 +74,57 @@ func (c *Controller) Stream(ctx context.Context, sink *Sink) error {
 		c.queue.ShutDown()
 	}()
 
-	go c.informer.Run(ctx.Done())
-
-	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+	// Unlike the informer's HasSynced, the registration's HasSynced also waits until
+	// the initial list of objects has been delivered to our event handler.
+	if !cache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
 		return errors.New("timed out waiting for caches to sync")
 	}
 
+	if onSynced := c.features.OnSynced(); onSynced != nil {
+		if err := onSynced(ctx, sink); err != nil {
+			return err
+		}
+	}
+
 	return c.stream(ctx, sink)
 }
 
+// stream processes the queued items with the configured number of workers.
+// Since all changes of an object are queued as the same item, the queue never processes them concurrently,
+// and each item is synchronized according to the latest state of its object in the informer's store.
 func (c *Controller) stream(ctx context.Context, sink *Sink) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	for i := 0; i < c.features.Workers(); i++ {
+		g.Go(func() error {
+			defer runtime.HandleCrash()
+
+			if err := c.work(ctx, sink); err != nil {
+				// Wake up the other workers waiting for items.
+				c.queue.ShutDown()
+
+				return err
+			}
+
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// work processes queued items until the queue is shut down or, with WithOnce(), empty.
+func (c *Controller) work(ctx context.Context, sink *Sink) error {
 	var eventHandlerItem interface{}
 	var key string
 	var shutdown bool
 	for {
 		c.queue.Done(eventHandlerItem)
 
+		if c.features.Once() && c.queue.Len() == 0 {
+			return nil
+		}
+
 		eventHandlerItem, shutdown = c.queue.Get()
 		if shutdown {
 			return ctx.Err()
@@ -71,7 +134,9 @@ func (c *Controller) stream(ctx context.Context, sink *Sink) error {
 
 		item, exists, err := c.informer.GetStore().GetByKey(key)
 		if err != nil {
-			if c.queue.NumRequeues(eventHandlerItem) < 5 {
+			// Rate-limited requeues are not reflected in the queue length,
+			// so they can't be waited for when only processing the initial list.
+			if !c.features.Once() && c.queue.NumRequeues(eventHandlerItem) < maxRetries {
 				c.log.Error(errors.WithStack(err), fmt.Sprintf("Fetching key %s failed. Retrying", key))
 
 				c.queue.AddRateLimited(eventHandlerItem)
@@ -88,8 +153,10 @@ func (c *Controller) stream(ctx context.Context, sink *Sink) error {
 
 		c.queue.Forget(eventHandlerItem)
 
-		if !exists || eventHandlerItem.(EventHandlerItem).Type == EventDelete {
-			if err := sink.Delete(ctx, eventHandlerItem.(EventHandlerItem).Id); err != nil {
+		id := eventHandlerItem.(EventHandlerItem).Id
+		// The key may refer to a new object with the same name if the object of the item has been deleted.
+		if !exists || schemav1.EnsureUUID(item.(kmetav1.Object).GetUID()) != id || !c.allowed(item) {
+			if err := sink.Delete(ctx, id); err != nil {
 				return err
 			}
 		} else {
@@ -102,5 +169,43 @@ func (c *Controller) stream(ctx context.Context, sink *Sink) error {
 				return err
 			}
 		}
+
+		c.features.Status().Processed(time.Now())
+	}
+}
+
+// Retry requeues the given item with exponential backoff, since it couldn't be synchronized due to err.
+// Once the item has been retried maxRetries times, it is dropped and err is logged.
+// With WithOnce(), err is returned instead, as rate-limited requeues are not reflected in the queue length
+// and therefore can't be waited for when only processing the initial list.
+func (c *Controller) Retry(item EventHandlerItem, err error) error {
+	if c.features.Once() {
+		return errors.Wrapf(err, "synchronizing %s failed", item.Id)
+	}
+
+	if c.retries.NumRequeues(item.Id) < maxRetries {
+		c.log.Error(err, "Synchronizing item failed. Retrying", "id", item.Id, "key", item.KKey)
+
+		c.queue.AddAfter(item, c.retries.When(item.Id))
+
+		return nil
 	}
+
+	c.retries.Forget(item.Id)
+	c.log.Error(err, "Synchronizing item failed. Giving up", "id", item.Id, "key", item.KKey)
+
+	return nil
+}
+
+// Forget stops tracking retries of the item with the given ID once it has been synchronized.
+func (c *Controller) Forget(id types.UUID) {
+	c.retries.Forget(id)
+}
+
+func (c *Controller) allowed(item interface{}) bool {
+	if c.features.Filter() == nil {
+		return true
+	}
+
+	return c.features.Filter()(item.(kmetav1.Object))
 }
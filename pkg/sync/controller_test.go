@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	fcache "k8s.io/client-go/tools/cache/testing"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestControllerWorkers verifies that the database reflects the final state of all objects
+// if multiple workers process adds, updates and deletes of the same objects, including objects recreated by name.
+func TestControllerWorkers(t *testing.T) {
+	const pods = 20
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := fcache.NewFakeControllerSource()
+	defer source.Shutdown()
+
+	informer := cache.NewSharedIndexInformer(source, &kcorev1.Pod{}, 0, cache.Indexers{})
+	go informer.Run(ctx.Done())
+
+	c := NewController(informer, logr.Discard(), WithWorkers(pods))
+
+	sink := NewSink(func(i *Item) interface{} {
+		return *i.Item
+	}, func(id interface{}) interface{} {
+		return id
+	})
+
+	var mu sync.Mutex
+	stored := make(map[types.UUID]string)
+
+	// The database is slow, so that multiple workers wait for it with changes of the same objects.
+	go func() {
+		for {
+			time.Sleep(100 * time.Microsecond)
+
+			select {
+			case u := <-sink.UpsertCh():
+				obj := u.(kmetav1.Object)
+				mu.Lock()
+				stored[schemav1.EnsureUUID(obj.GetUID())] = obj.GetResourceVersion()
+				mu.Unlock()
+			case id := <-sink.DeleteCh():
+				mu.Lock()
+				delete(stored, id.(types.UUID))
+				mu.Unlock()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	errs := make(chan error, 1)
+	go func() { errs <- c.Stream(ctx, sink) }()
+
+	current := make([]*kcorev1.Pod, pods)
+	for i := range current {
+		current[i] = &kcorev1.Pod{ObjectMeta: kmetav1.ObjectMeta{
+			Namespace: "default",
+			Name:      fmt.Sprintf("pod-%d", i),
+			UID:       ktypes.UID(fmt.Sprintf("uid-%d-0", i)),
+		}}
+		source.Add(current[i].DeepCopy())
+	}
+
+	// Change the objects only once they are streamed, so that the changes are watched and not just listed.
+	for {
+		mu.Lock()
+		n := len(stored)
+		mu.Unlock()
+
+		if n == pods {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	for round := 1; round <= 20; round++ {
+		for i := 0; i < pods; i++ {
+			pod := current[i]
+			if pod == nil {
+				current[i] = &kcorev1.Pod{ObjectMeta: kmetav1.ObjectMeta{
+					Namespace: "default",
+					Name:      fmt.Sprintf("pod-%d", i),
+					UID:       ktypes.UID(fmt.Sprintf("uid-%d-%d", i, round)),
+				}}
+				source.Add(current[i].DeepCopy())
+
+				continue
+			}
+
+			pod = pod.DeepCopy()
+			pod.Labels = map[string]string{"round": fmt.Sprint(round)}
+			source.Modify(pod.DeepCopy())
+			current[i] = pod
+		}
+
+		// Let the workers fetch the updated objects, which are deleted while they wait for the database.
+		time.Sleep(time.Millisecond)
+
+		for i := 0; i < pods; i++ {
+			if current[i] != nil && (i+round)%3 == 0 {
+				source.Delete(current[i].DeepCopy())
+				current[i] = nil
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	list, err := source.List(kmetav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make(map[types.UUID]string)
+	for _, item := range list.(*kcorev1.List).Items {
+		obj := item.Object.(kmetav1.Object)
+		expected[schemav1.EnsureUUID(obj.GetUID())] = obj.GetResourceVersion()
+	}
+
+	deadline := time.After(10 * time.Second)
+	for {
+		mu.Lock()
+		equal := maps.Equal(stored, expected)
+		mu.Unlock()
+
+		if equal {
+			return
+		}
+
+		select {
+		case err := <-errs:
+			t.Fatalf("streaming failed: %v", err)
+		case <-deadline:
+			mu.Lock()
+			defer mu.Unlock()
+
+			var differing int
+			for id, rv := range expected {
+				if stored[id] != rv {
+					differing++
+				}
+			}
+
+			t.Fatalf("%d of %d objects differ, %d are stored", differing, len(expected), len(stored))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
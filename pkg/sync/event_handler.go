@@ -8,15 +8,24 @@ import (
 	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	"time"
 )
 
 type EventHandler struct {
-	queue workqueue.Interface
-	log   logr.Logger
+	queue    workqueue.DelayingInterface
+	debounce time.Duration
+	resync   time.Duration
+	resyncOf func(namespace string) time.Duration
+	// resynced tracks when objects have last been added or resynced if resyncOf is set.
+	// Event handlers are called sequentially, so it isn't guarded.
+	resynced map[string]time.Time
+	log      logr.Logger
 }
 
+// EventHandlerItem identifies an object to synchronize, but not how, which is resolved from the informer's store
+// when it is processed. Therefore, all changes of an object result in the same item,
+// which the queue never processes concurrently and deduplicates while waiting.
 type EventHandlerItem struct {
-	Type EventType
 	Id   types.UUID
 	KKey string
 }
@@ -27,22 +36,88 @@ const EventAdd EventType = "ADDED"
 const EventUpdate EventType = "UPDATED"
 const EventDelete EventType = "DELETED"
 
-func NewEventHandler(queue workqueue.Interface, log logr.Logger) cache.ResourceEventHandler {
-	return &EventHandler{queue: queue, log: log}
+// NewEventHandler returns an event handler adding the keys of changed objects to queue.
+// Updates are only added after debounce, so that consecutive updates of the same object within this window,
+// e.g. status changes during startup, are coalesced into a single item, as the queue deduplicates waiting items.
+// If resyncOf is set, resyncs, which the informer delivers every resync, are only added once the interval
+// returned by resyncOf for the namespace of the object has elapsed since it has last been added or resynced.
+func NewEventHandler(
+	queue workqueue.DelayingInterface, debounce time.Duration,
+	resync time.Duration, resyncOf func(namespace string) time.Duration, log logr.Logger,
+) cache.ResourceEventHandler {
+	e := &EventHandler{queue: queue, debounce: debounce, resync: resync, resyncOf: resyncOf, log: log}
+	if resyncOf != nil {
+		e.resynced = make(map[string]time.Time)
+	}
+
+	return e
 }
 
 func (e *EventHandler) OnAdd(obj interface{}, _ bool) {
+	if e.resynced != nil {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			e.resynced[key] = time.Now()
+		}
+	}
+
 	e.enqueue(EventAdd, obj, cache.MetaNamespaceKeyFunc)
 }
 
-func (e *EventHandler) OnUpdate(_, newObj interface{}) {
+func (e *EventHandler) OnUpdate(oldObj, newObj interface{}) {
+	// Objects from the warmup have been read from the database, which then already contains
+	// the initially listed version if its resource version is unchanged.
+	// Skip them, so that restarts don't rewrite all unchanged objects.
+	// The objects are still listed, as watches can't be resumed from the stored resource versions:
+	// the informer's store must contain complete objects for the other handlers.
+	if old, ok := oldObj.(schemav1.Resource); ok {
+		if n, ok := newObj.(kmetav1.Object); ok && n.GetResourceVersion() == old.GetResourceVersion() {
+			return
+		}
+	}
+
+	if o, ok := oldObj.(kmetav1.Object); ok && e.resynced != nil {
+		if n, ok := newObj.(kmetav1.Object); ok && n.GetResourceVersion() == o.GetResourceVersion() && !e.due(n) {
+			return
+		}
+	}
+
 	e.enqueue(EventUpdate, newObj, cache.MetaNamespaceKeyFunc)
 }
 
 func (e *EventHandler) OnDelete(obj interface{}) {
+	if e.resynced != nil {
+		if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+			delete(e.resynced, key)
+		}
+	}
+
 	e.enqueue(EventDelete, obj, cache.DeletionHandlingMetaNamespaceKeyFunc)
 }
 
+// due returns whether the resync of the given object is due and, if so, records it as resynced.
+// Resyncs are delivered every resync, so they are considered due half of it early,
+// as the elapsed time varies slightly.
+func (e *EventHandler) due(obj kmetav1.Object) bool {
+	interval := e.resyncOf(obj.GetNamespace())
+	if interval <= 0 {
+		return false
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return true
+	}
+
+	now := time.Now()
+	if last, ok := e.resynced[key]; ok && now.Sub(last)+e.resync/2 < interval {
+		return false
+	}
+
+	e.resynced[key] = now
+
+	return true
+}
+
 func (e *EventHandler) enqueue(_type EventType, obj interface{}, keyFunc cache.KeyFunc) {
 	key, err := keyFunc(obj)
 	if err != nil {
@@ -61,9 +136,14 @@ func (e *EventHandler) enqueue(_type EventType, obj interface{}, keyFunc cache.K
 		panic(fmt.Sprintf("unknown object type %#v", v))
 	}
 
-	e.queue.Add(EventHandlerItem{
-		Type: _type,
+	item := EventHandlerItem{
 		Id:   id,
 		KKey: key,
-	})
+	}
+
+	if _type == EventUpdate && e.debounce > 0 {
+		e.queue.AddAfter(item, e.debounce)
+	} else {
+		e.queue.Add(item)
+	}
 }
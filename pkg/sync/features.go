@@ -1,14 +1,30 @@
 package sync
 
-import "github.com/icinga/icinga-kubernetes/pkg/com"
+import (
+	"context"
+	"github.com/icinga/icinga-kubernetes/pkg/com"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
 
 type Feature func(*Features)
 
 type Features struct {
+	debounce time.Duration
+	filter   func(kmetav1.Object) bool
 	noDelete bool
 	noWarmup bool
+	once     bool
+	resync   time.Duration
+	// resyncOf returns the resync interval of objects of the given namespace.
+	resyncOf func(namespace string) time.Duration
 	onDelete com.ProcessBulk[any]
+	onSynced func(context.Context, *Sink) error
 	onUpsert com.ProcessBulk[any]
+	status   *Status
+	workers  int
+	// relationWorkers is the number of relations upserted concurrently.
+	relationWorkers int
 }
 
 func NewFeatures(features ...Feature) *Features {
@@ -20,6 +36,14 @@ func NewFeatures(features ...Feature) *Features {
 	return f
 }
 
+func (f *Features) Debounce() time.Duration {
+	return f.debounce
+}
+
+func (f *Features) Filter() func(kmetav1.Object) bool {
+	return f.filter
+}
+
 func (f *Features) NoDelete() bool {
 	return f.noDelete
 }
@@ -28,14 +52,60 @@ func (f *Features) NoWarmup() bool {
 	return f.noWarmup
 }
 
+func (f *Features) Once() bool {
+	return f.once
+}
+
 func (f *Features) OnDelete() com.ProcessBulk[any] {
 	return f.onDelete
 }
 
+func (f *Features) OnSynced() func(context.Context, *Sink) error {
+	return f.onSynced
+}
+
 func (f *Features) OnUpsert() com.ProcessBulk[any] {
 	return f.onUpsert
 }
 
+func (f *Features) Resync() time.Duration {
+	return f.resync
+}
+
+// ResyncOf returns the function returning the resync interval of objects of a namespace, if set.
+func (f *Features) ResyncOf() func(namespace string) time.Duration {
+	return f.resyncOf
+}
+
+func (f *Features) Status() *Status {
+	return f.status
+}
+
+// Workers returns the number of items processed concurrently, at least 1.
+func (f *Features) Workers() int {
+	return max(f.workers, 1)
+}
+
+// RelationWorkers returns the number of relations, e.g. labels, upserted concurrently, at least 1.
+func (f *Features) RelationWorkers() int {
+	return max(f.relationWorkers, 1)
+}
+
+// WithDebounce coalesces updates of the same object within d into a single database write.
+func WithDebounce(d time.Duration) Feature {
+	return func(f *Features) {
+		f.debounce = d
+	}
+}
+
+// WithFilter only synchronizes objects for which fn returns true.
+// Objects that are filtered out are deleted from the database.
+func WithFilter(fn func(kmetav1.Object) bool) Feature {
+	return func(f *Features) {
+		f.filter = fn
+	}
+}
+
 func WithNoDelete() Feature {
 	return func(f *Features) {
 		f.noDelete = true
@@ -48,14 +118,87 @@ func WithNoWarumup() Feature {
 	}
 }
 
+// WithOnce stops synchronization as soon as the initial list of objects has been processed.
+func WithOnce() Feature {
+	return func(f *Features) {
+		f.once = true
+	}
+}
+
+// WithOnDelete calls fn with the IDs of deleted objects.
+// If used multiple times, all functions are called in the given order.
 func WithOnDelete(fn com.ProcessBulk[any]) Feature {
 	return func(f *Features) {
-		f.onDelete = fn
+		f.onDelete = chain(f.onDelete, fn)
 	}
 }
 
+// WithOnSynced calls fn once the initial list of objects has been delivered, before it is processed,
+// e.g. to delete objects that disappeared while not running via the given sink.
+func WithOnSynced(fn func(ctx context.Context, sink *Sink) error) Feature {
+	return func(f *Features) {
+		f.onSynced = fn
+	}
+}
+
+// WithOnUpsert calls fn with the upserted objects.
+// If used multiple times, all functions are called in the given order.
 func WithOnUpsert(fn com.ProcessBulk[any]) Feature {
 	return func(f *Features) {
-		f.onUpsert = fn
+		f.onUpsert = chain(f.onUpsert, fn)
+	}
+}
+
+// WithResync synchronizes all cached objects again every d. Zero disables resyncs.
+// The informer must check for due resyncs at least every d, which is configured via its factory.
+func WithResync(d time.Duration) Feature {
+	return func(f *Features) {
+		f.resync = d
+	}
+}
+
+// WithResyncOf resyncs objects in the interval returned by fn for their namespace, e.g. to override it per namespace.
+// Zero disables resyncs of the namespace. Due resyncs are still checked in the interval set with WithResync,
+// which must therefore not be longer than any interval returned by fn.
+func WithResyncOf(fn func(namespace string) time.Duration) Feature {
+	return func(f *Features) {
+		f.resyncOf = fn
+	}
+}
+
+// WithStatus records successful database writes and errors in status.
+func WithStatus(status *Status) Feature {
+	return func(f *Features) {
+		f.status = status
+	}
+}
+
+// WithWorkers processes up to n items concurrently instead of one after another,
+// so that bursts of changes, e.g. while draining a node, don't delay synchronization.
+func WithWorkers(n int) Feature {
+	return func(f *Features) {
+		f.workers = n
+	}
+}
+
+// WithRelationWorkers upserts the relations of up to n objects, e.g. their labels, concurrently
+// once the objects themselves have been written.
+func WithRelationWorkers(n int) Feature {
+	return func(f *Features) {
+		f.relationWorkers = n
+	}
+}
+
+func chain(first, second com.ProcessBulk[any]) com.ProcessBulk[any] {
+	if first == nil {
+		return second
+	}
+
+	return func(ctx context.Context, bulk []any) error {
+		if err := first(ctx, bulk); err != nil {
+			return err
+		}
+
+		return second(ctx, bulk)
 	}
 }
@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"github.com/pkg/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfields "k8s.io/apimachinery/pkg/fields"
+	"slices"
+)
+
+// NamespacesConfig defines which namespaces are synchronized.
+// If Include is set, only the listed namespaces are synchronized.
+// Otherwise, all namespaces except the ones listed in Exclude are synchronized.
+type NamespacesConfig struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Validate checks constraints in the supplied namespaces configuration and returns an error if they are violated.
+func (c *NamespacesConfig) Validate() error {
+	if len(c.Include) > 0 && len(c.Exclude) > 0 {
+		return errors.New("namespaces include and exclude are mutually exclusive")
+	}
+
+	for _, namespace := range append(c.Include, c.Exclude...) {
+		if namespace == "" {
+			return errors.New("namespace names must not be empty")
+		}
+	}
+
+	return nil
+}
+
+// Allowed returns whether the given namespace is to be synchronized.
+func (c *NamespacesConfig) Allowed(namespace string) bool {
+	if len(c.Include) > 0 {
+		return slices.Contains(c.Include, namespace)
+	}
+
+	return !slices.Contains(c.Exclude, namespace)
+}
+
+// Filter returns whether the given object lives in a namespace that is to be synchronized.
+// Cluster-scoped objects are always allowed.
+func (c *NamespacesConfig) Filter(obj kmetav1.Object) bool {
+	if obj.GetNamespace() == "" {
+		return true
+	}
+
+	return c.Allowed(obj.GetNamespace())
+}
+
+// FilterNamespace returns whether the given namespace object is to be synchronized.
+func (c *NamespacesConfig) FilterNamespace(obj kmetav1.Object) bool {
+	return c.Allowed(obj.GetName())
+}
+
+// TweakListOptions restricts list and watch requests for namespaced resources to the configured namespaces.
+// Field selectors can't express a set of namespaces, so multiple includes are filtered by the controllers instead.
+func (c *NamespacesConfig) TweakListOptions(options *kmetav1.ListOptions) {
+	c.tweakListOptions("metadata.namespace", options)
+}
+
+// TweakNamespaceListOptions restricts list and watch requests for namespaces to the configured namespaces.
+func (c *NamespacesConfig) TweakNamespaceListOptions(options *kmetav1.ListOptions) {
+	c.tweakListOptions("metadata.name", options)
+}
+
+func (c *NamespacesConfig) tweakListOptions(field string, options *kmetav1.ListOptions) {
+	var selectors []kfields.Selector
+
+	if len(c.Include) == 1 {
+		selectors = append(selectors, kfields.OneTermEqualSelector(field, c.Include[0]))
+	}
+
+	for _, namespace := range c.Exclude {
+		selectors = append(selectors, kfields.OneTermNotEqualSelector(field, namespace))
+	}
+
+	if len(selectors) == 0 {
+		return
+	}
+
+	if options.FieldSelector != "" {
+		if selector, err := kfields.ParseSelector(options.FieldSelector); err == nil {
+			selectors = append(selectors, selector)
+		}
+	}
+
+	options.FieldSelector = kfields.AndSelectors(selectors...).String()
+}
@@ -28,6 +28,13 @@ func NewSink(upsertFunc func(*Item) interface{}, deleteFunc func(interface{}) in
 	}
 }
 
+// Close closes all channels of the sink. Must only be called once no more items are sent.
+func (s *Sink) Close() {
+	close(s.error)
+	close(s.delete)
+	close(s.upsert)
+}
+
 func (s *Sink) Delete(ctx context.Context, key interface{}) error {
 	select {
 	case s.delete <- s.deleteFunc(key):
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"github.com/icinga/icinga-kubernetes/pkg/com"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status tracks the time of the last successful database write, the time of the last processed event,
+// the queue depth and the number of errors of a controller.
+// All methods are no-ops on a nil Status.
+type Status struct {
+	lastSync  atomic.Int64
+	lastEvent atomic.Int64
+	errors    com.Counter
+
+	mu    sync.Mutex
+	queue interface{ Len() int }
+}
+
+// Synced records a successful database write at the given time.
+func (s *Status) Synced(t time.Time) {
+	if s != nil {
+		s.lastSync.Store(t.UnixMilli())
+	}
+}
+
+// Processed records that an event has been processed at the given time.
+func (s *Status) Processed(t time.Time) {
+	if s != nil {
+		s.lastEvent.Store(t.UnixMilli())
+	}
+}
+
+// Watch reports the length of queue as queue depth, replacing any previously watched queue.
+func (s *Status) Watch(queue interface{ Len() int }) {
+	if s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.queue = queue
+	}
+}
+
+// Error records an error.
+func (s *Status) Error() {
+	if s != nil {
+		s.errors.Inc()
+	}
+}
+
+// LastSync returns the time of the last successful database write or the zero time if there hasn't been any.
+func (s *Status) LastSync() time.Time {
+	if s == nil || s.lastSync.Load() == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(s.lastSync.Load())
+}
+
+// LastEvent returns the time of the last processed event or the zero time if there hasn't been any.
+func (s *Status) LastEvent() time.Time {
+	if s == nil || s.lastEvent.Load() == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(s.lastEvent.Load())
+}
+
+// QueueDepth returns the number of events waiting to be processed.
+func (s *Status) QueueDepth() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.queue == nil {
+		return 0
+	}
+
+	return s.queue.Len()
+}
+
+// Errors returns the number of errors.
+func (s *Status) Errors() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.errors.Val()
+}
+
+// Statuses holds the Status of multiple controllers by name.
+type Statuses struct {
+	mu       sync.Mutex
+	statuses map[string]*Status
+}
+
+// Get returns the Status of the controller with the given name and creates it if it doesn't exist.
+func (s *Statuses) Get(name string) *Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.statuses == nil {
+		s.statuses = make(map[string]*Status)
+	}
+
+	status, ok := s.statuses[name]
+	if !ok {
+		status = &Status{}
+		s.statuses[name] = status
+	}
+
+	return status
+}
+
+// All returns a copy of all statuses by controller name.
+func (s *Statuses) All() map[string]*Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make(map[string]*Status, len(s.statuses))
+	for name, status := range s.statuses {
+		all[name] = status
+	}
+
+	return all
+}
@@ -2,60 +2,149 @@ package v1
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
 	"github.com/icinga/icinga-kubernetes/pkg/com"
 	"github.com/icinga/icinga-kubernetes/pkg/database"
 	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
 	"github.com/icinga/icinga-kubernetes/pkg/sync"
 	"golang.org/x/sync/errgroup"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
+	"slices"
+	"time"
 )
 
 type Sync struct {
-	db       *database.Database
-	informer cache.SharedIndexInformer
-	log      logr.Logger
-	factory  func() schemav1.Resource
+	db          *database.Database
+	clusterUuid types.UUID
+	informer    cache.SharedIndexInformer
+	log         logr.Logger
+	factory     func() schemav1.Resource
 }
 
 func NewSync(
 	db *database.Database,
+	clusterUuid types.UUID,
 	informer cache.SharedIndexInformer,
 	log logr.Logger,
 	factory func() schemav1.Resource,
 ) *Sync {
 	return &Sync{
-		db:       db,
-		informer: informer,
-		log:      log,
-		factory:  factory,
+		db:          db,
+		clusterUuid: clusterUuid,
+		informer:    informer,
+		log:         log,
+		factory:     factory,
 	}
 }
 
 func (s *Sync) Run(ctx context.Context, features ...sync.Feature) error {
-	controller := sync.NewController(s.informer, s.log.WithName("controller"))
-
 	with := sync.NewFeatures(features...)
 
-	if !with.NoWarmup() {
-		if err := s.warmup(ctx, controller); err != nil {
+	// stored holds the UUIDs of the objects in the database, as loaded during warmup.
+	var stored []types.UUID
+	if !with.NoDelete() {
+		features = append(slices.Clip(features), sync.WithOnSynced(s.reconcile(&stored)))
+	}
+
+	controller := sync.NewController(s.informer, s.log.WithName("controller"), features...)
+
+	// If the sync is restarted after an error, the informer is already running and
+	// its store must not be overwritten with the placeholders from warmup.
+	if !with.NoWarmup() && !s.informer.HasSynced() {
+		var err error
+		if stored, err = s.warmup(ctx, controller); err != nil {
 			return err
 		}
 	}
 
+	// The informer isn't started by its factory, since warmup has to populate its store before the initial list,
+	// so that objects deleted in the meantime are detected. Running an already running informer is a no-op.
+	// It is run with the context of Run, so that it keeps running if the sync fails and is restarted.
+	go s.informer.Run(ctx.Done())
+
 	return s.sync(ctx, controller, features...)
 }
 
-func (s *Sync) warmup(ctx context.Context, c *sync.Controller) error {
+// warmupPageSize is the number of rows loaded per query during warmup.
+const warmupPageSize = 1000
+
+// warmup announces the objects of our cluster stored in the database to the controller,
+// so that objects deleted while not running are detected, and returns their UUIDs. Rows are loaded in pages
+// ordered by UUID instead of in a single query, so that no long-running query is kept open while the store is populated.
+func (s *Sync) warmup(ctx context.Context, c *sync.Controller) ([]types.UUID, error) {
+	// Only warm up the objects of our cluster, as the database may be shared with other clusters.
+	query := fmt.Sprintf(
+		"%s WHERE cluster_uuid=:cluster_uuid AND uuid > :after ORDER BY uuid LIMIT %d",
+		s.db.BuildSelectStmt(s.factory(), &schemav1.Meta{}), warmupPageSize)
+	scope := struct {
+		ClusterUuid types.UUID
+		After       types.UUID
+	}{ClusterUuid: s.clusterUuid}
+
+	var stored []types.UUID
+	for {
+		rows, err := s.warmupPage(ctx, c, query, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, rows...)
+
+		if len(rows) < warmupPageSize {
+			return stored, nil
+		}
+
+		scope.After = rows[len(rows)-1]
+	}
+}
+
+// reconcile returns a function that deletes the objects in stored that don't exist anymore
+// once the initial list of objects has been delivered. Most objects deleted while not running are already
+// detected via warmup, but not those recreated with the same name in the meantime, e.g. pods of stateful sets,
+// since the informer identifies objects by their name.
+func (s *Sync) reconcile(stored *[]types.UUID) func(context.Context, *sync.Sink) error {
+	return func(ctx context.Context, sink *sync.Sink) error {
+		live := make(map[types.UUID]struct{})
+		for _, obj := range s.informer.GetStore().List() {
+			if o, ok := obj.(kmetav1.Object); ok {
+				live[schemav1.EnsureUUID(o.GetUID())] = struct{}{}
+			}
+		}
+
+		var deleted int
+		for _, id := range *stored {
+			if _, ok := live[id]; !ok {
+				if err := sink.Delete(ctx, id); err != nil {
+					return err
+				}
+
+				deleted++
+			}
+		}
+
+		if deleted > 0 {
+			s.log.Info("Deleting objects that disappeared while not running", "count", deleted)
+		}
+
+		return nil
+	}
+}
+
+// warmupPage announces the objects of a single page and returns their UUIDs.
+func (s *Sync) warmupPage(ctx context.Context, c *sync.Controller, query string, scope any) ([]types.UUID, error) {
 	g, ctx := errgroup.WithContext(ctx)
 
 	entities, errs := s.db.YieldAll(ctx, func() (interface{}, error) {
 		return s.factory(), nil
-	}, s.db.BuildSelectStmt(s.factory(), &schemav1.Meta{}))
+	}, query, scope)
 	// Let errors from YieldAll() cancel the group.
 	com.ErrgroupReceive(ctx, g, errs)
 
+	uuids := make([]types.UUID, 0, warmupPageSize)
 	g.Go(func() error {
 		defer runtime.HandleCrash()
 
@@ -69,19 +158,21 @@ func (s *Sync) warmup(ctx context.Context, c *sync.Controller) error {
 				if err := c.Announce(e); err != nil {
 					return err
 				}
+
+				uuids = append(uuids, schemav1.EnsureUUID(e.(schemav1.Resource).GetUID()))
 			case <-ctx.Done():
 				return ctx.Err()
 			}
 		}
 	})
 
-	return g.Wait()
+	return uuids, g.Wait()
 }
 
 func (s *Sync) sync(ctx context.Context, c *sync.Controller, features ...sync.Feature) error {
 	sink := sync.NewSink(func(i *sync.Item) interface{} {
 		entity := s.factory()
-		entity.Obtain(*i.Item)
+		entity.Obtain(*i.Item, s.clusterUuid)
 
 		return entity
 	}, func(k interface{}) interface{} {
@@ -93,6 +184,8 @@ func (s *Sync) sync(ctx context.Context, c *sync.Controller, features ...sync.Fe
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error {
 		defer runtime.HandleCrash()
+		// Let the consumers below finish once all items have been streamed, e.g. in WithOnce() mode.
+		defer sink.Close()
 
 		return c.Stream(ctx, sink)
 	})
@@ -101,7 +194,14 @@ func (s *Sync) sync(ctx context.Context, c *sync.Controller, features ...sync.Fe
 
 		return s.db.UpsertStreamed(
 			ctx, sink.UpsertCh(),
-			database.WithCascading(), database.WithOnSuccess(with.OnUpsert()))
+			database.WithCascading(),
+			database.WithRelationWorkers(with.RelationWorkers()),
+			database.WithOnSuccess(forget(c, with.Status(), with.OnUpsert(), upsertedId)),
+			database.WithOnError(retry(c, with.Status(), func(entity any) sync.EventHandlerItem {
+				key, _ := cache.MetaNamespaceKeyFunc(entity)
+
+				return sync.EventHandlerItem{Id: upsertedId(entity), KKey: key}
+			})))
 	})
 	g.Go(func() error {
 		defer runtime.HandleCrash()
@@ -119,9 +219,16 @@ func (s *Sync) sync(ctx context.Context, c *sync.Controller, features ...sync.Fe
 
 			}
 		} else {
+			// The key of deleted objects is unknown, but not required,
+			// as retried items which aren't in the informer's store are deleted again.
 			return s.db.DeleteStreamed(
 				ctx, s.factory(), sink.DeleteCh(),
-				database.WithBlocking(), database.WithCascading(), database.WithOnSuccess(with.OnDelete()))
+				database.WithBlocking(),
+				database.WithCascading(),
+				database.WithOnSuccess(forget(c, with.Status(), with.OnDelete(), deletedId)),
+				database.WithOnError(retry(c, with.Status(), func(id any) sync.EventHandlerItem {
+					return sync.EventHandlerItem{Id: deletedId(id)}
+				})))
 		}
 	})
 	g.Go(func() error {
@@ -134,6 +241,11 @@ func (s *Sync) sync(ctx context.Context, c *sync.Controller, features ...sync.Fe
 					return nil
 				}
 
+				if with.Once() {
+					return err
+				}
+
+				with.Status().Error()
 				s.log.Error(err, "sync error")
 			case <-ctx.Done():
 				return ctx.Err()
@@ -144,3 +256,49 @@ func (s *Sync) sync(ctx context.Context, c *sync.Controller, features ...sync.Fe
 
 	return g.Wait()
 }
+
+// forget returns a com.ProcessBulk that stops tracking retries of successfully synchronized items
+// and records the write in status before passing them to onSuccess, if set. id returns the ID of an item.
+func forget(
+	c *sync.Controller, status *sync.Status, onSuccess com.ProcessBulk[any], id func(any) types.UUID,
+) com.ProcessBulk[any] {
+	return func(ctx context.Context, bulk []any) error {
+		status.Synced(time.Now())
+
+		for _, item := range bulk {
+			c.Forget(id(item))
+		}
+
+		if onSuccess != nil {
+			return onSuccess(ctx, bulk)
+		}
+
+		return nil
+	}
+}
+
+// retry returns a database.WithOnError callback that records the error in status
+// and requeues all items of the failed bulk via c.Retry.
+func retry(
+	c *sync.Controller, status *sync.Status, item func(any) sync.EventHandlerItem,
+) func(context.Context, []any, error) error {
+	return func(_ context.Context, bulk []any, err error) error {
+		status.Error()
+
+		for _, i := range bulk {
+			if err := c.Retry(item(i), err); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func upsertedId(entity any) types.UUID {
+	return schemav1.EnsureUUID(entity.(kmetav1.Object).GetUID())
+}
+
+func deletedId(id any) types.UUID {
+	return id.(types.UUID)
+}
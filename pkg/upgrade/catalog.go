@@ -0,0 +1,58 @@
+package upgrade
+
+// RemovedApi is a version of a built-in resource that is removed from the API server in a minor version.
+type RemovedApi struct {
+	Group    string
+	Version  string
+	Resource string
+	// RemovedIn is the minor version the API is removed in, e.g. 1.25.
+	RemovedIn string
+	// Replacement is the group and version to migrate to, empty if the resource is removed entirely.
+	Replacement string
+}
+
+// ApiVersion returns the group and version as in the apiVersion field of objects, e.g. batch/v1beta1.
+func (a RemovedApi) ApiVersion() string {
+	if a.Group == "" {
+		return a.Version
+	}
+
+	return a.Group + "/" + a.Version
+}
+
+// Catalog lists the persisted resources whose API versions have been removed since Kubernetes 1.22,
+// as documented in the deprecated API migration guide.
+var Catalog = []RemovedApi{
+	{"admissionregistration.k8s.io", "v1beta1", "mutatingwebhookconfigurations", "1.22", "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io", "v1beta1", "validatingwebhookconfigurations", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiextensions.k8s.io", "v1beta1", "customresourcedefinitions", "1.22", "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io", "v1beta1", "apiservices", "1.22", "apiregistration.k8s.io/v1"},
+	{"certificates.k8s.io", "v1beta1", "certificatesigningrequests", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io", "v1beta1", "leases", "1.22", "coordination.k8s.io/v1"},
+	{"extensions", "v1beta1", "ingresses", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io", "v1beta1", "ingresses", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io", "v1beta1", "ingressclasses", "1.22", "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io", "v1beta1", "clusterroles", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io", "v1beta1", "clusterrolebindings", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io", "v1beta1", "roles", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io", "v1beta1", "rolebindings", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io", "v1beta1", "priorityclasses", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io", "v1beta1", "csidrivers", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io", "v1beta1", "csinodes", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io", "v1beta1", "storageclasses", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io", "v1beta1", "volumeattachments", "1.22", "storage.k8s.io/v1"},
+	{"batch", "v1beta1", "cronjobs", "1.25", "batch/v1"},
+	{"discovery.k8s.io", "v1beta1", "endpointslices", "1.25", "discovery.k8s.io/v1"},
+	{"autoscaling", "v2beta1", "horizontalpodautoscalers", "1.25", "autoscaling/v2"},
+	{"policy", "v1beta1", "poddisruptionbudgets", "1.25", "policy/v1"},
+	{"policy", "v1beta1", "podsecuritypolicies", "1.25", ""},
+	{"node.k8s.io", "v1beta1", "runtimeclasses", "1.25", "node.k8s.io/v1"},
+	{"autoscaling", "v2beta2", "horizontalpodautoscalers", "1.26", "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io", "v1beta1", "flowschemas", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io", "v1beta1", "prioritylevelconfigurations", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io", "v1beta1", "csistoragecapacities", "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io", "v1beta2", "flowschemas", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io", "v1beta2", "prioritylevelconfigurations", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io", "v1beta3", "flowschemas", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io", "v1beta3", "prioritylevelconfigurations", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+}
@@ -0,0 +1,404 @@
+// Package upgrade reports whether a cluster can be upgraded to upcoming Kubernetes versions
+// without clients or manifests breaking due to the removal of deprecated APIs.
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/expfmt"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"slices"
+	"strings"
+	"time"
+)
+
+// interval is the interval in which readiness is checked.
+const interval = time.Hour
+
+// deprecatedApisMetric is the API server metric that tracks requests to deprecated APIs since its start.
+const deprecatedApisMetric = "apiserver_requested_deprecated_apis"
+
+// Checker checks the upgrade readiness of a cluster and stores a report for each minor version
+// from the next one up to the last one of the Catalog in the upgrade_readiness
+// and upgrade_readiness_issue tables, replacing the previous ones.
+// Issues are found in three ways:
+//   - Objects whose managed fields show that they were last written via a removed API version,
+//     e.g. by applying outdated manifests.
+//   - Requests to removed API versions that the API server counts in its apiserver_requested_deprecated_apis metric,
+//     which requires permission to get the /metrics endpoint. Requests are not attributed to objects.
+//   - Requests of Icinga for Kubernetes itself to removed API versions that the API server warned about
+//     in the last 24 hours, as captured by Warnings.
+type Checker struct {
+	clientset   kubernetes.Interface
+	metadata    metadata.Interface
+	db          *database.Database
+	clusterUuid types.UUID
+	namespaces  *sync.NamespacesConfig
+	log         logr.Logger
+	forbidden   bool
+}
+
+// NewChecker creates a new Checker for the cluster with the given UUID.
+// Objects of namespaces that are not synchronized are not checked.
+func NewChecker(
+	clientset kubernetes.Interface,
+	metadataClient metadata.Interface,
+	db *database.Database,
+	clusterUuid types.UUID,
+	namespaces *sync.NamespacesConfig,
+	log logr.Logger,
+) *Checker {
+	return &Checker{
+		clientset:   clientset,
+		metadata:    metadataClient,
+		db:          db,
+		clusterUuid: clusterUuid,
+		namespaces:  namespaces,
+		log:         log,
+	}
+}
+
+// Run checks the upgrade readiness every hour until ctx is canceled.
+func (c *Checker) Run(ctx context.Context) error {
+	for {
+		if err := c.Check(ctx, time.Now()); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// issue is a usage of a removed API, not yet assigned to target versions.
+type issue struct {
+	api       RemovedApi
+	source    string
+	resource  string
+	namespace string
+	name      string
+	manager   string
+}
+
+// Check checks the upgrade readiness of the cluster and stores the reports at the given time.
+func (c *Checker) Check(ctx context.Context, now time.Time) error {
+	info, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return errors.Wrap(err, "can't get Kubernetes version")
+	}
+
+	current, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return errors.Wrapf(err, "can't parse Kubernetes version %q", info.GitVersion)
+	}
+
+	c.log.V(1).Info("Checking upgrade readiness", "version", info.GitVersion)
+
+	objects, err := c.objectIssues(ctx, current)
+	if err != nil {
+		return err
+	}
+
+	requests, err := c.requestIssues(ctx, current)
+	if err != nil {
+		return err
+	}
+
+	warnings, err := c.warningIssues(ctx, current, now)
+	if err != nil {
+		return err
+	}
+
+	// Objects may have been written via the same removed API by multiple managers, of which the first is reported,
+	// and the API server counts requests to subresources separately.
+	var issues []issue
+	seen := make(map[issue]struct{})
+	for _, i := range slices.Concat(objects, requests, warnings) {
+		key := i
+		key.manager = ""
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			issues = append(issues, i)
+		}
+	}
+
+	last := current.Minor() + 1
+	for _, api := range Catalog {
+		last = max(last, version.MustParseGeneric(api.RemovedIn).Minor())
+	}
+	// APIs the API server announced the removal of may not be in the Catalog yet.
+	for _, i := range issues {
+		last = max(last, version.MustParseGeneric(i.api.RemovedIn).Minor())
+	}
+
+	reports := make(chan interface{}, last-current.Minor())
+	var entities []interface{}
+	for minor := current.Minor() + 1; minor <= last; minor++ {
+		target := version.MajorMinor(current.Major(), minor)
+		report := &schemav1.UpgradeReadiness{
+			ClusterUuid:    c.clusterUuid,
+			TargetVersion:  target.String(),
+			CurrentVersion: info.GitVersion,
+			Computed:       types.UnixMilli(now),
+		}
+
+		for _, i := range issues {
+			if target.LessThan(version.MustParseGeneric(i.api.RemovedIn)) {
+				continue
+			}
+
+			report.Issues++
+			entities = append(entities, &schemav1.UpgradeReadinessIssue{
+				ClusterUuid:   c.clusterUuid,
+				TargetVersion: report.TargetVersion,
+				Source:        i.source,
+				ApiVersion:    i.api.ApiVersion(),
+				Resource:      i.resource,
+				Namespace:     i.namespace,
+				Name:          i.name,
+				Manager:       schemav1.NewNullableString(i.manager),
+				RemovedIn:     i.api.RemovedIn,
+				Replacement:   schemav1.NewNullableString(i.api.Replacement),
+				Computed:      types.UnixMilli(now),
+			})
+		}
+
+		report.Ready = types.Bool{Bool: report.Issues == 0, Valid: true}
+		reports <- report
+	}
+	close(reports)
+
+	issueEntities := make(chan interface{}, len(entities))
+	for _, e := range entities {
+		issueEntities <- e
+	}
+	close(issueEntities)
+
+	if err := c.db.UpsertStreamed(ctx, issueEntities); err != nil {
+		return errors.Wrap(err, "can't store upgrade readiness issues")
+	}
+
+	if err := c.db.UpsertStreamed(ctx, reports); err != nil {
+		return errors.Wrap(err, "can't store upgrade readiness reports")
+	}
+
+	// Issues that have been resolved and reports of versions that have been reached are removed.
+	for _, table := range []string{"upgrade_readiness_issue", "upgrade_readiness"} {
+		if _, err := c.db.ExecContext(ctx, c.db.Rebind(
+			"DELETE FROM "+table+" WHERE cluster_uuid = ? AND computed < ?"), c.clusterUuid, now.UnixMilli(),
+		); err != nil {
+			return errors.Wrapf(err, "can't delete outdated %s", table)
+		}
+	}
+
+	return nil
+}
+
+// objectIssues returns the objects that were last written via an API version
+// that is removed after the current version.
+func (c *Checker) objectIssues(ctx context.Context, current *version.Version) ([]issue, error) {
+	// Objects are listed via the preferred version of their resource, as the removed ones may not be served anymore.
+	preferred, err := discovery.ServerPreferredResources(c.clientset.Discovery())
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, errors.Wrap(err, "can't discover API resources")
+	}
+
+	served := make(map[schema.GroupResource]schema.GroupVersionResource)
+	namespaced := make(map[schema.GroupResource]bool)
+	for _, list := range preferred {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, r := range list.APIResources {
+			gr := schema.GroupResource{Group: gv.Group, Resource: r.Name}
+			served[gr] = gv.WithResource(r.Name)
+			namespaced[gr] = r.Namespaced
+		}
+	}
+
+	removed := make(map[schema.GroupResource][]RemovedApi)
+	for _, api := range Catalog {
+		if !current.LessThan(version.MustParseGeneric(api.RemovedIn)) {
+			continue
+		}
+
+		// Objects are served in the group of the replacement, e.g. ingresses written via extensions/v1beta1.
+		gr := schema.GroupResource{Group: api.Group, Resource: api.Resource}
+		if gv, err := schema.ParseGroupVersion(api.Replacement); err == nil && api.Replacement != "" {
+			gr.Group = gv.Group
+		}
+
+		removed[gr] = append(removed[gr], api)
+	}
+
+	var issues []issue
+	for gr, apis := range removed {
+		gvr, ok := served[gr]
+		if !ok {
+			continue
+		}
+
+		filter := c.namespaces.Filter
+		if !namespaced[gr] {
+			filter = func(kmetav1.Object) bool { return true }
+		}
+
+		options := kmetav1.ListOptions{Limit: 500}
+		for {
+			l, err := c.metadata.Resource(gvr).List(ctx, options)
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't list %s", gr)
+			}
+
+			for i := range l.Items {
+				if !filter(&l.Items[i]) {
+					continue
+				}
+
+				for _, f := range l.Items[i].ManagedFields {
+					for _, api := range apis {
+						if f.APIVersion == api.ApiVersion() {
+							issues = append(issues, issue{
+								api:       api,
+								source:    schemav1.UpgradeIssueSourceObject,
+								resource:  gr.Resource,
+								namespace: l.Items[i].Namespace,
+								name:      l.Items[i].Name,
+								manager:   f.Manager,
+							})
+						}
+					}
+				}
+			}
+
+			if options.Continue = l.Continue; options.Continue == "" {
+				break
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// requestIssues returns the requests to API versions that are removed after the current version
+// since the API server started, or nothing if its metrics can't be read.
+func (c *Checker) requestIssues(ctx context.Context, current *version.Version) ([]issue, error) {
+	raw, err := c.clientset.Discovery().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		if kerrors.IsForbidden(err) {
+			if !c.forbidden {
+				c.log.Info("Not permitted to get API server metrics. Requests to removed APIs are not reported")
+				c.forbidden = true
+			}
+
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "can't get API server metrics")
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse API server metrics")
+	}
+
+	family, ok := families[deprecatedApisMetric]
+	if !ok {
+		return nil, nil
+	}
+
+	var issues []issue
+	for _, m := range family.GetMetric() {
+		labels := make(map[string]string)
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+
+		// Deprecated APIs without scheduled removal don't affect upgrades.
+		removedIn, err := version.ParseGeneric(labels["removed_release"])
+		if err != nil || !current.LessThan(removedIn) {
+			continue
+		}
+
+		api := RemovedApi{
+			Group:     labels["group"],
+			Version:   labels["version"],
+			Resource:  labels["resource"],
+			RemovedIn: version.MajorMinor(removedIn.Major(), removedIn.Minor()).String(),
+		}
+		for _, known := range Catalog {
+			if known.Group == api.Group && known.Version == api.Version && known.Resource == api.Resource {
+				api.Replacement = known.Replacement
+			}
+		}
+
+		issues = append(issues, issue{
+			api:      api,
+			source:   schemav1.UpgradeIssueSourceRequest,
+			resource: api.Resource,
+		})
+	}
+
+	return issues, nil
+}
+
+// warningIssues returns the requests to API versions that are removed after the current version
+// that the API server warned about within the warning window before the given time.
+func (c *Checker) warningIssues(ctx context.Context, current *version.Version, now time.Time) ([]issue, error) {
+	var warnings []*schemav1.ApiWarning
+	if err := c.db.SelectContext(ctx, &warnings, c.db.Rebind(
+		c.db.BuildSelectStmt(&schemav1.ApiWarning{}, &schemav1.ApiWarning{})+
+			" WHERE cluster_uuid = ? AND removed_in IS NOT NULL AND last_seen >= ?"),
+		c.clusterUuid, now.Add(-warningWindow).UnixMilli()); err != nil {
+		return nil, errors.Wrap(err, "can't load API warnings")
+	}
+
+	var issues []issue
+	for _, w := range warnings {
+		removedIn, err := version.ParseGeneric(w.RemovedIn.String)
+		if err != nil || !current.LessThan(removedIn) {
+			continue
+		}
+
+		api := RemovedApi{
+			Version:     w.ApiVersion,
+			Resource:    w.Resource,
+			RemovedIn:   w.RemovedIn.String,
+			Replacement: w.Replacement.String,
+		}
+		if group, v, ok := strings.Cut(w.ApiVersion, "/"); ok {
+			api.Group, api.Version = group, v
+		}
+		for _, known := range Catalog {
+			if known.Group == api.Group && known.Version == api.Version && known.Resource == api.Resource {
+				api.Replacement = known.Replacement
+			}
+		}
+
+		issues = append(issues, issue{
+			api:      api,
+			source:   schemav1.UpgradeIssueSourceWarning,
+			resource: api.Resource,
+		})
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,195 @@
+package upgrade
+
+import (
+	"context"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	knet "k8s.io/apimachinery/pkg/util/net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warningsInterval is the interval in which the captured warnings are stored.
+const warningsInterval = time.Minute
+
+// warningWindow is the time within which warnings must have been received to be reported as readiness issues,
+// so that APIs that are no longer requested, e.g. after an update of a custom resource definition, don't block upgrades.
+const warningWindow = 24 * time.Hour
+
+// removal matches the removal announced in deprecation warnings of the API server,
+// e.g. "batch/v1beta1 CronJob is deprecated in v1.21+, unavailable in v1.25+; use batch/v1 CronJob".
+var removal = regexp.MustCompile(`unavailable in v(\d+\.\d+)\+(?:; use (\S+/\S+))?`)
+
+// warningKey identifies the warnings of a resource requested via an API version.
+type warningKey struct {
+	apiVersion string
+	resource   string
+}
+
+// Warnings captures the warnings that the API server returns in the Warning headers of the responses
+// to the requests made via the transports it wraps, e.g. deprecation warnings for list and watch requests
+// of informers, and stores the latest one per API version and resource every minute in the api_warning table.
+// Warnings that announce the removal of their API are reported as upgrade readiness issues by the Checker.
+type Warnings struct {
+	mu       sync.Mutex
+	warnings map[warningKey]*schemav1.ApiWarning
+	// changed contains the warnings received since they have last been stored.
+	changed map[warningKey]struct{}
+}
+
+// NewWarnings creates a new Warnings.
+func NewWarnings() *Warnings {
+	return &Warnings{
+		warnings: make(map[warningKey]*schemav1.ApiWarning),
+		changed:  make(map[warningKey]struct{}),
+	}
+}
+
+// Wrap wraps the given transport so that the warnings of its responses are captured.
+// It is supposed to be passed to rest.Config.Wrap.
+func (w *Warnings) Wrap(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := rt.RoundTrip(req)
+		if err == nil {
+			if headers := res.Header.Values("Warning"); len(headers) > 0 {
+				w.record(req.URL.Path, headers, time.Now())
+			}
+		}
+
+		return res, err
+	})
+}
+
+// Run loads the warnings stored before and stores the captured warnings every minute until ctx is canceled.
+func (w *Warnings) Run(ctx context.Context, db *database.Database, clusterUuid types.UUID) error {
+	var stored []*schemav1.ApiWarning
+	if err := db.SelectContext(ctx, &stored, db.Rebind(
+		db.BuildSelectStmt(&schemav1.ApiWarning{}, &schemav1.ApiWarning{})+" WHERE cluster_uuid = ?"),
+		clusterUuid); err != nil {
+		return errors.Wrap(err, "can't load API warnings")
+	}
+
+	w.mu.Lock()
+	for _, s := range stored {
+		k := warningKey{apiVersion: s.ApiVersion, resource: s.Resource}
+		if captured, ok := w.warnings[k]; ok {
+			captured.Requests += s.Requests
+			captured.FirstSeen = s.FirstSeen
+		} else {
+			w.warnings[k] = s
+		}
+	}
+	w.mu.Unlock()
+
+	for {
+		select {
+		case <-time.After(warningsInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := w.store(ctx, db, clusterUuid); err != nil {
+			return err
+		}
+	}
+}
+
+// record records the given Warning headers of a response to a request of the given path at the given time.
+// Warnings of requests that are not of a resource, e.g. /version, are ignored.
+func (w *Warnings) record(path string, headers []string, now time.Time) {
+	apiVersion, resource, ok := parse(path)
+	if !ok {
+		return
+	}
+
+	// Malformed warnings are skipped, as they are by client-go.
+	parsed, _ := knet.ParseWarningHeaders(headers)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, h := range parsed {
+		// The API server only returns warnings with the code 299, i.e. miscellaneous persistent warnings.
+		if h.Code != 299 || h.Text == "" {
+			continue
+		}
+
+		k := warningKey{apiVersion: apiVersion, resource: resource}
+		warning, ok := w.warnings[k]
+		if !ok {
+			warning = &schemav1.ApiWarning{
+				ApiVersion: apiVersion,
+				Resource:   resource,
+				FirstSeen:  types.UnixMilli(now),
+			}
+			w.warnings[k] = warning
+		}
+
+		var removedIn, replacement string
+		if m := removal.FindStringSubmatch(h.Text); m != nil {
+			removedIn, replacement = m[1], m[2]
+		}
+
+		warning.Message = h.Text
+		warning.RemovedIn = schemav1.NewNullableString(removedIn)
+		warning.Replacement = schemav1.NewNullableString(replacement)
+		warning.Requests++
+		warning.LastSeen = types.UnixMilli(now)
+		w.changed[k] = struct{}{}
+	}
+}
+
+// store stores the warnings received since they have last been stored.
+func (w *Warnings) store(ctx context.Context, db *database.Database, clusterUuid types.UUID) error {
+	w.mu.Lock()
+	entities := make(chan interface{}, len(w.changed))
+	for k := range w.changed {
+		// Warnings are copied, as they may be updated while they are stored.
+		warning := *w.warnings[k]
+		warning.Uuid = schemav1.NewUUID(clusterUuid, k.apiVersion+"/"+k.resource)
+		warning.ClusterUuid = clusterUuid
+		entities <- &warning
+	}
+	close(entities)
+	w.changed = make(map[warningKey]struct{})
+	w.mu.Unlock()
+
+	return errors.Wrap(db.UpsertStreamed(ctx, entities), "can't store API warnings")
+}
+
+// parse parses the given request path of a resource, i.e. /api/<version>/... or /apis/<group>/<version>/...,
+// optionally followed by namespaces/<namespace>, and returns its API version and resource without subresource.
+func parse(path string) (apiVersion, resource string, ok bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case len(segments) >= 3 && segments[0] == "api":
+		apiVersion = segments[1]
+		segments = segments[2:]
+	case len(segments) >= 4 && segments[0] == "apis":
+		apiVersion = segments[1] + "/" + segments[2]
+		segments = segments[3:]
+	default:
+		return "", "", false
+	}
+
+	// Namespaced resources, except namespaces themselves and their subresources.
+	if len(segments) >= 3 && segments[0] == "namespaces" && segments[2] != "status" && segments[2] != "finalize" {
+		segments = segments[2:]
+	}
+
+	return apiVersion, segments[0], true
+}
+
+// roundTripperFunc is an adapter to allow the use of ordinary functions as http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements the http.RoundTripper interface.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
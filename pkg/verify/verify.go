@@ -0,0 +1,410 @@
+package verify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/icinga/icinga-kubernetes/pkg/registry"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/icinga/icinga-kubernetes/pkg/sync"
+	k8sMysql "github.com/icinga/icinga-kubernetes/schema/mysql"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kschema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxExamples is the number of objects listed per discrepancy.
+const maxExamples = 5
+
+// Discrepancy is an inconsistency found by verification.
+type Discrepancy struct {
+	// Cluster is the name or UUID of the affected cluster, if specific to a cluster.
+	Cluster string
+	Message string
+}
+
+func (d Discrepancy) String() string {
+	if d.Cluster != "" {
+		return "cluster " + d.Cluster + ": " + d.Message
+	}
+
+	return d.Message
+}
+
+// Resource describes where objects synchronized by a controller are stored.
+type Resource struct {
+	Gvr        kschema.GroupVersionResource
+	Table      string
+	Namespaced bool
+	// Optional resources are skipped if the API server doesn't serve them.
+	Optional bool
+}
+
+// Resources maps the names of the registered controllers to the resources they synchronize.
+// Controllers that don't delete objects, i.e. events, are not included, as their objects are transient.
+func Resources() map[string]Resource {
+	resources := make(map[string]Resource)
+	for _, h := range registry.Handlers() {
+		if sync.NewFeatures(h.Features...).NoDelete() {
+			continue
+		}
+
+		resources[h.Name] = Resource{Gvr: h.Gvr, Table: h.Table(), Namespaced: !h.ClusterScoped, Optional: h.Optional}
+	}
+
+	return resources
+}
+
+// schemaTables matches the tables of the schema and their definitions.
+var schemaTables = regexp.MustCompile(`(?s)CREATE TABLE (\w+) \((.*?)\n\) ENGINE`)
+
+// schemaColumns matches the column definitions in table definitions of the schema,
+// whose names, unlike keys and constraints, are lowercase.
+var schemaColumns = regexp.MustCompile(`(?m)^  ([a-z0-9_]+) `)
+
+// Schema verifies that the database schema has the version of the schema shipped with this build
+// and that all of its tables and columns exist, e.g. in case an upgrade has been applied only partially.
+func Schema(ctx context.Context, db *database.Database) ([]Discrepancy, error) {
+	var versions []string
+	if err := db.SelectContext(ctx, &versions,
+		"SELECT version FROM kubernetes_schema WHERE success = 'y' ORDER BY id DESC"); err != nil {
+		return nil, errors.Wrap(err, "can't query schema version")
+	}
+
+	if len(versions) == 0 {
+		return []Discrepancy{{Message: "no schema version has been imported successfully"}}, nil
+	}
+
+	var discrepancies []Discrepancy
+	if versions[0] != k8sMysql.Version {
+		discrepancies = append(discrepancies, Discrepancy{Message: fmt.Sprintf(
+			"schema version is %s, but %s is expected", versions[0], k8sMysql.Version)})
+	}
+
+	var existing []struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+	}
+	if err := db.SelectContext(ctx, &existing,
+		"SELECT table_name AS table_name, column_name AS column_name FROM INFORMATION_SCHEMA.COLUMNS"+
+			" WHERE table_schema = DATABASE()"); err != nil {
+		return nil, errors.Wrap(err, "can't query schema columns")
+	}
+
+	columns := make(map[string]map[string]struct{})
+	for _, e := range existing {
+		if columns[e.Table] == nil {
+			columns[e.Table] = make(map[string]struct{})
+		}
+		columns[e.Table][e.Column] = struct{}{}
+	}
+
+	var missingTables []string
+	for _, t := range schemaTables.FindAllStringSubmatch(k8sMysql.Schema, -1) {
+		table, ok := columns[t[1]]
+		if !ok {
+			missingTables = append(missingTables, t[1])
+
+			continue
+		}
+
+		var missing []string
+		for _, c := range schemaColumns.FindAllStringSubmatch(t[2], -1) {
+			if _, ok := table[c[1]]; !ok {
+				missing = append(missing, c[1])
+			}
+		}
+
+		if len(missing) > 0 {
+			discrepancies = append(discrepancies, Discrepancy{Message: fmt.Sprintf(
+				"%d columns of table %s are missing: %s", len(missing), t[1], examples(missing))})
+		}
+	}
+
+	if len(missingTables) > 0 {
+		discrepancies = append(discrepancies, Discrepancy{Message: fmt.Sprintf(
+			"%d tables are missing: %s", len(missingTables), examples(missingTables))})
+	}
+
+	return discrepancies, nil
+}
+
+// relationTables matches the tables relating resources to their labels and annotations in the schema.
+var relationTables = regexp.MustCompile(`CREATE TABLE (\w+)_(label|annotation) \(`)
+
+// Relations verifies that all label and annotation relations and containers refer to existing rows.
+func Relations(ctx context.Context, db *database.Database) ([]Discrepancy, error) {
+	type relation struct {
+		table, column, referenced string
+	}
+
+	var relations []relation
+	for _, m := range relationTables.FindAllStringSubmatch(k8sMysql.Schema, -1) {
+		table := m[1] + "_" + m[2]
+		relations = append(relations,
+			relation{table, m[1] + "_uuid", m[1]},
+			relation{table, m[2] + "_uuid", m[2]})
+	}
+	relations = append(relations, relation{"container", "pod_uuid", "pod"})
+
+	var discrepancies []Discrepancy
+	for _, r := range relations {
+		var dangling int
+		if err := db.GetContext(ctx, &dangling, fmt.Sprintf(
+			"SELECT COUNT(*) FROM %s r LEFT JOIN %s x ON x.uuid = r.%s WHERE x.uuid IS NULL",
+			r.table, r.referenced, r.column)); err != nil {
+			return nil, errors.Wrapf(err, "can't verify relations of table %s", r.table)
+		}
+
+		if dangling > 0 {
+			discrepancies = append(discrepancies, Discrepancy{Message: fmt.Sprintf(
+				"%d rows of table %s refer to missing %s rows", dangling, r.table, r.referenced)})
+		}
+	}
+
+	return discrepancies, nil
+}
+
+// Metrics verifies that running pods have Prometheus metrics in clusters for which metrics are synchronized at all.
+// Pods younger than ten minutes are not taken into account, as their metrics may not have been synchronized yet.
+func Metrics(ctx context.Context, db *database.Database) ([]Discrepancy, error) {
+	var clusters []struct {
+		Uuid types.UUID
+		Name sql.NullString
+	}
+	if err := db.SelectContext(ctx, &clusters,
+		"SELECT uuid, name FROM cluster c WHERE EXISTS (SELECT 1 FROM prometheus_cluster_metric m"+
+			" WHERE m.cluster_uuid = c.uuid) ORDER BY name"); err != nil {
+		return nil, errors.Wrap(err, "can't query clusters with metrics")
+	}
+
+	var discrepancies []Discrepancy
+	for _, c := range clusters {
+		var pods []struct {
+			Namespace string
+			Name      string
+		}
+		if err := db.SelectContext(ctx, &pods, db.Rebind(
+			"SELECT p.namespace, p.name FROM pod p WHERE p.cluster_uuid = ? AND p.phase = 'Running' AND p.created < ?"+
+				" AND NOT EXISTS (SELECT 1 FROM prometheus_pod_metric m WHERE m.pod_uuid = p.uuid)"),
+			c.Uuid, time.Now().Add(-10*time.Minute).UnixMilli()); err != nil {
+			return nil, errors.Wrap(err, "can't query pods without metrics")
+		}
+
+		if len(pods) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(pods))
+		for _, p := range pods {
+			names = append(names, p.Namespace+"/"+p.Name)
+		}
+
+		cluster := c.Name.String
+		if cluster == "" {
+			cluster = c.Uuid.String()
+		}
+
+		discrepancies = append(discrepancies, Discrepancy{Cluster: cluster, Message: fmt.Sprintf(
+			"%d running pods have no metrics: %s", len(pods), examples(names))})
+	}
+
+	return discrepancies, nil
+}
+
+// Live verifies that the database contains exactly the objects of the given resources in the live cluster,
+// taking the namespace configuration into account. Objects created or deleted during verification
+// may be reported, as they may not have been synchronized yet.
+func Live(
+	ctx context.Context, db *database.Database, client metadata.Interface, cluster string, clusterUuid types.UUID,
+	namespaces *sync.NamespacesConfig, resources map[string]Resource,
+) ([]Discrepancy, error) {
+	differences, err := Diff(ctx, db, client, clusterUuid, namespaces, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		resource string
+		state    DiffState
+	}
+
+	var keys []key
+	names := make(map[key][]string)
+	for _, d := range differences {
+		k := key{d.Resource, d.State}
+		if _, ok := names[k]; !ok {
+			keys = append(keys, k)
+		}
+		names[k] = append(names[k], d.Object())
+	}
+
+	var discrepancies []Discrepancy
+	for _, k := range keys {
+		var format string
+		switch k.state {
+		case Missing:
+			format = "%d %s are missing in the database: %s"
+		case Orphaned:
+			format = "%d %s don't exist anymore: %s"
+		default:
+			continue
+		}
+
+		discrepancies = append(discrepancies, Discrepancy{
+			Cluster: cluster, Message: fmt.Sprintf(format, len(names[k]), k.resource, examples(names[k]))})
+	}
+
+	return discrepancies, nil
+}
+
+// DiffState describes how an object in the database differs from the live cluster.
+type DiffState string
+
+const (
+	// Missing objects exist in the cluster but not in the database.
+	Missing DiffState = "missing"
+	// Stale objects exist in both, but the database has another resource version than the cluster.
+	Stale DiffState = "stale"
+	// Orphaned objects exist in the database but not in the cluster anymore.
+	Orphaned DiffState = "orphaned"
+)
+
+// Difference is an object that differs between the live cluster and the database.
+type Difference struct {
+	Resource   string
+	Namespaced bool
+	Namespace  string
+	Name       string
+	State      DiffState
+}
+
+// Object returns the name of the object, prefixed with its namespace if namespaced.
+func (d Difference) Object() string {
+	if d.Namespaced {
+		return d.Namespace + "/" + d.Name
+	}
+
+	return d.Name
+}
+
+// Diff compares the objects of the given resources in the live cluster with the database,
+// taking the namespace configuration into account, and returns all objects that differ,
+// ordered by resource, state and object name.
+// Objects changed during comparison may be reported, as their changes may not have been synchronized yet.
+func Diff(
+	ctx context.Context, db *database.Database, client metadata.Interface, clusterUuid types.UUID,
+	namespaces *sync.NamespacesConfig, resources map[string]Resource,
+) ([]Difference, error) {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var differences []Difference
+	for _, name := range names {
+		r := resources[name]
+		live, err := list(ctx, client, r, namespaces)
+		if r.Optional && kerrors.IsNotFound(errors.Cause(err)) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't list %s", name)
+		}
+
+		var rows []struct {
+			Uuid            types.UUID
+			Namespace       string
+			Name            string
+			ResourceVersion string `db:"resource_version"`
+		}
+		if err := db.SelectContext(ctx, &rows, db.Rebind(fmt.Sprintf(
+			"SELECT uuid, namespace, name, resource_version FROM %s WHERE cluster_uuid = ?", r.Table)),
+			clusterUuid); err != nil {
+			return nil, errors.Wrapf(err, "can't query %s", name)
+		}
+
+		var diff []Difference
+		for _, row := range rows {
+			obj, ok := live[row.Uuid]
+			if !ok {
+				diff = append(diff, Difference{name, r.Namespaced, row.Namespace, row.Name, Orphaned})
+
+				continue
+			}
+
+			delete(live, row.Uuid)
+			if obj.GetResourceVersion() != row.ResourceVersion {
+				diff = append(diff, Difference{name, r.Namespaced, row.Namespace, row.Name, Stale})
+			}
+		}
+
+		for _, obj := range live {
+			diff = append(diff, Difference{name, r.Namespaced, obj.GetNamespace(), obj.GetName(), Missing})
+		}
+
+		slices.SortFunc(diff, func(a, b Difference) int {
+			if c := strings.Compare(string(a.State), string(b.State)); c != 0 {
+				return c
+			}
+
+			return strings.Compare(a.Object(), b.Object())
+		})
+
+		differences = append(differences, diff...)
+	}
+
+	return differences, nil
+}
+
+// list returns the metadata of all objects of the given resource that are synchronized by ID.
+func list(
+	ctx context.Context, client metadata.Interface, r Resource, namespaces *sync.NamespacesConfig,
+) (map[types.UUID]kmetav1.Object, error) {
+	filter := namespaces.Filter
+	if !r.Namespaced {
+		filter = func(kmetav1.Object) bool { return true }
+	}
+	if r.Table == "namespace" {
+		filter = namespaces.FilterNamespace
+	}
+
+	objects := make(map[types.UUID]kmetav1.Object)
+	options := kmetav1.ListOptions{Limit: 500}
+	for {
+		l, err := client.Resource(r.Gvr).List(ctx, options)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for i := range l.Items {
+			if filter(&l.Items[i]) {
+				objects[schemav1.EnsureUUID(l.Items[i].UID)] = &l.Items[i]
+			}
+		}
+
+		if options.Continue = l.Continue; options.Continue == "" {
+			return objects, nil
+		}
+	}
+}
+
+// examples returns up to maxExamples of the given names, sorted, as a comma-separated list.
+func examples(names []string) string {
+	slices.Sort(names)
+
+	if len(names) > maxExamples {
+		return strings.Join(names[:maxExamples], ", ") + ", ..."
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"github.com/pkg/errors"
+	"net/url"
+	"time"
+)
+
+// Config defines a webhook to which problem events are sent.
+type Config struct {
+	// Url to POST events to.
+	Url string `yaml:"url"`
+	// Headers are added to each request, e.g. for authorization.
+	Headers map[string]string `yaml:"headers"`
+	// Template is a Go text/template rendering the request body from an Event.
+	// If not set, the Event is sent as JSON.
+	Template string `yaml:"template"`
+	// Timeout of each request. Defaults to DefaultTimeout.
+	// Not set via a default tag, as defaults aren't applied to list entries.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// DefaultTimeout is the timeout of requests to webhooks without a configured timeout.
+const DefaultTimeout = 10 * time.Second
+
+// Validate checks constraints in the supplied webhook configuration and returns an error if they are violated.
+func (c *Config) Validate() error {
+	u, err := url.Parse(c.Url)
+	if err != nil {
+		return errors.Wrap(err, "invalid webhook url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("webhook url must use http or https")
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("webhook timeout must not be negative")
+	}
+
+	if _, err := parseTemplate(c.Template); err != nil {
+		return errors.Wrap(err, "invalid webhook template")
+	}
+
+	return nil
+}
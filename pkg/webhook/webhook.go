@@ -0,0 +1,246 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/backoff"
+	"github.com/icinga/icinga-kubernetes/pkg/problem"
+	"github.com/icinga/icinga-kubernetes/pkg/retry"
+	schemav1 "github.com/icinga/icinga-kubernetes/pkg/schema/v1"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// Opened is the type of events sent when a problem is raised.
+	Opened = "open"
+	// Closed is the type of events sent when a problem is cleared.
+	Closed = "close"
+)
+
+// queueSize is the number of events buffered per webhook. Further events are dropped while the webhook is unavailable.
+const queueSize = 1024
+
+// Event is sent to webhooks when a problem is opened or closed.
+type Event struct {
+	Type      string     `json:"type"`
+	Cluster   string     `json:"cluster,omitempty"`
+	Namespace string     `json:"namespace"`
+	Pod       string     `json:"pod,omitempty"`
+	Container string     `json:"container,omitempty"`
+	Object    string     `json:"object,omitempty"`
+	Reason    string     `json:"reason"`
+	Message   string     `json:"message,omitempty"`
+	Started   time.Time  `json:"started"`
+	Cleared   *time.Time `json:"cleared,omitempty"`
+}
+
+// gitopsKinds maps the types of GitOps applications to their kind.
+var gitopsKinds = map[string]string{
+	"argo_application":   "Application",
+	"flux_kustomization": "Kustomization",
+}
+
+// NewEvent returns an Event for the given problem of the cluster with the given name, e.g. a *schemav1.Problem,
+// of type Closed if the problem has been cleared and Opened otherwise. Object is the kind and name of the object
+// the problem is one of, unless it is one of a pod or container. For certificate problems, it is the kind and name
+// of the object that references or contains the certificate or token, or the address of the API server.
+func NewEvent(cluster string, p problem.Problem) Event {
+	e := Event{Cluster: cluster, Reason: p.GetReason()}
+
+	var message sql.NullString
+	var started, cleared types.UnixMilli
+	switch p := p.(type) {
+	case *schemav1.Problem:
+		e.Namespace, e.Pod, e.Container = p.Namespace, p.PodName, p.ContainerName.String
+		message, started, cleared = p.Message, p.Started, p.Cleared
+	case *schemav1.CertificateProblem:
+		e.Namespace = p.Namespace
+		switch p.Source {
+		case schemav1.CertificateSourceApiServer:
+			e.Object = p.Target
+		case schemav1.CertificateSourceWebhook:
+			e.Object = "WebhookConfiguration/" + p.Name
+		case schemav1.CertificateSourceIngress:
+			e.Object = "Ingress/" + p.Name
+		case schemav1.CertificateSourceServiceAccountToken, schemav1.CertificateSourceKubeconfig:
+			e.Object = "Secret/" + p.Name
+		}
+		message, started, cleared = p.Message, p.Started, p.Cleared
+	case *schemav1.CronJobProblem:
+		e.Namespace, e.Object = p.Namespace, "CronJob/"+p.Name
+		message, started, cleared = p.Message, p.Started, p.Cleared
+	case *schemav1.ServiceProblem:
+		e.Namespace, e.Object = p.Namespace, "Service/"+p.Name
+		message, started, cleared = p.Message, p.Started, p.Cleared
+	case *schemav1.HpaProblem:
+		e.Namespace, e.Object = p.Namespace, "HorizontalPodAutoscaler/"+p.Name
+		message, started, cleared = p.Message, p.Started, p.Cleared
+	case *schemav1.ResourceQuotaProblem:
+		e.Namespace, e.Object = p.Namespace, "ResourceQuota/"+p.Name
+		message, started, cleared = p.Message, p.Started, p.Cleared
+	case *schemav1.GitopsProblem:
+		e.Namespace, e.Object = p.Namespace, gitopsKinds[p.ResourceType]+"/"+p.Name
+		message, started, cleared = p.Message, p.Started, p.Cleared
+	}
+
+	e.Message = message.String
+	e.Started = started.Time()
+
+	e.Type = Opened
+	if t := cleared.Time(); !t.IsZero() {
+		e.Type = Closed
+		e.Cleared = &t
+	}
+
+	return e
+}
+
+// Sink sends events to a webhook in the background, so that slow webhooks don't delay problem detection.
+type Sink struct {
+	config   *Config
+	template *template.Template
+	http     *http.Client
+	queue    chan Event
+	log      logr.Logger
+}
+
+// NewSink creates a new Sink for the given webhook.
+func NewSink(c *Config, log logr.Logger) (*Sink, error) {
+	tmpl, err := parseTemplate(c.Template)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid webhook template")
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Sink{
+		config:   c,
+		template: tmpl,
+		http:     &http.Client{Timeout: timeout},
+		queue:    make(chan Event, queueSize),
+		log:      log,
+	}, nil
+}
+
+// Notify queues the given event. If the queue is full, the event is dropped.
+func (s *Sink) Notify(e Event) {
+	select {
+	case s.queue <- e:
+	default:
+		s.log.Info("Dropping event, as the webhook can't keep up",
+			"reason", e.Reason, "namespace", e.Namespace, "pod", e.Pod, "object", e.Object)
+	}
+}
+
+// Run sends queued events until ctx is canceled.
+// Failed requests are retried for up to five minutes before the event is dropped.
+func (s *Sink) Run(ctx context.Context) error {
+	for {
+		select {
+		case e := <-s.queue:
+			err := retry.WithBackoff(
+				ctx,
+				func(ctx context.Context) error {
+					return s.send(ctx, e)
+				},
+				func(err error) bool {
+					var status statusError
+
+					return !errors.As(err, &status) || status.retryable()
+				},
+				backoff.NewExponentialWithJitter(time.Second, time.Minute),
+				retry.Settings{Timeout: 5 * time.Minute},
+			)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				s.log.Error(err, "Can't send event to webhook", "reason", e.Reason, "pod", e.Namespace+"/"+e.Pod)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Sink) send(ctx context.Context, e Event) error {
+	var body bytes.Buffer
+	if s.template != nil {
+		if err := s.template.Execute(&body, e); err != nil {
+			return errors.Wrap(err, "can't render webhook template")
+		}
+	} else if err := json.NewEncoder(&body).Encode(e); err != nil {
+		return errors.Wrap(err, "can't marshal event")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Url, &body)
+	if err != nil {
+		return errors.Wrap(err, "can't create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := s.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "can't send request")
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+		return errors.WithStack(statusError{code: res.StatusCode, status: res.Status, msg: strings.TrimSpace(string(msg))})
+	}
+
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	return nil
+}
+
+// statusError is returned if the webhook responds with an unsuccessful status code.
+type statusError struct {
+	code   int
+	status string
+	msg    string
+}
+
+func (e statusError) Error() string {
+	return "webhook responded with " + e.status + ": " + e.msg
+}
+
+// retryable returns whether the request may succeed if retried.
+func (e statusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+// parseTemplate parses the given body template, returning nil if it is empty.
+// The json function marshals values as JSON, so that they can be embedded safely, e.g. {{ json .Message }}.
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+
+			return string(b), err
+		},
+	}).Parse(text)
+}
@@ -0,0 +1,71 @@
+// Package workload resolves the workloads of pods from the owners stored in the database.
+package workload
+
+import (
+	"context"
+	"github.com/icinga/icinga-go-library/types"
+	"github.com/icinga/icinga-kubernetes/pkg/database"
+	"github.com/pkg/errors"
+)
+
+// maxOwnerDepth limits how many owners are followed to find the workload of a pod.
+const maxOwnerDepth = 5
+
+// Workload identifies the top-level controller of a pod.
+type Workload struct {
+	Kind string
+	Name string
+}
+
+// Resolve returns the workloads of the pods of the cluster by pod UUID,
+// following the controller owner references of pods, e.g. via replica sets to deployments.
+// Pods without controller are not included.
+func Resolve(ctx context.Context, db *database.Database, clusterUuid types.UUID) (map[types.UUID]Workload, error) {
+	type owner struct {
+		Uuid      types.UUID
+		OwnerUuid types.UUID
+		Kind      string
+		Name      string
+	}
+
+	owners := make(map[types.UUID]owner)
+	for _, table := range []string{"replica_set", "job", "deployment", "daemon_set", "stateful_set"} {
+		var rows []owner
+		if err := db.SelectContext(ctx, &rows, db.Rebind(
+			"SELECT o."+table+"_uuid AS uuid, o.owner_uuid, o.kind, o.name FROM "+table+"_owner o"+
+				" INNER JOIN "+table+" t ON t.uuid = o."+table+"_uuid"+
+				" WHERE t.cluster_uuid = ? AND o.controller = 'y'"),
+			clusterUuid); err != nil {
+			return nil, errors.Wrapf(err, "can't query %s owners", table)
+		}
+
+		for _, o := range rows {
+			owners[o.Uuid] = o
+		}
+	}
+
+	var pods []owner
+	if err := db.SelectContext(ctx, &pods, db.Rebind(
+		"SELECT o.pod_uuid AS uuid, o.owner_uuid, o.kind, o.name FROM pod_owner o"+
+			" INNER JOIN pod ON pod.uuid = o.pod_uuid WHERE pod.cluster_uuid = ? AND o.controller = 'y'"),
+		clusterUuid); err != nil {
+		return nil, errors.Wrap(err, "can't query pod owners")
+	}
+
+	workloads := make(map[types.UUID]Workload, len(pods))
+	for _, o := range pods {
+		podUuid := o.Uuid
+		for depth := 0; depth < maxOwnerDepth; depth++ {
+			next, ok := owners[o.OwnerUuid]
+			if !ok {
+				break
+			}
+
+			o = next
+		}
+
+		workloads[podUuid] = Workload{Kind: o.Kind, Name: o.Name}
+	}
+
+	return workloads, nil
+}
@@ -1,9 +1,105 @@
 package mysql
 
-import _ "embed"
+import (
+	"embed"
+	"fmt"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+	"path"
+	"slices"
+	"strings"
+)
 
 // Schema is a copy of schema.sql. It resides here
 // and not in ../../cmd/icinga-kubernetes/main.go due to go:embed restrictions.
 //
 //go:embed schema.sql
 var Schema string
+
+// Version is the version of Schema. It must match the version inserted into kubernetes_schema by schema.sql
+// and the version of the latest upgrade script.
+const Version = "0.2.0"
+
+// AdoptedTables are the tables to which the upgrade to 0.2.0 added the cluster_uuid column,
+// whose rows from before the upgrade have a zero cluster_uuid until a cluster adopts them.
+// Tables of objects that reference the rows of others are listed first.
+var AdoptedTables = []string{
+	"config_map", "cron_job", "daemon_set", "deployment", "endpoint_slice", "event", "ingress", "job", "node",
+	"persistent_volume", "pod", "pvc", "replica_set", "secret", "service", "stateful_set", "kubernetes_instance",
+	"namespace",
+}
+
+// upgrades contains the upgrade scripts upgrades/<version>.sql, each of which upgrades the schema
+// from the previous version to <version> and inserts <version> into kubernetes_schema.
+//
+//go:embed upgrades/*.sql
+var upgrades embed.FS
+
+// Upgrade is an upgrade script of the schema.
+type Upgrade struct {
+	// Version is the version the script upgrades the schema to.
+	Version string
+	// Script contains the statements of the script.
+	Script string
+}
+
+// Upgrades returns the upgrade scripts required to upgrade the schema from the given version to Version in order.
+// It fails if the given version is newer than Version, i.e. the schema is of a newer release of Icinga for Kubernetes,
+// or if it is not the version of Schema or any of the upgrade scripts.
+func Upgrades(from string) ([]Upgrade, error) {
+	current, err := version.ParseSemantic(from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse schema version %q", from)
+	}
+
+	latest := version.MustParseSemantic(Version)
+	if latest.LessThan(current) {
+		return nil, errors.Errorf("schema version %s is newer than the supported version %s", from, Version)
+	}
+
+	entries, err := upgrades.ReadDir("upgrades")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read upgrade scripts")
+	}
+
+	known := current.String() == Version || current.String() == "0.1.0"
+	var pending []Upgrade
+	for _, e := range entries {
+		v, err := version.ParseSemantic(strings.TrimSuffix(e.Name(), ".sql"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't parse version of upgrade script %s", e.Name())
+		}
+
+		if v.String() == current.String() {
+			known = true
+		}
+
+		if !current.LessThan(v) {
+			continue
+		}
+
+		script, err := upgrades.ReadFile(path.Join("upgrades", e.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read upgrade script %s", e.Name())
+		}
+
+		pending = append(pending, Upgrade{Version: v.String(), Script: string(script)})
+	}
+
+	// 0.1.0 is the initial version, which has no upgrade script.
+	if !known {
+		return nil, errors.Errorf("unknown schema version %s", from)
+	}
+
+	slices.SortFunc(pending, func(a, b Upgrade) int {
+		c, _ := version.MustParseSemantic(a.Version).Compare(b.Version)
+
+		return c
+	})
+
+	if len(pending) > 0 && pending[len(pending)-1].Version != Version {
+		panic(fmt.Sprintf("latest upgrade script is of version %s instead of %s", pending[len(pending)-1].Version, Version))
+	}
+
+	return pending, nil
+}
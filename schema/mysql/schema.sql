@@ -12,13 +12,169 @@ CREATE TABLE label (
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE api_request (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  timestamp bigint unsigned NOT NULL,
+  verb varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  requests int unsigned NOT NULL,
+  errors int unsigned NOT NULL,
+  latency_avg bigint unsigned NOT NULL,
+  latency_max bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_api_request_cluster_uuid_timestamp (cluster_uuid, timestamp),
+  INDEX idx_api_request_timestamp (timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE api_warning (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  api_version varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message varchar(1023) COLLATE utf8mb4_unicode_ci NOT NULL,
+  removed_in varchar(15) NULL DEFAULT NULL,
+  replacement varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  requests bigint unsigned NOT NULL,
+  first_seen bigint unsigned NOT NULL,
+  last_seen bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_api_warning_cluster_uuid_last_seen (cluster_uuid, last_seen),
+  INDEX idx_api_warning_last_seen (last_seen)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE argo_application (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  project varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  repo_url varchar(1024) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  path varchar(1024) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  target_revision varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  destination_server varchar(1024) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  destination_namespace varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  sync_status varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  sync_revision varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  health_status varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  health_message text NULL DEFAULT NULL,
+  operation_phase varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  operation_message text NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE argo_application_resource (
+  argo_application_uuid binary(16) NOT NULL,
+  api_group varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  kind varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  sync_status varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  health_status varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  PRIMARY KEY (argo_application_uuid, api_group, kind, namespace, name),
+  INDEX idx_argo_application_resource_namespace_name (namespace, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE canary_run (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pod_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  node_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  success enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  scheduling_time bigint unsigned NULL DEFAULT NULL,
+  running_time bigint unsigned NULL DEFAULT NULL,
+  error text NULL DEFAULT NULL,
+  started bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_canary_run_cluster_uuid_started (cluster_uuid, started),
+  INDEX idx_canary_run_started (started)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE capacity_forecast (
+  cluster_uuid binary(16) NOT NULL,
+  scope enum('node_pool', 'namespace', 'pvc') COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource enum('cpu', 'memory', 'storage', 'inodes') COLLATE utf8mb4_unicode_ci NOT NULL,
+  capacity double NOT NULL,
+  usage double NOT NULL,
+  growth_per_day double NULL DEFAULT NULL,
+  days_until_exhaustion double NULL DEFAULT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (cluster_uuid, scope, namespace, name, resource)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE certificate (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  source enum('api_server', 'webhook', 'ingress', 'service_account_token', 'kubeconfig') COLLATE utf8mb4_unicode_ci NOT NULL,
+  type enum('certificate', 'token') COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  target varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL,
+  subject varchar(1024) COLLATE utf8mb4_unicode_ci NOT NULL,
+  issuer varchar(1024) COLLATE utf8mb4_unicode_ci NOT NULL,
+  dns_names text COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  not_before bigint unsigned NOT NULL,
+  not_after bigint unsigned NOT NULL,
+  checked bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_certificate_cluster_uuid_not_after (cluster_uuid, not_after)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE certificate_problem (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  certificate_uuid binary(16) NOT NULL,
+  source enum('api_server', 'webhook', 'ingress', 'service_account_token', 'kubeconfig') COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  target varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  not_after bigint unsigned NOT NULL,
+  started bigint unsigned NOT NULL,
+  cleared bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_certificate_problem_cluster_uuid_cleared (cluster_uuid, cleared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE cilium_endpoint (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  endpoint_id bigint unsigned NULL DEFAULT NULL,
+  identity_id bigint unsigned NULL DEFAULT NULL,
+  status varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  health varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  node_ip varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  ipv4 varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  ipv6 varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  ingress_enforcing enum('n', 'y') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  egress_enforcing enum('n', 'y') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE config_map (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
   resource_version varchar(255) NOT NULL,
-  immutable enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  immutable enum('n', 'y') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -50,6 +206,8 @@ CREATE TABLE container (
   ready enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
   started enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
   restart_count int unsigned NOT NULL,
+  restarts_last_hour int unsigned NULL DEFAULT NULL,
+  restarts_last_day int unsigned NULL DEFAULT NULL,
   icinga_state enum('unknown', 'pending', 'ok', 'warning', 'critical') COLLATE utf8mb4_unicode_ci NOT NULL,
   icinga_state_reason text NULL DEFAULT NULL,
   PRIMARY KEY (uuid)
@@ -81,8 +239,69 @@ CREATE TABLE container_mount (
   PRIMARY KEY (container_uuid, volume_name)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE container_recommendation (
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  workload_kind varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  workload_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  container varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  cpu_requests bigint unsigned NULL DEFAULT NULL,
+  cpu_limits bigint unsigned NULL DEFAULT NULL,
+  memory_requests bigint unsigned NULL DEFAULT NULL,
+  memory_limits bigint unsigned NULL DEFAULT NULL,
+  cpu_usage double NOT NULL,
+  memory_usage double NOT NULL,
+  recommended_cpu_requests bigint unsigned NOT NULL,
+  recommended_cpu_limits bigint unsigned NULL DEFAULT NULL,
+  recommended_memory_requests bigint unsigned NOT NULL,
+  recommended_memory_limits bigint unsigned NULL DEFAULT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (cluster_uuid, namespace, workload_kind, workload_name, container)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE container_restart (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  container_uuid binary(16) NOT NULL,
+  pod_uuid binary(16) NOT NULL,
+  restart_count int unsigned NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  exit_code int NULL DEFAULT NULL,
+  event_time bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_container_restart_container_uuid_event_time (container_uuid, event_time),
+  INDEX idx_container_restart_event_time (event_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE cost_namespace (
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  hour bigint unsigned NOT NULL,
+  cpu_cost double NOT NULL,
+  memory_cost double NOT NULL,
+  cost double NOT NULL,
+  currency varchar(3) NOT NULL,
+  PRIMARY KEY (cluster_uuid, namespace, hour),
+  INDEX idx_cost_namespace_hour (hour)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE cost_workload (
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  kind varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  hour bigint unsigned NOT NULL,
+  cpu_cost double NOT NULL,
+  memory_cost double NOT NULL,
+  cost double NOT NULL,
+  currency varchar(3) NOT NULL,
+  PRIMARY KEY (cluster_uuid, namespace, kind, name, hour),
+  INDEX idx_cost_workload_hour (hour)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE cron_job (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -98,6 +317,8 @@ CREATE TABLE cron_job (
   last_schedule_time bigint unsigned NULL DEFAULT NULL,
   last_successful_time bigint unsigned NULL DEFAULT NULL,
   yaml mediumblob DEFAULT NULL,
+  last_change_manager varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_changed bigint unsigned NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -114,8 +335,24 @@ CREATE TABLE cron_job_label (
   PRIMARY KEY (cron_job_uuid, label_uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE cron_job_problem (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  cron_job_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  scheduled bigint unsigned NOT NULL,
+  started bigint unsigned NOT NULL,
+  cleared bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_cron_job_problem_cluster_uuid_cleared (cluster_uuid, cleared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE daemon_set (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -132,6 +369,8 @@ CREATE TABLE daemon_set (
   yaml mediumblob DEFAULT NULL,
   icinga_state enum('unknown', 'ok', 'warning', 'critical') COLLATE utf8mb4_unicode_ci NOT NULL,
   icinga_state_reason text NOT NULL,
+  last_change_manager varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_changed bigint unsigned NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -152,6 +391,22 @@ CREATE TABLE daemon_set_condition (
   PRIMARY KEY (daemon_set_uuid, type)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE daemon_set_coverage_gap (
+  daemon_set_uuid binary(16) NOT NULL,
+  node_uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  daemon_set_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  node_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason enum('missing', 'not_running') COLLATE utf8mb4_unicode_ci NOT NULL,
+  pod_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  pod_phase varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (daemon_set_uuid, node_uuid),
+  INDEX idx_daemon_set_coverage_gap_node_uuid (node_uuid),
+  INDEX idx_daemon_set_coverage_gap_cluster_uuid_computed (cluster_uuid, computed)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE daemon_set_label (
   daemon_set_uuid binary(16) NOT NULL,
   label_uuid binary(16) NOT NULL,
@@ -171,6 +426,7 @@ CREATE TABLE daemon_set_owner (
 
 CREATE TABLE deployment (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci  NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -188,6 +444,8 @@ CREATE TABLE deployment (
   yaml mediumblob DEFAULT NULL,
   icinga_state enum('unknown', 'ok', 'warning', 'critical') COLLATE utf8mb4_unicode_ci NOT NULL,
   icinga_state_reason text NOT NULL,
+  last_change_manager varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_changed bigint unsigned NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -226,6 +484,17 @@ CREATE TABLE deployment_owner (
   PRIMARY KEY (deployment_uuid, owner_uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE deployment_sla (
+  deployment_uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  day bigint unsigned NOT NULL,
+  observed bigint unsigned NOT NULL,
+  available bigint unsigned NOT NULL,
+  availability decimal(6, 3) NULL DEFAULT NULL,
+  PRIMARY KEY (deployment_uuid, day),
+  INDEX idx_deployment_sla_cluster_uuid_day (cluster_uuid, day)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE endpoint (
   uuid binary(16) NOT NULL,
   endpoint_slice_uuid binary(16) NOT NULL,
@@ -244,6 +513,7 @@ CREATE TABLE endpoint (
 
 CREATE TABLE endpoint_slice (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -270,8 +540,32 @@ CREATE TABLE endpoint_target_ref (
   PRIMARY KEY (endpoint_slice_uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE etcd_object_count (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  timestamp bigint unsigned NOT NULL,
+  resource varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  objects bigint unsigned NOT NULL,
+  source enum('metrics', 'list') COLLATE utf8mb4_unicode_ci NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_etcd_object_count_cluster_uuid_timestamp (cluster_uuid, timestamp),
+  INDEX idx_etcd_object_count_timestamp (timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE etcd_size (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  timestamp bigint unsigned NOT NULL,
+  storage_cluster varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  size bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_etcd_size_cluster_uuid_timestamp (cluster_uuid, timestamp),
+  INDEX idx_etcd_size_timestamp (timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE event (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   referent_uuid binary(16) NOT NULL,
   namespace varchar(63) NOT NULL,
   name varchar(270) NOT NULL,
@@ -294,8 +588,157 @@ CREATE TABLE event (
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE flux_kustomization (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  source_kind varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  source_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  path varchar(1024) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  suspend enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  ready enum('n', 'y') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  ready_reason varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  ready_message text NULL DEFAULT NULL,
+  last_applied_revision varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_attempted_revision varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE flux_kustomization_resource (
+  flux_kustomization_uuid binary(16) NOT NULL,
+  api_group varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  kind varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  PRIMARY KEY (flux_kustomization_uuid, api_group, kind, namespace, name),
+  INDEX idx_flux_kustomization_resource_namespace_name (namespace, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE gitops_problem (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  resource_type enum('argo_application', 'flux_kustomization') COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  started bigint unsigned NOT NULL,
+  cleared bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_gitops_problem_cluster_uuid_cleared (cluster_uuid, cleared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE hpa (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  scale_target_kind varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  scale_target_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  min_replicas int unsigned NOT NULL,
+  max_replicas int unsigned NOT NULL,
+  current_replicas int unsigned NOT NULL,
+  desired_replicas int unsigned NOT NULL,
+  last_scale_time bigint unsigned NULL DEFAULT NULL,
+  scaling_metric varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  scaling_metric_ratio double NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE hpa_problem (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  hpa_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  scale_target_kind varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  scale_target_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  scaling_metric varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  scalings int unsigned NOT NULL,
+  started bigint unsigned NOT NULL,
+  cleared bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_hpa_problem_cluster_uuid_cleared (cluster_uuid, cleared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE hpa_scaling (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  hpa_uuid binary(16) NOT NULL,
+  previous_replicas int unsigned NOT NULL,
+  desired_replicas int unsigned NOT NULL,
+  scaling_metric varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  scaling_metric_ratio double NULL DEFAULT NULL,
+  event_time bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_hpa_scaling_hpa_uuid_event_time (hpa_uuid, event_time),
+  INDEX idx_hpa_scaling_event_time (event_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE image_pull (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  pod_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pod_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  image varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL,
+  registry varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  succeeded enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  duration bigint unsigned NULL DEFAULT NULL,
+  size bigint unsigned NULL DEFAULT NULL,
+  attempts int unsigned NOT NULL,
+  failure enum('unauthorized', 'not_found', 'rate_limited', 'timeout', 'network', 'other') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  error text NULL DEFAULT NULL,
+  first_seen bigint unsigned NOT NULL,
+  last_seen bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_image_pull_cluster_uuid_registry (cluster_uuid, registry, last_seen),
+  INDEX idx_image_pull_last_seen (last_seen)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE image_pull_secret_issue (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  kind enum('no_secret', 'missing', 'unused') COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  workload_kind varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  workload_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  secret_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  registry varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  image varchar(512) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_image_pull_secret_issue_cluster_uuid_computed (cluster_uuid, computed)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE image_pull_secret_usage (
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  secret_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  workload_kind varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  workload_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pods int unsigned NOT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (cluster_uuid, namespace, secret_name, workload_kind, workload_name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE ingress (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -325,6 +768,25 @@ CREATE TABLE ingress_backend_service (
   PRIMARY KEY (service_uuid, ingress_uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE ingress_conflict (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  ingress_uuid binary(16) NOT NULL,
+  ingress_rule_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  ingress_class varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  host varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  path varchar(1024) COLLATE utf8mb4_unicode_ci NOT NULL,
+  path_type enum('Exact', 'Prefix', 'ImplementationSpecific') COLLATE utf8mb4_unicode_ci NOT NULL,
+  backend varchar(1024) COLLATE utf8mb4_unicode_ci NOT NULL,
+  conflicting_ingresses text NOT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_ingress_conflict_ingress_uuid (ingress_uuid),
+  INDEX idx_ingress_conflict_cluster_uuid_computed (cluster_uuid, computed)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE ingress_rule (
   uuid binary(16) NOT NULL,
   backend_uuid binary(16) NOT NULL,
@@ -342,8 +804,60 @@ CREATE TABLE ingress_tls (
   PRIMARY KEY (ingress_uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE istio_gateway (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  selector text NOT NULL,
+  yaml mediumblob DEFAULT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE istio_gateway_server (
+  uuid binary(16) NOT NULL,
+  istio_gateway_uuid binary(16) NOT NULL,
+  port_number int unsigned NOT NULL,
+  port_name varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  protocol varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  hosts text NOT NULL,
+  tls_mode varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_istio_gateway_server_istio_gateway_uuid (istio_gateway_uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE istio_virtual_service (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  hosts text NOT NULL,
+  gateways text NOT NULL,
+  http_routes int unsigned NOT NULL,
+  tcp_routes int unsigned NOT NULL,
+  tls_routes int unsigned NOT NULL,
+  yaml mediumblob DEFAULT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE istio_virtual_service_destination (
+  istio_virtual_service_uuid binary(16) NOT NULL,
+  host varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  subset varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  port int unsigned NOT NULL,
+  weight int unsigned NOT NULL,
+  PRIMARY KEY (istio_virtual_service_uuid, host, subset, port)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE job (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -363,6 +877,8 @@ CREATE TABLE job (
   yaml mediumblob DEFAULT NULL,
   icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
   icinga_state_reason text NOT NULL,
+  last_change_manager varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_changed bigint unsigned NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -384,6 +900,26 @@ CREATE TABLE job_condition (
   PRIMARY KEY (job_uuid, type)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE job_failure (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  job_uuid binary(16) NOT NULL,
+  pod_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  job_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pod_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  container_name varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  exit_code int NULL DEFAULT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  logs mediumtext NULL DEFAULT NULL,
+  events text NULL DEFAULT NULL,
+  failed bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_job_failure_cluster_uuid_failed (cluster_uuid, failed),
+  INDEX idx_job_failure_job_uuid_failed (job_uuid, failed)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE job_label (
   job_uuid binary(16) NOT NULL,
   label_uuid binary(16) NOT NULL,
@@ -403,11 +939,15 @@ CREATE TABLE job_owner (
 
 CREATE TABLE namespace (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL, /* TODO: Remove. A namespace does not have a namespace. */
   name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
   resource_version varchar(255) NOT NULL,
   phase enum('Active', 'Terminating') COLLATE utf8mb4_unicode_ci NOT NULL,
+  pod_security_enforce enum('privileged', 'baseline', 'restricted') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  pod_security_audit enum('privileged', 'baseline', 'restricted') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  pod_security_warn enum('privileged', 'baseline', 'restricted') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
   yaml mediumblob DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
@@ -429,6 +969,20 @@ CREATE TABLE namespace_condition (
   PRIMARY KEY (namespace_uuid, type)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE namespace_health (
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_type enum('argo_application', 'daemon_set', 'deployment', 'flux_kustomization', 'job', 'olm_cluster_service_version', 'olm_subscription', 'pod', 'pvc', 'replica_set', 'stateful_set', 'velero_backup', 'velero_restore', 'velero_schedule') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state enum('ok', 'pending', 'unknown', 'warning', 'critical') COLLATE utf8mb4_unicode_ci NOT NULL,
+  ok int unsigned NOT NULL,
+  pending int unsigned NOT NULL,
+  unknown int unsigned NOT NULL,
+  warning int unsigned NOT NULL,
+  critical int unsigned NOT NULL,
+  updated bigint unsigned NOT NULL,
+  PRIMARY KEY (cluster_uuid, namespace, resource_type)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE namespace_label (
   namespace_uuid binary(16) NOT NULL,
   label_uuid binary(16) NOT NULL,
@@ -437,6 +991,7 @@ CREATE TABLE namespace_label (
 
 CREATE TABLE node (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -444,6 +999,7 @@ CREATE TABLE node (
   pod_cidr varchar(255) NOT NULL,
   num_ips int unsigned NOT NULL,
   unschedulable enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  draining enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
   ready enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
   cpu_capacity bigint unsigned NOT NULL,
   cpu_allocatable bigint unsigned NOT NULL,
@@ -485,6 +1041,76 @@ CREATE TABLE node_condition (
   PRIMARY KEY (node_uuid, type)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE node_disk (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  node_uuid binary(16) NOT NULL,
+  device varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  model varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  serial varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  healthy enum('n', 'y') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  temperature double NULL DEFAULT NULL,
+  power_on_hours bigint unsigned NULL DEFAULT NULL,
+  reallocated_sectors bigint unsigned NULL DEFAULT NULL,
+  pending_sectors bigint unsigned NULL DEFAULT NULL,
+  offline_uncorrectable bigint unsigned NULL DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  updated bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_node_disk_cluster_uuid_updated (cluster_uuid, updated),
+  INDEX idx_node_disk_node_uuid (node_uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE node_drain_risk (
+  uuid binary(16) NOT NULL,
+  node_uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  score double NOT NULL,
+  pods int unsigned NOT NULL,
+  violating_pods int unsigned NOT NULL,
+  violated_pdbs int unsigned NOT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_node_drain_risk_node_uuid (node_uuid),
+  INDEX idx_node_drain_risk_cluster_uuid_computed (cluster_uuid, computed)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE node_drain_risk_pdb (
+  uuid binary(16) NOT NULL,
+  node_uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pdb_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pods int unsigned NOT NULL,
+  disruptions_allowed int unsigned NOT NULL,
+  excess int unsigned NOT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_node_drain_risk_pdb_node_uuid (node_uuid),
+  INDEX idx_node_drain_risk_pdb_cluster_uuid_computed (cluster_uuid, computed)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE node_fragmentation (
+  uuid binary(16) NOT NULL,
+  node_uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  node_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  cpu_allocatable bigint unsigned NOT NULL,
+  cpu_requests bigint unsigned NOT NULL,
+  memory_allocatable bigint unsigned NOT NULL,
+  memory_requests bigint unsigned NOT NULL,
+  pods_allocatable bigint unsigned NOT NULL,
+  pods bigint unsigned NOT NULL,
+  largest_pod_cpu bigint unsigned NOT NULL,
+  largest_pod_memory bigint unsigned NOT NULL,
+  unschedulable_reason enum('not_ready', 'cordoned', 'tainted', 'pods_exceeded') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_node_fragmentation_node_uuid (node_uuid),
+  INDEX idx_node_fragmentation_cluster_uuid_computed (cluster_uuid, computed)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE node_label (
   node_uuid binary(16) NOT NULL,
   label_uuid binary(16) NOT NULL,
@@ -499,8 +1125,53 @@ CREATE TABLE node_volume (
   PRIMARY KEY (node_uuid, name)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE olm_cluster_service_version (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  display_name varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  version varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  replaces varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  phase varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  message text NULL DEFAULT NULL,
+  copied_from varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE olm_subscription (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  package varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  channel varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  source varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  source_namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  install_plan_approval enum('Automatic', 'Manual') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  status varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  current_csv varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  installed_csv varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  install_plan varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE persistent_volume (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -530,6 +1201,7 @@ CREATE TABLE persistent_volume_claim_ref (
 
 CREATE TABLE pod (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -548,6 +1220,15 @@ CREATE TABLE pod (
   reason varchar(255) NULL DEFAULT NULL,
   message text NULL DEFAULT NULL,
   qos enum('Guaranteed', 'Burstable', 'BestEffort') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  privileged enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  run_as_root enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  host_network enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  host_pid enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  host_ipc enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  allow_privilege_escalation enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  capabilities text NULL DEFAULT NULL,
+  seccomp_profile enum('RuntimeDefault', 'Localhost', 'Unconfined') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  pod_security_level enum('privileged', 'baseline', 'restricted') COLLATE utf8mb4_unicode_ci NOT NULL,
   yaml mediumblob DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
@@ -570,6 +1251,23 @@ CREATE TABLE pod_condition (
   PRIMARY KEY (pod_uuid, type)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE pod_eviction (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  pod_uuid binary(16) NOT NULL,
+  node_uuid binary(16) NULL DEFAULT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pod_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  node_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  kind enum('node_pressure', 'preemption', 'api', 'taint', 'pod_gc') COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  event_time bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_pod_eviction_cluster_uuid_event_time (cluster_uuid, event_time),
+  INDEX idx_pod_eviction_node_uuid_event_time (node_uuid, event_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE pod_label (
   pod_uuid binary(16) NOT NULL,
   label_uuid binary(16) NOT NULL,
@@ -619,40 +1317,111 @@ CREATE TABLE pod_volume (
 CREATE TABLE prometheus_cluster_metric (
     cluster_uuid binary(16) NOT NULL,
     timestamp bigint NOT NULL,
+    until bigint NOT NULL,
     category varchar(255) NOT NULL,
     name varchar(255) NOT NULL,
     value double NOT NULL,
-    PRIMARY KEY (cluster_uuid, timestamp, category, name)
+    PRIMARY KEY (cluster_uuid, timestamp, category, name),
+    INDEX idx_prometheus_cluster_metric_timestamp (timestamp)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
 CREATE TABLE prometheus_container_metric (
     container_uuid binary(16) NOT NULL,
     timestamp bigint NOT NULL,
+    until bigint NOT NULL,
     category varchar(255) NOT NULL,
     name varchar(255) NOT NULL,
     value double NOT NULL,
-    PRIMARY KEY (container_uuid, timestamp, category, name)
+    PRIMARY KEY (container_uuid, timestamp, category, name),
+    INDEX idx_prometheus_container_metric_timestamp (timestamp)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 CREATE TABLE prometheus_node_metric (
     node_uuid binary(16) NOT NULL,
     timestamp bigint NOT NULL,
+    until bigint NOT NULL,
     category varchar(255) NOT NULL,
     name varchar(255) NOT NULL,
     value double NOT NULL,
-    PRIMARY KEY (node_uuid, timestamp, category, name)
+    PRIMARY KEY (node_uuid, timestamp, category, name),
+    INDEX idx_prometheus_node_metric_timestamp (timestamp)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
 CREATE TABLE prometheus_pod_metric (
     pod_uuid binary(16) NOT NULL,
     timestamp bigint NOT NULL,
+    until bigint NOT NULL,
+    category varchar(255) NOT NULL,
+    name varchar(255) NOT NULL,
+    value double NOT NULL,
+    PRIMARY KEY (pod_uuid, timestamp, category, name),
+    INDEX idx_prometheus_pod_metric_timestamp (timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE prometheus_service_metric (
+    service_uuid binary(16) NOT NULL,
+    timestamp bigint NOT NULL,
+    until bigint NOT NULL,
     category varchar(255) NOT NULL,
     name varchar(255) NOT NULL,
     value double NOT NULL,
-    PRIMARY KEY (pod_uuid, timestamp, category, name)
+    PRIMARY KEY (service_uuid, timestamp, category, name),
+    INDEX idx_prometheus_service_metric_timestamp (timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE probe (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  kind enum('service', 'ingress', 'dns') COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  target varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL,
+  protocol enum('tcp', 'http', 'https', 'dns') COLLATE utf8mb4_unicode_ci NOT NULL,
+  reachable enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  status_code smallint unsigned NULL DEFAULT NULL,
+  response_time bigint unsigned NULL DEFAULT NULL,
+  error text NULL DEFAULT NULL,
+  checked bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_probe_cluster_uuid_namespace (cluster_uuid, namespace)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE problem (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  pod_uuid binary(16) NOT NULL,
+  container_uuid binary(16) NULL DEFAULT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  pod_name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  container_name varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  blocking_constraint enum('insufficient_resources', 'taint', 'node_affinity', 'pod_affinity', 'volume', 'other') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  blocking_constraint_detail varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  logs mediumtext NULL DEFAULT NULL,
+  events text NULL DEFAULT NULL,
+  in_downtime enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  started bigint unsigned NOT NULL,
+  cleared bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_problem_cluster_uuid_cleared (cluster_uuid, cleared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE problem_comment (
+  uuid binary(16) NOT NULL,
+  problem_uuid binary(16) NOT NULL,
+  author varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  comment text COLLATE utf8mb4_unicode_ci NOT NULL,
+  acknowledgement enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  created bigint unsigned NOT NULL,
+  annotated bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_problem_comment_problem_uuid (problem_uuid),
+  INDEX idx_problem_comment_annotated (annotated)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
 CREATE TABLE pvc (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -665,6 +1434,8 @@ CREATE TABLE pvc (
   volume_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
   volume_mode enum('Block', 'Filesystem') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
   storage_class varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
   yaml mediumblob DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
@@ -695,6 +1466,7 @@ CREATE TABLE pvc_label (
 
 CREATE TABLE replica_set (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -708,6 +1480,8 @@ CREATE TABLE replica_set (
   yaml mediumblob DEFAULT NULL,
   icinga_state enum('unknown', 'ok', 'warning', 'critical') COLLATE utf8mb4_unicode_ci NOT NULL,
   icinga_state_reason text NOT NULL,
+  last_change_manager varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_changed bigint unsigned NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -745,14 +1519,78 @@ CREATE TABLE replica_set_owner (
   PRIMARY KEY (replica_set_uuid, owner_uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE resource_quota_forecast (
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  hard double NOT NULL,
+  used double NOT NULL,
+  growth_per_day double NULL DEFAULT NULL,
+  days_until_exhaustion double NULL DEFAULT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (cluster_uuid, namespace, name, resource)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE resource_quota_problem (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  hard double NOT NULL,
+  used double NOT NULL,
+  exhausted bigint unsigned NOT NULL,
+  started bigint unsigned NOT NULL,
+  cleared bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_resource_quota_problem_cluster_uuid_cleared (cluster_uuid, cleared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE resource_quota_usage (
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  timestamp bigint unsigned NOT NULL,
+  hard double NOT NULL,
+  used double NOT NULL,
+  PRIMARY KEY (cluster_uuid, namespace, name, resource, timestamp),
+  INDEX idx_resource_quota_usage_timestamp (timestamp)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE route (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  host varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  path varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  service_name varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  target_port varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  tls_termination enum('edge', 'passthrough', 'reencrypt') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  insecure_edge_termination_policy enum('None', 'Allow', 'Redirect') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  wildcard_policy varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  admitted enum('n', 'y') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  admitted_reason text NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE secret (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
   resource_version varchar(255) NOT NULL,
-  type varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
-  immutable enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  type varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  immutable enum('n', 'y') COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -778,6 +1616,7 @@ CREATE TABLE selector (
 
 CREATE TABLE service (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -835,6 +1674,21 @@ CREATE TABLE service_port (
   PRIMARY KEY (service_uuid, name)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE service_problem (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  service_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  message text NULL DEFAULT NULL,
+  not_ready_endpoints int unsigned NOT NULL,
+  started bigint unsigned NOT NULL,
+  cleared bigint unsigned NULL DEFAULT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_service_problem_cluster_uuid_cleared (cluster_uuid, cleared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE service_selector (
   service_uuid binary(16) NOT NULL,
   selector_uuid binary(16) NOT NULL,
@@ -843,6 +1697,7 @@ CREATE TABLE service_selector (
 
 CREATE TABLE stateful_set (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
   name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
   uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
@@ -863,6 +1718,8 @@ CREATE TABLE stateful_set (
   yaml mediumblob DEFAULT NULL,
   icinga_state enum('unknown', 'ok', 'warning', 'critical') COLLATE utf8mb4_unicode_ci NOT NULL,
   icinga_state_reason text NOT NULL,
+  last_change_manager varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_changed bigint unsigned NULL DEFAULT NULL,
   created bigint unsigned NOT NULL,
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -900,8 +1757,137 @@ CREATE TABLE stateful_set_owner (
   PRIMARY KEY (stateful_set_uuid, owner_uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
+CREATE TABLE state_history (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  resource_type enum('argo_application', 'daemon_set', 'deployment', 'flux_kustomization', 'job', 'node', 'olm_cluster_service_version', 'olm_subscription', 'pod', 'pvc', 'replica_set', 'stateful_set', 'velero_backup', 'velero_restore', 'velero_schedule') COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_uuid binary(16) NOT NULL,
+  event_time bigint unsigned NOT NULL,
+  previous_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  reason text NULL DEFAULT NULL,
+  in_downtime enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_state_history_resource_uuid_event_time (resource_uuid, event_time),
+  INDEX idx_state_history_event_time (event_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE upgrade_readiness (
+  cluster_uuid binary(16) NOT NULL,
+  target_version varchar(15) NOT NULL,
+  current_version varchar(63) NOT NULL,
+  ready enum('n', 'y') NOT NULL,
+  issues int unsigned NOT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (cluster_uuid, target_version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE upgrade_readiness_issue (
+  cluster_uuid binary(16) NOT NULL,
+  target_version varchar(15) NOT NULL,
+  source enum('object', 'request', 'warning') NOT NULL,
+  api_version varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  manager varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  removed_in varchar(15) NOT NULL,
+  replacement varchar(255) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  computed bigint unsigned NOT NULL,
+  PRIMARY KEY (cluster_uuid, target_version, source, api_version, resource, namespace, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE velero_backup (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  phase varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  schedule_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  storage_location varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  started bigint unsigned NULL DEFAULT NULL,
+  completed bigint unsigned NULL DEFAULT NULL,
+  expiration bigint unsigned NULL DEFAULT NULL,
+  total_items int unsigned NOT NULL,
+  items_backed_up int unsigned NOT NULL,
+  errors int unsigned NOT NULL,
+  warnings int unsigned NOT NULL,
+  failure_reason text NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_velero_backup_cluster_uuid_namespace_schedule_name (cluster_uuid, namespace, schedule_name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE velero_restore (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  phase varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  backup_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  schedule_name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  started bigint unsigned NULL DEFAULT NULL,
+  completed bigint unsigned NULL DEFAULT NULL,
+  total_items int unsigned NOT NULL,
+  items_restored int unsigned NOT NULL,
+  errors int unsigned NOT NULL,
+  warnings int unsigned NOT NULL,
+  failure_reason text NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE velero_schedule (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  namespace varchar(63) COLLATE utf8mb4_unicode_ci NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NOT NULL,
+  uid varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_version varchar(255) NOT NULL,
+  schedule varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  paused enum('n', 'y') COLLATE utf8mb4_unicode_ci NOT NULL,
+  phase varchar(63) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  last_backup bigint unsigned NULL DEFAULT NULL,
+  last_successful_backup bigint unsigned NULL DEFAULT NULL,
+  yaml mediumblob DEFAULT NULL,
+  icinga_state enum('pending', 'ok', 'warning', 'critical', 'unknown') COLLATE utf8mb4_unicode_ci NOT NULL,
+  icinga_state_reason text NOT NULL,
+  created bigint unsigned NOT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE flapping_history (
+  uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
+  resource_type enum('argo_application', 'daemon_set', 'deployment', 'flux_kustomization', 'job', 'node', 'olm_cluster_service_version', 'olm_subscription', 'pod', 'pvc', 'replica_set', 'stateful_set', 'velero_backup', 'velero_restore', 'velero_schedule') COLLATE utf8mb4_unicode_ci NOT NULL,
+  resource_uuid binary(16) NOT NULL,
+  start_time bigint unsigned NOT NULL,
+  end_time bigint unsigned NULL DEFAULT NULL,
+  state_changes int unsigned NOT NULL,
+  PRIMARY KEY (uuid),
+  INDEX idx_flapping_history_resource_uuid_start_time (resource_uuid, start_time),
+  INDEX idx_flapping_history_end_time (end_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE cluster (
+  uuid binary(16) NOT NULL,
+  name varchar(253) COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL,
+  PRIMARY KEY (uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE kubernetes_instance (
   uuid binary(16) NOT NULL,
+  cluster_uuid binary(16) NOT NULL,
   version varchar(255) NOT NULL,
   kubernetes_version varchar(255) NOT NULL,
   kubernetes_heartbeat bigint unsigned NULL DEFAULT NULL,
@@ -911,6 +1897,25 @@ CREATE TABLE kubernetes_instance (
   PRIMARY KEY (uuid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin ROW_FORMAT=DYNAMIC;
 
+CREATE TABLE kubernetes_instance_controller (
+  instance_uuid binary(16) NOT NULL,
+  name varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  last_sync bigint unsigned NULL DEFAULT NULL,
+  last_event bigint unsigned NULL DEFAULT NULL,
+  queue_depth int unsigned NOT NULL,
+  errors bigint unsigned NOT NULL,
+  PRIMARY KEY (instance_uuid, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE kubernetes_instance_metric (
+  instance_uuid binary(16) NOT NULL,
+  kind varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  category varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  last_query bigint unsigned NOT NULL,
+  backlog int unsigned NOT NULL,
+  PRIMARY KEY (instance_uuid, kind, category)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
 CREATE TABLE kubernetes_schema (
   id int unsigned NOT NULL AUTO_INCREMENT,
   version varchar(255) NOT NULL,
@@ -922,4 +1927,4 @@ CREATE TABLE kubernetes_schema (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
 
 INSERT INTO kubernetes_schema (version, timestamp, success, reason)
-VALUES ('0.1.0', UNIX_TIMESTAMP() * 1000, 'y', 'Initial import');
+VALUES ('0.2.0', UNIX_TIMESTAMP() * 1000, 'y', 'Initial import');